@@ -0,0 +1,55 @@
+package main
+
+import "fmt"
+
+// code128Widths — ширины штрихов и пробелов символов Code 128 (бар,
+// пробел, бар, ...), индекс — значение символа. 103–105 — Start A/B/C.
+var code128Widths = [...]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232",
+}
+
+const (
+	code128StartB = 104
+	code128Stop   = "2331112"
+)
+
+// code128 кодирует s набором B (ASCII 32–127) с контрольным символом и
+// возвращает модули штрихкода: true — чёрный.
+func code128(s string) ([]bool, error) {
+	values := []int{code128StartB}
+	for _, c := range []byte(s) {
+		if c < 32 || c > 127 {
+			return nil, fmt.Errorf("code128: %q is outside code set B", c)
+		}
+		values = append(values, int(c)-32)
+	}
+	sum := values[0]
+	for i, v := range values[1:] {
+		sum += (i + 1) * v
+	}
+	values = append(values, sum%103)
+
+	var modules []bool
+	emit := func(widths string) {
+		for i, w := range widths {
+			for n := 0; n < int(w-'0'); n++ {
+				modules = append(modules, i%2 == 0)
+			}
+		}
+	}
+	for _, v := range values {
+		emit(code128Widths[v])
+	}
+	emit(code128Stop)
+	return modules, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"pkg/config"
+)
+
+// Config — конфигурация delivery-service. Загружается и проверяется при
+// старте (config.MustLoad); -print-config выводит её и завершает процесс.
+type Config struct {
+	config.Common
+	config.HTTPClient
+	config.Consistency
+
+	Port        string `env:"PORT" default:"8004"`
+	DatabaseURL string `env:"DATABASE_URL" required:"true"`
+
+	StreamMaxConnections int64         `env:"STREAM_MAX_CONNECTIONS" default:"100" min:"1"`
+	WebhookPollInterval  time.Duration `env:"WEBHOOK_POLL_INTERVAL" default:"2s" min:"1ms"`
+	WebhookMaxAttempts   int           `env:"WEBHOOK_MAX_ATTEMPTS" default:"8" min:"1"`
+	ExportMaxRows        int           `env:"DELIVERY_EXPORT_MAX_ROWS" default:"10000" min:"1"`
+	// Адрес вне зон доставки: reject — 422, warn — доставка создаётся с
+	// предупреждением (на время перехода), off — без проверки.
+	CoverageMode string `env:"DELIVERY_COVERAGE_MODE" default:"reject" oneof:"reject,warn,off"`
+
+	// Окна "HH:MM-HH:MM" по UTC и вместимость; см. initDeliverySlots.
+	DeliverySlots            string `env:"DELIVERY_SLOTS" default:"08:00-10:00,10:00-12:00,12:00-14:00,14:00-16:00,16:00-18:00,18:00-20:00,20:00-22:00"`
+	DeliverySlotCapacity     int    `env:"DELIVERY_SLOT_CAPACITY" default:"20" min:"0"`
+	DeliveryZoneSlotCapacity string `env:"DELIVERY_ZONE_SLOT_CAPACITY"`
+
+	// SMS покупателю; без URL сервисов телефон не найти и SMS выключены.
+	OrdersServiceURL string        `env:"ORDERS_SERVICE_URL" url:"true"`
+	UsersServiceURL  string        `env:"USERS_SERVICE_URL" url:"true"`
+	SMSProvider      string        `env:"SMS_PROVIDER" default:"log" oneof:"log,http"`
+	SMSHTTPURL       string        `env:"SMS_HTTP_URL" url:"true"`
+	SMSAPIKey        string        `env:"SMS_API_KEY" secret:"true"`
+	SMSTimeout       time.Duration `env:"SMS_TIMEOUT" default:"3s" min:"1ms"`
+	SMSPollInterval  time.Duration `env:"SMS_POLL_INTERVAL" default:"5s" min:"1ms"`
+	SMSMaxAttempts   int           `env:"SMS_MAX_ATTEMPTS" default:"5" min:"1"`
+
+	// Сколько кэшируются настройки уведомлений покупателя; за это время их
+	// изменение вступает в силу.
+	NotificationPreferencesTTL time.Duration `env:"NOTIFICATION_PREFERENCES_TTL" default:"30s" min:"0s"`
+
+	// Демо-режим: доставки с simulated=true проходят статусы, события и
+	// координаты курьера сами за DELIVERY_SIMULATION_DURATION.
+	DeliverySimulation     bool          `env:"DELIVERY_SIMULATION"`
+	SimulationDuration     time.Duration `env:"DELIVERY_SIMULATION_DURATION" default:"3m" min:"10s"`
+	SimulationTickInterval time.Duration `env:"DELIVERY_SIMULATION_TICK" default:"5s" min:"100ms"`
+
+	// Читает pkg/dedup.
+	ProcessedEventsRetention     time.Duration `env:"PROCESSED_EVENTS_RETENTION" default:"168h" min:"1s"`
+	ProcessedEventsPruneInterval time.Duration `env:"PROCESSED_EVENTS_PRUNE_INTERVAL" default:"1h" min:"1s"`
+}
+
+func (c *Config) Validate() []error {
+	var errs []error
+	if _, err := parseSlotWindows(c.DeliverySlots); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := parseZoneSlotCapacity(c.DeliveryZoneSlotCapacity); err != nil {
+		errs = append(errs, err)
+	}
+	if c.SMSProvider == "http" && c.SMSHTTPURL == "" {
+		errs = append(errs, fmt.Errorf("SMS_HTTP_URL is required when SMS_PROVIDER=http"))
+	}
+	return errs
+}
+
+var cfg Config
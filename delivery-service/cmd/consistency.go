@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"pkg/clients"
+	"pkg/consistency"
+)
+
+// deliveryOrderMissing — доставка заказа, которого нет в orders-service.
+const deliveryOrderMissing = "delivery_order_missing"
+
+var consistencyChecker *consistency.Checker
+
+// startConsistencyCheck проверяет order_id доставок по orders-service
+// (GET /orders?ids=, архивные заказы тоже находятся); без
+// ORDERS_SERVICE_URL проверять не с чем.
+func startConsistencyCheck(ctx context.Context, orders *clients.Orders) {
+	var checks []consistency.Check
+	if cfg.OrdersServiceURL != "" {
+		checks = append(checks, consistency.Check{
+			Type:   deliveryOrderMissing,
+			Table:  "deliveries",
+			Column: "order_id",
+			Lookup: orders.Existing,
+		})
+	} else {
+		log.Printf("ℹ️ ORDERS_SERVICE_URL not set, delivery consistency check disabled")
+	}
+	consistencyChecker = consistency.New(db, cfg.Consistency, checks...)
+	consistencyChecker.Start(ctx)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+)
+
+// Courier — справочные данные курьера для выгрузок и партнёров.
+type Courier struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+// @Summary Upsert courier
+// @Description Создать или переименовать курьера. Требует X-Internal-API-Key.
+// @Tags couriers
+// @Accept json
+// @Produce json
+// @Param id path int true "Courier ID"
+// @Param courier body Courier true "Courier"
+// @Success 200 {object} Courier
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /admin/couriers/{id} [put]
+func putCourier(w http.ResponseWriter, r *http.Request) {
+	var c Courier
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	c.ID, _ = strconv.Atoi(mux.Vars(r)["id"])
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" || len(c.Name) > 255 {
+		apierr.Write(w, apierr.InvalidRequest, "name is required (up to 255 characters)")
+		return
+	}
+
+	err := db.QueryRowContext(r.Context(),
+		`INSERT INTO couriers (id, name) VALUES ($1, $2)
+		 ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, updated_at = NOW()
+		 RETURNING id, name, updated_at`, c.ID, c.Name).Scan(&c.ID, &c.Name, &c.UpdatedAt)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"pkg/apierr"
+)
+
+// Проверка покрытия: попадает ли адрес в зону доставки. Адрес попадает в
+// зону, если его координаты не дальше radius_km от склада зоны или его
+// почтовый индекс начинается с одного из postcodes зоны. Зоны без
+// radius_km и postcodes не участвуют; пока таких зон нет вовсе, проверка
+// выключена. Без координат и индекса адрес проверить нельзя, и он
+// пропускается.
+
+var (
+	postcodePrefixRe = regexp.MustCompile(`^[0-9]{1,6}$`)
+	postcodeRe       = regexp.MustCompile(`^[0-9]{6}$`)
+	// addressPostcodeRe — шестизначный индекс в тексте адреса.
+	addressPostcodeRe = regexp.MustCompile(`(?:^|[^0-9])([0-9]{6})(?:[^0-9]|$)`)
+)
+
+// NearestZone — ближайшая обслуживаемая зона для адреса вне покрытия.
+// DistanceKm — расстояние до границы зоны.
+type NearestZone struct {
+	ZoneID     int     `json:"zone_id"`
+	Name       string  `json:"name"`
+	DistanceKm float64 `json:"distance_km"`
+}
+
+// Coverage — результат проверки адреса. Zone — зона, в которую попал
+// адрес; Nearest — подсказка для адреса вне покрытия (только при
+// известных координатах).
+type Coverage struct {
+	Covered bool         `json:"covered"`
+	Zone    *Zone        `json:"zone,omitempty"`
+	Nearest *NearestZone `json:"nearest_zone,omitempty"`
+	// Checked — false, если проверять не по чему: нет зон с территорией
+	// или у адреса нет ни координат, ни индекса.
+	Checked bool `json:"checked"`
+}
+
+// addressPostcode достаёт шестизначный почтовый индекс из адреса.
+func addressPostcode(address string) string {
+	if m := addressPostcodeRe.FindStringSubmatch(address); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// hasArea сообщает, что у зоны задана обслуживаемая территория.
+func (z *Zone) hasArea() bool {
+	return (z.RadiusKm != nil && z.DepotLat != nil) || len(z.Postcodes) > 0
+}
+
+// resolveCoverage находит зону адреса. По координатам из подходящих зон
+// берётся самая узкая (меньший radius_km), по индексу — зона с самым
+// длинным совпавшим префиксом; координаты проверяются первыми.
+func resolveCoverage(zones []Zone, lat, lon *float64, postcode string) Coverage {
+	var c Coverage
+	served := false
+	for i := range zones {
+		served = served || zones[i].hasArea()
+	}
+	if !served || (lat == nil && postcode == "") {
+		return Coverage{Covered: true}
+	}
+	c.Checked = true
+
+	if lat != nil {
+		for i := range zones {
+			z := &zones[i]
+			if z.RadiusKm == nil || z.DepotLat == nil {
+				continue
+			}
+			outside := distanceKm(*z.DepotLat, *z.DepotLon, *lat, *lon) - *z.RadiusKm
+			if outside <= 0 {
+				if c.Zone == nil || *z.RadiusKm < *c.Zone.RadiusKm {
+					c.Zone = z
+				}
+			} else if c.Nearest == nil || outside < c.Nearest.DistanceKm {
+				c.Nearest = &NearestZone{ZoneID: z.ID, Name: z.Name, DistanceKm: math.Round(outside*10) / 10}
+			}
+		}
+	}
+	if c.Zone == nil && postcode != "" {
+		best := 0
+		for i := range zones {
+			for _, prefix := range zones[i].Postcodes {
+				if len(prefix) > best && strings.HasPrefix(postcode, prefix) {
+					c.Zone, best = &zones[i], len(prefix)
+				}
+			}
+		}
+	}
+	if c.Zone != nil {
+		c.Covered, c.Nearest = true, nil
+	}
+	return c
+}
+
+// applyCoverage проверяет адрес доставки при создании. Доставке без
+// zone_id назначается найденная зона (от неё считается fee). Адрес вне
+// покрытия при DELIVERY_COVERAGE_MODE=reject отклоняется с
+// outside_service_area, при warn — доставка создаётся с предупреждением в
+// warnings.
+func applyCoverage(r *http.Request, q queryer, d *Delivery) error {
+	if cfg.CoverageMode == "off" {
+		return nil
+	}
+	zones, err := loadZones(r.Context(), q)
+	if err != nil {
+		return err
+	}
+	c := resolveCoverage(zones, d.Lat, d.Lon, addressPostcode(d.Address))
+	if c.Covered {
+		if c.Zone != nil && d.ZoneID == nil {
+			d.ZoneID = &c.Zone.ID
+		}
+		return nil
+	}
+
+	if cfg.CoverageMode == "warn" {
+		log.Printf("⚠️ Delivery for order %d is outside the service area (%q)", d.OrderID, d.Address)
+		d.Warnings = append(d.Warnings, "address is outside the service area")
+		return nil
+	}
+	e := apierr.New(apierr.OutsideServiceArea, "address is outside the service area")
+	if c.Nearest != nil {
+		e = e.With("nearest_zone", c.Nearest)
+	}
+	return e
+}
+
+// @Summary Check delivery coverage
+// @Description Попадает ли точка или почтовый индекс в зону доставки, чтобы проверить адрес до оформления. Для точки вне покрытия — ближайшая зона и расстояние до её границы. checked=false — проверять не по чему (зоны без территории), адрес будет принят.
+// @Tags zones
+// @Produce json
+// @Param lat query number false "Широта (вместе с lon)"
+// @Param lon query number false "Долгота (вместе с lat)"
+// @Param postcode query string false "Почтовый индекс, 6 цифр"
+// @Success 200 {object} Coverage
+// @Failure 400 {object} map[string]string
+// @Router /coverage [get]
+func getCoverage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var lat, lon *float64
+	if q.Get("lat") != "" || q.Get("lon") != "" {
+		la, err1 := strconv.ParseFloat(q.Get("lat"), 64)
+		lo, err2 := strconv.ParseFloat(q.Get("lon"), 64)
+		if err1 != nil || err2 != nil {
+			apierr.Write(w, apierr.InvalidRequest, "lat and lon must be numbers and set together")
+			return
+		}
+		lat, lon = &la, &lo
+		if err := validateCoordinates(&Delivery{Lat: lat, Lon: lon}); err != nil {
+			apierr.Write(w, apierr.InvalidRequest, err.Error())
+			return
+		}
+	}
+	postcode := strings.TrimSpace(q.Get("postcode"))
+	if postcode != "" && !postcodeRe.MatchString(postcode) {
+		apierr.Write(w, apierr.InvalidRequest, fmt.Sprintf("postcode %q must be 6 digits", postcode))
+		return
+	}
+	if lat == nil && postcode == "" {
+		apierr.Write(w, apierr.InvalidRequest, "lat/lon or postcode is required")
+		return
+	}
+
+	zones, err := loadZones(r.Context(), db)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resolveCoverage(zones, lat, lon, postcode))
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func ptr(v float64) *float64 { return &v }
+
+func TestResolveCoverage(t *testing.T) {
+	zones := []Zone{
+		{ID: 1, Name: "Center", DepotLat: ptr(55.7558), DepotLon: ptr(37.6173), RadiusKm: ptr(15), Postcodes: []string{"101"}},
+		{ID: 2, Name: "Suburbs", DepotLat: ptr(55.7558), DepotLon: ptr(37.6173), RadiusKm: ptr(50), Postcodes: []string{"14"}},
+		{ID: 3, Name: "Pickup only"},
+	}
+
+	// Точка в обеих зонах попадает в более узкую.
+	if c := resolveCoverage(zones, ptr(55.76), ptr(37.62), ""); !c.Covered || c.Zone == nil || c.Zone.ID != 1 {
+		t.Errorf("center point: %+v", c)
+	}
+	// Санкт-Петербург вне зон; подсказка — граница Suburbs.
+	c := resolveCoverage(zones, ptr(59.9343), ptr(30.3351), "")
+	if c.Covered || !c.Checked || c.Nearest == nil || c.Nearest.ZoneID != 2 || c.Nearest.DistanceKm < 550 {
+		t.Errorf("outside point: %+v (nearest %+v)", c, c.Nearest)
+	}
+	// По индексу — самый длинный префикс.
+	if c := resolveCoverage(zones, nil, nil, "141700"); !c.Covered || c.Zone.ID != 2 {
+		t.Errorf("postcode 141700: %+v", c)
+	}
+	if c := resolveCoverage(zones, nil, nil, "190000"); c.Covered {
+		t.Errorf("postcode 190000 covered by zone %d", c.Zone.ID)
+	}
+	// Без координат и индекса, как и без зон с территорией, проверки нет.
+	if c := resolveCoverage(zones, nil, nil, ""); !c.Covered || c.Checked {
+		t.Errorf("no location: %+v", c)
+	}
+	if c := resolveCoverage(zones[2:], ptr(59.9), ptr(30.3), ""); !c.Covered || c.Checked {
+		t.Errorf("no served zones: %+v", c)
+	}
+}
+
+func TestAddressPostcode(t *testing.T) {
+	for address, want := range map[string]string{
+		"101000, Москва, ул. Мясницкая, 1": "101000",
+		"Москва, Тверская 7, 125009":       "125009",
+		"Москва, Тверская 7, кв. 1234567":  "",
+		"Springfield, 742 Evergreen":       "",
+	} {
+		if got := addressPostcode(address); got != want {
+			t.Errorf("addressPostcode(%q) = %q, want %q", address, got, want)
+		}
+	}
+}
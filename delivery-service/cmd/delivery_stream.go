@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+	"pkg/pgnotify"
+)
+
+// Канал Postgres для событий отслеживания доставок.
+const deliveryEventsChannel = "delivery_events"
+
+const streamHeartbeat = 15 * time.Second
+
+// Через сколько секунд клиенту стоит переподключиться, если лимит
+// потоков исчерпан.
+const streamRetryAfter = "5"
+
+type TrackingEvent struct {
+	ID          int    `json:"id"`
+	DeliveryID  int    `json:"delivery_id"`
+	EventType   string `json:"event_type" validate:"required"`
+	Description string `json:"description"`
+	CreatedAt   string `json:"createdAt"`
+}
+
+type LocationPing struct {
+	ID         int     `json:"id"`
+	DeliveryID int     `json:"delivery_id"`
+	CourierID  *int    `json:"courier_id"`
+	Lat        float64 `json:"lat" validate:"required,min=-90,max=90"`
+	Lon        float64 `json:"lon" validate:"required,min=-180,max=180"`
+	RecordedAt string  `json:"recorded_at"`
+}
+
+type DeliverySnapshot struct {
+	Delivery       Delivery        `json:"delivery"`
+	TrackingEvents []TrackingEvent `json:"tracking_events"`
+	LastLocation   *LocationPing   `json:"last_location"`
+}
+
+var streamConnections int64
+var streamMaxConnections int64
+
+func initDeliveryStream() {
+	streamMaxConnections = cfg.StreamMaxConnections
+}
+
+// @Summary Add tracking event
+// @Description Зарегистрировать событие отслеживания доставки. Событие out_for_delivery отправляет покупателю SMS (один раз на доставку).
+// @Tags tracking
+// @Accept json
+// @Produce json
+// @Param id path int true "Delivery ID"
+// @Param event body TrackingEvent true "Tracking event"
+// @Success 201 {object} TrackingEvent
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /deliveries/{id}/tracking-events [post]
+func createTrackingEvent(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	var e TrackingEvent
+	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	if e.EventType == "" {
+		apierr.Write(w, apierr.InvalidRequest, "event_type is required")
+		return
+	}
+	e.DeliveryID = id
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	err = insertTrackingEvent(r.Context(), tx, &e)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.DeliveryNotFound, "Delivery not found")
+		return
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(e)
+}
+
+// insertTrackingEvent записывает событие e.DeliveryID в транзакции tx и
+// рассылает его подписчикам потока; out_for_delivery ставит SMS покупателю.
+// Нет доставки — sql.ErrNoRows.
+func insertTrackingEvent(ctx context.Context, tx *sql.Tx, e *TrackingEvent) error {
+	err := tx.QueryRowContext(ctx,
+		"INSERT INTO delivery_tracking_events (delivery_id, event_type, description) SELECT id, $2, $3 FROM deliveries WHERE id = $1 RETURNING id, created_at",
+		e.DeliveryID, e.EventType, e.Description,
+	).Scan(&e.ID, &e.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if err := pgnotify.Notify(tx, deliveryEventsChannel, strconv.Itoa(e.DeliveryID), "tracking", e); err != nil {
+		return err
+	}
+	if e.EventType == smsOutForDelivery {
+		return enqueueSMS(ctx, tx, e.DeliveryID, smsOutForDelivery)
+	}
+	return nil
+}
+
+// @Summary Get tracking events
+// @Description Получить историю отслеживания доставки
+// @Tags tracking
+// @Produce json
+// @Param id path int true "Delivery ID"
+// @Success 200 {array} TrackingEvent
+// @Router /deliveries/{id}/tracking-events [get]
+func getTrackingEvents(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	events, err := loadTrackingEvents(r.Context(), id)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// @Summary Record courier location
+// @Description Зарегистрировать координаты курьера по доставке
+// @Tags tracking
+// @Accept json
+// @Produce json
+// @Param id path int true "Delivery ID"
+// @Param location body LocationPing true "Courier location"
+// @Success 201 {object} LocationPing
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /deliveries/{id}/locations [post]
+func createLocationPing(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	var p LocationPing
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	if p.Lat < -90 || p.Lat > 90 || p.Lon < -180 || p.Lon > 180 {
+		apierr.Write(w, apierr.InvalidRequest, "lat/lon out of range")
+		return
+	}
+	p.DeliveryID = id
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	err = insertLocationPing(r.Context(), tx, &p)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.DeliveryNotFound, "Delivery not found")
+		return
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(p)
+}
+
+// insertLocationPing записывает координаты курьера по доставке
+// p.DeliveryID и рассылает их подписчикам потока. Нет доставки —
+// sql.ErrNoRows.
+func insertLocationPing(ctx context.Context, tx *sql.Tx, p *LocationPing) error {
+	err := tx.QueryRowContext(ctx,
+		"INSERT INTO courier_locations (delivery_id, courier_id, lat, lon) SELECT id, $2, $3, $4 FROM deliveries WHERE id = $1 RETURNING id, recorded_at",
+		p.DeliveryID, p.CourierID, p.Lat, p.Lon,
+	).Scan(&p.ID, &p.RecordedAt)
+	if err != nil {
+		return err
+	}
+	return pgnotify.Notify(tx, deliveryEventsChannel, strconv.Itoa(p.DeliveryID), "location", p)
+}
+
+// @Summary Live delivery tracking
+// @Description Server-Sent Events: снимок доставки при подключении, затем события отслеживания и координаты курьера
+// @Tags tracking
+// @Produce text/event-stream
+// @Param id path int true "Delivery ID"
+// @Success 200 {object} DeliverySnapshot
+// @Failure 404 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Router /deliveries/{id}/stream [get]
+func streamDelivery(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apierr.Write(w, apierr.InternalError, "Streaming unsupported")
+		return
+	}
+
+	if atomic.AddInt64(&streamConnections, 1) > streamMaxConnections {
+		atomic.AddInt64(&streamConnections, -1)
+		w.Header().Set("Retry-After", streamRetryAfter)
+		apierr.Write(w, apierr.TooManyStreams, "Too many open streams")
+		return
+	}
+	defer atomic.AddInt64(&streamConnections, -1)
+
+	// Подписка до снимка, чтобы не потерять события между ними.
+	events, unsubscribe := deliveryFeed.Subscribe(strconv.Itoa(id))
+	defer unsubscribe()
+
+	snapshot, err := loadDeliverySnapshot(r.Context(), id)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.DeliveryNotFound, "Delivery not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	data, _ := json.Marshal(snapshot)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "event: snapshot\ndata: %s\n\n", data)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case ev := <-events:
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, ev.Data)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-deliveryFeed.Done():
+			return
+		}
+	}
+}
+
+func loadDeliverySnapshot(ctx context.Context, id int) (DeliverySnapshot, error) {
+	var s DeliverySnapshot
+	d := &s.Delivery
+	err := scanDelivery(db.QueryRowContext(ctx, "SELECT "+deliveryColumns+" FROM deliveries WHERE id = $1", id), d)
+	if err != nil {
+		return s, err
+	}
+
+	if s.TrackingEvents, err = loadTrackingEvents(ctx, id); err != nil {
+		return s, err
+	}
+
+	var p LocationPing
+	err = db.QueryRowContext(ctx, "SELECT id, delivery_id, courier_id, lat, lon, recorded_at FROM courier_locations WHERE delivery_id = $1 ORDER BY recorded_at DESC, id DESC LIMIT 1", id).
+		Scan(&p.ID, &p.DeliveryID, &p.CourierID, &p.Lat, &p.Lon, &p.RecordedAt)
+	if err == nil {
+		s.LastLocation = &p
+	} else if err != sql.ErrNoRows {
+		return s, err
+	}
+	return s, nil
+}
+
+func loadTrackingEvents(ctx context.Context, deliveryID int) ([]TrackingEvent, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id, delivery_id, event_type, description, created_at FROM delivery_tracking_events WHERE delivery_id = $1 ORDER BY created_at, id", deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []TrackingEvent{}
+	for rows.Next() {
+		var e TrackingEvent
+		if err := rows.Scan(&e.ID, &e.DeliveryID, &e.EventType, &e.Description, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+	"pkg/pg"
+)
+
+// Zone — зона доставки с тарифом. Стоимость доставки — base_fee плюс
+// per_km_fee за километр от склада зоны до адреса. Деньги хранятся как
+// DECIMAL(10, 2), как суммы платежей. Обслуживаемая территория — круг
+// radius_km вокруг склада и/или префиксы почтовых индексов postcodes; зона
+// без них в проверке покрытия не участвует (см. coverage.go).
+type Zone struct {
+	ID        int      `json:"id"`
+	Name      string   `json:"name"`
+	BaseFee   float64  `json:"base_fee"`
+	PerKmFee  float64  `json:"per_km_fee"`
+	DepotLat  *float64 `json:"depot_lat"`
+	DepotLon  *float64 `json:"depot_lon"`
+	RadiusKm  *float64 `json:"radius_km"`
+	Postcodes []string `json:"postcodes"`
+	UpdatedAt string   `json:"updatedAt"`
+}
+
+// FeeReportRow — сумма стоимостей доставок зоны за день.
+type FeeReportRow struct {
+	Date       string  `json:"date"`
+	ZoneID     *int    `json:"zone_id"`
+	Deliveries int     `json:"deliveries"`
+	Fees       float64 `json:"fees"`
+}
+
+const zoneColumns = "id, name, base_fee, per_km_fee, depot_lat, depot_lon, radius_km, postcodes, updated_at"
+
+func scanZone(row interface{ Scan(...interface{}) error }, z *Zone) error {
+	return row.Scan(&z.ID, &z.Name, &z.BaseFee, &z.PerKmFee, &z.DepotLat, &z.DepotLon, &z.RadiusKm, pg.Array(&z.Postcodes), &z.UpdatedAt)
+}
+
+// errUnknownZone — zone_id доставки не найден в delivery_zones.
+var errUnknownZone = fmt.Errorf("unknown delivery zone")
+
+// deliveryFee считает стоимость доставки d. Без зоны доставка бесплатна,
+// без координат адреса или склада берётся только base_fee. Расстояние
+// округляется до метров, дальше арифметика идёт в NUMERIC на стороне БД.
+func deliveryFee(ctx context.Context, q queryer, d *Delivery) (float64, error) {
+	if d.ZoneID == nil {
+		return 0, nil
+	}
+	var z Zone
+	err := scanZone(q.QueryRowContext(ctx, "SELECT "+zoneColumns+" FROM delivery_zones WHERE id = $1", *d.ZoneID), &z)
+	if err == sql.ErrNoRows {
+		return 0, errUnknownZone
+	} else if err != nil {
+		return 0, err
+	}
+
+	km := "0"
+	if d.Lat != nil && z.DepotLat != nil {
+		km = fmt.Sprintf("%.3f", distanceKm(*z.DepotLat, *z.DepotLon, *d.Lat, *d.Lon))
+	}
+	var fee float64
+	err = q.QueryRowContext(ctx, "SELECT ROUND(base_fee + per_km_fee * $2::numeric, 2) FROM delivery_zones WHERE id = $1", z.ID, km).Scan(&fee)
+	return fee, err
+}
+
+// loadZones читает все зоны: их единицы, поэтому покрытие считается в
+// памяти.
+func loadZones(ctx context.Context, q queryer) ([]Zone, error) {
+	rows, err := q.QueryContext(ctx, "SELECT "+zoneColumns+" FROM delivery_zones ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	zones := []Zone{}
+	for rows.Next() {
+		var z Zone
+		if err := scanZone(rows, &z); err != nil {
+			return nil, err
+		}
+		zones = append(zones, z)
+	}
+	return zones, rows.Err()
+}
+
+// @Summary List delivery zones
+// @Description Зоны доставки с тарифами и обслуживаемой территорией
+// @Tags zones
+// @Produce json
+// @Success 200 {array} Zone
+// @Router /zones [get]
+func getZones(w http.ResponseWriter, r *http.Request) {
+	zones, err := loadZones(r.Context(), db)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(zones)
+}
+
+// @Summary Upsert delivery zone
+// @Description Создать или изменить зону и её тариф. Новый тариф действует для доставок, созданных или изменённых в статусе pending после него. Требует X-Internal-API-Key.
+// @Tags zones
+// @Accept json
+// @Produce json
+// @Param id path int true "Zone ID"
+// @Param zone body Zone true "Zone"
+// @Success 200 {object} Zone
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /admin/zones/{id} [put]
+func putZone(w http.ResponseWriter, r *http.Request) {
+	var z Zone
+	if err := json.NewDecoder(r.Body).Decode(&z); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	z.ID, _ = strconv.Atoi(mux.Vars(r)["id"])
+	if z.Name == "" || z.BaseFee < 0 || z.PerKmFee < 0 {
+		apierr.Write(w, apierr.InvalidRequest, "name is required and fees must be non-negative")
+		return
+	}
+	if (z.DepotLat == nil) != (z.DepotLon == nil) {
+		apierr.Write(w, apierr.InvalidRequest, "depot_lat and depot_lon must be set together")
+		return
+	}
+	if z.RadiusKm != nil && (*z.RadiusKm <= 0 || z.DepotLat == nil) {
+		apierr.Write(w, apierr.InvalidRequest, "radius_km must be positive and requires depot_lat/depot_lon")
+		return
+	}
+	if z.Postcodes == nil {
+		z.Postcodes = []string{}
+	}
+	for _, p := range z.Postcodes {
+		if !postcodePrefixRe.MatchString(p) {
+			apierr.Write(w, apierr.InvalidRequest, fmt.Sprintf("postcodes: %q is not a postcode prefix (1-6 digits)", p))
+			return
+		}
+	}
+
+	err := scanZone(db.QueryRowContext(r.Context(),
+		`INSERT INTO delivery_zones (id, name, base_fee, per_km_fee, depot_lat, depot_lon, radius_km, postcodes) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		 ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, base_fee = EXCLUDED.base_fee, per_km_fee = EXCLUDED.per_km_fee,
+		   depot_lat = EXCLUDED.depot_lat, depot_lon = EXCLUDED.depot_lon, radius_km = EXCLUDED.radius_km,
+		   postcodes = EXCLUDED.postcodes, updated_at = NOW()
+		 RETURNING `+zoneColumns,
+		z.ID, z.Name, z.BaseFee, z.PerKmFee, z.DepotLat, z.DepotLon, z.RadiusKm, z.Postcodes), &z)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(z)
+}
+
+// @Summary Delivery fees report
+// @Description Суммы стоимостей доставок по зонам и дням создания (UTC) за период from–to включительно. Неудавшиеся доставки не учитываются.
+// @Tags deliveries
+// @Produce json
+// @Param from query string true "Первый день (YYYY-MM-DD)"
+// @Param to query string true "Последний день (YYYY-MM-DD)"
+// @Success 200 {array} FeeReportRow
+// @Failure 400 {object} map[string]string
+// @Router /deliveries/fees/report [get]
+func getFeesReport(w http.ResponseWriter, r *http.Request) {
+	from, err1 := time.Parse("2006-01-02", r.URL.Query().Get("from"))
+	to, err2 := time.Parse("2006-01-02", r.URL.Query().Get("to"))
+	if err1 != nil || err2 != nil || to.Before(from) {
+		apierr.Write(w, apierr.InvalidRequest, "from and to are required (YYYY-MM-DD), to not before from")
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT to_char(created_at::date, 'YYYY-MM-DD'), zone_id, COUNT(*), SUM(fee)
+		 FROM deliveries
+		 WHERE created_at >= $1 AND created_at < $2 AND status <> 'failed'
+		 GROUP BY created_at::date, zone_id
+		 ORDER BY created_at::date, zone_id NULLS FIRST`, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	report := []FeeReportRow{}
+	for rows.Next() {
+		var row FeeReportRow
+		if err := rows.Scan(&row.Date, &row.ZoneID, &row.Deliveries, &row.Fees); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		report = append(report, row)
+	}
+	if err := rows.Err(); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"pkg/apierr"
+)
+
+// labelAlphabet — символы label_code: без похожих друг на друга 0/O и 1/I.
+const labelAlphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+
+func newLabelCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = labelAlphabet[int(b[i])%len(labelAlphabet)]
+	}
+	return "DL" + string(b), nil
+}
+
+// ensureLabelCode возвращает label_code доставки, создавая его при первой
+// печати. Код сохраняется, поэтому повторная печать даёт ту же этикетку.
+func ensureLabelCode(ctx context.Context, d *Delivery) error {
+	if d.LabelCode != nil {
+		return nil
+	}
+	code, err := newLabelCode()
+	if err != nil {
+		return err
+	}
+	return db.QueryRowContext(ctx,
+		"UPDATE deliveries SET label_code = COALESCE(label_code, $2) WHERE id = $1 RETURNING label_code", d.ID, code).
+		Scan(&d.LabelCode)
+}
+
+// labelWidth — ширина строки этикетки в символах.
+const labelWidth = 48
+
+// labelLines — текст этикетки над штрихкодом. У подарка под окном
+// доставки печатается поздравление.
+func labelLines(d *Delivery) []string {
+	lines := []string{fmt.Sprintf("Delivery #%d    Order #%d", d.ID, d.OrderID)}
+	lines = append(lines, wrapLabel(d.Address)...)
+	if d.WindowStart != nil && d.WindowEnd != nil {
+		lines = append(lines, fmt.Sprintf("Window: %s-%s UTC", d.WindowStart.UTC().Format("2006-01-02 15:04"), d.WindowEnd.UTC().Format("15:04")))
+	} else {
+		lines = append(lines, "Window: not scheduled")
+	}
+	if d.GiftMessage != nil && *d.GiftMessage != "" {
+		lines = append(lines, "Gift:")
+		lines = append(lines, wrapLabel(*d.GiftMessage)...)
+	}
+	return lines
+}
+
+// wrapLabel переносит текст по словам в строки до labelWidth символов.
+func wrapLabel(text string) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && len([]rune(line))+1+len([]rune(word)) > labelWidth {
+			lines = append(lines, line)
+			line = ""
+		}
+		line = strings.TrimSpace(line + " " + word)
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Размеры PNG-этикетки в пикселях до двукратного увеличения.
+const (
+	labelMargin     = 12
+	labelLineHeight = 16
+	labelModule     = 2
+	labelBarHeight  = 70
+)
+
+func renderLabelPNG(d *Delivery, bars []bool) ([]byte, error) {
+	lines := labelLines(d)
+	// Code 128 требует по 10 модулей тихой зоны с краёв.
+	width := max(360, (len(bars)+20)*labelModule)
+	height := labelMargin*3 + len(lines)*labelLineHeight + labelBarHeight + labelLineHeight
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	drawer := &font.Drawer{Dst: img, Src: image.Black, Face: basicfont.Face7x13}
+	y := labelMargin
+	for _, line := range lines {
+		y += labelLineHeight
+		drawer.Dot = fixed.P(labelMargin, y-3)
+		drawer.DrawString(line)
+	}
+
+	y += labelMargin
+	x0 := (width - len(bars)*labelModule) / 2
+	for i, black := range bars {
+		if black {
+			draw.Draw(img, image.Rect(x0+i*labelModule, y, x0+(i+1)*labelModule, y+labelBarHeight), image.Black, image.Point{}, draw.Src)
+		}
+	}
+	y += labelBarHeight + labelLineHeight
+	drawer.Dot = fixed.P((width-drawer.MeasureString(*d.LabelCode).Round())/2, y-3)
+	drawer.DrawString(*d.LabelCode)
+
+	// Шрифт 7x13 мелок для печати: увеличиваем этикетку вдвое без сглаживания.
+	out := image.NewGray(image.Rect(0, 0, width*2, height*2))
+	for py := 0; py < height*2; py++ {
+		for px := 0; px < width*2; px++ {
+			out.SetGray(px, py, img.GrayAt(px/2, py/2))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, out); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pdfText экранирует строку для PDF. Стандартный шрифт Helvetica знает
+// только Latin-1, остальные символы заменяются на "?".
+func pdfText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		case r >= 160 && r <= 255:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// renderLabelPDF собирает одностраничный PDF 4x6 дюймов со стандартным
+// шрифтом Helvetica и штрихкодом из прямоугольников.
+func renderLabelPDF(d *Delivery, bars []bool) []byte {
+	const pageW, pageH, margin = 288.0, 432.0, 18.0
+	var content bytes.Buffer
+	y := pageH - margin
+	for i, line := range labelLines(d) {
+		size := 10.0
+		if i == 0 {
+			size = 12
+		}
+		y -= size + 4
+		fmt.Fprintf(&content, "BT /F1 %.0f Tf %.2f %.2f Td (%s) Tj ET\n", size, margin, y, pdfText(line))
+	}
+
+	module := (pageW - 2*margin) / float64(len(bars))
+	barH := 72.0
+	y -= 16 + barH
+	for i, black := range bars {
+		if black {
+			fmt.Fprintf(&content, "%.3f %.2f %.3f %.2f re f\n", margin+float64(i)*module, y, module, barH)
+		}
+	}
+	fmt.Fprintf(&content, "BT /F1 10 Tf %.2f %.2f Td (%s) Tj ET\n", pageW/2-float64(len(*d.LabelCode))*2.8, y-14, pdfText(*d.LabelCode))
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>", pageW, pageH),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// @Summary Delivery label
+// @Description Этикетка доставки со штрихкодом Code 128 кода label_code. Код создаётся при первой печати и не меняется. У подарка печатается gift_message, суммы заказа на этикетке нет. Формат выбирается по Accept: application/pdf — PDF 4x6 дюймов, иначе PNG.
+// @Tags labels
+// @Produce png
+// @Produce application/pdf
+// @Param id path int true "Delivery ID"
+// @Success 200 {file} binary
+// @Failure 404 {object} map[string]string
+// @Failure 406 {object} map[string]string
+// @Router /deliveries/{id}/label [get]
+func getDeliveryLabel(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	accept := r.Header.Get("Accept")
+	pdf := strings.Contains(accept, "application/pdf")
+	if !pdf && accept != "" && !strings.Contains(accept, "image/png") && !strings.Contains(accept, "image/*") && !strings.Contains(accept, "*/*") {
+		apierr.Write(w, apierr.NotAcceptable, "Label is available as image/png or application/pdf")
+		return
+	}
+
+	var d Delivery
+	err := scanDelivery(db.QueryRowContext(r.Context(), "SELECT "+deliveryColumns+" FROM deliveries WHERE id = $1", id), &d)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.DeliveryNotFound, "Delivery not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if err := ensureLabelCode(r.Context(), &d); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	bars, err := code128(*d.LabelCode)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	if pdf {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"label-%d.pdf\"", d.ID))
+		w.Write(renderLabelPDF(&d, bars))
+		return
+	}
+	body, err := renderLabelPNG(&d, bars)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(body)
+}
+
+// @Summary Find delivery by label
+// @Description Найти доставку по отсканированному label_code
+// @Tags labels
+// @Produce json
+// @Param code path string true "Label code"
+// @Success 200 {object} Delivery
+// @Failure 404 {object} map[string]string
+// @Router /deliveries/by-label/{code} [get]
+func getDeliveryByLabel(w http.ResponseWriter, r *http.Request) {
+	code := strings.ToUpper(strings.TrimSpace(mux.Vars(r)["code"]))
+
+	var d Delivery
+	err := scanDelivery(db.QueryRowContext(r.Context(), "SELECT "+deliveryColumns+" FROM deliveries WHERE label_code = $1", code), &d)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.DeliveryNotFound, "Delivery not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if d.Packages, err = loadPackages(r.Context(), db, d.ID); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d)
+}
@@ -1,29 +1,62 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"delivery-service/docs"
 	"github.com/gorilla/mux"
-	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	httpSwagger "github.com/swaggo/http-swagger"
-	_ "delivery-service/docs"
+	"pkg/admin"
+	"pkg/apierr"
+	"pkg/audit"
+	"pkg/auth"
+	"pkg/clients"
+	"pkg/config"
+	"pkg/dbhealth"
+	"pkg/deadletter"
+	"pkg/dedup"
+	"pkg/flags"
+	"pkg/hmacsign"
+	"pkg/httpclient"
+	"pkg/limit"
+	"pkg/mode"
+	"pkg/mtls"
+	"pkg/observe"
+	"pkg/pg"
+	"pkg/pgnotify"
+	"pkg/ratelimit"
+	"pkg/replica"
+	"pkg/seed"
+	"pkg/specvalidate"
 )
 
 var db *sql.DB
 
-type Delivery struct {
-	ID         int    `json:"id"`
-	OrderID    int    `json:"order_id" validate:"required"`
-	Address    string `json:"address" validate:"required,min=10,max=500"`
-	Status     string `json:"status" validate:"required,oneof=pending in_transit delivered failed"`
-	CourierID  *int   `json:"courier_id"`
-	CreatedAt  string `json:"createdAt"`
-	UpdatedAt  string `json:"updatedAt"`
+// dbWatch следит за соединением с БД; пока его нет, запросы получают 503.
+var dbWatch *dbhealth.Watchdog
+var serviceMode *mode.Switch
+var featureFlags *flags.Set
+var deliveryFeed *pgnotify.Feed
+
+// Delivery — общий контракт с клиентами (pkg/clients).
+type Delivery = clients.Delivery
+
+const deliveryColumns = "id, order_id, address, status, courier_id, estimated_delivery, zone_id, window_start, window_end, lat, lon, fee, label_code, delivered_at, age_restricted, recipient_age_verified, pickup_point_id, pickup_code, gift_message, simulated, created_at, updated_at"
+
+func scanDelivery(row interface{ Scan(...interface{}) error }, d *Delivery) error {
+	return row.Scan(&d.ID, &d.OrderID, &d.Address, &d.Status, &d.CourierID, &d.EstimatedDelivery, &d.ZoneID, &d.WindowStart, &d.WindowEnd, &d.Lat, &d.Lon, &d.Fee, &d.LabelCode, &d.DeliveredAt, &d.AgeRestricted, &d.RecipientAgeVerified, &d.PickupPointID, &d.PickupCode, &d.GiftMessage, &d.Simulated, &d.CreatedAt, &d.UpdatedAt)
 }
 
 // @title Delivery Service API
@@ -32,13 +65,10 @@ type Delivery struct {
 // @host localhost:8005
 // @BasePath /
 func main() {
-	databaseURL := os.Getenv("DATABASE_URL")
-	if databaseURL == "" {
-		log.Fatal("DATABASE_URL not set")
-	}
+	config.MustLoad("delivery-service", &cfg)
 
 	var err error
-	db, err = sql.Open("postgres", databaseURL)
+	db, err = sql.Open(observe.DriverName, cfg.DatabaseURL)
 	if err != nil {
 		log.Fatalf("DB connection error: %v", err)
 	}
@@ -48,26 +78,167 @@ func main() {
 		log.Fatalf("DB ping error: %v", err)
 	}
 	log.Printf("✅ Connected to PostgreSQL (delivery-service)")
+	// Ошибки ограничений БД — 409/422/503 вместо 500.
+	apierr.SetTranslator(pg.APIError)
+	dbWatch = dbhealth.FromEnv(db)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8004"
+	internalTLS, err := mtls.Load(mtls.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("mTLS config error: %v", err)
+	}
+	internalTLS.WatchSIGHUP()
+
+	signatures, err := hmacsign.VerifierFromEnv()
+	if err != nil {
+		log.Fatalf("HMAC verification config error: %v", err)
+	}
+
+	serviceMode, err = mode.FromEnv()
+	if err != nil {
+		log.Fatalf("Service mode config error: %v", err)
+	}
+	featureFlags, err = flags.FromEnv()
+	if err != nil {
+		log.Fatalf("Feature flags config error: %v", err)
+	}
+	featureFlags.Watch()
+	specValidator, err := specvalidate.FromEnv(docs.SwaggerInfo.ReadDoc())
+	if err != nil {
+		log.Fatalf("OpenAPI validation config error: %v", err)
 	}
+	initDeliverySlots()
+
+	port := cfg.Port
+
+	initDeliveryStream()
+	initDeliveryExport()
+	deliveryFeed = pgnotify.NewFeed(deliveryEventsChannel)
+	if err := deliveryFeed.Listen(cfg.DatabaseURL); err != nil {
+		log.Printf("⚠️ LISTEN %s failed: %v", deliveryEventsChannel, err)
+	}
+
+	workers, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	dbWatch.Start(workers)
+	dedup.StartPruner(workers, db)
+	webhookClient = newWebhookClient()
+	deadLetters = deadletter.NewStore(db, webhookClient)
+	startWebhookDispatcher(workers)
+
+	signer, err := hmacsign.SignerFromEnv()
+	if err != nil {
+		log.Fatalf("HMAC signing config error: %v", err)
+	}
+	clientCfg := httpclient.ConfigFromEnv()
+	clientCfg.TLS = internalTLS
+	clientCfg.Signer = signer
+	services := httpclient.New(clientCfg, "orders-service", "users-service")
+	ordersClient := clients.NewOrders(services, cfg.OrdersServiceURL, clients.WithAPIKey(cfg.InternalAPIKey))
+	startSMSSender(workers, ordersClient,
+		clients.NewUsers(services, cfg.UsersServiceURL, clients.WithAPIKey(cfg.InternalAPIKey)))
+	startSimulation(workers)
+	startConsistencyCheck(workers, ordersClient)
+
+	limiter := limit.FromEnv()
+	rateLimiter, err := ratelimit.FromEnv("delivery")
+	if err != nil {
+		log.Fatalf("Rate limit config error: %v", err)
+	}
+	defer rateLimiter.Close()
 
 	router := mux.NewRouter()
+	router.Use(apierr.Localize)
+	router.Use(observe.Middleware())
+	router.Use(limiter.Middleware)
+	router.Use(dbWatch.Middleware())
+	router.Use(auth.Middleware())
+	router.Use(rateLimiter.Middleware)
+	router.Use(audit.Middleware(db, "/admin/", "/dead-letters/", "/webhooks"))
+	router.Use(serviceMode.Middleware)
+	router.Use(specValidator.Middleware)
 	router.HandleFunc("/health", healthCheck).Methods("GET")
+	router.HandleFunc("/ready", dbWatch.ReadyHandler).Methods("GET")
+	router.HandleFunc("/health/ready", dbWatch.ReadyHandler).Methods("GET")
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	router.HandleFunc("/errors/catalog", apierr.CatalogHandler).Methods("GET")
+	router.HandleFunc("/admin/mode", admin.RequireKey(serviceMode.Handler)).Methods("POST")
+	router.HandleFunc("/admin/concurrency", admin.RequireKey(limiter.Handler)).Methods("GET", "PUT")
+	router.HandleFunc("/admin/rate-limits/users/{id}", admin.RequireKey(rateLimiter.Handler)).Methods("GET", "PUT", "DELETE")
+	router.HandleFunc("/admin/flags", admin.RequireKey(featureFlags.Handler)).Methods("GET")
+	router.HandleFunc("/admin/seed", admin.RequireKey(seed.Handler(insertSeed))).Methods("POST")
+	router.HandleFunc("/admin/audit", admin.RequireKey(audit.Handler(db))).Methods("GET")
+	router.HandleFunc("/admin/zones/{id}", admin.RequireKey(putZone)).Methods("PUT")
+	router.HandleFunc("/admin/couriers/{id}", admin.RequireKey(putCourier)).Methods("PUT")
+	router.HandleFunc("/admin/inconsistencies", admin.RequireKey(consistencyChecker.ListHandler)).Methods("GET")
+	router.HandleFunc("/admin/inconsistencies/check", admin.RequireKey(consistencyChecker.RunHandler)).Methods("POST")
 	router.HandleFunc("/deliveries", getDeliveries).Methods("GET")
+	router.HandleFunc("/deliveries/slots", getDeliverySlots).Methods("GET")
+	router.HandleFunc("/deliveries/export", exportDeliveries).Methods("GET")
+	router.HandleFunc("/deliveries/fees/report", getFeesReport).Methods("GET")
+	router.HandleFunc("/deliveries/stats", getDeliveryStats).Methods("GET")
+	router.HandleFunc("/deliveries/counts", getDeliveryCounts).Methods("GET")
+	router.HandleFunc("/deliveries/by-label/{code}", getDeliveryByLabel).Methods("GET")
+	router.HandleFunc("/deliveries/ratings", admin.RequireKey(getDeliveryRatings)).Methods("GET")
 	router.HandleFunc("/deliveries/{id}", getDelivery).Methods("GET")
 	router.HandleFunc("/deliveries", createDelivery).Methods("POST")
 	router.HandleFunc("/deliveries/{id}", updateDelivery).Methods("PUT")
 	router.HandleFunc("/deliveries/{id}", deleteDelivery).Methods("DELETE")
-	
+	router.HandleFunc("/deliveries/{id}/tracking-events", getTrackingEvents).Methods("GET")
+	router.HandleFunc("/deliveries/{id}/tracking-events", createTrackingEvent).Methods("POST")
+	router.HandleFunc("/deliveries/{id}/locations", createLocationPing).Methods("POST")
+	router.HandleFunc("/deliveries/{id}/packages", getDeliveryPackages).Methods("GET")
+	router.HandleFunc("/deliveries/{id}/packages", createDeliveryPackage).Methods("POST")
+	router.HandleFunc("/deliveries/{id}/packages/{pkg_id}", deleteDeliveryPackage).Methods("DELETE")
+	router.HandleFunc("/deliveries/{id}/packages/{pkg_id}/confirm", confirmDeliveryPackage).Methods("POST")
+	router.HandleFunc("/deliveries/{id}/label", getDeliveryLabel).Methods("GET")
+	router.HandleFunc("/deliveries/{id}/rating", createDeliveryRating).Methods("POST")
+	router.HandleFunc("/deliveries/{id}/confirm-pickup", confirmPickup).Methods("POST")
+	router.HandleFunc("/deliveries/{id}/stream", streamDelivery).Methods("GET")
+	router.HandleFunc("/zones", getZones).Methods("GET")
+	router.HandleFunc("/coverage", getCoverage).Methods("GET")
+	router.HandleFunc("/pickup-points", getPickupPoints).Methods("GET")
+	router.HandleFunc("/pickup-points/{id}", getPickupPoint).Methods("GET")
+	router.HandleFunc("/admin/pickup-points", admin.RequireKey(createPickupPoint)).Methods("POST")
+	router.HandleFunc("/admin/pickup-points/{id}", admin.RequireKey(updatePickupPoint)).Methods("PUT")
+	router.HandleFunc("/admin/pickup-points/{id}", admin.RequireKey(deletePickupPoint)).Methods("DELETE")
+	router.HandleFunc("/couriers/available", getAvailableCouriers).Methods("GET")
+	router.HandleFunc("/couriers/{id}/rating", getCourierRating).Methods("GET")
+	router.HandleFunc("/couriers/{id}/route", getCourierRoute).Methods("GET")
+	router.HandleFunc("/couriers/{id}/shifts", getCourierShifts).Methods("GET")
+	router.HandleFunc("/couriers/{id}/shifts", createCourierShift).Methods("POST")
+	router.HandleFunc("/couriers/{id}/shifts/{shift_id}", updateCourierShift).Methods("PUT")
+	router.HandleFunc("/couriers/{id}/shifts/{shift_id}", deleteCourierShift).Methods("DELETE")
+	router.HandleFunc("/webhooks", admin.RequireKey(getWebhooks)).Methods("GET")
+	router.HandleFunc("/webhooks", admin.RequireKey(createWebhook)).Methods("POST")
+	router.HandleFunc("/webhooks/{id}", admin.RequireKey(updateWebhook)).Methods("PUT")
+	router.HandleFunc("/webhooks/{id}", admin.RequireKey(deleteWebhook)).Methods("DELETE")
+	router.HandleFunc("/dead-letters", internalTLS.RequireClientCert(admin.RequireKey(listDeadLetters))).Methods("GET")
+	router.HandleFunc("/dead-letters/{id}/replay", internalTLS.RequireClientCert(admin.RequireKey(replayDeadLetter))).Methods("POST")
+	router.HandleFunc("/events/orders", internalTLS.RequireClientCert(signatures.Require(consumeOrderEvent))).Methods("POST")
+
 	router.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
 
-	log.Printf("🚀 Delivery Service started on port %s", port)
-	log.Printf("📚 Swagger UI: http://localhost:%s/swagger/index.html", port)
-	if err := http.ListenAndServe(":"+port, router); err != nil {
-		log.Fatalf("Server error: %v", err)
+	srv := &http.Server{Addr: ":" + port, Handler: replica.Middleware(router)}
+	srv.RegisterOnShutdown(deliveryFeed.Close)
+
+	go func() {
+		log.Printf("🚀 Delivery Service started on port %s", port)
+		log.Printf("📚 Swagger UI: http://localhost:%s/swagger/index.html", port)
+		if err := internalTLS.ListenAndServe(srv); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server error: %v", err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	log.Printf("🛑 Shutting down Delivery Service")
+	stopWorkers()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Shutdown error: %v", err)
 	}
 }
 
@@ -79,19 +250,85 @@ func main() {
 // @Router /health [get]
 func healthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     "healthy",
+		"mode":       serviceMode.Get(),
+		"replica_id": replica.ID(),
+		"database":   dbWatch.Status(),
+	})
+}
+
+// deliveryFilter собирает условие WHERE по параметрам списка доставок:
+// order_id, status, courier_id, zone_id и дням создания from/to (UTC,
+// включительно). Условия ссылаются на таблицу deliveries под алиасом d.
+func deliveryFilter(r *http.Request) (string, []interface{}, error) {
+	q := r.URL.Query()
+	var conds []string
+	var args []interface{}
+	add := func(cond string, v interface{}) {
+		args = append(args, v)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	for _, f := range []struct{ param, cond string }{
+		{"order_id", "d.order_id = $%d"},
+		{"courier_id", "d.courier_id = $%d"},
+		{"zone_id", "d.zone_id = $%d"},
+	} {
+		if v := q.Get(f.param); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return "", nil, fmt.Errorf("%s must be an integer", f.param)
+			}
+			add(f.cond, n)
+		}
+	}
+	if v := q.Get("status"); v != "" {
+		add("d.status = $%d", v)
+	}
+	for _, f := range []struct {
+		param, cond string
+		days        int
+	}{{"from", "d.created_at >= $%d", 0}, {"to", "d.created_at < $%d", 1}} {
+		if v := q.Get(f.param); v != "" {
+			t, err := time.Parse("2006-01-02", v)
+			if err != nil {
+				return "", nil, fmt.Errorf("%s must be a date (YYYY-MM-DD)", f.param)
+			}
+			add(f.cond, t.AddDate(0, 0, f.days))
+		}
+	}
+
+	if len(conds) == 0 {
+		return "", nil, nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args, nil
 }
 
 // @Summary Get all deliveries
-// @Description Получить список всех доставок
+// @Description Получить первые 100 доставок с необязательными фильтрами
+// @Param order_id query int false "Order ID"
+// @Param status query string false "Статус"
+// @Param courier_id query int false "Courier ID"
+// @Param zone_id query int false "Zone ID"
+// @Param from query string false "Созданы не раньше дня (YYYY-MM-DD)"
+// @Param to query string false "Созданы не позже дня (YYYY-MM-DD)"
 // @Tags deliveries
 // @Produce json
 // @Success 200 {array} Delivery
+// @Failure 400 {object} map[string]string
 // @Router /deliveries [get]
 func getDeliveries(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query("SELECT id, order_id, address, status, courier_id, created_at, updated_at FROM deliveries ORDER BY id LIMIT 100")
+	where, args, err := deliveryFilter(r)
+	if err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	query := "SELECT " + deliveryColumns + " FROM deliveries d" + where
+
+	rows, err := db.QueryContext(r.Context(), observe.Named("deliveries.list", query+" ORDER BY id LIMIT 100"), args...)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Internal(w, err)
 		return
 	}
 	defer rows.Close()
@@ -99,8 +336,8 @@ func getDeliveries(w http.ResponseWriter, r *http.Request) {
 	var deliveries []Delivery
 	for rows.Next() {
 		var d Delivery
-		if err := rows.Scan(&d.ID, &d.OrderID, &d.Address, &d.Status, &d.CourierID, &d.CreatedAt, &d.UpdatedAt); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if err := scanDelivery(rows, &d); err != nil {
+			apierr.Internal(w, err)
 			return
 		}
 		deliveries = append(deliveries, d)
@@ -111,7 +348,7 @@ func getDeliveries(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary Get delivery by ID
-// @Description Получить доставку по ID
+// @Description Получить доставку по ID вместе с посылками
 // @Tags deliveries
 // @Produce json
 // @Param id path int true "Delivery ID"
@@ -123,14 +360,17 @@ func getDelivery(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(vars["id"])
 
 	var d Delivery
-	err := db.QueryRow("SELECT id, order_id, address, status, courier_id, created_at, updated_at FROM deliveries WHERE id = $1", id).
-		Scan(&d.ID, &d.OrderID, &d.Address, &d.Status, &d.CourierID, &d.CreatedAt, &d.UpdatedAt)
+	err := scanDelivery(db.QueryRowContext(r.Context(), observe.Lookup("deliveries.get_by_id", "SELECT "+deliveryColumns+" FROM deliveries WHERE id = $1"), id), &d)
 
 	if err == sql.ErrNoRows {
-		http.Error(w, "Delivery not found", http.StatusNotFound)
+		apierr.Write(w, apierr.DeliveryNotFound, "Delivery not found")
 		return
 	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Internal(w, err)
+		return
+	}
+	if d.Packages, err = loadPackages(r.Context(), db, id); err != nil {
+		apierr.Internal(w, err)
 		return
 	}
 
@@ -139,45 +379,134 @@ func getDelivery(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary Create delivery
-// @Description Создать новую доставку
+// @Description Создать новую доставку до адреса (address) или до пункта выдачи (pickup_point_id) — ровно одно из двух. Доставке в пункт адрес и координаты берутся из пункта, курьер и окно не назначаются, зона не проверяется; в ready_for_pickup ей создаётся код получения pickup_code. Окно window_start/window_end должно совпадать с одним из слотов GET /deliveries/slots. fee считается по тарифу зоны и расстоянию, переданное значение игнорируется. Адрес (координаты или шестизначный индекс в address) проверяется по зонам доставки, как в GET /coverage; без zone_id доставке назначается найденная зона. Вне покрытия — 422 outside_service_area или, при DELIVERY_COVERAGE_MODE=warn, предупреждение в warnings. Доставку с age_restricted нельзя сразу создать в delivered без recipient_age_verified. simulated=true (только при DELIVERY_SIMULATION=true) создаёт демо-доставку: статусы, события отслеживания и координаты курьера генерирует симуляция за DELIVERY_SIMULATION_DURATION; такие доставки не входят в статистику и рейтинги курьеров.
 // @Tags deliveries
 // @Accept json
 // @Produce json
+// @Param Idempotency-Key header string false "Повтор запроса с тем же ключом вернёт ранее созданную доставку"
 // @Param delivery body Delivery true "Delivery data"
 // @Success 201 {object} Delivery
+// @Success 200 {object} Delivery
 // @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string "code: feature_disabled — simulated=true при выключенной симуляции"
+// @Failure 409 {object} map[string]interface{} "Окно заполнено, alternatives — свободные окна того же дня"
+// @Failure 422 {object} map[string]interface{} "Курьер не на смене, неизвестная зона, адрес вне зон доставки (outside_service_area, ближайшая зона — в nearest_zone) или recipient_age_not_verified"
 // @Router /deliveries [post]
 func createDelivery(w http.ResponseWriter, r *http.Request) {
 	var d Delivery
 	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	if err := validateWindow(&d); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	if err := validateCoordinates(&d); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	if d.Status == "delivered" {
+		if err := recipientAgeError(d.AgeRestricted, d.RecipientAgeVerified); err != nil {
+			apierr.Respond(w, err)
+			return
+		}
+	}
+	if err := pickupStatusError(d.PickupPointID != nil, d.Status); err != nil {
+		apierr.Respond(w, err)
+		return
+	}
+	if d.Simulated && !cfg.DeliverySimulation {
+		apierr.Write(w, apierr.FeatureDisabled, "Delivery simulation is disabled: DELIVERY_SIMULATION not set")
+		return
+	}
+	if !checkCourierAssignment(w, r, d.CourierID, 0) {
 		return
 	}
 
-	err := db.QueryRow(
-		"INSERT INTO deliveries (order_id, address, status, courier_id) VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at",
-		d.OrderID, d.Address, d.Status, d.CourierID,
-	).Scan(&d.ID, &d.CreatedAt, &d.UpdatedAt)
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
 
+	err = applyPickupPoint(r.Context(), tx, &d)
+	if err == nil && d.PickupPointID == nil {
+		err = applyCoverage(r, tx, &d)
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, err)
+		return
+	}
+	if d.Status == "ready_for_pickup" {
+		code, err := newPickupCode()
+		if err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		d.PickupCode = &code
+	}
+	if d.Fee, err = deliveryFee(r.Context(), tx, &d); err == errUnknownZone {
+		apierr.Write(w, apierr.ValidationFailed, fmt.Sprintf("Unknown delivery zone %d", *d.ZoneID))
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	key := r.Header.Get("Idempotency-Key")
+	if d.WindowStart != nil && d.Status != "failed" {
+		ok, err := reserveSlot(r.Context(), tx, &d, 0, key)
+		if err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		if !ok {
+			writeSlotFull(w, r, &d)
+			return
+		}
+	}
+
+	err = tx.QueryRowContext(r.Context(),
+		observe.Named("deliveries.insert", "INSERT INTO deliveries (order_id, address, status, courier_id, estimated_delivery, zone_id, window_start, window_end, lat, lon, fee, idempotency_key, delivered_at, age_restricted, recipient_age_verified, pickup_point_id, pickup_code, simulated) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NULLIF($12, ''), CASE WHEN $3 = 'delivered' THEN NOW() END, $13, $14, $15, $16, $17) ON CONFLICT (idempotency_key) DO NOTHING RETURNING id, delivered_at, created_at, updated_at"),
+		d.OrderID, d.Address, d.Status, d.CourierID, d.EstimatedDelivery, d.ZoneID, d.WindowStart, d.WindowEnd, d.Lat, d.Lon, d.Fee, key, d.AgeRestricted, d.RecipientAgeVerified, d.PickupPointID, d.PickupCode, d.Simulated,
+	).Scan(&d.ID, &d.DeliveredAt, &d.CreatedAt, &d.UpdatedAt)
+
+	status := http.StatusCreated
+	if err == sql.ErrNoRows {
+		// Повтор с тем же Idempotency-Key: возвращаем уже созданную доставку.
+		err = scanDelivery(tx.QueryRowContext(r.Context(), "SELECT "+deliveryColumns+" FROM deliveries WHERE idempotency_key = $1", key), &d)
+		status = http.StatusOK
+	} else if err == nil {
+		err = recordDeliveryTransitions(r.Context(), tx, nil, &d)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		apierr.Internal(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(d)
 }
 
 // @Summary Update delivery
-// @Description Обновить данные доставки
+// @Description Обновить данные доставки. Новое окно доставки проверяется на вместимость так же, как при создании. fee пересчитывается только в статусе pending. У доставки в пункт выдачи адрес не меняется, курьер и окно не назначаются; при переходе в ready_for_pickup создаётся pickup_code и покупателю уходит SMS, а в delivered она переходит только через POST /deliveries/{id}/confirm-pickup. age_restricted задаётся при создании и не меняется; доставку с age_restricted можно перевести в delivered только с recipient_age_verified=true (курьер проверил возраст получателя), подтверждение не снимается.
 // @Tags deliveries
 // @Accept json
 // @Produce json
 // @Param id path int true "Delivery ID"
 // @Param delivery body Delivery true "Delivery data"
 // @Success 200 {object} Delivery
+// @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]interface{} "Окно заполнено или не все посылки подтверждены (флаг strict_package_scan)"
+// @Failure 422 {object} map[string]string "Курьер не на смене, посылки тяжелее его грузоподъёмности, неизвестная зона или возраст получателя не подтверждён (recipient_age_not_verified)"
+// @Failure 503 {object} map[string]string "Конкурирующее изменение той же записи; запрос можно повторить"
 // @Router /deliveries/{id} [put]
 func updateDelivery(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -185,20 +514,117 @@ func updateDelivery(w http.ResponseWriter, r *http.Request) {
 
 	var d Delivery
 	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	if err := validateWindow(&d); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
 		return
 	}
+	if err := validateCoordinates(&d); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+
+	// Строка заблокирована до конца транзакции: из параллельных назначений
+	// курьера и смен статуса переход фиксирует ровно одно, остальные видят
+	// уже новое состояние.
+	in := d
+	err := pg.Locked(r.Context(), db, func(tx *sql.Tx) error {
+		d = in
+		var current Delivery
+		err := tx.QueryRowContext(r.Context(), "SELECT courier_id, zone_id, window_start, status, age_restricted, recipient_age_verified, pickup_point_id, pickup_code FROM deliveries WHERE id = $1 FOR UPDATE", id).
+			Scan(&current.CourierID, &current.ZoneID, &current.WindowStart, &current.Status, &current.AgeRestricted, &current.RecipientAgeVerified, &current.PickupPointID, &current.PickupCode)
+		if err != nil {
+			return err
+		}
+		// Адрес и координаты доставки в пункт выдачи берутся из пункта и в
+		// PUT не меняются; курьер и окно ей не назначаются.
+		pickup := current.PickupPointID != nil
+		if pickup && (d.CourierID != nil || d.WindowStart != nil) {
+			return apierr.New(apierr.InvalidRequest, "pickup point deliveries have no courier_id or delivery window")
+		}
+		if !pickup && strings.TrimSpace(d.Address) == "" {
+			return apierr.New(apierr.InvalidRequest, "address is required")
+		}
+		if d.Status != current.Status {
+			if err := pickupStatusError(pickup, d.Status); err != nil {
+				return err
+			}
+		}
+		var pickupCode *string
+		if d.Status == "ready_for_pickup" && current.PickupCode == nil {
+			code, err := newPickupCode()
+			if err != nil {
+				return err
+			}
+			pickupCode = &code
+		}
+		// Смена проверяется только при назначении другого курьера:
+		// доставку, начатую на смене, можно закрыть и после её окончания.
+		if d.CourierID != nil && !sameInt(current.CourierID, d.CourierID) {
+			if err := courierAssignmentError(r.Context(), d.CourierID, id); err != nil {
+				return err
+			}
+		}
+
+		// В строгом режиме доставку нельзя закрыть, пока курьер не
+		// отсканировал все посылки.
+		if d.Status == "delivered" && current.Status != "delivered" && featureFlags.Bool("strict_package_scan", false) {
+			n, err := unconfirmedPackages(r.Context(), tx, id)
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				return apierr.New(apierr.InvalidState, fmt.Sprintf("%d packages are not confirmed", n))
+			}
+		}
+		// Подтверждение возраста получателя не снимается: его можно
+		// передать заранее или вместе с переходом в delivered.
+		d.RecipientAgeVerified = d.RecipientAgeVerified || current.RecipientAgeVerified
+		if d.Status == "delivered" && current.Status != "delivered" {
+			if err := recipientAgeError(current.AgeRestricted, d.RecipientAgeVerified); err != nil {
+				return err
+			}
+		}
 
-	err := db.QueryRow(
-		"UPDATE deliveries SET order_id=$1, address=$2, status=$3, courier_id=$4, updated_at=NOW() WHERE id=$5 RETURNING id, order_id, address, status, courier_id, created_at, updated_at",
-		d.OrderID, d.Address, d.Status, d.CourierID, id,
-	).Scan(&d.ID, &d.OrderID, &d.Address, &d.Status, &d.CourierID, &d.CreatedAt, &d.UpdatedAt)
+		// Вместимость проверяется, только если доставка занимает новое
+		// окно: уже забронированное окно не отбирается при уменьшении
+		// вместимости.
+		if d.WindowStart != nil && d.Status != "failed" && (current.WindowStart == nil ||
+			!current.WindowStart.Equal(*d.WindowStart) || !sameInt(current.ZoneID, d.ZoneID) || current.Status == "failed") {
+			ok, err := reserveSlot(r.Context(), tx, &d, id, "")
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return slotFullError(r.Context(), &d)
+			}
+		}
 
+		// Стоимость пересчитывается, пока доставка в pending; после этого
+		// она зафиксирована.
+		fee, err := deliveryFee(r.Context(), tx, &d)
+		if err == errUnknownZone {
+			return apierr.New(apierr.ValidationFailed, fmt.Sprintf("Unknown delivery zone %d", *d.ZoneID))
+		} else if err != nil {
+			return err
+		}
+
+		err = scanDelivery(tx.QueryRowContext(r.Context(),
+			observe.Lookup("deliveries.update", "UPDATE deliveries SET order_id=$1, address=CASE WHEN pickup_point_id IS NULL THEN $2 ELSE address END, status=$3, courier_id=$4, estimated_delivery=$5, zone_id=$6, window_start=$7, window_end=$8, lat=CASE WHEN pickup_point_id IS NULL THEN $9 ELSE lat END, lon=CASE WHEN pickup_point_id IS NULL THEN $10 ELSE lon END, fee=CASE WHEN status = 'pending' THEN $11 ELSE fee END, delivered_at=CASE WHEN $3 = 'delivered' THEN COALESCE(delivered_at, NOW()) END, recipient_age_verified=$13, pickup_code=COALESCE(pickup_code, $14), updated_at=NOW() WHERE id=$12 RETURNING "+deliveryColumns),
+			d.OrderID, d.Address, d.Status, d.CourierID, d.EstimatedDelivery, d.ZoneID, d.WindowStart, d.WindowEnd, d.Lat, d.Lon, fee, id, d.RecipientAgeVerified, pickupCode,
+		), &d)
+		if err != nil {
+			return err
+		}
+		return recordDeliveryTransitions(r.Context(), tx, &current, &d)
+	})
 	if err == sql.ErrNoRows {
-		http.Error(w, "Delivery not found", http.StatusNotFound)
+		apierr.Write(w, apierr.DeliveryNotFound, "Delivery not found")
 		return
 	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, err)
 		return
 	}
 
@@ -217,15 +643,31 @@ func deleteDelivery(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, _ := strconv.Atoi(vars["id"])
 
-	result, err := db.Exec("DELETE FROM deliveries WHERE id = $1", id)
+	tx, err := db.BeginTx(r.Context(), nil)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Internal(w, err)
 		return
 	}
+	defer tx.Rollback()
 
+	result, err := tx.ExecContext(r.Context(), observe.Lookup("deliveries.delete", "DELETE FROM deliveries WHERE id = $1"), id)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
 	rows, _ := result.RowsAffected()
 	if rows == 0 {
-		http.Error(w, "Delivery not found", http.StatusNotFound)
+		apierr.Write(w, apierr.DeliveryNotFound, "Delivery not found")
+		return
+	}
+
+	// Запись аудита фиксируется в одной транзакции с удалением.
+	err = audit.Write(r.Context(), tx)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		apierr.Internal(w, err)
 		return
 	}
 
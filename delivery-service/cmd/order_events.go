@@ -0,0 +1,196 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"pkg/apierr"
+	"pkg/dedup"
+	"pkg/events"
+)
+
+var orderEventsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "delivery_order_events_total",
+	Help: "Order events received from orders-service by result: created, skipped, flagged, duplicate, ignored, rejected, failed.",
+}, []string{"result"})
+
+// Источник событий в processed_events.
+const orderEventsSource = "orders-outbox"
+
+var orderEventsLag = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "delivery_order_events_lag_seconds",
+	Help: "Age of the last received order event at the time it was processed.",
+})
+
+// @Summary Consume order event
+// @Description Приём событий заказов от outbox orders-service. На order.confirmed создаётся доставка в статусе pending, если для заказа её ещё нет; gift_message подарка сохраняется для этикетки (суммы подарка в событии нет). На order.force_deleted доставки удалённого заказа помечаются orphaned_at. Повторно доставленное событие (тот же event_id) ничего не меняет. 2xx возвращается только после записи в БД.
+// @Tags events
+// @Accept json
+// @Produce json
+// @Param event body events.Envelope true "Order event"
+// @Success 200 {object} map[string]interface{}
+// @Success 201 {object} Delivery
+// @Failure 401 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Router /events/orders [post]
+func consumeOrderEvent(w http.ResponseWriter, r *http.Request) {
+	var env events.Envelope
+	if err := json.NewDecoder(r.Body).Decode(&env); err != nil {
+		orderEventsProcessed.WithLabelValues("rejected").Inc()
+		apierr.Write(w, apierr.ValidationFailed, err.Error())
+		return
+	}
+	if env.EventID == "" {
+		orderEventsProcessed.WithLabelValues("rejected").Inc()
+		apierr.Write(w, apierr.ValidationFailed, "event_id is required")
+		return
+	}
+	if !env.OccurredAt.IsZero() {
+		orderEventsLag.Set(time.Since(env.OccurredAt).Seconds())
+	}
+
+	if env.EventType == events.OrderForceDeleted {
+		flagForceDeletedOrder(w, r, env)
+		return
+	}
+	if env.EventType != events.OrderConfirmed {
+		orderEventsProcessed.WithLabelValues("ignored").Inc()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"event_id": env.EventID, "result": "ignored"})
+		return
+	}
+
+	var p events.OrderPayload
+	if err := json.Unmarshal(env.Payload, &p); err != nil || p.OrderID <= 0 || strings.TrimSpace(p.ShippingAddress) == "" {
+		orderEventsProcessed.WithLabelValues("rejected").Inc()
+		log.Printf("⚠️ Rejected order event %s: invalid payload", env.EventID)
+		apierr.Write(w, apierr.ValidationFailed, "Invalid order.confirmed payload: order_id and shipping_address are required")
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		orderEventsProcessed.WithLabelValues("failed").Inc()
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	claimed, err := dedup.Claim(r.Context(), tx, orderEventsSource, env.EventID)
+	if err != nil {
+		orderEventsProcessed.WithLabelValues("failed").Inc()
+		apierr.Internal(w, err)
+		return
+	}
+	if !claimed {
+		orderEventsProcessed.WithLabelValues("duplicate").Inc()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"event_id": env.EventID, "result": "duplicate"})
+		return
+	}
+
+	// Разные события одного заказа (например, повторное подтверждение)
+	// не должны создать две доставки.
+	if _, err := tx.ExecContext(r.Context(), "SELECT pg_advisory_xact_lock($1)", p.OrderID); err != nil {
+		orderEventsProcessed.WithLabelValues("failed").Inc()
+		apierr.Internal(w, err)
+		return
+	}
+
+	var existingID int
+	err = tx.QueryRowContext(r.Context(), "SELECT id FROM deliveries WHERE order_id = $1 LIMIT 1", p.OrderID).Scan(&existingID)
+	if err == nil {
+		if err := tx.Commit(); err != nil {
+			orderEventsProcessed.WithLabelValues("failed").Inc()
+			apierr.Internal(w, err)
+			return
+		}
+		orderEventsProcessed.WithLabelValues("skipped").Inc()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"event_id": env.EventID, "result": "skipped", "delivery_id": existingID})
+		return
+	} else if err != sql.ErrNoRows {
+		orderEventsProcessed.WithLabelValues("failed").Inc()
+		apierr.Internal(w, err)
+		return
+	}
+
+	d := Delivery{OrderID: p.OrderID, Address: p.ShippingAddress, Status: "pending", AgeRestricted: p.AgeRestricted}
+	if p.GiftMessage != "" {
+		d.GiftMessage = &p.GiftMessage
+	}
+	err = tx.QueryRowContext(r.Context(),
+		"INSERT INTO deliveries (order_id, user_id, address, status, age_restricted, gift_message) VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6) RETURNING id, created_at, updated_at",
+		d.OrderID, p.UserID, d.Address, d.Status, d.AgeRestricted, d.GiftMessage,
+	).Scan(&d.ID, &d.CreatedAt, &d.UpdatedAt)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		orderEventsProcessed.WithLabelValues("failed").Inc()
+		apierr.Internal(w, err)
+		return
+	}
+
+	orderEventsProcessed.WithLabelValues("created").Inc()
+	log.Printf("📦 Delivery %d created for order %d (event %s)", d.ID, d.OrderID, env.EventID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(d)
+}
+
+// flagForceDeletedOrder помечает orphaned_at доставки заказа, удалённого
+// в orders-service с force=true. Доставки не удаляются: курьер может
+// быть уже в пути.
+func flagForceDeletedOrder(w http.ResponseWriter, r *http.Request, env events.Envelope) {
+	var p events.OrderPayload
+	if err := json.Unmarshal(env.Payload, &p); err != nil || p.OrderID <= 0 {
+		orderEventsProcessed.WithLabelValues("rejected").Inc()
+		apierr.Write(w, apierr.ValidationFailed, "Invalid order.force_deleted payload: order_id is required")
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		orderEventsProcessed.WithLabelValues("failed").Inc()
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	claimed, err := dedup.Claim(r.Context(), tx, orderEventsSource, env.EventID)
+	var flagged int64
+	if err == nil && claimed {
+		var res sql.Result
+		res, err = tx.ExecContext(r.Context(),
+			"UPDATE deliveries SET orphaned_at = COALESCE(orphaned_at, NOW()) WHERE order_id = $1", p.OrderID)
+		if err == nil {
+			flagged, _ = res.RowsAffected()
+		}
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		orderEventsProcessed.WithLabelValues("failed").Inc()
+		apierr.Internal(w, err)
+		return
+	}
+
+	result := "flagged"
+	if !claimed {
+		result = "duplicate"
+	} else if flagged > 0 {
+		log.Printf("⚠️ Order %d force-deleted, %d deliveries flagged (event %s)", p.OrderID, flagged, env.EventID)
+	}
+	orderEventsProcessed.WithLabelValues(result).Inc()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"event_id": env.EventID, "result": result, "deliveries": flagged})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pkg/events"
+)
+
+// TestOrderEventReplayCreatesOneDelivery — повторная доставка того же
+// order.confirmed (тот же event_id) не создаёт вторую доставку.
+func TestOrderEventReplayCreatesOneDelivery(t *testing.T) {
+	openTestDB(t)
+
+	orderID := 900000 + int(time.Now().UnixNano()%90000)
+	eventID := fmt.Sprintf("replay-test-%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM delivery_tracking_events WHERE delivery_id IN (SELECT id FROM deliveries WHERE order_id = $1)", orderID)
+		db.Exec("DELETE FROM deliveries WHERE order_id = $1", orderID)
+		db.Exec("DELETE FROM processed_events WHERE source = $1 AND event_id = $2", orderEventsSource, eventID)
+	})
+
+	payload, _ := json.Marshal(events.OrderPayload{OrderID: orderID, UserID: 1, Status: "confirmed", ShippingAddress: "1 Replay Street, Testville"})
+	body, _ := json.Marshal(events.Envelope{EventID: eventID, EventType: events.OrderConfirmed, OccurredAt: time.Now(), Payload: payload})
+
+	var results []string
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		consumeOrderEvent(rec, httptest.NewRequest(http.MethodPost, "/events/orders", strings.NewReader(string(body))))
+		if rec.Code != http.StatusCreated && rec.Code != http.StatusOK {
+			t.Fatalf("delivery %d: status %d: %s", i+1, rec.Code, rec.Body)
+		}
+		var resp struct {
+			Result string `json:"result"`
+		}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		results = append(results, resp.Result)
+	}
+	if results[1] != "duplicate" {
+		t.Errorf("replay result %q, want duplicate", results[1])
+	}
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM deliveries WHERE order_id = $1", orderID).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("deliveries for order %d = %d, want 1", orderID, n)
+	}
+}
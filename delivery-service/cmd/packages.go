@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+	"pkg/clients"
+)
+
+// Package — посылка внутри доставки. ConfirmedAt выставляется при
+// сканировании штрихкода курьером у получателя.
+type Package = clients.Package
+
+const packageColumns = "id, delivery_id, barcode, weight_kg, length_cm, width_cm, height_cm, confirmed_at, created_at"
+
+func scanPackage(row interface{ Scan(...interface{}) error }, p *Package) error {
+	return row.Scan(&p.ID, &p.DeliveryID, &p.Barcode, &p.WeightKg, &p.LengthCm, &p.WidthCm, &p.HeightCm, &p.ConfirmedAt, &p.CreatedAt)
+}
+
+func loadPackages(ctx context.Context, q queryer, deliveryID int) ([]Package, error) {
+	rows, err := q.QueryContext(ctx, "SELECT "+packageColumns+" FROM delivery_packages WHERE delivery_id = $1 ORDER BY id", deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	packages := []Package{}
+	for rows.Next() {
+		var p Package
+		if err := scanPackage(rows, &p); err != nil {
+			return nil, err
+		}
+		packages = append(packages, p)
+	}
+	return packages, rows.Err()
+}
+
+// packagesWeight — суммарный вес посылок доставки в килограммах.
+func packagesWeight(ctx context.Context, q queryer, deliveryID int) (float64, error) {
+	var weight float64
+	err := q.QueryRowContext(ctx, "SELECT COALESCE(SUM(weight_kg), 0) FROM delivery_packages WHERE delivery_id = $1", deliveryID).Scan(&weight)
+	return weight, err
+}
+
+// unconfirmedPackages — число посылок доставки, не отсканированных курьером.
+func unconfirmedPackages(ctx context.Context, q queryer, deliveryID int) (int, error) {
+	var n int
+	err := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM delivery_packages WHERE delivery_id = $1 AND confirmed_at IS NULL", deliveryID).Scan(&n)
+	return n, err
+}
+
+// recipientAgeError — доставку заказа с товарами 18+ нельзя завершить,
+// пока курьер не подтвердил возраст получателя (recipient_age_verified).
+func recipientAgeError(ageRestricted, verified bool) error {
+	if ageRestricted && !verified {
+		return apierr.New(apierr.RecipientAgeNotVerified, "recipient_age_verified is required to complete an age-restricted delivery")
+	}
+	return nil
+}
+
+// @Summary List delivery packages
+// @Description Посылки доставки в порядке добавления
+// @Tags packages
+// @Produce json
+// @Param id path int true "Delivery ID"
+// @Success 200 {array} Package
+// @Router /deliveries/{id}/packages [get]
+func getDeliveryPackages(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	packages, err := loadPackages(r.Context(), db, id)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(packages)
+}
+
+// @Summary Add delivery package
+// @Description Добавить посылку в доставку. Если курьер уже назначен, общий вес посылок не должен превышать грузоподъёмность его смены.
+// @Tags packages
+// @Accept json
+// @Produce json
+// @Param id path int true "Delivery ID"
+// @Param package body Package true "Package"
+// @Success 201 {object} Package
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "Штрихкод уже зарегистрирован"
+// @Failure 422 {object} map[string]string "Превышена грузоподъёмность курьера"
+// @Router /deliveries/{id}/packages [post]
+func createDeliveryPackage(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	var p Package
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	if p.Barcode == "" || len(p.Barcode) > 64 {
+		apierr.Write(w, apierr.InvalidRequest, "barcode is required (up to 64 characters)")
+		return
+	}
+	if p.WeightKg <= 0 || p.LengthCm < 0 || p.WidthCm < 0 || p.HeightCm < 0 {
+		apierr.Write(w, apierr.InvalidRequest, "weight_kg must be positive and dimensions non-negative")
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Блокировка доставки сериализует добавление посылок, чтобы два
+	// параллельных запроса вместе не превысили грузоподъёмность.
+	var courierID *int
+	err = tx.QueryRowContext(r.Context(), "SELECT courier_id FROM deliveries WHERE id = $1 FOR UPDATE", id).Scan(&courierID)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.DeliveryNotFound, "Delivery not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if courierID != nil {
+		shift, err := courierShift(r.Context(), *courierID, time.Now())
+		if err != nil && err != sql.ErrNoRows {
+			apierr.Internal(w, err)
+			return
+		}
+		if err == nil && shift.MaxWeightKg != nil {
+			weight, err := packagesWeight(r.Context(), tx, id)
+			if err != nil {
+				apierr.Internal(w, err)
+				return
+			}
+			if weight+p.WeightKg > *shift.MaxWeightKg {
+				apierr.Write(w, apierr.CourierCapacityExceeded, fmt.Sprintf("Packages would weigh %.2f kg, courier %d carries at most %.2f kg", weight+p.WeightKg, *courierID, *shift.MaxWeightKg))
+				return
+			}
+		}
+	}
+
+	err = scanPackage(tx.QueryRowContext(r.Context(),
+		"INSERT INTO delivery_packages (delivery_id, barcode, weight_kg, length_cm, width_cm, height_cm) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (barcode) DO NOTHING RETURNING "+packageColumns,
+		id, p.Barcode, p.WeightKg, p.LengthCm, p.WidthCm, p.HeightCm), &p)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.DuplicateBarcode, fmt.Sprintf("Barcode %s is already registered", p.Barcode))
+		return
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(p)
+}
+
+// @Summary Delete delivery package
+// @Description Удалить посылку из доставки
+// @Tags packages
+// @Param id path int true "Delivery ID"
+// @Param pkg_id path int true "Package ID"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Router /deliveries/{id}/packages/{pkg_id} [delete]
+func deleteDeliveryPackage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+	pkgID, _ := strconv.Atoi(vars["pkg_id"])
+
+	result, err := db.ExecContext(r.Context(), "DELETE FROM delivery_packages WHERE id = $1 AND delivery_id = $2", pkgID, id)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		apierr.Write(w, apierr.PackageNotFound, "Package not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Confirm delivery package
+// @Description Отметить посылку отсканированной при вручении. Повторное подтверждение сохраняет время первого.
+// @Tags packages
+// @Produce json
+// @Param id path int true "Delivery ID"
+// @Param pkg_id path int true "Package ID"
+// @Success 200 {object} Package
+// @Failure 404 {object} map[string]string
+// @Router /deliveries/{id}/packages/{pkg_id}/confirm [post]
+func confirmDeliveryPackage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+	pkgID, _ := strconv.Atoi(vars["pkg_id"])
+
+	var p Package
+	err := scanPackage(db.QueryRowContext(r.Context(),
+		"UPDATE delivery_packages SET confirmed_at = COALESCE(confirmed_at, NOW()) WHERE id = $1 AND delivery_id = $2 RETURNING "+packageColumns,
+		pkgID, id), &p)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.PackageNotFound, "Package not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+	"pkg/pg"
+)
+
+// Пункты выдачи. Доставка создаётся либо до адреса (address), либо до
+// пункта (pickup_point_id) — ровно одно из двух. Доставке в пункт адрес и
+// координаты копируются из пункта, курьер и окно доставки ей не
+// назначаются. Когда посылка в пункте, доставку переводят в
+// ready_for_pickup: создаётся код получения, покупателю уходит SMS.
+// Доставка завершается только через POST /deliveries/{id}/confirm-pickup с
+// этим кодом.
+
+const (
+	defaultPickupPointsLimit = 10
+	maxPickupPointsLimit     = 50
+	// pickupCodeLength — длина кода получения из символов labelAlphabet.
+	pickupCodeLength = 6
+)
+
+// PickupPoint — пункт выдачи. DistanceKm заполняется только в поиске
+// рядом с точкой.
+type PickupPoint struct {
+	ID           int      `json:"id"`
+	Name         string   `json:"name" example:"ПВЗ на Тверской"`
+	Address      string   `json:"address"`
+	Lat          float64  `json:"lat"`
+	Lon          float64  `json:"lon"`
+	OpeningHours string   `json:"opening_hours" example:"Пн-Пт 09:00-21:00"`
+	Active       bool     `json:"active"`
+	DistanceKm   *float64 `json:"distance_km,omitempty"`
+	CreatedAt    string   `json:"createdAt"`
+	UpdatedAt    string   `json:"updatedAt"`
+}
+
+// ConfirmPickupRequest — тело POST /deliveries/{id}/confirm-pickup.
+type ConfirmPickupRequest struct {
+	Code string `json:"code" example:"7KQ2MX"`
+	// RecipientAgeVerified — возраст получателя проверен (для доставок с
+	// age_restricted).
+	RecipientAgeVerified bool `json:"recipient_age_verified"`
+}
+
+const pickupPointColumns = "id, name, address, lat, lon, opening_hours, active, created_at, updated_at"
+
+func scanPickupPoint(row interface{ Scan(...interface{}) error }, p *PickupPoint) error {
+	return row.Scan(&p.ID, &p.Name, &p.Address, &p.Lat, &p.Lon, &p.OpeningHours, &p.Active, &p.CreatedAt, &p.UpdatedAt)
+}
+
+func newPickupCode() (string, error) {
+	b := make([]byte, pickupCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = labelAlphabet[int(b[i])%len(labelAlphabet)]
+	}
+	return string(b), nil
+}
+
+// applyPickupPoint проверяет, куда создаётся доставка: ровно одно из
+// address и pickup_point_id. Доставке в пункт копирует адрес и координаты
+// активного пункта; курьер и окно для неё недопустимы.
+func applyPickupPoint(ctx context.Context, q queryer, d *Delivery) error {
+	hasAddress := strings.TrimSpace(d.Address) != ""
+	if hasAddress == (d.PickupPointID != nil) {
+		return apierr.New(apierr.InvalidRequest, "exactly one of address and pickup_point_id is required")
+	}
+	if d.PickupPointID == nil {
+		return nil
+	}
+	if d.CourierID != nil || d.WindowStart != nil {
+		return apierr.New(apierr.InvalidRequest, "pickup point deliveries have no courier_id or delivery window")
+	}
+	var p PickupPoint
+	err := scanPickupPoint(q.QueryRowContext(ctx, "SELECT "+pickupPointColumns+" FROM pickup_points WHERE id = $1", *d.PickupPointID), &p)
+	if err == sql.ErrNoRows || (err == nil && !p.Active) {
+		return apierr.New(apierr.ValidationFailed, fmt.Sprintf("Unknown or inactive pickup point %d", *d.PickupPointID))
+	} else if err != nil {
+		return err
+	}
+	d.Address, d.Lat, d.Lon = p.Address, &p.Lat, &p.Lon
+	return nil
+}
+
+// pickupStatusError проверяет статус доставки против её вида:
+// ready_for_pickup — только у доставок в пункт, а их перевод в delivered —
+// только через confirm-pickup.
+func pickupStatusError(pickup bool, status string) error {
+	if !pickup && status == "ready_for_pickup" {
+		return apierr.New(apierr.InvalidStatusTransition, "ready_for_pickup is only for pickup point deliveries")
+	}
+	if pickup && status == "delivered" {
+		return apierr.New(apierr.InvalidStatusTransition, "pickup point deliveries are completed via POST /deliveries/{id}/confirm-pickup")
+	}
+	return nil
+}
+
+func decodePickupPoint(w http.ResponseWriter, r *http.Request) (PickupPoint, bool) {
+	p := PickupPoint{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return p, false
+	}
+	p.Name, p.Address = strings.TrimSpace(p.Name), strings.TrimSpace(p.Address)
+	if p.Name == "" || len([]rune(p.Address)) < 10 {
+		apierr.Write(w, apierr.InvalidRequest, "name is required and address must be at least 10 characters")
+		return p, false
+	}
+	if err := validateCoordinates(&Delivery{Lat: &p.Lat, Lon: &p.Lon}); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return p, false
+	}
+	return p, true
+}
+
+// @Summary Search pickup points
+// @Description Активные пункты выдачи. С near_lat и near_lon — ближайшие к точке, с расстоянием distance_km; без них — по id.
+// @Tags pickup-points
+// @Produce json
+// @Param near_lat query number false "Широта (вместе с near_lon)"
+// @Param near_lon query number false "Долгота (вместе с near_lat)"
+// @Param limit query int false "Сколько пунктов вернуть (по умолчанию 10, не больше 50)"
+// @Success 200 {array} PickupPoint
+// @Failure 400 {object} map[string]string
+// @Router /pickup-points [get]
+func getPickupPoints(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := defaultPickupPointsLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPickupPointsLimit {
+			apierr.Write(w, apierr.InvalidRequest, fmt.Sprintf("limit must be between 1 and %d", maxPickupPointsLimit))
+			return
+		}
+		limit = n
+	}
+	var lat, lon *float64
+	if q.Get("near_lat") != "" || q.Get("near_lon") != "" {
+		la, err1 := strconv.ParseFloat(q.Get("near_lat"), 64)
+		lo, err2 := strconv.ParseFloat(q.Get("near_lon"), 64)
+		if err1 != nil || err2 != nil {
+			apierr.Write(w, apierr.InvalidRequest, "near_lat and near_lon must be numbers and set together")
+			return
+		}
+		lat, lon = &la, &lo
+		if err := validateCoordinates(&Delivery{Lat: lat, Lon: lon}); err != nil {
+			apierr.Write(w, apierr.InvalidRequest, err.Error())
+			return
+		}
+	}
+
+	// Порядок — по равнопромежуточной проекции: на расстояниях до пункта
+	// выдачи она не отличается от расстояния по большому кругу, а
+	// считается в SQL без тригонометрии по каждой строке.
+	query := "SELECT " + pickupPointColumns + " FROM pickup_points WHERE active ORDER BY id LIMIT $1"
+	args := []interface{}{limit}
+	if lat != nil {
+		query = "SELECT " + pickupPointColumns + ` FROM pickup_points WHERE active
+			ORDER BY (lat - $2) ^ 2 + ((lon - $3) * cos(radians($2))) ^ 2, id LIMIT $1`
+		args = append(args, *lat, *lon)
+	}
+	rows, err := db.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	points := []PickupPoint{}
+	for rows.Next() {
+		var p PickupPoint
+		if err := scanPickupPoint(rows, &p); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		if lat != nil {
+			km := math.Round(distanceKm(*lat, *lon, p.Lat, p.Lon)*10) / 10
+			p.DistanceKm = &km
+		}
+		points = append(points, p)
+	}
+	if err := rows.Err(); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(points)
+}
+
+// @Summary Get pickup point
+// @Description Пункт выдачи по id, в том числе неактивный
+// @Tags pickup-points
+// @Produce json
+// @Param id path int true "Pickup point ID"
+// @Success 200 {object} PickupPoint
+// @Failure 404 {object} map[string]string
+// @Router /pickup-points/{id} [get]
+func getPickupPoint(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	var p PickupPoint
+	err := scanPickupPoint(db.QueryRowContext(r.Context(), "SELECT "+pickupPointColumns+" FROM pickup_points WHERE id = $1", id), &p)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.PickupPointNotFound, "Pickup point not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// @Summary Create pickup point
+// @Description Добавить пункт выдачи. Требует X-Internal-API-Key.
+// @Tags pickup-points
+// @Accept json
+// @Produce json
+// @Param point body PickupPoint true "Pickup point"
+// @Success 201 {object} PickupPoint
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /admin/pickup-points [post]
+func createPickupPoint(w http.ResponseWriter, r *http.Request) {
+	p, ok := decodePickupPoint(w, r)
+	if !ok {
+		return
+	}
+
+	err := scanPickupPoint(db.QueryRowContext(r.Context(),
+		"INSERT INTO pickup_points (name, address, lat, lon, opening_hours, active) VALUES ($1, $2, $3, $4, $5, $6) RETURNING "+pickupPointColumns,
+		p.Name, p.Address, p.Lat, p.Lon, p.OpeningHours, p.Active), &p)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(p)
+}
+
+// @Summary Update pickup point
+// @Description Изменить пункт выдачи. Неактивный пункт не находится в поиске и не принимает новые доставки; уже созданные доставки сохраняют прежний адрес. Требует X-Internal-API-Key.
+// @Tags pickup-points
+// @Accept json
+// @Produce json
+// @Param id path int true "Pickup point ID"
+// @Param point body PickupPoint true "Pickup point"
+// @Success 200 {object} PickupPoint
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/pickup-points/{id} [put]
+func updatePickupPoint(w http.ResponseWriter, r *http.Request) {
+	p, ok := decodePickupPoint(w, r)
+	if !ok {
+		return
+	}
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	err := scanPickupPoint(db.QueryRowContext(r.Context(),
+		`UPDATE pickup_points SET name = $2, address = $3, lat = $4, lon = $5, opening_hours = $6, active = $7, updated_at = NOW()
+		 WHERE id = $1 RETURNING `+pickupPointColumns,
+		id, p.Name, p.Address, p.Lat, p.Lon, p.OpeningHours, p.Active), &p)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.PickupPointNotFound, "Pickup point not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// @Summary Delete pickup point
+// @Description Удалить пункт выдачи. Пункт, на который ссылаются доставки, удалить нельзя (409) — его выключают через active=false. Требует X-Internal-API-Key.
+// @Tags pickup-points
+// @Param id path int true "Pickup point ID"
+// @Success 204
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /admin/pickup-points/{id} [delete]
+func deletePickupPoint(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	result, err := db.ExecContext(r.Context(), "DELETE FROM pickup_points WHERE id = $1", id)
+	if pg.IsForeignKeyViolation(err) {
+		apierr.Write(w, apierr.Conflict, "Pickup point has deliveries; deactivate it with active=false instead")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		apierr.Write(w, apierr.PickupPointNotFound, "Pickup point not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Confirm pickup
+// @Description Выдать доставку в пункте выдачи: код получения из доставки (pickup_code), который называет покупатель, переводит её из ready_for_pickup в delivered. Для доставки с age_restricted нужен recipient_age_verified=true.
+// @Tags deliveries
+// @Accept json
+// @Produce json
+// @Param id path int true "Delivery ID"
+// @Param confirm body ConfirmPickupRequest true "Код получения"
+// @Success 200 {object} Delivery
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "Доставка не в пункт выдачи или не в ready_for_pickup"
+// @Failure 422 {object} map[string]string "invalid_pickup_code или recipient_age_not_verified"
+// @Router /deliveries/{id}/confirm-pickup [post]
+func confirmPickup(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	var in ConfirmPickupRequest
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil && !errors.Is(err, io.EOF) {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	in.Code = strings.ToUpper(strings.TrimSpace(in.Code))
+	if in.Code == "" {
+		apierr.Write(w, apierr.InvalidRequest, "code is required")
+		return
+	}
+
+	var d Delivery
+	err := pg.Locked(r.Context(), db, func(tx *sql.Tx) error {
+		var current Delivery
+		err := scanDelivery(tx.QueryRowContext(r.Context(), "SELECT "+deliveryColumns+" FROM deliveries WHERE id = $1 FOR UPDATE", id), &current)
+		if err != nil {
+			return err
+		}
+		if current.PickupPointID == nil || current.Status != "ready_for_pickup" || current.PickupCode == nil {
+			return apierr.New(apierr.InvalidState, fmt.Sprintf("delivery is %s, not ready for pickup at a pickup point", current.Status))
+		}
+		if subtle.ConstantTimeCompare([]byte(in.Code), []byte(*current.PickupCode)) != 1 {
+			return apierr.New(apierr.InvalidPickupCode, "pickup code does not match")
+		}
+		verified := current.RecipientAgeVerified || in.RecipientAgeVerified
+		if err := recipientAgeError(current.AgeRestricted, verified); err != nil {
+			return err
+		}
+
+		err = scanDelivery(tx.QueryRowContext(r.Context(),
+			`UPDATE deliveries SET status = 'delivered', delivered_at = NOW(), recipient_age_verified = $2, updated_at = NOW()
+			 WHERE id = $1 RETURNING `+deliveryColumns, id, verified), &d)
+		if err != nil {
+			return err
+		}
+		return recordDeliveryTransitions(r.Context(), tx, &current, &d)
+	})
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.DeliveryNotFound, "Delivery not found")
+		return
+	} else if err != nil {
+		apierr.Respond(w, err)
+		return
+	}
+	log.Printf("📦 Delivery %d picked up at pickup point %d", d.ID, *d.PickupPointID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d)
+}
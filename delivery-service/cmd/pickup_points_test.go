@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"pkg/apierr"
+)
+
+func TestApplyPickupPointTarget(t *testing.T) {
+	ctx := context.Background()
+	point := 7
+	var e *apierr.Error
+
+	// Адрес без пункта проверяется без обращения к БД.
+	if err := applyPickupPoint(ctx, nil, &Delivery{Address: "742 Evergreen Terrace"}); err != nil {
+		t.Errorf("address only: %v", err)
+	}
+	for name, d := range map[string]Delivery{
+		"neither": {Address: "  "},
+		"both":    {Address: "742 Evergreen Terrace", PickupPointID: &point},
+		"courier": {PickupPointID: &point, CourierID: &point},
+	} {
+		if err := applyPickupPoint(ctx, nil, &d); !errors.As(err, &e) || e.Code != apierr.InvalidRequest {
+			t.Errorf("%s: err = %v, want %s", name, err, apierr.InvalidRequest)
+		}
+	}
+}
+
+func TestPickupStatusError(t *testing.T) {
+	var e *apierr.Error
+	if err := pickupStatusError(false, "ready_for_pickup"); !errors.As(err, &e) || e.Code != apierr.InvalidStatusTransition {
+		t.Errorf("address delivery ready_for_pickup: %v", err)
+	}
+	if err := pickupStatusError(true, "delivered"); !errors.As(err, &e) || e.Code != apierr.InvalidStatusTransition {
+		t.Errorf("pickup delivery delivered via PUT: %v", err)
+	}
+	if err := pickupStatusError(true, "ready_for_pickup"); err != nil {
+		t.Errorf("pickup delivery ready_for_pickup: %v", err)
+	}
+}
+
+func TestNewPickupCode(t *testing.T) {
+	code, err := newPickupCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != pickupCodeLength || strings.Trim(code, labelAlphabet) != "" {
+		t.Errorf("code %q is not %d characters of %s", code, pickupCodeLength, labelAlphabet)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+)
+
+// maxRatingComment — предельная длина комментария к оценке в символах.
+const maxRatingComment = 1000
+
+// Rating — оценка получателем завершённой доставки. CourierID — курьер,
+// который вёз доставку на момент оценки.
+type Rating struct {
+	DeliveryID int       `json:"delivery_id"`
+	CourierID  *int      `json:"courier_id"`
+	Score      int       `json:"score"`
+	Comment    string    `json:"comment"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// CourierRating — средняя оценка курьера.
+type CourierRating struct {
+	CourierID int      `json:"courier_id"`
+	Average   *float64 `json:"average"`
+	Count     int      `json:"count"`
+}
+
+const ratingColumns = "delivery_id, courier_id, score, comment, created_at"
+
+func scanRating(row interface{ Scan(...interface{}) error }, rt *Rating) error {
+	return row.Scan(&rt.DeliveryID, &rt.CourierID, &rt.Score, &rt.Comment, &rt.CreatedAt)
+}
+
+// cleanComment убирает управляющие символы, кроме перевода строки, и
+// пробелы по краям.
+func cleanComment(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r != '\n' && unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(s, ""))
+	return strings.TrimSpace(s)
+}
+
+// @Summary Rate delivery
+// @Description Оценить доставленную доставку от 1 до 5 с необязательным комментарием (до 1000 символов). Оценить можно один раз.
+// @Tags ratings
+// @Accept json
+// @Produce json
+// @Param id path int true "Delivery ID"
+// @Param rating body Rating true "Rating"
+// @Success 201 {object} Rating
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "Доставка не доставлена или уже оценена"
+// @Router /deliveries/{id}/rating [post]
+func createDeliveryRating(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	var rt Rating
+	if err := json.NewDecoder(r.Body).Decode(&rt); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	if rt.Score < 1 || rt.Score > 5 {
+		apierr.Write(w, apierr.InvalidRequest, "score must be between 1 and 5")
+		return
+	}
+	rt.Comment = cleanComment(rt.Comment)
+	if utf8.RuneCountInString(rt.Comment) > maxRatingComment {
+		apierr.Write(w, apierr.InvalidRequest, fmt.Sprintf("comment must be at most %d characters", maxRatingComment))
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRowContext(r.Context(), "SELECT status, courier_id FROM deliveries WHERE id = $1 FOR SHARE", id).Scan(&status, &rt.CourierID)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.DeliveryNotFound, "Delivery not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if status != "delivered" {
+		apierr.Write(w, apierr.InvalidStatusTransition, fmt.Sprintf("Only delivered deliveries can be rated, delivery is %s", status))
+		return
+	}
+
+	err = scanRating(tx.QueryRowContext(r.Context(),
+		"INSERT INTO delivery_ratings (delivery_id, courier_id, score, comment) VALUES ($1, $2, $3, $4) ON CONFLICT (delivery_id) DO NOTHING RETURNING "+ratingColumns,
+		id, rt.CourierID, rt.Score, rt.Comment), &rt)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.Conflict, "Delivery is already rated")
+		return
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rt)
+}
+
+// @Summary Courier rating
+// @Description Средняя оценка курьера и число оценок. Без оценок average — null. Оценки демо-доставок (simulated) не учитываются.
+// @Tags ratings
+// @Produce json
+// @Param id path int true "Courier ID"
+// @Success 200 {object} CourierRating
+// @Router /couriers/{id}/rating [get]
+func getCourierRating(w http.ResponseWriter, r *http.Request) {
+	cr := CourierRating{}
+	cr.CourierID, _ = strconv.Atoi(mux.Vars(r)["id"])
+
+	err := db.QueryRowContext(r.Context(),
+		`SELECT ROUND(AVG(r.score), 2)::float8, COUNT(*) FROM delivery_ratings r
+		 JOIN deliveries d ON d.id = r.delivery_id WHERE r.courier_id = $1 AND NOT d.simulated`, cr.CourierID).
+		Scan(&cr.Average, &cr.Count)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cr)
+}
+
+// @Summary List ratings
+// @Description Последние 100 оценок, новые первыми. Требует X-Internal-API-Key.
+// @Tags ratings
+// @Produce json
+// @Param courier_id query int false "Courier ID"
+// @Param min_score query int false "Минимальная оценка"
+// @Success 200 {array} Rating
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /deliveries/ratings [get]
+func getDeliveryRatings(w http.ResponseWriter, r *http.Request) {
+	query := "SELECT " + ratingColumns + " FROM delivery_ratings WHERE TRUE"
+	var args []interface{}
+	for _, f := range []struct{ param, cond string }{
+		{"courier_id", " AND courier_id = $%d"},
+		{"min_score", " AND score >= $%d"},
+	} {
+		v := r.URL.Query().Get(f.param)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			apierr.Write(w, apierr.InvalidRequest, f.param+" must be an integer")
+			return
+		}
+		args = append(args, n)
+		query += fmt.Sprintf(f.cond, len(args))
+	}
+
+	rows, err := db.QueryContext(r.Context(), query+" ORDER BY created_at DESC, delivery_id DESC LIMIT 100", args...)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	ratings := []Rating{}
+	for rows.Next() {
+		var rt Rating
+		if err := scanRating(rows, &rt); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		ratings = append(ratings, rt)
+	}
+	if err := rows.Err(); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ratings)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+)
+
+// RouteStop — точка маршрута курьера. ScheduledAt — начало окна доставки,
+// а без окна — estimated_delivery.
+type RouteStop struct {
+	DeliveryID  int        `json:"delivery_id"`
+	OrderID     int        `json:"order_id"`
+	Address     string     `json:"address"`
+	Status      string     `json:"status"`
+	ScheduledAt time.Time  `json:"scheduled_at"`
+	WindowStart *time.Time `json:"window_start"`
+	WindowEnd   *time.Time `json:"window_end"`
+	Lat         *float64   `json:"lat"`
+	Lon         *float64   `json:"lon"`
+	Packages    int        `json:"packages"`
+}
+
+// validateCoordinates проверяет координаты адреса доставки: задаются
+// вместе и в допустимых пределах.
+func validateCoordinates(d *Delivery) error {
+	if d.Lat == nil && d.Lon == nil {
+		return nil
+	}
+	if d.Lat == nil || d.Lon == nil {
+		return fmt.Errorf("lat and lon must be set together")
+	}
+	if *d.Lat < -90 || *d.Lat > 90 || *d.Lon < -180 || *d.Lon > 180 {
+		return fmt.Errorf("lat/lon out of range")
+	}
+	return nil
+}
+
+// distanceKm — расстояние по большому кругу между двумя точками.
+func distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKm = 6371
+	rad := math.Pi / 180
+	dLat, dLon := (lat2-lat1)*rad, (lon2-lon1)*rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// orderRoute упорядочивает точки с одинаковым ScheduledAt ближайшим
+// соседом, начиная от (lat, lon). Точки без координат идут в конце своей
+// группы. stops должны быть отсортированы по ScheduledAt.
+func orderRoute(stops []RouteStop, lat, lon *float64) {
+	for i := 0; i < len(stops); {
+		j := i + 1
+		for j < len(stops) && stops[j].ScheduledAt.Equal(stops[i].ScheduledAt) {
+			j++
+		}
+		for k := i; k < j; k++ {
+			best := -1
+			bestDist := math.Inf(1)
+			for m := k; m < j; m++ {
+				if stops[m].Lat == nil {
+					continue
+				}
+				if lat == nil {
+					best = m
+					break
+				}
+				if d := distanceKm(*lat, *lon, *stops[m].Lat, *stops[m].Lon); d < bestDist {
+					best, bestDist = m, d
+				}
+			}
+			if best < 0 {
+				break
+			}
+			stops[k], stops[best] = stops[best], stops[k]
+			lat, lon = stops[k].Lat, stops[k].Lon
+		}
+		i = j
+	}
+}
+
+// @Summary Courier route
+// @Description Доставки курьера на дату (UTC) в порядке объезда: по окну доставки, внутри одного окна — ближайший сосед от последней известной позиции курьера. Пустой маршрут — пустой массив. Ограничение доступа самим курьером появится вместе с JWT.
+// @Tags couriers
+// @Produce json
+// @Param id path int true "Courier ID"
+// @Param date query string true "Дата (YYYY-MM-DD)"
+// @Success 200 {array} RouteStop
+// @Failure 400 {object} map[string]string
+// @Router /couriers/{id}/route [get]
+func getCourierRoute(w http.ResponseWriter, r *http.Request) {
+	courierID, _ := strconv.Atoi(mux.Vars(r)["id"])
+	date, err := time.Parse("2006-01-02", r.URL.Query().Get("date"))
+	if err != nil {
+		apierr.Write(w, apierr.InvalidRequest, "date is required (YYYY-MM-DD)")
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT d.id, d.order_id, d.address, d.status, COALESCE(d.window_start, d.estimated_delivery),
+		        d.window_start, d.window_end, d.lat, d.lon, COUNT(p.id)
+		 FROM deliveries d LEFT JOIN delivery_packages p ON p.delivery_id = d.id
+		 WHERE d.courier_id = $1
+		   AND COALESCE(d.window_start, d.estimated_delivery) >= $2
+		   AND COALESCE(d.window_start, d.estimated_delivery) < $2 + INTERVAL '1 day'
+		 GROUP BY d.id
+		 ORDER BY 5, d.id`, courierID, date)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	stops := []RouteStop{}
+	for rows.Next() {
+		var s RouteStop
+		if err := rows.Scan(&s.DeliveryID, &s.OrderID, &s.Address, &s.Status, &s.ScheduledAt,
+			&s.WindowStart, &s.WindowEnd, &s.Lat, &s.Lon, &s.Packages); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		stops = append(stops, s)
+	}
+	if err := rows.Err(); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	// Маршрут начинается от последней позиции курьера, если она известна.
+	var lat, lon *float64
+	if len(stops) > 1 {
+		err = db.QueryRowContext(r.Context(),
+			"SELECT lat, lon FROM courier_locations WHERE courier_id = $1 ORDER BY recorded_at DESC LIMIT 1", courierID).
+			Scan(&lat, &lon)
+		if err != nil && err != sql.ErrNoRows {
+			apierr.Internal(w, err)
+			return
+		}
+	}
+	orderRoute(stops, lat, lon)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stops)
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"context"
+
+	"pkg/seed"
+)
+
+// insertSeed вставляет демо-доставки для POST /admin/seed.
+func insertSeed(ctx context.Context, ds seed.Dataset, reset bool) ([]seed.Report, error) {
+	rows := make([][]interface{}, 0, len(ds.Deliveries))
+	for _, d := range ds.Deliveries {
+		rows = append(rows, []interface{}{d.ID, d.OrderID, d.Address, d.Status})
+	}
+	rep, err := seed.Insert(ctx, db, "deliveries", []string{"id", "order_id", "address", "status"}, rows, reset)
+	return []seed.Report{rep}, err
+}
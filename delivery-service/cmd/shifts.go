@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+)
+
+// activeDeliveryStatuses — доставки, которые занимают курьера.
+const activeDeliveryStatuses = "('pending', 'in_transit')"
+
+// Shift — смена курьера. Capacity — сколько активных доставок курьер
+// может везти одновременно, MaxWeightKg — грузоподъёмность транспорта
+// на смене (nil — без ограничения).
+type Shift struct {
+	ID          int       `json:"id"`
+	CourierID   int       `json:"courier_id"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Capacity    int       `json:"capacity"`
+	MaxWeightKg *float64  `json:"max_weight_kg"`
+	CreatedAt   string    `json:"createdAt"`
+	UpdatedAt   string    `json:"updatedAt"`
+}
+
+// AvailableCourier — курьер на смене в момент at.
+type AvailableCourier struct {
+	CourierID         int       `json:"courier_id"`
+	ShiftID           int       `json:"shift_id"`
+	ShiftEnd          time.Time `json:"shift_end"`
+	Capacity          int       `json:"capacity"`
+	ActiveDeliveries  int       `json:"active_deliveries"`
+	RemainingCapacity int       `json:"remaining_capacity"`
+}
+
+const shiftColumns = "id, courier_id, starts_at, ends_at, capacity, max_weight_kg, created_at, updated_at"
+
+func scanShift(row interface{ Scan(...interface{}) error }, s *Shift) error {
+	return row.Scan(&s.ID, &s.CourierID, &s.Start, &s.End, &s.Capacity, &s.MaxWeightKg, &s.CreatedAt, &s.UpdatedAt)
+}
+
+// courierShift возвращает смену курьера, покрывающую at, или sql.ErrNoRows.
+func courierShift(ctx context.Context, courierID int, at time.Time) (Shift, error) {
+	var s Shift
+	err := scanShift(db.QueryRowContext(ctx,
+		"SELECT "+shiftColumns+" FROM courier_shifts WHERE courier_id = $1 AND starts_at <= $2 AND ends_at > $2 LIMIT 1",
+		courierID, at.UTC()), &s)
+	return s, err
+}
+
+// courierAssignmentError возвращает ошибку 422, если курьер назначается на
+// доставку вне своей смены или посылки доставки deliveryID тяжелее, чем
+// увезёт его транспорт; nil — назначение допустимо.
+func courierAssignmentError(ctx context.Context, courierID *int, deliveryID int) error {
+	if courierID == nil {
+		return nil
+	}
+	shift, err := courierShift(ctx, *courierID, time.Now())
+	if err == sql.ErrNoRows {
+		return apierr.New(apierr.CourierNotOnShift, fmt.Sprintf("Courier %d is not on shift", *courierID))
+	} else if err != nil {
+		return err
+	}
+	if shift.MaxWeightKg == nil || deliveryID == 0 {
+		return nil
+	}
+	weight, err := packagesWeight(ctx, db, deliveryID)
+	if err != nil {
+		return err
+	}
+	if weight > *shift.MaxWeightKg {
+		return apierr.New(apierr.CourierCapacityExceeded, fmt.Sprintf("Packages weigh %.2f kg, courier %d carries at most %.2f kg", weight, *courierID, *shift.MaxWeightKg))
+	}
+	return nil
+}
+
+// checkCourierAssignment отвечает ошибкой courierAssignmentError и
+// возвращает false, если назначение недопустимо.
+func checkCourierAssignment(w http.ResponseWriter, r *http.Request, courierID *int, deliveryID int) bool {
+	if err := courierAssignmentError(r.Context(), courierID, deliveryID); err != nil {
+		apierr.Respond(w, err)
+		return false
+	}
+	return true
+}
+
+func decodeShift(w http.ResponseWriter, r *http.Request) (Shift, bool) {
+	var s Shift
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return s, false
+	}
+	if s.Start.IsZero() || s.End.IsZero() || !s.End.After(s.Start) {
+		apierr.Write(w, apierr.InvalidRequest, "start and end are required and end must be after start")
+		return s, false
+	}
+	if s.Capacity == 0 {
+		s.Capacity = 3
+	}
+	if s.Capacity < 0 {
+		apierr.Write(w, apierr.InvalidRequest, "capacity must be positive")
+		return s, false
+	}
+	if s.MaxWeightKg != nil && *s.MaxWeightKg <= 0 {
+		apierr.Write(w, apierr.InvalidRequest, "max_weight_kg must be positive")
+		return s, false
+	}
+	s.Start, s.End = s.Start.UTC(), s.End.UTC()
+	return s, true
+}
+
+// saveShift вставляет (id == 0) или обновляет смену. Пересечения смен
+// одного курьера проверяются под advisory-блокировкой по courier_id,
+// поэтому два параллельных запроса не создадут пересекающиеся смены.
+func saveShift(w http.ResponseWriter, r *http.Request, s Shift, status int) {
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(r.Context(), "SELECT pg_advisory_xact_lock(hashtext('courier_shifts'), $1)", s.CourierID); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	var overlap int
+	err = tx.QueryRowContext(r.Context(),
+		"SELECT id FROM courier_shifts WHERE courier_id = $1 AND id <> $2 AND starts_at < $4 AND ends_at > $3 LIMIT 1",
+		s.CourierID, s.ID, s.Start, s.End).Scan(&overlap)
+	if err == nil {
+		apierr.Write(w, apierr.ShiftOverlap, fmt.Sprintf("Shift overlaps shift %d of courier %d", overlap, s.CourierID))
+		return
+	} else if err != sql.ErrNoRows {
+		apierr.Internal(w, err)
+		return
+	}
+
+	if s.ID == 0 {
+		err = scanShift(tx.QueryRowContext(r.Context(),
+			"INSERT INTO courier_shifts (courier_id, starts_at, ends_at, capacity, max_weight_kg) VALUES ($1, $2, $3, $4, $5) RETURNING "+shiftColumns,
+			s.CourierID, s.Start, s.End, s.Capacity, s.MaxWeightKg), &s)
+	} else {
+		err = scanShift(tx.QueryRowContext(r.Context(),
+			"UPDATE courier_shifts SET starts_at = $3, ends_at = $4, capacity = $5, max_weight_kg = $6 WHERE id = $1 AND courier_id = $2 RETURNING "+shiftColumns,
+			s.ID, s.CourierID, s.Start, s.End, s.Capacity, s.MaxWeightKg), &s)
+	}
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.ShiftNotFound, "Shift not found")
+		return
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(s)
+}
+
+// @Summary List courier shifts
+// @Description Смены курьера по времени начала. from/to (RFC3339) ограничивают период.
+// @Tags couriers
+// @Produce json
+// @Param id path int true "Courier ID"
+// @Param from query string false "Смены, заканчивающиеся после (RFC3339)"
+// @Param to query string false "Смены, начинающиеся до (RFC3339)"
+// @Success 200 {array} Shift
+// @Failure 400 {object} map[string]string
+// @Router /couriers/{id}/shifts [get]
+func getCourierShifts(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	courierID, _ := strconv.Atoi(vars["id"])
+
+	from, to := time.Time{}, time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		if v := r.URL.Query().Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				apierr.Write(w, apierr.InvalidRequest, p.name+" must be an RFC3339 timestamp")
+				return
+			}
+			*p.dst = t.UTC()
+		}
+	}
+
+	rows, err := db.QueryContext(r.Context(),
+		"SELECT "+shiftColumns+" FROM courier_shifts WHERE courier_id = $1 AND ends_at > $2 AND starts_at < $3 ORDER BY starts_at",
+		courierID, from, to)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	shifts := []Shift{}
+	for rows.Next() {
+		var s Shift
+		if err := scanShift(rows, &s); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		shifts = append(shifts, s)
+	}
+	if err := rows.Err(); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shifts)
+}
+
+// @Summary Create courier shift
+// @Description Добавить смену курьеру. Смены одного курьера не должны пересекаться. capacity по умолчанию 3.
+// @Tags couriers
+// @Accept json
+// @Produce json
+// @Param id path int true "Courier ID"
+// @Param shift body Shift true "Shift"
+// @Success 201 {object} Shift
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /couriers/{id}/shifts [post]
+func createCourierShift(w http.ResponseWriter, r *http.Request) {
+	s, ok := decodeShift(w, r)
+	if !ok {
+		return
+	}
+	s.ID = 0
+	s.CourierID, _ = strconv.Atoi(mux.Vars(r)["id"])
+	saveShift(w, r, s, http.StatusCreated)
+}
+
+// @Summary Update courier shift
+// @Description Изменить время, вместимость или грузоподъёмность смены
+// @Tags couriers
+// @Accept json
+// @Produce json
+// @Param id path int true "Courier ID"
+// @Param shift_id path int true "Shift ID"
+// @Param shift body Shift true "Shift"
+// @Success 200 {object} Shift
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /couriers/{id}/shifts/{shift_id} [put]
+func updateCourierShift(w http.ResponseWriter, r *http.Request) {
+	s, ok := decodeShift(w, r)
+	if !ok {
+		return
+	}
+	vars := mux.Vars(r)
+	s.CourierID, _ = strconv.Atoi(vars["id"])
+	s.ID, _ = strconv.Atoi(vars["shift_id"])
+	saveShift(w, r, s, http.StatusOK)
+}
+
+// @Summary Delete courier shift
+// @Description Удалить смену курьера
+// @Tags couriers
+// @Param id path int true "Courier ID"
+// @Param shift_id path int true "Shift ID"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Router /couriers/{id}/shifts/{shift_id} [delete]
+func deleteCourierShift(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	courierID, _ := strconv.Atoi(vars["id"])
+	shiftID, _ := strconv.Atoi(vars["shift_id"])
+
+	result, err := db.ExecContext(r.Context(), "DELETE FROM courier_shifts WHERE id = $1 AND courier_id = $2", shiftID, courierID)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		apierr.Write(w, apierr.ShiftNotFound, "Shift not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Available couriers
+// @Description Курьеры на смене в момент at (по умолчанию сейчас) с оставшейся вместимостью: capacity смены минус активные (pending, in_transit) доставки. Сначала самые свободные.
+// @Tags couriers
+// @Produce json
+// @Param at query string false "Момент (RFC3339)"
+// @Success 200 {array} AvailableCourier
+// @Failure 400 {object} map[string]string
+// @Router /couriers/available [get]
+func getAvailableCouriers(w http.ResponseWriter, r *http.Request) {
+	at := time.Now()
+	if v := r.URL.Query().Get("at"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			apierr.Write(w, apierr.InvalidRequest, "at must be an RFC3339 timestamp")
+			return
+		}
+		at = t
+	}
+
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT s.courier_id, s.id, s.ends_at, s.capacity, COUNT(d.id)
+		 FROM courier_shifts s
+		 LEFT JOIN deliveries d ON d.courier_id = s.courier_id AND d.status IN `+activeDeliveryStatuses+`
+		 WHERE s.starts_at <= $1 AND s.ends_at > $1
+		 GROUP BY s.id
+		 ORDER BY s.capacity - COUNT(d.id) DESC, s.courier_id`, at.UTC())
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	couriers := []AvailableCourier{}
+	for rows.Next() {
+		var c AvailableCourier
+		if err := rows.Scan(&c.CourierID, &c.ShiftID, &c.ShiftEnd, &c.Capacity, &c.ActiveDeliveries); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		c.RemainingCapacity = max(c.Capacity-c.ActiveDeliveries, 0)
+		couriers = append(couriers, c)
+	}
+	if err := rows.Err(); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(couriers)
+}
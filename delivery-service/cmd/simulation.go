@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"math"
+	"time"
+
+	"pkg/pg"
+)
+
+// Симуляция доставок для демо (DELIVERY_SIMULATION=true). Доставка с
+// simulated=true проходит сама весь путь за DELIVERY_SIMULATION_DURATION
+// от создания: pending → in_transit (курьер забрал посылку) →
+// out_for_delivery → delivered, а курьер каждые DELIVERY_SIMULATION_TICK
+// сообщает координаты на пути к адресу. Переходы идут через
+// recordDeliveryTransitions, как в PUT /deliveries/{id}, поэтому
+// вебхуки, SMS и поток /stream получают их как настоящие. Доставка в
+// пункт выдачи доходит до ready_for_pickup; выдать её можно только по
+// pickup_code. Демо-доставки не входят в статистику и рейтинги курьеров.
+
+// Доли DELIVERY_SIMULATION_DURATION, после которых курьер забирает
+// посылку и выезжает к получателю.
+const (
+	simPickupAt         = 0.1
+	simOutForDeliveryAt = 0.6
+)
+
+// simPickedUp — событие отслеживания: курьер забрал посылку.
+const simPickedUp = "picked_up"
+
+// simRouteKm — расстояние от точки, где курьер забирает посылку, до адреса.
+const simRouteKm = 3.0
+
+// simBatchSize — сколько доставок продвигается за тик.
+const simBatchSize = 100
+
+// simulationAction — что сделать с доставкой на очередном тике.
+type simulationAction struct {
+	Status         string // новый статус; пусто — без перехода
+	OutForDelivery bool   // записать событие out_for_delivery
+	Ping           bool   // записать координаты курьера
+}
+
+// simulationStep выбирает действие для доставки в статусе status через
+// долю progress её расписания. outSent — событие out_for_delivery уже
+// записано.
+func simulationStep(status string, pickup, outSent bool, progress float64) simulationAction {
+	var a simulationAction
+	switch {
+	case status == "pending" && progress >= simPickupAt:
+		a.Status = "in_transit"
+	case status == "in_transit" && progress >= 1 && pickup:
+		a.Status = "ready_for_pickup"
+	case status == "in_transit" && progress >= 1:
+		a.Status = "delivered"
+	}
+	moving := !pickup && (status == "in_transit" || a.Status == "in_transit")
+	a.OutForDelivery = moving && !outSent && progress >= simOutForDeliveryAt
+	a.Ping = moving
+	return a
+}
+
+// simulatedPosition — координаты курьера на прямой к адресу (lat, lon).
+// Направление, откуда едет курьер, постоянно для доставки id.
+func simulatedPosition(lat, lon float64, id int, progress float64) (float64, float64) {
+	t := math.Min(math.Max((progress-simPickupAt)/(1-simPickupAt), 0), 1)
+	bearing := float64(id%360) * math.Pi / 180
+	// Градус широты — около 111 км, градус долготы короче к полюсам.
+	dLat := simRouteKm / 111 * math.Cos(bearing)
+	dLon := simRouteKm / (111 * math.Max(math.Cos(lat*math.Pi/180), 0.01)) * math.Sin(bearing)
+	return lat + dLat*(1-t), lon + dLon*(1-t)
+}
+
+func startSimulation(ctx context.Context) {
+	if !cfg.DeliverySimulation {
+		return
+	}
+	go runSimulation(ctx, cfg.SimulationTickInterval, cfg.SimulationDuration)
+	log.Printf("🎬 Delivery simulation started (%s per delivery)", cfg.SimulationDuration)
+}
+
+func runSimulation(ctx context.Context, tick, duration time.Duration) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := simulateBatch(ctx, duration); err != nil && ctx.Err() == nil {
+				log.Printf("⚠️ Delivery simulation failed: %v", err)
+			}
+		}
+	}
+}
+
+// simulateBatch продвигает незавершённые демо-доставки.
+func simulateBatch(ctx context.Context, duration time.Duration) error {
+	rows, err := db.QueryContext(ctx,
+		"SELECT id FROM deliveries WHERE simulated AND status IN ('pending', 'in_transit') ORDER BY id LIMIT $1", simBatchSize)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := simulateDelivery(ctx, id, duration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// simulateDelivery выполняет очередной шаг симуляции доставки id в одной
+// транзакции. Доставку, которую сейчас меняет другой запрос или реплика,
+// пропускает до следующего тика.
+func simulateDelivery(ctx context.Context, id int, duration time.Duration) error {
+	err := pg.Locked(ctx, db, func(tx *sql.Tx) error {
+		var d Delivery
+		err := scanDelivery(tx.QueryRowContext(ctx,
+			"SELECT "+deliveryColumns+" FROM deliveries WHERE id = $1 AND simulated FOR UPDATE SKIP LOCKED", id), &d)
+		if err != nil {
+			return err
+		}
+		var elapsed float64
+		var outSent bool
+		err = tx.QueryRowContext(ctx,
+			`SELECT EXTRACT(EPOCH FROM NOW() - created_at)::float8,
+			        EXISTS (SELECT 1 FROM delivery_tracking_events WHERE delivery_id = $1 AND event_type = $2)
+			 FROM deliveries WHERE id = $1`, id, smsOutForDelivery).Scan(&elapsed, &outSent)
+		if err != nil {
+			return err
+		}
+		progress := elapsed / duration.Seconds()
+		a := simulationStep(d.Status, d.PickupPointID != nil, outSent, progress)
+
+		if a.Status == "in_transit" {
+			e := TrackingEvent{DeliveryID: id, EventType: simPickedUp, Description: "Parcel picked up by courier (simulated)"}
+			if err := insertTrackingEvent(ctx, tx, &e); err != nil {
+				return err
+			}
+		}
+		if a.Ping && d.Lat != nil && d.Lon != nil {
+			p := LocationPing{DeliveryID: id, CourierID: d.CourierID}
+			p.Lat, p.Lon = simulatedPosition(*d.Lat, *d.Lon, id, progress)
+			if err := insertLocationPing(ctx, tx, &p); err != nil {
+				return err
+			}
+		}
+		if a.OutForDelivery {
+			e := TrackingEvent{DeliveryID: id, EventType: smsOutForDelivery, Description: "Courier is on the way (simulated)"}
+			if err := insertTrackingEvent(ctx, tx, &e); err != nil {
+				return err
+			}
+		}
+		if a.Status == "" {
+			return nil
+		}
+		return advanceSimulated(ctx, tx, &d, a.Status)
+	})
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	return err
+}
+
+// advanceSimulated переводит демо-доставку d в status. Курьер-симулятор
+// сканирует все посылки и проверяет возраст получателя при вручении.
+func advanceSimulated(ctx context.Context, tx *sql.Tx, d *Delivery, status string) error {
+	prev := *d
+	var pickupCode *string
+	if status == "ready_for_pickup" && d.PickupCode == nil {
+		code, err := newPickupCode()
+		if err != nil {
+			return err
+		}
+		pickupCode = &code
+	}
+	if status == "delivered" {
+		_, err := tx.ExecContext(ctx, "UPDATE delivery_packages SET confirmed_at = COALESCE(confirmed_at, NOW()) WHERE delivery_id = $1", d.ID)
+		if err != nil {
+			return err
+		}
+	}
+	err := scanDelivery(tx.QueryRowContext(ctx,
+		`UPDATE deliveries SET status = $2,
+		        delivered_at = CASE WHEN $2 = 'delivered' THEN COALESCE(delivered_at, NOW()) END,
+		        recipient_age_verified = recipient_age_verified OR $2 = 'delivered',
+		        pickup_code = COALESCE(pickup_code, $3), updated_at = NOW()
+		 WHERE id = $1 RETURNING `+deliveryColumns, d.ID, status, pickupCode), d)
+	if err != nil {
+		return err
+	}
+	return recordDeliveryTransitions(ctx, tx, &prev, d)
+}
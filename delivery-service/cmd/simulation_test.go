@@ -0,0 +1,46 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSimulationStep(t *testing.T) {
+	for _, tc := range []struct {
+		status   string
+		pickup   bool
+		outSent  bool
+		progress float64
+		want     simulationAction
+	}{
+		{"pending", false, false, 0.05, simulationAction{}},
+		{"pending", false, false, 0.2, simulationAction{Status: "in_transit", Ping: true}},
+		{"in_transit", false, false, 0.3, simulationAction{Ping: true}},
+		{"in_transit", false, false, 0.7, simulationAction{OutForDelivery: true, Ping: true}},
+		{"in_transit", false, true, 0.7, simulationAction{Ping: true}},
+		// Пропущенные тики: выезд записывается вместе с вручением.
+		{"in_transit", false, false, 1.5, simulationAction{Status: "delivered", OutForDelivery: true, Ping: true}},
+		{"in_transit", true, false, 0.7, simulationAction{}},
+		{"in_transit", true, false, 1, simulationAction{Status: "ready_for_pickup"}},
+		{"delivered", false, true, 2, simulationAction{}},
+	} {
+		if got := simulationStep(tc.status, tc.pickup, tc.outSent, tc.progress); got != tc.want {
+			t.Errorf("simulationStep(%q, pickup=%v, out=%v, %v) = %+v, want %+v", tc.status, tc.pickup, tc.outSent, tc.progress, got, tc.want)
+		}
+	}
+}
+
+func TestSimulatedPosition(t *testing.T) {
+	lat, lon := 55.75, 37.62
+	startLat, startLon := simulatedPosition(lat, lon, 7, 0)
+	if d := distanceKm(startLat, startLon, lat, lon); math.Abs(d-simRouteKm) > 0.1 {
+		t.Errorf("start is %.2f km from the address, want %.1f", d, simRouteKm)
+	}
+	midLat, midLon := simulatedPosition(lat, lon, 7, 0.55)
+	if d := distanceKm(midLat, midLon, lat, lon); math.Abs(d-simRouteKm/2) > 0.1 {
+		t.Errorf("halfway point is %.2f km from the address", d)
+	}
+	if endLat, endLon := simulatedPosition(lat, lon, 7, 1.2); endLat != lat || endLon != lon {
+		t.Errorf("end = %v, %v, want the address", endLat, endLon)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg/apierr"
+)
+
+// slotWindow — окно доставки внутри дня, смещения от полуночи UTC.
+type slotWindow struct {
+	start, end time.Duration
+}
+
+// Slot — окно доставки на конкретную дату с оставшейся вместимостью.
+type Slot struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Capacity  int       `json:"capacity"`
+	Booked    int       `json:"booked"`
+	Remaining int       `json:"remaining"`
+}
+
+var (
+	slotWindows      []slotWindow
+	slotCapacity     int
+	zoneSlotCapacity map[int]int
+)
+
+// initDeliverySlots применяет окна доставки и их вместимость из
+// конфигурации: DELIVERY_SLOTS — окна "HH:MM-HH:MM" через запятую (UTC),
+// DELIVERY_SLOT_CAPACITY — доставок на окно, DELIVERY_ZONE_SLOT_CAPACITY —
+// переопределения по зонам "zone_id:capacity" через запятую. Формат
+// проверен в Config.Validate.
+func initDeliverySlots() {
+	slotWindows, _ = parseSlotWindows(cfg.DeliverySlots)
+	slotCapacity = cfg.DeliverySlotCapacity
+	zoneSlotCapacity, _ = parseZoneSlotCapacity(cfg.DeliveryZoneSlotCapacity)
+}
+
+func parseSlotWindows(spec string) ([]slotWindow, error) {
+	var windows []slotWindow
+	for _, item := range strings.Split(spec, ",") {
+		bounds := strings.Split(strings.TrimSpace(item), "-")
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("DELIVERY_SLOTS: %q is not HH:MM-HH:MM", item)
+		}
+		var win [2]time.Duration
+		for i, b := range bounds {
+			t, err := time.Parse("15:04", b)
+			if err != nil {
+				return nil, fmt.Errorf("DELIVERY_SLOTS: %q is not HH:MM-HH:MM", item)
+			}
+			win[i] = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+		}
+		if win[1] <= win[0] {
+			return nil, fmt.Errorf("DELIVERY_SLOTS: %q ends before it starts", item)
+		}
+		windows = append(windows, slotWindow{win[0], win[1]})
+	}
+	return windows, nil
+}
+
+func parseZoneSlotCapacity(spec string) (map[int]int, error) {
+	capacity := map[int]int{}
+	if spec == "" {
+		return capacity, nil
+	}
+	for _, item := range strings.Split(spec, ",") {
+		parts := strings.Split(strings.TrimSpace(item), ":")
+		zone, err1 := strconv.Atoi(parts[0])
+		if len(parts) != 2 || err1 != nil {
+			return nil, fmt.Errorf("DELIVERY_ZONE_SLOT_CAPACITY: %q is not zone_id:capacity", item)
+		}
+		n, err := strconv.Atoi(parts[1])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("DELIVERY_ZONE_SLOT_CAPACITY: %q is not zone_id:capacity", item)
+		}
+		capacity[zone] = n
+	}
+	return capacity, nil
+}
+
+func capacityFor(zoneID *int) int {
+	if zoneID != nil {
+		if n, ok := zoneSlotCapacity[*zoneID]; ok {
+			return n
+		}
+	}
+	return slotCapacity
+}
+
+// validateWindow проверяет, что запрошенное окно совпадает с одним из
+// настроенных окон своего дня.
+func validateWindow(d *Delivery) error {
+	if d.WindowStart == nil && d.WindowEnd == nil {
+		return nil
+	}
+	if d.WindowStart == nil || d.WindowEnd == nil {
+		return fmt.Errorf("window_start and window_end must be set together")
+	}
+	start, end := d.WindowStart.UTC(), d.WindowEnd.UTC()
+	day := start.Truncate(24 * time.Hour)
+	for _, w := range slotWindows {
+		if start.Equal(day.Add(w.start)) && end.Equal(day.Add(w.end)) {
+			d.WindowStart, d.WindowEnd = &start, &end
+			return nil
+		}
+	}
+	return fmt.Errorf("requested window is not a delivery slot, see GET /deliveries/slots")
+}
+
+// queryer — общее у *sql.DB и *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// daySlots возвращает окна даты с занятостью в зоне. Окно занимают все
+// доставки, кроме failed.
+func daySlots(ctx context.Context, q queryer, date time.Time, zoneID *int) ([]Slot, error) {
+	day := date.UTC().Truncate(24 * time.Hour)
+	rows, err := q.QueryContext(ctx,
+		`SELECT window_start, COUNT(*) FROM deliveries
+		 WHERE window_start >= $1 AND window_start < $1 + INTERVAL '1 day'
+		   AND zone_id IS NOT DISTINCT FROM $2 AND status <> 'failed'
+		 GROUP BY window_start`, day, zoneID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	booked := map[time.Time]int{}
+	for rows.Next() {
+		var start time.Time
+		var n int
+		if err := rows.Scan(&start, &n); err != nil {
+			return nil, err
+		}
+		booked[start.UTC()] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	capacity := capacityFor(zoneID)
+	slots := make([]Slot, 0, len(slotWindows))
+	for _, w := range slotWindows {
+		s := Slot{Start: day.Add(w.start), End: day.Add(w.end), Capacity: capacity}
+		s.Booked = booked[s.Start]
+		s.Remaining = max(capacity-s.Booked, 0)
+		slots = append(slots, s)
+	}
+	return slots, nil
+}
+
+// reserveSlot проверяет вместимость окна доставки d внутри tx. Окна зоны
+// бронируются по очереди под транзакционной advisory-блокировкой, поэтому
+// проверка и последующая вставка атомарны. excludeID — доставка, которая
+// переносится и сама окно не занимает; key — Idempotency-Key повтора.
+func reserveSlot(ctx context.Context, tx *sql.Tx, d *Delivery, excludeID int, key string) (bool, error) {
+	zone := 0
+	if d.ZoneID != nil {
+		zone = *d.ZoneID
+	}
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('delivery-slots'), $1)", zone); err != nil {
+		return false, err
+	}
+
+	var booked int
+	err := tx.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM deliveries
+		 WHERE window_start = $1 AND zone_id IS NOT DISTINCT FROM $2 AND status <> 'failed'
+		   AND id <> $3 AND idempotency_key IS DISTINCT FROM NULLIF($4, '')`,
+		d.WindowStart, d.ZoneID, excludeID, key).Scan(&booked)
+	if err != nil {
+		return false, err
+	}
+	return booked < capacityFor(d.ZoneID), nil
+}
+
+// slotFullError — ошибка 409 со свободными окнами того же дня и зоны.
+func slotFullError(ctx context.Context, d *Delivery) error {
+	slots, err := daySlots(ctx, db, *d.WindowStart, d.ZoneID)
+	if err != nil {
+		return err
+	}
+	free := []Slot{}
+	for _, s := range slots {
+		if s.Remaining > 0 {
+			free = append(free, s)
+		}
+	}
+	return apierr.New(apierr.SlotFull, "requested delivery window is fully booked").
+		With("alternatives", free)
+}
+
+// writeSlotFull отвечает 409 со свободными окнами того же дня и зоны.
+func writeSlotFull(w http.ResponseWriter, r *http.Request, d *Delivery) {
+	apierr.Respond(w, slotFullError(r.Context(), d))
+}
+
+// @Summary Delivery slots
+// @Description Окна доставки на дату (UTC) с вместимостью, числом броней и остатком
+// @Tags deliveries
+// @Produce json
+// @Param date query string true "Дата (YYYY-MM-DD)"
+// @Param zone_id query int false "Зона доставки"
+// @Success 200 {array} Slot
+// @Failure 400 {object} map[string]string
+// @Router /deliveries/slots [get]
+func getDeliverySlots(w http.ResponseWriter, r *http.Request) {
+	date, err := time.Parse("2006-01-02", r.URL.Query().Get("date"))
+	if err != nil {
+		apierr.Write(w, apierr.InvalidRequest, "date is required (YYYY-MM-DD)")
+		return
+	}
+	var zoneID *int
+	if v := r.URL.Query().Get("zone_id"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			apierr.Write(w, apierr.InvalidRequest, "zone_id must be an integer")
+			return
+		}
+		zoneID = &n
+	}
+
+	slots, err := daySlots(r.Context(), db, date, zoneID)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(slots)
+}
+
+func sameInt(a, b *int) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"pkg/clients"
+)
+
+var smsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "delivery_sms_total",
+	Help: "Delivery SMS by event and result: sent, retry, failed, skipped, suppressed_by_preference.",
+}, []string{"event", "result"})
+
+// SMS «курьер едет к вам»: при переходе доставки в in_transit и при
+// событии отслеживания out_for_delivery. SMS ставится в таблицу
+// sms_notifications в той же транзакции, что и изменение, — не больше
+// одной на доставку и событие (UNIQUE (delivery_id, event)). Фоновый
+// отправитель находит телефон покупателя (orders-service → user_id,
+// users-service → phone) и отправляет через провайдера SMS_PROVIDER:
+// http (POST в SMS_HTTP_URL) или log (только запись в лог). Вызов
+// провайдера ограничен SMS_TIMEOUT; неудача — повтор с удвоением паузы,
+// после SMS_MAX_ATTEMPTS — status = 'failed'. Покупателю, отключившему
+// sms_delivery_updates в настройках уведомлений, SMS не отправляется
+// (status = 'suppressed_by_preference'); настройки кэшируются на
+// NOTIFICATION_PREFERENCES_TTL. Без ORDERS_SERVICE_URL и
+// USERS_SERVICE_URL SMS выключены.
+
+// События, о которых отправляется SMS.
+const (
+	smsInTransit      = "in_transit"
+	smsOutForDelivery = "out_for_delivery"
+	smsReadyForPickup = "ready_for_pickup"
+)
+
+// smsSuppressed — SMS не отправлено из-за настроек уведомлений.
+const smsSuppressed = "suppressed_by_preference"
+
+var smsTexts = map[string]string{
+	smsInTransit:      "Заказ №%d передан курьеру и скоро будет у вас.",
+	smsOutForDelivery: "Курьер уже едет к вам с заказом №%d.",
+	smsReadyForPickup: "Заказ №%d ждёт вас в пункте выдачи. Код получения — в карточке доставки.",
+}
+
+// smsProvider отправляет SMS на номер в формате E.164.
+type smsProvider interface {
+	Send(ctx context.Context, to, text string) error
+}
+
+// logSMS — провайдер для разработки: SMS только пишется в лог.
+type logSMS struct{}
+
+func (logSMS) Send(_ context.Context, to, text string) error {
+	log.Printf("📱 SMS to %s: %s", to, text)
+	return nil
+}
+
+// httpSMS отправляет POST {"to": ..., "text": ...} в url шлюза SMS с
+// Authorization: Bearer <SMS_API_KEY>; успех — ответ 2xx.
+type httpSMS struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+func (p *httpSMS) Send(ctx context.Context, to, text string) error {
+	body, err := json.Marshal(map[string]string{"to": to, "text": text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("sms provider rejected with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type smsSender struct {
+	provider    smsProvider
+	orders      *clients.Orders
+	users       *clients.Users
+	prefs       *clients.PreferenceCache
+	timeout     time.Duration
+	interval    time.Duration
+	maxAttempts int
+	batchSize   int
+}
+
+var deliverySMS *smsSender
+
+func startSMSSender(ctx context.Context, orders *clients.Orders, users *clients.Users) {
+	if cfg.OrdersServiceURL == "" || cfg.UsersServiceURL == "" {
+		log.Printf("ℹ️ ORDERS_SERVICE_URL or USERS_SERVICE_URL not set, delivery SMS disabled")
+		return
+	}
+	var provider smsProvider = logSMS{}
+	if cfg.SMSProvider == "http" {
+		provider = &httpSMS{url: cfg.SMSHTTPURL, apiKey: cfg.SMSAPIKey, client: &http.Client{Timeout: cfg.SMSTimeout}}
+	}
+	deliverySMS = &smsSender{
+		provider:    provider,
+		orders:      orders,
+		users:       users,
+		prefs:       clients.NewPreferenceCache(users, cfg.NotificationPreferencesTTL),
+		timeout:     cfg.SMSTimeout,
+		interval:    cfg.SMSPollInterval,
+		maxAttempts: cfg.SMSMaxAttempts,
+		batchSize:   20,
+	}
+	go deliverySMS.run(ctx)
+	log.Printf("📱 Delivery SMS started (provider %s)", cfg.SMSProvider)
+}
+
+// enqueueSMS ставит SMS о событии event доставки deliveryID; повтор того
+// же события для доставки игнорируется. Вызывается в транзакции, которая
+// записывает событие.
+func enqueueSMS(ctx context.Context, tx *sql.Tx, deliveryID int, event string) error {
+	if deliverySMS == nil || smsTexts[event] == "" {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO sms_notifications (delivery_id, order_id, event)
+		 SELECT id, order_id, $2 FROM deliveries WHERE id = $1
+		 ON CONFLICT (delivery_id, event) DO NOTHING`, deliveryID, event)
+	return err
+}
+
+type smsNotification struct {
+	ID       int64
+	OrderID  int
+	Event    string
+	Attempts int
+}
+
+func (s *smsSender) run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.sendBatch(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("⚠️ Delivery SMS error: %v", err)
+			}
+		}
+	}
+}
+
+// sendBatch блокирует пачку SMS через SKIP LOCKED, поэтому реплики не
+// отправляют одно SMS дважды.
+func (s *smsSender) sendBatch(ctx context.Context) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, order_id, event, attempts FROM sms_notifications
+		 WHERE status = 'pending' AND next_attempt_at <= NOW() ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED`, s.batchSize)
+	if err != nil {
+		return err
+	}
+	var batch []smsNotification
+	for rows.Next() {
+		var n smsNotification
+		if err := rows.Scan(&n.ID, &n.OrderID, &n.Event, &n.Attempts); err != nil {
+			rows.Close()
+			return err
+		}
+		batch = append(batch, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, n := range batch {
+		phone, skip, suppressed, err := s.phone(ctx, n.OrderID)
+		if err == nil && skip == "" && !suppressed {
+			err = s.send(ctx, phone, fmt.Sprintf(smsTexts[n.Event], n.OrderID))
+		}
+		switch {
+		case err != nil && n.Attempts+1 >= s.maxAttempts:
+			log.Printf("⚠️ SMS %s for order %d failed after %d attempts: %v", n.Event, n.OrderID, n.Attempts+1, err)
+			_, err = tx.ExecContext(ctx,
+				"UPDATE sms_notifications SET status = 'failed', attempts = attempts + 1, last_error = $1, phone = NULLIF($2, '') WHERE id = $3",
+				err.Error(), phone, n.ID)
+			smsSent.WithLabelValues(n.Event, "failed").Inc()
+		case err != nil:
+			backoff := math.Min(s.interval.Seconds()*math.Pow(2, float64(n.Attempts)), time.Hour.Seconds())
+			_, err = tx.ExecContext(ctx,
+				"UPDATE sms_notifications SET attempts = attempts + 1, last_error = $1, next_attempt_at = NOW() + $2 * INTERVAL '1 second' WHERE id = $3",
+				err.Error(), backoff, n.ID)
+			smsSent.WithLabelValues(n.Event, "retry").Inc()
+		case suppressed:
+			_, err = tx.ExecContext(ctx,
+				"UPDATE sms_notifications SET status = $1, phone = NULLIF($2, '') WHERE id = $3", smsSuppressed, phone, n.ID)
+			smsSent.WithLabelValues(n.Event, smsSuppressed).Inc()
+		case skip != "":
+			_, err = tx.ExecContext(ctx,
+				"UPDATE sms_notifications SET status = 'skipped', last_error = $1 WHERE id = $2", skip, n.ID)
+			smsSent.WithLabelValues(n.Event, "skipped").Inc()
+		default:
+			_, err = tx.ExecContext(ctx,
+				"UPDATE sms_notifications SET status = 'sent', attempts = attempts + 1, phone = $1, last_error = NULL, sent_at = NOW() WHERE id = $2",
+				phone, n.ID)
+			smsSent.WithLabelValues(n.Event, "sent").Inc()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// phone находит телефон покупателя заказа. skip — причина не отправлять
+// SMS вовсе (заказ или пользователь удалён, телефона нет), suppressed —
+// покупатель отключил SMS в настройках уведомлений; ошибка — повод
+// повторить позже.
+func (s *smsSender) phone(ctx context.Context, orderID int) (phone, skip string, suppressed bool, err error) {
+	order, err := s.orders.Get(ctx, orderID)
+	if clients.IsNotFound(err) {
+		return "", "order not found", false, nil
+	}
+	if err != nil {
+		return "", "", false, err
+	}
+	user, err := s.users.Get(ctx, order.UserID)
+	if clients.IsNotFound(err) {
+		return "", "user not found", false, nil
+	}
+	if err != nil {
+		return "", "", false, err
+	}
+	if user.Phone == nil || *user.Phone == "" {
+		return "", "user has no phone", false, nil
+	}
+	prefs, err := s.prefs.Get(ctx, order.UserID)
+	if err != nil {
+		return "", "", false, err
+	}
+	return *user.Phone, "", !prefs.SMSDeliveryUpdates, nil
+}
+
+// send вызывает провайдера не дольше SMS_TIMEOUT.
+func (s *smsSender) send(ctx context.Context, to, text string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.provider.Send(ctx, to, text)
+}
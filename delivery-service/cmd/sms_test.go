@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"pkg/clients"
+	"pkg/httpclient"
+)
+
+// TestHTTPSMSProvider — тело и авторизация запроса к шлюзу, отказ шлюза и
+// таймаут: зависший провайдер не держит отправителя дольше SMS_TIMEOUT.
+func TestHTTPSMSProvider(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		case "/reject":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			if r.Header.Get("Authorization") != "Bearer key" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewDecoder(r.Body).Decode(&got)
+		}
+	}))
+	defer srv.Close()
+
+	s := &smsSender{timeout: 50 * time.Millisecond}
+	p := &httpSMS{url: srv.URL + "/send", apiKey: "key", client: srv.Client()}
+	s.provider = p
+	if err := s.send(context.Background(), "+79991234567", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if got["to"] != "+79991234567" || got["text"] != "hi" {
+		t.Errorf("provider got %v", got)
+	}
+
+	p.url = srv.URL + "/reject"
+	if err := s.send(context.Background(), "+79991234567", "hi"); err == nil {
+		t.Error("expected an error for a 502 from the provider")
+	}
+
+	p.url = srv.URL + "/slow"
+	start := time.Now()
+	if err := s.send(context.Background(), "+79991234567", "hi"); err == nil {
+		t.Error("expected a timeout")
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("send took %s, want it cut at the timeout", d)
+	}
+}
+
+// TestSMSPhoneHonorsPreferences — покупатель, отключивший
+// sms_delivery_updates, получает suppressed, а не SMS.
+func TestSMSPhoneHonorsPreferences(t *testing.T) {
+	smsOn := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/orders/7":
+			json.NewEncoder(w).Encode(clients.Order{ID: 7, UserID: 3})
+		case "/users/3":
+			phone := "+79991234567"
+			json.NewEncoder(w).Encode(clients.User{ID: 3, Phone: &phone})
+		case "/users/3/notification-preferences":
+			json.NewEncoder(w).Encode(map[string]bool{"sms_delivery_updates": smsOn})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	hc := httpclient.New(httpclient.Config{Timeout: time.Second})
+	users := clients.NewUsers(hc, srv.URL)
+	s := &smsSender{orders: clients.NewOrders(hc, srv.URL), users: users, prefs: clients.NewPreferenceCache(users, 0)}
+
+	if phone, skip, suppressed, err := s.phone(context.Background(), 7); err != nil || skip != "" || suppressed || phone != "+79991234567" {
+		t.Errorf("enabled: %q %q %t %v", phone, skip, suppressed, err)
+	}
+	smsOn = false
+	if _, skip, suppressed, err := s.phone(context.Background(), 7); err != nil || skip != "" || !suppressed {
+		t.Errorf("disabled: %q %t %v", skip, suppressed, err)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pkg/apierr"
+	"pkg/clients"
+	"pkg/events"
+)
+
+// DeliveryStats — общий контракт с клиентами (pkg/clients).
+type DeliveryStats = clients.DeliveryStats
+
+// deliveryStatuses — статусы, которые всегда присутствуют в ответе
+// /deliveries/counts, даже с нулём.
+var deliveryStatuses = []string{"pending", "in_transit", "ready_for_pickup", "delivered", "failed"}
+
+// DeliveryCounts — число доставок по статусам.
+type DeliveryCounts struct {
+	Counts map[string]int `json:"counts"`
+	Total  int            `json:"total"`
+}
+
+// topFailureReasons — сколько причин неудачи перечислять в статистике.
+const topFailureReasons = 5
+
+// @Summary Delivery statistics
+// @Description За дни from–to (UTC) включительно: доставлено (по delivered_at), не удалось (по событию delivery.failed) и самые частые причины неудачи — описания событий delivery.failed. Демо-доставки (simulated) не учитываются.
+// @Tags deliveries
+// @Produce json
+// @Param from query string true "Первый день (YYYY-MM-DD)"
+// @Param to query string true "Последний день (YYYY-MM-DD)"
+// @Success 200 {object} DeliveryStats
+// @Failure 400 {object} map[string]string
+// @Router /deliveries/stats [get]
+func getDeliveryStats(w http.ResponseWriter, r *http.Request) {
+	from, err1 := time.Parse("2006-01-02", r.URL.Query().Get("from"))
+	to, err2 := time.Parse("2006-01-02", r.URL.Query().Get("to"))
+	if err1 != nil || err2 != nil || to.Before(from) {
+		apierr.Write(w, apierr.InvalidRequest, "from and to are required (YYYY-MM-DD), to not before from")
+		return
+	}
+	to = to.AddDate(0, 0, 1)
+
+	stats := DeliveryStats{FailureReasons: []clients.ReasonCount{}}
+	err := db.QueryRowContext(r.Context(),
+		`SELECT
+		   (SELECT COUNT(*) FROM deliveries WHERE delivered_at >= $1 AND delivered_at < $2 AND NOT simulated),
+		   (SELECT COUNT(DISTINCT e.delivery_id) FROM delivery_tracking_events e JOIN deliveries d ON d.id = e.delivery_id
+		     WHERE e.event_type = $3 AND e.created_at >= $1 AND e.created_at < $2 AND NOT d.simulated)`,
+		from, to, events.DeliveryFailed).Scan(&stats.Delivered, &stats.Failed)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT COALESCE(NULLIF(e.description, ''), 'unspecified'), COUNT(*) FROM delivery_tracking_events e
+		 JOIN deliveries d ON d.id = e.delivery_id
+		 WHERE e.event_type = $3 AND e.created_at >= $1 AND e.created_at < $2 AND NOT d.simulated
+		 GROUP BY 1 ORDER BY 2 DESC, 1 LIMIT `+strconv.Itoa(topFailureReasons),
+		from, to, events.DeliveryFailed)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rc clients.ReasonCount
+		if err := rows.Scan(&rc.Reason, &rc.Count); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		stats.FailureReasons = append(stats.FailureReasons, rc)
+	}
+	if err := rows.Err(); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// @Summary Delivery counts by status
+// @Description Количество доставок по статусам сейчас одним запросом; фильтры courier_id и zone_id.
+// @Tags deliveries
+// @Produce json
+// @Param courier_id query int false "Courier ID"
+// @Param zone_id query int false "Zone ID"
+// @Success 200 {object} DeliveryCounts
+// @Failure 400 {object} map[string]string
+// @Router /deliveries/counts [get]
+func getDeliveryCounts(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	where := "1=1"
+	var args []interface{}
+	for _, f := range []string{"courier_id", "zone_id"} {
+		v := q.Get(f)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			apierr.Write(w, apierr.InvalidRequest, f+" must be an integer")
+			return
+		}
+		args = append(args, n)
+		where += " AND " + f + " = $" + strconv.Itoa(len(args))
+	}
+
+	rows, err := db.QueryContext(r.Context(), "SELECT COALESCE(status, 'pending'), COUNT(*) FROM deliveries WHERE "+where+" GROUP BY 1", args...)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	res := DeliveryCounts{Counts: make(map[string]int, len(deliveryStatuses))}
+	for _, s := range deliveryStatuses {
+		res.Counts[s] = 0
+	}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		res.Counts[status] = n
+		res.Total += n
+	}
+	if err := rows.Err(); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,495 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"pkg/apierr"
+	"pkg/deadletter"
+	"pkg/events"
+	"pkg/hmacsign"
+	"pkg/httpclient"
+	"pkg/pg"
+	"pkg/pgnotify"
+)
+
+var webhooksDispatched = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "delivery_webhooks_dispatched_total",
+	Help: "Webhook dispatch attempts by result: delivered, failed, parked.",
+}, []string{"result"})
+
+// webhookEvents — события, на которые можно подписаться.
+var webhookEvents = map[string]bool{
+	events.DeliveryAssigned:  true,
+	events.DeliveryDelivered: true,
+	events.DeliveryFailed:    true,
+}
+
+// webhookClient отправляет вебхуки и переотправляет их из dead_letters.
+var webhookClient *httpclient.Client
+
+// WebhookSubscription — подписка внешней системы на события доставок.
+// Secret показывается только при создании.
+type WebhookSubscription struct {
+	ID        int      `json:"id"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	Secret    string   `json:"secret,omitempty"`
+	Active    bool     `json:"active"`
+	CreatedAt string   `json:"createdAt"`
+	UpdatedAt string   `json:"updatedAt"`
+}
+
+// WebhookPayload — payload события delivery.*: доставка после изменения и
+// событие отслеживания, которым изменение записано.
+type WebhookPayload struct {
+	Delivery      Delivery      `json:"delivery"`
+	TrackingEvent TrackingEvent `json:"tracking_event"`
+}
+
+const webhookColumns = "id, url, events, active, created_at, updated_at"
+
+func scanWebhook(row interface{ Scan(...interface{}) error }, s *WebhookSubscription) error {
+	return row.Scan(&s.ID, &s.URL, pg.Array(&s.Events), &s.Active, &s.CreatedAt, &s.UpdatedAt)
+}
+
+// blockedWebhookIP — адреса, на которые вебхук не отправляется: loopback,
+// link-local (в том числе метаданные облака 169.254.169.254), multicast и
+// неуказанный адрес.
+func blockedWebhookIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified()
+}
+
+// validateWebhookURL принимает только http(s) URL, все адреса которого
+// не попадают в blockedWebhookIP.
+func validateWebhookURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if u.User != nil {
+		return fmt.Errorf("url must not contain credentials")
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("cannot resolve %s", u.Hostname())
+	}
+	for _, ip := range ips {
+		if blockedWebhookIP(ip) {
+			return fmt.Errorf("url resolves to a forbidden address %s", ip)
+		}
+	}
+	return nil
+}
+
+// webhookDialControl повторяет проверку адреса при подключении: DNS
+// может смениться после создания подписки.
+func webhookDialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || blockedWebhookIP(ip) {
+		return fmt.Errorf("webhook target %s is a forbidden address", host)
+	}
+	return nil
+}
+
+func newWebhookClient() *httpclient.Client {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = nil
+	tr.DialContext = (&net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second, Control: webhookDialControl}).DialContext
+	clientConfig := httpclient.ConfigFromEnv()
+	clientConfig.Transport = tr
+	return httpclient.New(clientConfig)
+}
+
+func decodeWebhook(w http.ResponseWriter, r *http.Request) (WebhookSubscription, bool) {
+	s := WebhookSubscription{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return s, false
+	}
+	if err := validateWebhookURL(r.Context(), s.URL); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return s, false
+	}
+	if len(s.Events) == 0 {
+		apierr.Write(w, apierr.InvalidRequest, "events must not be empty")
+		return s, false
+	}
+	for _, e := range s.Events {
+		if !webhookEvents[e] {
+			apierr.Write(w, apierr.InvalidRequest, fmt.Sprintf("unknown event %q, expected delivery.assigned, delivery.delivered or delivery.failed", e))
+			return s, false
+		}
+	}
+	return s, true
+}
+
+// @Summary List webhook subscriptions
+// @Description Подписки на события доставок. Требует X-Internal-API-Key.
+// @Tags webhooks
+// @Produce json
+// @Success 200 {array} WebhookSubscription
+// @Failure 401 {object} map[string]string
+// @Router /webhooks [get]
+func getWebhooks(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.QueryContext(r.Context(), "SELECT "+webhookColumns+" FROM webhook_subscriptions ORDER BY id")
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	subs := []WebhookSubscription{}
+	for rows.Next() {
+		var s WebhookSubscription
+		if err := scanWebhook(rows, &s); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		subs = append(subs, s)
+	}
+	if err := rows.Err(); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subs)
+}
+
+// @Summary Create webhook subscription
+// @Description Подписать URL на события delivery.assigned, delivery.delivered, delivery.failed. Разрешены только http(s) URL, не ведущие на loopback и link-local адреса. Если secret не задан, он генерируется; в ответе secret показывается один раз. Запросы подписываются заголовком X-Signature (HMAC-SHA256, как межсервисные). Требует X-Internal-API-Key.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param subscription body WebhookSubscription true "Subscription"
+// @Success 201 {object} WebhookSubscription
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /webhooks [post]
+func createWebhook(w http.ResponseWriter, r *http.Request) {
+	s, ok := decodeWebhook(w, r)
+	if !ok {
+		return
+	}
+	secret := s.Secret
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		secret = hex.EncodeToString(b)
+	}
+
+	err := scanWebhook(db.QueryRowContext(r.Context(),
+		"INSERT INTO webhook_subscriptions (url, events, secret, active) VALUES ($1, $2, $3, $4) RETURNING "+webhookColumns,
+		s.URL, s.Events, secret, s.Active), &s)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	s.Secret = secret
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(s)
+}
+
+// @Summary Update webhook subscription
+// @Description Изменить URL, события или активность подписки. Пустой secret оставляет прежний. Требует X-Internal-API-Key.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path int true "Subscription ID"
+// @Param subscription body WebhookSubscription true "Subscription"
+// @Success 200 {object} WebhookSubscription
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /webhooks/{id} [put]
+func updateWebhook(w http.ResponseWriter, r *http.Request) {
+	s, ok := decodeWebhook(w, r)
+	if !ok {
+		return
+	}
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	err := scanWebhook(db.QueryRowContext(r.Context(),
+		"UPDATE webhook_subscriptions SET url = $2, events = $3, secret = COALESCE(NULLIF($4, ''), secret), active = $5 WHERE id = $1 RETURNING "+webhookColumns,
+		id, s.URL, s.Events, s.Secret, s.Active), &s)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.WebhookSubscriptionNotFound, "Webhook subscription not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	s.Secret = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// @Summary Delete webhook subscription
+// @Description Удалить подписку вместе с неотправленными событиями. Требует X-Internal-API-Key.
+// @Tags webhooks
+// @Param id path int true "Subscription ID"
+// @Success 204
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /webhooks/{id} [delete]
+func deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	result, err := db.ExecContext(r.Context(), "DELETE FROM webhook_subscriptions WHERE id = $1", id)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		apierr.Write(w, apierr.WebhookSubscriptionNotFound, "Webhook subscription not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deliveryTransitions — события delivery.*, которые порождает переход
+// доставки из prev в d. prev == nil — доставка только что создана.
+func deliveryTransitions(prev, d *Delivery) []TrackingEvent {
+	var out []TrackingEvent
+	if d.CourierID != nil && (prev == nil || !sameInt(prev.CourierID, d.CourierID)) {
+		out = append(out, TrackingEvent{EventType: events.DeliveryAssigned, Description: fmt.Sprintf("Courier %d assigned", *d.CourierID)})
+	}
+	if d.Status == "delivered" && (prev == nil || prev.Status != "delivered") {
+		out = append(out, TrackingEvent{EventType: events.DeliveryDelivered, Description: "Delivered"})
+	}
+	if d.Status == "failed" && (prev == nil || prev.Status != "failed") {
+		out = append(out, TrackingEvent{EventType: events.DeliveryFailed, Description: "Delivery failed"})
+	}
+	return out
+}
+
+// recordDeliveryTransitions записывает переходы доставки как события
+// отслеживания, ставит вебхуки подписчикам в очередь webhook_events, а при
+// переходе в in_transit и ready_for_pickup — SMS покупателю.
+// Вызывается в транзакции, которая меняет доставку, поэтому вебхук уйдёт
+// только после её коммита.
+func recordDeliveryTransitions(ctx context.Context, tx *sql.Tx, prev, d *Delivery) error {
+	for _, e := range deliveryTransitions(prev, d) {
+		e.DeliveryID = d.ID
+		err := tx.QueryRowContext(ctx,
+			"INSERT INTO delivery_tracking_events (delivery_id, event_type, description) VALUES ($1, $2, $3) RETURNING id, created_at",
+			d.ID, e.EventType, e.Description).Scan(&e.ID, &e.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if err := pgnotify.Notify(tx, deliveryEventsChannel, strconv.Itoa(d.ID), "tracking", e); err != nil {
+			return err
+		}
+
+		payload, err := json.Marshal(WebhookPayload{Delivery: *d, TrackingEvent: e})
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO webhook_events (subscription_id, event_type, payload)
+			 SELECT id, $1, $2 FROM webhook_subscriptions WHERE active AND $1 = ANY(events)`,
+			e.EventType, payload)
+		if err != nil {
+			return err
+		}
+	}
+	if d.Status == "in_transit" && (prev == nil || prev.Status != "in_transit") {
+		return enqueueSMS(ctx, tx, d.ID, smsInTransit)
+	}
+	if d.Status == "ready_for_pickup" && (prev == nil || prev.Status != "ready_for_pickup") {
+		return enqueueSMS(ctx, tx, d.ID, smsReadyForPickup)
+	}
+	return nil
+}
+
+type webhookEvent struct {
+	ID        int64
+	EventID   string
+	EventType string
+	Payload   []byte
+	Attempts  int
+	CreatedAt time.Time
+	URL       string
+	Secret    string
+}
+
+// webhookDispatcher отправляет события webhook_events подписчикам.
+// Неудачная отправка повторяется с экспоненциальной паузой; после
+// WEBHOOK_MAX_ATTEMPTS неудач событие паркуется и копируется в
+// dead_letters для POST /dead-letters/{id}/replay.
+type webhookDispatcher struct {
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+}
+
+func startWebhookDispatcher(ctx context.Context) {
+	d := &webhookDispatcher{interval: cfg.WebhookPollInterval, batchSize: 50, maxAttempts: cfg.WebhookMaxAttempts}
+	go d.run(ctx)
+}
+
+func (d *webhookDispatcher) run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.dispatchBatch(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("⚠️ Webhook dispatch error: %v", err)
+			}
+		}
+	}
+}
+
+// dispatchBatch блокирует пачку событий через SKIP LOCKED, поэтому реплики
+// не отправляют одно и то же событие одновременно.
+func (d *webhookDispatcher) dispatchBatch(ctx context.Context) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT e.id, e.event_id, e.event_type, e.payload, e.attempts, e.created_at, s.url, s.secret
+		 FROM webhook_events e JOIN webhook_subscriptions s ON s.id = e.subscription_id
+		 WHERE e.status = 'pending' AND e.next_attempt_at <= NOW()
+		 ORDER BY e.id LIMIT $1 FOR UPDATE OF e SKIP LOCKED`, d.batchSize)
+	if err != nil {
+		return err
+	}
+	var batch []webhookEvent
+	for rows.Next() {
+		var ev webhookEvent
+		if err := rows.Scan(&ev.ID, &ev.EventID, &ev.EventType, &ev.Payload, &ev.Attempts, &ev.CreatedAt, &ev.URL, &ev.Secret); err != nil {
+			rows.Close()
+			return err
+		}
+		batch = append(batch, ev)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, ev := range batch {
+		body, headers, err := d.request(ev)
+		if err == nil {
+			err = d.push(ctx, ev.URL, body, headers)
+		}
+		if err == nil {
+			if _, err := tx.ExecContext(ctx,
+				"UPDATE webhook_events SET attempts = attempts + 1, status = 'dispatched', dispatched_at = NOW() WHERE id = $1",
+				ev.ID); err != nil {
+				return err
+			}
+			webhooksDispatched.WithLabelValues("delivered").Inc()
+			continue
+		}
+
+		status, result := "pending", "failed"
+		if ev.Attempts+1 >= d.maxAttempts {
+			status, result = "parked", "parked"
+			log.Printf("🅿️ Webhook %s (%s) to %s parked after %d attempts: %v", ev.EventID, ev.EventType, ev.URL, ev.Attempts+1, err)
+			if err := deadletter.Record(ctx, tx, deadletter.Letter{
+				Source:    "webhook:" + ev.EventType,
+				TargetURL: ev.URL,
+				Headers:   headers,
+				Payload:   string(body),
+				Attempts:  ev.Attempts + 1,
+				LastError: err.Error(),
+			}); err != nil {
+				return err
+			}
+		}
+		backoff := math.Min(d.interval.Seconds()*math.Pow(2, float64(ev.Attempts)), time.Hour.Seconds())
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE webhook_events SET attempts = attempts + 1, last_error = $1, status = $2, next_attempt_at = NOW() + $3 * INTERVAL '1 second' WHERE id = $4",
+			err.Error(), status, backoff, ev.ID); err != nil {
+			return err
+		}
+		webhooksDispatched.WithLabelValues(result).Inc()
+	}
+	return tx.Commit()
+}
+
+// request собирает тело и подписанные заголовки. Те же заголовки
+// сохраняются в dead_letters, чтобы replay был неотличим от исходной
+// отправки.
+func (d *webhookDispatcher) request(ev webhookEvent) ([]byte, map[string]string, error) {
+	body, err := json.Marshal(events.Envelope{
+		EventID:    ev.EventID,
+		EventType:  ev.EventType,
+		OccurredAt: ev.CreatedAt,
+		Payload:    ev.Payload,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	u, err := url.Parse(ev.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+	ts := time.Now().Unix()
+	sig := hmacsign.Compute([]byte(ev.Secret), ts, http.MethodPost, u.EscapedPath(), body)
+	headers := map[string]string{
+		"Content-Type":    "application/json",
+		"Idempotency-Key": ev.EventID,
+		hmacsign.Header:   fmt.Sprintf("t=%d,kid=webhook,v1=%s", ts, sig),
+	}
+	return body, headers, nil
+}
+
+func (d *webhookDispatcher) push(ctx context.Context, target string, body []byte, headers map[string]string) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := webhookClient.Do(u.Host, req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook rejected with status %d", resp.StatusCode)
+	}
+	return nil
+}
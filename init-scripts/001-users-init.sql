@@ -2,14 +2,159 @@
 CREATE TABLE IF NOT EXISTS users (
     id SERIAL PRIMARY KEY,
     email VARCHAR(255) NOT NULL UNIQUE,
+    username VARCHAR(30),
+    username_changed_at TIMESTAMP,
     name VARCHAR(255) NOT NULL,
     age INTEGER NOT NULL CHECK (age >= 0 AND age <= 150),
+    -- Телефон в формате E.164 для SMS о доставке
+    phone VARCHAR(16),
+    password_hash VARCHAR(100),
+    totp_secret VARCHAR(64),
+    totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    totp_last_step BIGINT,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    metadata JSONB NOT NULL DEFAULT '{}'::jsonb,
+    -- Настройки уведомлений: ключи clients.NotificationPreferences, нет ключа — значение по умолчанию
+    notification_preferences JSONB NOT NULL DEFAULT '{}'::jsonb,
+    avatar_keys JSONB,
+    avatar_urls JSONB,
+    -- Последний вход паролем (или паролем и 2FA); NULL — ни одного входа
+    -- с момента появления колонки
+    last_login_at TIMESTAMP,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
 CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_lower ON users(LOWER(username));
 CREATE INDEX IF NOT EXISTS idx_users_created_at ON users(created_at);
+CREATE INDEX IF NOT EXISTS idx_users_last_login_at ON users(last_login_at) WHERE is_active;
+-- Фильтр ?metadata.<key>= в GET /users — проверка вхождения metadata @> ...
+CREATE INDEX IF NOT EXISTS idx_users_metadata ON users USING GIN (metadata jsonb_path_ops);
+
+-- Сессии входа: хранится только sha256 refresh-токена
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    refresh_hash CHAR(64) NOT NULL UNIQUE,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id ON user_sessions(user_id) WHERE revoked_at IS NULL;
+
+-- Запуски POST /users/bulk-deactivate. last_user_id — курсор: прерванный
+-- запуск (status = 'running') продолжается с него.
+CREATE TABLE IF NOT EXISTS deactivation_runs (
+    id SERIAL PRIMARY KEY,
+    last_login_before TIMESTAMP NOT NULL,
+    created_before TIMESTAMP NOT NULL,
+    dry_run BOOLEAN NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'running',
+    actor VARCHAR(255) NOT NULL,
+    matched INTEGER NOT NULL DEFAULT 0,
+    deactivated INTEGER NOT NULL DEFAULT 0,
+    last_user_id INTEGER NOT NULL DEFAULT 0,
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+-- Пользователи, деактивированные запуском (при dry_run — кандидаты)
+CREATE TABLE IF NOT EXISTS deactivation_run_users (
+    run_id INTEGER NOT NULL REFERENCES deactivation_runs(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL,
+    PRIMARY KEY (run_id, user_id)
+);
+
+-- Правила доменов email для регистрации и смены адреса (GET/PUT/DELETE
+-- /admin/email-domains); дополняют EMAIL_DOMAIN_BLOCKLIST/ALLOWLIST.
+CREATE TABLE IF NOT EXISTS email_domain_rules (
+    list VARCHAR(10) NOT NULL CHECK (list IN ('allow', 'block')),
+    domain VARCHAR(253) NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (list, domain)
+);
+
+-- Коды восстановления 2FA (sha256), одноразовые
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_recovery_codes_user_id ON user_recovery_codes(user_id, code_hash);
+
+-- Смена email: новый адрес подтверждается token, старому уходит ссылка отмены (undo)
+CREATE TABLE IF NOT EXISTS email_changes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    old_email VARCHAR(255) NOT NULL,
+    new_email VARCHAR(255) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    confirmed_at TIMESTAMP,
+    undo_hash CHAR(64) UNIQUE,
+    undo_expires_at TIMESTAMP,
+    undone_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_changes_user_id ON email_changes(user_id) WHERE confirmed_at IS NULL;
+
+-- Прежние username после переименования: закреплены за владельцем до reserved_until
+CREATE TABLE IF NOT EXISTS reserved_usernames (
+    username_lower VARCHAR(30) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reserved_until TIMESTAMP NOT NULL
+);
+
+-- Журнал активности аккаунта: только добавление, удаляет лишь очистка по сроку
+CREATE TABLE IF NOT EXISTS user_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event_type VARCHAR(100) NOT NULL,
+    source VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}'::jsonb,
+    occurred_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_events_user_id ON user_events(user_id, id);
+CREATE INDEX IF NOT EXISTS idx_user_events_created_at ON user_events(created_at);
+
+-- Обработанные события других сервисов (pkg/dedup)
+CREATE TABLE IF NOT EXISTS processed_events (
+    source VARCHAR(100) NOT NULL,
+    event_id VARCHAR(255) NOT NULL,
+    processed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (source, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_processed_events_processed_at ON processed_events(processed_at);
+
+-- Журнал аудита административных и удаляющих действий (pkg/audit)
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor VARCHAR(255) NOT NULL,
+    action VARCHAR(255) NOT NULL,
+    resource_type VARCHAR(100) NOT NULL,
+    resource_id VARCHAR(100) NOT NULL DEFAULT '',
+    body_sha256 CHAR(64) NOT NULL,
+    request_id VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor, id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_resource ON audit_log(resource_type, resource_id, id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
 
 -- Функция автоматического обновления updated_at
 CREATE OR REPLACE FUNCTION update_updated_at_column()
@@ -24,6 +169,17 @@ DROP TRIGGER IF EXISTS update_users_updated_at ON users;
 CREATE TRIGGER update_users_updated_at BEFORE UPDATE ON users
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
+CREATE OR REPLACE FUNCTION reject_update()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION '% is insert-only', TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS user_events_insert_only ON user_events;
+CREATE TRIGGER user_events_insert_only BEFORE UPDATE ON user_events
+    FOR EACH ROW EXECUTE FUNCTION reject_update();
+
 -- Demo данные
 INSERT INTO users (email, name, age) VALUES
     ('alice@example.com', 'Alice Johnson', 28),
@@ -4,14 +4,218 @@ CREATE TABLE IF NOT EXISTS orders (
     user_id INTEGER NOT NULL,
     items JSONB DEFAULT '[]'::jsonb,
     total_amount DECIMAL(10, 2) NOT NULL CHECK (total_amount >= 0),
+    currency CHAR(3) NOT NULL DEFAULT 'RUB',
     status VARCHAR(50) DEFAULT 'created',
+    shipping_address VARCHAR(500) NOT NULL DEFAULT '',
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    -- Товары 18+: при создании проверяется возраст покупателя, при вручении —
+    -- возраст получателя (MIN_CUSTOMER_AGE)
+    age_restricted BOOLEAN NOT NULL DEFAULT false,
+    -- Отложенный заказ: до этого времени в статусе scheduled, затем pending
+    scheduled_for TIMESTAMP,
+    -- Подарок: в событиях для delivery-service нет суммы, gift_message
+    -- печатается на этикетке
+    is_gift BOOLEAN NOT NULL DEFAULT false,
+    gift_message VARCHAR(200),
+    -- Сирота: проверка согласованности не нашла пользователя (CONSISTENCY_REMEDIATE)
+    orphaned_at TIMESTAMP,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
-CREATE INDEX IF NOT EXISTS idx_orders_user_id ON orders(user_id);
+CREATE INDEX IF NOT EXISTS idx_orders_user_id_status ON orders(user_id, status);
 CREATE INDEX IF NOT EXISTS idx_orders_status ON orders(status);
 CREATE INDEX IF NOT EXISTS idx_orders_created_at ON orders(created_at);
+-- Фильтр GET /orders?tag= (tags @> ...)
+CREATE INDEX IF NOT EXISTS idx_orders_tags ON orders USING GIN (tags);
+
+-- Перевод отложенных заказов в pending и фильтр GET /orders?scheduled_before=
+CREATE INDEX IF NOT EXISTS idx_orders_scheduled ON orders(scheduled_for) WHERE status = 'scheduled';
+
+-- Очистка отменённых заказов (ORDER_RETENTION)
+CREATE INDEX IF NOT EXISTS idx_orders_cancelled_updated_at ON orders(updated_at) WHERE status = 'cancelled';
+
+-- Transactional outbox: события пишутся в одной транзакции с изменением заказа
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id BIGSERIAL PRIMARY KEY,
+    event_id UUID NOT NULL UNIQUE DEFAULT gen_random_uuid(),
+    -- Адресат: delivery (OUTBOX_PUSH_URL) или users (USER_EVENTS_PUSH_URL)
+    destination VARCHAR(20) NOT NULL DEFAULT 'delivery',
+    event_type VARCHAR(100) NOT NULL,
+    aggregate_id INTEGER NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    -- Аренда диспетчера: до этого момента событие отправляет забравшая его
+    -- реплика; после — его может забрать другая
+    locked_until TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    dispatched_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_pending ON outbox_events(destination, id) WHERE status = 'pending';
+-- Диспетчер не берёт событие, пока ждёт отправки более раннее событие того же заказа
+CREATE INDEX IF NOT EXISTS idx_outbox_events_pending_aggregate ON outbox_events(destination, aggregate_id, id) WHERE status = 'pending';
+
+-- Письма о смене статуса заказа: очередь отправки и журнал
+CREATE TABLE IF NOT EXISTS notifications (
+    id BIGSERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    -- Статус заказа, о котором письмо: confirmed, shipped, delivered
+    event VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    recipient VARCHAR(255),
+    subject TEXT,
+    -- pending, sent, failed, skipped (пользователь удалён),
+    -- suppressed_by_preference (письмо отключено в настройках уведомлений)
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_pending ON notifications(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_notifications_order ON notifications(order_id);
+
+-- Ежедневные сводки (GET /reports/daily?date=)
+CREATE TABLE IF NOT EXISTS daily_digests (
+    date DATE PRIMARY KEY,
+    digest JSONB NOT NULL,
+    sent_at TIMESTAMP,
+    send_error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Исходящие запросы, исчерпавшие повторы; переотправляются через POST /dead-letters/{id}/replay
+CREATE TABLE IF NOT EXISTS dead_letters (
+    id BIGSERIAL PRIMARY KEY,
+    source VARCHAR(100) NOT NULL,
+    method VARCHAR(10) NOT NULL DEFAULT 'POST',
+    target_url TEXT NOT NULL,
+    headers JSONB NOT NULL DEFAULT '{}'::jsonb,
+    payload TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'open',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_dead_letters_status ON dead_letters(status, id);
+
+-- Саги оформления заказа (POST /orders/checkout)
+CREATE TABLE IF NOT EXISTS checkout_sagas (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    idempotency_key VARCHAR(255) NOT NULL UNIQUE,
+    order_id INTEGER NOT NULL REFERENCES orders(id),
+    payment_method VARCHAR(50) NOT NULL,
+    state VARCHAR(30) NOT NULL,
+    failed_step VARCHAR(50),
+    error TEXT,
+    payment_id INTEGER,
+    delivery_id INTEGER,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_checkout_sagas_unfinished ON checkout_sagas(updated_at)
+    WHERE state NOT IN ('completed', 'compensated');
+
+-- Журнал аудита административных и удаляющих действий (pkg/audit)
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor VARCHAR(255) NOT NULL,
+    action VARCHAR(255) NOT NULL,
+    resource_type VARCHAR(100) NOT NULL,
+    resource_id VARCHAR(100) NOT NULL DEFAULT '',
+    body_sha256 CHAR(64) NOT NULL,
+    request_id VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor, id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_resource ON audit_log(resource_type, resource_id, id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+
+-- История решений по заказу (сейчас — проверки возраста для age_restricted).
+-- Только дополняется: UPDATE и DELETE запрещены триггером ниже. order_id NULL
+-- у отклонённых заказов, которые так и не были созданы.
+CREATE TABLE IF NOT EXISTS order_history (
+    id BIGSERIAL PRIMARY KEY,
+    order_id INTEGER,
+    user_id INTEGER NOT NULL,
+    event VARCHAR(50) NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    actor VARCHAR(255) NOT NULL,
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_history_order ON order_history(order_id, id);
+CREATE INDEX IF NOT EXISTS idx_order_history_user ON order_history(user_id, id);
+
+CREATE OR REPLACE FUNCTION forbid_order_history_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'order_history is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS order_history_append_only ON order_history;
+CREATE TRIGGER order_history_append_only BEFORE UPDATE OR DELETE ON order_history
+    FOR EACH ROW EXECUTE FUNCTION forbid_order_history_change();
+
+-- Архив заказов в конечном статусе (POST /orders/archive). Колонки совпадают
+-- с orders и идут в том же порядке, плюс archived_at в конце.
+CREATE TABLE IF NOT EXISTS orders_archive (
+    LIKE orders,
+    archived_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_archive_user_id ON orders_archive(user_id);
+CREATE INDEX IF NOT EXISTS idx_orders_archive_tags ON orders_archive USING GIN (tags);
+
+-- Заказы, удалённые POST /orders/bulk-delete: строки сохраняются, чтобы
+-- ошибочную чистку можно было откатить вручную.
+CREATE TABLE IF NOT EXISTS orders_deleted (
+    LIKE orders,
+    deleted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id)
+);
+
+-- Импорт заказов из CSV (POST /orders/import): последняя зафиксированная
+-- строка файла; повторная загрузка с тем же id продолжает после неё.
+CREATE TABLE IF NOT EXISTS order_imports (
+    id VARCHAR(100) PRIMARY KEY,
+    actor VARCHAR(255) NOT NULL,
+    last_line INTEGER NOT NULL DEFAULT 0,
+    imported INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP
+);
+
+-- Находки проверки согласованности (pkg/consistency): записи, ссылающиеся
+-- на удалённую запись другого сервиса. resolved_at — полный проход больше
+-- не нашёл ссылку.
+CREATE TABLE IF NOT EXISTS inconsistencies (
+    id BIGSERIAL PRIMARY KEY,
+    type VARCHAR(50) NOT NULL,
+    record_id INTEGER NOT NULL,
+    ref_id INTEGER NOT NULL,
+    detected_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP,
+    UNIQUE (type, record_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_inconsistencies_open ON inconsistencies(type, id) WHERE resolved_at IS NULL;
 
 -- Функция для обновления updated_at
 CREATE OR REPLACE FUNCTION update_updated_at_column()
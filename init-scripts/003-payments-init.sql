@@ -1,10 +1,45 @@
 -- payments_db: таблица платежей
+
+-- Дневные расчёты для сверки с файлами эквайера
+CREATE TABLE IF NOT EXISTS settlements (
+    id SERIAL PRIMARY KEY,
+    settlement_date DATE NOT NULL,
+    currency CHAR(3) NOT NULL,
+    gross DECIMAL(12, 2) NOT NULL DEFAULT 0,
+    refunds DECIMAL(12, 2) NOT NULL DEFAULT 0,
+    net DECIMAL(12, 2) NOT NULL DEFAULT 0,
+    payment_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (settlement_date, currency)
+);
+
 CREATE TABLE IF NOT EXISTS payments (
     id SERIAL PRIMARY KEY,
-    user_id INTEGER NOT NULL,
+    -- Плательщик; API платежей его не принимает, задан только у демо-данных
+    user_id INTEGER,
     order_id INTEGER NOT NULL,
     amount DECIMAL(10, 2) NOT NULL CHECK (amount > 0),
+    -- Списанная часть авторизации; NULL — платёж списывается целиком.
+    captured_amount DECIMAL(10, 2) CHECK (captured_amount >= 0 AND captured_amount <= amount),
+    currency CHAR(3) NOT NULL DEFAULT 'RUB',
     status VARCHAR(50) DEFAULT 'pending',
+    -- Способ оплаты: от него зависят лимиты (PAYMENT_METHOD_LIMITS) и
+    -- method_details
+    payment_method VARCHAR(20) NOT NULL DEFAULT 'card' CHECK (payment_method IN ('card', 'cash', 'paypal')),
+    authorization_expires_at TIMESTAMP,
+    method_details JSONB CHECK (method_details IS NULL OR NOT method_details ? 'number'),
+    idempotency_key VARCHAR(255) UNIQUE,
+    completed_at TIMESTAMP,
+    refunded_at TIMESTAMP,
+    settlement_id INTEGER REFERENCES settlements(id),
+    refund_reason VARCHAR(50),
+    deleted_at TIMESTAMP,
+    -- Платёж песочницы (PAYMENTS_SANDBOX): деньги не двигались, в сверку и
+    -- статистику не попадает
+    test BOOLEAN NOT NULL DEFAULT false,
+    -- Сирота: проверка согласованности не нашла заказ (CONSISTENCY_REMEDIATE)
+    orphaned_at TIMESTAMP,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
@@ -12,6 +47,134 @@ CREATE TABLE IF NOT EXISTS payments (
 CREATE INDEX IF NOT EXISTS idx_payments_user_id ON payments(user_id);
 CREATE INDEX IF NOT EXISTS idx_payments_order_id ON payments(order_id);
 CREATE INDEX IF NOT EXISTS idx_payments_status ON payments(status);
+CREATE INDEX IF NOT EXISTS idx_payments_failed_updated_at ON payments(updated_at) WHERE status = 'failed';
+CREATE INDEX IF NOT EXISTS idx_payments_completed_at ON payments(completed_at) WHERE completed_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_payments_refunded_at ON payments(refunded_at) WHERE refunded_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_payments_settlement_id ON payments(settlement_id, id);
+CREATE INDEX IF NOT EXISTS idx_payments_authorization_expires_at ON payments(authorization_expires_at)
+    WHERE status IN ('pending', 'partially_captured');
+
+-- Курсы валют для пересчёта статистики (GET /payments/stats?convert_to=)
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    from_currency CHAR(3) NOT NULL,
+    to_currency CHAR(3) NOT NULL,
+    rate NUMERIC(18, 8) NOT NULL CHECK (rate > 0),
+    effective_date DATE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (from_currency, to_currency, effective_date)
+);
+
+-- Споры (chargeback) по платежам
+CREATE TABLE IF NOT EXISTS disputes (
+    id SERIAL PRIMARY KEY,
+    payment_id INTEGER NOT NULL REFERENCES payments(id) ON DELETE CASCADE,
+    amount DECIMAL(10, 2) NOT NULL CHECK (amount > 0),
+    reason TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'won', 'lost')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_disputes_payment_id ON disputes(payment_id, id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_disputes_open_payment ON disputes(payment_id) WHERE status = 'open';
+
+-- История смен статуса платежей. Только дополняется: изменение и удаление
+-- строк запрещены триггером ниже. Внешнего ключа нет, чтобы история
+-- переживала удаление платежа.
+CREATE TABLE IF NOT EXISTS payment_status_history (
+    id BIGSERIAL PRIMARY KEY,
+    payment_id INTEGER NOT NULL,
+    old_status VARCHAR(50),
+    new_status VARCHAR(50) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    actor VARCHAR(255) NOT NULL,
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_status_history_payment ON payment_status_history(payment_id, id);
+
+CREATE OR REPLACE FUNCTION forbid_payment_status_history_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'payment_status_history is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS payment_status_history_append_only ON payment_status_history;
+CREATE TRIGGER payment_status_history_append_only BEFORE UPDATE OR DELETE ON payment_status_history
+    FOR EACH ROW EXECUTE FUNCTION forbid_payment_status_history_change();
+
+-- Запуски очистки старых неуспешных платежей (FAILED_PAYMENT_RETENTION)
+CREATE TABLE IF NOT EXISTS payment_retention_runs (
+    id SERIAL PRIMARY KEY,
+    dry_run BOOLEAN NOT NULL,
+    cutoff TIMESTAMP NOT NULL,
+    payments INTEGER NOT NULL DEFAULT 0,
+    batches INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+-- Журнал аудита административных и удаляющих действий (pkg/audit)
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor VARCHAR(255) NOT NULL,
+    action VARCHAR(255) NOT NULL,
+    resource_type VARCHAR(100) NOT NULL,
+    resource_id VARCHAR(100) NOT NULL DEFAULT '',
+    body_sha256 CHAR(64) NOT NULL,
+    request_id VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor, id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_resource ON audit_log(resource_type, resource_id, id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+
+CREATE TABLE IF NOT EXISTS dead_letters (
+    id BIGSERIAL PRIMARY KEY,
+    source VARCHAR(100) NOT NULL,
+    method VARCHAR(10) NOT NULL DEFAULT 'POST',
+    target_url TEXT NOT NULL,
+    headers JSONB NOT NULL DEFAULT '{}'::jsonb,
+    payload TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'open',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_dead_letters_status ON dead_letters(status, id);
+
+-- Находки проверки согласованности (pkg/consistency): записи, ссылающиеся
+-- на удалённую запись другого сервиса. resolved_at — полный проход больше
+-- не нашёл ссылку.
+CREATE TABLE IF NOT EXISTS inconsistencies (
+    id BIGSERIAL PRIMARY KEY,
+    type VARCHAR(50) NOT NULL,
+    record_id INTEGER NOT NULL,
+    ref_id INTEGER NOT NULL,
+    detected_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP,
+    UNIQUE (type, record_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_inconsistencies_open ON inconsistencies(type, id) WHERE resolved_at IS NULL;
+
+-- Обработанные события для идемпотентного приёма (pkg/dedup)
+CREATE TABLE IF NOT EXISTS processed_events (
+    source VARCHAR(100) NOT NULL,
+    event_id VARCHAR(255) NOT NULL,
+    processed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (source, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_processed_events_processed_at ON processed_events(processed_at);
 
 -- Функция для обновления updated_at
 CREATE OR REPLACE FUNCTION update_updated_at_column()
@@ -1,11 +1,77 @@
+-- Зоны доставки и их тарифы: стоимость = base_fee + per_km_fee × км от склада
+CREATE TABLE IF NOT EXISTS delivery_zones (
+    id INTEGER PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    base_fee DECIMAL(10, 2) NOT NULL DEFAULT 0 CHECK (base_fee >= 0),
+    per_km_fee DECIMAL(10, 2) NOT NULL DEFAULT 0 CHECK (per_km_fee >= 0),
+    depot_lat DOUBLE PRECISION CHECK (depot_lat BETWEEN -90 AND 90),
+    depot_lon DOUBLE PRECISION CHECK (depot_lon BETWEEN -180 AND 180),
+    -- Обслуживаемая территория: круг вокруг склада и префиксы индексов.
+    radius_km DOUBLE PRECISION CHECK (radius_km > 0),
+    postcodes TEXT[] NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Справочник курьеров для выгрузок
+CREATE TABLE IF NOT EXISTS couriers (
+    id INTEGER PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Пункты выдачи: доставка до пункта вместо адреса, получение по коду
+CREATE TABLE IF NOT EXISTS pickup_points (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    address VARCHAR(500) NOT NULL,
+    lat DOUBLE PRECISION NOT NULL CHECK (lat BETWEEN -90 AND 90),
+    lon DOUBLE PRECISION NOT NULL CHECK (lon BETWEEN -180 AND 180),
+    -- Часы работы для покупателя, например "Пн-Пт 09:00-21:00, Сб 10:00-18:00"
+    opening_hours VARCHAR(255) NOT NULL DEFAULT '',
+    active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_pickup_points_active ON pickup_points(lat, lon) WHERE active;
+
 -- delivery_db: таблица доставок
 CREATE TABLE IF NOT EXISTS deliveries (
     id SERIAL PRIMARY KEY,
-    user_id INTEGER NOT NULL,
+    -- Покупатель: приходит в событии заказа; у доставок, созданных через
+    -- POST /deliveries, не задаётся
+    user_id INTEGER,
     order_id INTEGER NOT NULL,
     address VARCHAR(255) NOT NULL,
     status VARCHAR(50) DEFAULT 'pending',
-    tracking_id VARCHAR(50) NOT NULL UNIQUE,
+    courier_id INTEGER,
+    tracking_id VARCHAR(50) NOT NULL UNIQUE
+        DEFAULT 'TRK' || upper(substr(md5(random()::text || clock_timestamp()::text), 1, 12)),
+    estimated_delivery TIMESTAMP,
+    zone_id INTEGER,
+    window_start TIMESTAMP,
+    window_end TIMESTAMP,
+    lat DOUBLE PRECISION CHECK (lat BETWEEN -90 AND 90),
+    lon DOUBLE PRECISION CHECK (lon BETWEEN -180 AND 180),
+    fee DECIMAL(10, 2) NOT NULL DEFAULT 0 CHECK (fee >= 0),
+    label_code VARCHAR(16) UNIQUE,
+    delivered_at TIMESTAMP,
+    -- Заказ с товарами 18+: завершить доставку можно только после проверки
+    -- возраста получателя курьером
+    age_restricted BOOLEAN NOT NULL DEFAULT false,
+    recipient_age_verified BOOLEAN NOT NULL DEFAULT false,
+    -- Доставка в пункт выдачи: address и координаты берутся из пункта,
+    -- pickup_code создаётся при переходе в ready_for_pickup
+    pickup_point_id INTEGER REFERENCES pickup_points(id),
+    pickup_code VARCHAR(16),
+    -- Поздравление из заказа-подарка, печатается на этикетке
+    gift_message VARCHAR(200),
+    -- Демо-доставка: события и координаты генерирует симуляция
+    -- (DELIVERY_SIMULATION), в статистику и рейтинги курьеров не входит
+    simulated BOOLEAN NOT NULL DEFAULT false,
+    -- Сирота: проверка согласованности не нашла заказ (CONSISTENCY_REMEDIATE)
+    orphaned_at TIMESTAMP,
+    idempotency_key VARCHAR(255) UNIQUE,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
@@ -14,6 +80,184 @@ CREATE INDEX IF NOT EXISTS idx_deliveries_user_id ON deliveries(user_id);
 CREATE INDEX IF NOT EXISTS idx_deliveries_order_id ON deliveries(order_id);
 CREATE INDEX IF NOT EXISTS idx_deliveries_status ON deliveries(status);
 CREATE INDEX IF NOT EXISTS idx_deliveries_tracking_id ON deliveries(tracking_id);
+CREATE INDEX IF NOT EXISTS idx_deliveries_courier_id ON deliveries(courier_id, status);
+CREATE INDEX IF NOT EXISTS idx_deliveries_created_at ON deliveries(created_at);
+CREATE INDEX IF NOT EXISTS idx_deliveries_window ON deliveries(window_start, zone_id) WHERE window_start IS NOT NULL;
+
+-- Смены курьеров. Пересечения смен одного курьера проверяет сервис.
+CREATE TABLE IF NOT EXISTS courier_shifts (
+    id SERIAL PRIMARY KEY,
+    courier_id INTEGER NOT NULL,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    capacity INTEGER NOT NULL DEFAULT 3 CHECK (capacity > 0),
+    max_weight_kg DOUBLE PRECISION CHECK (max_weight_kg > 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_courier_shifts_courier ON courier_shifts(courier_id, starts_at);
+CREATE INDEX IF NOT EXISTS idx_courier_shifts_period ON courier_shifts(starts_at, ends_at);
+
+-- Посылки внутри доставки. confirmed_at — время сканирования при вручении.
+CREATE TABLE IF NOT EXISTS delivery_packages (
+    id SERIAL PRIMARY KEY,
+    delivery_id INTEGER NOT NULL REFERENCES deliveries(id) ON DELETE CASCADE,
+    barcode VARCHAR(64) NOT NULL UNIQUE,
+    weight_kg DOUBLE PRECISION NOT NULL CHECK (weight_kg > 0),
+    length_cm DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (length_cm >= 0),
+    width_cm DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (width_cm >= 0),
+    height_cm DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (height_cm >= 0),
+    confirmed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_delivery_packages_delivery_id ON delivery_packages(delivery_id);
+
+-- Оценки доставок получателями, одна на доставку
+CREATE TABLE IF NOT EXISTS delivery_ratings (
+    delivery_id INTEGER PRIMARY KEY REFERENCES deliveries(id) ON DELETE CASCADE,
+    courier_id INTEGER,
+    score SMALLINT NOT NULL CHECK (score BETWEEN 1 AND 5),
+    comment VARCHAR(1000) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_delivery_ratings_courier_id ON delivery_ratings(courier_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_delivery_ratings_created_at ON delivery_ratings(created_at DESC);
+
+-- События отслеживания доставки
+CREATE TABLE IF NOT EXISTS delivery_tracking_events (
+    id SERIAL PRIMARY KEY,
+    delivery_id INTEGER NOT NULL REFERENCES deliveries(id) ON DELETE CASCADE,
+    event_type VARCHAR(50) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_tracking_events_delivery_id ON delivery_tracking_events(delivery_id, created_at);
+
+-- SMS покупателю о доставке: очередь отправки и журнал, одна на доставку и событие
+CREATE TABLE IF NOT EXISTS sms_notifications (
+    id BIGSERIAL PRIMARY KEY,
+    delivery_id INTEGER NOT NULL REFERENCES deliveries(id) ON DELETE CASCADE,
+    order_id INTEGER NOT NULL,
+    -- in_transit, out_for_delivery или ready_for_pickup
+    event VARCHAR(50) NOT NULL,
+    phone VARCHAR(16),
+    -- pending, sent, failed, skipped (нет телефона, заказ или пользователь удалён),
+    -- suppressed_by_preference (SMS отключены в настройках уведомлений)
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP,
+    UNIQUE (delivery_id, event)
+);
+
+CREATE INDEX IF NOT EXISTS idx_sms_notifications_pending ON sms_notifications(next_attempt_at) WHERE status = 'pending';
+
+-- Координаты курьера по доставке
+CREATE TABLE IF NOT EXISTS courier_locations (
+    id SERIAL PRIMARY KEY,
+    delivery_id INTEGER NOT NULL REFERENCES deliveries(id) ON DELETE CASCADE,
+    courier_id INTEGER,
+    lat DOUBLE PRECISION NOT NULL CHECK (lat BETWEEN -90 AND 90),
+    lon DOUBLE PRECISION NOT NULL CHECK (lon BETWEEN -180 AND 180),
+    recorded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_courier_locations_delivery_id ON courier_locations(delivery_id, recorded_at DESC);
+CREATE INDEX IF NOT EXISTS idx_courier_locations_courier_id ON courier_locations(courier_id, recorded_at DESC);
+
+-- Обработанные события для идемпотентного приёма (pkg/dedup)
+CREATE TABLE IF NOT EXISTS processed_events (
+    source VARCHAR(100) NOT NULL,
+    event_id VARCHAR(255) NOT NULL,
+    processed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (source, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_processed_events_processed_at ON processed_events(processed_at);
+
+-- Журнал аудита административных и удаляющих действий (pkg/audit)
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor VARCHAR(255) NOT NULL,
+    action VARCHAR(255) NOT NULL,
+    resource_type VARCHAR(100) NOT NULL,
+    resource_id VARCHAR(100) NOT NULL DEFAULT '',
+    body_sha256 CHAR(64) NOT NULL,
+    request_id VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor, id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_resource ON audit_log(resource_type, resource_id, id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+
+-- Подписки на вебхуки о статусах доставок
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id SERIAL PRIMARY KEY,
+    url TEXT NOT NULL,
+    events TEXT[] NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Очередь вебхуков: пишется в одной транзакции с изменением доставки
+CREATE TABLE IF NOT EXISTS webhook_events (
+    id BIGSERIAL PRIMARY KEY,
+    event_id UUID NOT NULL UNIQUE DEFAULT gen_random_uuid(),
+    subscription_id INTEGER NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+    event_type VARCHAR(100) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    dispatched_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_events_pending ON webhook_events(next_attempt_at, id) WHERE status = 'pending';
+
+-- Исходящие запросы, исчерпавшие повторы; переотправляются через POST /dead-letters/{id}/replay
+CREATE TABLE IF NOT EXISTS dead_letters (
+    id BIGSERIAL PRIMARY KEY,
+    source VARCHAR(100) NOT NULL,
+    method VARCHAR(10) NOT NULL DEFAULT 'POST',
+    target_url TEXT NOT NULL,
+    headers JSONB NOT NULL DEFAULT '{}'::jsonb,
+    payload TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'open',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_dead_letters_status ON dead_letters(status, id);
+
+-- Находки проверки согласованности (pkg/consistency): записи, ссылающиеся
+-- на удалённую запись другого сервиса. resolved_at — полный проход больше
+-- не нашёл ссылку.
+CREATE TABLE IF NOT EXISTS inconsistencies (
+    id BIGSERIAL PRIMARY KEY,
+    type VARCHAR(50) NOT NULL,
+    record_id INTEGER NOT NULL,
+    ref_id INTEGER NOT NULL,
+    detected_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP,
+    UNIQUE (type, record_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_inconsistencies_open ON inconsistencies(type, id) WHERE resolved_at IS NULL;
 
 -- Функция для обновления updated_at
 CREATE OR REPLACE FUNCTION update_updated_at_column()
@@ -28,7 +272,20 @@ DROP TRIGGER IF EXISTS update_deliveries_updated_at ON deliveries;
 CREATE TRIGGER update_deliveries_updated_at BEFORE UPDATE ON deliveries
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
+DROP TRIGGER IF EXISTS update_courier_shifts_updated_at ON courier_shifts;
+CREATE TRIGGER update_courier_shifts_updated_at BEFORE UPDATE ON courier_shifts
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+DROP TRIGGER IF EXISTS update_webhook_subscriptions_updated_at ON webhook_subscriptions;
+CREATE TRIGGER update_webhook_subscriptions_updated_at BEFORE UPDATE ON webhook_subscriptions
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
 -- Demo данные
+INSERT INTO delivery_zones (id, name, base_fee, per_km_fee, depot_lat, depot_lon, radius_km, postcodes) VALUES
+    (1, 'Center', 199.00, 15.00, 55.7558, 37.6173, 15, '{101,103,107,109}'),
+    (2, 'Suburbs', 299.00, 25.00, 55.7558, 37.6173, 50, '{14}')
+ON CONFLICT (id) DO NOTHING;
+
 INSERT INTO deliveries (user_id, order_id, address, tracking_id, status) VALUES
     (1, 1, '742 Evergreen Terrace, Springfield, USA', 'TRK001', 'delivered'),
     (2, 2, '31 Spooner Street, Quahog, USA', 'TRK002', 'in_transit'),
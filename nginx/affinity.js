@@ -0,0 +1,22 @@
+// Ключ привязки клиента к реплике orders-service (hash ... consistent):
+// id пользователя из JWT, для анонимных запросов — cookie orders_affinity;
+// пустой ключ — обычная балансировка. Подпись токена здесь не проверяется:
+// ключ влияет только на выбор реплики, доступ проверяет сам сервис.
+function key(r) {
+    var auth = r.headersIn['Authorization'] || '';
+    var m = auth.match(/^Bearer\s+[^.]+\.([^.]+)\./i);
+    if (m) {
+        try {
+            var claims = JSON.parse(Buffer.from(m[1], 'base64url').toString());
+            if (claims.sub) {
+                return 'user:' + claims.sub;
+            }
+        } catch (e) {
+            // битый токен — как анонимный запрос
+        }
+    }
+    var cookie = r.variables.cookie_orders_affinity;
+    return cookie ? 'anon:' + cookie : '';
+}
+
+export default { key };
@@ -0,0 +1,88 @@
+// Кэш ответов шлюза для GET-маршрутов из map $cache_route (proxy_cache).
+//
+// Явная инвалидация: у каждого ресурса — первого сегмента пути после
+// /api/ — есть поколение, оно входит в ключ кэша ($cache_gen). Успешный
+// (не 4xx/5xx) запрос с другим методом к тому же ресурсу увеличивает
+// поколение, и прежние записи больше не находятся; вытесняются они сами,
+// по inactive и max_size зоны. Запрос, начатый до изменения, сохраняет
+// ответ под старым поколением и новым запросам его не отдаёт.
+//
+// record вызывается на каждый ответ (через access_log с if=$cache_record):
+// считает HIT/MISS/... по маршрутам и увеличивает поколения. Счётчики и
+// поколения — в разделяемой памяти всех воркеров; GET /cache-status
+// отдаёт их.
+
+var READ_METHODS = ['GET', 'HEAD', 'OPTIONS'];
+
+// resource — ресурс запроса: /api/orders/12/items → orders. По
+// $request_uri: r.uri после rewrite в локации уже без /api.
+function resource(r) {
+    var m = (r.variables.request_uri || '').match(/^\/api\/([^\/?]+)/);
+    return m ? m[1] : '';
+}
+
+function generation(r) {
+    var res = resource(r);
+    return res ? String(ngx.shared.cache_gen.get(res) || 0) : '0';
+}
+
+function record(r) {
+    var res = resource(r);
+    if (!res) {
+        return '';
+    }
+    if (READ_METHODS.indexOf(r.method) < 0) {
+        if (r.status < 400) {
+            ngx.shared.cache_gen.incr(res, 1, 0);
+            ngx.shared.cache_counts.incr('invalidated:' + res, 1, 0);
+        }
+        return '';
+    }
+    var route = r.variables.cache_route;
+    var result = r.variables.upstream_cache_status;
+    if (route && result) {
+        ngx.shared.cache_counts.incr(result.toLowerCase() + ':' + route, 1, 0);
+    }
+    return '';
+}
+
+// status — GET /cache-status: ответы по маршрутам (hit, miss, expired,
+// bypass, ...), инвалидации и поколения ресурсов.
+function status(r) {
+    var routes = {};
+    var invalidations = {};
+    var counts = ngx.shared.cache_counts;
+    counts.keys().forEach(function (k) {
+        var i = k.indexOf(':');
+        var kind = k.slice(0, i);
+        var name = k.slice(i + 1);
+        var n = counts.get(k) || 0;
+        if (kind == 'invalidated') {
+            invalidations[name] = n;
+            return;
+        }
+        var e = routes[name] = routes[name] || { requests: 0 };
+        e[kind] = n;
+        e.requests += n;
+    });
+    Object.keys(routes).forEach(function (name) {
+        var e = routes[name];
+        e.hit_ratio = e.requests ? Math.round((e.hit || 0) / e.requests * 1000) / 1000 : 0;
+    });
+
+    var generations = {};
+    ngx.shared.cache_gen.keys().forEach(function (k) {
+        generations[k] = ngx.shared.cache_gen.get(k);
+    });
+
+    r.headersOut['Content-Type'] = 'application/json';
+    r.headersOut['Cache-Control'] = 'no-store';
+    r.return(200, JSON.stringify({
+        enabled: r.variables.api_cache == 'on',
+        routes: routes,
+        invalidations: invalidations,
+        generations: generations,
+    }) + '\n');
+}
+
+export default { generation, record, status };
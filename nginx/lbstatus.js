@@ -0,0 +1,157 @@
+// Статистика балансировки для GET /lb-status: по каждому сервису — какие
+// реплики отвечали, сколько запросов пришлось на каждую за скользящее окно
+// и их текущее состояние.
+//
+// record вызывается на каждый проксированный ответ (через access_log с
+// if=$lb_record) и берёт реплику из заголовка X-Replica-ID. Счётчики — в
+// разделяемой памяти всех воркеров (js_shared_dict_zone), incr атомарен.
+// Окно делится на 60 корзин; $lb_window задаёт его в секундах.
+
+var BUCKETS = 60;
+
+function windowSeconds(r) {
+    var w = parseInt(r.variables.lb_window, 10);
+    return w > 0 ? w : 60;
+}
+
+function bucketSize(r) {
+    return Math.max(1, Math.ceil(windowSeconds(r) / BUCKETS));
+}
+
+function now() {
+    return Math.floor(Date.now() / 1000);
+}
+
+// service — имя upstream без суффикса режима (orders-service-affinity —
+// тот же orders-service).
+function service(r) {
+    return (r.variables.proxy_host || '').replace(/-affinity$/, '');
+}
+
+// attempts — попытки nginx для запроса: $upstream_addr и $upstream_status
+// перечисляют через запятую все бэкенды, если первый не ответил.
+function attempts(r) {
+    var addrs = (r.variables.upstream_addr || '').split(/\s*,\s*/);
+    var statuses = (r.variables.upstream_status || '').split(/\s*,\s*/);
+    var out = [];
+    for (var i = 0; i < addrs.length; i++) {
+        if (addrs[i]) {
+            out.push({ addr: addrs[i], status: parseInt(statuses[i], 10) || 502 });
+        }
+    }
+    return out;
+}
+
+function record(r) {
+    var svc = service(r);
+    if (!svc) {
+        return '';
+    }
+    var replicas = ngx.shared.lb_replicas;
+    var counts = ngx.shared.lb_counts;
+    var tries = attempts(r);
+    var t = now();
+    for (var i = 0; i < tries.length; i++) {
+        var a = tries[i];
+        var last = i == tries.length - 1;
+        // Ответившая реплика называет себя сама; для недоступной — id,
+        // с которым она отвечала с этого адреса раньше, иначе адрес.
+        var id = last && r.variables.upstream_http_x_replica_id;
+        if (id) {
+            replicas.set('addr:' + svc + ':' + a.addr, id);
+        } else {
+            id = replicas.get('addr:' + svc + ':' + a.addr) || a.addr;
+        }
+        replicas.set('health:' + svc + ':' + id, JSON.stringify({
+            address: a.addr,
+            status: a.status,
+            // 502/503/504 — реплика недоступна или не готова; прочие
+            // ответы, в том числе 500, — реплика жива.
+            healthy: [502, 503, 504].indexOf(a.status) < 0,
+            at: t,
+        }));
+        if (last) {
+            var bucket = t - t % bucketSize(r);
+            counts.incr('n:' + svc + ':' + id + ':' + bucket, 1, 0);
+        }
+    }
+    return '';
+}
+
+function json(r, code, body) {
+    r.headersOut['Content-Type'] = 'application/json';
+    r.return(code, JSON.stringify(body) + '\n');
+}
+
+function status(r) {
+    var win = windowSeconds(r);
+    var from = now() - win;
+    var services = {};
+    var entry = function (svc, id) {
+        var s = services[svc] = services[svc] || { total: 0, replicas: {} };
+        return s.replicas[id] = s.replicas[id] || { requests: 0 };
+    };
+
+    var counts = ngx.shared.lb_counts;
+    counts.keys().forEach(function (k) {
+        var p = k.split(':');
+        if (p[0] != 'n' || parseInt(p[p.length - 1], 10) < from - bucketSize(r)) {
+            return;
+        }
+        var svc = p[1];
+        var id = p.slice(2, -1).join(':');
+        var n = counts.get(k) || 0;
+        entry(svc, id).requests += n;
+        services[svc].total += n;
+    });
+
+    var replicas = ngx.shared.lb_replicas;
+    replicas.keys().forEach(function (k) {
+        var p = k.split(':');
+        if (p[0] != 'health') {
+            return;
+        }
+        var h = JSON.parse(replicas.get(k));
+        // Реплика, не отвечавшая дольше окна, в отчёт не попадает.
+        if (h.at < from) {
+            return;
+        }
+        var e = entry(p[1], p.slice(2).join(':'));
+        e.health = h.healthy ? 'up' : 'down';
+        e.address = h.address;
+        e.last_status = h.status;
+        e.last_seen = new Date(h.at * 1000).toISOString();
+    });
+
+    Object.keys(services).forEach(function (svc) {
+        var s = services[svc];
+        s.replica_ids = Object.keys(s.replicas).sort();
+        s.replica_ids.forEach(function (id) {
+            var e = s.replicas[id];
+            e.health = e.health || 'unknown';
+            e.share = s.total ? Math.round(e.requests / s.total * 1000) / 1000 : 0;
+        });
+    });
+
+    var since = replicas.get('reset_at');
+    json(r, 200, {
+        window_seconds: win,
+        reset_at: since ? new Date(parseInt(since, 10) * 1000).toISOString() : null,
+        services: services,
+    });
+}
+
+// reset — POST /lb-status/reset: обнулить счётчики перед новым замером.
+function reset(r) {
+    if (r.method != 'POST') {
+        r.headersOut['Allow'] = 'POST';
+        json(r, 405, { code: 'method_not_allowed', error: 'Method not allowed' });
+        return;
+    }
+    ngx.shared.lb_counts.clear();
+    ngx.shared.lb_replicas.clear();
+    ngx.shared.lb_replicas.set('reset_at', String(now()));
+    json(r, 200, { status: 'reset' });
+}
+
+export default { record, status, reset };
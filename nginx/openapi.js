@@ -0,0 +1,268 @@
+// Единая документация API на шлюзе: OpenAPI (Swagger 2.0) каждого сервиса
+// забирается с его /swagger/doc.json, пути переписываются в маршруты
+// шлюза (/users → /api/users), недоступные через шлюз пути (служебные,
+// /admin/*) отбрасываются. Документы хранятся в разделяемой памяти:
+// обновляются по таймеру (js_periodic) и по POST /admin/openapi/refresh;
+// если сервис недоступен, отдаётся последний полученный документ.
+//
+// /openapi.json — все сервисы в одном документе (теги и определения с
+// префиксом сервиса), /openapi/<сервис>.json — по отдельности, /docs —
+// Swagger UI с выбором документа.
+
+// services — откуда брать документ (реплики по порядку) и какие префиксы
+// путей сервиса шлюз проксирует и под каким путём.
+var services = {
+    'users-service': {
+        sources: ['http://users-service:8001'],
+        routes: { '/users': '/api/users', '/auth': '/api/auth', '/errors/catalog': '/api/errors/catalog' },
+    },
+    'orders-service': {
+        sources: ['http://orders-service-1:8002', 'http://orders-service-2:8002'],
+        routes: { '/orders': '/api/orders', '/reports': '/api/reports', '/system-id': '/api/system-id' },
+    },
+    'payments-service': {
+        sources: ['http://payments-service:8003'],
+        routes: { '/payments': '/api/payments', '/payment-methods': '/api/payment-methods' },
+    },
+    'delivery-service': {
+        sources: ['http://delivery-service:8004'],
+        routes: { '/deliveries': '/api/deliveries', '/couriers': '/api/couriers', '/zones': '/api/zones', '/pickup-points': '/api/pickup-points' },
+    },
+};
+
+var FETCH_TIMEOUT = 5000;
+
+// gatewayPath — путь сервиса в маршруте шлюза или null, если шлюз его не
+// проксирует.
+function gatewayPath(routes, path) {
+    var prefixes = Object.keys(routes);
+    for (var i = 0; i < prefixes.length; i++) {
+        var p = prefixes[i];
+        if (path == p || path.indexOf(p + '/') == 0) {
+            return routes[p] + path.substring(p.length);
+        }
+    }
+    return null;
+}
+
+function rewrite(name, spec) {
+    var routes = services[name].routes;
+    var paths = {};
+    Object.keys(spec.paths || {}).forEach(function (p) {
+        var gp = gatewayPath(routes, p);
+        if (gp) {
+            paths[gp] = spec.paths[p];
+        }
+    });
+    spec.paths = paths;
+    spec.basePath = '/';
+    delete spec.host;
+    return spec;
+}
+
+async function fetchSpec(name) {
+    var sources = services[name].sources;
+    var lastErr;
+    for (var i = 0; i < sources.length; i++) {
+        try {
+            var resp = await ngx.fetch(sources[i] + '/swagger/doc.json', { timeout: FETCH_TIMEOUT });
+            if (resp.status != 200) {
+                throw new Error(sources[i] + ': HTTP ' + resp.status);
+            }
+            return rewrite(name, await resp.json());
+        } catch (e) {
+            lastErr = e;
+        }
+    }
+    throw lastErr;
+}
+
+// refreshAll обновляет документы всех сервисов; при ошибке прежний
+// документ остаётся, а в состоянии сервиса записывается ошибка.
+async function refreshAll() {
+    var store = ngx.shared.openapi;
+    var names = Object.keys(services);
+    var results = await Promise.allSettled(names.map(fetchSpec));
+    var now = new Date().toISOString();
+    var report = {};
+    names.forEach(function (name, i) {
+        var state = JSON.parse(store.get('state:' + name) || '{}');
+        state.checked_at = now;
+        if (results[i].status == 'fulfilled') {
+            store.set('spec:' + name, JSON.stringify(results[i].value));
+            state.fetched_at = now;
+            delete state.error;
+        } else {
+            state.error = String(results[i].reason && results[i].reason.message || results[i].reason);
+            ngx.log(ngx.WARN, 'openapi: ' + name + ': ' + state.error);
+        }
+        state.stale = !!state.error;
+        store.set('state:' + name, JSON.stringify(state));
+        report[name] = state;
+    });
+    return report;
+}
+
+// refresh — обработчик js_periodic.
+async function refresh(s) {
+    await refreshAll();
+}
+
+function states() {
+    var out = {};
+    Object.keys(services).forEach(function (name) {
+        out[name] = JSON.parse(ngx.shared.openapi.get('state:' + name) || '{"stale":true,"error":"not fetched yet"}');
+    });
+    return out;
+}
+
+// specs — сохранённые документы; при пустом кэше (первый запрос после
+// старта) сначала загружает их.
+async function specs() {
+    var store = ngx.shared.openapi;
+    var names = Object.keys(services);
+    if (names.every(function (n) { return !store.get('state:' + n); })) {
+        await refreshAll();
+    }
+    var out = {};
+    names.forEach(function (name) {
+        var raw = store.get('spec:' + name);
+        if (raw) {
+            out[name] = JSON.parse(raw);
+        }
+    });
+    return out;
+}
+
+function send(r, code, body) {
+    r.headersOut['Content-Type'] = 'application/json';
+    r.headersOut['Cache-Control'] = 'no-cache';
+    r.return(code, JSON.stringify(body));
+}
+
+// prefixRefs добавляет префикс к ссылкам на определения.
+function prefixRefs(node, prefix) {
+    if (Array.isArray(node)) {
+        node.forEach(function (n) { prefixRefs(n, prefix); });
+    } else if (node && typeof node == 'object') {
+        Object.keys(node).forEach(function (k) {
+            var v = node[k];
+            if (k == '$ref' && typeof v == 'string' && v.indexOf('#/definitions/') == 0) {
+                node[k] = '#/definitions/' + prefix + v.substring('#/definitions/'.length);
+            } else {
+                prefixRefs(v, prefix);
+            }
+        });
+    }
+}
+
+// merge собирает один документ: определения с префиксом "<сервис>.", теги
+// операций — "<сервис>/<тег>".
+function merge(all, host) {
+    var out = {
+        swagger: '2.0',
+        info: { title: 'API Gateway', version: '1.0', description: 'Все сервисы через шлюз' },
+        host: host,
+        basePath: '/',
+        paths: {},
+        definitions: {},
+        tags: [],
+        'x-services': states(),
+    };
+    Object.keys(all).forEach(function (name) {
+        var spec = all[name];
+        var prefix = name + '.';
+        prefixRefs(spec, prefix);
+        Object.keys(spec.definitions || {}).forEach(function (d) {
+            out.definitions[prefix + d] = spec.definitions[d];
+        });
+        var seen = {};
+        Object.keys(spec.paths).forEach(function (p) {
+            var item = spec.paths[p];
+            Object.keys(item).forEach(function (method) {
+                var op = item[method];
+                if (op && typeof op == 'object' && !Array.isArray(op)) {
+                    op.tags = (op.tags && op.tags.length ? op.tags : ['default']).map(function (t) {
+                        seen[name + '/' + t] = true;
+                        return name + '/' + t;
+                    });
+                }
+            });
+            out.paths[p] = item;
+        });
+        Object.keys(seen).sort().forEach(function (t) {
+            out.tags.push({ name: t });
+        });
+        if (spec.securityDefinitions) {
+            out.securityDefinitions = Object.assign(out.securityDefinitions || {}, spec.securityDefinitions);
+        }
+    });
+    return out;
+}
+
+// combined — GET /openapi.json.
+async function combined(r) {
+    var all = await specs();
+    var doc = merge(all, r.headersIn['Host']);
+    var stale = Object.keys(doc['x-services']).filter(function (n) { return doc['x-services'][n].stale; });
+    if (stale.length) {
+        r.headersOut['X-OpenAPI-Stale'] = stale.join(', ');
+    }
+    send(r, 200, doc);
+}
+
+// single — GET /openapi/<сервис>.json.
+async function single(r) {
+    var m = r.uri.match(/^\/openapi\/([a-z-]+)\.json$/);
+    if (!m || !services[m[1]]) {
+        send(r, 404, { code: 'not_found', error: 'Unknown service' });
+        return;
+    }
+    var spec = (await specs())[m[1]];
+    if (!spec) {
+        send(r, 503, { code: 'service_unavailable', error: 'No OpenAPI document fetched yet', state: states()[m[1]] });
+        return;
+    }
+    spec.host = r.headersIn['Host'];
+    if (states()[m[1]].stale) {
+        r.headersOut['X-OpenAPI-Stale'] = m[1];
+    }
+    send(r, 200, spec);
+}
+
+// adminRefresh — POST /admin/openapi/refresh с X-Internal-API-Key, как у
+// /admin/* сервисов: без INTERNAL_API_KEY маршрут отключён.
+async function adminRefresh(r) {
+    var key = process.env.INTERNAL_API_KEY || '';
+    if (!key) {
+        send(r, 403, { code: 'feature_disabled', error: 'Admin API disabled: INTERNAL_API_KEY not set' });
+        return;
+    }
+    if (r.headersIn['X-Internal-API-Key'] !== key) {
+        send(r, 401, { code: 'invalid_api_key', error: 'Invalid internal API key' });
+        return;
+    }
+    if (r.method != 'POST') {
+        r.headersOut['Allow'] = 'POST';
+        send(r, 405, { code: 'method_not_allowed', error: 'Method not allowed' });
+        return;
+    }
+    send(r, 200, { services: await refreshAll() });
+}
+
+function docs(r) {
+    var urls = [{ url: '/openapi.json', name: 'Все сервисы' }].concat(Object.keys(services).map(function (n) {
+        return { url: '/openapi/' + n + '.json', name: n };
+    }));
+    r.headersOut['Content-Type'] = 'text/html; charset=utf-8';
+    r.return(200, '<!DOCTYPE html><html><head><meta charset="utf-8"><title>API Gateway — Swagger UI</title>' +
+        '<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css"></head><body>' +
+        '<div id="swagger-ui"></div>' +
+        '<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>' +
+        '<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-standalone-preset.js"></script>' +
+        '<script>window.ui = SwaggerUIBundle({urls: ' + JSON.stringify(urls) + ', dom_id: "#swagger-ui",' +
+        ' presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset], layout: "StandaloneLayout"});</script>' +
+        '</body></html>');
+}
+
+export default { refresh, combined, single, adminRefresh, docs };
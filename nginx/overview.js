@@ -0,0 +1,148 @@
+// Сводка для панели эксплуатации: GET /admin/overview одним запросом
+// собирает параллельно число заказов по статусам, платежи за сегодня
+// (UTC), доставки по статусам, свободных курьеров и /health каждой
+// реплики. У каждого раздела свой fetched_at; раздел, который не удалось
+// получить, содержит error вместо data, остальные отдаются как обычно.
+//
+// Готовый документ кэшируется в разделяемой памяти на $overview_ttl
+// секунд (X-Cache: HIT/MISS); ?refresh=1 собирает заново. Доступ — по
+// X-Internal-API-Key, как у /admin/* сервисов.
+
+// sources — адреса реплик сервисов; разделы берут данные у первой
+// ответившей.
+var sources = {
+    'users-service': ['http://users-service:8001'],
+    'orders-service': ['http://orders-service-1:8002', 'http://orders-service-2:8002'],
+    'payments-service': ['http://payments-service:8003'],
+    'delivery-service': ['http://delivery-service:8004'],
+};
+
+var FETCH_TIMEOUT = 3000;
+
+function send(r, code, body) {
+    r.headersOut['Content-Type'] = 'application/json';
+    r.headersOut['Cache-Control'] = 'no-store';
+    r.return(code, JSON.stringify(body));
+}
+
+function ttl(r) {
+    var t = parseInt(r.variables.overview_ttl, 10);
+    return t >= 0 ? t : 10;
+}
+
+async function getJSON(url) {
+    var resp = await ngx.fetch(url, {
+        timeout: FETCH_TIMEOUT,
+        headers: { 'X-Internal-API-Key': process.env.INTERNAL_API_KEY || '' },
+    });
+    if (resp.status != 200) {
+        throw new Error(url + ': HTTP ' + resp.status);
+    }
+    return await resp.json();
+}
+
+// fromService — GET path у первой ответившей реплики сервиса.
+async function fromService(name, path) {
+    var urls = sources[name];
+    var lastErr;
+    for (var i = 0; i < urls.length; i++) {
+        try {
+            return await getJSON(urls[i] + path);
+        } catch (e) {
+            lastErr = e;
+        }
+    }
+    throw lastErr;
+}
+
+// sections — разделы сводки; каждый возвращает data или бросает ошибку.
+var sections = {
+    orders: async function () {
+        return await fromService('orders-service', '/orders/counts');
+    },
+    payments_today: async function () {
+        var today = new Date().toISOString().substring(0, 10);
+        var stats = await fromService('payments-service', '/payments/stats?from=' + today + '&to=' + today);
+        return { date: today, currencies: stats.currencies };
+    },
+    deliveries: async function () {
+        var c = await fromService('delivery-service', '/deliveries/counts');
+        return { active: { pending: c.counts.pending || 0, in_transit: c.counts.in_transit || 0 }, counts: c.counts, total: c.total };
+    },
+    couriers: async function () {
+        var list = await fromService('delivery-service', '/couriers/available');
+        var out = { on_shift: list.length, with_capacity: 0, remaining_capacity: 0 };
+        list.forEach(function (c) {
+            if (c.remaining_capacity > 0) {
+                out.with_capacity++;
+                out.remaining_capacity += c.remaining_capacity;
+            }
+        });
+        return out;
+    },
+    services: async function () {
+        var names = Object.keys(sources);
+        var out = {};
+        await Promise.all(names.map(async function (name) {
+            out[name] = await Promise.all(sources[name].map(async function (url) {
+                try {
+                    var h = await getJSON(url + '/health');
+                    return { url: url, status: h.status, replica_id: h.replica_id };
+                } catch (e) {
+                    return { url: url, status: 'unreachable', error: String(e.message || e) };
+                }
+            }));
+        }));
+        return out;
+    },
+};
+
+async function build() {
+    var names = Object.keys(sections);
+    var doc = { generated_at: new Date().toISOString(), sections: {} };
+    await Promise.all(names.map(async function (name) {
+        try {
+            var data = await sections[name]();
+            doc.sections[name] = { fetched_at: new Date().toISOString(), data: data };
+        } catch (e) {
+            doc.sections[name] = { fetched_at: new Date().toISOString(), error: String(e.message || e) };
+        }
+    }));
+    return doc;
+}
+
+// overview — GET /admin/overview.
+async function overview(r) {
+    var key = process.env.INTERNAL_API_KEY || '';
+    if (!key) {
+        send(r, 403, { code: 'feature_disabled', error: 'Admin API disabled: INTERNAL_API_KEY not set' });
+        return;
+    }
+    if (r.headersIn['X-Internal-API-Key'] !== key) {
+        send(r, 401, { code: 'invalid_api_key', error: 'Invalid internal API key' });
+        return;
+    }
+    if (r.method != 'GET') {
+        r.headersOut['Allow'] = 'GET';
+        send(r, 405, { code: 'method_not_allowed', error: 'Method not allowed' });
+        return;
+    }
+
+    var store = ngx.shared.overview;
+    if (r.args.refresh != '1') {
+        var cached = store.get('doc');
+        if (cached) {
+            r.headersOut['X-Cache'] = 'HIT';
+            send(r, 200, JSON.parse(cached));
+            return;
+        }
+    }
+    var doc = await build();
+    if (ttl(r) > 0) {
+        store.set('doc', JSON.stringify(doc), ttl(r) * 1000);
+    }
+    r.headersOut['X-Cache'] = 'MISS';
+    send(r, 200, doc);
+}
+
+export default { overview };
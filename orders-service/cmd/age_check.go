@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+	"pkg/audit"
+	"pkg/clients"
+	"pkg/observe"
+)
+
+// Заказы с age_restricted (товары 18+). При создании возраст покупателя
+// сверяется с MIN_CUSTOMER_AGE по users-service; при вручении возраст
+// получателя подтверждает курьер (recipient_age_verified в
+// delivery-service). Если users-service не ответил, решение зависит от
+// AGE_CHECK_FAILURE_MODE: closed — заказ отклоняется с 503, open —
+// создаётся без проверки. Каждое решение пишется в order_history, в том
+// числе для отклонённых заказов (с order_id NULL).
+
+// События order_history.
+const (
+	historyAgeVerified    = "age_verified"
+	historyAgeRejected    = "age_requirement_not_met"
+	historyAgeCheckFailed = "age_check_failed"
+	historyAgeCheckSkip   = "age_check_skipped"
+)
+
+// HistoryEntry — запись order_history. Таблица только дополняется: UPDATE
+// и DELETE запрещены триггером.
+type HistoryEntry struct {
+	ID        int64  `json:"id"`
+	OrderID   *int   `json:"order_id"`
+	UserID    int    `json:"user_id"`
+	Event     string `json:"event" example:"age_verified"`
+	Detail    string `json:"detail"`
+	Actor     string `json:"actor"`
+	RequestID string `json:"request_id"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// ageDecision — решение по возрасту покупателя для записи в историю.
+type ageDecision struct {
+	event  string
+	detail string
+}
+
+// checkCustomerAge проверяет возраст покупателя заказа с age_restricted.
+// Ошибка означает, что заказ создавать нельзя; решение возвращается и в
+// этом случае, чтобы его можно было записать.
+func checkCustomerAge(r *http.Request, userID int) (ageDecision, error) {
+	if cfg.MinCustomerAge == 0 {
+		return ageDecision{historyAgeCheckSkip, "MIN_CUSTOMER_AGE=0"}, nil
+	}
+	if usersServiceURL == "" {
+		return decideAge(nil, fmt.Errorf("USERS_SERVICE_URL is not set"))
+	}
+	u, err := usersClient.Get(r.Context(), userID)
+	return decideAge(u, err)
+}
+
+// decideAge выносит решение по ответу users-service. Ответ вне 2xx —
+// пользователя нет, и заказ отклоняется при любом AGE_CHECK_FAILURE_MODE;
+// режим действует только при недоступности сервиса.
+func decideAge(u *clients.User, err error) (ageDecision, error) {
+	if status := clients.StatusOf(err); status != 0 {
+		d := ageDecision{historyAgeCheckFailed, fmt.Sprintf("users-service responded %d", status)}
+		return d, apierr.New(apierr.UnknownUser, "User not found or deactivated")
+	}
+	if err != nil {
+		if cfg.AgeCheckFailureMode == "open" {
+			return ageDecision{historyAgeCheckSkip, "users-service unavailable, AGE_CHECK_FAILURE_MODE=open: " + err.Error()}, nil
+		}
+		d := ageDecision{historyAgeCheckFailed, "users-service unavailable, AGE_CHECK_FAILURE_MODE=closed: " + err.Error()}
+		return d, apierr.New(apierr.DependencyUnavailable, "cannot verify customer age: "+err.Error())
+	}
+	if u.Age < cfg.MinCustomerAge {
+		d := ageDecision{historyAgeRejected, fmt.Sprintf("age %d is below %d", u.Age, cfg.MinCustomerAge)}
+		return d, apierr.New(apierr.AgeRequirementNotMet,
+			fmt.Sprintf("customer must be at least %d years old", cfg.MinCustomerAge)).
+			With("min_age", cfg.MinCustomerAge)
+	}
+	return ageDecision{historyAgeVerified, fmt.Sprintf("age %d, minimum %d", u.Age, cfg.MinCustomerAge)}, nil
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// recordOrderHistory пишет решение в order_history. orderID 0 — заказ не
+// создан; такую запись пишут вне транзакции заказа.
+func recordOrderHistory(r *http.Request, q execer, orderID, userID int, d ageDecision) error {
+	_, err := q.ExecContext(r.Context(),
+		`INSERT INTO order_history (order_id, user_id, event, detail, actor, request_id)
+		 VALUES (NULLIF($1, 0), $2, $3, $4, $5, $6)`,
+		orderID, userID, d.event, d.detail, audit.Actor(r), observe.RequestID(r.Context()))
+	return err
+}
+
+// rejectAgeRestricted записывает отказ в историю и отвечает ошибкой
+// проверки. Сбой записи только логируется: клиенту важнее причина отказа.
+func rejectAgeRestricted(w http.ResponseWriter, r *http.Request, userID int, d ageDecision, err error) {
+	log.Printf("🔞 Age-restricted order for user %d rejected: %s", userID, d.detail)
+	if herr := recordOrderHistory(r, db, 0, userID, d); herr != nil {
+		log.Printf("⚠️ Order history write failed: %v", herr)
+	}
+	apierr.Respond(w, err)
+}
+
+// @Summary Order history
+// @Description Решения по заказу: проверки возраста покупателя для заказов с age_restricted (age_verified, age_requirement_not_met, age_check_failed, age_check_skipped), кто и когда. Старые сначала.
+// @Tags orders
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {array} HistoryEntry
+// @Failure 404 {object} map[string]string
+// @Router /orders/{id}/history [get]
+func getOrderHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT id, order_id, user_id, event, detail, actor, request_id, created_at
+		 FROM order_history WHERE order_id = $1 ORDER BY id`, id)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	history := []HistoryEntry{}
+	for rows.Next() {
+		var e HistoryEntry
+		if err := rows.Scan(&e.ID, &e.OrderID, &e.UserID, &e.Event, &e.Detail, &e.Actor, &e.RequestID, &e.CreatedAt); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		history = append(history, e)
+	}
+	if err := rows.Err(); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	// История переживает удаление и архивацию заказа, поэтому 404 — только
+	// если нет ни истории, ни заказа.
+	if len(history) == 0 {
+		var exists bool
+		err := db.QueryRowContext(r.Context(),
+			"SELECT EXISTS (SELECT 1 FROM orders WHERE id = $1) OR EXISTS (SELECT 1 FROM orders_archive WHERE id = $1)", id).Scan(&exists)
+		if err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		if !exists {
+			apierr.Write(w, apierr.OrderNotFound, "Order not found")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"pkg/apierr"
+	"pkg/clients"
+	"pkg/httpclient"
+)
+
+func TestDecideAge(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg.MinCustomerAge, cfg.AgeCheckFailureMode = 18, "closed"
+
+	if d, err := decideAge(&clients.User{Age: 18}, nil); err != nil || d.event != historyAgeVerified {
+		t.Errorf("age 18: %+v, %v", d, err)
+	}
+	var e *apierr.Error
+	d, err := decideAge(&clients.User{Age: 17}, nil)
+	if !errors.As(err, &e) || e.Code != apierr.AgeRequirementNotMet || d.event != historyAgeRejected {
+		t.Fatalf("age 17: %+v, %v", d, err)
+	}
+
+	// Недоступность users-service: closed отклоняет, open пропускает.
+	unavailable := httpclient.ErrDependencyUnavailable
+	if d, err := decideAge(nil, unavailable); !errors.As(err, &e) || e.Code != apierr.DependencyUnavailable || d.event != historyAgeCheckFailed {
+		t.Errorf("closed: %+v, %v", d, err)
+	}
+	cfg.AgeCheckFailureMode = "open"
+	if d, err := decideAge(nil, unavailable); err != nil || d.event != historyAgeCheckSkip {
+		t.Errorf("open: %+v, %v", d, err)
+	}
+	// Неизвестный пользователь отклоняется и в режиме open.
+	if _, err := decideAge(nil, &clients.Error{Status: 404}); !errors.As(err, &e) || e.Code != apierr.UnknownUser {
+		t.Errorf("unknown user: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pkg/apierr"
+	"pkg/pg"
+)
+
+const archiveBatchSize = 1000
+
+// archivableStatuses — конечные статусы, заказы в которых можно переносить
+// в orders_archive.
+var archivableStatuses = map[string]bool{"delivered": true, "cancelled": true}
+
+// ArchiveRun — результат переноса заказов в архив.
+type ArchiveRun struct {
+	Status   string `json:"status"`
+	Before   string `json:"before"`
+	Archived int64  `json:"archived"`
+}
+
+// @Summary Archive orders
+// @Description Перенести заказы в конечном статусе, не менявшиеся до даты before, в orders_archive (кроме заказов с незавершённой сагой оформления). Перенос идёт пачками, каждая в своей транзакции. Требует X-Internal-API-Key.
+// @Tags orders
+// @Produce json
+// @Param before query string true "Дата (YYYY-MM-DD или RFC 3339)"
+// @Param status query string false "delivered (по умолчанию) или cancelled"
+// @Success 200 {object} ArchiveRun
+// @Failure 400 {object} map[string]string
+// @Router /orders/archive [post]
+func archiveOrders(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	before, err := time.Parse("2006-01-02", q.Get("before"))
+	if err != nil {
+		if before, err = time.Parse(time.RFC3339, q.Get("before")); err != nil {
+			apierr.Write(w, apierr.InvalidRequest, "before: expected YYYY-MM-DD or RFC 3339")
+			return
+		}
+	}
+	run := ArchiveRun{Status: q.Get("status"), Before: before.Format(time.RFC3339)}
+	if run.Status == "" {
+		run.Status = "delivered"
+	}
+	if !archivableStatuses[run.Status] {
+		apierr.Write(w, apierr.InvalidRequest, "status must be delivered or cancelled")
+		return
+	}
+
+	for {
+		ids, err := archiveBatch(r.Context(), run.Status, before)
+		if err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		for _, id := range ids {
+			orderCache.Delete(r.Context(), strconv.FormatInt(id, 10))
+		}
+		run.Archived += int64(len(ids))
+		if len(ids) < archiveBatchSize {
+			break
+		}
+	}
+	log.Printf("📦 Archived %d %s orders last updated before %s", run.Archived, run.Status, run.Before)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// archiveBatch переносит одну пачку: вставка в архив и удаление из orders
+// выполняются одним запросом. Завершённые саги, ссылающиеся на заказы,
+// удаляются вместе с ними; заказы с незавершённой сагой пропускаются.
+func archiveBatch(ctx context.Context, status string, before time.Time) ([]int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var ids []int64
+	err = tx.QueryRowContext(ctx,
+		`SELECT COALESCE(array_agg(id), '{}') FROM (
+		   SELECT id FROM orders WHERE status = $1 AND updated_at < $2 AND `+noRunningSaga+`
+		   ORDER BY id LIMIT $3 FOR UPDATE SKIP LOCKED
+		 ) batch`,
+		status, before, archiveBatchSize).Scan(pg.Array(&ids))
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM checkout_sagas WHERE order_id = ANY($1)", ids); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`WITH moved AS (DELETE FROM orders WHERE id = ANY($1) RETURNING *)
+		 INSERT INTO orders_archive SELECT moved.*, NOW() FROM moved`,
+		ids); err != nil {
+		return nil, err
+	}
+	return ids, tx.Commit()
+}
+
+// loadArchivedOrder читает заказ из orders_archive.
+func loadArchivedOrder(ctx context.Context, id int) (Order, error) {
+	var o Order
+	err := scanOrder(db.QueryRowContext(ctx, "SELECT "+orderColumns+" FROM orders_archive WHERE id = $1", id), &o)
+	return o, err
+}
+
+func isArchived(ctx context.Context, id int) (bool, error) {
+	var archived bool
+	err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM orders_archive WHERE id = $1)", id).Scan(&archived)
+	return archived, err
+}
+
+// orderNotFound отвечает 409 для архивного заказа и 404 для
+// несуществующего.
+func orderNotFound(w http.ResponseWriter, r *http.Request, id int) {
+	archived, err := isArchived(r.Context(), id)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if archived {
+		apierr.Write(w, apierr.OrderArchived, "Order is archived and cannot be modified")
+		return
+	}
+	apierr.Write(w, apierr.OrderNotFound, "Order not found")
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg/admin"
+	"pkg/apierr"
+	"pkg/pg"
+)
+
+const (
+	bulkDeleteBatchSize  = 200
+	bulkDeleteSampleSize = 20
+)
+
+// BulkDeleteRequest — фильтр заказов и флаги POST /orders/bulk-delete.
+// Фильтры те же, что у GET /orders и /orders/counts; нужен хотя бы один.
+type BulkDeleteRequest struct {
+	Status string   `json:"status,omitempty"`
+	UserID *int     `json:"user_id,omitempty"`
+	From   string   `json:"from,omitempty" example:"2026-01-01"`
+	To     string   `json:"to,omitempty" example:"2026-02-01"`
+	Tags   []string `json:"tags,omitempty"`
+	// DryRun обязателен: true — только посчитать, false — удалить.
+	DryRun *bool `json:"dry_run"`
+	// ConfirmOverCap разрешает удалить больше BULK_DELETE_CAP заказов.
+	ConfirmOverCap bool `json:"confirm_over_cap,omitempty"`
+}
+
+// BulkDeleteResult — сколько заказов попало под фильтр и сколько удалено;
+// при dry_run — первые из них.
+type BulkDeleteResult struct {
+	DryRun    bool    `json:"dry_run"`
+	Matched   int64   `json:"matched"`
+	Deleted   int64   `json:"deleted"`
+	SampleIDs []int64 `json:"sample_ids,omitempty"`
+}
+
+// orderFilter — условие WHERE по заказам с позиционными параметрами.
+type orderFilter struct {
+	where []string
+	args  []interface{}
+}
+
+func (f *orderFilter) add(cond string, v interface{}) {
+	f.args = append(f.args, v)
+	f.where = append(f.where, strings.Replace(cond, "?", "$"+strconv.Itoa(len(f.args)), 1))
+}
+
+func (f *orderFilter) sql() string {
+	return strings.Join(f.where, " AND ")
+}
+
+func (req BulkDeleteRequest) filter() (*orderFilter, error) {
+	f := &orderFilter{}
+	if req.Status != "" {
+		f.add("status = ?", req.Status)
+	}
+	if req.UserID != nil {
+		f.add("user_id = ?", *req.UserID)
+	}
+	for _, p := range []struct{ name, value, cond string }{{"from", req.From, "created_at >= ?"}, {"to", req.To, "created_at < ?"}} {
+		if p.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, p.value)
+		if err != nil {
+			if t, err = time.Parse("2006-01-02", p.value); err != nil {
+				return nil, fmt.Errorf("%s: expected RFC 3339 or YYYY-MM-DD", p.name)
+			}
+		}
+		f.add(p.cond, t)
+	}
+	if len(req.Tags) > 0 {
+		tags := make([]string, len(req.Tags))
+		for i, t := range req.Tags {
+			tags[i] = strings.ToLower(strings.TrimSpace(t))
+		}
+		f.add("tags @> ?", tags)
+	}
+	if len(f.where) == 0 {
+		return nil, fmt.Errorf("at least one filter is required: status, user_id, from, to or tags")
+	}
+	return f, nil
+}
+
+// @Summary Bulk delete orders
+// @Description Удалить заказы по фильтру (status, user_id, from/to по created_at, tags). dry_run обязателен: true возвращает число и первые id, false удаляет пачками, каждая в своей транзакции. Удалённые заказы переносятся в orders_deleted; заказы с незавершённой сагой оформления не удаляются и не считаются. Больше BULK_DELETE_CAP заказов — только с confirm_over_cap. Каждый вызов пишется в журнал аудита. Требует X-Internal-API-Key.
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param request body BulkDeleteRequest true "Фильтр и флаги"
+// @Success 200 {object} BulkDeleteResult
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]interface{} "code: bulk_delete_over_cap"
+// @Router /orders/bulk-delete [post]
+func bulkDeleteOrders(w http.ResponseWriter, r *http.Request) {
+	var req BulkDeleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	if req.DryRun == nil {
+		apierr.Write(w, apierr.InvalidRequest, "dry_run is required")
+		return
+	}
+	f, err := req.filter()
+	if err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+
+	res := BulkDeleteResult{DryRun: *req.DryRun}
+	if err := db.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM orders WHERE "+f.sql()+" AND "+noRunningSaga, f.args...).Scan(&res.Matched); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	if res.DryRun {
+		err = db.QueryRowContext(r.Context(),
+			"SELECT COALESCE(array_agg(id), '{}') FROM (SELECT id FROM orders WHERE "+f.sql()+" AND "+noRunningSaga+
+				" ORDER BY id LIMIT "+strconv.Itoa(bulkDeleteSampleSize)+") sample",
+			f.args...).Scan(pg.Array(&res.SampleIDs))
+		if err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		log.Printf("🗑️ Bulk delete dry run by %s: %d orders match", admin.Actor(r), res.Matched)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	if res.Matched > int64(cfg.BulkDeleteCap) && !req.ConfirmOverCap {
+		apierr.Respond(w, apierr.New(apierr.BulkDeleteOverCap,
+			fmt.Sprintf("filter matches %d orders, more than %d; repeat with confirm_over_cap to delete them", res.Matched, cfg.BulkDeleteCap)).
+			With("matched", res.Matched).With("cap", cfg.BulkDeleteCap))
+		return
+	}
+
+	// Удаляется не больше, чем насчитано: заказы, созданные после подсчёта,
+	// в удаление не попадают.
+	for res.Deleted < res.Matched {
+		ids, err := bulkDeleteBatch(r.Context(), f, min(bulkDeleteBatchSize, res.Matched-res.Deleted))
+		if err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		for _, id := range ids {
+			orderCache.Delete(r.Context(), strconv.FormatInt(id, 10))
+		}
+		res.Deleted += int64(len(ids))
+		if len(ids) == 0 {
+			break
+		}
+	}
+	log.Printf("🗑️ Bulk delete by %s: %d of %d matching orders deleted", admin.Actor(r), res.Deleted, res.Matched)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// bulkDeleteBatch переносит в orders_deleted до limit заказов под фильтром
+// вместе с удалением саг, которые на них ссылаются, в одной транзакции.
+// Заказы с незавершённой сагой пропускаются.
+func bulkDeleteBatch(ctx context.Context, f *orderFilter, limit int64) ([]int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var ids []int64
+	err = tx.QueryRowContext(ctx,
+		`SELECT COALESCE(array_agg(id), '{}') FROM (
+		   SELECT id FROM orders WHERE `+f.sql()+` AND `+noRunningSaga+`
+		   ORDER BY id LIMIT $`+strconv.Itoa(len(f.args)+1)+` FOR UPDATE SKIP LOCKED
+		 ) batch`,
+		append(f.args[:len(f.args):len(f.args)], limit)...).Scan(pg.Array(&ids))
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM checkout_sagas WHERE order_id = ANY($1)", ids); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`WITH moved AS (DELETE FROM orders WHERE id = ANY($1) RETURNING *)
+		 INSERT INTO orders_deleted SELECT moved.*, NOW() FROM moved`,
+		ids); err != nil {
+		return nil, err
+	}
+	return ids, tx.Commit()
+}
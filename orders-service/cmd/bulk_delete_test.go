@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestBulkDeleteFilter(t *testing.T) {
+	userID := 42
+	f, err := BulkDeleteRequest{Status: "cancelled", UserID: &userID, To: "2026-01-01", Tags: []string{" Test "}}.filter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "status = $1 AND user_id = $2 AND created_at < $3 AND tags @> $4"
+	if f.sql() != want || len(f.args) != 4 {
+		t.Errorf("filter = %q with %d args, want %q", f.sql(), len(f.args), want)
+	}
+	if tags := f.args[3].([]string); tags[0] != "test" {
+		t.Errorf("tag not normalized: %q", tags[0])
+	}
+
+	// Пустой фильтр удалил бы все заказы.
+	if _, err := (BulkDeleteRequest{}).filter(); err == nil {
+		t.Error("empty filter accepted")
+	}
+	if _, err := (BulkDeleteRequest{From: "yesterday"}).filter(); err == nil {
+		t.Error("bad date accepted")
+	}
+}
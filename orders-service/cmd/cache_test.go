@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/mux"
+	"pkg/cache"
+	"pkg/dbhealth"
+)
+
+// TestUpdateThenGetSkipsStaleCache — GET после PUT отдаёт новую версию
+// заказа, а не ту, что осталась в кэше от предыдущего GET.
+func TestUpdateThenGetSkipsStaleCache(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	dbWatch = dbhealth.FromEnv(db)
+
+	mr := miniredis.RunT(t)
+	t.Setenv("REDIS_URL", "redis://"+mr.Addr())
+	var err error
+	if orderCache, err = cache.FromEnv("orders"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { orderCache.Close(); orderCache = nil })
+
+	o := Order{UserID: 1, TotalAmount: 10, Currency: "RUB", Status: "pending", ShippingAddress: "Old street 1"}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := insertOrder(ctx, tx, &o); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM outbox_events WHERE aggregate_id = $1", o.ID)
+		db.Exec("DELETE FROM orders WHERE id = $1", o.ID)
+	})
+
+	id := strconv.Itoa(o.ID)
+	vars := map[string]string{"id": id}
+	address := func() string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		getOrder(rec, mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/orders/"+id, nil), vars))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET: status %d: %s", rec.Code, rec.Body)
+		}
+		var got OrderDetail
+		if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		return got.ShippingAddress
+	}
+
+	if got := address(); got != "Old street 1" {
+		t.Fatalf("first GET: %q", got)
+	}
+	if !mr.Exists("orders:" + id) {
+		t.Fatal("GET did not populate the cache")
+	}
+
+	rec := httptest.NewRecorder()
+	updateOrder(rec, mux.SetURLVars(httptest.NewRequest(http.MethodPut, "/orders/"+id,
+		strings.NewReader(`{"user_id": 1, "total_amount": 10, "status": "pending", "shipping_address": "New street 2"}`)), vars))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT: status %d: %s", rec.Code, rec.Body)
+	}
+
+	if got := address(); got != "New street 2" {
+		t.Errorf("GET after PUT: %q, want New street 2", got)
+	}
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg/apierr"
+	"pkg/clients"
+	"pkg/currency"
+	"pkg/httpclient"
+	"pkg/pg"
+)
+
+// Шаги и состояния саги оформления заказа. Состояние сохраняется после
+// каждого шага, поэтому прерванную сагу можно продолжить или откатить.
+const (
+	sagaOrderCreated   = "order_created"
+	sagaPaymentCharged = "payment_charged"
+	sagaDeliveryBooked = "delivery_created"
+	sagaCompleted      = "completed"
+	sagaCompensating   = "compensating"
+	sagaCompensated    = "compensated"
+
+	stepChargePayment  = "charge_payment"
+	stepCreateDelivery = "create_delivery"
+	stepConfirmOrder   = "confirm_order"
+)
+
+var paymentsServiceURL string
+var deliveryServiceURL string
+
+type CheckoutRequest = clients.CheckoutRequest
+
+type CheckoutResult = clients.CheckoutResult
+
+type checkoutSaga struct {
+	ID              string
+	OrderID         int
+	UserID          int
+	TotalAmount     float64
+	Currency        string
+	ShippingAddress string
+	PaymentMethod   string
+	State           string
+	FailedStep      sql.NullString
+	Error           sql.NullString
+	PaymentID       *int
+	DeliveryID      *int
+	Compensations   []string
+	dependencyDown  bool
+}
+
+func (s *checkoutSaga) result() CheckoutResult {
+	return CheckoutResult{
+		SagaID:        s.ID,
+		Status:        s.State,
+		FailedStep:    s.FailedStep.String,
+		Error:         s.Error.String,
+		OrderID:       s.OrderID,
+		PaymentID:     s.PaymentID,
+		DeliveryID:    s.DeliveryID,
+		Compensations: s.Compensations,
+	}
+}
+
+// @Summary Checkout
+// @Description Оформление заказа одной операцией: создание заказа, оплата в payments-service и создание доставки в delivery-service. При ошибке выполняется компенсация (возврат платежа, отмена заказа). Повтор с тем же Idempotency-Key возвращает результат завершённой саги, а пока сага выполняется — 409 idempotency_in_progress.
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param Idempotency-Key header string false "Ключ идемпотентности оформления"
+// @Param checkout body CheckoutRequest true "Checkout data"
+// @Success 201 {object} CheckoutResult
+// @Success 200 {object} CheckoutResult
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string "Оформление выключено флагом checkout_saga"
+// @Failure 409 {object} map[string]string "code: idempotency_in_progress — сага с тем же Idempotency-Key ещё выполняется"
+// @Failure 422 {object} CheckoutResult
+// @Failure 503 {object} CheckoutResult
+// @Router /orders/checkout [post]
+func checkout(w http.ResponseWriter, r *http.Request) {
+	var req CheckoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	if req.UserID <= 0 || req.TotalAmount <= 0 || strings.TrimSpace(req.ShippingAddress) == "" || req.PaymentMethod == "" {
+		apierr.Write(w, apierr.InvalidRequest, "user_id, total_amount, shipping_address and payment_method are required")
+		return
+	}
+	if req.Currency = currency.Normalize(req.Currency); req.Currency == "" {
+		req.Currency = defaultCurrency
+	} else if !currency.Valid(req.Currency) {
+		writeFieldErrors(w, map[string]apierr.Violation{"currency": {Rule: apierr.RuleUnsupported}})
+		return
+	}
+	if err := checkMinOrderAmount(r, req.TotalAmount, req.Currency); err != nil {
+		apierr.Respond(w, err)
+		return
+	}
+	if !featureFlags.EnabledFor("checkout_saga", strconv.Itoa(req.UserID), true) {
+		apierr.Write(w, apierr.NotFound, "Checkout is not enabled")
+		return
+	}
+	if paymentsServiceURL == "" || deliveryServiceURL == "" {
+		apierr.Write(w, apierr.ServiceUnavailable, "Checkout is not configured: PAYMENTS_SERVICE_URL and DELIVERY_SERVICE_URL are required")
+		return
+	}
+
+	key := r.Header.Get("Idempotency-Key")
+	if key != "" {
+		if s, err := loadSagaByKey(r.Context(), key); err == nil {
+			replaySaga(w, s)
+			return
+		} else if err != sql.ErrNoRows {
+			apierr.Internal(w, err)
+			return
+		}
+	}
+
+	exists, err := userExists(r, req.UserID)
+	if errors.Is(err, httpclient.ErrDependencyUnavailable) {
+		apierr.Write(w, apierr.DependencyUnavailable, err.Error())
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if !exists {
+		apierr.Write(w, apierr.UnknownUser, "User not found or deactivated")
+		return
+	}
+
+	s, err := startSaga(r.Context(), key, req)
+	if key != "" && pg.IsUniqueViolation(err) {
+		// Параллельный запрос с тем же ключом успел создать сагу первым;
+		// заказ этого запроса откатился вместе с транзакцией.
+		if s, err = loadSagaByKey(r.Context(), key); err == nil {
+			replaySaga(w, s)
+			return
+		}
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	// Отключение клиента не должно обрывать сагу на середине.
+	s.run(context.WithoutCancel(r.Context()))
+
+	status := http.StatusCreated
+	if s.State != sagaCompleted {
+		status = http.StatusUnprocessableEntity
+		if s.dependencyDown {
+			status = http.StatusServiceUnavailable
+		}
+	}
+	writeCheckoutResult(w, status, s)
+}
+
+func writeCheckoutResult(w http.ResponseWriter, status int, s *checkoutSaga) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(s.result())
+}
+
+// replaySaga отвечает на повтор с тем же Idempotency-Key: результатом
+// завершённой саги или idempotency_in_progress, пока её ведёт другой
+// запрос (или recovery job).
+func replaySaga(w http.ResponseWriter, s *checkoutSaga) {
+	if s.State != sagaCompleted && s.State != sagaCompensated {
+		apierr.Write(w, apierr.IdempotencyInProgress, "Checkout with this Idempotency-Key is still in progress")
+		return
+	}
+	writeCheckoutResult(w, http.StatusOK, s)
+}
+
+// startSaga создаёт заказ и запись саги в одной транзакции. Без
+// Idempotency-Key ключом служит id саги.
+func startSaga(ctx context.Context, key string, req CheckoutRequest) (*checkoutSaga, error) {
+	s := &checkoutSaga{
+		UserID:          req.UserID,
+		TotalAmount:     req.TotalAmount,
+		Currency:        req.Currency,
+		ShippingAddress: req.ShippingAddress,
+		PaymentMethod:   req.PaymentMethod,
+		State:           sagaOrderCreated,
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO orders (user_id, total_amount, currency, status, shipping_address) VALUES ($1, $2, $3, 'pending', $4) RETURNING id",
+		req.UserID, req.TotalAmount, req.Currency, req.ShippingAddress,
+	).Scan(&s.OrderID)
+	if err == nil {
+		err = recordOrderPlaced(tx, Order{
+			ID:              s.OrderID,
+			UserID:          req.UserID,
+			TotalAmount:     req.TotalAmount,
+			Currency:        req.Currency,
+			Status:          "pending",
+			ShippingAddress: req.ShippingAddress,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO checkout_sagas (idempotency_key, order_id, payment_method, state)
+		 VALUES (COALESCE(NULLIF($1, ''), gen_random_uuid()::text), $2, $3, $4) RETURNING id`,
+		key, s.OrderID, s.PaymentMethod, s.State,
+	).Scan(&s.ID)
+	if err != nil {
+		return nil, err
+	}
+	return s, tx.Commit()
+}
+
+// noRunningSaga — условие на строку orders: у заказа нет незавершённой
+// саги оформления. Такие заказы пакетные чистки (архив, bulk-delete,
+// retention) пропускают, чтобы не выбить строку саги из-под компенсации.
+const noRunningSaga = `NOT EXISTS (SELECT 1 FROM checkout_sagas s WHERE s.order_id = orders.id AND s.state NOT IN ('completed', 'compensated'))`
+
+const sagaSelect = `SELECT s.id, s.order_id, o.user_id, o.total_amount, o.currency, o.shipping_address, s.payment_method,
+	s.state, s.failed_step, s.error, s.payment_id, s.delivery_id
+	FROM checkout_sagas s JOIN orders o ON o.id = s.order_id `
+
+func scanSaga(row rowScanner) (*checkoutSaga, error) {
+	s := &checkoutSaga{}
+	err := row.Scan(&s.ID, &s.OrderID, &s.UserID, &s.TotalAmount, &s.Currency, &s.ShippingAddress, &s.PaymentMethod,
+		&s.State, &s.FailedStep, &s.Error, &s.PaymentID, &s.DeliveryID)
+	return s, err
+}
+
+func loadSagaByKey(ctx context.Context, key string) (*checkoutSaga, error) {
+	return scanSaga(db.QueryRowContext(ctx, sagaSelect+"WHERE s.idempotency_key = $1", key))
+}
+
+func (s *checkoutSaga) save(ctx context.Context) error {
+	_, err := db.ExecContext(ctx,
+		`UPDATE checkout_sagas SET state = $1, failed_step = $2, error = $3, payment_id = $4, delivery_id = $5, updated_at = NOW()
+		 WHERE id = $6`,
+		s.State, s.FailedStep, s.Error, s.PaymentID, s.DeliveryID, s.ID)
+	return err
+}
+
+// run выполняет оставшиеся шаги саги с текущего состояния. Если компенсация
+// не удалась, сага остаётся в compensating и её доделает recovery job.
+func (s *checkoutSaga) run(ctx context.Context) {
+	for {
+		var step string
+		var err error
+		switch s.State {
+		case sagaOrderCreated:
+			step, err = stepChargePayment, s.chargePayment(ctx)
+			if err == nil {
+				s.State = sagaPaymentCharged
+			}
+		case sagaPaymentCharged:
+			step, err = stepCreateDelivery, s.createDelivery(ctx)
+			if err == nil {
+				s.State = sagaDeliveryBooked
+			}
+		case sagaDeliveryBooked:
+			step, err = stepConfirmOrder, s.setOrderStatus(ctx, "confirmed")
+			if err == nil {
+				s.State = sagaCompleted
+			}
+		case sagaCompensating:
+			if err := s.compensate(ctx); err != nil {
+				log.Printf("⚠️ Saga %s compensation incomplete: %v", s.ID, err)
+				return
+			}
+			s.State = sagaCompensated
+		default:
+			return
+		}
+
+		if err != nil {
+			log.Printf("⚠️ Saga %s step %s failed: %v", s.ID, step, err)
+			s.State = sagaCompensating
+			s.FailedStep = sql.NullString{String: step, Valid: true}
+			s.Error = sql.NullString{String: err.Error(), Valid: true}
+			s.dependencyDown = errors.Is(err, httpclient.ErrDependencyUnavailable)
+		}
+		if err := s.save(ctx); err != nil {
+			log.Printf("⚠️ Saga %s state not saved: %v", s.ID, err)
+			return
+		}
+	}
+}
+
+func (s *checkoutSaga) chargePayment(ctx context.Context) error {
+	payment, err := paymentsClient.Create(ctx, clients.Payment{
+		OrderID:       s.OrderID,
+		Amount:        s.TotalAmount,
+		Currency:      s.Currency,
+		Status:        "completed",
+		PaymentMethod: s.PaymentMethod,
+	}, clients.CheckoutPaymentKey(s.ID))
+	if err != nil {
+		return err
+	}
+	s.PaymentID = &payment.ID
+	if payment.Status != "completed" {
+		return fmt.Errorf("payment %d is %s", payment.ID, payment.Status)
+	}
+	return nil
+}
+
+func (s *checkoutSaga) createDelivery(ctx context.Context) error {
+	delivery, err := deliveriesClient.Create(ctx, clients.Delivery{
+		OrderID: s.OrderID,
+		Address: s.ShippingAddress,
+		Status:  "pending",
+	}, s.ID+":delivery")
+	if err != nil {
+		return err
+	}
+	s.DeliveryID = &delivery.ID
+	return nil
+}
+
+// compensate откатывает выполненные шаги в обратном порядке. Каждая
+// компенсация идемпотентна, поэтому её безопасно повторять.
+func (s *checkoutSaga) compensate(ctx context.Context) error {
+	s.Compensations = nil
+	// Ответ на создание мог потеряться (таймаут, 5xx) уже после того, как
+	// сервис записал платёж или доставку. Повтор Create с тем же ключом
+	// идемпотентен и возвращает эту запись; если её не было, она создаётся
+	// и откатывается ниже вместе с остальным.
+	if s.DeliveryID == nil && s.FailedStep.String == stepCreateDelivery {
+		if err := s.createDelivery(ctx); s.DeliveryID == nil {
+			return err
+		}
+	}
+	if s.PaymentID == nil && s.FailedStep.String == stepChargePayment {
+		if err := s.chargePayment(ctx); s.PaymentID == nil {
+			return err
+		}
+	}
+	if s.DeliveryID != nil {
+		if _, err := deliveriesClient.SetStatus(ctx, *s.DeliveryID, "pending", "failed", s.ID+":delivery-cancel"); err != nil {
+			return err
+		}
+		s.Compensations = append(s.Compensations, "cancel_delivery")
+	}
+	if s.PaymentID != nil {
+		if _, err := paymentsClient.SetStatus(ctx, *s.PaymentID, "completed", "refunded", s.ID+":refund"); err != nil {
+			return err
+		}
+		s.Compensations = append(s.Compensations, "refund_payment")
+	}
+	if err := s.setOrderStatus(ctx, "cancelled"); err != nil {
+		return err
+	}
+	s.Compensations = append(s.Compensations, "cancel_order")
+	return nil
+}
+
+func (s *checkoutSaga) setOrderStatus(ctx context.Context, status string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var o Order
+	err = scanOrder(tx.QueryRowContext(ctx, "SELECT "+orderColumns+" FROM orders WHERE id = $1 FOR UPDATE", s.OrderID), &o)
+	if err != nil {
+		return err
+	}
+	if o.Status == status {
+		return nil
+	}
+
+	err = scanOrder(tx.QueryRowContext(ctx, "UPDATE orders SET status = $1, updated_at = NOW() WHERE id = $2 RETURNING "+orderColumns, status, s.OrderID), &o)
+	if err != nil {
+		return err
+	}
+	if err := recordStatusChange(tx, o); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	orderCache.Delete(ctx, strconv.Itoa(s.OrderID))
+	return nil
+}
+
+// startSagaRecovery периодически подбирает саги, зависшие в промежуточном
+// состоянии (например, после падения реплики), и доводит их до конца.
+func startSagaRecovery(ctx context.Context) {
+	if paymentsServiceURL == "" || deliveryServiceURL == "" {
+		return
+	}
+	interval, staleAfter := cfg.SagaRecoveryInterval, cfg.SagaStaleAfter
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				recoverSagas(ctx, staleAfter)
+			}
+		}
+	}()
+}
+
+func recoverSagas(ctx context.Context, staleAfter time.Duration) {
+	rows, err := db.QueryContext(ctx,
+		sagaSelect+`WHERE s.state NOT IN ('completed', 'compensated') AND s.updated_at < NOW() - $1::interval
+		 ORDER BY s.updated_at LIMIT 20`, fmt.Sprintf("%d seconds", int(staleAfter.Seconds())))
+	if err != nil {
+		log.Printf("⚠️ Saga recovery query failed: %v", err)
+		return
+	}
+	var stale []*checkoutSaga
+	for rows.Next() {
+		s, err := scanSaga(rows)
+		if err != nil {
+			rows.Close()
+			log.Printf("⚠️ Saga recovery scan failed: %v", err)
+			return
+		}
+		stale = append(stale, s)
+	}
+	rows.Close()
+
+	for _, s := range stale {
+		// Захват саги: другая реплика, обновившая её раньше, выиграет.
+		res, err := db.ExecContext(ctx,
+			"UPDATE checkout_sagas SET updated_at = NOW() WHERE id = $1 AND state = $2 AND updated_at < NOW() - $3::interval",
+			s.ID, s.State, fmt.Sprintf("%d seconds", int(staleAfter.Seconds())))
+		if err != nil {
+			continue
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		log.Printf("🔁 Resuming saga %s from state %s", s.ID, s.State)
+		s.run(ctx)
+	}
+}
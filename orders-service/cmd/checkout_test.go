@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"pkg/clients"
+	"pkg/flags"
+	"pkg/httpclient"
+)
+
+// stubDependencies подменяет payments-service и delivery-service сервером,
+// который отвечает успехом с задержкой, чтобы повторы застали сагу
+// незавершённой.
+func stubDependencies(t *testing.T) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		switch r.URL.Path {
+		case "/payments":
+			json.NewEncoder(w).Encode(clients.Payment{ID: 1, Status: "completed"})
+		case "/deliveries":
+			json.NewEncoder(w).Encode(clients.Delivery{ID: 1})
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	paymentsServiceURL, deliveryServiceURL = srv.URL, srv.URL
+	hc := httpclient.New(httpclient.ConfigFromEnv(), "payments-service", "delivery-service")
+	paymentsClient = clients.NewPayments(hc, srv.URL)
+	deliveriesClient = clients.NewDeliveries(hc, srv.URL)
+}
+
+// TestConcurrentCheckoutSameKey — из racers одновременных оформлений с
+// одним Idempotency-Key сагу и заказ создаёт ровно одно; остальные
+// получают её результат (200) или idempotency_in_progress (409), но не 500.
+// Нужна TEST_DATABASE_URL (см. locked_test.go).
+func TestConcurrentCheckoutSameKey(t *testing.T) {
+	openTestDB(t)
+	var err error
+	if featureFlags, err = flags.FromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	defaultCurrency = "RUB"
+	usersServiceURL = ""
+	stubDependencies(t)
+
+	key := "checkout-race-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	body := `{"user_id": 1, "total_amount": 10, "currency": "RUB", "shipping_address": "Checkout race", "payment_method": "card"}`
+	t.Cleanup(func() {
+		var orderID int
+		if db.QueryRow("SELECT order_id FROM checkout_sagas WHERE idempotency_key = $1", key).Scan(&orderID) == nil {
+			db.Exec("DELETE FROM checkout_sagas WHERE idempotency_key = $1", key)
+			db.Exec("DELETE FROM outbox_events WHERE aggregate_id = $1", orderID)
+			db.Exec("DELETE FROM orders WHERE id = $1", orderID)
+		}
+	})
+
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orders/checkout", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", key)
+		rec := httptest.NewRecorder()
+		checkout(rec, req)
+		return rec
+	}
+
+	codes := make([]int, racers)
+	sagas := make([]string, racers)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			rec := post()
+			var res CheckoutResult
+			json.NewDecoder(rec.Body).Decode(&res)
+			codes[i], sagas[i] = rec.Code, res.SagaID
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	var winner string
+	for i, code := range codes {
+		switch code {
+		case http.StatusCreated:
+			if winner != "" {
+				t.Fatalf("codes %v: more than one checkout created", codes)
+			}
+			winner = sagas[i]
+		case http.StatusOK, http.StatusConflict:
+		default:
+			t.Fatalf("codes %v: unexpected status %d", codes, code)
+		}
+	}
+	if winner == "" {
+		t.Fatalf("codes %v: no checkout created", codes)
+	}
+	for i, code := range codes {
+		if code == http.StatusOK && sagas[i] != winner {
+			t.Errorf("replay returned saga %s, want %s", sagas[i], winner)
+		}
+	}
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM orders WHERE shipping_address = 'Checkout race' AND created_at > NOW() - INTERVAL '1 minute'").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("orders created = %d, want 1", n)
+	}
+
+	// Сага завершена: повтор отдаёт её результат.
+	rec := post()
+	var res CheckoutResult
+	json.NewDecoder(rec.Body).Decode(&res)
+	if rec.Code != http.StatusOK || res.SagaID != winner || res.Status != sagaCompleted {
+		t.Errorf("replay after completion: %d %+v, want 200 with saga %s completed", rec.Code, res, winner)
+	}
+}
+
+// TestCompensationFindsPaymentWithLostResponse — payments-service записал
+// платёж, но ответ на создание потерян (500). Компенсация находит платёж
+// повтором Create с тем же ключом и возвращает деньги. Нужна
+// TEST_DATABASE_URL (см. locked_test.go).
+func TestCompensationFindsPaymentWithLostResponse(t *testing.T) {
+	openTestDB(t)
+	var err error
+	if featureFlags, err = flags.FromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	defaultCurrency = "RUB"
+	usersServiceURL = ""
+
+	var creates atomic.Int32
+	var refunded atomic.Bool
+	payment := clients.Payment{ID: 7, Status: "completed"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/payments":
+			if creates.Add(1) == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(payment)
+		case r.Method == http.MethodGet && r.URL.Path == "/payments/7":
+			json.NewEncoder(w).Encode(payment)
+		case r.Method == http.MethodPut && r.URL.Path == "/payments/7":
+			var p clients.Payment
+			json.NewDecoder(r.Body).Decode(&p)
+			refunded.Store(p.Status == "refunded")
+			json.NewEncoder(w).Encode(p)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	paymentsServiceURL, deliveryServiceURL = srv.URL, srv.URL
+	hc := httpclient.New(httpclient.Config{Breaker: httpclient.BreakerConfig{FailureThreshold: 100}}, "payments-service", "delivery-service")
+	paymentsClient = clients.NewPayments(hc, srv.URL)
+	deliveriesClient = clients.NewDeliveries(hc, srv.URL)
+
+	req := httptest.NewRequest(http.MethodPost, "/orders/checkout", strings.NewReader(
+		`{"user_id": 1, "total_amount": 10, "currency": "RUB", "shipping_address": "Lost response", "payment_method": "card"}`))
+	rec := httptest.NewRecorder()
+	checkout(rec, req)
+	var res CheckoutResult
+	json.NewDecoder(rec.Body).Decode(&res)
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM checkout_sagas WHERE id = $1", res.SagaID)
+		db.Exec("DELETE FROM outbox_events WHERE aggregate_id = $1", res.OrderID)
+		db.Exec("DELETE FROM orders WHERE id = $1", res.OrderID)
+	})
+
+	if res.Status != sagaCompensated {
+		t.Fatalf("saga %+v, want compensated", res)
+	}
+	if !refunded.Load() {
+		t.Errorf("payment with the lost response was not refunded; compensations %v", res.Compensations)
+	}
+}
+
+// TestDeleteOrderWithSaga — заказ с незавершённой сагой не удаляется
+// (409), с завершённой удаляется вместе со строкой саги. Нужна
+// TEST_DATABASE_URL (см. locked_test.go).
+func TestDeleteOrderWithSaga(t *testing.T) {
+	openTestDB(t)
+	paymentsServiceURL, deliveryServiceURL = "", ""
+
+	key := "delete-saga-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	s, err := startSaga(context.Background(), key, CheckoutRequest{
+		UserID: 1, TotalAmount: 10, Currency: "RUB", ShippingAddress: "Delete saga", PaymentMethod: "card"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM checkout_sagas WHERE id = $1", s.ID)
+		db.Exec("DELETE FROM outbox_events WHERE aggregate_id = $1", s.OrderID)
+		db.Exec("DELETE FROM orders WHERE id = $1", s.OrderID)
+	})
+
+	id := strconv.Itoa(s.OrderID)
+	del := func() int {
+		rec := httptest.NewRecorder()
+		deleteOrder(rec, mux.SetURLVars(httptest.NewRequest(http.MethodDelete, "/orders/"+id, nil), map[string]string{"id": id}))
+		return rec.Code
+	}
+
+	if code := del(); code != http.StatusConflict {
+		t.Fatalf("order with a running saga: status %d, want 409", code)
+	}
+	if _, err := db.Exec("UPDATE checkout_sagas SET state = 'compensated' WHERE id = $1", s.ID); err != nil {
+		t.Fatal(err)
+	}
+	if code := del(); code != http.StatusNoContent {
+		t.Fatalf("order with a finished saga: status %d, want 204", code)
+	}
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM checkout_sagas WHERE id = $1", s.ID).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Error("saga row left behind after the order was deleted")
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// setLastModified выставляет Last-Modified по updated_at заказа, чтобы
+// клиент мог вернуть его в If-Unmodified-Since.
+func setLastModified(w http.ResponseWriter, o Order) {
+	t, err := time.Parse(time.RFC3339Nano, o.UpdatedAt)
+	if err != nil {
+		return
+	}
+	w.Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+}
+
+// modifiedSince сообщает, что заказ менялся после момента из
+// If-Unmodified-Since. HTTP-даты имеют точность до секунды, поэтому
+// updated_at усекается до секунды. Без заголовка или с некорректной датой
+// условие не проверяется (RFC 9110, 13.1.4).
+func modifiedSince(r *http.Request, updatedAt time.Time) bool {
+	v := r.Header.Get("If-Unmodified-Since")
+	if v == "" {
+		return false
+	}
+	since, err := http.ParseTime(v)
+	if err != nil {
+		return false
+	}
+	return updatedAt.Truncate(time.Second).After(since)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"pkg/config"
+)
+
+// Config — конфигурация orders-service. Загружается и проверяется при
+// старте (config.MustLoad); -print-config выводит её и завершает процесс.
+type Config struct {
+	config.Common
+	config.HTTPClient
+	config.Consistency
+
+	Port        string `env:"PORT" default:"8002"`
+	DatabaseURL string `env:"DATABASE_URL" required:"true"`
+	// REDIS_URL, CACHE_TTL, CACHE_INVALIDATION и CACHE_LOCAL_TTL читает
+	// pkg/cache, DEFAULT_CURRENCY — pkg/currency, CHAOS_MAX_DURATION —
+	// pkg/chaos.
+	RedisURL          string        `env:"REDIS_URL" url:"true"`
+	CacheTTL          time.Duration `env:"CACHE_TTL" default:"60s"`
+	CacheInvalidation string        `env:"CACHE_INVALIDATION" default:"redis" oneof:"redis,postgres,off"`
+	CacheLocalTTL     time.Duration `env:"CACHE_LOCAL_TTL" default:"5s" min:"0s"`
+	DefaultCurrency   string        `env:"DEFAULT_CURRENCY" default:"RUB"`
+	ChaosMaxDuration  time.Duration `env:"CHAOS_MAX_DURATION" default:"1h" min:"1s"`
+
+	// Без URL сервиса вызовы к нему (и саги, которым он нужен) отключены.
+	UsersServiceURL    string `env:"USERS_SERVICE_URL" url:"true"`
+	PaymentsServiceURL string `env:"PAYMENTS_SERVICE_URL" url:"true"`
+	DeliveryServiceURL string `env:"DELIVERY_SERVICE_URL" url:"true"`
+	// Базовые URL для ссылок _links; относительные пути допустимы.
+	OrdersPublicURL   string `env:"ORDERS_PUBLIC_URL" default:"/api"`
+	PaymentsPublicURL string `env:"PAYMENTS_PUBLIC_URL" default:"/api"`
+	DeliveryPublicURL string `env:"DELIVERY_PUBLIC_URL" default:"/api"`
+
+	OutboxPushURL      string        `env:"OUTBOX_PUSH_URL" url:"true"`
+	UserEventsPushURL  string        `env:"USER_EVENTS_PUSH_URL" url:"true"`
+	OutboxPollInterval time.Duration `env:"OUTBOX_POLL_INTERVAL" default:"1s" min:"1ms"`
+	OutboxMaxAttempts  int           `env:"OUTBOX_MAX_ATTEMPTS" default:"5" min:"1"`
+	OutboxLease        time.Duration `env:"OUTBOX_LEASE" default:"5m" min:"1s"`
+	// Потолок паузы между попытками отправки события (пауза удваивается
+	// с каждой неудачей, начиная с OUTBOX_POLL_INTERVAL).
+	OutboxMaxBackoff time.Duration `env:"OUTBOX_MAX_BACKOFF" default:"5m" min:"1ms"`
+	// Куда отправлять order.force_deleted для payments-service.
+	PaymentsEventsPushURL string `env:"PAYMENTS_EVENTS_PUSH_URL" url:"true"`
+
+	OrderDuplicateWindow   time.Duration `env:"ORDER_DUPLICATE_WINDOW" default:"30s" min:"0s"`
+	MaxOpenOrdersPerUser   int           `env:"MAX_OPEN_ORDERS_PER_USER" default:"10" min:"0"`
+	MinOrderAmount         string        `env:"MIN_ORDER_AMOUNT"`
+	SagaRecoveryInterval   time.Duration `env:"SAGA_RECOVERY_INTERVAL" default:"30s" min:"1s"`
+	SagaStaleAfter         time.Duration `env:"SAGA_STALE_AFTER" default:"1m" min:"1s"`
+	WSMaxConnections       int64         `env:"WS_MAX_CONNECTIONS" default:"100" min:"1"`
+	WSAllowedOrigins       []string      `env:"WS_ALLOWED_ORIGINS"`
+	OrderWaitMaxTimeout    time.Duration `env:"ORDER_WAIT_MAX_TIMEOUT" default:"60s" min:"1s"`
+	OrderWaitMaxWaiters    int64         `env:"ORDER_WAIT_MAX_WAITERS" default:"1000" min:"1"`
+	DeliveryETATimeout     time.Duration `env:"DELIVERY_ETA_TIMEOUT" default:"300ms" min:"1ms"`
+	DeliveryETACacheTTL    time.Duration `env:"DELIVERY_ETA_CACHE_TTL" default:"15s" min:"1s"`
+	OrderRetention         time.Duration `env:"ORDER_RETENTION" default:"8760h" min:"1s"`
+	OrderRetentionEvery    time.Duration `env:"ORDER_RETENTION_INTERVAL" default:"24h" min:"1s"`
+	OrderRetentionDryRun   bool          `env:"ORDER_RETENTION_DRY_RUN"`
+	BulkDeleteCap          int           `env:"BULK_DELETE_CAP" default:"500" min:"1"`
+	ReadinessChecks        bool          `env:"READINESS_DEPENDENCY_CHECKS"`
+	ReadinessInterval      time.Duration `env:"READINESS_CHECK_INTERVAL" default:"15s" min:"1s"`
+	ReadinessCritical      []string      `env:"READINESS_CRITICAL_DEPENDENCIES"`
+	OutboxPendingThreshold int           `env:"OUTBOX_PENDING_THRESHOLD" default:"1000" min:"1"`
+
+	// Заказы с age_restricted: минимальный возраст покупателя (0 — без
+	// проверки) и что делать, если users-service недоступен: closed —
+	// отклонить с 503, open — создать без проверки возраста.
+	MinCustomerAge      int    `env:"MIN_CUSTOMER_AGE" default:"18" min:"0"`
+	AgeCheckFailureMode string `env:"AGE_CHECK_FAILURE_MODE" default:"closed" oneof:"closed,open"`
+
+	// Отложенные заказы: насколько вперёд можно назначить scheduled_for и
+	// как часто наступившие заказы переводятся в pending.
+	ScheduledOrderMaxAhead  time.Duration `env:"SCHEDULED_ORDER_MAX_AHEAD" default:"2160h" min:"24h"`
+	ScheduledOrdersInterval time.Duration `env:"SCHEDULED_ORDERS_INTERVAL" default:"1m" min:"1s"`
+
+	// Письма о смене статуса; SMTP_* читает pkg/mail, без SMTP_ADDR письма
+	// пишутся в лог.
+	OrderEmails              bool          `env:"ORDER_EMAILS" default:"true"`
+	NotificationPollInterval time.Duration `env:"NOTIFICATION_POLL_INTERVAL" default:"5s" min:"1ms"`
+	NotificationMaxAttempts  int           `env:"NOTIFICATION_MAX_ATTEMPTS" default:"5" min:"1"`
+	NotificationRetryDelay   time.Duration `env:"NOTIFICATION_RETRY_DELAY" default:"30s" min:"1ms"`
+	SMTPAddr                 string        `env:"SMTP_ADDR"`
+	SMTPFrom                 string        `env:"SMTP_FROM" default:"no-reply@localhost"`
+	SMTPUser                 string        `env:"SMTP_USER"`
+	SMTPPassword             string        `env:"SMTP_PASSWORD" secret:"true"`
+
+	// Сколько кэшируются настройки уведомлений пользователя; за это время
+	// их изменение вступает в силу.
+	NotificationPreferencesTTL time.Duration `env:"NOTIFICATION_PREFERENCES_TTL" default:"30s" min:"0s"`
+
+	// Ежедневная сводка: время рассылки (HH:MM, UTC) и адреса через запятую.
+	DigestTime       string   `env:"DIGEST_TIME" default:"07:00"`
+	DigestRecipients []string `env:"DIGEST_RECIPIENTS"`
+}
+
+func (c *Config) Validate() []error {
+	var errs []error
+	known := map[string]bool{"users-service": true, "payments-service": true, "delivery-service": true, outboxDependency: true}
+	for _, name := range c.ReadinessCritical {
+		if !known[name] {
+			errs = append(errs, fmt.Errorf("READINESS_CRITICAL_DEPENDENCIES: unknown dependency %q", name))
+		}
+	}
+	if _, err := time.Parse("15:04", c.DigestTime); err != nil {
+		errs = append(errs, fmt.Errorf("DIGEST_TIME: expected HH:MM, got %q", c.DigestTime))
+	}
+	if _, err := parseMinOrderAmount(c.MinOrderAmount); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+var cfg Config
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"pkg/consistency"
+)
+
+// orderUserMissing — заказ пользователя, которого нет в users-service.
+const orderUserMissing = "order_user_missing"
+
+var consistencyChecker *consistency.Checker
+
+// startConsistencyCheck проверяет user_id заказов по users-service
+// (GET /users?ids=); без USERS_SERVICE_URL проверять не с чем.
+func startConsistencyCheck(ctx context.Context) {
+	var checks []consistency.Check
+	if usersServiceURL != "" {
+		checks = append(checks, consistency.Check{
+			Type:   orderUserMissing,
+			Table:  "orders",
+			Column: "user_id",
+			Lookup: usersClient.Existing,
+		})
+	} else {
+		log.Printf("ℹ️ USERS_SERVICE_URL not set, order consistency check disabled")
+	}
+	consistencyChecker = consistency.New(db, cfg.Consistency, checks...)
+	consistencyChecker.Start(ctx)
+}
+
+// parseIDList разбирает список id через запятую, не длиннее max.
+func parseIDList(s string, max int) ([]int64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) > max {
+		return nil, fmt.Errorf("ids: at most %d ids per request", max)
+	}
+	ids := make([]int64, 0, len(parts))
+	for _, p := range parts {
+		id, err := strconv.ParseInt(strings.TrimSpace(p), 10, 64)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("ids: %q is not a valid id", p)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
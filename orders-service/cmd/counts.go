@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg/apierr"
+)
+
+// orderStatuses — статусы, которые всегда присутствуют в ответе
+// /orders/counts, даже с нулём.
+var orderStatuses = []string{"scheduled", "pending", "confirmed", "shipped", "delivered", "cancelled"}
+
+// OrderCounts — число заказов по статусам.
+type OrderCounts struct {
+	Counts map[string]int `json:"counts"`
+	Total  int            `json:"total"`
+}
+
+// @Summary Order counts by status
+// @Description Количество заказов по статусам одним запросом. Фильтры: user_id, from и to (RFC 3339 или YYYY-MM-DD, по created_at).
+// @Tags orders
+// @Produce json
+// @Param user_id query int false "User ID"
+// @Param from query string false "Начало периода (включительно)"
+// @Param to query string false "Конец периода (не включительно)"
+// @Success 200 {object} OrderCounts
+// @Failure 400 {object} map[string]string
+// @Router /orders/counts [get]
+func getOrderCounts(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	where := []string{"1=1"}
+	var args []interface{}
+	add := func(cond string, v interface{}) {
+		args = append(args, v)
+		where = append(where, strings.Replace(cond, "?", "$"+strconv.Itoa(len(args)), 1))
+	}
+
+	if v := q.Get("user_id"); v != "" {
+		userID, err := strconv.Atoi(v)
+		if err != nil {
+			apierr.Write(w, apierr.InvalidRequest, "user_id must be an integer")
+			return
+		}
+		add("user_id = ?", userID)
+	}
+	for _, f := range []struct{ param, cond string }{{"from", "created_at >= ?"}, {"to", "created_at < ?"}} {
+		v := q.Get(f.param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			if t, err = time.Parse("2006-01-02", v); err != nil {
+				apierr.Write(w, apierr.InvalidRequest, f.param+": expected RFC 3339 or YYYY-MM-DD")
+				return
+			}
+		}
+		add(f.cond, t)
+	}
+
+	rows, err := db.QueryContext(r.Context(),
+		"SELECT COALESCE(status, 'unknown'), COUNT(*) FROM orders WHERE "+strings.Join(where, " AND ")+" GROUP BY 1", args...)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	res := OrderCounts{Counts: make(map[string]int, len(orderStatuses))}
+	for _, s := range orderStatuses {
+		res.Counts[s] = 0
+	}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		res.Counts[status] = n
+		res.Total += n
+	}
+	if err := rows.Err(); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, max-age=5")
+	json.NewEncoder(w).Encode(res)
+}
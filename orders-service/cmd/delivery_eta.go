@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg/cache"
+)
+
+// deliveryETATimeout ограничивает вызов delivery-service при
+// GET /orders/{id}?include=delivery_eta (DELIVERY_ETA_TIMEOUT, по умолчанию 300ms).
+var deliveryETATimeout time.Duration
+
+// etaCache хранит ответ delivery-service недолго (DELIVERY_ETA_CACHE_TTL,
+// по умолчанию 15s): статус доставки меняется, но не каждую секунду.
+var etaCache *cache.Cache
+
+func initDeliveryETA() {
+	deliveryETATimeout = cfg.DeliveryETATimeout
+	etaCache = orderCache.Sub("orders-delivery-eta", cfg.DeliveryETACacheTTL)
+}
+
+// DeliveryETA — сведения о доставке заказа из delivery-service.
+type DeliveryETA struct {
+	DeliveryStatus    *string `json:"delivery_status"`
+	EstimatedDelivery *string `json:"estimated_delivery"`
+}
+
+// ResponseMeta — служебная часть ответа: предупреждения о частично
+// недоступных данных.
+type ResponseMeta struct {
+	Warnings []string `json:"warnings"`
+}
+
+// OrderDetail — заказ со ссылками и необязательными данными из других
+// сервисов. DeliveryETA заполняется только при include=delivery_eta.
+type OrderDetail struct {
+	Order
+	*DeliveryETA
+	Archived bool            `json:"archived,omitempty"`
+	Links    map[string]Link `json:"_links"`
+	Meta     *ResponseMeta   `json:"meta,omitempty"`
+}
+
+func wantsInclude(r *http.Request, name string) bool {
+	for _, v := range strings.Split(r.URL.Query().Get("include"), ",") {
+		if strings.TrimSpace(v) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// withDeliveryETA дополняет заказ статусом и ETA доставки. Ошибка
+// delivery-service не роняет запрос: поля остаются null, а причина
+// попадает в meta.warnings.
+func (d *OrderDetail) withDeliveryETA(ctx context.Context) {
+	eta, err := fetchDeliveryETA(ctx, d.ID)
+	d.DeliveryETA = &eta
+	if err != nil {
+		d.Meta = &ResponseMeta{Warnings: []string{"delivery_eta unavailable: " + err.Error()}}
+	}
+}
+
+func fetchDeliveryETA(ctx context.Context, orderID int) (DeliveryETA, error) {
+	var eta DeliveryETA
+	if deliveryServiceURL == "" {
+		return eta, fmt.Errorf("DELIVERY_SERVICE_URL not set")
+	}
+	key := strconv.Itoa(orderID)
+	if etaCache.Get(ctx, key, &eta) {
+		return eta, nil
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, deliveryETATimeout)
+	defer cancel()
+	deliveries, err := deliveriesClient.List(callCtx, url.Values{"order_id": {key}})
+	if err != nil {
+		return eta, err
+	}
+
+	// Заказ без доставки — не ошибка: оба поля остаются null.
+	if n := len(deliveries); n > 0 {
+		latest := deliveries[n-1]
+		eta = DeliveryETA{DeliveryStatus: &latest.Status, EstimatedDelivery: latest.EstimatedDelivery}
+	}
+	etaCache.Set(ctx, key, eta)
+	return eta, nil
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"pkg/apierr"
+	"pkg/mail"
+)
+
+// Ежедневная сводка для руководства: заказы, выручка и доля успешных
+// платежей, доставки и самые частые причины неудач за прошедшие сутки
+// (UTC). Каждый день в DIGEST_TIME (UTC, по умолчанию 07:00) одна реплика
+// собирает сводку из статистики orders-service (своя БД), payments-service
+// (GET /payments/stats) и delivery-service (GET /deliveries/stats),
+// сохраняет её в daily_digests и рассылает на DIGEST_RECIPIENTS. Если
+// сервис недоступен, его раздел помечается недоступным, а сводка всё равно
+// сохраняется и отправляется. Сохранённую сводку отдаёт GET
+// /reports/daily?date=, пересобрать её можно через POST
+// /admin/reports/daily/run?date=.
+
+// digestLockKey — ключ pg_advisory_lock, общий для всех реплик.
+const digestLockKey = 0x64676573 // "dges"
+
+const digestDateLayout = "2006-01-02"
+
+// digestTopReasons — сколько причин неудач попадает в сводку.
+const digestTopReasons = 5
+
+var errDigestBusy = errors.New("daily digest is being generated by another replica")
+
+var digestTemplate = template.Must(template.New("daily_digest.html").Funcs(template.FuncMap{
+	"percent": func(v float64) string { return fmt.Sprintf("%.1f%%", v*100) },
+}).ParseFS(notificationFS, "templates/daily_digest.html"))
+
+// DailyDigest — сводка за день. Раздел, данные которого получить не
+// удалось, равен null, а причина — в unavailable.
+type DailyDigest struct {
+	Date              string                `json:"date"`
+	GeneratedAt       time.Time             `json:"generated_at"`
+	Orders            *DigestOrders         `json:"orders"`
+	Payments          *DigestPayments       `json:"payments"`
+	Deliveries        *DigestDeliveries     `json:"deliveries"`
+	Unavailable       map[string]string     `json:"unavailable,omitempty"`
+	TopFailureReasons []DigestFailureReason `json:"top_failure_reasons"`
+	Recipients        []string              `json:"recipients"`
+	SentAt            *time.Time            `json:"sent_at,omitempty"`
+	SendError         string                `json:"send_error,omitempty"`
+}
+
+// DigestOrders — заказы, созданные за день.
+type DigestOrders struct {
+	Total    int            `json:"total"`
+	ByStatus map[string]int `json:"by_status"`
+}
+
+// DigestPayments — платежи, созданные за день. Выручка — сумма проведённых
+// платежей по валютам; success_rate — completed / (completed + failed),
+// null, если ни один платёж не завершился.
+type DigestPayments struct {
+	Revenue     map[string]float64 `json:"revenue"`
+	Completed   int                `json:"completed"`
+	Failed      int                `json:"failed"`
+	SuccessRate *float64           `json:"success_rate"`
+}
+
+// DigestDeliveries — доставки, завершённые и не удавшиеся за день.
+type DigestDeliveries struct {
+	Delivered int `json:"delivered"`
+	Failed    int `json:"failed"`
+}
+
+// DigestFailureReason — причина неудачи; source — payments или deliveries.
+type DigestFailureReason struct {
+	Source string `json:"source"`
+	Reason string `json:"reason"`
+	Count  int    `json:"count"`
+}
+
+type dailyDigest struct {
+	at         time.Duration
+	recipients []string
+	mailer     *mail.Sender
+	// lastDay — последний день, сводка за который уже есть; чтобы не
+	// ходить в БД каждую минуту.
+	lastDay string
+}
+
+var digest *dailyDigest
+
+func startDailyDigest(ctx context.Context) {
+	at, _ := time.Parse("15:04", cfg.DigestTime)
+	digest = &dailyDigest{
+		at:         time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute,
+		recipients: cfg.DigestRecipients,
+		mailer:     mail.FromEnv(),
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			now := time.Now().UTC()
+			today := now.Truncate(24 * time.Hour)
+			day := today.AddDate(0, 0, -1)
+			if now.Sub(today) < digest.at || digest.lastDay == day.Format(digestDateLayout) {
+				continue
+			}
+			if _, err := digest.run(ctx, day, false); err != nil && !errors.Is(err, errDigestBusy) && ctx.Err() == nil {
+				log.Printf("⚠️ Daily digest for %s failed: %v", day.Format(digestDateLayout), err)
+				continue
+			}
+			digest.lastDay = day.Format(digestDateLayout)
+		}
+	}()
+	log.Printf("📊 Daily digest scheduled at %s UTC for %d recipients", cfg.DigestTime, len(digest.recipients))
+}
+
+// run собирает, сохраняет и рассылает сводку за day. Без force уже
+// сохранённая сводка возвращается как есть. Сессионная advisory-блокировка
+// на выделенном соединении не даёт двум репликам собирать сводку
+// одновременно.
+func (j *dailyDigest) run(ctx context.Context, day time.Time, force bool) (*DailyDigest, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", digestLockKey).Scan(&locked); err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, errDigestBusy
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", digestLockKey)
+
+	date := day.Format(digestDateLayout)
+	if !force {
+		d, err := loadDigest(ctx, conn, date)
+		if err == nil {
+			return d, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+	}
+
+	d := buildDigest(ctx, day)
+	d.Recipients = j.recipients
+	body, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx,
+		`INSERT INTO daily_digests (date, digest) VALUES ($1, $2)
+		 ON CONFLICT (date) DO UPDATE SET digest = EXCLUDED.digest, sent_at = NULL, send_error = NULL, created_at = NOW()`,
+		date, body); err != nil {
+		return nil, err
+	}
+
+	if len(j.recipients) > 0 {
+		if err := j.send(d); err != nil {
+			d.SendError = err.Error()
+		} else {
+			now := time.Now().UTC()
+			d.SentAt = &now
+		}
+		if _, err := conn.ExecContext(ctx,
+			"UPDATE daily_digests SET sent_at = $2, send_error = NULLIF($3, '') WHERE date = $1",
+			date, d.SentAt, d.SendError); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("📊 Daily digest for %s generated (unavailable: %d, sent to %d)", date, len(d.Unavailable), len(j.recipients))
+	return d, nil
+}
+
+// send отправляет сводку каждому получателю; ошибки по адресам
+// собираются, неудача одного не отменяет остальных.
+func (j *dailyDigest) send(d *DailyDigest) error {
+	subject, body, err := renderDigest(d)
+	if err != nil {
+		return err
+	}
+	var failed []string
+	for _, to := range j.recipients {
+		if err := j.mailer.Send(mail.Message{To: to, Subject: subject, Body: body, HTML: true}); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", to, err))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func renderDigest(d *DailyDigest) (subject, body string, err error) {
+	var s, b bytes.Buffer
+	if err := digestTemplate.ExecuteTemplate(&s, "subject", d); err != nil {
+		return "", "", err
+	}
+	if err := digestTemplate.ExecuteTemplate(&b, "body", d); err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(s.String()), b.String(), nil
+}
+
+// buildDigest собирает сводку за сутки day (UTC). Ошибка источника
+// не прерывает сборку: раздел остаётся null, причина — в Unavailable.
+func buildDigest(ctx context.Context, day time.Time) *DailyDigest {
+	date := day.Format(digestDateLayout)
+	d := &DailyDigest{
+		Date:              date,
+		GeneratedAt:       time.Now().UTC(),
+		Unavailable:       map[string]string{},
+		TopFailureReasons: []DigestFailureReason{},
+	}
+
+	if orders, err := digestOrders(ctx, day); err != nil {
+		d.Unavailable["orders"] = err.Error()
+	} else {
+		d.Orders = orders
+	}
+
+	if cfg.PaymentsServiceURL == "" {
+		d.Unavailable["payments"] = "PAYMENTS_SERVICE_URL not set"
+	} else if stats, err := paymentsClient.Stats(ctx, date, date); err != nil {
+		d.Unavailable["payments"] = err.Error()
+	} else {
+		p := &DigestPayments{Revenue: map[string]float64{}}
+		for cur, cs := range stats.Currencies {
+			completed := cs.ByStatus["completed"]
+			if completed.Count > 0 {
+				p.Revenue[cur] = completed.Amount
+			}
+			p.Completed += completed.Count
+			p.Failed += cs.ByStatus["failed"].Count
+		}
+		if n := p.Completed + p.Failed; n > 0 {
+			rate := float64(p.Completed) / float64(n)
+			p.SuccessRate = &rate
+		}
+		d.Payments = p
+		for _, r := range stats.FailureReasons {
+			d.TopFailureReasons = append(d.TopFailureReasons, DigestFailureReason{Source: "payments", Reason: r.Reason, Count: r.Count})
+		}
+	}
+
+	if cfg.DeliveryServiceURL == "" {
+		d.Unavailable["deliveries"] = "DELIVERY_SERVICE_URL not set"
+	} else if stats, err := deliveriesClient.Stats(ctx, date, date); err != nil {
+		d.Unavailable["deliveries"] = err.Error()
+	} else {
+		d.Deliveries = &DigestDeliveries{Delivered: stats.Delivered, Failed: stats.Failed}
+		for _, r := range stats.FailureReasons {
+			d.TopFailureReasons = append(d.TopFailureReasons, DigestFailureReason{Source: "deliveries", Reason: r.Reason, Count: r.Count})
+		}
+	}
+
+	sort.SliceStable(d.TopFailureReasons, func(i, j int) bool {
+		return d.TopFailureReasons[i].Count > d.TopFailureReasons[j].Count
+	})
+	if len(d.TopFailureReasons) > digestTopReasons {
+		d.TopFailureReasons = d.TopFailureReasons[:digestTopReasons]
+	}
+	return d
+}
+
+// digestOrders — то же, что GET /orders/counts за сутки day.
+func digestOrders(ctx context.Context, day time.Time) (*DigestOrders, error) {
+	rows, err := db.QueryContext(ctx,
+		"SELECT COALESCE(status, 'unknown'), COUNT(*) FROM orders WHERE created_at >= $1 AND created_at < $2 GROUP BY 1",
+		day, day.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	o := &DigestOrders{ByStatus: make(map[string]int, len(orderStatuses))}
+	for _, s := range orderStatuses {
+		o.ByStatus[s] = 0
+	}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		o.ByStatus[status] = n
+		o.Total += n
+	}
+	return o, rows.Err()
+}
+
+func loadDigest(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}, date string) (*DailyDigest, error) {
+	var body []byte
+	var sentAt *time.Time
+	var sendError *string
+	err := q.QueryRowContext(ctx, "SELECT digest, sent_at, send_error FROM daily_digests WHERE date = $1", date).
+		Scan(&body, &sentAt, &sendError)
+	if err != nil {
+		return nil, err
+	}
+	var d DailyDigest
+	if err := json.Unmarshal(body, &d); err != nil {
+		return nil, err
+	}
+	d.SentAt = sentAt
+	if sendError != nil {
+		d.SendError = *sendError
+	}
+	return &d, nil
+}
+
+// digestDate — параметр date (YYYY-MM-DD); по умолчанию вчера (UTC).
+func digestDate(r *http.Request) (time.Time, error) {
+	v := r.URL.Query().Get("date")
+	if v == "" {
+		return time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1), nil
+	}
+	return time.Parse(digestDateLayout, v)
+}
+
+// @Summary Daily digest
+// @Description Сохранённая ежедневная сводка: заказы, выручка и доля успешных платежей, доставки, частые причины неудач. Раздел недоступного при сборке сервиса равен null, причина — в unavailable. Требует X-Internal-API-Key.
+// @Tags reports
+// @Produce json
+// @Param date query string false "День (YYYY-MM-DD, UTC), по умолчанию вчера"
+// @Success 200 {object} DailyDigest
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string "code: report_not_found"
+// @Router /reports/daily [get]
+func getDailyDigest(w http.ResponseWriter, r *http.Request) {
+	day, err := digestDate(r)
+	if err != nil {
+		apierr.Write(w, apierr.InvalidRequest, "date must be YYYY-MM-DD")
+		return
+	}
+	d, err := loadDigest(r.Context(), db, day.Format(digestDateLayout))
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.ReportNotFound, "No digest for "+day.Format(digestDateLayout))
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d)
+}
+
+// @Summary Generate daily digest
+// @Description Собрать сводку за день заново, сохранить и разослать на DIGEST_RECIPIENTS. 409, если сводку сейчас собирает другая реплика.
+// @Tags admin
+// @Produce json
+// @Param date query string false "День (YYYY-MM-DD, UTC), по умолчанию вчера"
+// @Success 200 {object} DailyDigest
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /admin/reports/daily/run [post]
+func runDailyDigest(w http.ResponseWriter, r *http.Request) {
+	day, err := digestDate(r)
+	if err != nil {
+		apierr.Write(w, apierr.InvalidRequest, "date must be YYYY-MM-DD")
+		return
+	}
+	d, err := digest.run(r.Context(), day, true)
+	if errors.Is(err, errDigestBusy) {
+		apierr.Write(w, apierr.Conflict, err.Error())
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d)
+}
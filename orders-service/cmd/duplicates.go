@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// duplicateWindow — окно, в котором одинаковый заказ считается двойным
+// нажатием (ORDER_DUPLICATE_WINDOW, по умолчанию 30s; 0 отключает проверку).
+var duplicateWindow time.Duration
+
+// lockUserOrders берёт транзакционную advisory-блокировку по user_id. Она
+// сериализует создание заказов одного пользователя до коммита, поэтому
+// проверки повтора и лимита открытых заказов не проходят одновременно у
+// двух параллельных запросов.
+func lockUserOrders(ctx context.Context, tx *sql.Tx, userID int) error {
+	_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('orders:create'), $1)", userID)
+	return err
+}
+
+// findDuplicateOrder ищет ожидающий заказ того же пользователя на ту же
+// сумму в той же валюте, созданный в пределах duplicateWindow. Вызывается
+// под lockUserOrders.
+func findDuplicateOrder(ctx context.Context, tx *sql.Tx, o Order) (Order, bool, error) {
+	var dup Order
+	if duplicateWindow == 0 {
+		return dup, false, nil
+	}
+
+	err := scanOrder(tx.QueryRowContext(ctx,
+		`SELECT `+orderColumns+` FROM orders
+		 WHERE user_id = $1 AND total_amount = $2 AND currency = $3 AND status = 'pending'
+		   AND created_at > NOW() - make_interval(secs => $4)
+		 ORDER BY id DESC LIMIT 1`,
+		o.UserID, o.TotalAmount, o.Currency, duplicateWindow.Seconds()), &dup)
+	if err == sql.ErrNoRows {
+		return dup, false, nil
+	}
+	return dup, err == nil, err
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"pkg/flags"
+)
+
+// TestConcurrentDuplicateCreatesOneOrder — из racers одинаковых
+// POST /orders, пришедших одновременно, заказ создаёт ровно один; остальные
+// получают 409 с этим же заказом. Нужна TEST_DATABASE_URL (см.
+// locked_test.go).
+func TestConcurrentDuplicateCreatesOneOrder(t *testing.T) {
+	openTestDB(t)
+	var err error
+	if featureFlags, err = flags.FromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	defaultCurrency = "RUB"
+	duplicateWindow = 30 * time.Second
+	usersServiceURL = ""
+
+	// Сумма уникальна для прогона, чтобы не совпасть с заказами других тестов.
+	amount := 1000 + float64(time.Now().UnixNano()%1000000)/100
+	body := `{"user_id": 1, "total_amount": ` + strconv.FormatFloat(amount, 'f', 2, 64) +
+		`, "currency": "RUB", "status": "pending", "shipping_address": "Duplicate test"}`
+
+	type result struct {
+		code int
+		id   int
+	}
+	results := make([]result, racers)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			rec := httptest.NewRecorder()
+			createOrder(rec, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body)))
+			var o struct {
+				ID int `json:"id"`
+			}
+			json.NewDecoder(rec.Body).Decode(&o)
+			results[i] = result{rec.Code, o.ID}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	t.Cleanup(func() {
+		for _, r := range results {
+			if r.code == http.StatusCreated {
+				db.Exec("DELETE FROM outbox_events WHERE aggregate_id = $1", r.id)
+				db.Exec("DELETE FROM orders WHERE id = $1", r.id)
+			}
+		}
+	})
+
+	created := 0
+	for _, r := range results {
+		switch r.code {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+		default:
+			t.Fatalf("results %v: unexpected status %d", results, r.code)
+		}
+		if r.id == 0 || r.id != results[0].id {
+			t.Fatalf("results %v: responses refer to different orders", results)
+		}
+	}
+	if created != 1 {
+		t.Fatalf("results %v: %d orders created, want 1", results, created)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"pkg/apierr"
+	"pkg/events"
+)
+
+// Заказы-подарки. is_gift и gift_message задаются при создании заказа.
+// Сумма подарка скрывается при сериализации events.OrderPayload, поэтому
+// всё, что уходит из orders-service в сторону доставки, строится через
+// orderPayload и показывает сумму только по явному WithPrice — в событиях
+// и письмах самому покупателю.
+
+// maxGiftMessageLength — предел gift_message в символах (VARCHAR(200)).
+const maxGiftMessageLength = 200
+
+// cleanGiftMessage убирает управляющие символы и схлопывает пробелы и
+// переводы строк: поздравление печатается на этикетке в одну строку с
+// переносами по словам.
+func cleanGiftMessage(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(s, ""))
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// applyGift готовит поля подарка нового заказа: gift_message очищается,
+// пустое сообщение не сохраняется, а непустое делает заказ подарком.
+// Возвращает нарушение для поля gift_message.
+func applyGift(o *Order) (apierr.Violation, bool) {
+	if o.GiftMessage == nil {
+		return apierr.Violation{}, false
+	}
+	msg := cleanGiftMessage(*o.GiftMessage)
+	if msg == "" {
+		o.GiftMessage = nil
+		return apierr.Violation{}, false
+	}
+	if len([]rune(msg)) > maxGiftMessageLength {
+		return apierr.Violation{Rule: apierr.RuleMaxLength, Limit: maxGiftMessageLength}, true
+	}
+	o.GiftMessage = &msg
+	o.IsGift = true
+	return apierr.Violation{}, false
+}
+
+// orderPayload — нагрузка событий заказа. Для подарка сумма при
+// сериализации опускается, пока не вызван WithPrice.
+func orderPayload(o Order) events.OrderPayload {
+	p := events.OrderPayload{
+		OrderID:         o.ID,
+		UserID:          o.UserID,
+		TotalAmount:     o.TotalAmount,
+		Currency:        o.Currency,
+		Status:          o.Status,
+		ShippingAddress: o.ShippingAddress,
+		AgeRestricted:   o.AgeRestricted,
+		IsGift:          o.IsGift,
+	}
+	if o.GiftMessage != nil {
+		p.GiftMessage = *o.GiftMessage
+	}
+	return p
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"pkg/apierr"
+)
+
+func TestApplyGift(t *testing.T) {
+	msg := "  С днём\r\nрождения!\x00\x07  "
+	o := Order{GiftMessage: &msg}
+	if _, bad := applyGift(&o); bad || !o.IsGift || *o.GiftMessage != "С днём рождения!" {
+		t.Errorf("cleaned %q, is_gift %t", *o.GiftMessage, o.IsGift)
+	}
+
+	blank := " \n "
+	o = Order{GiftMessage: &blank}
+	if _, bad := applyGift(&o); bad || o.IsGift || o.GiftMessage != nil {
+		t.Errorf("blank message: %+v", o)
+	}
+
+	long := strings.Repeat("я", maxGiftMessageLength+1)
+	o = Order{IsGift: true, GiftMessage: &long}
+	if v, bad := applyGift(&o); !bad || v.Rule != apierr.RuleMaxLength {
+		t.Errorf("long message: %+v", v)
+	}
+}
+
+// TestGiftOutboxPayload — событие подарка для delivery-service не содержит
+// суммы, для users-service (история покупателя) — содержит.
+func TestGiftOutboxPayload(t *testing.T) {
+	msg := "Поздравляю!"
+	o := Order{ID: 3, TotalAmount: 4990, Currency: "RUB", IsGift: true, GiftMessage: &msg}
+
+	toDelivery, _ := json.Marshal(orderPayload(o))
+	if strings.Contains(string(toDelivery), "4990") || !strings.Contains(string(toDelivery), msg) {
+		t.Errorf("delivery payload: %s", toDelivery)
+	}
+	toBuyer, _ := json.Marshal(orderPayload(o).WithPrice())
+	if !strings.Contains(string(toBuyer), "4990") {
+		t.Errorf("buyer payload: %s", toBuyer)
+	}
+}
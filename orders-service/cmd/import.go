@@ -0,0 +1,430 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg/apierr"
+	"pkg/audit"
+	"pkg/currency"
+	"pkg/httpclient"
+)
+
+const (
+	// importBatchSize — строк файла в одной транзакции; вместе с ними
+	// фиксируется и номер последней строки.
+	importBatchSize = 500
+	// importUserLookup — id в одном запросе GET /users?ids=.
+	importUserLookup = 100
+	// maxImportErrors — ошибок строк в ответе; остальные только считаются.
+	maxImportErrors = 1000
+	// importLockClass — первый ключ pg_advisory_lock(int, int) импорта,
+	// второй — hashtext(import_id).
+	importLockClass = 0x6f696d70 // "oimp"
+)
+
+var importIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,100}$`)
+
+// importColumns — колонки CSV: обязательные и необязательные.
+var (
+	importRequired = []string{"user_id", "total_amount", "status", "created_at"}
+	importOptional = []string{"currency", "shipping_address"}
+)
+
+// ImportRowError — строка файла, которая не импортирована.
+type ImportRowError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// ImportResult — итог загрузки. Imported, Failed и Skipped — за этот
+// запрос, Total* — за все загрузки с этим import_id.
+type ImportResult struct {
+	ImportID string `json:"import_id"`
+	// LastLine — последняя зафиксированная строка файла (заголовок — 1).
+	LastLine        int              `json:"last_line"`
+	Imported        int              `json:"imported"`
+	Failed          int              `json:"failed"`
+	Skipped         int              `json:"skipped"`
+	TotalImported   int              `json:"total_imported"`
+	TotalFailed     int              `json:"total_failed"`
+	Errors          []ImportRowError `json:"errors"`
+	ErrorsTruncated bool             `json:"errors_truncated,omitempty"`
+}
+
+type importRow struct {
+	line      int
+	order     Order
+	createdAt time.Time
+}
+
+// orderImport — одна загрузка файла. Строки копятся в batch и
+// записываются вместе с last_line в одной транзакции, поэтому после
+// обрыва каждая строка либо импортирована и учтена, либо нет.
+type orderImport struct {
+	conn        *sql.Conn
+	verifyUsers bool
+	columns     map[string]int
+	res         ImportResult
+
+	batch         []importRow
+	batchLastLine int
+	batchFailed   int
+}
+
+// @Summary Import orders from CSV
+// @Description Импорт заказов из старой системы: multipart-поле file, CSV с заголовком user_id,total_amount,status,created_at (необязательно currency, shipping_address). Файл читается потоком и записывается пачками по 500 строк; created_at сохраняется из файла. Номер последней записанной строки хранится под import_id: повторная загрузка того же файла с тем же import_id пропускает уже записанные строки. verify_users=true проверяет пользователей в users-service. Ошибочные строки не импортируются и перечисляются в ответе (первые 1000). Заказы импортируются без событий и уведомлений. Требует X-Internal-API-Key.
+// @Tags orders
+// @Accept multipart/form-data
+// @Produce json
+// @Param import_id query string true "Id загрузки для продолжения: буквы, цифры, . _ -, до 100 символов"
+// @Param verify_users query bool false "Проверить user_id в users-service"
+// @Param file formData file true "CSV с заказами"
+// @Success 200 {object} ImportResult
+// @Failure 400 {object} map[string]interface{} "Ошибка формата файла; last_line — до какой строки записано"
+// @Failure 409 {object} map[string]string "Загрузка с этим import_id уже идёт"
+// @Failure 415 {object} map[string]string
+// @Failure 503 {object} map[string]interface{} "users-service недоступен; last_line — до какой строки записано"
+// @Router /orders/import [post]
+func importOrders(w http.ResponseWriter, r *http.Request) {
+	importID := r.URL.Query().Get("import_id")
+	if !importIDPattern.MatchString(importID) {
+		apierr.Write(w, apierr.InvalidRequest, "import_id is required: 1-100 letters, digits, '.', '_' or '-'")
+		return
+	}
+	imp := &orderImport{res: ImportResult{ImportID: importID, Errors: []ImportRowError{}}}
+	if v := r.URL.Query().Get("verify_users"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			apierr.Write(w, apierr.InvalidRequest, "verify_users must be a boolean")
+			return
+		}
+		imp.verifyUsers = b && usersServiceURL != ""
+	}
+
+	file, err := importFile(r)
+	if err != nil {
+		apierr.Respond(w, err)
+		return
+	}
+	hash := sha256.New()
+	body := io.TeeReader(file, hash)
+
+	conn, err := db.Conn(r.Context())
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer conn.Close()
+	imp.conn = conn
+
+	var locked bool
+	if err := conn.QueryRowContext(r.Context(), "SELECT pg_try_advisory_lock($1, hashtext($2))", importLockClass, importID).Scan(&locked); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if !locked {
+		apierr.Write(w, apierr.AlreadyRunning, "Import "+importID+" is already running")
+		return
+	}
+	defer conn.ExecContext(context.WithoutCancel(r.Context()), "SELECT pg_advisory_unlock($1, hashtext($2))", importLockClass, importID)
+
+	err = conn.QueryRowContext(r.Context(),
+		`INSERT INTO order_imports (id, actor) VALUES ($1, $2)
+		 ON CONFLICT (id) DO UPDATE SET updated_at = NOW()
+		 RETURNING last_line, imported, failed`,
+		importID, audit.Actor(r)).Scan(&imp.res.LastLine, &imp.res.TotalImported, &imp.res.TotalFailed)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if imp.res.LastLine > 0 {
+		log.Printf("▶️ Order import %s resumes after line %d", importID, imp.res.LastLine)
+	}
+
+	if err := imp.run(r.Context(), body); err != nil {
+		var e *apierr.Error
+		if errors.As(err, &e) {
+			apierr.Respond(w, e.With("last_line", imp.res.LastLine))
+			return
+		}
+		apierr.Internal(w, err)
+		return
+	}
+
+	sum := hash.Sum(nil)
+	if err := audit.Record(r.Context(), db, audit.Entry{
+		Actor:        audit.Actor(r),
+		Action:       "POST /orders/import",
+		ResourceType: "orders",
+		ResourceID:   importID,
+		BodySHA256:   hex.EncodeToString(sum),
+	}); err != nil {
+		log.Printf("⚠️ Audit write failed for order import %s: %v", importID, err)
+	}
+	log.Printf("📥 Order import %s: %d imported, %d failed, %d skipped, last line %d",
+		importID, imp.res.Imported, imp.res.Failed, imp.res.Skipped, imp.res.LastLine)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(imp.res)
+}
+
+// importFile возвращает поле file multipart-тела, не читая его.
+func importFile(r *http.Request) (io.Reader, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, apierr.New(apierr.UnsupportedMediaType, "expected multipart/form-data with a file field")
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, apierr.New(apierr.InvalidRequest, "file field is required")
+		}
+		if err != nil {
+			return nil, apierr.New(apierr.InvalidRequest, err.Error())
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+	}
+}
+
+// run читает CSV до конца. Строки до res.LastLine включительно записаны
+// прошлыми загрузками и пропускаются.
+func (imp *orderImport) run(ctx context.Context, body io.Reader) error {
+	cr := csv.NewReader(body)
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return apierr.New(apierr.InvalidRequest, "file is empty")
+	}
+	if err != nil {
+		return apierr.New(apierr.InvalidRequest, err.Error())
+	}
+	if imp.columns, err = importHeader(header); err != nil {
+		return apierr.New(apierr.InvalidRequest, err.Error())
+	}
+	imp.batchLastLine = imp.res.LastLine
+
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+			// Дальше файл не разобрать: записываем то, что до ошибки.
+			if ferr := imp.flush(ctx); ferr != nil {
+				return ferr
+			}
+			e := apierr.New(apierr.InvalidRequest, err.Error())
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				e = e.With("line", parseErr.StartLine)
+			}
+			return e
+		}
+		line, _ := cr.FieldPos(0)
+		if line <= imp.res.LastLine {
+			imp.res.Skipped++
+			continue
+		}
+
+		imp.batchLastLine = line
+		if err != nil {
+			imp.fail(line, "expected "+strconv.Itoa(len(header))+" fields")
+		} else if o, createdAt, err := parseImportRow(rec, imp.columns, time.Now()); err != nil {
+			imp.fail(line, err.Error())
+		} else {
+			imp.batch = append(imp.batch, importRow{line: line, order: o, createdAt: createdAt})
+		}
+		if len(imp.batch)+imp.batchFailed >= importBatchSize {
+			if err := imp.flush(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return imp.flush(ctx)
+}
+
+func (imp *orderImport) fail(line int, msg string) {
+	imp.batchFailed++
+	if len(imp.res.Errors) < maxImportErrors {
+		imp.res.Errors = append(imp.res.Errors, ImportRowError{Line: line, Error: msg})
+	} else {
+		imp.res.ErrorsTruncated = true
+	}
+}
+
+// flush проверяет пользователей пачки и в одной транзакции вставляет её
+// заказы и сдвигает last_line.
+func (imp *orderImport) flush(ctx context.Context) error {
+	if imp.batchLastLine == imp.res.LastLine {
+		return nil
+	}
+	if imp.verifyUsers {
+		if err := imp.checkUsers(ctx); err != nil {
+			return err
+		}
+	}
+
+	tx, err := imp.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for i := range imp.batch {
+		if err := insertImportedOrder(ctx, tx, &imp.batch[i].order, imp.batch[i].createdAt); err != nil {
+			return fmt.Errorf("line %d: %w", imp.batch[i].line, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE order_imports SET last_line = $2, imported = imported + $3, failed = failed + $4, updated_at = NOW()
+		 WHERE id = $1`,
+		imp.res.ImportID, imp.batchLastLine, len(imp.batch), imp.batchFailed); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	imp.res.LastLine = imp.batchLastLine
+	imp.res.Imported += len(imp.batch)
+	imp.res.Failed += imp.batchFailed
+	imp.res.TotalImported += len(imp.batch)
+	imp.res.TotalFailed += imp.batchFailed
+	imp.batch, imp.batchFailed = imp.batch[:0], 0
+	return nil
+}
+
+// checkUsers убирает из пачки заказы пользователей, которых нет в
+// users-service. Деактивированные пользователи допустимы: заказы старые.
+func (imp *orderImport) checkUsers(ctx context.Context) error {
+	var ids []int
+	for _, row := range imp.batch {
+		if !slices.Contains(ids, row.order.UserID) {
+			ids = append(ids, row.order.UserID)
+		}
+	}
+	found := make(map[int]bool, len(ids))
+	for start := 0; start < len(ids); start += importUserLookup {
+		chunk := ids[start:min(start+importUserLookup, len(ids))]
+		list := make([]string, len(chunk))
+		for i, id := range chunk {
+			list[i] = strconv.Itoa(id)
+		}
+		users, err := usersClient.List(ctx, url.Values{"ids": {strings.Join(list, ",")}})
+		if errors.Is(err, httpclient.ErrDependencyUnavailable) {
+			return apierr.New(apierr.DependencyUnavailable, err.Error())
+		} else if err != nil {
+			return err
+		}
+		for _, u := range users {
+			found[u.ID] = true
+		}
+	}
+
+	kept := imp.batch[:0]
+	for _, row := range imp.batch {
+		if found[row.order.UserID] {
+			kept = append(kept, row)
+		} else {
+			imp.fail(row.line, "user "+strconv.Itoa(row.order.UserID)+" not found")
+		}
+	}
+	imp.batch = kept
+	return nil
+}
+
+// importHeader — номера колонок по заголовку CSV.
+func importHeader(header []string) (map[string]int, error) {
+	cols := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !slices.Contains(importRequired, name) && !slices.Contains(importOptional, name) {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		if _, dup := cols[name]; dup {
+			return nil, fmt.Errorf("duplicate column %q", name)
+		}
+		cols[name] = i
+	}
+	for _, name := range importRequired {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+	return cols, nil
+}
+
+// importTimeLayouts — форматы created_at; без зоны время считается UTC.
+var importTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+// parseImportRow проверяет строку CSV и собирает из неё заказ.
+func parseImportRow(rec []string, cols map[string]int, now time.Time) (Order, time.Time, error) {
+	field := func(name string) string {
+		if i, ok := cols[name]; ok {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	var o Order
+	userID, err := strconv.Atoi(field("user_id"))
+	if err != nil || userID <= 0 {
+		return o, time.Time{}, fmt.Errorf("user_id: %q is not a valid id", field("user_id"))
+	}
+	amount, err := strconv.ParseFloat(field("total_amount"), 64)
+	// DECIMAL(10, 2) вмещает суммы до 99 999 999.99.
+	if err != nil || math.IsNaN(amount) || amount <= 0 || amount >= 1e8 {
+		return o, time.Time{}, fmt.Errorf("total_amount: %q must be a positive amount below 100000000", field("total_amount"))
+	}
+	status := field("status")
+	if !slices.Contains(orderStatuses, status) {
+		return o, time.Time{}, fmt.Errorf("status: %q must be one of %s", status, strings.Join(orderStatuses, ", "))
+	}
+	// Без scheduled_for отложенный заказ никогда не перешёл бы в pending.
+	if status == "scheduled" {
+		return o, time.Time{}, fmt.Errorf("status: scheduled orders cannot be imported")
+	}
+	var createdAt time.Time
+	for _, layout := range importTimeLayouts {
+		if createdAt, err = time.Parse(layout, field("created_at")); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return o, time.Time{}, fmt.Errorf("created_at: %q is not RFC 3339, YYYY-MM-DD HH:MM:SS or YYYY-MM-DD", field("created_at"))
+	}
+	if createdAt.After(now) {
+		return o, time.Time{}, fmt.Errorf("created_at: %s is in the future", field("created_at"))
+	}
+	cur := currency.Normalize(field("currency"))
+	if cur == "" {
+		cur = defaultCurrency
+	} else if !currency.Valid(cur) {
+		return o, time.Time{}, fmt.Errorf("currency: %q is not supported", field("currency"))
+	}
+	address := field("shipping_address")
+	if len(address) > 500 {
+		return o, time.Time{}, errors.New("shipping_address: longer than 500 characters")
+	}
+
+	o = Order{UserID: userID, TotalAmount: amount, Currency: cur, Status: status, ShippingAddress: address}
+	return o, createdAt.UTC(), nil
+}
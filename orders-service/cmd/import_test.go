@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportHeader(t *testing.T) {
+	cols, err := importHeader([]string{"\ufeffcreated_at", "User_ID ", "status", "total_amount", "currency"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cols["user_id"] != 1 || cols["created_at"] != 0 || cols["currency"] != 4 {
+		t.Errorf("columns = %v", cols)
+	}
+
+	for _, header := range [][]string{
+		{"user_id", "total_amount", "status"},                          // нет created_at
+		{"user_id", "total_amount", "status", "created_at", "items"},   // неизвестная колонка
+		{"user_id", "total_amount", "status", "created_at", "user_id"}, // повтор
+	} {
+		if _, err := importHeader(header); err == nil {
+			t.Errorf("header %v accepted", header)
+		}
+	}
+}
+
+func TestParseImportRow(t *testing.T) {
+	defaultCurrency = "RUB"
+	cols, _ := importHeader([]string{"user_id", "total_amount", "status", "created_at", "shipping_address"})
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	o, created, err := parseImportRow([]string{"42", "199.90", "delivered", "2019-03-04 10:20:30", " Lenina 1 "}, cols, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.UserID != 42 || o.TotalAmount != 199.9 || o.Status != "delivered" || o.Currency != "RUB" || o.ShippingAddress != "Lenina 1" {
+		t.Errorf("order = %+v", o)
+	}
+	// Исходная дата сохраняется, время без зоны — UTC.
+	if want := time.Date(2019, 3, 4, 10, 20, 30, 0, time.UTC); !created.Equal(want) {
+		t.Errorf("created_at = %s, want %s", created, want)
+	}
+
+	for _, tc := range []struct {
+		row  []string
+		want string
+	}{
+		{[]string{"x", "10", "pending", "2020-01-01", ""}, "user_id"},
+		{[]string{"1", "0", "pending", "2020-01-01", ""}, "total_amount"},
+		{[]string{"1", "100000000", "pending", "2020-01-01", ""}, "total_amount"},
+		{[]string{"1", "10", "created", "2020-01-01", ""}, "status"},
+		{[]string{"1", "10", "pending", "01/02/2020", ""}, "created_at"},
+		{[]string{"1", "10", "pending", "2027-01-01", ""}, "future"},
+		{[]string{"1", "10", "pending", "2020-01-01", strings.Repeat("a", 501)}, "shipping_address"},
+	} {
+		if _, _, err := parseImportRow(tc.row, cols, now); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("row %v: err = %v, want mention of %q", tc.row, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Внешние базовые URL сервисов для ссылок _links. По умолчанию — пути за
+// api-gateway; переопределяются ORDERS_PUBLIC_URL, PAYMENTS_PUBLIC_URL и
+// DELIVERY_PUBLIC_URL.
+var (
+	ordersPublicURL   string
+	paymentsPublicURL string
+	deliveryPublicURL string
+)
+
+func initLinks() {
+	ordersPublicURL = strings.TrimSuffix(cfg.OrdersPublicURL, "/")
+	paymentsPublicURL = strings.TrimSuffix(cfg.PaymentsPublicURL, "/")
+	deliveryPublicURL = strings.TrimSuffix(cfg.DeliveryPublicURL, "/")
+}
+
+// Link — ссылка на связанный ресурс или действие. Method указывается для
+// действий, отличных от GET.
+type Link struct {
+	Href   string `json:"href"`
+	Method string `json:"method,omitempty"`
+}
+
+// cancellableStatuses — статусы, из которых заказ ещё можно отменить.
+var cancellableStatuses = map[string]bool{"scheduled": true, "pending": true, "confirmed": true}
+
+// orderLinks строит _links заказа. Ссылки на недоступные сейчас действия
+// не включаются, чтобы клиент мог ориентироваться на их наличие.
+func orderLinks(o Order) map[string]Link {
+	self := fmt.Sprintf("%s/orders/%d", ordersPublicURL, o.ID)
+	links := map[string]Link{
+		"self":     {Href: self},
+		"items":    {Href: self + "/items"},
+		"history":  {Href: self + "/history"},
+		"payment":  {Href: fmt.Sprintf("%s/payments?order_id=%d", paymentsPublicURL, o.ID)},
+		"delivery": {Href: fmt.Sprintf("%s/deliveries?order_id=%d", deliveryPublicURL, o.ID)},
+	}
+	// Отмена — PATCH {"status": "cancelled"}: PUT заменил бы заказ целиком.
+	if cancellableStatuses[o.Status] {
+		links["cancel"] = Link{Href: self, Method: http.MethodPatch}
+	}
+	return links
+}
+
+func orderDetail(o Order) OrderDetail {
+	return OrderDetail{Order: o, Links: orderLinks(o)}
+}
+
+// setPageLinks ставит заголовок Link (RFC 8288) со ссылками self, next и
+// prev на страницы GET /orders. Тело списка остаётся массивом; next есть,
+// только если страница заполнена целиком.
+func setPageLinks(w http.ResponseWriter, r *http.Request, offset, n int) {
+	page := func(offset int) string {
+		q := r.URL.Query()
+		q.Del("offset")
+		if offset > 0 {
+			q.Set("offset", strconv.Itoa(offset))
+		}
+		href := ordersPublicURL + "/orders"
+		if len(q) > 0 {
+			href += "?" + q.Encode()
+		}
+		return href
+	}
+	links := []string{fmt.Sprintf(`<%s>; rel="self"`, page(offset))}
+	if n == ordersPageSize {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, page(offset+ordersPageSize)))
+	}
+	if offset > 0 {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, page(max(offset-ordersPageSize, 0))))
+	}
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOrderLinks(t *testing.T) {
+	ordersPublicURL, paymentsPublicURL, deliveryPublicURL = "/api/orders-service", "/api/payments-service", "/api/delivery-service"
+
+	links := orderLinks(Order{ID: 7, Status: "pending"})
+	want := map[string]Link{
+		"self":     {Href: "/api/orders-service/orders/7"},
+		"items":    {Href: "/api/orders-service/orders/7/items"},
+		"history":  {Href: "/api/orders-service/orders/7/history"},
+		"payment":  {Href: "/api/payments-service/payments?order_id=7"},
+		"delivery": {Href: "/api/delivery-service/deliveries?order_id=7"},
+		"cancel":   {Href: "/api/orders-service/orders/7", Method: http.MethodPatch},
+	}
+	for rel, l := range want {
+		if links[rel] != l {
+			t.Errorf("%s: %+v, want %+v", rel, links[rel], l)
+		}
+	}
+	if len(links) != len(want) {
+		t.Errorf("links %v, want %d entries", links, len(want))
+	}
+
+	if _, ok := orderLinks(Order{ID: 7, Status: "delivered"})["cancel"]; ok {
+		t.Error("cancel link on a delivered order")
+	}
+}
+
+func TestSetPageLinks(t *testing.T) {
+	ordersPublicURL = "/api/orders-service"
+	cases := []struct {
+		target string
+		offset int
+		n      int
+		want   string
+	}{
+		{"/orders", 0, 3, `</api/orders-service/orders>; rel="self"`},
+		{"/orders", 0, ordersPageSize,
+			`</api/orders-service/orders>; rel="self", </api/orders-service/orders?offset=100>; rel="next"`},
+		{"/orders?tag=vip&offset=150", 150, ordersPageSize,
+			`</api/orders-service/orders?offset=150&tag=vip>; rel="self", </api/orders-service/orders?offset=250&tag=vip>; rel="next", </api/orders-service/orders?offset=50&tag=vip>; rel="prev"`},
+		{"/orders?offset=100", 100, 0,
+			`</api/orders-service/orders?offset=100>; rel="self", </api/orders-service/orders>; rel="prev"`},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		setPageLinks(rec, httptest.NewRequest(http.MethodGet, c.target, nil), c.offset, c.n)
+		if got := rec.Header().Get("Link"); got != c.want {
+			t.Errorf("%s (%d rows):\n got %s\nwant %s", c.target, c.n, got, c.want)
+		}
+	}
+}
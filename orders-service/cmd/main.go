@@ -1,29 +1,83 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
-	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	httpSwagger "github.com/swaggo/http-swagger"
-	_ "orders-service/docs"
+	"orders-service/docs"
+	"pkg/admin"
+	"pkg/apierr"
+	"pkg/audit"
+	"pkg/auth"
+	"pkg/cache"
+	"pkg/chaos"
+	"pkg/clients"
+	"pkg/config"
+	"pkg/currency"
+	"pkg/dbhealth"
+	"pkg/deadletter"
+	"pkg/events"
+	"pkg/flags"
+	"pkg/hmacsign"
+	"pkg/httpclient"
+	"pkg/limit"
+	"pkg/mode"
+	"pkg/mtls"
+	"pkg/observe"
+	"pkg/pg"
+	"pkg/pgnotify"
+	"pkg/ratelimit"
+	"pkg/replica"
+	"pkg/seed"
+	"pkg/specvalidate"
 )
 
 var db *sql.DB
+
+// dbWatch следит за соединением с БД; пока его нет, запросы получают 503.
+var dbWatch *dbhealth.Watchdog
+var serviceMode *mode.Switch
+var featureFlags *flags.Set
+var faults *chaos.Injector
 var replicaID string
+var defaultCurrency string
+var usersServiceURL string
+var services *httpclient.Client
+
+// Клиенты других сервисов поверх services.
+var (
+	usersClient      *clients.Users
+	paymentsClient   *clients.Payments
+	deliveriesClient *clients.Deliveries
+)
+var orderCache *cache.Cache
+var orderFeed *pgnotify.Feed
+
+// Order — общий контракт с клиентами (pkg/clients).
+type Order = clients.Order
+
+// orderColumns — порядок колонок, который ожидает scanOrder.
+const orderColumns = "id, user_id, total_amount, currency, status, shipping_address, tags, age_restricted, scheduled_for, is_gift, gift_message, created_at, updated_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
 
-type Order struct {
-	ID          int     `json:"id"`
-	UserID      int     `json:"user_id" validate:"required"`
-	TotalAmount float64 `json:"total_amount" validate:"required,gt=0"`
-	Status      string  `json:"status" validate:"required,oneof=pending confirmed shipped delivered cancelled"`
-	CreatedAt   string  `json:"createdAt"`
-	UpdatedAt   string  `json:"updatedAt"`
+func scanOrder(row rowScanner, o *Order) error {
+	return row.Scan(&o.ID, &o.UserID, &o.TotalAmount, &o.Currency, &o.Status, &o.ShippingAddress, pg.Array(&o.Tags), &o.AgeRestricted, &o.ScheduledFor, &o.IsGift, &o.GiftMessage, &o.CreatedAt, &o.UpdatedAt)
 }
 
 type SystemInfo struct {
@@ -37,18 +91,11 @@ type SystemInfo struct {
 // @host localhost:8002
 // @BasePath /
 func main() {
-	databaseURL := os.Getenv("DATABASE_URL")
-	if databaseURL == "" {
-		log.Fatal("DATABASE_URL not set")
-	}
-
-	replicaID = os.Getenv("REPLICA_ID")
-	if replicaID == "" {
-		replicaID = "default"
-	}
+	config.MustLoad("orders-service", &cfg)
+	replicaID = replica.ID()
 
 	var err error
-	db, err = sql.Open("postgres", databaseURL)
+	db, err = sql.Open(observe.DriverName, cfg.DatabaseURL)
 	if err != nil {
 		log.Fatalf("DB connection error: %v", err)
 	}
@@ -58,27 +105,169 @@ func main() {
 		log.Fatalf("DB ping error: %v", err)
 	}
 	log.Printf("✅ Connected to PostgreSQL (orders-service - %s)", replicaID)
+	// Ошибки ограничений БД — 409/422/503 вместо 500.
+	apierr.SetTranslator(pg.APIError)
+	dbWatch = dbhealth.FromEnv(db)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8002"
+	internalTLS, err := mtls.Load(mtls.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("mTLS config error: %v", err)
 	}
+	internalTLS.WatchSIGHUP()
+
+	serviceMode, err = mode.FromEnv()
+	if err != nil {
+		log.Fatalf("Service mode config error: %v", err)
+	}
+	featureFlags, err = flags.FromEnv()
+	if err != nil {
+		log.Fatalf("Feature flags config error: %v", err)
+	}
+	featureFlags.Watch()
+	specValidator, err := specvalidate.FromEnv(docs.SwaggerInfo.ReadDoc())
+	if err != nil {
+		log.Fatalf("OpenAPI validation config error: %v", err)
+	}
+	defaultCurrency, err = currency.DefaultFromEnv()
+	if err != nil {
+		log.Fatalf("Currency config error: %v", err)
+	}
+	if err := initMinOrderAmount(); err != nil {
+		log.Fatalf("Minimum order amount config error: %v", err)
+	}
+	faults = chaos.FromEnv()
+
+	port := cfg.Port
+
+	usersServiceURL = cfg.UsersServiceURL
+	paymentsServiceURL = cfg.PaymentsServiceURL
+	deliveryServiceURL = cfg.DeliveryServiceURL
+	duplicateWindow = cfg.OrderDuplicateWindow
+	maxOpenOrders = cfg.MaxOpenOrdersPerUser
+	signer, err := hmacsign.SignerFromEnv()
+	if err != nil {
+		log.Fatalf("HMAC signing config error: %v", err)
+	}
+	clientCfg := httpclient.ConfigFromEnv()
+	clientCfg.TLS = internalTLS
+	clientCfg.Signer = signer
+	services = httpclient.New(clientCfg, "users-service", "payments-service", "delivery-service")
+	usersClient = clients.NewUsers(services, usersServiceURL, clients.WithAPIKey(cfg.InternalAPIKey))
+	paymentsClient = clients.NewPayments(services, paymentsServiceURL)
+	deliveriesClient = clients.NewDeliveries(services, deliveryServiceURL)
+	deadLetters = deadletter.NewStore(db, services)
+
+	orderCache, err = cache.FromEnv("orders")
+	if err != nil {
+		log.Fatalf("Redis config error: %v", err)
+	}
+	defer orderCache.Close()
+	initDeliveryETA()
+	initLinks()
+
+	initOrderStream()
+	orderFeed = pgnotify.NewFeed(orderStatusChannel)
+	if err := orderFeed.Listen(cfg.DatabaseURL); err != nil {
+		log.Printf("⚠️ LISTEN %s failed: %v", orderStatusChannel, err)
+	}
+
+	workers, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	dbWatch.Start(workers)
+	// Реплики держат заказы и в памяти; изменение на одной удаляет их у всех.
+	if err := orderCache.Listen(workers, db, cfg.DatabaseURL); err != nil {
+		log.Fatalf("Cache config error: %v", err)
+	}
+	startOutboxDispatcher(workers)
+	startSagaRecovery(workers)
+	startOrderRetention(workers)
+	startConsistencyCheck(workers)
+	startNotifications(workers)
+	startDailyDigest(workers)
+	startDependencyChecks(workers)
+	startScheduledPromoter(workers)
+
+	limiter := limit.FromEnv()
+	rateLimiter, err := ratelimit.FromEnv("orders")
+	if err != nil {
+		log.Fatalf("Rate limit config error: %v", err)
+	}
+	defer rateLimiter.Close()
 
 	router := mux.NewRouter()
+	router.Use(apierr.Localize)
+	router.Use(observe.Middleware())
+	router.Use(limiter.Middleware)
+	router.Use(dbWatch.Middleware("/orders/{id}"))
+	router.Use(auth.Middleware())
+	router.Use(rateLimiter.Middleware)
+	router.Use(audit.Middleware(db, "/admin/", "/dead-letters/", "/orders/archive", "/orders/bulk-delete"))
+	router.Use(serviceMode.Middleware)
+	router.Use(specValidator.Middleware)
+	router.Use(faults.Middleware)
 	router.HandleFunc("/health", healthCheck).Methods("GET")
+	router.HandleFunc("/ready", readyCheck).Methods("GET")
+	router.HandleFunc("/health/ready", readyCheck).Methods("GET")
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	router.HandleFunc("/errors/catalog", apierr.CatalogHandler).Methods("GET")
+	router.HandleFunc("/admin/mode", admin.RequireKey(serviceMode.Handler)).Methods("POST")
+	router.HandleFunc("/admin/concurrency", admin.RequireKey(limiter.Handler)).Methods("GET", "PUT")
+	router.HandleFunc("/admin/rate-limits/users/{id}", admin.RequireKey(rateLimiter.Handler)).Methods("GET", "PUT", "DELETE")
+	router.HandleFunc("/admin/flags", admin.RequireKey(featureFlags.Handler)).Methods("GET")
+	router.HandleFunc("/admin/seed", admin.RequireKey(seed.Handler(insertSeed))).Methods("POST")
+	router.HandleFunc("/admin/audit", admin.RequireKey(audit.Handler(db))).Methods("GET")
+	router.HandleFunc("/admin/chaos", admin.RequireKey(faults.Handler)).Methods("POST", "DELETE")
+	router.HandleFunc("/admin/retention/run", admin.RequireKey(runRetention)).Methods("POST")
+	router.HandleFunc("/admin/inconsistencies", admin.RequireKey(consistencyChecker.ListHandler)).Methods("GET")
+	router.HandleFunc("/admin/inconsistencies/check", admin.RequireKey(consistencyChecker.RunHandler)).Methods("POST")
+	router.HandleFunc("/admin/reports/daily/run", admin.RequireKey(runDailyDigest)).Methods("POST")
+	router.HandleFunc("/reports/daily", admin.RequireKey(getDailyDigest)).Methods("GET")
 	router.HandleFunc("/system-id", getSystemID).Methods("GET")
 	router.HandleFunc("/orders", getOrders).Methods("GET")
+	router.HandleFunc("/orders/counts", getOrderCounts).Methods("GET")
+	router.HandleFunc("/orders/config", getOrderConfig).Methods("GET")
 	router.HandleFunc("/orders/{id}", getOrder).Methods("GET")
 	router.HandleFunc("/orders", createOrder).Methods("POST")
+	router.HandleFunc("/orders/checkout", checkout).Methods("POST")
+	router.HandleFunc("/orders/archive", admin.RequireKey(archiveOrders)).Methods("POST")
+	router.HandleFunc("/orders/bulk-delete", admin.RequireKey(bulkDeleteOrders)).Methods("POST")
+	router.HandleFunc("/orders/import", admin.RequireKey(importOrders)).Methods("POST")
 	router.HandleFunc("/orders/{id}", updateOrder).Methods("PUT")
+	router.HandleFunc("/orders/{id}", patchOrder).Methods("PATCH")
 	router.HandleFunc("/orders/{id}", deleteOrder).Methods("DELETE")
-	
+	router.HandleFunc("/orders/{id}/items", getOrderItems).Methods("GET")
+	router.HandleFunc("/orders/{id}/recalculate", recalculateOrder).Methods("POST")
+	router.HandleFunc("/orders/{id}/verify-total", verifyOrderTotal).Methods("GET")
+	router.HandleFunc("/orders/{id}/history", getOrderHistory).Methods("GET")
+	router.HandleFunc("/orders/{id}/ws", streamOrderStatus).Methods("GET")
+	router.HandleFunc("/orders/{id}/wait", waitOrderStatus).Methods("GET")
+	router.HandleFunc("/orders/{id}/payment-completed", internalTLS.RequireClientCert(paymentCompleted)).Methods("POST")
+	router.HandleFunc("/dead-letters", internalTLS.RequireClientCert(admin.RequireKey(listDeadLetters))).Methods("GET")
+	router.HandleFunc("/dead-letters/{id}/replay", internalTLS.RequireClientCert(admin.RequireKey(replayDeadLetter))).Methods("POST")
+
 	router.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
 
-	log.Printf("🚀 Orders Service (%s) started on port %s", replicaID, port)
-	log.Printf("📚 Swagger UI: http://localhost:%s/swagger/index.html", port)
-	if err := http.ListenAndServe(":"+port, router); err != nil {
-		log.Fatalf("Server error: %v", err)
+	srv := &http.Server{Addr: ":" + port, Handler: replica.Middleware(router)}
+	srv.RegisterOnShutdown(orderFeed.Close)
+
+	go func() {
+		log.Printf("🚀 Orders Service (%s) started on port %s", replicaID, port)
+		log.Printf("📚 Swagger UI: http://localhost:%s/swagger/index.html", port)
+		if err := internalTLS.ListenAndServe(srv); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server error: %v", err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	log.Printf("🛑 Shutting down Orders Service (%s)", replicaID)
+	stopWorkers()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Shutdown error: %v", err)
 	}
 }
 
@@ -86,11 +275,46 @@ func main() {
 // @Description Проверка состояния сервиса
 // @Tags health
 // @Produce json
-// @Success 200 {object} map[string]string
+// @Success 200 {object} map[string]interface{}
 // @Router /health [get]
 func healthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "healthy", "replica_id": replicaID})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":       "healthy",
+		"mode":         serviceMode.Get(),
+		"replica_id":   replicaID,
+		"database":     dbWatch.Status(),
+		"dependencies": services.BreakerStates(),
+		"chaos":        faults.Active(),
+	})
+}
+
+// @Summary Readiness check
+// @Description Готовность реплики принимать трафик: доступна БД (по фоновым проверкам DB_WATCHDOG_*, а не на каждый запрос) и не включён эксперимент chaos с unready. С READINESS_DEPENDENCY_CHECKS=true в ответе также закешированные фоновые проверки users-, payments-, delivery-service и очереди outbox: отказ некритичной зависимости даёт status degraded (200), критичной — unready (503).
+// @Tags health
+// @Produce json
+// @Success 200 {object} ReadinessReport
+// @Failure 503 {object} ReadinessReport
+// @Router /ready [get]
+// @Router /health/ready [get]
+func readyCheck(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	report := ReadinessReport{Status: "ready", ReplicaID: replicaID}
+	if dependencies != nil {
+		report.Dependencies, report.Status = dependencies.snapshot()
+		if report.Status == "unready" {
+			report.Reason = "dependency"
+		}
+	}
+	if !faults.Ready() {
+		report.Status, report.Reason = "unready", "chaos"
+	} else if !dbWatch.Up() {
+		report.Status, report.Reason = "unready", "database"
+	}
+	if report.Status == "unready" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
 }
 
 // @Summary Get system ID
@@ -108,29 +332,72 @@ func getSystemID(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary Get all orders
-// @Description Получить список всех заказов
+// @Description Получить список заказов страницами по 100 (offset). Повторяющийся параметр tag оставляет заказы, у которых есть все указанные метки. scheduled_before — отложенные заказы для планирования. ids — заказы по списку id (до 100), рабочие и архивные; удалённых в ответе нет.
 // @Tags orders
 // @Produce json
+// @Param tag query []string false "Метка заказа" collectionFormat(multi)
+// @Param archived query bool false "Искать в архиве заказов"
+// @Param scheduled_before query string false "Только отложенные заказы (status scheduled) с scheduled_for раньше этого времени, RFC 3339; ближайшие первыми"
+// @Param ids query string false "id заказов через запятую, до 100; не сочетается с другими фильтрами"
+// @Param offset query int false "Сдвиг страницы (по 100 заказов); ссылки на соседние страницы — в заголовке Link"
 // @Success 200 {array} Order
+// @Header 200 {string} Link "RFC 8288: rel=self, next (если страница полная), prev (если offset > 0); без ids"
+// @Failure 400 {object} map[string]string
 // @Router /orders [get]
 func getOrders(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query("SELECT id, user_id, total_amount, status, created_at, updated_at FROM orders ORDER BY id LIMIT 100")
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	tags := r.URL.Query()["tag"]
+	for i := range tags {
+		tags[i] = strings.ToLower(strings.TrimSpace(tags[i]))
+	}
+	archived := r.URL.Query().Get("archived") == "true"
+	if v := r.URL.Query().Get("ids"); v != "" {
+		if len(tags) > 0 || archived || r.URL.Query().Get("scheduled_before") != "" || r.URL.Query().Get("offset") != "" {
+			apierr.Write(w, apierr.InvalidRequest, "ids cannot be combined with other filters")
+			return
+		}
+		ids, err := parseIDList(v, clients.MaxLookupIDs)
+		if err != nil {
+			apierr.Write(w, apierr.InvalidRequest, err.Error())
+			return
+		}
+		orders, err := listOrdersByIDs(r.Context(), ids)
+		if err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(orders)
 		return
 	}
-	defer rows.Close()
-
-	var orders []Order
-	for rows.Next() {
-		var o Order
-		if err := rows.Scan(&o.ID, &o.UserID, &o.TotalAmount, &o.Status, &o.CreatedAt, &o.UpdatedAt); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+	var scheduledBefore *time.Time
+	if v := r.URL.Query().Get("scheduled_before"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			apierr.Write(w, apierr.InvalidRequest, "scheduled_before: expected RFC 3339")
+			return
+		}
+		if archived {
+			apierr.Write(w, apierr.InvalidRequest, "scheduled_before cannot be combined with archived")
+			return
+		}
+		scheduledBefore = &t
+	}
+	offset := 0
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			apierr.Write(w, apierr.InvalidRequest, "offset must be a non-negative integer")
 			return
 		}
-		orders = append(orders, o)
+		offset = n
+	}
+	orders, err := listOrders(r.Context(), archived, tags, scheduledBefore, offset)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
 	}
 
+	setPageLinks(w, r, offset, len(orders))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(orders)
 }
@@ -140,7 +407,8 @@ func getOrders(w http.ResponseWriter, r *http.Request) {
 // @Tags orders
 // @Produce json
 // @Param id path int true "Order ID"
-// @Success 200 {object} Order
+// @Param include query string false "delivery_eta — добавить delivery_status и estimated_delivery из delivery-service"
+// @Success 200 {object} OrderDetail
 // @Failure 404 {object} map[string]string
 // @Router /orders/{id} [get]
 func getOrder(w http.ResponseWriter, r *http.Request) {
@@ -148,61 +416,200 @@ func getOrder(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(vars["id"])
 
 	var o Order
-	err := db.QueryRow("SELECT id, user_id, total_amount, status, created_at, updated_at FROM orders WHERE id = $1", id).
-		Scan(&o.ID, &o.UserID, &o.TotalAmount, &o.Status, &o.CreatedAt, &o.UpdatedAt)
+	archived := false
+	if !orderCache.Get(r.Context(), strconv.Itoa(id), &o) {
+		// Без БД заказ отдаётся только из кэша.
+		if !dbWatch.Up() {
+			dbWatch.Unavailable(w)
+			return
+		}
+		// Метка берётся до чтения: если заказ изменят, пока идёт чтение,
+		// устаревшая версия в кэш не попадёт.
+		stamp, stamped := orderCache.Stamp(r.Context(), strconv.Itoa(id))
+		var err error
+		o, err = findOrder(r.Context(), id)
+		if err == sql.ErrNoRows {
+			// Заказа нет в рабочей таблице — возможно, он перенесён в архив.
+			o, err = loadArchivedOrder(r.Context(), id)
+			archived = err == nil
+		} else if err == nil && stamped {
+			orderCache.SetIfUnchanged(r.Context(), strconv.Itoa(id), o, stamp)
+		}
 
-	if err == sql.ErrNoRows {
-		http.Error(w, "Order not found", http.StatusNotFound)
-		return
-	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		if err == sql.ErrNoRows {
+			apierr.Write(w, apierr.OrderNotFound, "Order not found")
+			return
+		} else if err != nil {
+			apierr.Internal(w, err)
+			return
+		}
 	}
 
+	d := orderDetail(o)
+	d.Archived = archived
+	if wantsInclude(r, "delivery_eta") {
+		d.withDeliveryETA(r.Context())
+	}
+	setLastModified(w, o)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(o)
+	json.NewEncoder(w).Encode(d)
 }
 
 // @Summary Create order
-// @Description Создать новый заказ
+// @Description Создать новый заказ. Заказ с scheduled_for (в будущем, не дальше SCHEDULED_ORDER_MAX_AHEAD) создаётся в статусе scheduled и переходит в pending в назначенное время; события по нему ставятся тогда же. Для заказа с age_restricted возраст покупателя проверяется в users-service (MIN_CUSTOMER_AGE), решение пишется в историю заказа. Заказ с is_gift (или gift_message до 200 символов, управляющие символы удаляются) — подарок: в событиях для delivery-service нет суммы, поздравление печатается на этикетке; оба поля задаются только при создании.
 // @Tags orders
 // @Accept json
 // @Produce json
 // @Param order body Order true "Order data"
-// @Success 201 {object} Order
+// @Param allow_duplicate query bool false "Не проверять повтор заказа (ORDER_DUPLICATE_WINDOW)"
+// @Param bypass_quota query bool false "Не проверять MAX_OPEN_ORDERS_PER_USER (только с X-Internal-API-Key)"
+// @Param bypass_min_amount query bool false "Не проверять MIN_ORDER_AMOUNT (только с X-Internal-API-Key)"
+// @Success 201 {object} OrderDetail
 // @Failure 400 {object} map[string]string
+// @Failure 409 {object} Order "Повтор заказа; при превышении лимита — {code: open_order_limit_reached}"
+// @Failure 422 {object} map[string]interface{} "Ошибки полей; сумма меньше минимальной — {code: order_amount_below_minimum}; покупатель младше MIN_CUSTOMER_AGE — {code: age_requirement_not_met}"
+// @Failure 503 {object} map[string]string "Недоступен users-service (для age_restricted — при AGE_CHECK_FAILURE_MODE=closed)"
 // @Router /orders [post]
 func createOrder(w http.ResponseWriter, r *http.Request) {
 	var o Order
 	if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	if featureFlags.EnabledFor("strict_order_validation", strconv.Itoa(o.UserID), false) &&
+		(o.TotalAmount <= 0 || strings.TrimSpace(o.ShippingAddress) == "") {
+		apierr.Write(w, apierr.InvalidRequest, "total_amount must be positive and shipping_address is required")
+		return
+	}
+
+	tags, fieldErrs := normalizeTags(o.Tags)
+	if o.Currency = currency.Normalize(o.Currency); o.Currency == "" {
+		o.Currency = defaultCurrency
+	} else if !currency.Valid(o.Currency) {
+		if fieldErrs == nil {
+			fieldErrs = map[string]apierr.Violation{}
+		}
+		fieldErrs["currency"] = apierr.Violation{Rule: apierr.RuleUnsupported}
+	}
+	if v, bad := applyGift(&o); bad {
+		if fieldErrs == nil {
+			fieldErrs = map[string]apierr.Violation{}
+		}
+		fieldErrs["gift_message"] = v
+	}
+	if v, bad := applySchedule(&o, time.Now()); bad {
+		if fieldErrs == nil {
+			fieldErrs = map[string]apierr.Violation{}
+		}
+		fieldErrs["scheduled_for"] = v
+	}
+	if fieldErrs != nil {
+		writeFieldErrors(w, fieldErrs)
+		return
+	}
+	o.Tags = tags
+	if err := checkMinOrderAmount(r, o.TotalAmount, o.Currency); err != nil {
+		apierr.Respond(w, err)
 		return
 	}
 
-	err := db.QueryRow(
-		"INSERT INTO orders (user_id, total_amount, status) VALUES ($1, $2, $3) RETURNING id, created_at, updated_at",
-		o.UserID, o.TotalAmount, o.Status,
-	).Scan(&o.ID, &o.CreatedAt, &o.UpdatedAt)
+	exists, err := userExists(r, o.UserID)
+	if errors.Is(err, httpclient.ErrDependencyUnavailable) {
+		apierr.Write(w, apierr.DependencyUnavailable, err.Error())
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if !exists {
+		apierr.Write(w, apierr.UnknownUser, "User not found or deactivated")
+		return
+	}
+	var ageCheck ageDecision
+	if o.AgeRestricted {
+		if ageCheck, err = checkCustomerAge(r, o.UserID); err != nil {
+			rejectAgeRestricted(w, r, o.UserID, ageCheck, err)
+			return
+		}
+	}
 
+	tx, err := db.BeginTx(r.Context(), nil)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := lockUserOrders(r.Context(), tx, o.UserID); err != nil {
+		apierr.Internal(w, err)
 		return
 	}
+	// Лимит открытых заказов снимается только явным флагом и только для
+	// запросов с внутренним API-ключом.
+	if maxOpenOrders > 0 && !(r.URL.Query().Get("bypass_quota") == "true" && admin.HasKey(r)) {
+		open, err := countOpenOrders(r.Context(), tx, o.UserID)
+		if err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		if open >= maxOpenOrders {
+			writeOpenOrderLimit(w, open)
+			return
+		}
+	}
+
+	if r.URL.Query().Get("allow_duplicate") != "true" {
+		dup, found, err := findDuplicateOrder(r.Context(), tx, o)
+		if err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		if found {
+			log.Printf("⚠️ Duplicate order for user %d rejected (existing order %d)", o.UserID, dup.ID)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(dup)
+			return
+		}
+	}
+
+	err = insertOrder(r.Context(), tx, &o)
+	if err == nil && o.AgeRestricted {
+		err = recordOrderHistory(r, tx, o.ID, o.UserID, ageCheck)
+	}
+	// Для отложенного заказа order.placed ставится при переходе в pending.
+	if err == nil && o.Status != "scheduled" {
+		err = recordOrderPlaced(tx, o)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	orderCache.Delete(r.Context(), strconv.Itoa(o.ID))
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(o)
+	json.NewEncoder(w).Encode(orderDetail(o))
 }
 
 // @Summary Update order
-// @Description Обновить данные заказа
+// @Description Обновить данные заказа. Отложенный заказ (scheduled) можно перенести (scheduled_for) или отменить, но не перевести в другой статус; после перехода в pending scheduled_for не меняется.
 // @Tags orders
 // @Accept json
 // @Produce json
 // @Param id path int true "Order ID"
 // @Param order body Order true "Order data"
-// @Success 200 {object} Order
+// @Param If-Unmodified-Since header string false "Обновить, только если заказ не менялся после этой даты (значение Last-Modified)"
+// @Param bypass_min_amount query bool false "Не проверять MIN_ORDER_AMOUNT при смене суммы (только с X-Internal-API-Key)"
+// @Success 200 {object} OrderDetail
 // @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "Запрещённый переход из scheduled или в него; смена scheduled_for после перехода в pending"
+// @Failure 412 {object} map[string]string
+// @Failure 422 {object} map[string]interface{} "Ошибки полей; новая сумма меньше минимальной — {code: order_amount_below_minimum}"
+// @Failure 503 {object} map[string]string "Конкурирующее изменение той же записи; запрос можно повторить"
 // @Router /orders/{id} [put]
 func updateOrder(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -210,49 +617,194 @@ func updateOrder(w http.ResponseWriter, r *http.Request) {
 
 	var o Order
 	if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
 		return
 	}
+	// Без поля tags метки заказа не меняются.
+	if o.Tags != nil {
+		tags, fieldErrs := normalizeTags(o.Tags)
+		if fieldErrs != nil {
+			writeFieldErrors(w, fieldErrs)
+			return
+		}
+		o.Tags = tags
+	}
+
+	saveOrder(w, r, id, func(context.Context, *sql.Tx) (Order, error) { return o, nil })
+}
 
-	err := db.QueryRow(
-		"UPDATE orders SET user_id=$1, total_amount=$2, status=$3, updated_at=NOW() WHERE id=$4 RETURNING id, user_id, total_amount, status, created_at, updated_at",
-		o.UserID, o.TotalAmount, o.Status, id,
-	).Scan(&o.ID, &o.UserID, &o.TotalAmount, &o.Status, &o.CreatedAt, &o.UpdatedAt)
+// saveOrder записывает заказ, который строит next, с проверками PUT:
+// If-Unmodified-Since, неизменная валюта, переходы scheduled, минимальная
+// сумма. next вызывается под блокировкой строки (и заново при повторе
+// транзакции), поэтому видит текущую версию заказа.
+func saveOrder(w http.ResponseWriter, r *http.Request, id int, next func(context.Context, *sql.Tx) (Order, error)) {
+	// Строка заблокирована до конца транзакции, поэтому проверка
+	// If-Unmodified-Since не может устареть до UPDATE, а смену статуса при
+	// параллельных запросах фиксирует ровно один из них.
+	var o Order
+	err := pg.Locked(r.Context(), db, func(tx *sql.Tx) error {
+		var oldStatus, oldCurrency string
+		var oldAmount float64
+		var updatedAt time.Time
+		var oldScheduledFor *time.Time
+		err := tx.QueryRowContext(r.Context(), "SELECT status, currency, total_amount, scheduled_for, updated_at FROM orders WHERE id = $1 FOR UPDATE", id).
+			Scan(&oldStatus, &oldCurrency, &oldAmount, &oldScheduledFor, &updatedAt)
+		if err != nil {
+			return err
+		}
+		if modifiedSince(r, updatedAt) {
+			return apierr.New(apierr.PreconditionFailed, "Order was modified after If-Unmodified-Since")
+		}
+		if o, err = next(r.Context(), tx); err != nil {
+			return err
+		}
+		// Валюта задаётся при создании и дальше не меняется.
+		if c := currency.Normalize(o.Currency); c != "" && c != oldCurrency {
+			return apierr.Invalid(map[string]apierr.Violation{"currency": {Rule: apierr.RuleImmutable}})
+		}
+		if err := checkScheduleUpdate(oldStatus, oldScheduledFor, &o, time.Now()); err != nil {
+			return err
+		}
+		// Минимум проверяется только при смене суммы: заказы, созданные до
+		// повышения MIN_ORDER_AMOUNT, по-прежнему можно менять.
+		if o.TotalAmount != oldAmount {
+			if err := checkMinOrderAmount(r, o.TotalAmount, oldCurrency); err != nil {
+				return err
+			}
+		}
 
+		if err := updateOrderRow(r.Context(), tx, id, &o); err != nil {
+			return err
+		}
+		if o.Status != oldStatus {
+			return recordStatusChange(tx, o)
+		}
+		return nil
+	})
 	if err == sql.ErrNoRows {
-		http.Error(w, "Order not found", http.StatusNotFound)
+		orderNotFound(w, r, id)
 		return
 	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, err)
 		return
 	}
+	orderCache.Delete(r.Context(), strconv.Itoa(id))
 
+	setLastModified(w, o)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(o)
+	json.NewEncoder(w).Encode(orderDetail(o))
 }
 
 // @Summary Delete order
-// @Description Удалить заказ
+// @Description Удалить заказ. Перед удалением payments-service и delivery-service проверяются на записи заказа: незавершённые платежи (всё, кроме failed, refunded, voided) и доставки (кроме delivered, failed) дают 409 со списком в blocking. force=true (только с X-Internal-API-Key) удаляет заказ всё равно и отправляет событие order.force_deleted, по которому сервисы помечают свои записи. Если проверить зависимости не удалось — 503, заказ не удаляется.
 // @Tags orders
 // @Param id path int true "Order ID"
+// @Param force query bool false "Удалить несмотря на незавершённые платежи и доставки; требует X-Internal-API-Key"
 // @Success 204
+// @Failure 401 {object} map[string]string "force=true без X-Internal-API-Key"
 // @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]interface{} "code: order_has_dependencies, список в blocking; invalid_state — по заказу ещё идёт сага оформления"
+// @Failure 503 {object} map[string]string "code: dependency_unavailable — зависимости не проверить"
 // @Router /orders/{id} [delete]
 func deleteOrder(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, _ := strconv.Atoi(vars["id"])
 
-	result, err := db.Exec("DELETE FROM orders WHERE id = $1", id)
+	force := r.URL.Query().Get("force") == "true"
+	if force && !admin.HasKey(r) {
+		apierr.Write(w, apierr.InvalidAPIKey, "force=true requires X-Internal-API-Key")
+		return
+	}
+	o, err := findOrder(r.Context(), id)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.OrderNotFound, "Order not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	blocking, err := orderDependencies(r.Context(), id)
+	if err := decideDelete(blocking, err, force); err != nil {
+		apierr.Respond(w, err)
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Сага оформления ссылается на заказ: завершённая удаляется вместе с
+	// ним, незавершённую (ещё идёт или компенсируется) трогать нельзя.
+	var running bool
+	err = tx.QueryRowContext(r.Context(),
+		"SELECT COALESCE(bool_or(state NOT IN ('completed', 'compensated')), false) FROM (SELECT state FROM checkout_sagas WHERE order_id = $1 FOR UPDATE) s", id).Scan(&running)
+	if err == nil && running {
+		apierr.Write(w, apierr.InvalidState, "Checkout saga for this order is still running")
+		return
+	}
+	if err == nil {
+		_, err = tx.ExecContext(r.Context(), "DELETE FROM checkout_sagas WHERE order_id = $1", id)
+	}
+	if err != nil {
+		apierr.Internal(w, err)
 		return
 	}
 
+	result, err := tx.ExecContext(r.Context(), observe.Lookup("orders.delete", "DELETE FROM orders WHERE id = $1"), id)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
 	rows, _ := result.RowsAffected()
 	if rows == 0 {
-		http.Error(w, "Order not found", http.StatusNotFound)
+		apierr.Write(w, apierr.OrderNotFound, "Order not found")
+		return
+	}
+	// Сервисы с записями заказа узнают о принудительном удалении из
+	// outbox и помечают их.
+	if len(blocking) > 0 {
+		log.Printf("⚠️ Order %d force-deleted by %s with %d active payments or deliveries", id, admin.Actor(r), len(blocking))
+		for _, dest := range []string{outboxToDelivery, outboxToPayments} {
+			if err := enqueueOutbox(tx, dest, events.OrderForceDeleted, o); err != nil {
+				apierr.Internal(w, err)
+				return
+			}
+		}
+	}
+
+	// Запись аудита фиксируется в одной транзакции с удалением.
+	err = audit.Write(r.Context(), tx)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		apierr.Internal(w, err)
 		return
 	}
+	orderCache.Delete(r.Context(), strconv.Itoa(id))
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// userExists проверяет пользователя в users-service. Деактивированный
+// пользователь для новых заказов считается несуществующим; уже созданные
+// заказы эта проверка не затрагивает. Если USERS_SERVICE_URL не задан или
+// флаг verify_user_exists выключен, проверка пропускается.
+func userExists(r *http.Request, userID int) (bool, error) {
+	if usersServiceURL == "" || !featureFlags.Bool("verify_user_exists", true) {
+		return true, nil
+	}
+
+	u, err := usersClient.Get(r.Context(), userID)
+	if clients.StatusOf(err) != 0 {
+		// Ответ вне 2xx (404 и т.п.) — пользователя нет.
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return u.IsActive, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pkg/admin"
+	"pkg/apierr"
+	"pkg/currency"
+)
+
+// minOrderAmounts — минимальная сумма заказа по валютам (MIN_ORDER_AMOUNT).
+// Ключ "" — граница для валют без своей; пустая карта — минимума нет.
+var minOrderAmounts map[string]float64
+
+// initMinOrderAmount применяет MIN_ORDER_AMOUNT. Граница проверяется при
+// создании заказа и при смене суммы, поэтому уже созданные заказы её смена
+// не затрагивает.
+func initMinOrderAmount() error {
+	amounts, err := parseMinOrderAmount(cfg.MinOrderAmount)
+	if err != nil {
+		return err
+	}
+	minOrderAmounts = amounts
+	return nil
+}
+
+// parseMinOrderAmount разбирает список через запятую: "CUR:amount" задаёт
+// границу для валюты, число без валюты — для остальных валют. Например,
+// "RUB:100,USD:1.5,2".
+func parseMinOrderAmount(spec string) (map[string]float64, error) {
+	amounts := map[string]float64{}
+	if strings.TrimSpace(spec) == "" {
+		return amounts, nil
+	}
+	for _, item := range strings.Split(spec, ",") {
+		cur, value := "", strings.TrimSpace(item)
+		if c, v, ok := strings.Cut(value, ":"); ok {
+			cur, value = currency.Normalize(c), strings.TrimSpace(v)
+			if !currency.Valid(cur) {
+				return nil, fmt.Errorf("MIN_ORDER_AMOUNT: unsupported currency %q", c)
+			}
+		}
+		if _, dup := amounts[cur]; dup {
+			return nil, fmt.Errorf("MIN_ORDER_AMOUNT: %q is set twice", item)
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("MIN_ORDER_AMOUNT: invalid amount %q", item)
+		}
+		amounts[cur] = v
+	}
+	return amounts, nil
+}
+
+// minOrderAmount возвращает границу для валюты; false — минимума нет.
+func minOrderAmount(cur string) (float64, bool) {
+	if v, ok := minOrderAmounts[cur]; ok {
+		return v, true
+	}
+	v, ok := minOrderAmounts[""]
+	return v, ok
+}
+
+// checkMinOrderAmount возвращает ошибку 422 с границей, если сумма меньше
+// MIN_ORDER_AMOUNT. Граница снимается только явным флагом bypass_min_amount
+// и только для запросов с внутренним API-ключом — для заказов-компенсаций
+// и замен с нулевой суммой.
+func checkMinOrderAmount(r *http.Request, amount float64, cur string) error {
+	bound, ok := minOrderAmount(cur)
+	if !ok || amount >= bound {
+		return nil
+	}
+	if r.URL.Query().Get("bypass_min_amount") == "true" && admin.HasKey(r) {
+		return nil
+	}
+	return apierr.New(apierr.OrderAmountBelowMinimum,
+		fmt.Sprintf("total_amount %.2f is below the minimum order amount %.2f %s", amount, bound, cur)).
+		With("min_amount", bound).
+		With("currency", cur)
+}
+
+// OrderConfig — параметры заказов, которые клиент может проверить до
+// отправки.
+type OrderConfig struct {
+	DefaultCurrency string   `json:"default_currency" example:"RUB"`
+	Currencies      []string `json:"currencies"`
+	// Минимальная сумма заказа по валютам; валюты без минимума не указаны.
+	MinOrderAmount map[string]float64 `json:"min_order_amount"`
+	// Минимальный возраст покупателя заказа с age_restricted; 0 — без
+	// проверки.
+	MinCustomerAge int `json:"min_customer_age" example:"18"`
+}
+
+// @Summary Order config
+// @Description Валюты, минимальная сумма заказа (MIN_ORDER_AMOUNT) и минимальный возраст покупателя для заказов с age_restricted (MIN_CUSTOMER_AGE), чтобы клиент мог проверить заказ до отправки
+// @Tags orders
+// @Produce json
+// @Success 200 {object} OrderConfig
+// @Router /orders/config [get]
+func getOrderConfig(w http.ResponseWriter, r *http.Request) {
+	c := OrderConfig{
+		DefaultCurrency: defaultCurrency,
+		Currencies:      currency.Supported(),
+		MinOrderAmount:  map[string]float64{},
+		MinCustomerAge:  cfg.MinCustomerAge,
+	}
+	for _, cur := range c.Currencies {
+		if v, ok := minOrderAmount(cur); ok {
+			c.MinOrderAmount[cur] = v
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
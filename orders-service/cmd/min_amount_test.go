@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"pkg/apierr"
+)
+
+func TestParseMinOrderAmount(t *testing.T) {
+	got, err := parseMinOrderAmount(" rub:100, USD:1.5 ,2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["RUB"] != 100 || got["USD"] != 1.5 || got[""] != 2 || len(got) != 3 {
+		t.Errorf("amounts = %v", got)
+	}
+
+	for _, spec := range []string{"XXX:10", "RUB:-1", "RUB:abc", "RUB:1,RUB:2", "1,2"} {
+		if _, err := parseMinOrderAmount(spec); err == nil {
+			t.Errorf("spec %q accepted", spec)
+		}
+	}
+}
+
+func TestCheckMinOrderAmount(t *testing.T) {
+	minOrderAmounts = map[string]float64{"RUB": 100, "": 2}
+	t.Cleanup(func() { minOrderAmounts = nil })
+	r := httptest.NewRequest("POST", "/orders", nil)
+
+	if err := checkMinOrderAmount(r, 100, "RUB"); err != nil {
+		t.Errorf("amount at the minimum rejected: %v", err)
+	}
+	var e *apierr.Error
+	if err := checkMinOrderAmount(r, 1.5, "USD"); !errors.As(err, &e) || e.Code != apierr.OrderAmountBelowMinimum {
+		t.Fatalf("USD 1.5: err = %v, want %s", err, apierr.OrderAmountBelowMinimum)
+	}
+
+	// Без внутреннего API-ключа флаг bypass_min_amount не действует.
+	r = httptest.NewRequest("POST", "/orders?bypass_min_amount=true", nil)
+	if err := checkMinOrderAmount(r, 0, "RUB"); err == nil {
+		t.Error("bypass_min_amount accepted without API key")
+	}
+}
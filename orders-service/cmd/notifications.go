@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"pkg/clients"
+	"pkg/events"
+	"pkg/mail"
+)
+
+var notificationsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "orders_notifications_total",
+	Help: "Order status emails by event and result: sent, retry, failed, skipped, suppressed_by_preference.",
+}, []string{"event", "result"})
+
+// Письма о смене статуса заказа (confirmed, shipped, delivered). Смена
+// статуса ставит письмо в таблицу notifications в той же транзакции
+// (recordStatusChange), фоновый отправитель берёт их оттуда: узнаёт адрес
+// и настройки уведомлений в users-service, рендерит шаблон и отправляет
+// через pkg/mail (без SMTP_ADDR письмо только пишется в лог). Неудача —
+// повтор через NOTIFICATION_RETRY_DELAY с удвоением, после
+// NOTIFICATION_MAX_ATTEMPTS — status = 'failed'. Удалённым пользователям
+// письмо не отправляется (status = 'skipped'), отключившим его в
+// настройках — тоже (status = 'suppressed_by_preference'). Настройки
+// кэшируются на NOTIFICATION_PREFERENCES_TTL.
+// ORDER_EMAILS=false или пустой USERS_SERVICE_URL выключают письма.
+
+//go:embed templates/*.html
+var notificationFS embed.FS
+
+// notificationTemplates — шаблон для каждого статуса; в файле определены
+// "subject" и "body".
+var notificationTemplates = map[string]*template.Template{
+	"confirmed": template.Must(template.ParseFS(notificationFS, "templates/order_confirmed.html")),
+	"shipped":   template.Must(template.ParseFS(notificationFS, "templates/order_shipped.html")),
+	"delivered": template.Must(template.ParseFS(notificationFS, "templates/order_delivered.html")),
+}
+
+// maxNotificationDelay — потолок паузы между повторами.
+const maxNotificationDelay = time.Hour
+
+// statusSuppressed — письмо не отправлено из-за настроек уведомлений.
+const statusSuppressed = "suppressed_by_preference"
+
+type notifier struct {
+	mailer      *mail.Sender
+	prefs       *clients.PreferenceCache
+	interval    time.Duration
+	retryDelay  time.Duration
+	maxAttempts int
+	batchSize   int
+}
+
+var orderNotifier *notifier
+
+func startNotifications(ctx context.Context) {
+	if !cfg.OrderEmails || cfg.UsersServiceURL == "" {
+		log.Printf("ℹ️ Order status emails disabled")
+		return
+	}
+	orderNotifier = &notifier{
+		mailer:      mail.FromEnv(),
+		prefs:       clients.NewPreferenceCache(usersClient, cfg.NotificationPreferencesTTL),
+		interval:    cfg.NotificationPollInterval,
+		retryDelay:  cfg.NotificationRetryDelay,
+		maxAttempts: cfg.NotificationMaxAttempts,
+		batchSize:   20,
+	}
+	go orderNotifier.run(ctx)
+	mode := "smtp"
+	if orderNotifier.mailer.LogOnly() {
+		mode = "log only"
+	}
+	log.Printf("📧 Order status emails started (%s)", mode)
+}
+
+// enqueueNotification ставит письмо о новом статусе заказа. Вызывается из
+// recordStatusChange в транзакции, которая меняет статус; снимок заказа
+// сохраняется, чтобы письмо описывало его на момент смены статуса.
+func enqueueNotification(tx *sql.Tx, o Order) error {
+	if orderNotifier == nil || notificationTemplates[o.Status] == nil {
+		return nil
+	}
+	// Письмо уходит покупателю, поэтому сумма подарка в нём есть.
+	payload, err := json.Marshal(orderPayload(o).WithPrice())
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO notifications (order_id, user_id, event, payload) VALUES ($1, $2, $3, $4)",
+		o.ID, o.UserID, o.Status, payload)
+	return err
+}
+
+type notification struct {
+	ID       int64
+	UserID   int
+	Event    string
+	Payload  []byte
+	Attempts int
+}
+
+// notificationData — данные шаблона письма.
+type notificationData struct {
+	Name  string
+	Order events.OrderPayload
+}
+
+func (n *notifier) run(ctx context.Context) {
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := n.sendBatch(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("⚠️ Order notifications error: %v", err)
+			}
+		}
+	}
+}
+
+// sendBatch блокирует пачку писем через SKIP LOCKED, поэтому реплики не
+// отправляют одно письмо дважды.
+func (n *notifier) sendBatch(ctx context.Context) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, user_id, event, payload, attempts FROM notifications
+		 WHERE status = 'pending' AND next_attempt_at <= NOW() ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED`, n.batchSize)
+	if err != nil {
+		return err
+	}
+	var batch []notification
+	for rows.Next() {
+		var nt notification
+		if err := rows.Scan(&nt.ID, &nt.UserID, &nt.Event, &nt.Payload, &nt.Attempts); err != nil {
+			rows.Close()
+			return err
+		}
+		batch = append(batch, nt)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, nt := range batch {
+		msg, skip, suppressed, err := n.prepare(ctx, nt)
+		if err == nil && skip == "" && !suppressed {
+			err = n.mailer.Send(msg)
+		}
+		switch {
+		case err != nil && nt.Attempts+1 >= n.maxAttempts:
+			log.Printf("⚠️ Order %s email %d failed after %d attempts: %v", nt.Event, nt.ID, nt.Attempts+1, err)
+			_, err = tx.ExecContext(ctx,
+				"UPDATE notifications SET status = 'failed', attempts = attempts + 1, last_error = $1, recipient = NULLIF($2, ''), subject = NULLIF($3, '') WHERE id = $4",
+				err.Error(), msg.To, msg.Subject, nt.ID)
+			notificationsSent.WithLabelValues(nt.Event, "failed").Inc()
+		case err != nil:
+			delay := min(n.retryDelay<<nt.Attempts, maxNotificationDelay)
+			_, err = tx.ExecContext(ctx,
+				"UPDATE notifications SET attempts = attempts + 1, last_error = $1, next_attempt_at = $2 WHERE id = $3",
+				err.Error(), time.Now().Add(delay), nt.ID)
+			notificationsSent.WithLabelValues(nt.Event, "retry").Inc()
+		case suppressed:
+			_, err = tx.ExecContext(ctx,
+				"UPDATE notifications SET status = $1, recipient = $2 WHERE id = $3", statusSuppressed, msg.To, nt.ID)
+			notificationsSent.WithLabelValues(nt.Event, statusSuppressed).Inc()
+		case skip != "":
+			_, err = tx.ExecContext(ctx,
+				"UPDATE notifications SET status = 'skipped', last_error = $1 WHERE id = $2", skip, nt.ID)
+			notificationsSent.WithLabelValues(nt.Event, "skipped").Inc()
+		default:
+			_, err = tx.ExecContext(ctx,
+				"UPDATE notifications SET status = 'sent', attempts = attempts + 1, recipient = $1, subject = $2, last_error = NULL, sent_at = NOW() WHERE id = $3",
+				msg.To, msg.Subject, nt.ID)
+			notificationsSent.WithLabelValues(nt.Event, "sent").Inc()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// prepare собирает письмо. skip — причина не отправлять его вовсе
+// (пользователь удалён), suppressed — письмо отключено в настройках
+// уведомлений; ошибка — повод повторить позже.
+func (n *notifier) prepare(ctx context.Context, nt notification) (msg mail.Message, skip string, suppressed bool, err error) {
+	var order events.OrderPayload
+	if err := json.Unmarshal(nt.Payload, &order); err != nil {
+		return msg, "", false, err
+	}
+	user, err := usersClient.Get(ctx, nt.UserID)
+	if clients.IsNotFound(err) {
+		return msg, "user not found", false, nil
+	}
+	if err != nil {
+		return msg, "", false, err
+	}
+	prefs, err := n.prefs.Get(ctx, nt.UserID)
+	if err != nil {
+		return msg, "", false, err
+	}
+	if !prefs.OrderStatus(nt.Event) {
+		return mail.Message{To: user.Email}, "", true, nil
+	}
+	subject, body, err := renderNotification(nt.Event, notificationData{Name: user.Name, Order: order})
+	if err != nil {
+		return msg, "", false, err
+	}
+	return mail.Message{To: user.Email, Subject: subject, Body: body, HTML: true}, "", false, nil
+}
+
+func renderNotification(event string, data notificationData) (subject, body string, err error) {
+	t := notificationTemplates[event]
+	if t == nil {
+		return "", "", fmt.Errorf("no email template for %q", event)
+	}
+	var s, b bytes.Buffer
+	if err := t.ExecuteTemplate(&s, "subject", data); err != nil {
+		return "", "", err
+	}
+	if err := t.ExecuteTemplate(&b, "body", data); err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(s.String()), b.String(), nil
+}
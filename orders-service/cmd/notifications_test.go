@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"pkg/events"
+)
+
+// TestRenderNotificationEscapes — у каждого статуса с письмом есть шаблон,
+// а данные пользователя в HTML экранируются.
+func TestRenderNotificationEscapes(t *testing.T) {
+	data := notificationData{
+		Name:  "<b>Ann</b>",
+		Order: events.OrderPayload{OrderID: 42, TotalAmount: 10, Currency: "RUB", ShippingAddress: "Main St"},
+	}
+	for _, event := range []string{"confirmed", "shipped", "delivered"} {
+		subject, body, err := renderNotification(event, data)
+		if err != nil {
+			t.Fatalf("%s: %v", event, err)
+		}
+		if !strings.Contains(subject, "42") {
+			t.Errorf("%s: subject %q has no order id", event, subject)
+		}
+		if strings.Contains(body, "<b>Ann</b>") || !strings.Contains(body, "&lt;b&gt;Ann&lt;/b&gt;") {
+			t.Errorf("%s: name is not escaped in body:\n%s", event, body)
+		}
+	}
+	if _, _, err := renderNotification("cancelled", data); err == nil {
+		t.Error("cancelled: expected no template")
+	}
+}
+
+// TestRenderDigestPartial — раздел недоступного сервиса помечается в
+// письме, остальные выводятся.
+func TestRenderDigestPartial(t *testing.T) {
+	rate := 0.75
+	d := &DailyDigest{
+		Date:        "2026-01-02",
+		Orders:      &DigestOrders{Total: 3, ByStatus: map[string]int{"pending": 3}},
+		Payments:    &DigestPayments{Revenue: map[string]float64{"RUB": 150}, Completed: 3, Failed: 1, SuccessRate: &rate},
+		Unavailable: map[string]string{"deliveries": "delivery-service unavailable"},
+		TopFailureReasons: []DigestFailureReason{
+			{Source: "payments", Reason: "card_declined", Count: 1},
+		},
+	}
+	subject, body, err := renderDigest(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(subject, "2026-01-02") {
+		t.Errorf("subject %q has no date", subject)
+	}
+	for _, want := range []string{"150.00 RUB", "75.0%", "Данные недоступны: delivery-service unavailable", "card_declined"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body has no %q:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"pkg/apierr"
+	"pkg/clients"
+)
+
+// BlockingResource — платёж или доставка заказа, из-за которых его нельзя
+// удалить.
+type BlockingResource struct {
+	Type   string `json:"type"` // payment или delivery
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+}
+
+// Статусы, в которых платёж или доставка больше не меняются и удалению
+// заказа не мешают. Завершённый платёж мешает: деньги списаны.
+var (
+	finalPaymentStatuses  = map[string]bool{"failed": true, "refunded": true, "voided": true}
+	finalDeliveryStatuses = map[string]bool{"delivered": true, "failed": true}
+)
+
+// blockingResources отбирает незавершённые платежи и доставки заказа.
+func blockingResources(payments []clients.Payment, deliveries []clients.Delivery) []BlockingResource {
+	var out []BlockingResource
+	for _, p := range payments {
+		if !finalPaymentStatuses[p.Status] {
+			out = append(out, BlockingResource{Type: "payment", ID: p.ID, Status: p.Status})
+		}
+	}
+	for _, d := range deliveries {
+		if !finalDeliveryStatuses[d.Status] {
+			out = append(out, BlockingResource{Type: "delivery", ID: d.ID, Status: d.Status})
+		}
+	}
+	return out
+}
+
+// orderDependencies запрашивает у payments-service (включая платежи
+// песочницы) и delivery-service записи заказа id. Сервис без URL не
+// проверяется. Ошибка означает, что проверить зависимости не удалось.
+func orderDependencies(ctx context.Context, id int) ([]BlockingResource, error) {
+	var payments []clients.Payment
+	var deliveries []clients.Delivery
+	var err error
+	if paymentsServiceURL != "" {
+		payments, err = paymentsClient.List(ctx, url.Values{"order_id": {strconv.Itoa(id)}, "include_test": {"true"}})
+		if err != nil {
+			return nil, fmt.Errorf("payments-service: %w", err)
+		}
+	}
+	if deliveryServiceURL != "" {
+		deliveries, err = deliveriesClient.List(ctx, url.Values{"order_id": {strconv.Itoa(id)}})
+		if err != nil {
+			return nil, fmt.Errorf("delivery-service: %w", err)
+		}
+	}
+	return blockingResources(payments, deliveries), nil
+}
+
+// decideDelete решает по результату orderDependencies, можно ли удалить
+// заказ. С force удаление идёт и при незавершённых записях.
+func decideDelete(blocking []BlockingResource, err error, force bool) error {
+	if err != nil {
+		return apierr.New(apierr.DependencyUnavailable, "cannot verify order dependencies: "+err.Error())
+	}
+	if len(blocking) > 0 && !force {
+		return apierr.New(apierr.OrderHasDependencies,
+			fmt.Sprintf("order has %d active payments or deliveries", len(blocking))).
+			With("blocking", blocking)
+	}
+	return nil
+}
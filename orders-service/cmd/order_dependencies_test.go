@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"pkg/apierr"
+	"pkg/clients"
+)
+
+func TestBlockingResources(t *testing.T) {
+	payments := []clients.Payment{{ID: 1, Status: "completed"}, {ID: 2, Status: "refunded"}, {ID: 3, Status: "failed"}, {ID: 4, Status: "pending"}}
+	deliveries := []clients.Delivery{{ID: 7, Status: "in_transit"}, {ID: 8, Status: "delivered"}}
+	got := blockingResources(payments, deliveries)
+	want := []BlockingResource{{"payment", 1, "completed"}, {"payment", 4, "pending"}, {"delivery", 7, "in_transit"}}
+	if len(got) != len(want) {
+		t.Fatalf("blocking = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("blocking[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDecideDelete(t *testing.T) {
+	blocking := []BlockingResource{{"delivery", 7, "in_transit"}}
+	var e *apierr.Error
+
+	if err := decideDelete(nil, nil, false); err != nil {
+		t.Errorf("no dependencies: %v", err)
+	}
+	if err := decideDelete(blocking, nil, false); !errors.As(err, &e) || e.Code != apierr.OrderHasDependencies || e.Details["blocking"] == nil {
+		t.Errorf("blocking: err = %v", err)
+	}
+	if err := decideDelete(blocking, nil, true); err != nil {
+		t.Errorf("force: %v", err)
+	}
+	// Без ответа сервисов не удаляем даже с force.
+	if err := decideDelete(nil, errors.New("payments-service: unavailable"), true); !errors.As(err, &e) || e.Code != apierr.DependencyUnavailable {
+		t.Errorf("unavailable: err = %v", err)
+	}
+}
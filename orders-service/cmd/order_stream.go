@@ -0,0 +1,161 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"pkg/apierr"
+	"pkg/pgnotify"
+)
+
+// Канал Postgres, через который изменения статуса доходят до всех реплик.
+const orderStatusChannel = "order_status"
+
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+
+	// Через сколько секунд клиенту стоит переподключиться, если лимит
+	// соединений исчерпан.
+	wsRetryAfter = "5"
+)
+
+type OrderStatusEvent struct {
+	OrderID   int    `json:"order_id"`
+	Status    string `json:"status"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// notifyStatusChange ставит NOTIFY в транзакцию: подписчики получат событие
+// только после коммита.
+func notifyStatusChange(tx *sql.Tx, o Order) error {
+	ev := OrderStatusEvent{OrderID: o.ID, Status: o.Status, UpdatedAt: o.UpdatedAt}
+	return pgnotify.Notify(tx, orderStatusChannel, strconv.Itoa(o.ID), "status_changed", ev)
+}
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     checkWSOrigin,
+}
+
+// checkWSOrigin пускает запросы без Origin (не из браузера), со своего
+// хоста и из WS_ALLOWED_ORIGINS: иначе любая страница могла бы читать
+// статусы заказов с cookie пользователя.
+func checkWSOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range cfg.WSAllowedOrigins {
+		if strings.EqualFold(strings.TrimRight(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+var wsConnections int64
+var wsMaxConnections int64
+
+func initOrderStream() {
+	wsMaxConnections = cfg.WSMaxConnections
+}
+
+// @Summary Order status stream
+// @Description WebSocket: текущий статус заказа и все последующие изменения. Из браузера — только со своего хоста или из WS_ALLOWED_ORIGINS (иначе 403).
+// @Tags orders
+// @Param id path int true "Order ID"
+// @Success 101
+// @Failure 403 "Origin не разрешён"
+// @Failure 404 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Router /orders/{id}/ws [get]
+func streamOrderStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	// Подписка до чтения заказа: смена статуса между чтением и подпиской
+	// не теряется.
+	events, unsubscribe := orderFeed.Subscribe(strconv.Itoa(id))
+	defer unsubscribe()
+
+	var current OrderStatusEvent
+	err := db.QueryRowContext(r.Context(), "SELECT id, status, updated_at FROM orders WHERE id = $1", id).
+		Scan(&current.OrderID, &current.Status, &current.UpdatedAt)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.OrderNotFound, "Order not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	if atomic.AddInt64(&wsConnections, 1) > wsMaxConnections {
+		atomic.AddInt64(&wsConnections, -1)
+		w.Header().Set("Retry-After", wsRetryAfter)
+		apierr.Write(w, apierr.TooManyStreams, "Too many WebSocket connections")
+		return
+	}
+	defer atomic.AddInt64(&wsConnections, -1)
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// Чтение нужно только для обработки pong и закрытия со стороны клиента.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	if err := conn.WriteJSON(current); err != nil {
+		return
+	}
+
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+	for {
+		select {
+		case ev := <-events:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.TextMessage, ev.Data); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+		case <-orderFeed.Done():
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+				time.Now().Add(wsWriteWait))
+			return
+		case <-gone:
+			return
+		}
+	}
+}
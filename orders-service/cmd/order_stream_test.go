@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckWSOrigin(t *testing.T) {
+	cfg.WSAllowedOrigins = []string{"https://shop.example.com/"}
+	t.Cleanup(func() { cfg.WSAllowedOrigins = nil })
+
+	cases := map[string]bool{
+		"":                          true,
+		"http://orders.local":       true,
+		"https://shop.example.com":  true,
+		"https://evil.example.com":  false,
+		"https://shop.example.com.": false,
+	}
+	for origin, want := range cases {
+		req := httptest.NewRequest(http.MethodGet, "http://orders.local/orders/1/ws", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if got := checkWSOrigin(req); got != want {
+			t.Errorf("Origin %q: allowed %v, want %v", origin, got, want)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"pkg/deadletter"
+	"pkg/events"
+	"pkg/httpclient"
+)
+
+var outboxPending = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "orders_outbox_pending_events",
+	Help: "Number of outbox events waiting to be dispatched.",
+})
+
+var outboxDispatched = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "orders_outbox_dispatched_total",
+	Help: "Outbox dispatch attempts by result: delivered, failed, parked.",
+}, []string{"result"})
+
+// Адресаты outbox. У каждого свой диспетчер и свой URL отправки:
+// delivery-service получает смены статуса (OUTBOX_PUSH_URL), users-service —
+// события для журнала активности пользователя (USER_EVENTS_PUSH_URL),
+// payments-service — только order.force_deleted (PAYMENTS_EVENTS_PUSH_URL).
+const (
+	outboxToDelivery = "delivery"
+	outboxToUsers    = "users"
+	outboxToPayments = "payments"
+)
+
+// recordStatusChange — единственное место, где фиксируется смена статуса
+// заказа: NOTIFY для подписчиков, письмо покупателю и событие
+// order.<status> в outbox. Вызывается внутри транзакции, которая меняет
+// статус.
+func recordStatusChange(tx *sql.Tx, o Order) error {
+	if err := notifyStatusChange(tx, o); err != nil {
+		return err
+	}
+	if err := enqueueNotification(tx, o); err != nil {
+		return err
+	}
+	return enqueueOutbox(tx, outboxToDelivery, "order."+o.Status, o)
+}
+
+// recordOrderPlaced ставит в outbox событие order.placed для users-service.
+// Вызывается в транзакции, создающей заказ.
+func recordOrderPlaced(tx *sql.Tx, o Order) error {
+	return enqueueOutbox(tx, outboxToUsers, events.OrderPlaced, o)
+}
+
+func enqueueOutbox(tx *sql.Tx, destination, eventType string, o Order) error {
+	// Сумму подарка видит только покупатель: users-service пишет её в
+	// историю его действий, delivery-service получает событие без неё.
+	p := orderPayload(o)
+	if destination == outboxToUsers {
+		p = p.WithPrice()
+	}
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO outbox_events (destination, event_type, aggregate_id, payload) VALUES ($1, $2, $3, $4)",
+		destination, eventType, o.ID, payload,
+	)
+	return err
+}
+
+type outboxEvent struct {
+	ID        int64
+	EventID   string
+	EventType string
+	Payload   []byte
+	Attempts  int
+	CreatedAt time.Time
+}
+
+// outboxDispatcher отправляет события одного адресата outbox. Событие
+// считается доставленным только после ответа 2xx; после OUTBOX_MAX_ATTEMPTS
+// неудач оно паркуется (status = 'parked') и копируется в dead_letters,
+// откуда его можно переотправить через POST /dead-letters/{id}/replay.
+// События одного заказа уходят строго по порядку: следующее не берётся,
+// пока предыдущее ждёт отправки.
+type outboxDispatcher struct {
+	destination string
+	pushURL     string
+	target      string
+	interval    time.Duration
+	lease       time.Duration
+	maxBackoff  time.Duration
+	batchSize   int
+	maxAttempts int
+}
+
+func startOutboxDispatcher(ctx context.Context) {
+	startOutboxDestination(ctx, outboxToDelivery, "OUTBOX_PUSH_URL", cfg.OutboxPushURL)
+	startOutboxDestination(ctx, outboxToUsers, "USER_EVENTS_PUSH_URL", cfg.UserEventsPushURL)
+	startOutboxDestination(ctx, outboxToPayments, "PAYMENTS_EVENTS_PUSH_URL", cfg.PaymentsEventsPushURL)
+}
+
+func startOutboxDestination(ctx context.Context, destination, urlEnv, pushURL string) {
+	if pushURL == "" {
+		log.Printf("ℹ️ %s not set, outbox dispatcher for %s disabled", urlEnv, destination)
+		return
+	}
+	u, err := url.Parse(pushURL)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", urlEnv, err)
+	}
+
+	d := &outboxDispatcher{
+		destination: destination,
+		pushURL:     pushURL,
+		target:      u.Host,
+		interval:    cfg.OutboxPollInterval,
+		lease:       cfg.OutboxLease,
+		maxBackoff:  cfg.OutboxMaxBackoff,
+		batchSize:   50,
+		maxAttempts: cfg.OutboxMaxAttempts,
+	}
+
+	go d.run(ctx)
+	log.Printf("📤 Outbox dispatcher for %s started (%s)", destination, pushURL)
+}
+
+func (d *outboxDispatcher) run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.dispatchBatch(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("⚠️ Outbox dispatch error: %v", err)
+			}
+			var pending int
+			if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM outbox_events WHERE status = 'pending'").Scan(&pending); err == nil {
+				outboxPending.Set(float64(pending))
+			}
+		}
+	}
+}
+
+// claimBatch забирает пачку событий одним коротким UPDATE: locked_until
+// сдвигается на d.lease, и до его истечения реплики не берут эти события
+// повторно. Строки не остаются заблокированными на время отправки; если
+// реплика упала, не отправив событие, его заберёт другая после аренды.
+// Событие не берётся, пока ждёт отправки более раннее событие того же
+// заказа, поэтому в пачке не больше одного события на заказ.
+func (d *outboxDispatcher) claimBatch(ctx context.Context) ([]outboxEvent, error) {
+	rows, err := db.QueryContext(ctx,
+		`UPDATE outbox_events SET locked_until = NOW() + make_interval(secs => $3)
+		 WHERE id IN (
+		     SELECT id FROM outbox_events
+		     WHERE status = 'pending' AND destination = $1 AND (locked_until IS NULL OR locked_until < NOW())
+		       AND NOT EXISTS (
+		           SELECT 1 FROM outbox_events e
+		           WHERE e.status = 'pending' AND e.destination = outbox_events.destination
+		             AND e.aggregate_id = outbox_events.aggregate_id AND e.id < outbox_events.id)
+		     ORDER BY id LIMIT $2 FOR UPDATE SKIP LOCKED)
+		 RETURNING id, event_id, event_type, payload, attempts, created_at`,
+		d.destination, d.batchSize, d.lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var batch []outboxEvent
+	for rows.Next() {
+		var ev outboxEvent
+		if err := rows.Scan(&ev.ID, &ev.EventID, &ev.EventType, &ev.Payload, &ev.Attempts, &ev.CreatedAt); err != nil {
+			return nil, err
+		}
+		batch = append(batch, ev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// RETURNING не сохраняет порядок подзапроса.
+	sort.Slice(batch, func(i, j int) bool { return batch[i].ID < batch[j].ID })
+	return batch, nil
+}
+
+// dispatchBatch забирает пачку (claimBatch) и отправляет события вне
+// транзакции; результат каждого записывается отдельным коротким запросом.
+// Если breaker адресата открыт, остаток пачки возвращается в очередь без
+// траты попыток: события не отправлялись.
+func (d *outboxDispatcher) dispatchBatch(ctx context.Context) error {
+	batch, err := d.claimBatch(ctx)
+	if err != nil {
+		return err
+	}
+	for i, ev := range batch {
+		body, headers, err := d.request(ev)
+		if err == nil {
+			err = d.push(ctx, body, headers)
+		}
+		if errors.Is(err, httpclient.ErrBreakerOpen) {
+			return d.release(ctx, batch[i:])
+		}
+		if err == nil {
+			err = d.markDispatched(ctx, ev)
+		} else {
+			err = d.markFailed(ctx, ev, body, headers, err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *outboxDispatcher) markDispatched(ctx context.Context, ev outboxEvent) error {
+	_, err := db.ExecContext(ctx,
+		"UPDATE outbox_events SET attempts = attempts + 1, status = 'dispatched', dispatched_at = NOW(), locked_until = NULL WHERE id = $1",
+		ev.ID)
+	if err != nil {
+		return err
+	}
+	outboxDispatched.WithLabelValues("delivered").Inc()
+	return nil
+}
+
+// release возвращает события в очередь, не засчитывая попытку; забрать
+// их снова можно через d.interval.
+func (d *outboxDispatcher) release(ctx context.Context, batch []outboxEvent) error {
+	for _, ev := range batch {
+		if _, err := db.ExecContext(ctx,
+			"UPDATE outbox_events SET locked_until = NOW() + make_interval(secs => $1) WHERE id = $2",
+			d.interval.Seconds(), ev.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backoff — пауза после attempts неудачных попыток: d.interval,
+// удваиваемый с каждой попыткой, но не больше d.maxBackoff.
+func (d *outboxDispatcher) backoff(attempts int) time.Duration {
+	wait := d.interval
+	for i := 1; i < attempts && wait < d.maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.maxBackoff {
+		wait = d.maxBackoff
+	}
+	return wait
+}
+
+// markFailed откладывает следующую попытку на d.backoff или, после
+// d.maxAttempts неудач, паркует событие и копирует его в dead_letters в
+// одной транзакции.
+func (d *outboxDispatcher) markFailed(ctx context.Context, ev outboxEvent, body []byte, headers map[string]string, pushErr error) error {
+	if ev.Attempts+1 < d.maxAttempts {
+		_, err := db.ExecContext(ctx,
+			"UPDATE outbox_events SET attempts = attempts + 1, last_error = $1, locked_until = NOW() + make_interval(secs => $2) WHERE id = $3",
+			pushErr.Error(), d.backoff(ev.Attempts+1).Seconds(), ev.ID)
+		if err != nil {
+			return err
+		}
+		outboxDispatched.WithLabelValues("failed").Inc()
+		return nil
+	}
+
+	log.Printf("🅿️ Outbox event %s (%s) parked after %d attempts: %v", ev.EventID, ev.EventType, ev.Attempts+1, pushErr)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := deadletter.Record(ctx, tx, deadletter.Letter{
+		Source:    "outbox:" + ev.EventType,
+		TargetURL: d.pushURL,
+		Headers:   headers,
+		Payload:   string(body),
+		Attempts:  ev.Attempts + 1,
+		LastError: pushErr.Error(),
+	}); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE outbox_events SET attempts = attempts + 1, last_error = $1, status = 'parked', locked_until = NULL WHERE id = $2",
+		pushErr.Error(), ev.ID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	outboxDispatched.WithLabelValues("parked").Inc()
+	return nil
+}
+
+// request собирает тело и заголовки отправки. Те же заголовки сохраняются
+// в dead_letters, чтобы replay был неотличим от исходной отправки.
+func (d *outboxDispatcher) request(ev outboxEvent) ([]byte, map[string]string, error) {
+	headers := map[string]string{
+		"Content-Type":    "application/json",
+		"Idempotency-Key": ev.EventID,
+	}
+	body, err := json.Marshal(events.Envelope{
+		EventID:    ev.EventID,
+		EventType:  ev.EventType,
+		OccurredAt: ev.CreatedAt,
+		Payload:    ev.Payload,
+	})
+	return body, headers, err
+}
+
+func (d *outboxDispatcher) push(ctx context.Context, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.pushURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := services.Do(d.target, req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("push rejected with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+)
+
+// @Summary Patch order
+// @Description Частичное обновление заказа по JSON Merge Patch (RFC 7386): поля, которых нет в теле, не меняются; null допустим только для tags и scheduled_for (сбрасывает их), для остальных полей — 422. Патч накладывается на текущую версию под блокировкой строки, дальше действуют те же проверки, что и у PUT (If-Unmodified-Since, неизменная валюта, переходы scheduled, MIN_ORDER_AMOUNT).
+// @Tags orders
+// @Accept json
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param id path int true "Order ID"
+// @Param patch body Order true "Изменяемые поля заказа"
+// @Param If-Unmodified-Since header string false "Обновить, только если заказ не менялся после этой даты (значение Last-Modified)"
+// @Param bypass_min_amount query bool false "Не проверять MIN_ORDER_AMOUNT при смене суммы (только с X-Internal-API-Key)"
+// @Success 200 {object} OrderDetail
+// @Failure 400 {object} map[string]string "Тело — не JSON-объект"
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "Запрещённый переход из scheduled или в него; смена scheduled_for после перехода в pending"
+// @Failure 412 {object} map[string]string
+// @Failure 422 {object} map[string]interface{} "Ошибки полей (в том числе null для обязательного поля); новая сумма меньше минимальной — {code: order_amount_below_minimum}"
+// @Failure 503 {object} map[string]string "Конкурирующее изменение той же записи; запрос можно повторить"
+// @Router /orders/{id} [patch]
+func patchOrder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	var patch map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, "expected a JSON object (merge patch): "+err.Error())
+		return
+	}
+	if fieldErrs := nullViolations(patch); fieldErrs != nil {
+		apierr.Respond(w, apierr.Invalid(fieldErrs))
+		return
+	}
+
+	saveOrder(w, r, id, func(ctx context.Context, tx *sql.Tx) (Order, error) {
+		var cur Order
+		if err := scanOrder(tx.QueryRowContext(ctx, "SELECT "+orderColumns+" FROM orders WHERE id = $1", id), &cur); err != nil {
+			return cur, err
+		}
+		o, err := mergeOrder(cur, patch)
+		if err != nil {
+			return o, apierr.New(apierr.InvalidRequest, err.Error())
+		}
+		if _, ok := patch["tags"]; ok && o.Tags != nil {
+			tags, fieldErrs := normalizeTags(o.Tags)
+			if fieldErrs != nil {
+				return o, apierr.Invalid(fieldErrs)
+			}
+			o.Tags = tags
+		}
+		return o, nil
+	})
+}
+
+// nullableFields — поля заказа, которые патч может сбросить через null.
+var nullableFields = map[string]bool{"tags": true, "scheduled_for": true, "gift_message": true}
+
+// nullViolations — ошибки полей для null в патче там, где поле обязательно:
+// по RFC 7386 null удаляет поле, и заказ получил бы нулевое значение.
+func nullViolations(patch map[string]interface{}) map[string]apierr.Violation {
+	var fieldErrs map[string]apierr.Violation
+	for k, v := range patch {
+		if v != nil || nullableFields[k] {
+			continue
+		}
+		if fieldErrs == nil {
+			fieldErrs = map[string]apierr.Violation{}
+		}
+		fieldErrs[k] = apierr.Violation{Rule: apierr.RuleNotNull}
+	}
+	return fieldErrs
+}
+
+// mergeOrder накладывает патч на заказ через его JSON-представление.
+// Поле, которого после слияния нет (null в патче), получает нулевое
+// значение; обязательные поля отсекает раньше nullViolations.
+func mergeOrder(cur Order, patch map[string]interface{}) (Order, error) {
+	data, err := json.Marshal(cur)
+	if err != nil {
+		return cur, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return cur, err
+	}
+	if data, err = json.Marshal(mergePatch(doc, patch)); err != nil {
+		return cur, err
+	}
+	var o Order
+	err = json.Unmarshal(data, &o)
+	return o, err
+}
+
+// mergePatch — JSON Merge Patch (RFC 7386, раздел 2) для объектов.
+func mergePatch(target, patch map[string]interface{}) map[string]interface{} {
+	if target == nil {
+		target = map[string]interface{}{}
+	}
+	for k, v := range patch {
+		switch pv := v.(type) {
+		case nil:
+			delete(target, k)
+		case map[string]interface{}:
+			sub, _ := target[k].(map[string]interface{})
+			target[k] = mergePatch(sub, pv)
+		default:
+			target[k] = v
+		}
+	}
+	return target
+}
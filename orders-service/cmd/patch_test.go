@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+)
+
+func TestMergeOrder(t *testing.T) {
+	at := time.Date(2026, 11, 1, 10, 0, 0, 0, time.UTC)
+	cur := Order{ID: 5, UserID: 1, TotalAmount: 10, Currency: "RUB", Status: "scheduled",
+		ShippingAddress: "Old street 1", Tags: []string{"vip"}, ScheduledFor: &at}
+
+	cases := []struct {
+		name  string
+		patch string
+		want  func(o *Order)
+	}{
+		{"empty patch changes nothing", `{}`, func(o *Order) {}},
+		{"one field", `{"shipping_address": "New street 2"}`, func(o *Order) { o.ShippingAddress = "New street 2" }},
+		{"array replaced whole", `{"tags": ["gift", "fragile"]}`, func(o *Order) { o.Tags = []string{"gift", "fragile"} }},
+		{"null keeps tags and date unset", `{"tags": null, "scheduled_for": null}`, func(o *Order) { o.Tags, o.ScheduledFor = nil, nil }},
+		{"several fields", `{"status": "cancelled", "total_amount": 12.5}`, func(o *Order) { o.Status, o.TotalAmount = "cancelled", 12.5 }},
+	}
+	for _, c := range cases {
+		var patch map[string]interface{}
+		if err := json.Unmarshal([]byte(c.patch), &patch); err != nil {
+			t.Fatal(err)
+		}
+		got, err := mergeOrder(cur, patch)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		want := cur
+		want.Tags = append([]string(nil), cur.Tags...)
+		c.want(&want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s:\n got %+v\nwant %+v", c.name, got, want)
+		}
+	}
+
+	if _, err := mergeOrder(cur, map[string]interface{}{"total_amount": "ten"}); err == nil {
+		t.Error("want error for a wrongly typed field")
+	}
+}
+
+func TestNullViolations(t *testing.T) {
+	var patch map[string]interface{}
+	json.Unmarshal([]byte(`{"status": null, "shipping_address": null, "tags": null, "scheduled_for": null, "total_amount": 12}`), &patch)
+	got := nullViolations(patch)
+	want := map[string]apierr.Violation{
+		"status":           {Rule: apierr.RuleNotNull},
+		"shipping_address": {Rule: apierr.RuleNotNull},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("violations %v, want %v", got, want)
+	}
+	if got := nullViolations(map[string]interface{}{"tags": nil}); got != nil {
+		t.Errorf("null tags: %v, want none", got)
+	}
+}
+
+// TestPatchOrder — PATCH меняет только переданные поля и соблюдает
+// If-Unmodified-Since. Нужна TEST_DATABASE_URL (см. locked_test.go).
+func TestPatchOrder(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+
+	o := Order{UserID: 1, TotalAmount: 10, Currency: "RUB", Status: "pending", ShippingAddress: "Patch test", Tags: []string{"vip"}}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := insertOrder(ctx, tx, &o); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM outbox_events WHERE aggregate_id = $1", o.ID)
+		db.Exec("DELETE FROM orders WHERE id = $1", o.ID)
+	})
+
+	id := strconv.Itoa(o.ID)
+	patch := func(body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/orders/"+id, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		patchOrder(rec, mux.SetURLVars(req, map[string]string{"id": id}))
+		return rec
+	}
+
+	rec := patch(`{"shipping_address": "Patch test 2"}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PATCH: status %d: %s", rec.Code, rec.Body)
+	}
+	var got OrderDetail
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ShippingAddress != "Patch test 2" || got.Status != "pending" || got.TotalAmount != 10 ||
+		!reflect.DeepEqual(got.Tags, []string{"vip"}) {
+		t.Errorf("after PATCH: %+v; want only shipping_address changed", got.Order)
+	}
+
+	// Заказ уже изменён позже этой даты — 412, ничего не пишется.
+	stale := http.Header{"If-Unmodified-Since": {time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)}}
+	if rec := patch(`{"status": "cancelled"}`, stale); rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("stale If-Unmodified-Since: status %d, want 412", rec.Code)
+	}
+	var status string
+	if err := db.QueryRow("SELECT status FROM orders WHERE id = $1", o.ID).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status != "pending" {
+		t.Errorf("status %s after rejected PATCH, want pending", status)
+	}
+
+	if rec := patch(`{"status": null}`, nil); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("null status: status %d, want 422", rec.Code)
+	}
+
+	if rec := patch(`["op"]`, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("non-object body: status %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+	"pkg/clients"
+)
+
+// PaymentCompleted — уведомление payments-service о проведённом платеже.
+type PaymentCompleted = clients.PaymentCompleted
+
+// @Summary Payment completed
+// @Description Внутренний вызов payments-service: платёж по заказу проведён. Заказ в pending переводится в confirmed; в любом другом статусе вызов ничего не меняет, поэтому повтор безопасен.
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param id path int true "Order ID"
+// @Param event body PaymentCompleted true "Payment"
+// @Success 200 {object} Order
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /orders/{id}/payment-completed [post]
+func paymentCompleted(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	var ev PaymentCompleted
+	if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var o Order
+	err = scanOrder(tx.QueryRowContext(r.Context(), "SELECT "+orderColumns+" FROM orders WHERE id = $1 FOR UPDATE", id), &o)
+	if err == sql.ErrNoRows {
+		orderNotFound(w, r, id)
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	if o.Status == "pending" {
+		err = scanOrder(tx.QueryRowContext(r.Context(),
+			"UPDATE orders SET status = 'confirmed', updated_at = NOW() WHERE id = $1 RETURNING "+orderColumns, id), &o)
+		if err == nil {
+			err = recordStatusChange(tx, o)
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		orderCache.Delete(r.Context(), strconv.Itoa(id))
+		log.Printf("💳 Order %d confirmed by payment %d", id, ev.PaymentID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(o)
+}
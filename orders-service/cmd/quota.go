@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"pkg/apierr"
+)
+
+// maxOpenOrders — сколько заказов в статусах pending и confirmed может
+// одновременно быть у пользователя (MAX_OPEN_ORDERS_PER_USER, по
+// умолчанию 10; 0 отключает лимит).
+var maxOpenOrders int
+
+// countOpenOrders считает открытые заказы пользователя. Вызывается под
+// lockUserOrders; запрос обслуживается индексом (user_id, status).
+func countOpenOrders(ctx context.Context, tx *sql.Tx, userID int) (int, error) {
+	var n int
+	err := tx.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM orders WHERE user_id = $1 AND status IN ('pending', 'confirmed')", userID).Scan(&n)
+	return n, err
+}
+
+func writeOpenOrderLimit(w http.ResponseWriter, open int) {
+	apierr.Respond(w, apierr.New(apierr.OpenOrderLimitReached,
+		fmt.Sprintf("user already has %d open orders (limit %d)", open, maxOpenOrders)).
+		With("limit", maxOpenOrders))
+}
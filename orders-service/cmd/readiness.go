@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DependencyCheck — последний результат проверки зависимости.
+type DependencyCheck struct {
+	Status    string    `json:"status"` // up, down или unknown (ещё не проверялась)
+	Critical  bool      `json:"critical"`
+	LatencyMs int64     `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	// Pending — число неотправленных событий (только для outbox).
+	Pending *int `json:"pending,omitempty"`
+}
+
+// ReadinessReport — ответ /ready.
+type ReadinessReport struct {
+	Status       string                     `json:"status"` // ready, degraded или unready
+	Reason       string                     `json:"reason,omitempty"`
+	ReplicaID    string                     `json:"replica_id"`
+	Dependencies map[string]DependencyCheck `json:"dependencies,omitempty"`
+}
+
+// dependencyChecker в фоне проверяет /health настроенных сервисов и
+// очередь outbox раз в READINESS_CHECK_INTERVAL (по умолчанию 15s); /ready
+// отдаёт закешированный результат и сам никуда не ходит. Включается
+// READINESS_DEPENDENCY_CHECKS=true. Отказ зависимости из
+// READINESS_CRITICAL_DEPENDENCIES (список через запятую) делает реплику
+// unready, отказ остальных — degraded. Outbox отказывает, когда в нём
+// больше OUTBOX_PENDING_THRESHOLD (по умолчанию 1000) событий.
+type dependencyChecker struct {
+	interval         time.Duration
+	timeout          time.Duration
+	pendingThreshold int
+	critical         map[string]bool
+	services         map[string]string // target → base URL
+
+	mu      sync.RWMutex
+	results map[string]DependencyCheck
+}
+
+// outboxDependency — имя проверки очереди outbox в отчёте.
+const outboxDependency = "outbox"
+
+var dependencies *dependencyChecker
+
+func startDependencyChecks(ctx context.Context) {
+	if !cfg.ReadinessChecks {
+		return
+	}
+	c := &dependencyChecker{
+		interval:         cfg.ReadinessInterval,
+		timeout:          2 * time.Second,
+		pendingThreshold: cfg.OutboxPendingThreshold,
+		critical:         map[string]bool{},
+		services:         map[string]string{},
+		results:          map[string]DependencyCheck{},
+	}
+	for _, name := range cfg.ReadinessCritical {
+		c.critical[name] = true
+	}
+	for target, base := range map[string]string{
+		"users-service":    usersServiceURL,
+		"payments-service": paymentsServiceURL,
+		"delivery-service": deliveryServiceURL,
+	} {
+		if base != "" {
+			c.services[target] = strings.TrimRight(base, "/")
+		}
+	}
+	for name := range c.services {
+		c.results[name] = DependencyCheck{Status: "unknown", Critical: c.critical[name]}
+	}
+	c.results[outboxDependency] = DependencyCheck{Status: "unknown", Critical: c.critical[outboxDependency]}
+
+	dependencies = c
+	go c.run(ctx)
+}
+
+func (c *dependencyChecker) run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		c.checkAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *dependencyChecker) checkAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for target, base := range c.services {
+		wg.Add(1)
+		go func(target, base string) {
+			defer wg.Done()
+			c.store(target, c.checkService(ctx, target, base))
+		}(target, base)
+	}
+	c.store(outboxDependency, c.checkOutbox(ctx))
+	wg.Wait()
+}
+
+func (c *dependencyChecker) store(name string, res DependencyCheck) {
+	res.Critical = c.critical[name]
+	c.mu.Lock()
+	c.results[name] = res
+	c.mu.Unlock()
+}
+
+func (c *dependencyChecker) checkService(ctx context.Context, target, base string) DependencyCheck {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	start := time.Now()
+	res := DependencyCheck{Status: "up"}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/health", nil)
+	if err == nil {
+		var resp *http.Response
+		resp, err = services.Do(target, req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				res.Error = "status " + strconv.Itoa(resp.StatusCode)
+			}
+		}
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	if res.Error != "" {
+		res.Status = "down"
+	}
+	res.LatencyMs = time.Since(start).Milliseconds()
+	res.CheckedAt = time.Now().UTC()
+	return res
+}
+
+func (c *dependencyChecker) checkOutbox(ctx context.Context) DependencyCheck {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	start := time.Now()
+	res := DependencyCheck{Status: "up"}
+
+	var pending int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM outbox_events WHERE status = 'pending'").Scan(&pending); err != nil {
+		res.Status, res.Error = "down", err.Error()
+	} else {
+		res.Pending = &pending
+		if pending > c.pendingThreshold {
+			res.Status = "down"
+			res.Error = "pending events above threshold " + strconv.Itoa(c.pendingThreshold)
+		}
+	}
+	res.LatencyMs = time.Since(start).Milliseconds()
+	res.CheckedAt = time.Now().UTC()
+	return res
+}
+
+// snapshot возвращает копию результатов и итоговый статус по ним.
+func (c *dependencyChecker) snapshot() (map[string]DependencyCheck, string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	status := "ready"
+	out := make(map[string]DependencyCheck, len(c.results))
+	for name, res := range c.results {
+		out[name] = res
+		if res.Status != "down" {
+			continue
+		}
+		if res.Critical {
+			status = "unready"
+		} else if status == "ready" {
+			status = "degraded"
+		}
+	}
+	return out, status
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"pkg/apierr"
+	"pkg/pg"
+)
+
+// retentionLockKey — ключ pg_advisory_lock, общий для всех реплик.
+const retentionLockKey = 0x6f726472 // "ordr"
+
+const retentionBatchSize = 1000
+
+var errRetentionBusy = errors.New("retention run already in progress")
+
+var retentionPurged = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "orders_retention_purged_total",
+	Help: "Cancelled orders deleted by the retention job.",
+})
+
+var retentionLastRun = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "orders_retention_last_run_orders",
+	Help: "Orders purged (or, in dry-run, eligible for purging) by the last retention run.",
+}, []string{"dry_run"})
+
+// orderRetention удаляет отменённые заказы, не менявшиеся дольше
+// ORDER_RETENTION (по умолчанию 8760h — год). Запуск раз в
+// ORDER_RETENTION_INTERVAL (по умолчанию 24h) и по POST
+// /admin/retention/run. ORDER_RETENTION_DRY_RUN=true только считает
+// кандидатов. Удаление идёт пачками по retentionBatchSize, каждая в своей
+// транзакции, чтобы не держать долгие блокировки.
+type orderRetention struct {
+	retention time.Duration
+	interval  time.Duration
+	dryRun    bool
+}
+
+// RetentionRun — результат одного запуска.
+type RetentionRun struct {
+	DryRun bool      `json:"dry_run"`
+	Cutoff time.Time `json:"cutoff"`
+	Orders int64     `json:"orders"`
+}
+
+var retention *orderRetention
+
+func startOrderRetention(ctx context.Context) {
+	retention = &orderRetention{
+		retention: cfg.OrderRetention,
+		interval:  cfg.OrderRetentionEvery,
+		dryRun:    cfg.OrderRetentionDryRun,
+	}
+
+	go func() {
+		ticker := time.NewTicker(retention.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if _, err := retention.run(ctx, retention.dryRun); err != nil && !errors.Is(err, errRetentionBusy) && ctx.Err() == nil {
+				log.Printf("⚠️ Order retention run failed: %v", err)
+			}
+		}
+	}()
+	log.Printf("🧹 Order retention started (cancelled orders older than %s, every %s, dry_run=%t)", retention.retention, retention.interval, retention.dryRun)
+}
+
+// run выполняет один проход. Сессионная advisory-блокировка держится на
+// выделенном соединении, поэтому одновременно работает только одна реплика;
+// остальные получают errRetentionBusy.
+func (j *orderRetention) run(ctx context.Context, dryRun bool) (RetentionRun, error) {
+	res := RetentionRun{DryRun: dryRun, Cutoff: time.Now().Add(-j.retention)}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return res, err
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", retentionLockKey).Scan(&locked); err != nil {
+		return res, err
+	}
+	if !locked {
+		return res, errRetentionBusy
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", retentionLockKey)
+
+	if dryRun {
+		err = conn.QueryRowContext(ctx,
+			"SELECT COUNT(*) FROM orders WHERE status = 'cancelled' AND updated_at < $1 AND "+noRunningSaga, res.Cutoff).Scan(&res.Orders)
+		if err != nil {
+			return res, err
+		}
+		retentionLastRun.WithLabelValues("true").Set(float64(res.Orders))
+		log.Printf("🧹 Order retention dry run: %d cancelled orders older than %s", res.Orders, res.Cutoff.Format(time.RFC3339))
+		return res, nil
+	}
+
+	for {
+		ids, err := j.purgeBatch(ctx, conn, res.Cutoff)
+		if err != nil {
+			return res, err
+		}
+		for _, id := range ids {
+			orderCache.Delete(ctx, strconv.FormatInt(id, 10))
+		}
+		res.Orders += int64(len(ids))
+		retentionPurged.Add(float64(len(ids)))
+		if len(ids) < retentionBatchSize {
+			break
+		}
+	}
+	retentionLastRun.WithLabelValues("false").Set(float64(res.Orders))
+	log.Printf("🧹 Order retention purged %d cancelled orders older than %s", res.Orders, res.Cutoff.Format(time.RFC3339))
+	return res, nil
+}
+
+// purgeBatch удаляет одну пачку вместе с завершёнными сагами, которые на
+// неё ссылаются; заказы с незавершённой сагой пропускаются.
+func (j *orderRetention) purgeBatch(ctx context.Context, conn *sql.Conn, cutoff time.Time) ([]int64, error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var ids []int64
+	err = tx.QueryRowContext(ctx,
+		`SELECT COALESCE(array_agg(id), '{}') FROM (
+		   SELECT id FROM orders WHERE status = 'cancelled' AND updated_at < $1 AND `+noRunningSaga+`
+		   ORDER BY id LIMIT $2 FOR UPDATE SKIP LOCKED
+		 ) batch`,
+		cutoff, retentionBatchSize).Scan(pg.Array(&ids))
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM checkout_sagas WHERE order_id = ANY($1)", ids); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM orders WHERE id = ANY($1)", ids); err != nil {
+		return nil, err
+	}
+	return ids, tx.Commit()
+}
+
+// @Summary Run order retention
+// @Description Запустить очистку отменённых заказов старше ORDER_RETENTION; заказы с незавершённой сагой оформления пропускаются. dry_run=true только считает кандидатов. Требует X-Internal-API-Key.
+// @Tags admin
+// @Produce json
+// @Param dry_run query bool false "Только посчитать (по умолчанию ORDER_RETENTION_DRY_RUN)"
+// @Success 200 {object} RetentionRun
+// @Failure 409 {object} map[string]string
+// @Router /admin/retention/run [post]
+func runRetention(w http.ResponseWriter, r *http.Request) {
+	dryRun := retention.dryRun
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			apierr.Write(w, apierr.InvalidRequest, "dry_run must be a boolean")
+			return
+		}
+		dryRun = b
+	}
+
+	res, err := retention.run(r.Context(), dryRun)
+	if errors.Is(err, errRetentionBusy) {
+		apierr.Write(w, apierr.Conflict, err.Error())
+		return
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"pkg/apierr"
+)
+
+// Отложенные заказы. Заказ с scheduled_for создаётся в статусе scheduled:
+// дата должна быть в будущем и не дальше SCHEDULED_ORDER_MAX_AHEAD. Раз в
+// SCHEDULED_ORDERS_INTERVAL фоновая задача переводит наступившие заказы в
+// pending и ставит те же события, что и обычный заказ: order.placed для
+// users-service и смену статуса для delivery-service, писем и
+// WebSocket-подписчиков. До этого событий по заказу нет. Отложенный заказ
+// можно только отменить или перенести; после перевода в pending
+// scheduled_for не меняется.
+
+// scheduledPromoteBatch — сколько наступивших заказов переводится в одной
+// транзакции.
+const scheduledPromoteBatch = 100
+
+// scheduleViolation проверяет scheduled_for нового или переносимого
+// заказа; false — дата допустима.
+func scheduleViolation(at, now time.Time) (apierr.Violation, bool) {
+	if !at.After(now) {
+		return apierr.Violation{Rule: apierr.RuleFuture}, true
+	}
+	if at.After(now.Add(cfg.ScheduledOrderMaxAhead)) {
+		return apierr.Violation{Rule: apierr.RuleMaxDaysAhead, Limit: int(cfg.ScheduledOrderMaxAhead.Hours() / 24)}, true
+	}
+	return apierr.Violation{}, false
+}
+
+// applySchedule готовит новый заказ: с scheduled_for он создаётся в
+// статусе scheduled, статус scheduled без даты не допускается. Возвращает
+// нарушение для поля scheduled_for.
+func applySchedule(o *Order, now time.Time) (apierr.Violation, bool) {
+	if o.ScheduledFor == nil {
+		if o.Status == "scheduled" {
+			return apierr.Violation{Rule: apierr.RuleRequired}, true
+		}
+		return apierr.Violation{}, false
+	}
+	at := o.ScheduledFor.UTC()
+	o.ScheduledFor = &at
+	if v, bad := scheduleViolation(at, now); bad {
+		return v, true
+	}
+	o.Status = "scheduled"
+	return apierr.Violation{}, false
+}
+
+// checkScheduleUpdate проверяет PUT заказа против текущего статуса и даты:
+// отложенный заказ можно перенести или отменить, но не перевести в другой
+// статус вручную; у остальных scheduled_for не меняется и статус scheduled
+// не ставится. Без scheduled_for в теле дата не меняется.
+func checkScheduleUpdate(oldStatus string, oldAt *time.Time, o *Order, now time.Time) error {
+	changed := o.ScheduledFor != nil && (oldAt == nil || !o.ScheduledFor.Equal(*oldAt))
+	if oldStatus != "scheduled" {
+		if o.Status == "scheduled" {
+			return apierr.New(apierr.InvalidStatusTransition, "only new orders can be scheduled")
+		}
+		if changed {
+			return apierr.New(apierr.InvalidState, "scheduled_for cannot be changed after the order was released")
+		}
+		return nil
+	}
+
+	if o.Status != "scheduled" && o.Status != "cancelled" {
+		return apierr.New(apierr.InvalidStatusTransition,
+			"scheduled order can only be cancelled; it becomes pending at scheduled_for")
+	}
+	if changed {
+		at := o.ScheduledFor.UTC()
+		o.ScheduledFor = &at
+		if v, bad := scheduleViolation(at, now); bad {
+			return apierr.Invalid(map[string]apierr.Violation{"scheduled_for": v})
+		}
+	}
+	return nil
+}
+
+// startScheduledPromoter раз в SCHEDULED_ORDERS_INTERVAL переводит
+// наступившие отложенные заказы в pending. Строки берутся через SKIP
+// LOCKED, поэтому реплики не мешают друг другу.
+func startScheduledPromoter(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(cfg.ScheduledOrdersInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			for {
+				n, err := promoteScheduledOrders(ctx)
+				if err != nil && ctx.Err() == nil {
+					log.Printf("⚠️ Scheduled order promotion failed: %v", err)
+				}
+				if err != nil || n < scheduledPromoteBatch {
+					break
+				}
+			}
+		}
+	}()
+	log.Printf("📅 Scheduled order promoter started (every %s)", cfg.ScheduledOrdersInterval)
+}
+
+// promoteScheduledOrders переводит одну пачку наступивших заказов в
+// pending вместе с их событиями и возвращает её размер.
+func promoteScheduledOrders(ctx context.Context) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`UPDATE orders SET status = 'pending', updated_at = NOW()
+		 WHERE id IN (
+		   SELECT id FROM orders WHERE status = 'scheduled' AND scheduled_for <= NOW()
+		   ORDER BY scheduled_for LIMIT $1 FOR UPDATE SKIP LOCKED
+		 ) RETURNING `+orderColumns, scheduledPromoteBatch)
+	if err != nil {
+		return 0, err
+	}
+	var promoted []Order
+	for rows.Next() {
+		var o Order
+		if err := scanOrder(rows, &o); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		promoted = append(promoted, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(promoted) == 0 {
+		return 0, err
+	}
+
+	for _, o := range promoted {
+		if err := recordOrderPlaced(tx, o); err != nil {
+			return 0, err
+		}
+		if err := recordStatusChange(tx, o); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	for _, o := range promoted {
+		orderCache.Delete(ctx, strconv.Itoa(o.ID))
+	}
+	log.Printf("📅 Released %d scheduled orders", len(promoted))
+	return len(promoted), nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"pkg/apierr"
+)
+
+func TestApplySchedule(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg.ScheduledOrderMaxAhead = 90 * 24 * time.Hour
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+
+	at := now.Add(30 * 24 * time.Hour)
+	o := Order{Status: "pending", ScheduledFor: &at}
+	if _, bad := applySchedule(&o, now); bad || o.Status != "scheduled" {
+		t.Errorf("30 days ahead: status %q, rejected %t", o.Status, bad)
+	}
+
+	for name, c := range map[string]struct {
+		at   time.Time
+		rule apierr.Rule
+	}{
+		"past":    {now.Add(-time.Minute), apierr.RuleFuture},
+		"now":     {now, apierr.RuleFuture},
+		"too far": {now.Add(91 * 24 * time.Hour), apierr.RuleMaxDaysAhead},
+	} {
+		o := Order{Status: "pending", ScheduledFor: &c.at}
+		if v, bad := applySchedule(&o, now); !bad || v.Rule != c.rule {
+			t.Errorf("%s: violation %+v, want %s", name, v, c.rule)
+		}
+	}
+
+	if v, bad := applySchedule(&Order{Status: "scheduled"}, now); !bad || v.Rule != apierr.RuleRequired {
+		t.Errorf("scheduled without date: %+v", v)
+	}
+}
+
+func TestCheckScheduleUpdate(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg.ScheduledOrderMaxAhead = 90 * 24 * time.Hour
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	at := now.Add(24 * time.Hour)
+	later := now.Add(48 * time.Hour)
+
+	// Отложенный заказ переносится и отменяется, но не подтверждается вручную.
+	if err := checkScheduleUpdate("scheduled", &at, &Order{Status: "scheduled", ScheduledFor: &later}, now); err != nil {
+		t.Errorf("reschedule: %v", err)
+	}
+	if err := checkScheduleUpdate("scheduled", &at, &Order{Status: "cancelled"}, now); err != nil {
+		t.Errorf("cancel: %v", err)
+	}
+	var e *apierr.Error
+	if err := checkScheduleUpdate("scheduled", &at, &Order{Status: "confirmed"}, now); !errors.As(err, &e) || e.Code != apierr.InvalidStatusTransition {
+		t.Errorf("confirm scheduled: %v", err)
+	}
+
+	// После перехода в pending дата не меняется; та же дата в теле допустима.
+	if err := checkScheduleUpdate("pending", &at, &Order{Status: "pending", ScheduledFor: &at}, now); err != nil {
+		t.Errorf("same date after release: %v", err)
+	}
+	if err := checkScheduleUpdate("pending", &at, &Order{Status: "pending", ScheduledFor: &later}, now); !errors.As(err, &e) || e.Code != apierr.InvalidState {
+		t.Errorf("reschedule after release: %v", err)
+	}
+	if err := checkScheduleUpdate("pending", nil, &Order{Status: "scheduled"}, now); !errors.As(err, &e) || e.Code != apierr.InvalidStatusTransition {
+		t.Errorf("schedule released order: %v", err)
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"context"
+
+	"pkg/seed"
+)
+
+// insertSeed вставляет демо-заказы для POST /admin/seed. События outbox
+// для них не создаются: платежи и доставки сидируются в своих сервисах
+// из того же набора.
+func insertSeed(ctx context.Context, ds seed.Dataset, reset bool) ([]seed.Report, error) {
+	rows := make([][]interface{}, 0, len(ds.Orders))
+	for _, o := range ds.Orders {
+		rows = append(rows, []interface{}{o.ID, o.UserID, o.TotalAmount, o.Status, o.ShippingAddress})
+	}
+	rep, err := seed.Insert(ctx, db, "orders", []string{"id", "user_id", "total_amount", "status", "shipping_address"}, rows, reset)
+	return []seed.Report{rep}, err
+}
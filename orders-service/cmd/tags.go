@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"pkg/apierr"
+)
+
+const (
+	maxOrderTags   = 10
+	maxOrderTagLen = 32
+)
+
+// normalizeTags приводит метки к нижнему регистру и убирает дубликаты,
+// сохраняя порядок. Ошибки возвращаются по полям: "tags" или "tags[i]".
+func normalizeTags(tags []string) ([]string, map[string]apierr.Violation) {
+	errs := map[string]apierr.Violation{}
+	out := make([]string, 0, len(tags))
+	seen := map[string]bool{}
+	for i, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		field := fmt.Sprintf("tags[%d]", i)
+		switch {
+		case t == "":
+			errs[field] = apierr.Violation{Rule: apierr.RuleRequired}
+		case utf8.RuneCountInString(t) > maxOrderTagLen:
+			errs[field] = apierr.Violation{Rule: apierr.RuleMaxLength, Limit: maxOrderTagLen}
+		case !seen[t]:
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	if len(out) > maxOrderTags {
+		errs["tags"] = apierr.Violation{Rule: apierr.RuleMaxItems, Limit: maxOrderTags}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return out, nil
+}
+
+// writeFieldErrors отвечает 422 с ошибками по полям.
+func writeFieldErrors(w http.ResponseWriter, errs map[string]apierr.Violation) {
+	apierr.Respond(w, apierr.Invalid(errs))
+}
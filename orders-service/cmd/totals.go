@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+)
+
+// itemsTotalSQL — сумма позиций из orders.items:
+// quantity × unit_price − discount по каждой позиции, не меньше нуля.
+const itemsTotalSQL = `GREATEST(COALESCE((
+	SELECT SUM((i->>'quantity')::numeric * (i->>'unit_price')::numeric - COALESCE((i->>'discount')::numeric, 0))
+	FROM jsonb_array_elements(orders.items) i
+), 0), 0)`
+
+// TotalCheck — сохранённая и вычисленная по позициям сумма заказа.
+type TotalCheck struct {
+	OrderID       int     `json:"order_id"`
+	StoredTotal   float64 `json:"stored_total"`
+	ComputedTotal float64 `json:"computed_total"`
+	Difference    float64 `json:"difference"`
+	Matches       bool    `json:"matches"`
+}
+
+// Recalculation — результат пересчёта суммы заказа.
+type Recalculation struct {
+	OrderID int     `json:"order_id"`
+	Before  float64 `json:"before"`
+	After   float64 `json:"after"`
+	Changed bool    `json:"changed"`
+}
+
+// recalculateTotal записывает в total_amount сумму позиций заказа. Вызывается
+// внутри транзакции, которая меняет items, чтобы сумма и позиции не
+// расходились.
+func recalculateTotal(ctx context.Context, tx *sql.Tx, id int) (Recalculation, error) {
+	rc := Recalculation{OrderID: id}
+	err := tx.QueryRowContext(ctx,
+		"SELECT total_amount, "+itemsTotalSQL+" FROM orders WHERE id = $1 FOR UPDATE", id,
+	).Scan(&rc.Before, &rc.After)
+	if err != nil {
+		return rc, err
+	}
+	rc.After = math.Round(rc.After*100) / 100
+	rc.Changed = rc.Before != rc.After
+	if !rc.Changed {
+		return rc, nil
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE orders SET total_amount = $1, updated_at = NOW() WHERE id = $2", rc.After, id)
+	return rc, err
+}
+
+// @Summary Order items
+// @Description Позиции заказа (orders.items) как есть; для архивного заказа — из архива
+// @Tags orders
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {array} object
+// @Failure 404 {object} map[string]string
+// @Router /orders/{id}/items [get]
+func getOrderItems(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	var items json.RawMessage
+	err := db.QueryRowContext(r.Context(),
+		`SELECT COALESCE(items, '[]'::jsonb) FROM orders WHERE id = $1
+		 UNION ALL SELECT COALESCE(items, '[]'::jsonb) FROM orders_archive WHERE id = $1 LIMIT 1`, id,
+	).Scan(&items)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.OrderNotFound, "Order not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(items)
+}
+
+// @Summary Recalculate order total
+// @Description Пересчитать total_amount как сумму позиций (quantity × unit_price − discount)
+// @Tags orders
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} Recalculation
+// @Failure 404 {object} map[string]string
+// @Router /orders/{id}/recalculate [post]
+func recalculateOrder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	rc, err := recalculateTotal(r.Context(), tx, id)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.OrderNotFound, "Order not found")
+		return
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if rc.Changed {
+		orderCache.Delete(r.Context(), strconv.Itoa(id))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rc)
+}
+
+// @Summary Verify order total
+// @Description Сравнить total_amount с суммой позиций, ничего не меняя
+// @Tags orders
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} TotalCheck
+// @Failure 404 {object} map[string]string
+// @Router /orders/{id}/verify-total [get]
+func verifyOrderTotal(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	c := TotalCheck{OrderID: id}
+	err := db.QueryRowContext(r.Context(),
+		"SELECT total_amount, "+itemsTotalSQL+" FROM orders WHERE id = $1", id,
+	).Scan(&c.StoredTotal, &c.ComputedTotal)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.OrderNotFound, "Order not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	c.ComputedTotal = math.Round(c.ComputedTotal*100) / 100
+	c.Difference = math.Round((c.StoredTotal-c.ComputedTotal)*100) / 100
+	c.Matches = c.Difference == 0
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+)
+
+// Long polling статуса заказа для клиентов без WebSocket и SSE. Запрос
+// ждёт события того же фида orderFeed, что и /orders/{id}/ws, а не
+// опрашивает базу. Время ожидания ограничено ORDER_WAIT_MAX_TIMEOUT,
+// число одновременно ждущих запросов на реплике — ORDER_WAIT_MAX_WAITERS.
+
+// defaultWaitTimeout — ожидание без параметра timeout.
+const defaultWaitTimeout = 30 * time.Second
+
+// statusRank — порядок статусов на пути заказа. Заказ, ушедший дальше
+// ожидаемого статуса, уже его прошёл; cancelled в этот путь не входит.
+var statusRank = map[string]int{"scheduled": 0, "pending": 1, "confirmed": 2, "shipped": 3, "delivered": 4}
+
+// statusReached — заказ в статусе current уже достиг want.
+func statusReached(current, want string) bool {
+	if current == want {
+		return true
+	}
+	c, okc := statusRank[current]
+	w, okw := statusRank[want]
+	return okc && okw && c >= w
+}
+
+// statusFinal — из current заказ больше никуда не перейдёт.
+func statusFinal(current string) bool {
+	return current == "delivered" || current == "cancelled"
+}
+
+// waitTimeout разбирает timeout запроса и ограничивает его сверху.
+func waitTimeout(raw string, maxTimeout time.Duration) (time.Duration, error) {
+	if raw == "" {
+		return min(defaultWaitTimeout, maxTimeout), nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		return 0, apierr.New(apierr.InvalidRequest, "timeout must be a positive duration, e.g. 30s")
+	}
+	return min(d, maxTimeout), nil
+}
+
+var orderWaiters int64
+
+// @Summary Wait for order status
+// @Description Long polling: держит запрос, пока заказ не перейдёт в status, и возвращает заказ. Если заказ уже в этом статусе или прошёл его (например, delivered при ожидании shipped), ответ сразу. Если заказ в конечном статусе (delivered, cancelled) и ожидаемого уже не достигнет — 409. Без изменения до timeout (по умолчанию 30s, не больше ORDER_WAIT_MAX_TIMEOUT) — 304 с Last-Modified и X-Order-Status текущего заказа. Одновременно ждущих запросов на реплике не больше ORDER_WAIT_MAX_WAITERS.
+// @Tags orders
+// @Produce json
+// @Param id path int true "Order ID"
+// @Param status query string true "Ожидаемый статус" Enums(scheduled, pending, confirmed, shipped, delivered, cancelled)
+// @Param timeout query string false "Сколько ждать, например 30s"
+// @Success 200 {object} OrderDetail
+// @Success 304 "Статус не изменился до timeout"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "Заказ в конечном статусе и ожидаемого не достигнет"
+// @Failure 503 {object} map[string]string "Исчерпан лимит ожидающих запросов"
+// @Router /orders/{id}/wait [get]
+func waitOrderStatus(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	want := r.URL.Query().Get("status")
+	if !slices.Contains(orderStatuses, want) {
+		apierr.Write(w, apierr.InvalidRequest, "status must be one of the order statuses")
+		return
+	}
+	timeout, err := waitTimeout(r.URL.Query().Get("timeout"), cfg.OrderWaitMaxTimeout)
+	if err != nil {
+		apierr.Respond(w, err)
+		return
+	}
+
+	if atomic.AddInt64(&orderWaiters, 1) > cfg.OrderWaitMaxWaiters {
+		atomic.AddInt64(&orderWaiters, -1)
+		w.Header().Set("Retry-After", wsRetryAfter)
+		apierr.Write(w, apierr.TooManyStreams, "Too many requests waiting for order status")
+		return
+	}
+	defer atomic.AddInt64(&orderWaiters, -1)
+
+	// Подписка до чтения заказа: смена статуса между чтением и подпиской
+	// не теряется.
+	events, unsubscribe := orderFeed.Subscribe(strconv.Itoa(id))
+	defer unsubscribe()
+
+	o, err := findOrder(r.Context(), id)
+	if err == sql.ErrNoRows {
+		orderNotFound(w, r, id)
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for !statusReached(o.Status, want) {
+		if statusFinal(o.Status) {
+			apierr.Write(w, apierr.InvalidState, "Order is "+o.Status+" and will not become "+want)
+			return
+		}
+		select {
+		case ev := <-events:
+			var change OrderStatusEvent
+			if json.Unmarshal(ev.Data, &change) != nil || change.Status == o.Status {
+				continue
+			}
+			// Промежуточный статус — ждём дальше; заказ целиком читается
+			// только для ответа.
+			if !statusReached(change.Status, want) && !statusFinal(change.Status) {
+				o.Status, o.UpdatedAt = change.Status, change.UpdatedAt
+				continue
+			}
+			if o, err = findOrder(r.Context(), id); err != nil {
+				if r.Context().Err() == nil {
+					apierr.Internal(w, err)
+				}
+				return
+			}
+		case <-deadline.C:
+			writeWaitTimeout(w, o)
+			return
+		case <-orderFeed.Done():
+			writeWaitTimeout(w, o)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	setLastModified(w, o)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orderDetail(o))
+}
+
+// writeWaitTimeout — ответ 304: статус не изменился до конца ожидания.
+func writeWaitTimeout(w http.ResponseWriter, o Order) {
+	setLastModified(w, o)
+	w.Header().Set("X-Order-Status", o.Status)
+	w.WriteHeader(http.StatusNotModified)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatusReached(t *testing.T) {
+	for _, c := range []struct {
+		current, want string
+		reached       bool
+	}{
+		{"shipped", "shipped", true},
+		{"delivered", "shipped", true},
+		{"confirmed", "shipped", false},
+		{"cancelled", "cancelled", true},
+		{"cancelled", "shipped", false},
+		{"delivered", "cancelled", false},
+	} {
+		if got := statusReached(c.current, c.want); got != c.reached {
+			t.Errorf("statusReached(%s, %s) = %t", c.current, c.want, got)
+		}
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	if d, err := waitTimeout("", time.Minute); err != nil || d != defaultWaitTimeout {
+		t.Errorf("default: %s, %v", d, err)
+	}
+	if d, err := waitTimeout("10m", time.Minute); err != nil || d != time.Minute {
+		t.Errorf("capped: %s, %v", d, err)
+	}
+	for _, raw := range []string{"soon", "-5s", "0s"} {
+		if _, err := waitTimeout(raw, time.Minute); err == nil {
+			t.Errorf("timeout %q accepted", raw)
+		}
+	}
+}
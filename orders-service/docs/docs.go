@@ -15,19 +15,42 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/health": {
-            "get": {
-                "description": "Проверка состояния сервиса",
+        "/admin/reports/daily/run": {
+            "post": {
+                "description": "Собрать сводку за день заново, сохранить и разослать на DIGEST_RECIPIENTS. 409, если сводку сейчас собирает другая реплика.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "health"
+                    "admin"
+                ],
+                "summary": "Generate daily digest",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "День (YYYY-MM-DD, UTC), по умолчанию вчера",
+                        "name": "date",
+                        "in": "query"
+                    }
                 ],
-                "summary": "Health check",
                 "responses": {
                     "200": {
                         "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.DailyDigest"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -38,60 +61,79 @@ const docTemplate = `{
                 }
             }
         },
-        "/orders": {
-            "get": {
-                "description": "Получить список всех заказов",
+        "/admin/retention/run": {
+            "post": {
+                "description": "Запустить очистку отменённых заказов старше ORDER_RETENTION; заказы с незавершённой сагой оформления пропускаются. dry_run=true только считает кандидатов. Требует X-Internal-API-Key.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "orders"
+                    "admin"
+                ],
+                "summary": "Run order retention",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "description": "Только посчитать (по умолчанию ORDER_RETENTION_DRY_RUN)",
+                        "name": "dry_run",
+                        "in": "query"
+                    }
                 ],
-                "summary": "Get all orders",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/main.Order"
+                            "$ref": "#/definitions/main.RetentionRun"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
                             }
                         }
                     }
                 }
-            },
-            "post": {
-                "description": "Создать новый заказ",
-                "consumes": [
-                    "application/json"
-                ],
+            }
+        },
+        "/dead-letters": {
+            "get": {
+                "description": "Исходящие запросы, исчерпавшие повторы (события outbox и т.п.). Фильтр по status: open или resolved. Нужны клиентский сертификат mTLS и X-Internal-API-Key.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "orders"
+                    "dead-letters"
                 ],
-                "summary": "Create order",
+                "summary": "List dead letters",
                 "parameters": [
                     {
-                        "description": "Order data",
-                        "name": "order",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/main.Order"
-                        }
+                        "type": "string",
+                        "description": "open | resolved",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Максимум записей (по умолчанию 100)",
+                        "name": "limit",
+                        "in": "query"
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.Order"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/deadletter.Letter"
+                            }
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "403": {
+                        "description": "Нет клиентского сертификата или X-Internal-API-Key",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -102,20 +144,20 @@ const docTemplate = `{
                 }
             }
         },
-        "/orders/{id}": {
-            "get": {
-                "description": "Получить заказ по ID",
+        "/dead-letters/{id}/replay": {
+            "post": {
+                "description": "Повторно отправить запрос с исходными заголовками (Idempotency-Key и др.). При ответе 2xx запись помечается resolved. Нужны клиентский сертификат mTLS и X-Internal-API-Key.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "orders"
+                    "dead-letters"
                 ],
-                "summary": "Get order by ID",
+                "summary": "Replay dead letter",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Order ID",
+                        "description": "Dead letter ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -125,7 +167,16 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.Order"
+                            "$ref": "#/definitions/deadletter.Letter"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет клиентского сертификата или X-Internal-API-Key",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
                         }
                     },
                     "404": {
@@ -136,48 +187,136 @@ const docTemplate = `{
                                 "type": "string"
                             }
                         }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/deadletter.Letter"
+                        }
                     }
                 }
-            },
-            "put": {
-                "description": "Обновить данные заказа",
-                "consumes": [
+            }
+        },
+        "/health": {
+            "get": {
+                "description": "Проверка состояния сервиса",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Health check",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/health/ready": {
+            "get": {
+                "description": "Готовность реплики принимать трафик: доступна БД (по фоновым проверкам DB_WATCHDOG_*, а не на каждый запрос) и не включён эксперимент chaos с unready. С READINESS_DEPENDENCY_CHECKS=true в ответе также закешированные фоновые проверки users-, payments-, delivery-service и очереди outbox: отказ некритичной зависимости даёт status degraded (200), критичной — unready (503).",
+                "produces": [
                     "application/json"
                 ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Readiness check",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.ReadinessReport"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ReadinessReport"
+                        }
+                    }
+                }
+            }
+        },
+        "/orders": {
+            "get": {
+                "description": "Получить список заказов страницами по 100 (offset). Повторяющийся параметр tag оставляет заказы, у которых есть все указанные метки. scheduled_before — отложенные заказы для планирования. ids — заказы по списку id (до 100), рабочие и архивные; удалённых в ответе нет.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "orders"
                 ],
-                "summary": "Update order",
+                "summary": "Get all orders",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Order ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Метка заказа",
+                        "name": "tag",
+                        "in": "query"
                     },
                     {
-                        "description": "Order data",
-                        "name": "order",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/main.Order"
-                        }
+                        "type": "boolean",
+                        "description": "Искать в архиве заказов",
+                        "name": "archived",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Только отложенные заказы (status scheduled) с scheduled_for раньше этого времени, RFC 3339; ближайшие первыми",
+                        "name": "scheduled_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "id заказов через запятую, до 100; не сочетается с другими фильтрами",
+                        "name": "ids",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Сдвиг страницы (по 100 заказов); ссылки на соседние страницы — в заголовке Link",
+                        "name": "offset",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.Order"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.Order"
+                            }
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "RFC 8288: rel=self, next (если страница полная), prev (если offset \u003e 0); без ids"
+                            }
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -187,27 +326,78 @@ const docTemplate = `{
                     }
                 }
             },
-            "delete": {
-                "description": "Удалить заказ",
+            "post": {
+                "description": "Создать новый заказ. Заказ с scheduled_for (в будущем, не дальше SCHEDULED_ORDER_MAX_AHEAD) создаётся в статусе scheduled и переходит в pending в назначенное время; события по нему ставятся тогда же. Для заказа с age_restricted возраст покупателя проверяется в users-service (MIN_CUSTOMER_AGE), решение пишется в историю заказа. Заказ с is_gift (или gift_message до 200 символов, управляющие символы удаляются) — подарок: в событиях для delivery-service нет суммы, поздравление печатается на этикетке; оба поля задаются только при создании.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
                     "orders"
                 ],
-                "summary": "Delete order",
+                "summary": "Create order",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Order ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Order data",
+                        "name": "order",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.Order"
+                        }
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Не проверять повтор заказа (ORDER_DUPLICATE_WINDOW)",
+                        "name": "allow_duplicate",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Не проверять MAX_OPEN_ORDERS_PER_USER (только с X-Internal-API-Key)",
+                        "name": "bypass_quota",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Не проверять MIN_ORDER_AMOUNT (только с X-Internal-API-Key)",
+                        "name": "bypass_min_amount",
+                        "in": "query"
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No Content"
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.OrderDetail"
+                        }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Повтор заказа; при превышении лимита — {code: open_order_limit_reached}",
+                        "schema": {
+                            "$ref": "#/definitions/main.Order"
+                        }
+                    },
+                    "422": {
+                        "description": "Ошибки полей; сумма меньше минимальной — {code: order_amount_below_minimum}; покупатель младше MIN_CUSTOMER_AGE — {code: age_requirement_not_met}",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "503": {
+                        "description": "Недоступен users-service (для age_restricted — при AGE_CHECK_FAILURE_MODE=closed)",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -218,45 +408,1631 @@ const docTemplate = `{
                 }
             }
         },
-        "/system-id": {
-            "get": {
-                "description": "Получить ID реплики для проверки балансировки",
+        "/orders/archive": {
+            "post": {
+                "description": "Перенести заказы в конечном статусе, не менявшиеся до даты before, в orders_archive (кроме заказов с незавершённой сагой оформления). Перенос идёт пачками, каждая в своей транзакции. Требует X-Internal-API-Key.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "system"
+                    "orders"
+                ],
+                "summary": "Archive orders",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Дата (YYYY-MM-DD или RFC 3339)",
+                        "name": "before",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "delivered (по умолчанию) или cancelled",
+                        "name": "status",
+                        "in": "query"
+                    }
                 ],
-                "summary": "Get system ID",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.SystemInfo"
+                            "$ref": "#/definitions/main.ArchiveRun"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "main.Order": {
-            "type": "object",
-            "required": [
-                "status",
-                "total_amount",
-                "user_id"
+        },
+        "/orders/bulk-delete": {
+            "post": {
+                "description": "Удалить заказы по фильтру (status, user_id, from/to по created_at, tags). dry_run обязателен: true возвращает число и первые id, false удаляет пачками, каждая в своей транзакции. Удалённые заказы переносятся в orders_deleted; заказы с незавершённой сагой оформления не удаляются и не считаются. Больше BULK_DELETE_CAP заказов — только с confirm_over_cap. Каждый вызов пишется в журнал аудита. Требует X-Internal-API-Key.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Bulk delete orders",
+                "parameters": [
+                    {
+                        "description": "Фильтр и флаги",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.BulkDeleteRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.BulkDeleteResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "code: bulk_delete_over_cap",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/checkout": {
+            "post": {
+                "description": "Оформление заказа одной операцией: создание заказа, оплата в payments-service и создание доставки в delivery-service. При ошибке выполняется компенсация (возврат платежа, отмена заказа). Повтор с тем же Idempotency-Key возвращает результат завершённой саги, а пока сага выполняется — 409 idempotency_in_progress.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Checkout",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Ключ идемпотентности оформления",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Checkout data",
+                        "name": "checkout",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.CheckoutRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.CheckoutResult"
+                        }
+                    },
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.CheckoutResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Оформление выключено флагом checkout_saga",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "code: idempotency_in_progress — сага с тем же Idempotency-Key ещё выполняется",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/main.CheckoutResult"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.CheckoutResult"
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/config": {
+            "get": {
+                "description": "Валюты, минимальная сумма заказа (MIN_ORDER_AMOUNT) и минимальный возраст покупателя для заказов с age_restricted (MIN_CUSTOMER_AGE), чтобы клиент мог проверить заказ до отправки",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Order config",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.OrderConfig"
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/counts": {
+            "get": {
+                "description": "Количество заказов по статусам одним запросом. Фильтры: user_id, from и to (RFC 3339 или YYYY-MM-DD, по created_at).",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Order counts by status",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Начало периода (включительно)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Конец периода (не включительно)",
+                        "name": "to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.OrderCounts"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/import": {
+            "post": {
+                "description": "Импорт заказов из старой системы: multipart-поле file, CSV с заголовком user_id,total_amount,status,created_at (необязательно currency, shipping_address). Файл читается потоком и записывается пачками по 500 строк; created_at сохраняется из файла. Номер последней записанной строки хранится под import_id: повторная загрузка того же файла с тем же import_id пропускает уже записанные строки. verify_users=true проверяет пользователей в users-service. Ошибочные строки не импортируются и перечисляются в ответе (первые 1000). Заказы импортируются без событий и уведомлений. Требует X-Internal-API-Key.",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Import orders from CSV",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Id загрузки для продолжения: буквы, цифры, . _ -, до 100 символов",
+                        "name": "import_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Проверить user_id в users-service",
+                        "name": "verify_users",
+                        "in": "query"
+                    },
+                    {
+                        "type": "file",
+                        "description": "CSV с заказами",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.ImportResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Ошибка формата файла; last_line — до какой строки записано",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "409": {
+                        "description": "Загрузка с этим import_id уже идёт",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "503": {
+                        "description": "users-service недоступен; last_line — до какой строки записано",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/{id}": {
+            "get": {
+                "description": "Получить заказ по ID",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Get order by ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "delivery_eta — добавить delivery_status и estimated_delivery из delivery-service",
+                        "name": "include",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.OrderDetail"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Обновить данные заказа. Отложенный заказ (scheduled) можно перенести (scheduled_for) или отменить, но не перевести в другой статус; после перехода в pending scheduled_for не меняется.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Update order",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Order data",
+                        "name": "order",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.Order"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Обновить, только если заказ не менялся после этой даты (значение Last-Modified)",
+                        "name": "If-Unmodified-Since",
+                        "in": "header"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Не проверять MIN_ORDER_AMOUNT при смене суммы (только с X-Internal-API-Key)",
+                        "name": "bypass_min_amount",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.OrderDetail"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Запрещённый переход из scheduled или в него; смена scheduled_for после перехода в pending",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Ошибки полей; новая сумма меньше минимальной — {code: order_amount_below_minimum}",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "503": {
+                        "description": "Конкурирующее изменение той же записи; запрос можно повторить",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Удалить заказ. Перед удалением payments-service и delivery-service проверяются на записи заказа: незавершённые платежи (всё, кроме failed, refunded, voided) и доставки (кроме delivered, failed) дают 409 со списком в blocking. force=true (только с X-Internal-API-Key) удаляет заказ всё равно и отправляет событие order.force_deleted, по которому сервисы помечают свои записи. Если проверить зависимости не удалось — 503, заказ не удаляется.",
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Delete order",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Удалить несмотря на незавершённые платежи и доставки; требует X-Internal-API-Key",
+                        "name": "force",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "401": {
+                        "description": "force=true без X-Internal-API-Key",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "code: order_has_dependencies, список в blocking; invalid_state — по заказу ещё идёт сага оформления",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "503": {
+                        "description": "code: dependency_unavailable — зависимости не проверить",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Частичное обновление заказа по JSON Merge Patch (RFC 7386): поля, которых нет в теле, не меняются; null допустим только для tags и scheduled_for (сбрасывает их), для остальных полей — 422. Патч накладывается на текущую версию под блокировкой строки, дальше действуют те же проверки, что и у PUT (If-Unmodified-Since, неизменная валюта, переходы scheduled, MIN_ORDER_AMOUNT).",
+                "consumes": [
+                    "application/json",
+                    "application/merge-patch+json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Patch order",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Изменяемые поля заказа",
+                        "name": "patch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.Order"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Обновить, только если заказ не менялся после этой даты (значение Last-Modified)",
+                        "name": "If-Unmodified-Since",
+                        "in": "header"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Не проверять MIN_ORDER_AMOUNT при смене суммы (только с X-Internal-API-Key)",
+                        "name": "bypass_min_amount",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.OrderDetail"
+                        }
+                    },
+                    "400": {
+                        "description": "Тело — не JSON-объект",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Запрещённый переход из scheduled или в него; смена scheduled_for после перехода в pending",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Ошибки полей (в том числе null для обязательного поля); новая сумма меньше минимальной — {code: order_amount_below_minimum}",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "503": {
+                        "description": "Конкурирующее изменение той же записи; запрос можно повторить",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/{id}/history": {
+            "get": {
+                "description": "Решения по заказу: проверки возраста покупателя для заказов с age_restricted (age_verified, age_requirement_not_met, age_check_failed, age_check_skipped), кто и когда. Старые сначала.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Order history",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.HistoryEntry"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/{id}/items": {
+            "get": {
+                "description": "Позиции заказа (orders.items) как есть; для архивного заказа — из архива",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Order items",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "object"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/{id}/payment-completed": {
+            "post": {
+                "description": "Внутренний вызов payments-service: платёж по заказу проведён. Заказ в pending переводится в confirmed; в любом другом статусе вызов ничего не меняет, поэтому повтор безопасен.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Payment completed",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Payment",
+                        "name": "event",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.PaymentCompleted"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.Order"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/{id}/recalculate": {
+            "post": {
+                "description": "Пересчитать total_amount как сумму позиций (quantity × unit_price − discount)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Recalculate order total",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.Recalculation"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/{id}/verify-total": {
+            "get": {
+                "description": "Сравнить total_amount с суммой позиций, ничего не меняя",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Verify order total",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.TotalCheck"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/{id}/wait": {
+            "get": {
+                "description": "Long polling: держит запрос, пока заказ не перейдёт в status, и возвращает заказ. Если заказ уже в этом статусе или прошёл его (например, delivered при ожидании shipped), ответ сразу. Если заказ в конечном статусе (delivered, cancelled) и ожидаемого уже не достигнет — 409. Без изменения до timeout (по умолчанию 30s, не больше ORDER_WAIT_MAX_TIMEOUT) — 304 с Last-Modified и X-Order-Status текущего заказа. Одновременно ждущих запросов на реплике не больше ORDER_WAIT_MAX_WAITERS.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Wait for order status",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "scheduled",
+                            "pending",
+                            "confirmed",
+                            "shipped",
+                            "delivered",
+                            "cancelled"
+                        ],
+                        "type": "string",
+                        "description": "Ожидаемый статус",
+                        "name": "status",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Сколько ждать, например 30s",
+                        "name": "timeout",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.OrderDetail"
+                        }
+                    },
+                    "304": {
+                        "description": "Статус не изменился до timeout"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Заказ в конечном статусе и ожидаемого не достигнет",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "503": {
+                        "description": "Исчерпан лимит ожидающих запросов",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/{id}/ws": {
+            "get": {
+                "description": "WebSocket: текущий статус заказа и все последующие изменения. Из браузера — только со своего хоста или из WS_ALLOWED_ORIGINS (иначе 403).",
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Order status stream",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "Switching Protocols"
+                    },
+                    "403": {
+                        "description": "Origin не разрешён"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/ready": {
+            "get": {
+                "description": "Готовность реплики принимать трафик: доступна БД (по фоновым проверкам DB_WATCHDOG_*, а не на каждый запрос) и не включён эксперимент chaos с unready. С READINESS_DEPENDENCY_CHECKS=true в ответе также закешированные фоновые проверки users-, payments-, delivery-service и очереди outbox: отказ некритичной зависимости даёт status degraded (200), критичной — unready (503).",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Readiness check",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.ReadinessReport"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ReadinessReport"
+                        }
+                    }
+                }
+            }
+        },
+        "/reports/daily": {
+            "get": {
+                "description": "Сохранённая ежедневная сводка: заказы, выручка и доля успешных платежей, доставки, частые причины неудач. Раздел недоступного при сборке сервиса равен null, причина — в unavailable. Требует X-Internal-API-Key.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reports"
+                ],
+                "summary": "Daily digest",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "День (YYYY-MM-DD, UTC), по умолчанию вчера",
+                        "name": "date",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.DailyDigest"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "code: report_not_found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/system-id": {
+            "get": {
+                "description": "Получить ID реплики для проверки балансировки",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "system"
+                ],
+                "summary": "Get system ID",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.SystemInfo"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "deadletter.Letter": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "headers": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "method": {
+                    "type": "string"
+                },
+                "payload": {
+                    "type": "string"
+                },
+                "resolved_at": {
+                    "type": "string"
+                },
+                "source": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "target_url": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.ArchiveRun": {
+            "type": "object",
+            "properties": {
+                "archived": {
+                    "type": "integer"
+                },
+                "before": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.BulkDeleteRequest": {
+            "type": "object",
+            "properties": {
+                "confirm_over_cap": {
+                    "description": "ConfirmOverCap разрешает удалить больше BULK_DELETE_CAP заказов.",
+                    "type": "boolean"
+                },
+                "dry_run": {
+                    "description": "DryRun обязателен: true — только посчитать, false — удалить.",
+                    "type": "boolean"
+                },
+                "from": {
+                    "type": "string",
+                    "example": "2026-01-01"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "to": {
+                    "type": "string",
+                    "example": "2026-02-01"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.BulkDeleteResult": {
+            "type": "object",
+            "properties": {
+                "deleted": {
+                    "type": "integer"
+                },
+                "dry_run": {
+                    "type": "boolean"
+                },
+                "matched": {
+                    "type": "integer"
+                },
+                "sample_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "main.CheckoutRequest": {
+            "type": "object",
+            "required": [
+                "payment_method",
+                "shipping_address",
+                "total_amount",
+                "user_id"
+            ],
+            "properties": {
+                "currency": {
+                    "type": "string"
+                },
+                "payment_method": {
+                    "type": "string",
+                    "enum": [
+                        "card",
+                        "cash",
+                        "paypal"
+                    ]
+                },
+                "shipping_address": {
+                    "type": "string",
+                    "maxLength": 500
+                },
+                "total_amount": {
+                    "type": "number"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.CheckoutResult": {
+            "type": "object",
+            "properties": {
+                "compensations": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "delivery_id": {
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "failed_step": {
+                    "type": "string"
+                },
+                "order_id": {
+                    "type": "integer"
+                },
+                "payment_id": {
+                    "type": "integer"
+                },
+                "saga_id": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.DailyDigest": {
+            "type": "object",
+            "properties": {
+                "date": {
+                    "type": "string"
+                },
+                "deliveries": {
+                    "$ref": "#/definitions/main.DigestDeliveries"
+                },
+                "generated_at": {
+                    "type": "string"
+                },
+                "orders": {
+                    "$ref": "#/definitions/main.DigestOrders"
+                },
+                "payments": {
+                    "$ref": "#/definitions/main.DigestPayments"
+                },
+                "recipients": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "send_error": {
+                    "type": "string"
+                },
+                "sent_at": {
+                    "type": "string"
+                },
+                "top_failure_reasons": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.DigestFailureReason"
+                    }
+                },
+                "unavailable": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "main.DependencyCheck": {
+            "type": "object",
+            "properties": {
+                "checked_at": {
+                    "type": "string"
+                },
+                "critical": {
+                    "type": "boolean"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "latency_ms": {
+                    "type": "integer"
+                },
+                "pending": {
+                    "description": "Pending — число неотправленных событий (только для outbox).",
+                    "type": "integer"
+                },
+                "status": {
+                    "description": "up, down или unknown (ещё не проверялась)",
+                    "type": "string"
+                }
+            }
+        },
+        "main.DigestDeliveries": {
+            "type": "object",
+            "properties": {
+                "delivered": {
+                    "type": "integer"
+                },
+                "failed": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.DigestFailureReason": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "source": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.DigestOrders": {
+            "type": "object",
+            "properties": {
+                "by_status": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.DigestPayments": {
+            "type": "object",
+            "properties": {
+                "completed": {
+                    "type": "integer"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "revenue": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "number",
+                        "format": "float64"
+                    }
+                },
+                "success_rate": {
+                    "type": "number"
+                }
+            }
+        },
+        "main.HistoryEntry": {
+            "type": "object",
+            "properties": {
+                "actor": {
+                    "type": "string"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "detail": {
+                    "type": "string"
+                },
+                "event": {
+                    "type": "string",
+                    "example": "age_verified"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "order_id": {
+                    "type": "integer"
+                },
+                "request_id": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.ImportResult": {
+            "type": "object",
+            "properties": {
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.ImportRowError"
+                    }
+                },
+                "errors_truncated": {
+                    "type": "boolean"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "import_id": {
+                    "type": "string"
+                },
+                "imported": {
+                    "type": "integer"
+                },
+                "last_line": {
+                    "description": "LastLine — последняя зафиксированная строка файла (заголовок — 1).",
+                    "type": "integer"
+                },
+                "skipped": {
+                    "type": "integer"
+                },
+                "total_failed": {
+                    "type": "integer"
+                },
+                "total_imported": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.ImportRowError": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "line": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.Link": {
+            "type": "object",
+            "properties": {
+                "href": {
+                    "type": "string"
+                },
+                "method": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.Order": {
+            "type": "object",
+            "required": [
+                "status",
+                "total_amount",
+                "user_id"
+            ],
+            "properties": {
+                "age_restricted": {
+                    "description": "AgeRestricted — в заказе товары 18+: задаётся при создании и дальше\nне меняется.",
+                    "type": "boolean"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "gift_message": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "is_gift": {
+                    "description": "IsGift — заказ-подарок: в событиях для delivery-service нет суммы, на\nэтикетке печатается GiftMessage (до 200 символов). Оба поля задаются\nпри создании и дальше не меняются.",
+                    "type": "boolean"
+                },
+                "scheduled_for": {
+                    "description": "ScheduledFor — время исполнения отложенного заказа: до него заказ в\nстатусе scheduled, затем переходит в pending.",
+                    "type": "string"
+                },
+                "shipping_address": {
+                    "type": "string",
+                    "maxLength": 500
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "scheduled",
+                        "pending",
+                        "confirmed",
+                        "shipped",
+                        "delivered",
+                        "cancelled"
+                    ]
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "total_amount": {
+                    "type": "number"
+                },
+                "updatedAt": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.OrderConfig": {
+            "type": "object",
+            "properties": {
+                "currencies": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "default_currency": {
+                    "type": "string",
+                    "example": "RUB"
+                },
+                "min_customer_age": {
+                    "description": "Минимальный возраст покупателя заказа с age_restricted; 0 — без\nпроверки.",
+                    "type": "integer",
+                    "example": 18
+                },
+                "min_order_amount": {
+                    "description": "Минимальная сумма заказа по валютам; валюты без минимума не указаны.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "number",
+                        "format": "float64"
+                    }
+                }
+            }
+        },
+        "main.OrderCounts": {
+            "type": "object",
+            "properties": {
+                "counts": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.OrderDetail": {
+            "type": "object",
+            "required": [
+                "status",
+                "total_amount",
+                "user_id"
             ],
             "properties": {
+                "_links": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/main.Link"
+                    }
+                },
+                "age_restricted": {
+                    "description": "AgeRestricted — в заказе товары 18+: задаётся при создании и дальше\nне меняется.",
+                    "type": "boolean"
+                },
+                "archived": {
+                    "type": "boolean"
+                },
                 "createdAt": {
                     "type": "string"
                 },
+                "currency": {
+                    "type": "string"
+                },
+                "delivery_status": {
+                    "type": "string"
+                },
+                "estimated_delivery": {
+                    "type": "string"
+                },
+                "gift_message": {
+                    "type": "string"
+                },
                 "id": {
                     "type": "integer"
                 },
+                "is_gift": {
+                    "description": "IsGift — заказ-подарок: в событиях для delivery-service нет суммы, на\nэтикетке печатается GiftMessage (до 200 символов). Оба поля задаются\nпри создании и дальше не меняются.",
+                    "type": "boolean"
+                },
+                "meta": {
+                    "$ref": "#/definitions/main.ResponseMeta"
+                },
+                "scheduled_for": {
+                    "description": "ScheduledFor — время исполнения отложенного заказа: до него заказ в\nстатусе scheduled, затем переходит в pending.",
+                    "type": "string"
+                },
+                "shipping_address": {
+                    "type": "string",
+                    "maxLength": 500
+                },
                 "status": {
                     "type": "string",
                     "enum": [
+                        "scheduled",
                         "pending",
                         "confirmed",
                         "shipped",
@@ -264,6 +2040,12 @@ const docTemplate = `{
                         "cancelled"
                     ]
                 },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
                 "total_amount": {
                     "type": "number"
                 },
@@ -275,6 +2057,77 @@ const docTemplate = `{
                 }
             }
         },
+        "main.PaymentCompleted": {
+            "type": "object",
+            "properties": {
+                "payment_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.ReadinessReport": {
+            "type": "object",
+            "properties": {
+                "dependencies": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/main.DependencyCheck"
+                    }
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "replica_id": {
+                    "type": "string"
+                },
+                "status": {
+                    "description": "ready, degraded или unready",
+                    "type": "string"
+                }
+            }
+        },
+        "main.Recalculation": {
+            "type": "object",
+            "properties": {
+                "after": {
+                    "type": "number"
+                },
+                "before": {
+                    "type": "number"
+                },
+                "changed": {
+                    "type": "boolean"
+                },
+                "order_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.ResponseMeta": {
+            "type": "object",
+            "properties": {
+                "warnings": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "main.RetentionRun": {
+            "type": "object",
+            "properties": {
+                "cutoff": {
+                    "type": "string"
+                },
+                "dry_run": {
+                    "type": "boolean"
+                },
+                "orders": {
+                    "type": "integer"
+                }
+            }
+        },
         "main.SystemInfo": {
             "type": "object",
             "properties": {
@@ -285,6 +2138,26 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "main.TotalCheck": {
+            "type": "object",
+            "properties": {
+                "computed_total": {
+                    "type": "number"
+                },
+                "difference": {
+                    "type": "number"
+                },
+                "matches": {
+                    "type": "boolean"
+                },
+                "order_id": {
+                    "type": "integer"
+                },
+                "stored_total": {
+                    "type": "number"
+                }
+            }
         }
     }
 }`
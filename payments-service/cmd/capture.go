@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+	"pkg/audit"
+	"pkg/observe"
+	"pkg/pg"
+)
+
+// Авторизация и частичное списание. Платёж в pending — авторизация на
+// amount; POST /payments/{id}/capture списывает её частями (статус
+// partially_captured), пока остаток не исчерпан (completed) или не отменён
+// через POST /payments/{id}/void. Неиспользованный остаток отменяется
+// автоматически через AUTHORIZATION_EXPIRY после создания платежа: при
+// списанной части платёж становится completed, без неё — voided.
+// Возвраты, расчёты и споры считаются от списанной суммы, а не от amount.
+
+// capturedAmountExpr — списанная сумма платежа. captured_amount NULL у
+// платежей, проведённых целиком без capture: для них списан весь amount,
+// если платёж проведён.
+const capturedAmountExpr = "COALESCE(captured_amount, CASE WHEN status IN ('completed', 'disputed', 'refunded') THEN amount ELSE 0 END)"
+
+// capturedStatus — статусы, которые ставят только capture и void.
+func capturedStatus(status string) bool {
+	return status == "partially_captured" || status == "voided"
+}
+
+// CaptureRequest — тело POST /payments/{id}/capture. Amount 0 — весь
+// остаток авторизации.
+type CaptureRequest struct {
+	Amount float64 `json:"amount" example:"150.00"`
+}
+
+// authorization — авторизация платежа, прочитанная под блокировкой строки.
+type authorization struct {
+	amount    float64
+	captured  float64
+	status    string
+	expiresAt *time.Time
+}
+
+func lockAuthorization(ctx context.Context, tx *sql.Tx, id int) (authorization, error) {
+	var a authorization
+	err := tx.QueryRowContext(ctx,
+		"SELECT amount, "+capturedAmountExpr+", COALESCE(status, 'pending'), authorization_expires_at FROM payments WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", id).
+		Scan(&a.amount, &a.captured, &a.status, &a.expiresAt)
+	return a, err
+}
+
+// capturable — остаток авторизации, который ещё можно списать.
+func (a authorization) capturable() float64 {
+	return roundCents(a.amount - a.captured)
+}
+
+// active сообщает, что остаток авторизации ещё не отменён.
+func (a authorization) active() bool {
+	return a.status == "pending" || a.status == "partially_captured"
+}
+
+func (a authorization) notAuthorized() error {
+	return apierr.New(apierr.PaymentNotAuthorized, "payment is "+a.status+", not an open authorization")
+}
+
+// checkOpen возвращает payment_not_authorized, если по авторизации больше
+// нельзя списывать: платёж не в pending/partially_captured или срок
+// авторизации истёк (остаток отменит фоновая задача).
+func (a authorization) checkOpen(now time.Time) error {
+	if !a.active() {
+		return a.notAuthorized()
+	}
+	if a.expiresAt != nil && !now.Before(*a.expiresAt) {
+		return apierr.New(apierr.PaymentNotAuthorized, "authorization expired at "+a.expiresAt.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// planCapture проверяет списание amount (0 — весь остаток) и возвращает
+// списываемую сумму и статус платежа после него.
+func planCapture(a authorization, amount float64, now time.Time) (float64, string, error) {
+	if err := a.checkOpen(now); err != nil {
+		return 0, "", err
+	}
+	rest := a.capturable()
+	if amount == 0 {
+		amount = rest
+	}
+	amount = roundCents(amount)
+	if amount <= 0 {
+		return 0, "", apierr.New(apierr.ValidationFailed, "amount must be positive")
+	}
+	if amount > rest {
+		return 0, "", apierr.New(apierr.CaptureExceedsAuthorization,
+			fmt.Sprintf("capture of %.2f exceeds the remaining authorization %.2f", amount, rest)).
+			With("capturable", rest)
+	}
+	if amount == rest {
+		return amount, "completed", nil
+	}
+	return amount, "partially_captured", nil
+}
+
+// releaseStatus — статус платежа после отмены остатка авторизации.
+func releaseStatus(a authorization) string {
+	if a.captured > 0 {
+		return "completed"
+	}
+	return "voided"
+}
+
+// settleAuthorization записывает новую списанную сумму и статус, ставит
+// completed_at при переходе в completed и пишет смену в историю статусов
+// (каждое списание — отдельная запись, даже без смены статуса).
+func settleAuthorization(ctx context.Context, tx *sql.Tx, id int, a authorization, captured float64, status, actor, requestID, reason string) (Payment, error) {
+	var p Payment
+	err := scanPayment(tx.QueryRowContext(ctx,
+		`UPDATE payments SET captured_amount = $2, status = $3,
+		   completed_at = CASE WHEN $3 = 'completed' THEN NOW() ELSE completed_at END
+		 WHERE id = $1 RETURNING `+paymentColumns,
+		id, captured, status), &p)
+	if err != nil {
+		return p, err
+	}
+	return p, recordPaymentStatusBy(ctx, tx, actor, requestID, id, a.status, status, reason)
+}
+
+// @Summary Capture payment
+// @Description Списать часть или весь остаток авторизации (платёж в pending или partially_captured). Списывать можно несколько раз, пока остаток не исчерпан: тогда платёж переходит в completed. Каждое списание пишется в историю статусов.
+// @Tags payments
+// @Accept json
+// @Produce json
+// @Param id path int true "Payment ID"
+// @Param capture body CaptureRequest false "Сумма списания; без неё — весь остаток"
+// @Success 200 {object} Payment
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "code: payment_not_authorized"
+// @Failure 422 {object} map[string]interface{} "code: capture_exceeds_authorization, остаток — в capturable"
+// @Router /payments/{id}/capture [post]
+func capturePayment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	var in CaptureRequest
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil && !errors.Is(err, io.EOF) {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+
+	var p Payment
+	var amount float64
+	err := pg.Locked(r.Context(), db, func(tx *sql.Tx) error {
+		a, err := lockAuthorization(r.Context(), tx, id)
+		if err != nil {
+			return err
+		}
+		var status string
+		amount, status, err = planCapture(a, in.Amount, time.Now())
+		if err != nil {
+			return err
+		}
+		p, err = settleAuthorization(r.Context(), tx, id, a, roundCents(a.captured+amount), status,
+			audit.Actor(r), observe.RequestID(r.Context()),
+			fmt.Sprintf("captured %.2f of %.2f", amount, a.amount))
+		return err
+	})
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.PaymentNotFound, "Payment not found")
+		return
+	} else if err != nil {
+		apierr.Respond(w, err)
+		return
+	}
+	log.Printf("💳 Payment %d: captured %.2f (%.2f of %.2f)", id, amount, p.CapturedAmount, p.Amount)
+	if p.Status == "completed" {
+		notifyPaymentCompleted(p)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// @Summary Void payment authorization
+// @Description Отменить неиспользованный остаток авторизации. Если часть уже списана, платёж переходит в completed на списанную сумму, иначе — в voided.
+// @Tags payments
+// @Produce json
+// @Param id path int true "Payment ID"
+// @Success 200 {object} Payment
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "code: payment_not_authorized"
+// @Router /payments/{id}/void [post]
+func voidPayment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	var p Payment
+	err := pg.Locked(r.Context(), db, func(tx *sql.Tx) error {
+		a, err := lockAuthorization(r.Context(), tx, id)
+		if err != nil {
+			return err
+		}
+		// Истёкшую авторизацию тоже можно отменить вручную, не дожидаясь
+		// фоновой задачи.
+		if !a.active() {
+			return a.notAuthorized()
+		}
+		p, err = settleAuthorization(r.Context(), tx, id, a, a.captured, releaseStatus(a),
+			audit.Actor(r), observe.RequestID(r.Context()),
+			fmt.Sprintf("authorization voided, released %.2f", a.capturable()))
+		return err
+	})
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.PaymentNotFound, "Payment not found")
+		return
+	} else if err != nil {
+		apierr.Respond(w, err)
+		return
+	}
+	log.Printf("💳 Payment %d: authorization voided (%s, captured %.2f of %.2f)", id, p.Status, p.CapturedAmount, p.Amount)
+	if p.Status == "completed" {
+		notifyPaymentCompleted(p)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// authorizationExpiryBatch — сколько истёкших авторизаций отменяется в
+// одной транзакции.
+const authorizationExpiryBatch = 100
+
+// startAuthorizationExpiry раз в AUTHORIZATION_EXPIRY_INTERVAL отменяет
+// остаток истёкших авторизаций. Строки берутся через SKIP LOCKED, поэтому
+// реплики не мешают друг другу.
+func startAuthorizationExpiry(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(cfg.AuthorizationExpiryEvery)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			for {
+				n, err := expireAuthorizations(ctx)
+				if err != nil && ctx.Err() == nil {
+					log.Printf("⚠️ Authorization expiry failed: %v", err)
+				}
+				if err != nil || n < authorizationExpiryBatch {
+					break
+				}
+			}
+		}
+	}()
+	log.Printf("⏳ Authorization expiry started (after %s, every %s)", cfg.AuthorizationExpiry, cfg.AuthorizationExpiryEvery)
+}
+
+// expireAuthorizations отменяет одну пачку истёкших авторизаций и
+// возвращает её размер.
+func expireAuthorizations(ctx context.Context) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var ids []int64
+	err = tx.QueryRowContext(ctx,
+		`SELECT COALESCE(array_agg(id), '{}') FROM (
+		   SELECT id FROM payments
+		   WHERE status IN ('pending', 'partially_captured') AND authorization_expires_at <= NOW() AND deleted_at IS NULL
+		   ORDER BY authorization_expires_at LIMIT $1 FOR UPDATE SKIP LOCKED
+		 ) batch`, authorizationExpiryBatch).Scan(pg.Array(&ids))
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	var completed []Payment
+	for _, id := range ids {
+		a, err := lockAuthorization(ctx, tx, int(id))
+		if err != nil {
+			return 0, err
+		}
+		p, err := settleAuthorization(ctx, tx, int(id), a, a.captured, releaseStatus(a), "job:authorization-expiry", "",
+			fmt.Sprintf("authorization expired, released %.2f", a.capturable()))
+		if err != nil {
+			return 0, err
+		}
+		if p.Status == "completed" {
+			completed = append(completed, p)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	for _, p := range completed {
+		notifyPaymentCompleted(p)
+	}
+	log.Printf("⏳ Voided %d expired authorizations", len(ids))
+	return len(ids), nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"pkg/apierr"
+)
+
+func TestPlanCapture(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	later := now.Add(time.Hour)
+	a := authorization{amount: 250, captured: 100, status: "partially_captured", expiresAt: &later}
+
+	if amount, status, err := planCapture(a, 50, now); err != nil || amount != 50 || status != "partially_captured" {
+		t.Errorf("capture 50 = %v, %q, %v", amount, status, err)
+	}
+	// Без суммы списывается весь остаток, и авторизация исчерпана.
+	if amount, status, err := planCapture(a, 0, now); err != nil || amount != 150 || status != "completed" {
+		t.Errorf("capture rest = %v, %q, %v", amount, status, err)
+	}
+
+	var e *apierr.Error
+	_, _, err := planCapture(a, 150.01, now)
+	if !errors.As(err, &e) || e.Code != apierr.CaptureExceedsAuthorization {
+		t.Fatalf("over-capture: err = %v", err)
+	}
+
+	for name, a := range map[string]authorization{
+		"expired":  {amount: 250, status: "pending", expiresAt: &now},
+		"voided":   {amount: 250, status: "voided"},
+		"refunded": {amount: 250, captured: 250, status: "refunded"},
+	} {
+		if _, _, err := planCapture(a, 10, now); !errors.As(err, &e) || e.Code != apierr.PaymentNotAuthorized {
+			t.Errorf("%s: err = %v, want %s", name, err, apierr.PaymentNotAuthorized)
+		}
+	}
+}
+
+func TestReleaseStatus(t *testing.T) {
+	if s := releaseStatus(authorization{amount: 10, status: "pending"}); s != "voided" {
+		t.Errorf("nothing captured: %q", s)
+	}
+	if s := releaseStatus(authorization{amount: 10, captured: 4, status: "partially_captured"}); s != "completed" {
+		t.Errorf("partly captured: %q", s)
+	}
+}
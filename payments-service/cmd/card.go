@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"pkg/apierr"
+	"pkg/clients"
+	"pkg/redact"
+)
+
+// CardInput — данные карты из запроса на создание платежа. Номер нужен
+// только чтобы определить бренд и last4: tokenizeCard сразу заменяет его
+// токеном, и в базу, ответы и логи он не попадает.
+type CardInput = clients.CardInput
+
+// MethodDetails — маскированные реквизиты карты, хранятся в
+// payments.method_details.
+type MethodDetails = clients.MethodDetails
+
+// tokenizeCard проверяет карту и возвращает её маскированные реквизиты с
+// токеном вместо номера. Отказ в приёме карты — *apierr.Error; ошибки не
+// содержат номер.
+func tokenizeCard(c *CardInput, now time.Time) (*MethodDetails, error) {
+	pan := redact.Digits(c.Number)
+	if len(pan) < 13 || len(pan) > 19 || !redact.Luhn(pan) {
+		return nil, apierr.New(apierr.InvalidCardNumber, "card number is invalid")
+	}
+	if c.ExpMonth < 1 || c.ExpMonth > 12 || c.ExpYear < 2000 || c.ExpYear > 2100 {
+		return nil, apierr.New(apierr.InvalidCardExpiry, "card expiry month or year is invalid")
+	}
+	// Карта действует до конца месяца истечения.
+	if !now.Before(time.Date(c.ExpYear, time.Month(c.ExpMonth)+1, 1, 0, 0, 0, 0, time.UTC)) {
+		return nil, apierr.New(apierr.CardExpired, "card is expired")
+	}
+
+	token, err := newCardToken()
+	if err != nil {
+		return nil, err
+	}
+	return &MethodDetails{
+		Brand:    cardBrand(pan),
+		Last4:    pan[len(pan)-4:],
+		ExpMonth: c.ExpMonth,
+		ExpYear:  c.ExpYear,
+		Token:    token,
+	}, nil
+}
+
+// newCardToken выдаёт токен карты. Платёжного шлюза пока нет, поэтому
+// токен случайный и лишь занимает место токена шлюза.
+func newCardToken() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "tok_" + hex.EncodeToString(b), nil
+}
+
+func cardBrand(pan string) string {
+	prefix := func(n int) int {
+		v := 0
+		for _, c := range pan[:n] {
+			v = v*10 + int(c-'0')
+		}
+		return v
+	}
+	switch {
+	case strings.HasPrefix(pan, "4"):
+		return "visa"
+	case prefix(2) >= 51 && prefix(2) <= 55, prefix(4) >= 2221 && prefix(4) <= 2720:
+		return "mastercard"
+	case prefix(4) >= 2200 && prefix(4) <= 2204:
+		return "mir"
+	case strings.HasPrefix(pan, "34"), strings.HasPrefix(pan, "37"):
+		return "amex"
+	case strings.HasPrefix(pan, "62"):
+		return "unionpay"
+	}
+	return "unknown"
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"pkg/redact"
+)
+
+const testPAN = "4242424242424242"
+
+func TestTokenizeCardDropsPAN(t *testing.T) {
+	card := &CardInput{Number: "4242 4242 4242 4242", ExpMonth: 12, ExpYear: 2030}
+	d, err := tokenizeCard(card, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Brand != "visa" || d.Last4 != "4242" || !strings.HasPrefix(d.Token, "tok_") {
+		t.Errorf("details = %+v", d)
+	}
+	b, _ := json.Marshal(d)
+	if strings.Contains(string(b), testPAN) {
+		t.Fatalf("PAN in method_details: %s", b)
+	}
+}
+
+// TestCreatePaymentNeverStoresPAN — после POST /payments с картой номера
+// нет ни в строке payments, ни в ответе, ни в логе. Нужна
+// TEST_DATABASE_URL (см. locked_test.go).
+func TestCreatePaymentNeverStoresPAN(t *testing.T) {
+	openTestDB(t)
+	defaultCurrency = "RUB"
+	ordersServiceURL = ""
+
+	var logs bytes.Buffer
+	log.SetOutput(redact.Writer(&logs))
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	body := `{"order_id": 1, "amount": 10, "currency": "RUB", "status": "pending", "payment_method": "card",
+		"card": {"number": "` + testPAN + `", "exp_month": 12, "exp_year": 2099}}`
+	rec := httptest.NewRecorder()
+	createPayment(rec, httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader(body)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if strings.Contains(rec.Body.String(), testPAN) {
+		t.Fatalf("PAN in response: %s", rec.Body)
+	}
+	var p Payment
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM payment_status_history WHERE payment_id = $1", p.ID)
+		db.Exec("DELETE FROM payments WHERE id = $1", p.ID)
+	})
+
+	// Вся строка целиком, а не только method_details: номер не должен
+	// оказаться ни в одной колонке.
+	var row string
+	if err := db.QueryRow("SELECT row_to_json(p)::text FROM payments p WHERE id = $1", p.ID).Scan(&row); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(row, testPAN) {
+		t.Fatalf("PAN in stored row: %s", row)
+	}
+	var details MethodDetails
+	if err := db.QueryRow("SELECT method_details FROM payments WHERE id = $1", p.ID).Scan(&details); err != nil {
+		t.Fatal(err)
+	}
+	if details.Last4 != "4242" || details.Brand != "visa" || details.Token == "" {
+		t.Errorf("stored method_details = %+v", details)
+	}
+
+	// Лог, в который номер мог бы попасть в обход маскировки.
+	log.Printf("test: card %s", testPAN)
+	if strings.Contains(logs.String(), testPAN) {
+		t.Fatalf("PAN in log output: %s", logs.String())
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"pkg/config"
+)
+
+// Config — конфигурация payments-service. Загружается и проверяется при
+// старте (config.MustLoad); -print-config выводит её и завершает процесс.
+type Config struct {
+	config.Common
+	config.HTTPClient
+	config.Consistency
+
+	Port        string `env:"PORT" default:"8003"`
+	DatabaseURL string `env:"DATABASE_URL" required:"true"`
+	// REDIS_URL и CACHE_TTL читает pkg/cache, DEFAULT_CURRENCY — pkg/currency.
+	RedisURL        string        `env:"REDIS_URL" url:"true"`
+	CacheTTL        time.Duration `env:"CACHE_TTL" default:"60s"`
+	DefaultCurrency string        `env:"DEFAULT_CURRENCY" default:"RUB"`
+
+	// Без ORDERS_SERVICE_URL суммы заказов не проверяются, а уведомления
+	// orders-service отключены.
+	OrdersServiceURL      string        `env:"ORDERS_SERVICE_URL" url:"true"`
+	NotifyOrdersOnPayment bool          `env:"NOTIFY_ORDERS_ON_PAYMENT" default:"true"`
+	OrderTotalCacheTTL    time.Duration `env:"ORDER_TOTAL_CACHE_TTL" default:"15s" min:"1s"`
+	PaymentMethodLimits   string        `env:"PAYMENT_METHOD_LIMITS" default:"card:1:,cash::5000"`
+	// Остаток авторизации (pending, partially_captured) отменяется через
+	// AUTHORIZATION_EXPIRY после создания платежа; 0 — не отменяется.
+	AuthorizationExpiry      time.Duration `env:"AUTHORIZATION_EXPIRY" default:"168h" min:"0s"`
+	AuthorizationExpiryEvery time.Duration `env:"AUTHORIZATION_EXPIRY_INTERVAL" default:"1m" min:"1s"`
+	// SETTLEMENT_TIME — время суточной сверки, HH:MM по UTC.
+	SettlementTime string `env:"SETTLEMENT_TIME" default:"01:00"`
+
+	// Очистка неуспешных платежей старше FAILED_PAYMENT_RETENTION; пачки по
+	// BATCH_SIZE с паузой BATCH_PAUSE между ними.
+	FailedPaymentRetention      time.Duration `env:"FAILED_PAYMENT_RETENTION" default:"8760h" min:"1h"`
+	FailedPaymentRetentionEvery time.Duration `env:"FAILED_PAYMENT_RETENTION_INTERVAL" default:"24h" min:"1s"`
+	FailedPaymentRetentionDry   bool          `env:"FAILED_PAYMENT_RETENTION_DRY_RUN"`
+	FailedPaymentBatchSize      int           `env:"FAILED_PAYMENT_RETENTION_BATCH_SIZE" default:"500" min:"1"`
+	FailedPaymentBatchPause     time.Duration `env:"FAILED_PAYMENT_RETENTION_BATCH_PAUSE" default:"200ms" min:"0s"`
+
+	// Песочница: платёжный шлюз имитируется, новые платежи помечаются
+	// test=true, ответ шлюза приходит через SANDBOX_CALLBACK_DELAY.
+	PaymentsSandbox      bool          `env:"PAYMENTS_SANDBOX"`
+	SandboxCallbackDelay time.Duration `env:"SANDBOX_CALLBACK_DELAY" default:"2s" min:"0s"`
+
+	// Читает pkg/dedup.
+	ProcessedEventsRetention     time.Duration `env:"PROCESSED_EVENTS_RETENTION" default:"168h" min:"1s"`
+	ProcessedEventsPruneInterval time.Duration `env:"PROCESSED_EVENTS_PRUNE_INTERVAL" default:"1h" min:"1s"`
+}
+
+func (c *Config) Validate() []error {
+	var errs []error
+	if _, err := time.Parse("15:04", c.SettlementTime); err != nil {
+		errs = append(errs, fmt.Errorf("SETTLEMENT_TIME: %q is not HH:MM", c.SettlementTime))
+	}
+	if _, err := parseMethodLimits(c.PaymentMethodLimits); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+var cfg Config
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"pkg/consistency"
+)
+
+// paymentOrderMissing — платёж заказа, которого нет в orders-service.
+const paymentOrderMissing = "payment_order_missing"
+
+var consistencyChecker *consistency.Checker
+
+// startConsistencyCheck проверяет order_id неудалённых платежей по
+// orders-service (GET /orders?ids=, архивные заказы тоже находятся); без
+// ORDERS_SERVICE_URL проверять не с чем.
+func startConsistencyCheck(ctx context.Context) {
+	var checks []consistency.Check
+	if ordersServiceURL != "" {
+		checks = append(checks, consistency.Check{
+			Type:   paymentOrderMissing,
+			Table:  "payments",
+			Column: "order_id",
+			Where:  "deleted_at IS NULL",
+			Lookup: ordersClient.Existing,
+		})
+	} else {
+		log.Printf("ℹ️ ORDERS_SERVICE_URL not set, payment consistency check disabled")
+	}
+	consistencyChecker = consistency.New(db, cfg.Consistency, checks...)
+	consistencyChecker.Start(ctx)
+}
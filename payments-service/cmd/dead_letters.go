@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+	"pkg/deadletter"
+)
+
+var deadLetters *deadletter.Store
+
+// @Summary List dead letters
+// @Description Исходящие запросы, исчерпавшие повторы (события outbox и т.п.). Фильтр по status: open или resolved. Нужны клиентский сертификат mTLS и X-Internal-API-Key.
+// @Tags dead-letters
+// @Produce json
+// @Param status query string false "open | resolved"
+// @Param limit query int false "Максимум записей (по умолчанию 100)"
+// @Success 200 {array} deadletter.Letter
+// @Failure 403 {object} map[string]string "Нет клиентского сертификата или X-Internal-API-Key"
+// @Router /dead-letters [get]
+func listDeadLetters(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && status != deadletter.StatusOpen && status != deadletter.StatusResolved {
+		apierr.Write(w, apierr.InvalidRequest, "status must be open or resolved")
+		return
+	}
+	limit := 100
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= 1000 {
+		limit = v
+	}
+
+	letters, err := deadLetters.List(r.Context(), status, limit)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(letters)
+}
+
+// @Summary Replay dead letter
+// @Description Повторно отправить запрос с исходными заголовками (Idempotency-Key и др.). При ответе 2xx запись помечается resolved. Нужны клиентский сертификат mTLS и X-Internal-API-Key.
+// @Tags dead-letters
+// @Produce json
+// @Param id path int true "Dead letter ID"
+// @Success 200 {object} deadletter.Letter
+// @Failure 403 {object} map[string]string "Нет клиентского сертификата или X-Internal-API-Key"
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 502 {object} deadletter.Letter
+// @Router /dead-letters/{id}/replay [post]
+func replayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.ParseInt(vars["id"], 10, 64)
+
+	l, err := deadLetters.Replay(r.Context(), id)
+	switch {
+	case errors.Is(err, deadletter.ErrNotFound):
+		apierr.Write(w, apierr.DeadLetterNotFound, "Dead letter not found")
+		return
+	case errors.Is(err, deadletter.ErrAlreadyResolved):
+		apierr.Write(w, apierr.AlreadyResolved, "Dead letter already resolved")
+		return
+	case err != nil && l.ID == 0:
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		log.Printf("⚠️ Replay of dead letter %d failed: %v", id, err)
+		w.WriteHeader(http.StatusBadGateway)
+	} else {
+		log.Printf("♻️ Dead letter %d replayed to %s", id, l.TargetURL)
+	}
+	json.NewEncoder(w).Encode(l)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+)
+
+// Dispute — спор (chargeback), открытый банком по проведённому платежу.
+// Пока спор открыт, платёж в статусе disputed и не входит в расчёты;
+// проигранный спор возвращает платёж (refunded, refund_reason=chargeback),
+// выигранный — возвращает его в completed.
+type Dispute struct {
+	ID         int     `json:"id"`
+	PaymentID  int     `json:"payment_id"`
+	Amount     float64 `json:"amount"`
+	Reason     string  `json:"reason"`
+	Status     string  `json:"status" enums:"open,won,lost"`
+	CreatedAt  string  `json:"createdAt"`
+	ResolvedAt *string `json:"resolvedAt"`
+}
+
+// OpenDispute — тело POST /payments/{id}/disputes. Amount по умолчанию —
+// вся сумма платежа.
+type OpenDispute struct {
+	Amount float64 `json:"amount"`
+	Reason string  `json:"reason"`
+}
+
+// ResolveDispute — тело POST /disputes/{id}/resolve.
+type ResolveDispute struct {
+	Outcome string `json:"outcome" enums:"won,lost"`
+}
+
+const disputeColumns = "id, payment_id, amount, COALESCE(reason, ''), status, created_at, resolved_at"
+
+func scanDispute(row rowScanner, d *Dispute) error {
+	return row.Scan(&d.ID, &d.PaymentID, &d.Amount, &d.Reason, &d.Status, &d.CreatedAt, &d.ResolvedAt)
+}
+
+// @Summary Open dispute
+// @Description Открыть спор по проведённому платежу: платёж переходит в disputed. Сумма спора не больше списанной суммы платежа.
+// @Tags disputes
+// @Accept json
+// @Produce json
+// @Param id path int true "Payment ID"
+// @Param dispute body OpenDispute true "Dispute"
+// @Success 201 {object} Dispute
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "code: payment_not_completed"
+// @Failure 422 {object} map[string]string "code: invalid_dispute_amount"
+// @Router /payments/{id}/disputes [post]
+func openDispute(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	paymentID, _ := strconv.Atoi(vars["id"])
+
+	var in OpenDispute
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var amount float64
+	var status string
+	err = tx.QueryRowContext(r.Context(), "SELECT "+capturedAmountExpr+", status FROM payments WHERE id = $1 FOR UPDATE", paymentID).Scan(&amount, &status)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.PaymentNotFound, "Payment not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if status != "completed" {
+		apierr.Write(w, apierr.PaymentNotCompleted, fmt.Sprintf("disputes can only be opened on completed payments, payment is %s", status))
+		return
+	}
+	if in.Amount == 0 {
+		in.Amount = amount
+	}
+	if in.Amount < 0 || in.Amount-amount >= 0.005 {
+		apierr.Write(w, apierr.InvalidDisputeAmount, fmt.Sprintf("dispute amount %.2f must be positive and not exceed captured amount %.2f", in.Amount, amount))
+		return
+	}
+
+	var d Dispute
+	err = scanDispute(tx.QueryRowContext(r.Context(),
+		"INSERT INTO disputes (payment_id, amount, reason) VALUES ($1, $2, NULLIF($3, '')) RETURNING "+disputeColumns,
+		paymentID, in.Amount, in.Reason), &d)
+	if err == nil {
+		_, err = tx.ExecContext(r.Context(), "UPDATE payments SET status = 'disputed' WHERE id = $1", paymentID)
+	}
+	if err == nil {
+		err = recordPaymentStatus(r.Context(), tx, r, paymentID, status, "disputed", fmt.Sprintf("dispute %d opened", d.ID))
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	log.Printf("⚖️ Dispute %d opened on payment %d for %.2f", d.ID, paymentID, d.Amount)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(d)
+}
+
+// @Summary List payment disputes
+// @Description Споры по платежу, старые сначала
+// @Tags disputes
+// @Produce json
+// @Param id path int true "Payment ID"
+// @Success 200 {array} Dispute
+// @Failure 404 {object} map[string]string
+// @Router /payments/{id}/disputes [get]
+func getPaymentDisputes(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	paymentID, _ := strconv.Atoi(vars["id"])
+
+	var exists bool
+	if err := db.QueryRowContext(r.Context(), "SELECT EXISTS (SELECT 1 FROM payments WHERE id = $1)", paymentID).Scan(&exists); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if !exists {
+		apierr.Write(w, apierr.PaymentNotFound, "Payment not found")
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(), "SELECT "+disputeColumns+" FROM disputes WHERE payment_id = $1 ORDER BY id", paymentID)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	disputes := []Dispute{}
+	for rows.Next() {
+		var d Dispute
+		if err := scanDispute(rows, &d); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		disputes = append(disputes, d)
+	}
+	if err := rows.Err(); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(disputes)
+}
+
+// @Summary Resolve dispute
+// @Description Закрыть спор. won возвращает платёж в completed, lost — переводит в refunded с refund_reason=chargeback.
+// @Tags disputes
+// @Accept json
+// @Produce json
+// @Param id path int true "Dispute ID"
+// @Param resolution body ResolveDispute true "Outcome"
+// @Success 200 {object} Dispute
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /disputes/{id}/resolve [post]
+func resolveDispute(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	var in ResolveDispute
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	if in.Outcome != "won" && in.Outcome != "lost" {
+		apierr.Write(w, apierr.InvalidRequest, "outcome must be won or lost")
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var d Dispute
+	err = scanDispute(tx.QueryRowContext(r.Context(), "SELECT "+disputeColumns+" FROM disputes WHERE id = $1 FOR UPDATE", id), &d)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.DisputeNotFound, "Dispute not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if d.Status != "open" {
+		apierr.Write(w, apierr.AlreadyResolved, "Dispute already resolved")
+		return
+	}
+
+	err = scanDispute(tx.QueryRowContext(r.Context(),
+		"UPDATE disputes SET status = $1, resolved_at = NOW() WHERE id = $2 RETURNING "+disputeColumns, in.Outcome, id), &d)
+	// Если статус платежа уже сменили через PUT, он не трогается и смена
+	// не записывается в историю.
+	newStatus, query := "completed", "UPDATE payments SET status = 'completed' WHERE id = $1 AND status = 'disputed'"
+	if in.Outcome == "lost" {
+		newStatus, query = "refunded", "UPDATE payments SET status = 'refunded', refunded_at = NOW(), refund_reason = 'chargeback' WHERE id = $1 AND status = 'disputed'"
+	}
+	var res sql.Result
+	if err == nil {
+		res, err = tx.ExecContext(r.Context(), query, d.PaymentID)
+	}
+	if err == nil {
+		if n, _ := res.RowsAffected(); n == 1 {
+			err = recordPaymentStatus(r.Context(), tx, r, d.PaymentID, "disputed", newStatus, fmt.Sprintf("dispute %d %s", d.ID, d.Status))
+		}
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	log.Printf("⚖️ Dispute %d on payment %d %s", d.ID, d.PaymentID, d.Status)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"pkg/apierr"
+	"pkg/currency"
+)
+
+// ExchangeRate — курс from → to, действующий с effective_date до
+// следующего курса той же пары.
+type ExchangeRate struct {
+	From          string  `json:"from" example:"USD"`
+	To            string  `json:"to" example:"RUB"`
+	Rate          float64 `json:"rate" example:"92.5"`
+	EffectiveDate string  `json:"effective_date" example:"2026-10-01"`
+}
+
+// @Summary Set exchange rate
+// @Description Задать курс пары валют с даты. Курс на ту же дату перезаписывается. Используется в GET /payments/stats?convert_to=. Требует X-Internal-API-Key.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param rate body ExchangeRate true "Exchange rate"
+// @Success 200 {object} ExchangeRate
+// @Failure 400 {object} map[string]string
+// @Router /exchange-rates [put]
+func putExchangeRate(w http.ResponseWriter, r *http.Request) {
+	var er ExchangeRate
+	if err := json.NewDecoder(r.Body).Decode(&er); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	er.From, er.To = currency.Normalize(er.From), currency.Normalize(er.To)
+	if !currency.Valid(er.From) || !currency.Valid(er.To) || er.From == er.To {
+		apierr.Write(w, apierr.InvalidRequest, "from and to must be two different supported currencies")
+		return
+	}
+	if er.Rate <= 0 {
+		apierr.Write(w, apierr.InvalidRequest, "rate must be positive")
+		return
+	}
+	if _, err := time.Parse(settlementDateLayout, er.EffectiveDate); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, "effective_date must be YYYY-MM-DD")
+		return
+	}
+
+	_, err := db.ExecContext(r.Context(),
+		`INSERT INTO exchange_rates (from_currency, to_currency, rate, effective_date) VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (from_currency, to_currency, effective_date) DO UPDATE SET rate = EXCLUDED.rate, updated_at = NOW()`,
+		er.From, er.To, er.Rate, er.EffectiveDate)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(er)
+}
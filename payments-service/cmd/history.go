@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+	"pkg/audit"
+	"pkg/observe"
+)
+
+// StatusChange — запись payment_status_history. Таблица только
+// дополняется: UPDATE и DELETE запрещены триггером.
+type StatusChange struct {
+	ID        int64   `json:"id"`
+	PaymentID int     `json:"payment_id"`
+	OldStatus *string `json:"old_status"`
+	NewStatus string  `json:"new_status"`
+	Reason    string  `json:"reason"`
+	Actor     string  `json:"actor"`
+	RequestID string  `json:"request_id"`
+	CreatedAt string  `json:"createdAt"`
+}
+
+// recordPaymentStatus пишет смену статуса в транзакции, которая его
+// меняет. oldStatus "" — платёж только что создан.
+func recordPaymentStatus(ctx context.Context, tx *sql.Tx, r *http.Request, paymentID int, oldStatus, newStatus, reason string) error {
+	return recordPaymentStatusBy(ctx, tx, audit.Actor(r), observe.RequestID(r.Context()), paymentID, oldStatus, newStatus, reason)
+}
+
+// recordPaymentStatusBy — recordPaymentStatus вне HTTP-запроса, например
+// для фоновых задач.
+func recordPaymentStatusBy(ctx context.Context, tx *sql.Tx, actor, requestID string, paymentID int, oldStatus, newStatus, reason string) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO payment_status_history (payment_id, old_status, new_status, reason, actor, request_id)
+		 VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6)`,
+		paymentID, oldStatus, newStatus, reason, actor, requestID)
+	return err
+}
+
+// @Summary Payment status history
+// @Description Все смены статуса платежа: кто, с какого на какой, причина и время. Старые сначала.
+// @Tags payments
+// @Produce json
+// @Param id path int true "Payment ID"
+// @Success 200 {array} StatusChange
+// @Failure 404 {object} map[string]string
+// @Router /payments/{id}/status-history [get]
+func getPaymentStatusHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT id, payment_id, old_status, new_status, reason, actor, request_id, created_at
+		 FROM payment_status_history WHERE payment_id = $1 ORDER BY id`, id)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	history := []StatusChange{}
+	for rows.Next() {
+		var c StatusChange
+		if err := rows.Scan(&c.ID, &c.PaymentID, &c.OldStatus, &c.NewStatus, &c.Reason, &c.Actor, &c.RequestID, &c.CreatedAt); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		history = append(history, c)
+	}
+	if err := rows.Err(); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	// История переживает удаление платежа, поэтому 404 — только если нет
+	// ни истории, ни платежа.
+	if len(history) == 0 {
+		var exists bool
+		if err := db.QueryRowContext(r.Context(), "SELECT EXISTS (SELECT 1 FROM payments WHERE id = $1)", id).Scan(&exists); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		if !exists {
+			apierr.Write(w, apierr.PaymentNotFound, "Payment not found")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
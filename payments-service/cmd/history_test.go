@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"pkg/admin"
+)
+
+// historyFixture создаёт платёж с открытой авторизацией на 10.
+func historyFixture(t *testing.T) int {
+	t.Helper()
+	var id int
+	err := db.QueryRow(
+		"INSERT INTO payments (order_id, amount, currency, status, payment_method, authorization_expires_at) VALUES (1, 10, 'RUB', 'pending', 'card', NOW() + INTERVAL '1 hour') RETURNING id",
+	).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM disputes WHERE payment_id = $1", id)
+		db.Exec("DELETE FROM payments WHERE id = $1", id)
+	})
+	return id
+}
+
+// mutate выполняет handler с переменными пути vars; operator != "" —
+// запрос с внутренним ключом от имени оператора.
+func mutate(t *testing.T, handler http.HandlerFunc, method, target string, vars map[string]string, body, operator string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if operator != "" {
+		req.Header.Set(admin.APIKeyHeader, "test-key")
+		req.Header.Set(admin.ActorHeader, operator)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, mux.SetURLVars(req, vars))
+	if rec.Code >= 300 {
+		t.Fatalf("%s %s: status %d: %s", method, target, rec.Code, rec.Body)
+	}
+	return rec
+}
+
+// TestEveryMutationWritesOneHistoryRow — каждый путь смены статуса (PUT,
+// возврат, capture, void, открытие и закрытие спора) пишет в
+// payment_status_history ровно одну строку с тем, кто её сделал.
+func TestEveryMutationWritesOneHistoryRow(t *testing.T) {
+	openTestDB(t)
+	t.Setenv("INTERNAL_API_KEY", "test-key")
+
+	var seen int64
+	expect := func(id int, step, old, new, actor string) {
+		t.Helper()
+		rows, err := db.Query(
+			"SELECT id, COALESCE(old_status, ''), new_status, actor FROM payment_status_history WHERE payment_id = $1 AND id > $2 ORDER BY id",
+			id, seen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var n int
+		for rows.Next() {
+			var gotOld, gotNew, gotActor string
+			if err := rows.Scan(&seen, &gotOld, &gotNew, &gotActor); err != nil {
+				t.Fatal(err)
+			}
+			n++
+			if gotOld != old || gotNew != new || gotActor != actor {
+				t.Errorf("%s: %s → %s by %q, want %s → %s by %q", step, gotOld, gotNew, gotActor, old, new, actor)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Errorf("%s: %d history rows, want 1", step, n)
+		}
+	}
+
+	// PUT без ключа: актор — анонимный адрес (httptest: 192.0.2.1).
+	failed := historyFixture(t)
+	sid := strconv.Itoa(failed)
+	mutate(t, updatePayment, http.MethodPut, "/payments/"+sid, map[string]string{"id": sid},
+		`{"order_id": 1, "amount": 10, "status": "failed", "payment_method": "card"}`, "")
+	expect(failed, "PUT", "pending", "failed", "anonymous@192.0.2.1")
+
+	id := historyFixture(t)
+	sid = strconv.Itoa(id)
+	vars := map[string]string{"id": sid}
+
+	mutate(t, capturePayment, http.MethodPost, "/payments/"+sid+"/capture", vars, `{"amount": 4}`, "ops")
+	expect(id, "capture", "pending", "partially_captured", "api-key:ops")
+
+	// Частично списанный платёж PUT не меняет: только capture и void.
+	req := httptest.NewRequest(http.MethodPut, "/payments/"+sid,
+		strings.NewReader(`{"order_id": 1, "amount": 10, "status": "refunded", "payment_method": "card"}`))
+	put := httptest.NewRecorder()
+	updatePayment(put, mux.SetURLVars(req, vars))
+	if put.Code != http.StatusConflict {
+		t.Fatalf("PUT on partially_captured: status %d, want 409", put.Code)
+	}
+
+	mutate(t, voidPayment, http.MethodPost, "/payments/"+sid+"/void", vars, "", "ops")
+	expect(id, "void", "partially_captured", "completed", "api-key:ops")
+
+	rec := mutate(t, openDispute, http.MethodPost, "/payments/"+sid+"/disputes", vars, `{"reason": "not received"}`, "support")
+	expect(id, "open dispute", "completed", "disputed", "api-key:support")
+
+	var d Dispute
+	if err := json.NewDecoder(rec.Body).Decode(&d); err != nil {
+		t.Fatal(err)
+	}
+	did := strconv.Itoa(d.ID)
+	mutate(t, resolveDispute, http.MethodPost, "/disputes/"+did+"/resolve", map[string]string{"id": did}, `{"outcome": "won"}`, "support")
+	expect(id, "resolve dispute", "disputed", "completed", "api-key:support")
+
+	mutate(t, updatePayment, http.MethodPut, "/payments/"+sid, vars,
+		`{"order_id": 1, "amount": 10, "status": "refunded", "payment_method": "card"}`, "")
+	expect(id, "refund", "completed", "refunded", "anonymous@192.0.2.1")
+
+	// Повтор того же PUT статус не меняет и истории не пишет.
+	mutate(t, updatePayment, http.MethodPut, "/payments/"+sid, vars,
+		`{"order_id": 1, "amount": 10, "status": "refunded", "payment_method": "card"}`, "")
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM payment_status_history WHERE payment_id = $1 AND id > $2", id, seen).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("no-op PUT wrote %d history rows, want 0", n)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pkg/apierr"
+)
+
+// paymentMethods — допустимые способы оплаты в порядке вывода.
+var paymentMethods = []string{"card", "cash", "paypal"}
+
+// MethodLimits — границы суммы одного платежа для способа оплаты. nil —
+// граница не задана.
+type MethodLimits struct {
+	Method    string   `json:"method"`
+	MinAmount *float64 `json:"min_amount"`
+	MaxAmount *float64 `json:"max_amount"`
+}
+
+var methodLimits map[string]MethodLimits
+
+// initMethodLimits применяет PAYMENT_METHOD_LIMITS. Границы проверяются
+// только при создании платежа, поэтому их смена не затрагивает созданные
+// платежи.
+func initMethodLimits() error {
+	limits, err := parseMethodLimits(cfg.PaymentMethodLimits)
+	if err != nil {
+		return err
+	}
+	methodLimits = limits
+	return nil
+}
+
+// parseMethodLimits разбирает список "method:min:max" через запятую;
+// пустая граница не ограничивает.
+func parseMethodLimits(spec string) (map[string]MethodLimits, error) {
+	limits := make(map[string]MethodLimits, len(paymentMethods))
+	for _, m := range paymentMethods {
+		limits[m] = MethodLimits{Method: m}
+	}
+	for _, item := range strings.Split(spec, ",") {
+		parts := strings.Split(strings.TrimSpace(item), ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("PAYMENT_METHOD_LIMITS: %q is not method:min:max", item)
+		}
+		l, ok := limits[parts[0]]
+		if !ok {
+			return nil, fmt.Errorf("PAYMENT_METHOD_LIMITS: unknown payment method %q", parts[0])
+		}
+		for i, dst := range []**float64{&l.MinAmount, &l.MaxAmount} {
+			if parts[i+1] == "" {
+				continue
+			}
+			v, err := strconv.ParseFloat(parts[i+1], 64)
+			if err != nil || v < 0 {
+				return nil, fmt.Errorf("PAYMENT_METHOD_LIMITS: invalid bound %q for %s", parts[i+1], parts[0])
+			}
+			*dst = &v
+		}
+		if l.MinAmount != nil && l.MaxAmount != nil && *l.MinAmount > *l.MaxAmount {
+			return nil, fmt.Errorf("PAYMENT_METHOD_LIMITS: min exceeds max for %s", parts[0])
+		}
+		limits[parts[0]] = l
+	}
+	return limits, nil
+}
+
+// checkMethodLimits отвечает 422 с нарушенной границей и возвращает false,
+// если сумма вне границ способа оплаты.
+func checkMethodLimits(w http.ResponseWriter, p Payment) bool {
+	l := methodLimits[p.PaymentMethod]
+	var code apierr.Code
+	bound, field := 0.0, ""
+	switch {
+	case l.MinAmount != nil && p.Amount < *l.MinAmount:
+		code, bound, field = apierr.AmountBelowMinimum, *l.MinAmount, "min_amount"
+	case l.MaxAmount != nil && p.Amount > *l.MaxAmount:
+		code, bound, field = apierr.AmountAboveMaximum, *l.MaxAmount, "max_amount"
+	default:
+		return true
+	}
+
+	apierr.Respond(w, apierr.New(code,
+		fmt.Sprintf("amount %.2f is outside the %s limit %.2f for %s payments", p.Amount, field, bound, p.PaymentMethod)).
+		With("payment_method", p.PaymentMethod).
+		With(field, bound))
+	return false
+}
+
+// @Summary List payment methods
+// @Description Способы оплаты с границами суммы одного платежа (null — без ограничения), чтобы клиент мог проверить сумму заранее
+// @Tags payments
+// @Produce json
+// @Success 200 {array} MethodLimits
+// @Router /payment-methods [get]
+func getPaymentMethods(w http.ResponseWriter, r *http.Request) {
+	methods := make([]MethodLimits, 0, len(paymentMethods))
+	for _, m := range paymentMethods {
+		methods = append(methods, methodLimits[m])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(methods)
+}
@@ -1,29 +1,70 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
-	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	httpSwagger "github.com/swaggo/http-swagger"
-	_ "payments-service/docs"
+	"payments-service/docs"
+	"pkg/admin"
+	"pkg/apierr"
+	"pkg/audit"
+	"pkg/auth"
+	"pkg/cache"
+	"pkg/clients"
+	"pkg/config"
+	"pkg/currency"
+	"pkg/dbhealth"
+	"pkg/deadletter"
+	"pkg/dedup"
+	"pkg/flags"
+	"pkg/hmacsign"
+	"pkg/httpclient"
+	"pkg/limit"
+	"pkg/mode"
+	"pkg/mtls"
+	"pkg/observe"
+	"pkg/pg"
+	"pkg/ratelimit"
+	"pkg/redact"
+	"pkg/replica"
+	"pkg/seed"
+	"pkg/specvalidate"
 )
 
 var db *sql.DB
 
-type Payment struct {
-	ID            int     `json:"id"`
-	OrderID       int     `json:"order_id" validate:"required"`
-	Amount        float64 `json:"amount" validate:"required,gt=0"`
-	Status        string  `json:"status" validate:"required,oneof=pending completed failed refunded"`
-	PaymentMethod string  `json:"payment_method" validate:"required,oneof=card cash paypal"`
-	CreatedAt     string  `json:"createdAt"`
-	UpdatedAt     string  `json:"updatedAt"`
+// dbWatch следит за соединением с БД; пока его нет, запросы получают 503.
+var dbWatch *dbhealth.Watchdog
+var serviceMode *mode.Switch
+var featureFlags *flags.Set
+var ordersServiceURL string
+var defaultCurrency string
+var services *httpclient.Client
+var ordersClient *clients.Orders
+
+// Payment — общий контракт с клиентами (pkg/clients).
+type Payment = clients.Payment
+
+const paymentColumns = "id, order_id, amount, " + capturedAmountExpr + ", currency, status, payment_method, method_details, settlement_id, refund_reason, authorization_expires_at, deleted_at, test, created_at, updated_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPayment(row rowScanner, p *Payment) error {
+	return row.Scan(&p.ID, &p.OrderID, &p.Amount, &p.CapturedAmount, &p.Currency, &p.Status, &p.PaymentMethod, &p.MethodDetails, &p.SettlementID, &p.RefundReason, &p.AuthorizationExpiresAt, &p.DeletedAt, &p.Test, &p.CreatedAt, &p.UpdatedAt)
 }
 
 // @title Payments Service API
@@ -32,13 +73,12 @@ type Payment struct {
 // @host localhost:8004
 // @BasePath /
 func main() {
-	databaseURL := os.Getenv("DATABASE_URL")
-	if databaseURL == "" {
-		log.Fatal("DATABASE_URL not set")
-	}
+	// Номера карт не должны попадать в логи ни в каком виде.
+	log.SetOutput(redact.Writer(os.Stderr))
+	config.MustLoad("payments-service", &cfg)
 
 	var err error
-	db, err = sql.Open("postgres", databaseURL)
+	db, err = sql.Open(observe.DriverName, cfg.DatabaseURL)
 	if err != nil {
 		log.Fatalf("DB connection error: %v", err)
 	}
@@ -48,25 +88,136 @@ func main() {
 		log.Fatalf("DB ping error: %v", err)
 	}
 	log.Printf("✅ Connected to PostgreSQL (payments-service)")
+	// Ошибки ограничений БД — 409/422/503 вместо 500.
+	apierr.SetTranslator(pg.APIError)
+	dbWatch = dbhealth.FromEnv(db)
+
+	internalTLS, err := mtls.Load(mtls.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("mTLS config error: %v", err)
+	}
+	internalTLS.WatchSIGHUP()
+
+	signatures, err := hmacsign.VerifierFromEnv()
+	if err != nil {
+		log.Fatalf("HMAC verification config error: %v", err)
+	}
+
+	serviceMode, err = mode.FromEnv()
+	if err != nil {
+		log.Fatalf("Service mode config error: %v", err)
+	}
+	featureFlags, err = flags.FromEnv()
+	if err != nil {
+		log.Fatalf("Feature flags config error: %v", err)
+	}
+	featureFlags.Watch()
+	specValidator, err := specvalidate.FromEnv(docs.SwaggerInfo.ReadDoc())
+	if err != nil {
+		log.Fatalf("OpenAPI validation config error: %v", err)
+	}
+	defaultCurrency, err = currency.DefaultFromEnv()
+	if err != nil {
+		log.Fatalf("Currency config error: %v", err)
+	}
+	if err := initMethodLimits(); err != nil {
+		log.Fatalf("Payment method limits config error: %v", err)
+	}
+
+	port := cfg.Port
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8003"
+	ordersServiceURL = cfg.OrdersServiceURL
+	signer, err := hmacsign.SignerFromEnv()
+	if err != nil {
+		log.Fatalf("HMAC signing config error: %v", err)
+	}
+	clientCfg := httpclient.ConfigFromEnv()
+	clientCfg.TLS = internalTLS
+	clientCfg.Signer = signer
+	services = httpclient.New(clientCfg, "orders-service")
+	ordersClient = clients.NewOrders(services, ordersServiceURL)
+	deadLetters = deadletter.NewStore(db, services)
+	initPaymentNotify()
+
+	redisCache, err := cache.FromEnv("payments")
+	if err != nil {
+		log.Fatalf("Redis config error: %v", err)
 	}
+	defer redisCache.Close()
+	initOrderTotals(redisCache)
+
+	workers, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	dbWatch.Start(workers)
+	startSettlements(workers)
+	startPaymentRetention(workers)
+	startConsistencyCheck(workers)
+	dedup.StartPruner(workers, db)
+	if cfg.AuthorizationExpiry > 0 {
+		startAuthorizationExpiry(workers)
+	}
+
+	limiter := limit.FromEnv()
+	rateLimiter, err := ratelimit.FromEnv("payments")
+	if err != nil {
+		log.Fatalf("Rate limit config error: %v", err)
+	}
+	defer rateLimiter.Close()
 
 	router := mux.NewRouter()
+	router.Use(apierr.Localize)
+	router.Use(observe.Middleware())
+	router.Use(limiter.Middleware)
+	router.Use(dbWatch.Middleware())
+	router.Use(auth.Middleware())
+	router.Use(rateLimiter.Middleware)
+	router.Use(audit.Middleware(db, "/admin/", "/dead-letters/", "/exchange-rates"))
+	router.Use(serviceMode.Middleware)
+	router.Use(specValidator.Middleware)
 	router.HandleFunc("/health", healthCheck).Methods("GET")
+	router.HandleFunc("/ready", dbWatch.ReadyHandler).Methods("GET")
+	router.HandleFunc("/health/ready", dbWatch.ReadyHandler).Methods("GET")
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	router.HandleFunc("/errors/catalog", apierr.CatalogHandler).Methods("GET")
+	router.HandleFunc("/admin/mode", admin.RequireKey(serviceMode.Handler)).Methods("POST")
+	router.HandleFunc("/admin/concurrency", admin.RequireKey(limiter.Handler)).Methods("GET", "PUT")
+	router.HandleFunc("/admin/rate-limits/users/{id}", admin.RequireKey(rateLimiter.Handler)).Methods("GET", "PUT", "DELETE")
+	router.HandleFunc("/admin/flags", admin.RequireKey(featureFlags.Handler)).Methods("GET")
+	router.HandleFunc("/admin/seed", admin.RequireKey(seed.Handler(insertSeed))).Methods("POST")
+	router.HandleFunc("/admin/audit", admin.RequireKey(audit.Handler(db))).Methods("GET")
+	router.HandleFunc("/admin/settlements/run", admin.RequireKey(runSettlement)).Methods("POST")
+	router.HandleFunc("/admin/retention", admin.RequireKey(getRetentionStatus)).Methods("GET")
+	router.HandleFunc("/admin/retention/run", admin.RequireKey(runRetention)).Methods("POST")
+	router.HandleFunc("/admin/inconsistencies", admin.RequireKey(consistencyChecker.ListHandler)).Methods("GET")
+	router.HandleFunc("/admin/inconsistencies/check", admin.RequireKey(consistencyChecker.RunHandler)).Methods("POST")
+	router.HandleFunc("/exchange-rates", admin.RequireKey(putExchangeRate)).Methods("PUT")
+	router.HandleFunc("/payment-methods", getPaymentMethods).Methods("GET")
 	router.HandleFunc("/payments", getPayments).Methods("GET")
+	router.HandleFunc("/payments/summary", getPaymentSummary).Methods("GET")
+	router.HandleFunc("/payments/stats", getPaymentStats).Methods("GET")
 	router.HandleFunc("/payments/{id}", getPayment).Methods("GET")
 	router.HandleFunc("/payments", createPayment).Methods("POST")
 	router.HandleFunc("/payments/{id}", updatePayment).Methods("PUT")
 	router.HandleFunc("/payments/{id}", deletePayment).Methods("DELETE")
-	
+	router.HandleFunc("/payments/{id}/status-history", getPaymentStatusHistory).Methods("GET")
+	router.HandleFunc("/payments/{id}/restore", admin.RequireKey(restorePayment)).Methods("POST")
+	router.HandleFunc("/payments/{id}/capture", capturePayment).Methods("POST")
+	router.HandleFunc("/payments/{id}/void", voidPayment).Methods("POST")
+	router.HandleFunc("/payments/{id}/disputes", getPaymentDisputes).Methods("GET")
+	router.HandleFunc("/payments/{id}/disputes", openDispute).Methods("POST")
+	router.HandleFunc("/disputes/{id}/resolve", resolveDispute).Methods("POST")
+	router.HandleFunc("/settlements", listSettlements).Methods("GET")
+	router.HandleFunc("/settlements/{id}/payments", getSettlementPayments).Methods("GET")
+	router.HandleFunc("/dead-letters", internalTLS.RequireClientCert(admin.RequireKey(listDeadLetters))).Methods("GET")
+	router.HandleFunc("/dead-letters/{id}/replay", internalTLS.RequireClientCert(admin.RequireKey(replayDeadLetter))).Methods("POST")
+	router.HandleFunc("/events/orders", internalTLS.RequireClientCert(signatures.Require(consumeOrderEvent))).Methods("POST")
+
 	router.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
 
 	log.Printf("🚀 Payments Service started on port %s", port)
 	log.Printf("📚 Swagger UI: http://localhost:%s/swagger/index.html", port)
-	if err := http.ListenAndServe(":"+port, router); err != nil {
+	srv := &http.Server{Addr: ":" + port, Handler: replica.Middleware(router)}
+	if err := internalTLS.ListenAndServe(srv); err != nil {
 		log.Fatalf("Server error: %v", err)
 	}
 }
@@ -75,23 +226,44 @@ func main() {
 // @Description Проверка состояния сервиса
 // @Tags health
 // @Produce json
-// @Success 200 {object} map[string]string
+// @Success 200 {object} map[string]interface{}
 // @Router /health [get]
 func healthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":       "healthy",
+		"mode":         serviceMode.Get(),
+		"replica_id":   replica.ID(),
+		"database":     dbWatch.Status(),
+		"dependencies": services.BreakerStates(),
+	})
 }
 
 // @Summary Get all payments
-// @Description Получить список всех платежей
+// @Description Получить список всех платежей, опционально по заказу
 // @Tags payments
 // @Produce json
+// @Param order_id query int false "Order ID"
+// @Param include_deleted query bool false "Включить удалённые (только с X-Internal-API-Key)"
+// @Param include_test query bool false "Включить тестовые платежи песочницы"
 // @Success 200 {array} Payment
 // @Router /payments [get]
 func getPayments(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query("SELECT id, order_id, amount, status, payment_method, created_at, updated_at FROM payments ORDER BY id LIMIT 100")
+	query := "SELECT " + paymentColumns + " FROM payments WHERE (deleted_at IS NULL OR $1) AND (NOT test OR $2)"
+	args := []interface{}{includeDeleted(r), includeTest(r)}
+	if v := r.URL.Query().Get("order_id"); v != "" {
+		orderID, err := strconv.Atoi(v)
+		if err != nil {
+			apierr.Write(w, apierr.InvalidRequest, "order_id must be an integer")
+			return
+		}
+		query += " AND order_id = $3"
+		args = append(args, orderID)
+	}
+
+	rows, err := db.QueryContext(r.Context(), observe.Named("payments.list", query+" ORDER BY id LIMIT 100"), args...)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Internal(w, err)
 		return
 	}
 	defer rows.Close()
@@ -99,8 +271,8 @@ func getPayments(w http.ResponseWriter, r *http.Request) {
 	var payments []Payment
 	for rows.Next() {
 		var p Payment
-		if err := rows.Scan(&p.ID, &p.OrderID, &p.Amount, &p.Status, &p.PaymentMethod, &p.CreatedAt, &p.UpdatedAt); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if err := scanPayment(rows, &p); err != nil {
+			apierr.Internal(w, err)
 			return
 		}
 		payments = append(payments, p)
@@ -115,6 +287,7 @@ func getPayments(w http.ResponseWriter, r *http.Request) {
 // @Tags payments
 // @Produce json
 // @Param id path int true "Payment ID"
+// @Param include_deleted query bool false "Показать удалённый (только с X-Internal-API-Key)"
 // @Success 200 {object} Payment
 // @Failure 404 {object} map[string]string
 // @Router /payments/{id} [get]
@@ -123,14 +296,14 @@ func getPayment(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(vars["id"])
 
 	var p Payment
-	err := db.QueryRow("SELECT id, order_id, amount, status, payment_method, created_at, updated_at FROM payments WHERE id = $1", id).
-		Scan(&p.ID, &p.OrderID, &p.Amount, &p.Status, &p.PaymentMethod, &p.CreatedAt, &p.UpdatedAt)
+	err := scanPayment(db.QueryRowContext(r.Context(),
+		observe.Lookup("payments.get_by_id", "SELECT "+paymentColumns+" FROM payments WHERE id = $1 AND (deleted_at IS NULL OR $2)"), id, includeDeleted(r)), &p)
 
 	if err == sql.ErrNoRows {
-		http.Error(w, "Payment not found", http.StatusNotFound)
+		apierr.Write(w, apierr.PaymentNotFound, "Payment not found")
 		return
 	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Internal(w, err)
 		return
 	}
 
@@ -139,30 +312,139 @@ func getPayment(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary Create payment
-// @Description Создать новый платеж
+// @Description Создать новый платеж. При PAYMENTS_SANDBOX=true платёж помечается test=true, а ответ шлюза на платёж в pending имитируется: карта 4000000000000002 или сумма на .51 — failed, карта 4000000000000119 или сумма на .08 — ответа нет, остальные — completed через SANDBOX_CALLBACK_DELAY. Тестовые и боевые платежи одного заказа не смешиваются (409 test_mode_mismatch).
 // @Tags payments
 // @Accept json
 // @Produce json
+// @Param Idempotency-Key header string false "Повтор запроса с тем же ключом вернёт ранее созданный платёж"
 // @Param payment body Payment true "Payment data"
 // @Success 201 {object} Payment
+// @Success 200 {object} Payment
 // @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string "code: test_mode_mismatch"
+// @Failure 422 {object} map[string]string "code: unsupported_currency, amount_below_minimum, amount_above_maximum, currency_mismatch или amount_mismatch"
+// @Failure 503 {object} map[string]string
 // @Router /payments [post]
 func createPayment(w http.ResponseWriter, r *http.Request) {
 	var p Payment
 	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
 		return
 	}
 
-	err := db.QueryRow(
-		"INSERT INTO payments (order_id, amount, status, payment_method) VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at",
-		p.OrderID, p.Amount, p.Status, p.PaymentMethod,
-	).Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt)
+	// Флаг test ставит сервис: в песочнице — на каждый новый платёж.
+	p.Test = cfg.PaymentsSandbox
+	// Номер карты заменяется токеном до любой другой обработки; исход
+	// имитации шлюза выбирается до этого.
+	card := p.Card
+	p.Card, p.MethodDetails = nil, nil
+	outcome := ""
+	if p.Test {
+		outcome = sandboxOutcome(p.Amount, card)
+	}
+	if card != nil {
+		if p.PaymentMethod != "card" {
+			apierr.Write(w, apierr.CardNotAllowed, "card details are only accepted for payment_method card")
+			return
+		}
+		details, err := tokenizeCard(card, time.Now())
+		*card = CardInput{}
+		if err != nil {
+			apierr.Respond(w, err)
+			return
+		}
+		p.MethodDetails = details
+	}
 
+	if p.Status == "disputed" {
+		apierr.Write(w, apierr.ValidationFailed, "status disputed is managed via /payments/{id}/disputes")
+		return
+	}
+	if capturedStatus(p.Status) {
+		apierr.Write(w, apierr.ValidationFailed, "status "+p.Status+" is managed via /payments/{id}/capture and /payments/{id}/void")
+		return
+	}
+
+	if p.Currency = currency.Normalize(p.Currency); p.Currency == "" {
+		p.Currency = defaultCurrency
+	} else if !currency.Valid(p.Currency) {
+		apierr.Write(w, apierr.UnsupportedCurrency, "unsupported currency "+p.Currency)
+		return
+	}
+
+	if !checkMethodLimits(w, p) {
+		return
+	}
+
+	order, exists, err := lookupOrder(r, p.OrderID)
+	if errors.Is(err, httpclient.ErrDependencyUnavailable) {
+		apierr.Write(w, apierr.DependencyUnavailable, err.Error())
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if !exists {
+		apierr.Write(w, apierr.UnknownOrder, "Order not found")
+		return
+	}
+	// Сначала валюта: сравнивать суммы в разных валютах бессмысленно.
+	if order != nil && order.Currency != p.Currency {
+		apierr.Write(w, apierr.CurrencyMismatch, fmt.Sprintf("payment currency %s does not match order currency %s", p.Currency, order.Currency))
+		return
+	}
+	if order != nil && math.Abs(order.TotalAmount-p.Amount) >= 0.005 {
+		apierr.Write(w, apierr.AmountMismatch, fmt.Sprintf("payment amount %.2f does not match order total %.2f", p.Amount, order.TotalAmount))
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Internal(w, err)
 		return
 	}
+	defer tx.Rollback()
+
+	if err := checkTestMode(r.Context(), tx, p.OrderID, 0, p.Test); err != nil {
+		apierr.Respond(w, err)
+		return
+	}
+
+	key := r.Header.Get("Idempotency-Key")
+	err = tx.QueryRowContext(r.Context(),
+		observe.Named("payments.insert", "INSERT INTO payments (order_id, amount, currency, status, payment_method, method_details, idempotency_key, completed_at, refunded_at, authorization_expires_at, test) VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), CASE WHEN $4 = 'completed' THEN NOW() END, CASE WHEN $4 = 'refunded' THEN NOW() END, CASE WHEN $4 = 'pending' AND $8::bigint > 0 THEN NOW() + $8::bigint * INTERVAL '1 second' END, $9) ON CONFLICT (idempotency_key) DO NOTHING RETURNING id, "+capturedAmountExpr+", authorization_expires_at, created_at, updated_at"),
+		p.OrderID, p.Amount, p.Currency, p.Status, p.PaymentMethod, p.MethodDetails, key, int64(cfg.AuthorizationExpiry.Seconds()), p.Test,
+	).Scan(&p.ID, &p.CapturedAmount, &p.AuthorizationExpiresAt, &p.CreatedAt, &p.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		// Повтор с тем же Idempotency-Key: возвращаем уже созданный платёж.
+		err = scanPayment(tx.QueryRowContext(r.Context(), "SELECT "+paymentColumns+" FROM payments WHERE idempotency_key = $1", key), &p)
+		if err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p)
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	err = recordPaymentStatus(r.Context(), tx, r, p.ID, "", p.Status, "payment created")
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if p.Status == "completed" && !clients.IsCheckoutPaymentKey(key) {
+		notifyPaymentCompleted(p)
+	}
+	if p.Test {
+		scheduleSandboxCallback(p, outcome)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -176,8 +458,12 @@ func createPayment(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param id path int true "Payment ID"
 // @Param payment body Payment true "Payment data"
+// @Param reason query string false "Причина смены статуса для payment_status_history"
 // @Success 200 {object} Payment
+// @Failure 403 {object} map[string]string "Возврат (refunded) под имперсонацией"
 // @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "code: test_mode_mismatch — перенос на заказ с платежами другого режима; invalid_status_transition — платёж в disputed, partially_captured или voided"
+// @Failure 503 {object} map[string]string "Конкурирующее изменение той же записи; запрос можно повторить"
 // @Router /payments/{id} [put]
 func updatePayment(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -185,49 +471,153 @@ func updatePayment(w http.ResponseWriter, r *http.Request) {
 
 	var p Payment
 	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+
+	// Возврат денег оператор не может провести от имени пользователя.
+	if p.Status == "refunded" && auth.RefuseImpersonated(w, r) {
 		return
 	}
 
-	err := db.QueryRow(
-		"UPDATE payments SET order_id=$1, amount=$2, status=$3, payment_method=$4, updated_at=NOW() WHERE id=$5 RETURNING id, order_id, amount, status, payment_method, created_at, updated_at",
-		p.OrderID, p.Amount, p.Status, p.PaymentMethod, id,
-	).Scan(&p.ID, &p.OrderID, &p.Amount, &p.Status, &p.PaymentMethod, &p.CreatedAt, &p.UpdatedAt)
+	// disputed выставляется и снимается только через споры.
+	if p.Status == "disputed" {
+		apierr.Write(w, apierr.ValidationFailed, "status disputed is managed via /payments/{id}/disputes")
+		return
+	}
+	if capturedStatus(p.Status) {
+		apierr.Write(w, apierr.ValidationFailed, "status "+p.Status+" is managed via /payments/{id}/capture and /payments/{id}/void")
+		return
+	}
 
+	// Прежний статус читается под блокировкой строки в том же запросе:
+	// уведомление уходит только при переходе в completed, и из
+	// параллельных запросов переход (проведение, возврат) видит ровно
+	// один. По переходам же проставляются completed_at и refunded_at, по
+	// которым строятся дневные расчёты (updated_at для этого не годится).
+	in := p
+	var prevStatus string
+	err := pg.Locked(r.Context(), db, func(tx *sql.Tx) error {
+		p = in
+		var orderID int
+		var test bool
+		var status string
+		err := tx.QueryRowContext(r.Context(), "SELECT order_id, test, status FROM payments WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", id).Scan(&orderID, &test, &status)
+		if err != nil {
+			return err
+		}
+		// Из спора и частичного списания или отмены авторизации платёж
+		// выводят только их собственные маршруты.
+		if status == "disputed" || capturedStatus(status) {
+			return apierr.New(apierr.InvalidStatusTransition, "payment "+status+" is managed via /payments/{id}/disputes, /capture and /void").
+				With("status", status)
+		}
+		if p.OrderID != orderID {
+			if err := checkTestMode(r.Context(), tx, p.OrderID, id, test); err != nil {
+				return err
+			}
+		}
+		err = tx.QueryRowContext(r.Context(),
+			observe.Lookup("payments.update", `WITH prev AS (SELECT id, status FROM payments WHERE id=$5 AND deleted_at IS NULL FOR UPDATE)
+			 UPDATE payments SET order_id=$1, amount=$2, status=$3, payment_method=$4, updated_at=NOW(),
+			   completed_at = CASE WHEN $3 = 'completed' AND prev.status IS DISTINCT FROM 'completed' THEN NOW() ELSE payments.completed_at END,
+			   refunded_at = CASE WHEN $3 = 'refunded' AND prev.status IS DISTINCT FROM 'refunded' THEN NOW() ELSE payments.refunded_at END
+			 FROM prev WHERE payments.id=prev.id
+			 RETURNING payments.id, order_id, amount,
+			   COALESCE(captured_amount, CASE WHEN payments.status IN ('completed', 'disputed', 'refunded') THEN amount ELSE 0 END),
+			   currency, payments.status, payment_method, method_details, settlement_id, refund_reason, authorization_expires_at, deleted_at, test, created_at, updated_at, prev.status`),
+			p.OrderID, p.Amount, p.Status, p.PaymentMethod, id,
+		).Scan(&p.ID, &p.OrderID, &p.Amount, &p.CapturedAmount, &p.Currency, &p.Status, &p.PaymentMethod, &p.MethodDetails, &p.SettlementID, &p.RefundReason, &p.AuthorizationExpiresAt, &p.DeletedAt, &p.Test, &p.CreatedAt, &p.UpdatedAt, &prevStatus)
+		if err != nil || p.Status == prevStatus {
+			return err
+		}
+		reason := r.URL.Query().Get("reason")
+		if reason == "" {
+			reason = "payment updated"
+		}
+		return recordPaymentStatus(r.Context(), tx, r, p.ID, prevStatus, p.Status, reason)
+	})
 	if err == sql.ErrNoRows {
-		http.Error(w, "Payment not found", http.StatusNotFound)
+		apierr.Write(w, apierr.PaymentNotFound, "Payment not found")
 		return
 	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Respond(w, err)
 		return
 	}
+	if p.Status == "completed" && prevStatus != "completed" {
+		notifyPaymentCompleted(p)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(p)
 }
 
 // @Summary Delete payment
-// @Description Удалить платеж
+// @Description Мягко удалить платеж (deleted_at). Удалять можно только pending и failed; удалённый платёж восстанавливается через POST /payments/{id}/restore.
 // @Tags payments
 // @Param id path int true "Payment ID"
 // @Success 204
 // @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Router /payments/{id} [delete]
 func deletePayment(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, _ := strconv.Atoi(vars["id"])
 
-	result, err := db.Exec("DELETE FROM payments WHERE id = $1", id)
+	tx, err := db.BeginTx(r.Context(), nil)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Internal(w, err)
 		return
 	}
+	defer tx.Rollback()
 
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		http.Error(w, "Payment not found", http.StatusNotFound)
+	var status string
+	err = tx.QueryRowContext(r.Context(),
+		"SELECT COALESCE(status, 'pending') FROM payments WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", id).Scan(&status)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.PaymentNotFound, "Payment not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if !deletableStatus(status) {
+		apierr.Write(w, apierr.InvalidStatusTransition, "Only pending or failed payments can be deleted, payment is "+status)
+		return
+	}
+	if _, err := tx.ExecContext(r.Context(), observe.Named("payments.delete", "UPDATE payments SET deleted_at = NOW() WHERE id = $1"), id); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	// Запись аудита фиксируется в одной транзакции с удалением.
+	err = audit.Write(r.Context(), tx)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		apierr.Internal(w, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// lookupOrder получает заказ из orders-service (сумма и валюта, с
+// которыми сверяется платёж). Если ORDERS_SERVICE_URL не задан, проверка
+// пропускается: заказ считается существующим, а сверять сумму не с чем
+// (nil).
+func lookupOrder(r *http.Request, orderID int) (*clients.Order, bool, error) {
+	if ordersServiceURL == "" {
+		return nil, true, nil
+	}
+
+	o, err := ordersClient.Get(r.Context(), orderID)
+	if clients.StatusOf(err) != 0 {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return o, true, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"pkg/clients"
+	"pkg/deadletter"
+)
+
+// notifyOrders включает уведомление orders-service о проведённом платеже
+// (NOTIFY_ORDERS_ON_PAYMENT, по умолчанию true). О платежах саги
+// оформления (clients.IsCheckoutPaymentKey) не уведомляют: заказ
+// подтверждает сама сага.
+var notifyOrders bool
+
+const notifyTimeout = 30 * time.Second
+
+func initPaymentNotify() {
+	notifyOrders = cfg.NotifyOrdersOnPayment && ordersServiceURL != ""
+}
+
+// notifyPaymentCompleted сообщает orders-service, что платёж проведён.
+// Вызывается после коммита платежа и не блокирует ответ: запрос уходит
+// с Idempotency-Key, поэтому httpclient повторяет его, а если повторы
+// исчерпаны — он сохраняется в dead_letters для replay. Запись идёт со
+// своим таймаутом: к этому моменту повторы могли исчерпать ctx запроса.
+func notifyPaymentCompleted(p Payment) {
+	if !notifyOrders {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+
+		ev := clients.PaymentCompleted{PaymentID: p.ID}
+		key := fmt.Sprintf("payment-%d-completed", p.ID)
+		_, err := ordersClient.PaymentCompleted(ctx, p.OrderID, ev, key)
+		if err == nil {
+			log.Printf("📨 Order %d notified about payment %d", p.OrderID, p.ID)
+			return
+		}
+		log.Printf("⚠️ Payment %d completion not delivered to orders-service: %v", p.ID, err)
+		body, _ := json.Marshal(ev)
+		recordCtx, cancelRecord := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancelRecord()
+		if err := deadletter.Record(recordCtx, db, deadletter.Letter{
+			Source:    "payment.completed",
+			TargetURL: ordersClient.URL(clients.PaymentCompletedPath(p.OrderID)),
+			Headers:   map[string]string{"Content-Type": "application/json", "Idempotency-Key": key},
+			Payload:   string(body),
+			Attempts:  1,
+			LastError: err.Error(),
+		}); err != nil {
+			log.Printf("❌ Dead letter for payment %d not recorded: %v", p.ID, err)
+		}
+	}()
+}
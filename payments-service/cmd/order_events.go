@@ -0,0 +1,96 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"pkg/apierr"
+	"pkg/dedup"
+	"pkg/events"
+)
+
+var orderEventsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "payments_order_events_total",
+	Help: "Order events received from orders-service by result: flagged, duplicate, ignored, rejected, failed.",
+}, []string{"result"})
+
+// Источник событий в processed_events.
+const orderEventsSource = "orders-outbox"
+
+// @Summary Consume order event
+// @Description Приём событий заказов от outbox orders-service. На order.force_deleted платежи удалённого заказа помечаются orphaned_at; сами платежи не меняются — возврат, если он нужен, оформляется вручную. Остальные события игнорируются. Повторно доставленное событие (тот же event_id) ничего не меняет.
+// @Tags events
+// @Accept json
+// @Produce json
+// @Param event body events.Envelope true "Order event"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Router /events/orders [post]
+func consumeOrderEvent(w http.ResponseWriter, r *http.Request) {
+	var env events.Envelope
+	if err := json.NewDecoder(r.Body).Decode(&env); err != nil {
+		orderEventsProcessed.WithLabelValues("rejected").Inc()
+		apierr.Write(w, apierr.ValidationFailed, err.Error())
+		return
+	}
+	if env.EventID == "" {
+		orderEventsProcessed.WithLabelValues("rejected").Inc()
+		apierr.Write(w, apierr.ValidationFailed, "event_id is required")
+		return
+	}
+	if env.EventType != events.OrderForceDeleted {
+		orderEventsProcessed.WithLabelValues("ignored").Inc()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"event_id": env.EventID, "result": "ignored"})
+		return
+	}
+
+	var p events.OrderPayload
+	if err := json.Unmarshal(env.Payload, &p); err != nil || p.OrderID <= 0 {
+		orderEventsProcessed.WithLabelValues("rejected").Inc()
+		apierr.Write(w, apierr.ValidationFailed, "Invalid order.force_deleted payload: order_id is required")
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		orderEventsProcessed.WithLabelValues("failed").Inc()
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	claimed, err := dedup.Claim(r.Context(), tx, orderEventsSource, env.EventID)
+	var flagged int64
+	if err == nil && claimed {
+		var res sql.Result
+		res, err = tx.ExecContext(r.Context(),
+			"UPDATE payments SET orphaned_at = COALESCE(orphaned_at, NOW()) WHERE order_id = $1", p.OrderID)
+		if err == nil {
+			flagged, _ = res.RowsAffected()
+		}
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		orderEventsProcessed.WithLabelValues("failed").Inc()
+		apierr.Internal(w, err)
+		return
+	}
+
+	result := "flagged"
+	if !claimed {
+		result = "duplicate"
+	} else if flagged > 0 {
+		log.Printf("⚠️ Order %d force-deleted, %d payments flagged (event %s)", p.OrderID, flagged, env.EventID)
+	}
+	orderEventsProcessed.WithLabelValues(result).Inc()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"event_id": env.EventID, "result": result, "payments": flagged})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pkg/events"
+)
+
+// TestForceDeletedReplayFlagsOnce — повтор order.force_deleted (тот же
+// event_id) отвечает duplicate и не трогает orphaned_at второй раз.
+func TestForceDeletedReplayFlagsOnce(t *testing.T) {
+	openTestDB(t)
+
+	orderID := 900000 + int(time.Now().UnixNano()%90000)
+	eventID := fmt.Sprintf("replay-test-%d", time.Now().UnixNano())
+	var id int
+	if err := db.QueryRow("INSERT INTO payments (order_id, amount, status) VALUES ($1, 10, 'pending') RETURNING id", orderID).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM payments WHERE id = $1", id)
+		db.Exec("DELETE FROM processed_events WHERE source = $1 AND event_id = $2", orderEventsSource, eventID)
+	})
+
+	payload, _ := json.Marshal(events.OrderPayload{OrderID: orderID})
+	body, _ := json.Marshal(events.Envelope{EventID: eventID, EventType: events.OrderForceDeleted, Payload: payload})
+	send := func() (string, int64) {
+		rec := httptest.NewRecorder()
+		consumeOrderEvent(rec, httptest.NewRequest(http.MethodPost, "/events/orders", strings.NewReader(string(body))))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		var resp struct {
+			Result   string `json:"result"`
+			Payments int64  `json:"payments"`
+		}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp.Result, resp.Payments
+	}
+
+	if result, n := send(); result != "flagged" || n != 1 {
+		t.Fatalf("first delivery: %s, %d payments; want flagged, 1", result, n)
+	}
+	var first time.Time
+	if err := db.QueryRow("SELECT orphaned_at FROM payments WHERE id = $1", id).Scan(&first); err != nil {
+		t.Fatal(err)
+	}
+
+	if result, n := send(); result != "duplicate" || n != 0 {
+		t.Fatalf("replay: %s, %d payments; want duplicate, 0", result, n)
+	}
+	var second time.Time
+	if err := db.QueryRow("SELECT orphaned_at FROM payments WHERE id = $1", id).Scan(&second); err != nil {
+		t.Fatal(err)
+	}
+	if !second.Equal(first) {
+		t.Errorf("orphaned_at changed on replay: %s -> %s", first, second)
+	}
+}
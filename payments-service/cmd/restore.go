@@ -0,0 +1,62 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"pkg/admin"
+	"pkg/apierr"
+)
+
+// deletableStatus — мягко удалять можно только платежи, по которым деньги
+// не двигались.
+func deletableStatus(status string) bool {
+	return status == "pending" || status == "failed"
+}
+
+// includeDeleted — ?include_deleted=true учитывается только с внутренним
+// ключом.
+func includeDeleted(r *http.Request) bool {
+	v, _ := strconv.ParseBool(r.URL.Query().Get("include_deleted"))
+	return v && admin.HasKey(r)
+}
+
+// @Summary Restore payment
+// @Description Восстановить мягко удалённый платёж. Требует X-Internal-API-Key.
+// @Tags payments
+// @Produce json
+// @Param id path int true "Payment ID"
+// @Success 200 {object} Payment
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /payments/{id}/restore [post]
+func restorePayment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	var p Payment
+	err := scanPayment(db.QueryRowContext(r.Context(),
+		"UPDATE payments SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL RETURNING "+paymentColumns, id), &p)
+	if err == sql.ErrNoRows {
+		var exists bool
+		if err := db.QueryRowContext(r.Context(), "SELECT EXISTS (SELECT 1 FROM payments WHERE id = $1)", id).Scan(&exists); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		if exists {
+			apierr.Write(w, apierr.InvalidState, "Payment is not deleted")
+			return
+		}
+		apierr.Write(w, apierr.PaymentNotFound, "Payment not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"pkg/apierr"
+	"pkg/pg"
+)
+
+// retentionLockKey — ключ pg_advisory_lock, общий для всех реплик.
+const retentionLockKey = 0x70617972 // "payr"
+
+var errRetentionBusy = errors.New("retention run already in progress")
+
+var retentionPurged = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "payments_retention_purged_total",
+	Help: "Failed payments deleted by the retention job.",
+})
+
+var retentionLastRun = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "payments_retention_last_run_payments",
+	Help: "Failed payments purged (or, in dry-run, eligible for purging) by the last retention run.",
+}, []string{"dry_run"})
+
+// paymentRetention удаляет неуспешные (failed) платежи, не менявшиеся
+// дольше FAILED_PAYMENT_RETENTION (по умолчанию год). Запуск раз в
+// FAILED_PAYMENT_RETENTION_INTERVAL и по POST /admin/retention/run;
+// FAILED_PAYMENT_RETENTION_DRY_RUN=true только считает кандидатов.
+// Удаление идёт пачками по FAILED_PAYMENT_RETENTION_BATCH_SIZE, каждая в
+// своей транзакции, с паузой FAILED_PAYMENT_RETENTION_BATCH_PAUSE между
+// ними, чтобы не нагружать базу. Платежи с расчётом или спором не
+// удаляются; история статусов (payment_status_history) сохраняется.
+// Итоги запусков пишутся в payment_retention_runs.
+type paymentRetention struct {
+	retention time.Duration
+	interval  time.Duration
+	dryRun    bool
+	batchSize int
+	pause     time.Duration
+}
+
+// RetentionRun — запуск очистки. Error — причина, по которой запуск
+// прервался; удалённое до неё остаётся удалённым.
+type RetentionRun struct {
+	ID         int        `json:"id"`
+	DryRun     bool       `json:"dry_run"`
+	Cutoff     time.Time  `json:"cutoff"`
+	Payments   int64      `json:"payments"`
+	Batches    int        `json:"batches"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// purgeableCond — платежи, которые можно удалить; $1 — cutoff.
+const purgeableCond = `status = 'failed' AND updated_at < $1 AND settlement_id IS NULL
+	AND NOT EXISTS (SELECT 1 FROM disputes d WHERE d.payment_id = payments.id)`
+
+var retention *paymentRetention
+
+func startPaymentRetention(ctx context.Context) {
+	retention = &paymentRetention{
+		retention: cfg.FailedPaymentRetention,
+		interval:  cfg.FailedPaymentRetentionEvery,
+		dryRun:    cfg.FailedPaymentRetentionDry,
+		batchSize: cfg.FailedPaymentBatchSize,
+		pause:     cfg.FailedPaymentBatchPause,
+	}
+
+	go func() {
+		ticker := time.NewTicker(retention.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if _, err := retention.run(ctx, retention.dryRun); err != nil && !errors.Is(err, errRetentionBusy) && ctx.Err() == nil {
+				log.Printf("⚠️ Payment retention run failed: %v", err)
+			}
+		}
+	}()
+	log.Printf("🧹 Payment retention started (failed payments older than %s, every %s, batch %d, dry_run=%t)",
+		retention.retention, retention.interval, retention.batchSize, retention.dryRun)
+}
+
+// run выполняет один проход. Сессионная advisory-блокировка держится на
+// выделенном соединении, поэтому одновременно работает только одна реплика;
+// остальные получают errRetentionBusy.
+func (j *paymentRetention) run(ctx context.Context, dryRun bool) (RetentionRun, error) {
+	res := RetentionRun{DryRun: dryRun, Cutoff: time.Now().UTC().Add(-j.retention)}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return res, err
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", retentionLockKey).Scan(&locked); err != nil {
+		return res, err
+	}
+	if !locked {
+		return res, errRetentionBusy
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", retentionLockKey)
+
+	if err := conn.QueryRowContext(ctx,
+		"INSERT INTO payment_retention_runs (dry_run, cutoff) VALUES ($1, $2) RETURNING id, started_at",
+		dryRun, res.Cutoff).Scan(&res.ID, &res.StartedAt); err != nil {
+		return res, err
+	}
+
+	err = j.purge(ctx, conn, &res)
+	now := time.Now().UTC()
+	res.FinishedAt = &now
+	if err != nil {
+		res.Error = err.Error()
+	}
+	retentionLastRun.WithLabelValues(strconv.FormatBool(dryRun)).Set(float64(res.Payments))
+	if _, ferr := conn.ExecContext(context.WithoutCancel(ctx),
+		"UPDATE payment_retention_runs SET payments = $2, batches = $3, error = NULLIF($4, ''), finished_at = $5 WHERE id = $1",
+		res.ID, res.Payments, res.Batches, res.Error, now); ferr != nil && err == nil {
+		err = ferr
+	}
+	if err != nil {
+		return res, err
+	}
+	if dryRun {
+		log.Printf("🧹 Payment retention dry run: %d failed payments older than %s", res.Payments, res.Cutoff.Format(time.RFC3339))
+	} else {
+		log.Printf("🧹 Payment retention purged %d failed payments older than %s in %d batches", res.Payments, res.Cutoff.Format(time.RFC3339), res.Batches)
+	}
+	return res, nil
+}
+
+func (j *paymentRetention) purge(ctx context.Context, conn *sql.Conn, res *RetentionRun) error {
+	if res.DryRun {
+		return conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM payments WHERE "+purgeableCond, res.Cutoff).Scan(&res.Payments)
+	}
+	for {
+		n, err := j.purgeBatch(ctx, conn, res.Cutoff)
+		if err != nil {
+			return err
+		}
+		res.Payments += int64(n)
+		res.Batches++
+		retentionPurged.Add(float64(n))
+		if n < j.batchSize {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(j.pause):
+		}
+	}
+}
+
+// purgeBatch удаляет одну пачку. Кандидаты перепроверяются под
+// блокировкой строк, поэтому платёж, сменивший статус после отбора, не
+// удаляется.
+func (j *paymentRetention) purgeBatch(ctx context.Context, conn *sql.Conn, cutoff time.Time) (int, error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var ids []int64
+	err = tx.QueryRowContext(ctx,
+		`SELECT COALESCE(array_agg(id), '{}') FROM (
+		   SELECT id FROM payments WHERE `+purgeableCond+`
+		   ORDER BY id LIMIT $2 FOR UPDATE SKIP LOCKED
+		 ) batch`,
+		cutoff, j.batchSize).Scan(pg.Array(&ids))
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM payments WHERE id = ANY($1)", ids); err != nil {
+		return 0, err
+	}
+	return len(ids), tx.Commit()
+}
+
+// @Summary Run failed payment retention
+// @Description Удалить неуспешные платежи старше FAILED_PAYMENT_RETENTION пачками. dry_run=true только считает кандидатов. Завершённые, возвращённые и оспоренные платежи не затрагиваются. Требует X-Internal-API-Key.
+// @Tags admin
+// @Produce json
+// @Param dry_run query bool false "Только посчитать (по умолчанию FAILED_PAYMENT_RETENTION_DRY_RUN)"
+// @Success 200 {object} RetentionRun
+// @Failure 409 {object} map[string]string
+// @Router /admin/retention/run [post]
+func runRetention(w http.ResponseWriter, r *http.Request) {
+	dryRun := retention.dryRun
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			apierr.Write(w, apierr.InvalidRequest, "dry_run must be a boolean")
+			return
+		}
+		dryRun = b
+	}
+
+	res, err := retention.run(r.Context(), dryRun)
+	if errors.Is(err, errRetentionBusy) {
+		apierr.Write(w, apierr.Conflict, err.Error())
+		return
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// @Summary Last failed payment retention run
+// @Description Итоги последнего запуска очистки неуспешных платежей (на любой реплике). Без finished_at — запуск идёт или был прерван остановкой сервиса. Требует X-Internal-API-Key.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} RetentionRun
+// @Failure 404 {object} map[string]string
+// @Router /admin/retention [get]
+func getRetentionStatus(w http.ResponseWriter, r *http.Request) {
+	var res RetentionRun
+	var runErr sql.NullString
+	err := db.QueryRowContext(r.Context(),
+		`SELECT id, dry_run, cutoff, payments, batches, error, started_at, finished_at
+		 FROM payment_retention_runs ORDER BY id DESC LIMIT 1`).
+		Scan(&res.ID, &res.DryRun, &res.Cutoff, &res.Payments, &res.Batches, &runErr, &res.StartedAt, &res.FinishedAt)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.NotFound, "Retention has not run yet")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	res.Error = runErr.String
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
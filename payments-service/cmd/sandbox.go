@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pkg/apierr"
+	"pkg/pg"
+	"pkg/redact"
+)
+
+// Песочница платежей (PAYMENTS_SANDBOX=true) для проверки всего потока
+// оплаты без движения денег. Новые платежи помечаются test=true. Ответ
+// шлюза на платёж в pending (кроме cash) имитируется и через
+// SANDBOX_CALLBACK_DELAY применяется так же, как capture или void: смена
+// статуса с записью в историю и уведомлением orders-service. Исход
+// детерминирован — по тестовой карте, иначе по копейкам суммы:
+//
+//	4000000000000002 или сумма на .51 — отказ (failed);
+//	4000000000000119 или сумма на .08 — шлюз не отвечает, платёж остаётся
+//	в pending до AUTHORIZATION_EXPIRY;
+//	остальные — успех (completed).
+//
+// Ответы, не применённые до перезапуска реплики, теряются, как ответ
+// зависшего шлюза. Тестовые платежи не попадают в сверку (settlements), а
+// в списки, статистику и сводку по заказу — только с include_test=true.
+// Тестовые и боевые платежи одного заказа не смешиваются.
+
+// Исходы имитации шлюза.
+const (
+	sandboxSuccess = "success"
+	sandboxDecline = "decline"
+	sandboxTimeout = "timeout"
+)
+
+// sandboxCards — тестовые номера карт с заданным исходом.
+var sandboxCards = map[string]string{
+	"4000000000000002": sandboxDecline,
+	"4000000000000119": sandboxTimeout,
+}
+
+// sandboxCents — копейки суммы с заданным исходом.
+var sandboxCents = map[int]string{
+	51: sandboxDecline,
+	8:  sandboxTimeout,
+}
+
+// sandboxOutcome выбирает исход имитации для платежа на amount картой
+// card (nil — без карты).
+func sandboxOutcome(amount float64, card *CardInput) string {
+	if card != nil {
+		if o, ok := sandboxCards[redact.Digits(card.Number)]; ok {
+			return o
+		}
+	}
+	cents := int(math.Round(amount*100)) % 100
+	if o, ok := sandboxCents[cents]; ok {
+		return o
+	}
+	return sandboxSuccess
+}
+
+// includeTest — показывать ли тестовые платежи (include_test=true).
+func includeTest(r *http.Request) bool {
+	v, _ := strconv.ParseBool(r.URL.Query().Get("include_test"))
+	return v
+}
+
+// checkTestMode не даёт смешать тестовые и боевые платежи заказа:
+// test_mode_mismatch, если у orderID есть платёж с другим флагом test
+// (кроме самого платежа paymentID). Вызывается в транзакции, которая
+// создаёт или переносит платёж; заказ блокируется до её конца.
+func checkTestMode(ctx context.Context, tx *sql.Tx, orderID, paymentID int, test bool) error {
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('payments_order'), $1)", orderID); err != nil {
+		return err
+	}
+	var mixed bool
+	err := tx.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM payments WHERE order_id = $1 AND id <> $2 AND test <> $3 AND deleted_at IS NULL)",
+		orderID, paymentID, test).Scan(&mixed)
+	if err != nil || !mixed {
+		return err
+	}
+	mode := "live"
+	if test {
+		mode = "test"
+	}
+	return apierr.New(apierr.TestModeMismatch, "order "+strconv.Itoa(orderID)+" has payments in the other mode; cannot add a "+mode+" payment")
+}
+
+// scheduleSandboxCallback имитирует ответ шлюза на новый платёж p.
+func scheduleSandboxCallback(p Payment, outcome string) {
+	if p.Status != "pending" || p.PaymentMethod == "cash" {
+		return
+	}
+	if outcome == sandboxTimeout {
+		log.Printf("🧪 Sandbox payment %d: gateway timeout, no callback", p.ID)
+		return
+	}
+	time.AfterFunc(cfg.SandboxCallbackDelay, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+		if err := applySandboxCallback(ctx, p.ID, outcome); err != nil {
+			log.Printf("⚠️ Sandbox callback for payment %d failed: %v", p.ID, err)
+		}
+	})
+}
+
+// applySandboxCallback применяет ответ шлюза: успех списывает всю
+// авторизацию (completed), отказ переводит платёж в failed. Платёж, который
+// к этому времени уже не в pending, не меняется.
+func applySandboxCallback(ctx context.Context, id int, outcome string) error {
+	var p Payment
+	applied := false
+	err := pg.Locked(ctx, db, func(tx *sql.Tx) error {
+		applied = false
+		a, err := lockAuthorization(ctx, tx, id)
+		if err != nil || a.status != "pending" {
+			return err
+		}
+		captured, status, reason := a.amount, "completed", "sandbox: gateway approved"
+		if outcome == sandboxDecline {
+			captured, status, reason = 0, "failed", "sandbox: card declined"
+		}
+		if p, err = settleAuthorization(ctx, tx, id, a, captured, status, "sandbox", "", reason); err != nil {
+			return err
+		}
+		applied = true
+		return nil
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// Платёж удалён до ответа шлюза.
+		return nil
+	}
+	if err != nil || !applied {
+		return err
+	}
+	log.Printf("🧪 Sandbox payment %d: %s", id, p.Status)
+	if p.Status == "completed" {
+		notifyPaymentCompleted(p)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestSandboxOutcome(t *testing.T) {
+	for _, tc := range []struct {
+		amount float64
+		card   *CardInput
+		want   string
+	}{
+		{100, nil, sandboxSuccess},
+		{100.51, nil, sandboxDecline},
+		{100.08, nil, sandboxTimeout},
+		// Исход по карте важнее исхода по сумме.
+		{100.08, &CardInput{Number: "4000 0000 0000 0002"}, sandboxDecline},
+		{100, &CardInput{Number: "4000-0000-0000-0119"}, sandboxTimeout},
+		{100.51, &CardInput{Number: "4242424242424242"}, sandboxDecline},
+		{19.99, &CardInput{Number: "4242424242424242"}, sandboxSuccess},
+	} {
+		if got := sandboxOutcome(tc.amount, tc.card); got != tc.want {
+			t.Errorf("sandboxOutcome(%v, %+v) = %q, want %q", tc.amount, tc.card, got, tc.want)
+		}
+	}
+}
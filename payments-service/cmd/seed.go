@@ -0,0 +1,17 @@
+package main
+
+import (
+	"context"
+
+	"pkg/seed"
+)
+
+// insertSeed вставляет демо-платежи для POST /admin/seed.
+func insertSeed(ctx context.Context, ds seed.Dataset, reset bool) ([]seed.Report, error) {
+	rows := make([][]interface{}, 0, len(ds.Payments))
+	for _, p := range ds.Payments {
+		rows = append(rows, []interface{}{p.ID, p.OrderID, p.Amount, p.Status, p.PaymentMethod})
+	}
+	rep, err := seed.Insert(ctx, db, "payments", []string{"id", "order_id", "amount", "status", "payment_method"}, rows, reset)
+	return []seed.Report{rep}, err
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"pkg/apierr"
+	"pkg/currency"
+)
+
+const settlementDateLayout = "2006-01-02"
+
+var settlementLastRun = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "payments_settlement_last_success_timestamp_seconds",
+	Help: "Unix time of the last successful settlement run.",
+})
+
+// Settlement — дневной расчёт по одной валюте. Gross — платежи, проведённые
+// за день; Refunds — платежи, возвращённые за день (в том числе проведённые
+// раньше); PaymentCount — число проведённых платежей, помеченных этим
+// расчётом.
+type Settlement struct {
+	ID             int     `json:"id"`
+	SettlementDate string  `json:"settlement_date" example:"2026-10-14"`
+	Currency       string  `json:"currency"`
+	Gross          float64 `json:"gross"`
+	Refunds        float64 `json:"refunds"`
+	Net            float64 `json:"net"`
+	PaymentCount   int     `json:"payment_count"`
+	CreatedAt      string  `json:"createdAt"`
+	UpdatedAt      string  `json:"updatedAt"`
+}
+
+const settlementColumns = "id, settlement_date::text, currency, gross, refunds, net, payment_count, created_at, updated_at"
+
+func scanSettlement(row rowScanner, s *Settlement) error {
+	return row.Scan(&s.ID, &s.SettlementDate, &s.Currency, &s.Gross, &s.Refunds, &s.Net, &s.PaymentCount, &s.CreatedAt, &s.UpdatedAt)
+}
+
+// startSettlements раз в сутки в SETTLEMENT_TIME (UTC, по умолчанию 01:00)
+// формирует расчёты за предыдущий день.
+func startSettlements(ctx context.Context) {
+	// Формат проверен в Config.Validate.
+	at, _ := time.Parse("15:04", cfg.SettlementTime)
+
+	go func() {
+		for {
+			now := time.Now().UTC()
+			next := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, time.UTC)
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			timer := time.NewTimer(next.Sub(now))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			day := next.AddDate(0, 0, -1)
+			if _, err := settleDay(ctx, day); err != nil && ctx.Err() == nil {
+				log.Printf("⚠️ Settlement for %s failed: %v", day.Format(settlementDateLayout), err)
+			}
+		}
+	}()
+	log.Printf("🧾 Daily settlement scheduled at %s UTC", at.Format("15:04"))
+}
+
+// settleDay формирует расчёты за день одной транзакцией. Повторный запуск
+// за тот же день пересчитывает существующие строки settlements (по одной на
+// валюту) и заново помечает платежи, а не создаёт дубликаты. Платежи,
+// попавшие в расчёт другого дня, не переносятся. Платежи с открытым спором
+// (disputed) не учитываются, пока спор не закрыт; после закрытия день
+// пересчитывают через /admin/settlements/run.
+func settleDay(ctx context.Context, day time.Time) ([]Settlement, error) {
+	date := day.Format(settlementDateLayout)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Запуски за один день (по расписанию и из /admin) идут по очереди.
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('settlements'), ($1::date - DATE '2000-01-01'))", date); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE payments SET settlement_id = NULL WHERE settlement_id IN (SELECT id FROM settlements WHERE settlement_date = $1)", date); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`WITH day AS (SELECT $1::date::timestamp AS start, $1::date::timestamp + INTERVAL '1 day' AS finish),
+		 totals AS (
+		   SELECT p.currency,
+		          SUM(CASE WHEN p.completed_at >= day.start AND p.completed_at < day.finish AND p.settlement_id IS NULL AND p.status <> 'disputed' THEN COALESCE(p.captured_amount, p.amount) ELSE 0 END) AS gross,
+		          SUM(CASE WHEN p.status = 'refunded' AND p.refunded_at >= day.start AND p.refunded_at < day.finish THEN COALESCE(p.captured_amount, p.amount) ELSE 0 END) AS refunds,
+		          COUNT(*) FILTER (WHERE p.completed_at >= day.start AND p.completed_at < day.finish AND p.settlement_id IS NULL AND p.status <> 'disputed') AS payment_count
+		   FROM payments p, day
+		   WHERE p.deleted_at IS NULL AND NOT p.test
+		     AND ((p.completed_at >= day.start AND p.completed_at < day.finish)
+		       OR (p.refunded_at >= day.start AND p.refunded_at < day.finish))
+		   GROUP BY p.currency
+		 ),
+		 zeroed AS (
+		   UPDATE settlements SET gross = 0, refunds = 0, net = 0, payment_count = 0, updated_at = NOW()
+		   WHERE settlement_date = $1 AND currency NOT IN (SELECT currency FROM totals)
+		 )
+		 INSERT INTO settlements (settlement_date, currency, gross, refunds, net, payment_count)
+		 SELECT $1, currency, gross, refunds, gross - refunds, payment_count FROM totals
+		 ON CONFLICT (settlement_date, currency) DO UPDATE
+		   SET gross = EXCLUDED.gross, refunds = EXCLUDED.refunds, net = EXCLUDED.net,
+		       payment_count = EXCLUDED.payment_count, updated_at = NOW()`, date)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE payments p SET settlement_id = s.id
+		 FROM settlements s
+		 WHERE s.settlement_date = $1 AND s.currency = p.currency AND p.settlement_id IS NULL AND p.status <> 'disputed' AND p.deleted_at IS NULL AND NOT p.test
+		   AND p.completed_at >= $1::date AND p.completed_at < $1::date + 1`, date); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT "+settlementColumns+" FROM settlements WHERE settlement_date = $1 ORDER BY currency", date)
+	if err != nil {
+		return nil, err
+	}
+	settlements := []Settlement{}
+	for rows.Next() {
+		var s Settlement
+		if err := scanSettlement(rows, &s); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		settlements = append(settlements, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	settlementLastRun.SetToCurrentTime()
+	log.Printf("🧾 Settlement for %s: %d currencies", date, len(settlements))
+	return settlements, nil
+}
+
+// pageLimit разбирает ?limit= (по умолчанию 100, не больше 500).
+func pageLimit(r *http.Request) int {
+	limit := 100
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= 500 {
+		limit = v
+	}
+	return limit
+}
+
+// @Summary List settlements
+// @Description Дневные расчёты, новые сначала. Страницы по limit (до 500) и before_id — id последней записи предыдущей страницы (next_before_id в ответе).
+// @Tags settlements
+// @Produce json
+// @Param from query string false "Дата с (YYYY-MM-DD)"
+// @Param to query string false "Дата по (YYYY-MM-DD), включительно"
+// @Param currency query string false "Валюта"
+// @Param limit query int false "Размер страницы (по умолчанию 100)"
+// @Param before_id query int false "Курсор"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Router /settlements [get]
+func listSettlements(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := "SELECT " + settlementColumns + " FROM settlements WHERE TRUE"
+	var args []interface{}
+	add := func(cond string, v interface{}) {
+		args = append(args, v)
+		query += " AND " + cond + " $" + strconv.Itoa(len(args))
+	}
+
+	for _, f := range []struct{ param, cond string }{{"from", "settlement_date >="}, {"to", "settlement_date <="}} {
+		if v := q.Get(f.param); v != "" {
+			if _, err := time.Parse(settlementDateLayout, v); err != nil {
+				apierr.Write(w, apierr.InvalidRequest, f.param+" must be a date (YYYY-MM-DD)")
+				return
+			}
+			add(f.cond, v)
+		}
+	}
+	if v := q.Get("currency"); v != "" {
+		add("currency =", currency.Normalize(v))
+	}
+	if v := q.Get("before_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			apierr.Write(w, apierr.InvalidRequest, "before_id must be an integer")
+			return
+		}
+		add("id <", id)
+	}
+	limit := pageLimit(r)
+	args = append(args, limit)
+
+	rows, err := db.QueryContext(r.Context(), query+" ORDER BY id DESC LIMIT $"+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	settlements := []Settlement{}
+	for rows.Next() {
+		var s Settlement
+		if err := scanSettlement(rows, &s); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		settlements = append(settlements, s)
+	}
+	if err := rows.Err(); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	resp := map[string]interface{}{"settlements": settlements}
+	if len(settlements) == limit {
+		resp["next_before_id"] = settlements[len(settlements)-1].ID
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// @Summary Settlement payments
+// @Description Платежи, вошедшие в расчёт. Страницы по limit (до 500) и after_id — id последнего платежа предыдущей страницы (next_after_id в ответе).
+// @Tags settlements
+// @Produce json
+// @Param id path int true "Settlement ID"
+// @Param limit query int false "Размер страницы (по умолчанию 100)"
+// @Param after_id query int false "Курсор"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Router /settlements/{id}/payments [get]
+func getSettlementPayments(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	afterID := 0
+	if v := r.URL.Query().Get("after_id"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			apierr.Write(w, apierr.InvalidRequest, "after_id must be an integer")
+			return
+		}
+		afterID = n
+	}
+	limit := pageLimit(r)
+
+	var exists bool
+	if err := db.QueryRowContext(r.Context(), "SELECT EXISTS (SELECT 1 FROM settlements WHERE id = $1)", id).Scan(&exists); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if !exists {
+		apierr.Write(w, apierr.SettlementNotFound, "Settlement not found")
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(),
+		"SELECT "+paymentColumns+" FROM payments WHERE settlement_id = $1 AND id > $2 ORDER BY id LIMIT $3", id, afterID, limit)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	payments := []Payment{}
+	for rows.Next() {
+		var p Payment
+		if err := scanPayment(rows, &p); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		payments = append(payments, p)
+	}
+	if err := rows.Err(); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	resp := map[string]interface{}{"payments": payments}
+	if len(payments) == limit {
+		resp["next_after_id"] = payments[len(payments)-1].ID
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// @Summary Run settlement
+// @Description Сформировать или пересчитать расчёты за день. Повторный запуск обновляет существующие расчёты. Требует X-Internal-API-Key.
+// @Tags admin
+// @Produce json
+// @Param date query string false "День (YYYY-MM-DD), по умолчанию вчера (UTC)"
+// @Success 200 {array} Settlement
+// @Failure 400 {object} map[string]string
+// @Router /admin/settlements/run [post]
+func runSettlement(w http.ResponseWriter, r *http.Request) {
+	day := time.Now().UTC().AddDate(0, 0, -1)
+	if v := r.URL.Query().Get("date"); v != "" {
+		t, err := time.Parse(settlementDateLayout, v)
+		if err != nil {
+			apierr.Write(w, apierr.InvalidRequest, "date must be YYYY-MM-DD")
+			return
+		}
+		day = t
+	}
+
+	settlements, err := settleDay(r.Context(), day)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settlements)
+}
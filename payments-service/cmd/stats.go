@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"pkg/apierr"
+	"pkg/clients"
+	"pkg/currency"
+)
+
+// Типы статистики — общий контракт с клиентами (pkg/clients).
+type (
+	StatusTotals   = clients.StatusTotals
+	CurrencyStats  = clients.CurrencyStats
+	AppliedRate    = clients.AppliedRate
+	ConvertedStats = clients.ConvertedStats
+	PaymentStats   = clients.PaymentStats
+)
+
+// topFailureReasons — сколько причин неудачи перечислять в статистике.
+const topFailureReasons = 5
+
+// @Summary Payment statistics
+// @Description Число и суммы платежей по валютам и статусам и самые частые причины неудачных платежей (reason при переходе в failed). С convert_to дополнительно пересчитывает всё в одну валюту по курсу (PUT /exchange-rates), действовавшему на дату платежа, и перечисляет применённые курсы.
+// @Tags payments
+// @Produce json
+// @Param from query string false "Платежи, созданные с даты (YYYY-MM-DD)"
+// @Param to query string false "Платежи, созданные по дату (YYYY-MM-DD), включительно"
+// @Param convert_to query string false "Валюта пересчёта"
+// @Param include_test query bool false "Учитывать тестовые платежи песочницы"
+// @Success 200 {object} PaymentStats
+// @Failure 400 {object} map[string]string
+// @Router /payments/stats [get]
+func getPaymentStats(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	where := " WHERE p.deleted_at IS NULL"
+	if !includeTest(r) {
+		where += " AND NOT p.test"
+	}
+	var args []interface{}
+	for _, f := range []struct{ param, cond string }{{"from", "p.created_at >= $%d::date"}, {"to", "p.created_at < $%d::date + 1"}} {
+		if v := q.Get(f.param); v != "" {
+			if _, err := time.Parse(settlementDateLayout, v); err != nil {
+				apierr.Write(w, apierr.InvalidRequest, f.param+" must be a date (YYYY-MM-DD)")
+				return
+			}
+			args = append(args, v)
+			where += " AND " + fmt.Sprintf(f.cond, len(args))
+		}
+	}
+	target := currency.Normalize(q.Get("convert_to"))
+	if target != "" && !currency.Valid(target) {
+		apierr.Write(w, apierr.InvalidRequest, "unsupported convert_to currency "+target)
+		return
+	}
+
+	stats := PaymentStats{Currencies: map[string]CurrencyStats{}}
+	rows, err := db.QueryContext(r.Context(),
+		"SELECT p.currency, COALESCE(p.status, 'pending'), COUNT(*), SUM(p.amount) FROM payments p"+where+" GROUP BY 1, 2", args...)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cur, status string
+		var t StatusTotals
+		if err := rows.Scan(&cur, &status, &t.Count, &t.Amount); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		cs, ok := stats.Currencies[cur]
+		if !ok {
+			cs.ByStatus = map[string]StatusTotals{}
+		}
+		cs.Count += t.Count
+		cs.Amount = roundCents(cs.Amount + t.Amount)
+		cs.ByStatus[status] = t
+		stats.Currencies[cur] = cs
+	}
+	if err := rows.Err(); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	if stats.FailureReasons, err = failureReasons(r, where, args); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	if target != "" {
+		converted, err := convertStats(r, target, where, args)
+		if err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		stats.Converted = converted
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// convertStats группирует платежи по курсу, действовавшему на дату
+// создания платежа, и пересчитывает суммы в target.
+func convertStats(r *http.Request, target, where string, args []interface{}) (*ConvertedStats, error) {
+	args = append(args, target)
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT p.currency, COALESCE(p.status, 'pending'), rate.rate, rate.effective_date::text, COUNT(*), SUM(p.amount)
+		 FROM payments p
+		 LEFT JOIN LATERAL (
+		   SELECT er.rate, er.effective_date FROM exchange_rates er
+		   WHERE er.from_currency = p.currency AND er.to_currency = $`+strconv.Itoa(len(args))+`
+		     AND er.effective_date <= p.created_at::date
+		   ORDER BY er.effective_date DESC LIMIT 1
+		 ) rate ON TRUE`+where+`
+		 GROUP BY 1, 2, 3, 4`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	c := &ConvertedStats{Currency: target, ByStatus: map[string]StatusTotals{}, RatesApplied: []AppliedRate{}}
+	applied := map[string]int{}
+	for rows.Next() {
+		var cur, status string
+		var rate *float64
+		var effective *string
+		var t StatusTotals
+		if err := rows.Scan(&cur, &status, &rate, &effective, &t.Count, &t.Amount); err != nil {
+			return nil, err
+		}
+
+		factor := 1.0
+		switch {
+		case cur == target:
+		case rate == nil:
+			if c.Unconverted == nil {
+				c.Unconverted = map[string]StatusTotals{}
+			}
+			u := c.Unconverted[cur]
+			u.Count += t.Count
+			u.Amount = roundCents(u.Amount + t.Amount)
+			c.Unconverted[cur] = u
+			continue
+		default:
+			factor = *rate
+			key := cur + "/" + *effective
+			if i, ok := applied[key]; ok {
+				c.RatesApplied[i].Payments += t.Count
+			} else {
+				applied[key] = len(c.RatesApplied)
+				c.RatesApplied = append(c.RatesApplied, AppliedRate{From: cur, To: target, Rate: *rate, EffectiveDate: *effective, Payments: t.Count})
+			}
+		}
+
+		s := c.ByStatus[status]
+		s.Count += t.Count
+		s.Amount += t.Amount * factor
+		c.ByStatus[status] = s
+		c.Count += t.Count
+		c.Amount += t.Amount * factor
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	c.Amount = roundCents(c.Amount)
+	for status, s := range c.ByStatus {
+		s.Amount = roundCents(s.Amount)
+		c.ByStatus[status] = s
+	}
+	sort.Slice(c.RatesApplied, func(i, j int) bool {
+		a, b := c.RatesApplied[i], c.RatesApplied[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.EffectiveDate < b.EffectiveDate
+	})
+	return c, nil
+}
+
+// failureReasons — самые частые причины перехода платежей в failed из
+// payment_status_history; пустая причина — "unspecified".
+func failureReasons(r *http.Request, where string, args []interface{}) ([]clients.ReasonCount, error) {
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT COALESCE(NULLIF(h.reason, ''), 'unspecified'), COUNT(*)
+		 FROM payment_status_history h JOIN payments p ON p.id = h.payment_id`+where+` AND h.new_status = 'failed'
+		 GROUP BY 1 ORDER BY 2 DESC, 1 LIMIT `+strconv.Itoa(topFailureReasons), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reasons := []clients.ReasonCount{}
+	for rows.Next() {
+		var rc clients.ReasonCount
+		if err := rows.Scan(&rc.Reason, &rc.Count); err != nil {
+			return nil, err
+		}
+		reasons = append(reasons, rc)
+	}
+	return reasons, rows.Err()
+}
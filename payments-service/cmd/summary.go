@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+
+	"pkg/apierr"
+	"pkg/cache"
+	"pkg/clients"
+)
+
+// orderTotals кэширует сумму и валюту заказа из orders-service на
+// ORDER_TOTAL_CACHE_TTL (по умолчанию 15s).
+var orderTotals *cache.Cache
+
+func initOrderTotals(c *cache.Cache) {
+	orderTotals = c.Sub("payments-order-totals", cfg.OrderTotalCacheTTL)
+}
+
+// PaymentSummary — сводка оплаты заказа. OrderTotal и Outstanding равны
+// null, если orders-service недоступен; причина — в warnings.
+type PaymentSummary struct {
+	OrderID         int      `json:"order_id"`
+	OrderTotal      *float64 `json:"order_total"`
+	Currency        *string  `json:"currency"`
+	TotalAuthorized float64  `json:"total_authorized"`
+	TotalCompleted  float64  `json:"total_completed"`
+	TotalRefunded   float64  `json:"total_refunded"`
+	Outstanding     *float64 `json:"outstanding"`
+	PaymentIDs      []int    `json:"payment_ids"`
+	Warnings        []string `json:"warnings,omitempty"`
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// @Summary Payment summary for order
+// @Description Сумма заказа, авторизованные (pending и несписанный остаток partially_captured), списанные (completed) и возвращённые суммы и остаток к оплате
+// @Tags payments
+// @Produce json
+// @Param order_id query int true "Order ID"
+// @Param include_test query bool false "Учитывать тестовые платежи песочницы"
+// @Success 200 {object} PaymentSummary
+// @Failure 400 {object} map[string]string
+// @Router /payments/summary [get]
+func getPaymentSummary(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(r.URL.Query().Get("order_id"))
+	if err != nil {
+		apierr.Write(w, apierr.InvalidRequest, "order_id is required and must be an integer")
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(), "SELECT id, amount, "+capturedAmountExpr+", status FROM payments WHERE order_id = $1 AND deleted_at IS NULL AND (NOT test OR $2) ORDER BY id", orderID, includeTest(r))
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	s := PaymentSummary{OrderID: orderID, PaymentIDs: []int{}}
+	for rows.Next() {
+		var id int
+		var amount, captured float64
+		var status string
+		if err := rows.Scan(&id, &amount, &captured, &status); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		switch status {
+		case "pending":
+			s.TotalAuthorized += amount
+		case "partially_captured":
+			s.TotalAuthorized += amount - captured
+			s.TotalCompleted += captured
+		case "completed", "disputed":
+			s.TotalCompleted += captured
+		case "refunded":
+			s.TotalRefunded += captured
+		default:
+			continue
+		}
+		s.PaymentIDs = append(s.PaymentIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	s.TotalAuthorized = roundCents(s.TotalAuthorized)
+	s.TotalCompleted = roundCents(s.TotalCompleted)
+	s.TotalRefunded = roundCents(s.TotalRefunded)
+
+	order, err := cachedOrder(r, orderID)
+	switch {
+	case err != nil:
+		s.Warnings = append(s.Warnings, "order total unknown: "+err.Error())
+	case order == nil:
+		s.Warnings = append(s.Warnings, "order total unknown: order not found in orders-service")
+	default:
+		outstanding := roundCents(math.Max(order.TotalAmount-s.TotalCompleted, 0))
+		s.OrderTotal = &order.TotalAmount
+		s.Currency = &order.Currency
+		s.Outstanding = &outstanding
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// cachedOrder — lookupOrder с коротким кэшем. nil без ошибки означает,
+// что заказа нет или ORDERS_SERVICE_URL не задан.
+func cachedOrder(r *http.Request, orderID int) (*clients.Order, error) {
+	var o clients.Order
+	key := strconv.Itoa(orderID)
+	if orderTotals.Get(r.Context(), key, &o) {
+		return &o, nil
+	}
+	ref, _, err := lookupOrder(r, orderID)
+	if ref != nil {
+		orderTotals.Set(r.Context(), key, ref)
+	}
+	return ref, err
+}
@@ -0,0 +1,60 @@
+// Package admin защищает служебные маршруты (/admin/*) внутренним
+// API-ключом из INTERNAL_API_KEY.
+package admin
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"os"
+
+	"pkg/apierr"
+)
+
+// APIKeyHeader — заголовок, в котором передаётся INTERNAL_API_KEY.
+const APIKeyHeader = "X-Internal-API-Key"
+
+// ActorHeader — необязательное имя оператора, выполняющего запрос с
+// INTERNAL_API_KEY; попадает в журнал аудита.
+const ActorHeader = "X-Actor"
+
+// Actor — кто выполняет запрос: "api-key:<X-Actor>" для запросов с верным
+// внутренним ключом, иначе "anonymous@<адрес клиента>".
+func Actor(r *http.Request) string {
+	if HasKey(r) {
+		if name := r.Header.Get(ActorHeader); name != "" {
+			return "api-key:" + name
+		}
+		return "api-key"
+	}
+	addr := r.Header.Get("X-Real-IP")
+	if addr == "" {
+		addr, _, _ = net.SplitHostPort(r.RemoteAddr)
+	}
+	return "anonymous@" + addr
+}
+
+// HasKey сообщает, что запрос пришёл с верным внутренним ключом. Для
+// обычных маршрутов, где ключ лишь расширяет права (например, снимает
+// лимиты).
+func HasKey(r *http.Request) bool {
+	key := os.Getenv("INTERNAL_API_KEY")
+	return key != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get(APIKeyHeader)), []byte(key)) == 1
+}
+
+// RequireKey пропускает запрос только с верным ключом. Если
+// INTERNAL_API_KEY не задан, служебный маршрут отключён (403).
+func RequireKey(next http.HandlerFunc) http.HandlerFunc {
+	key := os.Getenv("INTERNAL_API_KEY")
+	return func(w http.ResponseWriter, r *http.Request) {
+		if key == "" {
+			apierr.Write(w, apierr.FeatureDisabled, "Admin API disabled: INTERNAL_API_KEY not set")
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(APIKeyHeader)), []byte(key)) != 1 {
+			apierr.Write(w, apierr.InvalidAPIKey, "Invalid internal API key")
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,173 @@
+// Package apierr — общий для всех сервисов реестр машиночитаемых кодов
+// ошибок API.
+//
+// Тело ошибки всегда {"code": "...", "error": "..."} и, при необходимости,
+// дополнительные поля (With). HTTP-статус определяется кодом по реестру, а
+// не обработчиком, поэтому один и тот же код во всех сервисах означает
+// одно и то же. Обработчики не пишут ошибки через http.Error: только
+// Write, Respond или Internal.
+//
+// Текст error локализуется по Accept-Language (Localize, каталоги в
+// messages/*.json); code от языка не зависит.
+package apierr
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+)
+
+// Code — машиночитаемый код ошибки.
+type Code string
+
+// Error — типизированная ошибка API. Details попадают в тело ответа рядом
+// с code и error.
+type Error struct {
+	Code    Code
+	Message string
+	Details map[string]interface{}
+
+	fields map[string]Violation // см. Invalid
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Status — HTTP-статус кода ошибки.
+func (e *Error) Status() int { return Status(e.Code) }
+
+// With добавляет поле в тело ответа.
+func (e *Error) With(key string, value interface{}) *Error {
+	if e.Details == nil {
+		e.Details = map[string]interface{}{}
+	}
+	e.Details[key] = value
+	return e
+}
+
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.body(""))
+}
+
+// body собирает тело ответа на языке lang; "" — без перевода: сообщение
+// обработчика и тексты правил на DefaultLanguage.
+func (e *Error) body(lang string) map[string]interface{} {
+	body := make(map[string]interface{}, len(e.Details)+4)
+	for k, v := range e.Details {
+		body[k] = v
+	}
+	body["code"] = e.Code
+	body["error"] = e.Message
+	if lang != "" {
+		if msg := Message(lang, e.Code); msg != "" {
+			body["error"] = msg
+			if e.Message != "" && e.Message != msg {
+				body["detail"] = e.Message
+			}
+		}
+	}
+	if e.fields != nil {
+		ruleLang := lang
+		if ruleLang == "" {
+			ruleLang = DefaultLanguage
+		}
+		fields := make(map[string]string, len(e.fields))
+		for name, v := range e.fields {
+			fields[name] = v.message(ruleLang)
+		}
+		body["fields"] = fields
+	}
+	return body
+}
+
+// New создаёт ошибку с кодом из реестра.
+func New(code Code, msg string) *Error {
+	return &Error{Code: code, Message: msg}
+}
+
+// Status возвращает HTTP-статус кода; незарегистрированный код — ошибка
+// программиста, такой ответ уходит как 500.
+func Status(code Code) int {
+	if d, ok := registry[code]; ok {
+		return d.status
+	}
+	log.Printf("⚠️ apierr: unregistered error code %q", code)
+	return http.StatusInternalServerError
+}
+
+// Write отвечает ошибкой с кодом и сообщением.
+func Write(w http.ResponseWriter, code Code, msg string) {
+	Respond(w, New(code, msg))
+}
+
+// translate переводит ошибки нижних слоёв (например, Postgres — см.
+// pkg/pg) в коды API; nil — перевода нет.
+var translate func(error) *Error
+
+// SetTranslator задаёт перевод ошибок для Internal и Respond. Вызывается
+// при старте, до обработки запросов.
+func SetTranslator(fn func(error) *Error) {
+	translate = fn
+}
+
+func translated(err error) *Error {
+	if translate == nil {
+		return nil
+	}
+	return translate(err)
+}
+
+// Internal отвечает internal_error с текстом err. Ошибка, которую
+// переводит SetTranslator (нарушение уникальности и т.п.), уходит со своим
+// кодом.
+func Internal(w http.ResponseWriter, err error) {
+	if e := translated(err); e != nil {
+		Respond(w, e)
+		return
+	}
+	Write(w, InternalError, err.Error())
+}
+
+// Respond отвечает ошибкой err: *Error — её кодом, переводимая
+// SetTranslator — переведённым, любая другая — internal_error. Язык
+// сообщения выбирает Localize.
+func Respond(w http.ResponseWriter, err error) {
+	var e *Error
+	if !errors.As(err, &e) {
+		if e = translated(err); e == nil {
+			e = New(InternalError, err.Error())
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	lang := languageOf(w)
+	if lang != "" {
+		w.Header().Set("Content-Language", lang)
+	}
+	w.WriteHeader(e.Status())
+	json.NewEncoder(w).Encode(e.body(lang))
+}
+
+// CatalogEntry — строка каталога кодов.
+type CatalogEntry struct {
+	Code        Code   `json:"code"`
+	Status      int    `json:"status"`
+	Description string `json:"description"`
+}
+
+// Catalog — все зарегистрированные коды, по алфавиту.
+func Catalog() []CatalogEntry {
+	out := make([]CatalogEntry, 0, len(registry))
+	for code, d := range registry {
+		out = append(out, CatalogEntry{Code: code, Status: d.status, Description: d.description})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Code < out[j].Code })
+	return out
+}
+
+// CatalogHandler — GET /errors/catalog: каталог кодов для клиентов.
+func CatalogHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Catalog())
+}
@@ -0,0 +1,224 @@
+package apierr
+
+import "net/http"
+
+// Коды ошибок. Новый код добавляется сюда и в registry — каталог
+// /errors/catalog строится из registry.
+const (
+	// Общие
+	InvalidRequest          Code = "invalid_request"
+	ValidationFailed        Code = "validation_failed"
+	InvalidReference        Code = "invalid_reference"
+	Unauthorized            Code = "unauthorized"
+	Forbidden               Code = "forbidden"
+	FeatureDisabled         Code = "feature_disabled"
+	NotFound                Code = "not_found"
+	NotAcceptable           Code = "not_acceptable"
+	Conflict                Code = "conflict"
+	InvalidState            Code = "invalid_state"
+	InvalidStatusTransition Code = "invalid_status_transition"
+	AlreadyResolved         Code = "already_resolved"
+	AlreadyRunning          Code = "already_running"
+	ResourceLocked          Code = "resource_locked"
+	IdempotencyInProgress   Code = "idempotency_in_progress"
+	PreconditionFailed      Code = "precondition_failed"
+	PayloadTooLarge         Code = "payload_too_large"
+	UnsupportedMediaType    Code = "unsupported_media_type"
+	RateLimited             Code = "rate_limited"
+	InternalError           Code = "internal_error"
+	UpstreamFailed          Code = "upstream_failed"
+	DependencyUnavailable   Code = "dependency_unavailable"
+	ServiceUnavailable      Code = "service_unavailable"
+	ReadOnly                Code = "read_only"
+	Maintenance             Code = "maintenance"
+	TooManyStreams          Code = "too_many_streams"
+	ConcurrentUpdate        Code = "concurrent_update"
+	Overloaded              Code = "overloaded"
+	DatabaseUnavailable     Code = "database_unavailable"
+
+	// Аутентификация и доступ
+	InvalidCredentials        Code = "invalid_credentials"
+	InvalidRefreshToken       Code = "invalid_refresh_token"
+	InvalidChallenge          Code = "invalid_challenge"
+	InvalidAPIKey             Code = "invalid_api_key"
+	InvalidSignature          Code = "invalid_signature"
+	ClientCertificateRequired Code = "client_certificate_required"
+	AccountDeactivated        Code = "account_deactivated"
+	ImpersonationForbidden    Code = "impersonation_forbidden"
+	InvalidToken              Code = "invalid_token"
+
+	// Пользователи
+	UserNotFound                    Code = "user_not_found"
+	UnknownUser                     Code = "unknown_user"
+	SessionNotFound                 Code = "session_not_found"
+	AvatarNotFound                  Code = "avatar_not_found"
+	DuplicateEmail                  Code = "duplicate_email"
+	DuplicateUsername               Code = "duplicate_username"
+	EmailChangeRequiresConfirmation Code = "email_change_requires_confirmation"
+	UsernameChangeTooSoon           Code = "username_change_too_soon"
+	Invalid2FACode                  Code = "invalid_2fa_code"
+	EmailDomainNotAllowed           Code = "email_domain_not_allowed"
+
+	// Заказы
+	OrderNotFound           Code = "order_not_found"
+	UnknownOrder            Code = "unknown_order"
+	OrderArchived           Code = "order_archived"
+	OpenOrderLimitReached   Code = "open_order_limit_reached"
+	BulkDeleteOverCap       Code = "bulk_delete_over_cap"
+	OrderHasDependencies    Code = "order_has_dependencies"
+	OrderAmountBelowMinimum Code = "order_amount_below_minimum"
+	AgeRequirementNotMet    Code = "age_requirement_not_met"
+
+	// Платежи
+	PaymentNotFound             Code = "payment_not_found"
+	DisputeNotFound             Code = "dispute_not_found"
+	SettlementNotFound          Code = "settlement_not_found"
+	PaymentNotCompleted         Code = "payment_not_completed"
+	AmountMismatch              Code = "amount_mismatch"
+	CurrencyMismatch            Code = "currency_mismatch"
+	UnsupportedCurrency         Code = "unsupported_currency"
+	AmountBelowMinimum          Code = "amount_below_minimum"
+	AmountAboveMaximum          Code = "amount_above_maximum"
+	CardNotAllowed              Code = "card_not_allowed"
+	InvalidCardNumber           Code = "invalid_card_number"
+	InvalidCardExpiry           Code = "invalid_card_expiry"
+	CardExpired                 Code = "card_expired"
+	InvalidDisputeAmount        Code = "invalid_dispute_amount"
+	PaymentNotAuthorized        Code = "payment_not_authorized"
+	CaptureExceedsAuthorization Code = "capture_exceeds_authorization"
+	TestModeMismatch            Code = "test_mode_mismatch"
+
+	// Доставка
+	DeliveryNotFound            Code = "delivery_not_found"
+	PackageNotFound             Code = "package_not_found"
+	ShiftNotFound               Code = "shift_not_found"
+	WebhookSubscriptionNotFound Code = "webhook_subscription_not_found"
+	PickupPointNotFound         Code = "pickup_point_not_found"
+	DuplicateBarcode            Code = "duplicate_barcode"
+	ShiftOverlap                Code = "shift_overlap"
+	SlotFull                    Code = "slot_full"
+	CourierNotOnShift           Code = "courier_not_on_shift"
+	CourierCapacityExceeded     Code = "courier_capacity_exceeded"
+	ExportTooLarge              Code = "export_too_large"
+	OutsideServiceArea          Code = "outside_service_area"
+	RecipientAgeNotVerified     Code = "recipient_age_not_verified"
+	InvalidPickupCode           Code = "invalid_pickup_code"
+
+	// Отчёты
+	ReportNotFound Code = "report_not_found"
+
+	// Межсервисное
+	DeadLetterNotFound Code = "dead_letter_not_found"
+)
+
+type definition struct {
+	status      int
+	description string
+}
+
+var registry = map[Code]definition{
+	// Общие
+	InvalidRequest:          {http.StatusBadRequest, "Запрос не разобран: некорректное тело, параметр или формат"},
+	ValidationFailed:        {http.StatusUnprocessableEntity, "Данные разобраны, но не прошли проверку; поля с ошибками — в fields, если есть"},
+	InvalidReference:        {http.StatusUnprocessableEntity, "Запрос ссылается на несуществующую запись; ограничение — в constraint"},
+	Unauthorized:            {http.StatusUnauthorized, "Нужна аутентификация"},
+	Forbidden:               {http.StatusForbidden, "Недостаточно прав"},
+	FeatureDisabled:         {http.StatusForbidden, "Возможность выключена конфигурацией сервиса"},
+	NotFound:                {http.StatusNotFound, "Ресурс не найден"},
+	NotAcceptable:           {http.StatusNotAcceptable, "Нет представления в запрошенном формате (Accept)"},
+	Conflict:                {http.StatusConflict, "Запрос противоречит текущему состоянию ресурса"},
+	InvalidState:            {http.StatusConflict, "Действие недоступно в текущем состоянии ресурса"},
+	InvalidStatusTransition: {http.StatusConflict, "Переход в запрошенный статус из текущего запрещён"},
+	AlreadyResolved:         {http.StatusConflict, "Ресурс уже закрыт (разрешён) и не меняется"},
+	AlreadyRunning:          {http.StatusConflict, "Такая операция уже выполняется"},
+	ResourceLocked:          {http.StatusConflict, "Ресурс дольше lock_timeout меняет другой запрос; перечитать его перед повтором — переход может быть уже недопустим"},
+	IdempotencyInProgress:   {http.StatusConflict, "Запрос с тем же Idempotency-Key ещё выполняется; повторить позже — ответ будет тем же"},
+	PreconditionFailed:      {http.StatusPreconditionFailed, "Ресурс изменился после версии, указанной в условном заголовке"},
+	PayloadTooLarge:         {http.StatusRequestEntityTooLarge, "Тело запроса превышает лимит"},
+	UnsupportedMediaType:    {http.StatusUnsupportedMediaType, "Тип содержимого не поддерживается"},
+	RateLimited:             {http.StatusTooManyRequests, "Слишком много запросов; см. Retry-After"},
+	InternalError:           {http.StatusInternalServerError, "Внутренняя ошибка сервиса"},
+	UpstreamFailed:          {http.StatusBadGateway, "Внешняя система (почта, хранилище) отказала"},
+	DependencyUnavailable:   {http.StatusServiceUnavailable, "Недоступен другой сервис, нужный для ответа; запрос можно повторить"},
+	ServiceUnavailable:      {http.StatusServiceUnavailable, "Сервис временно не может обработать запрос"},
+	ReadOnly:                {http.StatusServiceUnavailable, "Сервис в режиме только чтения, изменения временно отключены"},
+	Maintenance:             {http.StatusServiceUnavailable, "Сервис на обслуживании"},
+	TooManyStreams:          {http.StatusServiceUnavailable, "Исчерпан лимит одновременных WebSocket/SSE-подключений"},
+	ConcurrentUpdate:        {http.StatusServiceUnavailable, "Транзакция прервана конкурирующим изменением; запрос можно повторить"},
+	Overloaded:              {http.StatusServiceUnavailable, "Реплика перегружена и не приняла запрос; повторить после Retry-After"},
+	DatabaseUnavailable:     {http.StatusServiceUnavailable, "Нет соединения с базой данных; повторить после Retry-After"},
+
+	// Аутентификация и доступ
+	InvalidCredentials:        {http.StatusUnauthorized, "Неверный email, пароль или код 2FA"},
+	InvalidRefreshToken:       {http.StatusUnauthorized, "Refresh-токен неизвестен, отозван или истёк"},
+	InvalidChallenge:          {http.StatusUnauthorized, "Токен второго шага входа неверен или истёк"},
+	InvalidAPIKey:             {http.StatusUnauthorized, "Неверный X-Internal-API-Key"},
+	InvalidSignature:          {http.StatusUnauthorized, "Подпись межсервисного запроса (X-Signature) неверна"},
+	ClientCertificateRequired: {http.StatusUnauthorized, "Маршрут доступен только с клиентским сертификатом mTLS"},
+	AccountDeactivated:        {http.StatusForbidden, "Аккаунт деактивирован"},
+	ImpersonationForbidden:    {http.StatusForbidden, "Действие запрещено под имперсонацией"},
+	InvalidToken:              {http.StatusNotFound, "Одноразовый токен из письма неверен или истёк"},
+
+	// Пользователи
+	UserNotFound:                    {http.StatusNotFound, "Пользователь не найден"},
+	UnknownUser:                     {http.StatusBadRequest, "Указанный пользователь не существует или деактивирован"},
+	SessionNotFound:                 {http.StatusNotFound, "Сессия не найдена"},
+	AvatarNotFound:                  {http.StatusNotFound, "У пользователя нет аватара"},
+	DuplicateEmail:                  {http.StatusConflict, "Email уже занят другим аккаунтом"},
+	DuplicateUsername:               {http.StatusConflict, "Username занят или закреплён за прежним владельцем"},
+	EmailChangeRequiresConfirmation: {http.StatusConflict, "Email меняется только через POST /users/{id}/change-email"},
+	UsernameChangeTooSoon:           {http.StatusTooManyRequests, "Username можно менять не чаще раза в 30 дней"},
+	Invalid2FACode:                  {http.StatusUnprocessableEntity, "Неверный код TOTP"},
+	EmailDomainNotAllowed:           {http.StatusUnprocessableEntity, "Домен email в блок-листе или вне allowlist; домен — в domain"},
+
+	// Заказы
+	OrderNotFound:           {http.StatusNotFound, "Заказ не найден"},
+	UnknownOrder:            {http.StatusBadRequest, "Указанный заказ не существует"},
+	OrderArchived:           {http.StatusConflict, "Заказ в архиве и не меняется"},
+	OpenOrderLimitReached:   {http.StatusConflict, "У пользователя слишком много открытых заказов; лимит — в limit"},
+	BulkDeleteOverCap:       {http.StatusConflict, "Под фильтр попадает больше заказов, чем разрешено без confirm_over_cap; число — в matched, предел — в cap"},
+	OrderHasDependencies:    {http.StatusConflict, "У заказа есть незавершённые платежи или доставки; список — в blocking"},
+	OrderAmountBelowMinimum: {http.StatusUnprocessableEntity, "Сумма заказа меньше MIN_ORDER_AMOUNT; граница — в min_amount, валюта — в currency"},
+	AgeRequirementNotMet:    {http.StatusUnprocessableEntity, "Покупателю меньше MIN_CUSTOMER_AGE, а заказ с age_restricted; граница — в min_age"},
+
+	// Платежи
+	PaymentNotFound:             {http.StatusNotFound, "Платёж не найден"},
+	DisputeNotFound:             {http.StatusNotFound, "Спор не найден"},
+	SettlementNotFound:          {http.StatusNotFound, "Сверка не найдена"},
+	PaymentNotCompleted:         {http.StatusConflict, "Действие доступно только для проведённого платежа"},
+	AmountMismatch:              {http.StatusUnprocessableEntity, "Сумма платежа не совпадает с суммой заказа"},
+	CurrencyMismatch:            {http.StatusUnprocessableEntity, "Валюта платежа не совпадает с валютой заказа"},
+	UnsupportedCurrency:         {http.StatusUnprocessableEntity, "Валюта не поддерживается"},
+	AmountBelowMinimum:          {http.StatusUnprocessableEntity, "Сумма меньше минимума для способа оплаты; граница — в min_amount"},
+	AmountAboveMaximum:          {http.StatusUnprocessableEntity, "Сумма больше максимума для способа оплаты; граница — в max_amount"},
+	CardNotAllowed:              {http.StatusUnprocessableEntity, "Данные карты принимаются только для payment_method card"},
+	InvalidCardNumber:           {http.StatusUnprocessableEntity, "Номер карты неверен"},
+	InvalidCardExpiry:           {http.StatusUnprocessableEntity, "Срок действия карты указан неверно"},
+	CardExpired:                 {http.StatusUnprocessableEntity, "Срок действия карты истёк"},
+	InvalidDisputeAmount:        {http.StatusUnprocessableEntity, "Сумма спора не положительна или больше списанной суммы платежа"},
+	PaymentNotAuthorized:        {http.StatusConflict, "Списать или отменить можно только действующую авторизацию (pending или partially_captured)"},
+	CaptureExceedsAuthorization: {http.StatusUnprocessableEntity, "Сумма списания больше остатка авторизации; остаток — в capturable"},
+	TestModeMismatch:            {http.StatusConflict, "У заказа уже есть платежи другого режима: тестовые (песочница) и боевые не смешиваются"},
+
+	// Доставка
+	DeliveryNotFound:            {http.StatusNotFound, "Доставка не найдена"},
+	PackageNotFound:             {http.StatusNotFound, "Посылка не найдена"},
+	ShiftNotFound:               {http.StatusNotFound, "Смена курьера не найдена"},
+	WebhookSubscriptionNotFound: {http.StatusNotFound, "Подписка на вебхуки не найдена"},
+	PickupPointNotFound:         {http.StatusNotFound, "Пункт выдачи не найден"},
+	DuplicateBarcode:            {http.StatusConflict, "Штрихкод уже зарегистрирован"},
+	ShiftOverlap:                {http.StatusConflict, "Смена пересекается с другой сменой курьера"},
+	SlotFull:                    {http.StatusConflict, "Окно доставки заполнено; свободные окна — в alternatives"},
+	CourierNotOnShift:           {http.StatusUnprocessableEntity, "Курьер не на смене"},
+	CourierCapacityExceeded:     {http.StatusUnprocessableEntity, "Посылки тяжелее, чем может везти курьер"},
+	ExportTooLarge:              {http.StatusUnprocessableEntity, "Под фильтры попадает больше строк, чем допускает экспорт"},
+	OutsideServiceArea:          {http.StatusUnprocessableEntity, "Адрес вне зон доставки; ближайшая зона — в nearest_zone"},
+	RecipientAgeNotVerified:     {http.StatusUnprocessableEntity, "Доставку с age_restricted нельзя завершить без recipient_age_verified"},
+	InvalidPickupCode:           {http.StatusUnprocessableEntity, "Код получения не совпадает с кодом доставки"},
+
+	// Отчёты
+	ReportNotFound: {http.StatusNotFound, "Отчёт за эту дату не сформирован"},
+
+	// Межсервисное
+	DeadLetterNotFound: {http.StatusNotFound, "Запись dead letter не найдена"},
+}
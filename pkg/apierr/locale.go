@@ -0,0 +1,194 @@
+package apierr
+
+import (
+	"bufio"
+	"embed"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLanguage — язык, если ни один из Accept-Language не поддерживается.
+const DefaultLanguage = "en"
+
+//go:embed messages/*.json
+var messageFiles embed.FS
+
+// catalog — тексты одного языка: сообщения по кодам и шаблоны правил
+// валидации полей ({limit} подставляется из Violation).
+type catalog struct {
+	Codes map[Code]string `json:"codes"`
+	Rules map[Rule]string `json:"rules"`
+}
+
+var catalogs = loadCatalogs()
+
+func loadCatalogs() map[string]catalog {
+	files, err := messageFiles.ReadDir("messages")
+	if err != nil {
+		panic(err)
+	}
+	out := map[string]catalog{}
+	for _, f := range files {
+		b, err := messageFiles.ReadFile("messages/" + f.Name())
+		if err != nil {
+			panic(err)
+		}
+		var c catalog
+		if err := json.Unmarshal(b, &c); err != nil {
+			panic("apierr: messages/" + f.Name() + ": " + err.Error())
+		}
+		out[strings.TrimSuffix(f.Name(), path.Ext(f.Name()))] = c
+	}
+	return out
+}
+
+// Languages — поддерживаемые языки сообщений.
+func Languages() []string {
+	out := make([]string, 0, len(catalogs))
+	for lang := range catalogs {
+		out = append(out, lang)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Message — текст кода на языке lang (с откатом на DefaultLanguage).
+func Message(lang string, code Code) string {
+	if msg, ok := catalogs[lang].Codes[code]; ok {
+		return msg
+	}
+	return catalogs[DefaultLanguage].Codes[code]
+}
+
+// Negotiate выбирает язык по заголовку Accept-Language: теги по убыванию
+// q, для каждого — точное совпадение, затем основной подтег (ru-RU → ru);
+// "*" и пустой заголовок дают DefaultLanguage.
+func Negotiate(header string) string {
+	type tag struct {
+		name string
+		q    float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" && q > 0 {
+			tags = append(tags, tag{name, q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	for _, t := range tags {
+		if t.name == "*" {
+			return DefaultLanguage
+		}
+		if _, ok := catalogs[t.name]; ok {
+			return t.name
+		}
+		base, _, _ := strings.Cut(t.name, "-")
+		if _, ok := catalogs[base]; ok {
+			return base
+		}
+	}
+	return DefaultLanguage
+}
+
+// Localize выбирает язык ответов-ошибок по Accept-Language. Без заголовка
+// ошибки уходят с сообщением обработчика, как и раньше; с заголовком
+// error — текст из каталога, а сообщение обработчика — в detail.
+// Подключается первым router.Use, чтобы охватить и ошибки middleware.
+func Localize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h := r.Header.Get("Accept-Language"); h != "" {
+			w = &localizedWriter{ResponseWriter: w, lang: Negotiate(h)}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// localizedWriter несёт выбранный язык до Respond, сохраняя поддержку
+// Flusher и Hijacker для SSE и WebSocket.
+type localizedWriter struct {
+	http.ResponseWriter
+	lang string
+}
+
+func (w *localizedWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *localizedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hj.Hijack()
+}
+
+func (w *localizedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// languageOf ищет язык в цепочке обёрток ResponseWriter; "" — заголовка
+// не было.
+func languageOf(w http.ResponseWriter) string {
+	for {
+		switch v := w.(type) {
+		case *localizedWriter:
+			return v.lang
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return ""
+		}
+	}
+}
+
+// Rule — правило валидации поля; текст нарушения берётся из каталога.
+type Rule string
+
+const (
+	RuleRequired     Rule = "required"
+	RuleMaxLength    Rule = "max_length"
+	RuleMaxItems     Rule = "max_items"
+	RuleUnsupported  Rule = "unsupported"
+	RuleImmutable    Rule = "immutable"
+	RuleFuture       Rule = "future"
+	RuleMaxDaysAhead Rule = "max_days_ahead"
+	RuleNotNull      Rule = "not_null"
+)
+
+// Violation — нарушение правила полем. Limit подставляется в шаблон
+// вместо {limit}.
+type Violation struct {
+	Rule  Rule
+	Limit int
+}
+
+func (v Violation) message(lang string) string {
+	tmpl, ok := catalogs[lang].Rules[v.Rule]
+	if !ok {
+		tmpl = catalogs[DefaultLanguage].Rules[v.Rule]
+	}
+	return strings.ReplaceAll(tmpl, "{limit}", strconv.Itoa(v.Limit))
+}
+
+// Invalid — validation_failed с нарушениями по полям. Имена полей в ответе
+// не переводятся, тексты правил — на языке запроса.
+func Invalid(fields map[string]Violation) *Error {
+	e := New(ValidationFailed, "validation failed")
+	e.fields = fields
+	return e
+}
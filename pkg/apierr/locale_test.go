@@ -0,0 +1,137 @@
+package apierr
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCatalogsCoverRegistry(t *testing.T) {
+	for _, lang := range []string{"en", "ru"} {
+		c, ok := catalogs[lang]
+		if !ok {
+			t.Fatalf("no catalog for %s", lang)
+		}
+		for code := range registry {
+			if c.Codes[code] == "" {
+				t.Errorf("%s: no message for %s", lang, code)
+			}
+		}
+		for code := range c.Codes {
+			if _, ok := registry[code]; !ok {
+				t.Errorf("%s: message for unregistered code %s", lang, code)
+			}
+		}
+		for _, rule := range []Rule{RuleRequired, RuleMaxLength, RuleMaxItems, RuleUnsupported, RuleImmutable, RuleNotNull} {
+			if c.Rules[rule] == "" {
+				t.Errorf("%s: no text for rule %s", lang, rule)
+			}
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	cases := map[string]string{
+		"":                                "en",
+		"ru":                              "ru",
+		"ru-RU,ru;q=0.9,en;q=0.8":         "ru",
+		"de-DE,en;q=0.5,ru;q=0.7":         "ru",
+		"de, fr;q=0.5":                    "en",
+		"EN-gb":                           "en",
+		"ru;q=0, en":                      "en",
+		"*":                               "en",
+		"fr;q=0.9, ru-UA;q=0.95, *;q=0.1": "ru",
+	}
+	for header, want := range cases {
+		if got := Negotiate(header); got != want {
+			t.Errorf("Negotiate(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+// respond прогоняет ошибку через Localize и возвращает разобранное тело.
+func respond(t *testing.T, acceptLanguage string, err error) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	h := Localize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Respond(w, err)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if acceptLanguage != "" {
+		req.Header.Set("Accept-Language", acceptLanguage)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	return rec, body
+}
+
+func TestRespondLocalizesMessages(t *testing.T) {
+	cases := []struct {
+		code   Code
+		en, ru string
+	}{
+		{OrderNotFound, "Order not found.", "Заказ не найден."},
+		{InvalidStatusTransition, "The status cannot be changed this way.", "Статус нельзя изменить таким образом."},
+		{DuplicateEmail, "This email is already in use.", "Этот email уже используется."},
+		{DependencyUnavailable, "A required service is temporarily unavailable. Please try again.", "Нужный сервис временно недоступен. Повторите попытку."},
+		{CardExpired, "The card has expired.", "Срок действия карты истёк."},
+	}
+	for _, c := range cases {
+		for lang, want := range map[string]string{"en-US": c.en, "ru-RU,ru;q=0.9": c.ru} {
+			rec, body := respond(t, lang, New(c.code, "handler message"))
+			if rec.Code != Status(c.code) {
+				t.Errorf("%s %s: status %d, want %d", c.code, lang, rec.Code, Status(c.code))
+			}
+			if body["code"] != string(c.code) {
+				t.Errorf("%s %s: code %v", c.code, lang, body["code"])
+			}
+			if body["error"] != want {
+				t.Errorf("%s %s: error %q, want %q", c.code, lang, body["error"], want)
+			}
+			if body["detail"] != "handler message" {
+				t.Errorf("%s %s: detail %v", c.code, lang, body["detail"])
+			}
+		}
+	}
+}
+
+func TestRespondWithoutAcceptLanguageKeepsHandlerMessage(t *testing.T) {
+	rec, body := respond(t, "", New(UserNotFound, "User not found"))
+	if body["error"] != "User not found" || body["detail"] != nil {
+		t.Errorf("unexpected body %v", body)
+	}
+	if rec.Header().Get("Content-Language") != "" {
+		t.Errorf("Content-Language set without Accept-Language")
+	}
+}
+
+func TestRespondLocalizesFieldRules(t *testing.T) {
+	err := Invalid(map[string]Violation{
+		"tags[0]":  {Rule: RuleRequired},
+		"tags[1]":  {Rule: RuleMaxLength, Limit: 32},
+		"currency": {Rule: RuleUnsupported},
+	})
+	want := map[string]map[string]string{
+		"en": {"tags[0]": "must not be empty", "tags[1]": "must be at most 32 characters", "currency": "is not supported"},
+		"ru": {"tags[0]": "не может быть пустым", "tags[1]": "не длиннее 32 символов", "currency": "не поддерживается"},
+	}
+	for lang, fields := range want {
+		rec, body := respond(t, lang, err)
+		if rec.Code != http.StatusUnprocessableEntity || body["code"] != string(ValidationFailed) {
+			t.Fatalf("%s: status %d code %v", lang, rec.Code, body["code"])
+		}
+		if rec.Header().Get("Content-Language") != lang {
+			t.Errorf("%s: Content-Language %q", lang, rec.Header().Get("Content-Language"))
+		}
+		got, _ := body["fields"].(map[string]interface{})
+		for field, msg := range fields {
+			if got[field] != msg {
+				t.Errorf("%s: fields[%s] = %v, want %q", lang, field, got[field], msg)
+			}
+		}
+	}
+}
@@ -0,0 +1,287 @@
+// Package audit пишет журнал административных и удаляющих действий в
+// таблицу audit_log.
+//
+// Middleware создаёт запись для DELETE и для изменяющих запросов к
+// служебным префиксам и сохраняет её после успешного (2xx) ответа.
+// Обработчик, выполняющий действие одним запросом в транзакции, может
+// записать её сам через Write(ctx, tx) — тогда запись атомарна с
+// действием. Если обработчик этого не сделал, запись всё равно сохранит
+// middleware, поэтому пропустить аудит обработчик не может.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"pkg/admin"
+	"pkg/apierr"
+	"pkg/auth"
+	"pkg/observe"
+)
+
+// Entry — запись журнала аудита.
+type Entry struct {
+	ID           int64     `json:"id"`
+	Actor        string    `json:"actor"`
+	Action       string    `json:"action"`
+	ResourceType string    `json:"resource_type"`
+	ResourceID   string    `json:"resource_id"`
+	BodySHA256   string    `json:"body_sha256"`
+	RequestID    string    `json:"request_id"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Execer — *sql.DB или *sql.Tx.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+type ctxKey struct{}
+
+// pending — запись текущего запроса; written защищает от двойной записи.
+type pending struct {
+	mu      sync.Mutex
+	entry   Entry
+	written bool
+}
+
+// Write сохраняет запись текущего запроса через ex (обычно транзакцию
+// обработчика). Вне аудируемого запроса ничего не делает. Успешный ответ
+// обработчика означает, что транзакция зафиксирована, и middleware
+// повторно запись не делает.
+func Write(ctx context.Context, ex Execer) error {
+	p, ok := ctx.Value(ctxKey{}).(*pending)
+	if !ok {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.written {
+		return nil
+	}
+	if err := insert(ctx, ex, p.entry); err != nil {
+		return err
+	}
+	p.written = true
+	return nil
+}
+
+// Record сохраняет запись, не привязанную к аудируемому запросу, например
+// начало и конец имперсонации. Пустой RequestID берётся из контекста.
+func Record(ctx context.Context, ex Execer, e Entry) error {
+	if e.RequestID == "" {
+		e.RequestID = observe.RequestID(ctx)
+	}
+	return insert(ctx, ex, e)
+}
+
+// Actor — кто выполняет запрос: admin.Actor для запросов с внутренним
+// ключом и анонимных, "user:<id>" для запросов с access-токеном и
+// "user:<id> impersonated-by:<оператор>" под имперсонацией.
+func Actor(r *http.Request) string {
+	c := auth.FromContext(r.Context())
+	if c == nil || admin.HasKey(r) {
+		return admin.Actor(r)
+	}
+	if c.Impersonated() {
+		return "user:" + c.Subject + " impersonated-by:" + c.Impersonator
+	}
+	return "user:" + c.Subject
+}
+
+func insert(ctx context.Context, ex Execer, e Entry) error {
+	_, err := ex.ExecContext(ctx,
+		`INSERT INTO audit_log (actor, action, resource_type, resource_id, body_sha256, request_id)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		e.Actor, e.Action, e.ResourceType, e.ResourceID, e.BodySHA256, e.RequestID)
+	return err
+}
+
+// Middleware аудирует DELETE и изменяющие запросы к путям с префиксами
+// prefixes (например "/admin/"). Подключается через router.Use после
+// observe.Middleware, чтобы в записи был id запроса.
+func Middleware(db *sql.DB, prefixes ...string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !audited(r, prefixes) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 10<<20))
+			if err != nil {
+				apierr.Write(w, apierr.PayloadTooLarge, err.Error())
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			sum := sha256.Sum256(body)
+
+			p := &pending{entry: newEntry(r, hex.EncodeToString(sum[:]))}
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), ctxKey{}, p)))
+
+			if rec.status < 200 || rec.status > 299 {
+				return
+			}
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if p.written {
+				return
+			}
+			// Ответ уже отправлен, поэтому ошибку можно только залогировать.
+			if err := insert(context.WithoutCancel(r.Context()), db, p.entry); err != nil {
+				log.Printf("⚠️ Audit write failed for %s %s: %v", p.entry.Action, p.entry.ResourceID, err)
+			}
+		})
+	}
+}
+
+func audited(r *http.Request, prefixes []string) bool {
+	if r.Method == http.MethodDelete {
+		return true
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodPatch {
+		return false
+	}
+	for _, p := range prefixes {
+		if strings.HasPrefix(r.URL.Path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func newEntry(r *http.Request, bodyHash string) Entry {
+	path := r.URL.Path
+	if cur := mux.CurrentRoute(r); cur != nil {
+		if tpl, err := cur.GetPathTemplate(); err == nil {
+			path = tpl
+		}
+	}
+	resourceType := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)[0]
+	if resourceType == "admin" {
+		resourceType = strings.TrimPrefix(path, "/")
+	}
+	return Entry{
+		Actor:        Actor(r),
+		Action:       r.Method + " " + path,
+		ResourceType: resourceType,
+		ResourceID:   mux.Vars(r)["id"],
+		BodySHA256:   bodyHash,
+		RequestID:    observe.RequestID(r.Context()),
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Handler — GET /admin/audit. Фильтры: actor, resource_type, resource_id,
+// from и to (RFC 3339 или YYYY-MM-DD). Постраничный вывод по убыванию id:
+// limit (до 500) и before_id — id последней записи предыдущей страницы.
+func Handler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		where := []string{"1=1"}
+		var args []interface{}
+		add := func(cond string, v interface{}) {
+			args = append(args, v)
+			where = append(where, strings.Replace(cond, "?", "$"+strconv.Itoa(len(args)), 1))
+		}
+
+		for _, f := range []string{"actor", "resource_type", "resource_id"} {
+			if v := q.Get(f); v != "" {
+				add(f+" = ?", v)
+			}
+		}
+		for _, f := range []struct{ param, cond string }{{"from", "created_at >= ?"}, {"to", "created_at < ?"}} {
+			v := q.Get(f.param)
+			if v == "" {
+				continue
+			}
+			t, err := parseTime(v)
+			if err != nil {
+				apierr.Write(w, apierr.InvalidRequest, f.param+": expected RFC 3339 or YYYY-MM-DD")
+				return
+			}
+			add(f.cond, t)
+		}
+		if v := q.Get("before_id"); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				apierr.Write(w, apierr.InvalidRequest, "before_id must be an integer")
+				return
+			}
+			add("id < ?", id)
+		}
+		limit := 100
+		if v, err := strconv.Atoi(q.Get("limit")); err == nil && v > 0 && v <= 500 {
+			limit = v
+		}
+		args = append(args, limit)
+
+		rows, err := db.QueryContext(r.Context(),
+			`SELECT id, actor, action, resource_type, resource_id, body_sha256, request_id, created_at
+			 FROM audit_log WHERE `+strings.Join(where, " AND ")+` ORDER BY id DESC LIMIT $`+strconv.Itoa(len(args)),
+			args...)
+		if err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		defer rows.Close()
+
+		entries := []Entry{}
+		for rows.Next() {
+			var e Entry
+			if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.ResourceType, &e.ResourceID, &e.BodySHA256, &e.RequestID, &e.CreatedAt); err != nil {
+				apierr.Internal(w, err)
+				return
+			}
+			entries = append(entries, e)
+		}
+		if err := rows.Err(); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+
+		resp := map[string]interface{}{"entries": entries}
+		if len(entries) == limit {
+			resp["next_before_id"] = entries[len(entries)-1].ID
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func parseTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
+}
@@ -0,0 +1,107 @@
+// Package auth разбирает JWT пользователей, выпущенные users-service
+// (HS256, общий секрет JWT_SECRET), и помечает запросы под имперсонацией.
+//
+// Middleware не требует токен: он лишь кладёт claims валидного
+// access-токена в контекст. Решать, нужен ли токен, — дело обработчика.
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+	"pkg/observe"
+)
+
+// ImpersonatorHeader — заголовок ответа на запрос под имперсонацией: кто
+// из операторов действует от имени пользователя.
+const ImpersonatorHeader = "X-Impersonator"
+
+// Claims — содержимое токена. Subject — id пользователя; sid — сессия
+// входа; purpose заполнен только у промежуточных токенов (например,
+// "2fa"), которые не принимаются как access-токен; impersonator — оператор,
+// выпустивший токен имперсонации.
+type Claims struct {
+	SessionID    string `json:"sid,omitempty"`
+	Purpose      string `json:"purpose,omitempty"`
+	Impersonator string `json:"impersonator,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Impersonated сообщает, что токен выпущен оператором от имени
+// пользователя.
+func (c *Claims) Impersonated() bool {
+	return c != nil && c.Impersonator != ""
+}
+
+// Secret — ключ подписи из JWT_SECRET; пустой, если JWT не настроен.
+func Secret() []byte {
+	return []byte(os.Getenv("JWT_SECRET"))
+}
+
+// Parse проверяет подпись и срок действия токена.
+func Parse(secret []byte, raw string) (*Claims, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("JWT_SECRET not set")
+	}
+	var c Claims
+	_, err := jwt.ParseWithClaims(raw, &c, func(*jwt.Token) (interface{}, error) { return secret, nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+type ctxKey struct{}
+
+// FromContext возвращает claims access-токена запроса или nil.
+func FromContext(ctx context.Context) *Claims {
+	c, _ := ctx.Value(ctxKey{}).(*Claims)
+	return c
+}
+
+// Middleware кладёт в контекст claims из Authorization: Bearer, если это
+// валидный access-токен. Запросы под имперсонацией пишутся в журнал и
+// помечаются заголовком ImpersonatorHeader. Подключается после
+// observe.Middleware и до audit.Middleware.
+func Middleware() mux.MiddlewareFunc {
+	secret := Secret()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || len(secret) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			c, err := Parse(secret, raw)
+			if err != nil || c.Purpose != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if c.Impersonated() {
+				w.Header().Set(ImpersonatorHeader, c.Impersonator)
+				log.Printf("🎭 impersonated request method=%s path=%s user=%s impersonator=%q request_id=%s",
+					r.Method, r.URL.Path, c.Subject, c.Impersonator, observe.RequestID(r.Context()))
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, c)))
+		})
+	}
+}
+
+// RefuseImpersonated отвечает 403 на запрос под имперсонацией. Для
+// необратимых действий (удаление пользователя, возврат платежа), которые
+// оператор не должен совершать от чужого имени.
+func RefuseImpersonated(w http.ResponseWriter, r *http.Request) bool {
+	if !FromContext(r.Context()).Impersonated() {
+		return false
+	}
+	apierr.Write(w, apierr.ImpersonationForbidden, "This action is not allowed under impersonation")
+	return true
+}
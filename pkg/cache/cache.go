@@ -0,0 +1,212 @@
+// Package cache — опциональный read-through кэш в Redis для GET по id.
+// Nil *Cache допустим и означает, что кэш выключен. Ошибки Redis только
+// логируются: запрос в таком случае обслуживается из базы.
+//
+// Чтение из базы с последующим Set может разминуться с изменением:
+// GET прочитал старую версию, PUT записал новую и вызвал Delete, а Set
+// GET пришёл уже после. Поэтому read-through берёт метку (Stamp) до
+// чтения из базы и кладёт запись через SetIfUnchanged: Delete меняет
+// метку, и опоздавший Set ничего не пишет.
+//
+// После Listen перед Redis работает ещё и кэш в памяти реплики; об
+// изменениях (Delete) реплики оповещают друг друга (см. invalidate.go).
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+)
+
+var requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "cache_requests_total",
+	Help: "Cache lookups by result: local_hit, hit, miss or error.",
+}, []string{"cache", "result"})
+
+type Cache struct {
+	rdb   *redis.Client
+	name  string
+	ttl   time.Duration
+	local *localStore
+	inv   *invalidation
+}
+
+// FromEnv подключается к REDIS_URL; TTL берётся из CACHE_TTL (по умолчанию 60s).
+// Возвращает nil, если REDIS_URL не задан.
+func FromEnv(name string) (*Cache, error) {
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		return nil, nil
+	}
+
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, err
+	}
+	ttl := 60 * time.Second
+	if v, err := time.ParseDuration(os.Getenv("CACHE_TTL")); err == nil {
+		ttl = v
+	}
+	c := &Cache{rdb: redis.NewClient(opts), name: name, ttl: ttl, inv: invalidationFromEnv()}
+	c.local = newLocalStore(c.localTTL())
+	c.inv.register(c)
+	return c, nil
+}
+
+// Sub возвращает кэш с другим префиксом ключей и TTL на том же соединении
+// с Redis. Закрывать его не нужно: соединение закрывает родитель.
+func (c *Cache) Sub(name string, ttl time.Duration) *Cache {
+	if c == nil {
+		return nil
+	}
+	sub := &Cache{rdb: c.rdb, name: name, ttl: ttl, inv: c.inv}
+	sub.local = newLocalStore(sub.localTTL())
+	c.inv.register(sub)
+	return sub
+}
+
+func (c *Cache) key(id string) string {
+	return c.name + ":" + id
+}
+
+// stampKey — счётчик удалений записи id, по нему сверяется SetIfUnchanged.
+func (c *Cache) stampKey(id string) string {
+	return c.name + ":" + id + ":stamp"
+}
+
+// stampTTL — сколько живёт метка после Delete: дольше любого чтения из
+// базы между Stamp и SetIfUnchanged.
+func (c *Cache) stampTTL() time.Duration {
+	if c.ttl > time.Minute {
+		return c.ttl
+	}
+	return time.Minute
+}
+
+// setIfUnchanged пишет запись, только если метка не изменилась с Stamp.
+var setIfUnchanged = redis.NewScript(`
+if (redis.call('GET', KEYS[2]) or '') ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+// Get читает запись в out. Возвращает true только при попадании.
+func (c *Cache) Get(ctx context.Context, id string, out interface{}) bool {
+	if c == nil {
+		return false
+	}
+
+	if data, ok := c.localGet(id); ok && json.Unmarshal(data, out) == nil {
+		requestsTotal.WithLabelValues(c.name, "local_hit").Inc()
+		return true
+	}
+	data, err := c.rdb.Get(ctx, c.key(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		requestsTotal.WithLabelValues(c.name, "miss").Inc()
+		return false
+	}
+	if err == nil {
+		err = json.Unmarshal(data, out)
+	}
+	if err != nil {
+		requestsTotal.WithLabelValues(c.name, "error").Inc()
+		log.Printf("⚠️ Cache get %s failed: %v", c.key(id), err)
+		return false
+	}
+	requestsTotal.WithLabelValues(c.name, "hit").Inc()
+	c.localSet(id, data)
+	return true
+}
+
+func (c *Cache) Set(ctx context.Context, id string, v interface{}) {
+	if c == nil {
+		return
+	}
+
+	data, err := json.Marshal(v)
+	if err == nil {
+		c.localSet(id, data)
+		err = c.rdb.Set(ctx, c.key(id), data, c.ttl).Err()
+	}
+	if err != nil {
+		log.Printf("⚠️ Cache set %s failed: %v", c.key(id), err)
+	}
+}
+
+// Stamp возвращает метку записи id для SetIfUnchanged; брать её нужно до
+// чтения из базы. ok = false — Redis недоступен, класть запись не надо.
+func (c *Cache) Stamp(ctx context.Context, id string) (stamp string, ok bool) {
+	if c == nil {
+		return "", false
+	}
+	stamp, err := c.rdb.Get(ctx, c.stampKey(id)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", true
+	}
+	if err != nil {
+		log.Printf("⚠️ Cache stamp %s failed: %v", c.key(id), err)
+		return "", false
+	}
+	return stamp, true
+}
+
+// SetIfUnchanged кладёт v, если запись не удаляли (Delete) с момента, когда
+// была взята метка stamp. Иначе v могла устареть, и она отбрасывается.
+func (c *Cache) SetIfUnchanged(ctx context.Context, id string, v interface{}, stamp string) {
+	if c == nil {
+		return
+	}
+
+	data, err := json.Marshal(v)
+	var stored int64
+	if err == nil {
+		stored, err = setIfUnchanged.Run(ctx, c.rdb, []string{c.key(id), c.stampKey(id)},
+			stamp, data, c.ttl.Milliseconds()).Int64()
+	}
+	if err != nil {
+		log.Printf("⚠️ Cache set %s failed: %v", c.key(id), err)
+		return
+	}
+	if stored == 1 {
+		c.localSet(id, data)
+	}
+}
+
+// Delete удаляет запись из Redis и из памяти этой реплики и оповещает
+// остальные реплики. Оповещение идёт после удаления из Redis: иначе
+// реплика, получившая его раньше, успела бы снова взять из Redis старую
+// запись себе в память. Метка записи меняется в той же транзакции Redis,
+// чтобы опоздавший SetIfUnchanged её не вернул.
+func (c *Cache) Delete(ctx context.Context, id string) {
+	if c == nil {
+		return
+	}
+
+	c.local.delete(id)
+	_, err := c.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Incr(ctx, c.stampKey(id))
+		p.PExpire(ctx, c.stampKey(id), c.stampTTL())
+		p.Del(ctx, c.key(id))
+		return nil
+	})
+	if err != nil {
+		log.Printf("⚠️ Cache delete %s failed: %v", c.key(id), err)
+	}
+	c.inv.publish(ctx, c.name, id)
+}
+
+func (c *Cache) Close() error {
+	if c == nil {
+		return nil
+	}
+	return c.rdb.Close()
+}
@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+type record struct {
+	Name string `json:"name"`
+}
+
+// replicas — два кэша на одном Redis, как у двух реплик сервиса.
+func replicas(t *testing.T) (a, b *Cache) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	t.Setenv("REDIS_URL", "redis://"+mr.Addr())
+	var err error
+	if a, err = FromEnv("orders"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = FromEnv("orders"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close(); b.Close() })
+	return a, b
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func get(c *Cache, id string) string {
+	var r record
+	if !c.Get(context.Background(), id, &r) {
+		return ""
+	}
+	return r.Name
+}
+
+// TestInvalidationPropagates — запись, изменённая на реплике A, сразу
+// перестаёт отдаваться из памяти реплики B.
+func TestInvalidationPropagates(t *testing.T) {
+	t.Setenv("CACHE_LOCAL_TTL", "1m")
+	a, b := replicas(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, c := range []*Cache{a, b} {
+		if err := c.Listen(ctx, nil, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "subscriptions", func() bool { return a.inv.active.Load() && b.inv.active.Load() })
+
+	a.Set(ctx, "1", record{Name: "old"})
+	if got := get(b, "1"); got != "old" {
+		t.Fatalf("replica B read %q, want old", got)
+	}
+	if _, ok := b.local.get("1"); !ok {
+		t.Fatal("replica B did not keep the record in memory")
+	}
+
+	// Запись на A: удаление с оповещением и новое значение в Redis.
+	a.Delete(ctx, "1")
+	a.Set(ctx, "1", record{Name: "new"})
+	waitFor(t, "eviction on replica B", func() bool {
+		_, ok := b.local.get("1")
+		return !ok
+	})
+	if got := get(b, "1"); got != "new" {
+		t.Errorf("replica B read %q after invalidation, want new", got)
+	}
+}
+
+// deafBus подписан, но не доставляет ни одного сообщения.
+type deafBus struct{}
+
+func (deafBus) Publish(context.Context, Invalidation) error { return nil }
+
+func (deafBus) Run(ctx context.Context, _ func(Invalidation), connected func(bool)) {
+	connected(true)
+	<-ctx.Done()
+}
+
+// TestLostInvalidationBoundedByTTL — без сообщения реплика отдаёт
+// устаревшую запись не дольше CACHE_LOCAL_TTL.
+func TestLostInvalidationBoundedByTTL(t *testing.T) {
+	t.Setenv("CACHE_LOCAL_TTL", "100ms")
+	a, b := replicas(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b.UseBus(ctx, deafBus{})
+	waitFor(t, "subscription", b.inv.active.Load)
+
+	a.Set(ctx, "1", record{Name: "old"})
+	if got := get(b, "1"); got != "old" {
+		t.Fatalf("replica B read %q, want old", got)
+	}
+	a.Set(ctx, "1", record{Name: "new"})
+	if got := get(b, "1"); got != "old" {
+		t.Fatalf("replica B read %q before TTL, want stale old from memory", got)
+	}
+	waitFor(t, "local TTL", func() bool { return get(b, "1") == "new" })
+}
+
+// TestLateSetAfterDeleteIsDropped — чтение из базы, начатое до изменения,
+// не возвращает в кэш старую версию после Delete.
+func TestLateSetAfterDeleteIsDropped(t *testing.T) {
+	a, b := replicas(t)
+	ctx := context.Background()
+
+	stamp, ok := a.Stamp(ctx, "1")
+	if !ok {
+		t.Fatal("stamp unavailable")
+	}
+	b.Delete(ctx, "1")
+	a.SetIfUnchanged(ctx, "1", record{Name: "stale"}, stamp)
+	if got := get(b, "1"); got != "" {
+		t.Fatalf("read %q after a late set, want miss", got)
+	}
+
+	if stamp, ok = a.Stamp(ctx, "1"); !ok {
+		t.Fatal("stamp unavailable")
+	}
+	a.SetIfUnchanged(ctx, "1", record{Name: "fresh"}, stamp)
+	if got := get(b, "1"); got != "fresh" {
+		t.Fatalf("read %q, want fresh", got)
+	}
+}
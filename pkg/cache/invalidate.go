@@ -0,0 +1,358 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+)
+
+// Инвалидация между репликами. Пока Listen не вызван, кэш — только Redis,
+// общий для всех реплик, и оповещать некого. Listen включает кэш в памяти
+// реплики и подписку на канал инвалидаций: Delete на любой реплике
+// публикует имя кэша и id, и каждая реплика удаляет запись из памяти.
+//
+// CACHE_INVALIDATION выбирает канал: redis (по умолчанию, pub/sub в том же
+// Redis), postgres (LISTEN/NOTIFY) или off (кэша в памяти нет).
+// CACHE_LOCAL_TTL (по умолчанию 5s, не больше CACHE_TTL) ограничивает,
+// сколько реплика отдаёт запись из памяти: потерянное сообщение оставляет
+// устаревшую запись не дольше этого. Пока канал недоступен, кэш в памяти
+// выключен; после переподключения он начинает с нуля.
+
+// invalidationChannel — канал Redis и Postgres.
+const invalidationChannel = "cache_invalidation"
+
+// localMaxEntries — предел записей в памяти на один кэш; при переполнении
+// кэш в памяти сбрасывается.
+const localMaxEntries = 10000
+
+// Переподключение к каналу: пауза растёт от min до max.
+const (
+	minReconnect = time.Second
+	maxReconnect = 30 * time.Second
+)
+
+var invalidations = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "cache_invalidations_total",
+	Help: "Cross-replica cache invalidations: sent, received.",
+}, []string{"cache", "direction"})
+
+var invalidationConnected = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "cache_invalidation_connected",
+	Help: "Whether the replica is subscribed to the cache invalidation channel.",
+})
+
+// Invalidation — сообщение «запись изменилась»: имя кэша (тип ресурса) и
+// id. Origin — реплика-отправитель: у себя она уже удалила запись.
+type Invalidation struct {
+	Cache  string `json:"cache"`
+	ID     string `json:"id"`
+	Origin string `json:"origin"`
+}
+
+// Bus — канал инвалидаций между репликами.
+type Bus interface {
+	Publish(ctx context.Context, msg Invalidation) error
+	// Run принимает сообщения до отмены ctx и передаёт их в handle. При
+	// разрыве переподключается с паузой; connected сообщает о подписке и
+	// её потере.
+	Run(ctx context.Context, handle func(Invalidation), connected func(bool))
+}
+
+// invalidation — общее для кэша и его Sub: канал и кэши по именам.
+type invalidation struct {
+	mode     string
+	localTTL time.Duration
+	origin   string
+	active   atomic.Bool
+
+	mu     sync.RWMutex
+	bus    Bus
+	caches map[string]*Cache
+}
+
+func invalidationFromEnv() *invalidation {
+	inv := &invalidation{mode: "redis", localTTL: 5 * time.Second, caches: map[string]*Cache{}}
+	if v := os.Getenv("CACHE_INVALIDATION"); v != "" {
+		inv.mode = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("CACHE_LOCAL_TTL")); err == nil && v >= 0 {
+		inv.localTTL = v
+	}
+	var b [8]byte
+	rand.Read(b[:])
+	inv.origin = hex.EncodeToString(b[:])
+	return inv
+}
+
+func (inv *invalidation) register(c *Cache) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.caches[c.name] = c
+}
+
+func (inv *invalidation) publish(ctx context.Context, name, id string) {
+	inv.mu.RLock()
+	bus := inv.bus
+	inv.mu.RUnlock()
+	if bus == nil {
+		return
+	}
+	if err := bus.Publish(ctx, Invalidation{Cache: name, ID: id, Origin: inv.origin}); err != nil {
+		log.Printf("⚠️ Cache invalidation %s:%s failed: %v", name, id, err)
+		return
+	}
+	invalidations.WithLabelValues(name, "sent").Inc()
+}
+
+func (inv *invalidation) handle(msg Invalidation) {
+	if msg.Origin == inv.origin {
+		return
+	}
+	inv.mu.RLock()
+	c := inv.caches[msg.Cache]
+	inv.mu.RUnlock()
+	if c == nil {
+		return
+	}
+	c.local.delete(msg.ID)
+	invalidations.WithLabelValues(msg.Cache, "received").Inc()
+}
+
+// connected включает кэш в памяти, пока есть подписка. И при подписке, и
+// при её потере память сбрасывается: сообщения за время разрыва потеряны.
+func (inv *invalidation) connected(ok bool) {
+	inv.active.Store(ok)
+	inv.mu.RLock()
+	for _, c := range inv.caches {
+		c.local.clear()
+	}
+	inv.mu.RUnlock()
+	if ok {
+		invalidationConnected.Set(1)
+	} else {
+		invalidationConnected.Set(0)
+	}
+}
+
+// Listen включает кэш в памяти и подписывается на инвалидации по
+// CACHE_INVALIDATION до отмены ctx. Для postgres нужны db (NOTIFY) и
+// databaseURL (отдельное соединение для LISTEN). Вызывается один раз для
+// кэша из FromEnv; его Sub подключаются вместе с ним.
+func (c *Cache) Listen(ctx context.Context, db *sql.DB, databaseURL string) error {
+	if c == nil {
+		return nil
+	}
+	switch c.inv.mode {
+	case "off":
+		return nil
+	case "redis":
+		c.UseBus(ctx, &redisBus{rdb: c.rdb})
+	case "postgres":
+		c.UseBus(ctx, &pgBus{db: db, databaseURL: databaseURL})
+	default:
+		return fmt.Errorf("CACHE_INVALIDATION: unknown mode %q: expected redis, postgres or off", c.inv.mode)
+	}
+	log.Printf("🔁 Cache invalidation via %s", c.inv.mode)
+	return nil
+}
+
+// UseBus — Listen с заданным каналом.
+func (c *Cache) UseBus(ctx context.Context, bus Bus) {
+	c.inv.mu.Lock()
+	c.inv.bus = bus
+	c.inv.mu.Unlock()
+	go bus.Run(ctx, c.inv.handle, c.inv.connected)
+}
+
+func (c *Cache) localTTL() time.Duration {
+	return min(c.inv.localTTL, c.ttl)
+}
+
+func (c *Cache) localGet(id string) ([]byte, bool) {
+	if !c.inv.active.Load() {
+		return nil, false
+	}
+	return c.local.get(id)
+}
+
+func (c *Cache) localSet(id string, data []byte) {
+	if c.inv.active.Load() {
+		c.local.set(id, data)
+	}
+}
+
+// localStore — записи кэша в памяти реплики с TTL.
+type localStore struct {
+	ttl time.Duration
+
+	mu    sync.Mutex
+	items map[string]localItem
+}
+
+type localItem struct {
+	data    []byte
+	expires time.Time
+}
+
+func newLocalStore(ttl time.Duration) *localStore {
+	return &localStore{ttl: ttl, items: map[string]localItem{}}
+}
+
+func (s *localStore) get(id string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it, ok := s.items[id]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(it.expires) {
+		delete(s.items, id)
+		return nil, false
+	}
+	return it.data, true
+}
+
+func (s *localStore) set(id string, data []byte) {
+	if s.ttl <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.items) >= localMaxEntries {
+		clear(s.items)
+	}
+	s.items[id] = localItem{data: data, expires: time.Now().Add(s.ttl)}
+}
+
+func (s *localStore) delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, id)
+}
+
+func (s *localStore) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.items)
+}
+
+// wait — пауза перед переподключением; false — ctx отменён.
+func wait(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// redisBus — pub/sub в Redis кэша.
+type redisBus struct {
+	rdb *redis.Client
+}
+
+func (b *redisBus) Publish(ctx context.Context, msg Invalidation) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return b.rdb.Publish(ctx, invalidationChannel, payload).Err()
+}
+
+func (b *redisBus) Run(ctx context.Context, handle func(Invalidation), connected func(bool)) {
+	for backoff := minReconnect; ; backoff = min(backoff*2, maxReconnect) {
+		ps := b.rdb.Subscribe(ctx, invalidationChannel)
+		// Первый ответ — подтверждение подписки.
+		if _, err := ps.Receive(ctx); err == nil {
+			backoff = minReconnect
+			connected(true)
+			for {
+				m, err := ps.ReceiveMessage(ctx)
+				if err != nil {
+					if ctx.Err() == nil {
+						log.Printf("⚠️ Cache invalidation channel: %v", err)
+					}
+					break
+				}
+				var msg Invalidation
+				if err := json.Unmarshal([]byte(m.Payload), &msg); err != nil {
+					log.Printf("⚠️ Bad cache invalidation: %v", err)
+					continue
+				}
+				handle(msg)
+			}
+			connected(false)
+		} else if ctx.Err() == nil {
+			log.Printf("⚠️ Cache invalidation subscribe failed: %v", err)
+		}
+		ps.Close()
+		if !wait(ctx, backoff) {
+			return
+		}
+	}
+}
+
+// pgBus — LISTEN/NOTIFY в Postgres сервиса.
+type pgBus struct {
+	db          *sql.DB
+	databaseURL string
+}
+
+func (b *pgBus) Publish(ctx context.Context, msg Invalidation) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = b.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", invalidationChannel, string(payload))
+	return err
+}
+
+func (b *pgBus) Run(ctx context.Context, handle func(Invalidation), connected func(bool)) {
+	for backoff := minReconnect; ; backoff = min(backoff*2, maxReconnect) {
+		conn, err := pgx.Connect(ctx, b.databaseURL)
+		if err == nil {
+			if _, err = conn.Exec(ctx, "LISTEN "+invalidationChannel); err != nil {
+				conn.Close(context.Background())
+			}
+		}
+		if err == nil {
+			backoff = minReconnect
+			connected(true)
+			for {
+				n, err := conn.WaitForNotification(ctx)
+				if err != nil {
+					if ctx.Err() == nil {
+						log.Printf("⚠️ Cache invalidation channel: %v", err)
+					}
+					break
+				}
+				var msg Invalidation
+				if err := json.Unmarshal([]byte(n.Payload), &msg); err != nil {
+					log.Printf("⚠️ Bad cache invalidation: %v", err)
+					continue
+				}
+				handle(msg)
+			}
+			connected(false)
+			conn.Close(context.Background())
+		} else if ctx.Err() == nil {
+			log.Printf("⚠️ Cache invalidation listen failed: %v", err)
+		}
+		if !wait(ctx, backoff) {
+			return
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Package chaos — внесение отказов в реплику для проверки балансировки и
+// устойчивости: неготовность (/ready отдаёт 503), задержка и обрыв части
+// ответов. Любой эксперимент ограничен по времени и снимается сам.
+package chaos
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"pkg/apierr"
+)
+
+var active = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "chaos_fault_active",
+	Help: "Whether a fault is currently injected: unready, latency, drop.",
+}, []string{"fault"})
+
+var expiresAt = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "chaos_expires_timestamp_seconds",
+	Help: "Unix time when the current chaos experiment expires, 0 if none.",
+})
+
+var injected = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "chaos_injected_total",
+	Help: "Requests affected by injected faults: latency, drop.",
+}, []string{"fault"})
+
+// Config — параметры эксперимента. Проценты — доля запросов (0–100).
+type Config struct {
+	Unready        bool      `json:"unready"`
+	LatencyMS      int       `json:"latency_ms"`
+	LatencyPercent int       `json:"latency_percent"`
+	DropPercent    int       `json:"drop_percent"`
+	Duration       string    `json:"duration,omitempty" example:"5m"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+func (c Config) validate(maxDuration time.Duration) (time.Duration, error) {
+	d, err := time.ParseDuration(c.Duration)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("duration is required, e.g. \"5m\"")
+	}
+	if d > maxDuration {
+		return 0, fmt.Errorf("duration must not exceed %s", maxDuration)
+	}
+	if c.LatencyPercent < 0 || c.LatencyPercent > 100 || c.DropPercent < 0 || c.DropPercent > 100 {
+		return 0, fmt.Errorf("percentages must be within 0-100")
+	}
+	if c.LatencyMS < 0 || (c.LatencyPercent > 0 && c.LatencyMS == 0) {
+		return 0, fmt.Errorf("latency_ms must be positive when latency_percent is set")
+	}
+	return d, nil
+}
+
+// Injector хранит текущий эксперимент. Nil-эксперимент — обычная работа.
+type Injector struct {
+	maxDuration time.Duration
+
+	mu    sync.Mutex
+	cfg   *Config
+	timer *time.Timer
+}
+
+// FromEnv создаёт Injector; CHAOS_MAX_DURATION ограничивает длительность
+// одного эксперимента (по умолчанию 1h).
+func FromEnv() *Injector {
+	in := &Injector{maxDuration: time.Hour}
+	if v, err := time.ParseDuration(os.Getenv("CHAOS_MAX_DURATION")); err == nil && v > 0 {
+		in.maxDuration = v
+	}
+	in.publish(nil)
+	return in
+}
+
+// Active возвращает текущий эксперимент или nil.
+func (in *Injector) Active() *Config {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.cfg == nil {
+		return nil
+	}
+	c := *in.cfg
+	return &c
+}
+
+func (in *Injector) set(c *Config, d time.Duration) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.timer != nil {
+		in.timer.Stop()
+		in.timer = nil
+	}
+	in.cfg = c
+	if c != nil {
+		in.timer = time.AfterFunc(d, func() { in.expire(c) })
+	}
+	in.publish(c)
+}
+
+// expire снимает эксперимент c, если его ещё не заменили другим.
+func (in *Injector) expire(c *Config) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.cfg != c {
+		return
+	}
+	in.cfg = nil
+	in.timer = nil
+	in.publish(nil)
+	log.Printf("🐒 Chaos experiment expired")
+}
+
+func (in *Injector) publish(c *Config) {
+	var unready, latency, drop float64
+	var exp float64
+	if c != nil {
+		if c.Unready {
+			unready = 1
+		}
+		if c.LatencyPercent > 0 {
+			latency = 1
+		}
+		if c.DropPercent > 0 {
+			drop = 1
+		}
+		exp = float64(c.ExpiresAt.Unix())
+	}
+	active.WithLabelValues("unready").Set(unready)
+	active.WithLabelValues("latency").Set(latency)
+	active.WithLabelValues("drop").Set(drop)
+	expiresAt.Set(exp)
+}
+
+// Ready — false, пока действует эксперимент с unready.
+func (in *Injector) Ready() bool {
+	c := in.Active()
+	return c == nil || !c.Unready
+}
+
+// exempt — служебные маршруты не задерживаются и не обрываются, иначе
+// эксперимент нельзя будет ни наблюдать, ни отменить.
+func exempt(path string) bool {
+	return path == "/health" || path == "/ready" || path == "/health/ready" || path == "/metrics" || strings.HasPrefix(path, "/admin/")
+}
+
+// Middleware задерживает и обрывает заданную долю запросов. Подключается
+// через router.Use.
+func (in *Injector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := in.Active()
+		if c == nil || exempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if c.DropPercent > 0 && rand.Intn(100) < c.DropPercent {
+			if hj, ok := w.(http.Hijacker); ok {
+				if conn, _, err := hj.Hijack(); err == nil {
+					injected.WithLabelValues("drop").Inc()
+					conn.Close()
+					return
+				}
+			}
+		}
+		if c.LatencyPercent > 0 && rand.Intn(100) < c.LatencyPercent {
+			injected.WithLabelValues("latency").Inc()
+			select {
+			case <-time.After(time.Duration(c.LatencyMS) * time.Millisecond):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Handler — POST /admin/chaos запускает эксперимент (заменяя текущий),
+// DELETE /admin/chaos снимает его досрочно. Маршрут подключается через
+// admin.RequireKey.
+func (in *Injector) Handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		in.set(nil, 0)
+		log.Printf("🐒 Chaos experiment cancelled")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var c Config
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	d, err := c.validate(in.maxDuration)
+	if err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	c.ExpiresAt = time.Now().Add(d).UTC()
+	in.set(&c, d)
+	log.Printf("🐒 Chaos experiment started until %s: unready=%t latency=%dms@%d%% drop=%d%%",
+		c.ExpiresAt.Format(time.RFC3339), c.Unready, c.LatencyMS, c.LatencyPercent, c.DropPercent)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
@@ -0,0 +1,179 @@
+// Package clients — типизированные клиенты users-, orders-, payments- и
+// delivery-service. Запросы идут через общий httpclient.Client (повторы,
+// circuit breaker, mTLS, подпись HMAC, X-Request-ID входящего запроса),
+// а тела запросов и ответов — те же структуры, что сервисы используют в
+// обработчиках (type Order = clients.Order), поэтому контракт клиента и
+// сервиса не расходится.
+//
+// Ответ вне 2xx возвращается как *Error с кодом и текстом из тела apierr;
+// недоступность сервиса (сеть, 5xx, открытый breaker) — как
+// httpclient.ErrDependencyUnavailable.
+package clients
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"pkg/admin"
+	"pkg/apierr"
+	"pkg/httpclient"
+)
+
+// Error — ответ сервиса вне 2xx.
+type Error struct {
+	Method  string
+	URL     string
+	Status  int
+	Code    apierr.Code // пусто, если тело не в формате apierr
+	Message string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s %s: status %d", e.Method, e.URL, e.Status)
+	if e.Code != "" {
+		msg += " " + string(e.Code)
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// StatusOf — HTTP-статус ошибки сервиса; 0, если err не *Error.
+func StatusOf(err error) int {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Status
+	}
+	return 0
+}
+
+// IsNotFound — сервис ответил 404.
+func IsNotFound(err error) bool {
+	return StatusOf(err) == http.StatusNotFound
+}
+
+// Option настраивает клиент.
+type Option func(*client)
+
+// WithAPIKey добавляет X-Internal-API-Key ко всем запросам — для
+// маршрутов под admin.RequireKey и расширенных прав (admin.HasKey).
+func WithAPIKey(key string) Option {
+	return func(c *client) { c.apiKey = key }
+}
+
+// WithToken добавляет Authorization: Bearer с токеном, который token
+// возвращает для контекста запроса; пустая строка — без заголовка.
+func WithToken(token func(ctx context.Context) string) Option {
+	return func(c *client) { c.token = token }
+}
+
+// client — общая часть типизированных клиентов: сервис (имя breaker в
+// httpclient) и его базовый URL.
+type client struct {
+	http    *httpclient.Client
+	target  string
+	baseURL string
+	apiKey  string
+	token   func(ctx context.Context) string
+}
+
+func newClient(hc *httpclient.Client, target, baseURL string, opts []Option) client {
+	c := client{http: hc, target: target, baseURL: strings.TrimRight(baseURL, "/")}
+	for _, o := range opts {
+		o(&c)
+	}
+	return c
+}
+
+// URL — полный адрес пути сервиса.
+func (c *client) URL(path string) string {
+	return c.baseURL + path
+}
+
+// do отправляет in как JSON и декодирует ответ 2xx в out. Запрос с
+// idempotencyKey httpclient повторяет так же, как GET.
+func (c *client) do(ctx context.Context, method, path string, query url.Values, idempotencyKey string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	u := c.URL(path)
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	if c.apiKey != "" {
+		req.Header.Set(admin.APIKeyHeader, c.apiKey)
+	}
+	if c.token != nil {
+		if t := c.token(ctx); t != "" {
+			req.Header.Set("Authorization", "Bearer "+t)
+		}
+	}
+
+	resp, err := c.http.Do(c.target, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return responseError(req, resp)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func responseError(req *http.Request, resp *http.Response) *Error {
+	e := &Error{Method: req.Method, URL: req.URL.String(), Status: resp.StatusCode}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var body struct {
+		Code  apierr.Code `json:"code"`
+		Error string      `json:"error"`
+	}
+	if json.Unmarshal(data, &body) == nil && body.Code != "" {
+		e.Code, e.Message = body.Code, body.Error
+	} else {
+		e.Message = strings.TrimSpace(string(data))
+	}
+	return e
+}
+
+// setStatus переводит ресурс path из статуса from в to через GET + PUT:
+// PUT сервисов принимает ресурс целиком. Ресурс в другом статусе не
+// трогается; false — перевода не было.
+func setStatus[T any](ctx context.Context, c *client, path string, status func(*T) *string, from, to, idempotencyKey string) (bool, error) {
+	var res T
+	if err := c.do(ctx, http.MethodGet, path, nil, "", nil, &res); err != nil {
+		return false, err
+	}
+	if *status(&res) != from {
+		return false, nil
+	}
+	*status(&res) = to
+	return true, c.do(ctx, http.MethodPut, path, nil, idempotencyKey, res, nil)
+}
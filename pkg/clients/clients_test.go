@@ -0,0 +1,216 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pkg/admin"
+	"pkg/apierr"
+	"pkg/httpclient"
+	"pkg/observe"
+)
+
+func testHTTP() *httpclient.Client {
+	return httpclient.New(httpclient.Config{
+		Timeout: time.Second,
+		Breaker: httpclient.BreakerConfig{FailureThreshold: 100, OpenDuration: time.Second, HalfOpenProbes: 1},
+		Retry:   httpclient.RetryConfig{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestGetDecodesSharedContract(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/orders/7" {
+			t.Errorf("got %s %s", r.Method, r.URL.Path)
+		}
+		writeJSON(w, http.StatusOK, Order{ID: 7, UserID: 3, TotalAmount: 99.5, Currency: "RUB", Status: "pending", Tags: []string{"gift"}})
+	}))
+	defer srv.Close()
+
+	o, err := NewOrders(testHTTP(), srv.URL+"/").Get(context.Background(), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.ID != 7 || o.UserID != 3 || o.TotalAmount != 99.5 || len(o.Tags) != 1 {
+		t.Errorf("decoded %+v", o)
+	}
+}
+
+func TestErrorCarriesAPICode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apierr.Write(w, apierr.UserNotFound, "User not found")
+	}))
+	defer srv.Close()
+
+	_, err := NewUsers(testHTTP(), srv.URL).Get(context.Background(), 1)
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("err = %v, want *Error", err)
+	}
+	if !IsNotFound(err) || e.Code != apierr.UserNotFound || e.Message != "User not found" {
+		t.Errorf("err = %+v", e)
+	}
+	if errors.Is(err, httpclient.ErrDependencyUnavailable) {
+		t.Error("404 reported as dependency failure")
+	}
+}
+
+func TestUnavailableServiceIsDependencyError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	_, err := NewPayments(testHTTP(), url).Get(context.Background(), 1)
+	if !errors.Is(err, httpclient.ErrDependencyUnavailable) {
+		t.Errorf("err = %v, want ErrDependencyUnavailable", err)
+	}
+}
+
+func TestCredentialsAndRequestID(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get(admin.APIKeyHeader); got != "secret" {
+			t.Errorf("%s = %q", admin.APIKeyHeader, got)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer tok-42" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if got := r.Header.Get(observe.RequestIDHeader); got != "req-1" {
+			t.Errorf("%s = %q, want the incoming request id", observe.RequestIDHeader, got)
+		}
+		writeJSON(w, http.StatusOK, User{ID: 5})
+	}))
+	defer backend.Close()
+
+	users := NewUsers(testHTTP(), backend.URL,
+		WithAPIKey("secret"),
+		WithToken(func(context.Context) string { return "tok-42" }))
+	// Входящий запрос сервиса: id запроса в контексте ставит observe.
+	front := observe.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := users.Get(r.Context(), 5); err != nil {
+			t.Error(err)
+		}
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/users/5", nil)
+	req.Header.Set(observe.RequestIDHeader, "req-1")
+	front.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestCreateWithIdempotencyKeyIsRetried(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Idempotency-Key") != "saga-1:payment" {
+			t.Errorf("Idempotency-Key = %q", r.Header.Get("Idempotency-Key"))
+		}
+		var p Payment
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil || p.OrderID != 9 {
+			t.Errorf("body %+v, err %v", p, err)
+		}
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		p.ID = 100
+		writeJSON(w, http.StatusOK, p)
+	}))
+	defer srv.Close()
+
+	p, err := NewPayments(testHTTP(), srv.URL).Create(context.Background(),
+		Payment{OrderID: 9, Amount: 10, Status: "completed", PaymentMethod: "card"}, "saga-1:payment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != 100 || calls.Load() != 2 {
+		t.Errorf("payment %d after %d calls, want 100 after 2", p.ID, calls.Load())
+	}
+}
+
+func TestSetStatusOnlyFromExpected(t *testing.T) {
+	for _, tc := range []struct {
+		current string
+		changed bool
+	}{
+		{"pending", true},
+		{"delivered", false},
+	} {
+		var put *Delivery
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				writeJSON(w, http.StatusOK, Delivery{ID: 4, OrderID: 1, Address: "ул. Ленина, 1", Status: tc.current})
+			case http.MethodPut:
+				put = &Delivery{}
+				json.NewDecoder(r.Body).Decode(put)
+				writeJSON(w, http.StatusOK, put)
+			}
+		}))
+
+		changed, err := NewDeliveries(testHTTP(), srv.URL).SetStatus(context.Background(), 4, "pending", "failed", "k")
+		srv.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != tc.changed || (put != nil) != tc.changed {
+			t.Errorf("from %s: changed=%v, PUT sent=%v", tc.current, changed, put != nil)
+		}
+		if put != nil && (put.Status != "failed" || put.Address != "ул. Ленина, 1") {
+			t.Errorf("PUT body %+v, want the whole delivery with status failed", put)
+		}
+	}
+}
+
+func TestPreferenceCache(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path != "/users/5/notification-preferences" {
+			t.Errorf("got %s", r.URL.Path)
+		}
+		// Старый users-service не знает о sms_delivery_updates.
+		writeJSON(w, http.StatusOK, map[string]bool{"email_order_updates": false})
+	}))
+	defer srv.Close()
+
+	prefs := NewPreferenceCache(NewUsers(testHTTP(), srv.URL), time.Minute)
+	for range 3 {
+		p, err := prefs.Get(context.Background(), 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.EmailOrderUpdates || p.OrderStatus("shipped") || !p.SMSDeliveryUpdates || p.Marketing {
+			t.Errorf("decoded %+v", p)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("users-service called %d times, want 1", n)
+	}
+}
+
+func TestOrdersExisting(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("ids"); got != "3,5,8" {
+			t.Errorf("ids = %q", got)
+		}
+		writeJSON(w, http.StatusOK, []Order{{ID: 3}, {ID: 8}})
+	}))
+	defer srv.Close()
+
+	found, err := NewOrders(testHTTP(), srv.URL).Existing(context.Background(), []int{3, 5, 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found[3] || found[5] || !found[8] {
+		t.Errorf("found = %v", found)
+	}
+}
@@ -0,0 +1,133 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"pkg/httpclient"
+)
+
+// Delivery — доставка delivery-service.
+type Delivery struct {
+	ID                int        `json:"id"`
+	OrderID           int        `json:"order_id" validate:"required"`
+	Address           string     `json:"address" validate:"min=10,max=500"`
+	Status            string     `json:"status" validate:"required,oneof=pending in_transit ready_for_pickup delivered failed"`
+	CourierID         *int       `json:"courier_id"`
+	EstimatedDelivery *string    `json:"estimated_delivery"`
+	ZoneID            *int       `json:"zone_id"`
+	WindowStart       *time.Time `json:"window_start"`
+	WindowEnd         *time.Time `json:"window_end"`
+	Lat               *float64   `json:"lat"`
+	Lon               *float64   `json:"lon"`
+	Fee               float64    `json:"fee"`
+	LabelCode         *string    `json:"label_code"`
+	DeliveredAt       *time.Time `json:"delivered_at"`
+	Packages          []Package  `json:"packages,omitempty"`
+	Warnings          []string   `json:"warnings,omitempty"`
+	// AgeRestricted — доставка заказа с товарами 18+; завершить её можно
+	// только с RecipientAgeVerified.
+	AgeRestricted        bool `json:"age_restricted"`
+	RecipientAgeVerified bool `json:"recipient_age_verified"`
+	// PickupPointID — доставка в пункт выдачи вместо address; PickupCode
+	// покупатель называет при получении.
+	PickupPointID *int    `json:"pickup_point_id"`
+	PickupCode    *string `json:"pickup_code"`
+	// GiftMessage — поздравление из заказа-подарка (событие order.confirmed),
+	// печатается на этикетке; через API доставок не задаётся.
+	GiftMessage *string `json:"gift_message"`
+	// Simulated — демо-доставка: статусы, события и координаты курьера
+	// генерирует симуляция delivery-service. Задаётся при создании.
+	Simulated bool   `json:"simulated"`
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+// Package — посылка внутри доставки. ConfirmedAt выставляется при
+// сканировании штрихкода курьером у получателя.
+type Package struct {
+	ID          int        `json:"id"`
+	DeliveryID  int        `json:"delivery_id"`
+	Barcode     string     `json:"barcode"`
+	WeightKg    float64    `json:"weight_kg"`
+	LengthCm    float64    `json:"length_cm"`
+	WidthCm     float64    `json:"width_cm"`
+	HeightCm    float64    `json:"height_cm"`
+	ConfirmedAt *time.Time `json:"confirmed_at"`
+	CreatedAt   string     `json:"createdAt"`
+}
+
+// DeliveryStats — доставки, завершённые и не удавшиеся за период, и
+// самые частые причины неудачи (описание события delivery.failed).
+type DeliveryStats struct {
+	Delivered      int           `json:"delivered"`
+	Failed         int           `json:"failed"`
+	FailureReasons []ReasonCount `json:"failure_reasons"`
+}
+
+// Deliveries — клиент delivery-service.
+type Deliveries struct {
+	client
+}
+
+// NewDeliveries создаёт клиент delivery-service с базовым URL baseURL
+// (например, DELIVERY_SERVICE_URL).
+func NewDeliveries(hc *httpclient.Client, baseURL string, opts ...Option) *Deliveries {
+	return &Deliveries{newClient(hc, "delivery-service", baseURL, opts)}
+}
+
+func (c *Deliveries) Get(ctx context.Context, id int) (*Delivery, error) {
+	var d Delivery
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/deliveries/%d", id), nil, "", nil, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// List — GET /deliveries; query — фильтры (order_id, status, courier_id,
+// zone_id, from, to).
+func (c *Deliveries) List(ctx context.Context, query url.Values) ([]Delivery, error) {
+	var deliveries []Delivery
+	err := c.do(ctx, http.MethodGet, "/deliveries", query, "", nil, &deliveries)
+	return deliveries, err
+}
+
+// Create создаёт доставку. Повтор с тем же idempotencyKey возвращает ту
+// же доставку.
+func (c *Deliveries) Create(ctx context.Context, d Delivery, idempotencyKey string) (*Delivery, error) {
+	var out Delivery
+	if err := c.do(ctx, http.MethodPost, "/deliveries", nil, idempotencyKey, d, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Deliveries) Update(ctx context.Context, id int, d Delivery, idempotencyKey string) (*Delivery, error) {
+	var out Delivery
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/deliveries/%d", id), nil, idempotencyKey, d, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Deliveries) Delete(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/deliveries/%d", id), nil, "", nil, nil)
+}
+
+// SetStatus переводит доставку из статуса from в to (например, pending →
+// failed); в другом статусе доставка не меняется и возвращается false.
+func (c *Deliveries) SetStatus(ctx context.Context, id int, from, to, idempotencyKey string) (bool, error) {
+	return setStatus(ctx, &c.client, fmt.Sprintf("/deliveries/%d", id), func(d *Delivery) *string { return &d.Status }, from, to, idempotencyKey)
+}
+
+// Stats — GET /deliveries/stats за дни from–to (YYYY-MM-DD) включительно.
+func (c *Deliveries) Stats(ctx context.Context, from, to string) (*DeliveryStats, error) {
+	var out DeliveryStats
+	if err := c.do(ctx, http.MethodGet, "/deliveries/stats", url.Values{"from": {from}, "to": {to}}, "", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
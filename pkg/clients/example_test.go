@@ -0,0 +1,64 @@
+package clients_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"pkg/clients"
+	"pkg/httpclient"
+)
+
+// Клиент строится поверх общего httpclient.Client сервиса: повторы,
+// breaker и mTLS настраиваются там же, где для остальных вызовов.
+func ExampleNewOrders() {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(clients.Order{ID: 42, Status: "confirmed", TotalAmount: 1500, Currency: "RUB"})
+	}))
+	defer srv.Close()
+
+	services := httpclient.New(httpclient.ConfigFromEnv(), "orders-service")
+	orders := clients.NewOrders(services, srv.URL)
+
+	o, err := orders.Get(context.Background(), 42)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(o.ID, o.Status, o.TotalAmount, o.Currency)
+	// Output: 42 confirmed 1500 RUB
+}
+
+// Ответ вне 2xx — *clients.Error с кодом apierr.
+func ExampleIsNotFound() {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"code":"user_not_found","error":"User not found"}`)
+	}))
+	defer srv.Close()
+
+	users := clients.NewUsers(httpclient.New(httpclient.ConfigFromEnv()), srv.URL)
+	_, err := users.Get(context.Background(), 7)
+	fmt.Println(clients.IsNotFound(err))
+	// Output: true
+}
+
+// Компенсация саги: платёж возвращается, только если он ещё completed.
+func ExamplePayments_SetStatus() {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := clients.Payment{ID: 3, OrderID: 1, Amount: 10, Status: "completed", PaymentMethod: "cash"}
+		if r.Method == http.MethodPut {
+			json.NewDecoder(r.Body).Decode(&p)
+		}
+		json.NewEncoder(w).Encode(p)
+	}))
+	defer srv.Close()
+
+	payments := clients.NewPayments(httpclient.New(httpclient.ConfigFromEnv()), srv.URL)
+	refunded, err := payments.SetStatus(context.Background(), 3, "completed", "refunded", "saga-1:refund")
+	fmt.Println(refunded, err)
+	// Output: true <nil>
+}
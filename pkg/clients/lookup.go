@@ -0,0 +1,48 @@
+package clients
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// MaxLookupIDs — сколько id принимает один запрос ?ids= у orders-service и
+// users-service.
+const MaxLookupIDs = 100
+
+func idsQuery(ids []int) url.Values {
+	list := make([]string, len(ids))
+	for i, id := range ids {
+		list[i] = strconv.Itoa(id)
+	}
+	return url.Values{"ids": {strings.Join(list, ",")}}
+}
+
+// Existing возвращает те из ids (не больше MaxLookupIDs), для которых есть
+// заказ — рабочий или архивный; удалённые заказы не находятся.
+func (c *Orders) Existing(ctx context.Context, ids []int) (map[int]bool, error) {
+	orders, err := c.List(ctx, idsQuery(ids))
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[int]bool, len(orders))
+	for _, o := range orders {
+		found[o.ID] = true
+	}
+	return found, nil
+}
+
+// Existing возвращает те из ids (не больше MaxLookupIDs), для которых есть
+// пользователь, в том числе деактивированный.
+func (c *Users) Existing(ctx context.Context, ids []int) (map[int]bool, error) {
+	users, err := c.List(ctx, idsQuery(ids))
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[int]bool, len(users))
+	for _, u := range users {
+		found[u.ID] = true
+	}
+	return found, nil
+}
@@ -0,0 +1,136 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"pkg/httpclient"
+)
+
+// Order — заказ orders-service.
+type Order struct {
+	ID              int      `json:"id"`
+	UserID          int      `json:"user_id" validate:"required"`
+	TotalAmount     float64  `json:"total_amount" validate:"required,gt=0"`
+	Currency        string   `json:"currency"`
+	Status          string   `json:"status" validate:"required,oneof=scheduled pending confirmed shipped delivered cancelled"`
+	ShippingAddress string   `json:"shipping_address" validate:"max=500"`
+	Tags            []string `json:"tags"`
+	// AgeRestricted — в заказе товары 18+: задаётся при создании и дальше
+	// не меняется.
+	AgeRestricted bool `json:"age_restricted"`
+	// ScheduledFor — время исполнения отложенного заказа: до него заказ в
+	// статусе scheduled, затем переходит в pending.
+	ScheduledFor *time.Time `json:"scheduled_for"`
+	// IsGift — заказ-подарок: в событиях для delivery-service нет суммы, на
+	// этикетке печатается GiftMessage (до 200 символов). Оба поля задаются
+	// при создании и дальше не меняются.
+	IsGift      bool    `json:"is_gift"`
+	GiftMessage *string `json:"gift_message,omitempty"`
+	CreatedAt   string  `json:"createdAt"`
+	UpdatedAt   string  `json:"updatedAt"`
+}
+
+// PaymentCompleted — тело POST /orders/{id}/payment-completed.
+type PaymentCompleted struct {
+	PaymentID int `json:"payment_id"`
+}
+
+type CheckoutRequest struct {
+	UserID          int     `json:"user_id" validate:"required"`
+	TotalAmount     float64 `json:"total_amount" validate:"required,gt=0"`
+	Currency        string  `json:"currency"`
+	ShippingAddress string  `json:"shipping_address" validate:"required,max=500"`
+	PaymentMethod   string  `json:"payment_method" validate:"required,oneof=card cash paypal"`
+}
+
+type CheckoutResult struct {
+	SagaID        string   `json:"saga_id"`
+	Status        string   `json:"status"`
+	FailedStep    string   `json:"failed_step,omitempty"`
+	Error         string   `json:"error,omitempty"`
+	OrderID       int      `json:"order_id"`
+	PaymentID     *int     `json:"payment_id"`
+	DeliveryID    *int     `json:"delivery_id"`
+	Compensations []string `json:"compensations,omitempty"`
+}
+
+// Orders — клиент orders-service.
+type Orders struct {
+	client
+}
+
+// NewOrders создаёт клиент orders-service с базовым URL baseURL (например,
+// ORDERS_SERVICE_URL).
+func NewOrders(hc *httpclient.Client, baseURL string, opts ...Option) *Orders {
+	return &Orders{newClient(hc, "orders-service", baseURL, opts)}
+}
+
+func (c *Orders) Get(ctx context.Context, id int) (*Order, error) {
+	var o Order
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/orders/%d", id), nil, "", nil, &o); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// List — GET /orders; query — фильтры (tag, archived).
+func (c *Orders) List(ctx context.Context, query url.Values) ([]Order, error) {
+	var orders []Order
+	err := c.do(ctx, http.MethodGet, "/orders", query, "", nil, &orders)
+	return orders, err
+}
+
+func (c *Orders) Create(ctx context.Context, o Order, idempotencyKey string) (*Order, error) {
+	var out Order
+	if err := c.do(ctx, http.MethodPost, "/orders", nil, idempotencyKey, o, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Orders) Update(ctx context.Context, id int, o Order, idempotencyKey string) (*Order, error) {
+	var out Order
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/orders/%d", id), nil, idempotencyKey, o, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Orders) Delete(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/orders/%d", id), nil, "", nil, nil)
+}
+
+// SetStatus переводит заказ из статуса from в to (например, pending →
+// cancelled); в другом статусе заказ не меняется и возвращается false.
+func (c *Orders) SetStatus(ctx context.Context, id int, from, to, idempotencyKey string) (bool, error) {
+	return setStatus(ctx, &c.client, fmt.Sprintf("/orders/%d", id), func(o *Order) *string { return &o.Status }, from, to, idempotencyKey)
+}
+
+// Checkout запускает сагу оформления: заказ, платёж и доставка. Повтор с
+// тем же idempotencyKey возвращает ту же сагу.
+func (c *Orders) Checkout(ctx context.Context, req CheckoutRequest, idempotencyKey string) (*CheckoutResult, error) {
+	var out CheckoutResult
+	if err := c.do(ctx, http.MethodPost, "/orders/checkout", nil, idempotencyKey, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PaymentCompletedPath — путь уведомления о проведённом платеже.
+func PaymentCompletedPath(orderID int) string {
+	return fmt.Sprintf("/orders/%d/payment-completed", orderID)
+}
+
+// PaymentCompleted сообщает, что платёж по заказу проведён (внутренний
+// маршрут под mTLS). Повтор безопасен.
+func (c *Orders) PaymentCompleted(ctx context.Context, orderID int, ev PaymentCompleted, idempotencyKey string) (*Order, error) {
+	var out Order
+	if err := c.do(ctx, http.MethodPost, PaymentCompletedPath(orderID), nil, idempotencyKey, ev, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,205 @@
+package clients
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"pkg/httpclient"
+)
+
+// checkoutPaymentSuffix отличает Idempotency-Key платежей саги оформления.
+const checkoutPaymentSuffix = ":payment"
+
+// CheckoutPaymentKey — Idempotency-Key платежа саги оформления sagaID.
+func CheckoutPaymentKey(sagaID string) string { return sagaID + checkoutPaymentSuffix }
+
+// IsCheckoutPaymentKey сообщает, что платёж создан сагой оформления: заказ
+// она подтверждает сама, и уведомлять orders-service о нём не нужно.
+func IsCheckoutPaymentKey(key string) bool { return strings.HasSuffix(key, checkoutPaymentSuffix) }
+
+// Payment — платёж payments-service. Amount — авторизованная сумма,
+// CapturedAmount — списанная её часть; неиспользованный остаток авторизации
+// отменяется в AuthorizationExpiresAt.
+type Payment struct {
+	ID                     int            `json:"id"`
+	OrderID                int            `json:"order_id" validate:"required"`
+	Amount                 float64        `json:"amount" validate:"required,gt=0"`
+	CapturedAmount         float64        `json:"captured_amount"`
+	Currency               string         `json:"currency"`
+	Status                 string         `json:"status" validate:"required,oneof=pending partially_captured completed failed refunded disputed voided"`
+	PaymentMethod          string         `json:"payment_method" validate:"required,oneof=card cash paypal"`
+	Card                   *CardInput     `json:"card,omitempty"`
+	MethodDetails          *MethodDetails `json:"method_details,omitempty"`
+	SettlementID           *int           `json:"settlement_id,omitempty"`
+	RefundReason           *string        `json:"refund_reason,omitempty"`
+	AuthorizationExpiresAt *string        `json:"authorization_expires_at,omitempty"`
+	DeletedAt              *string        `json:"deletedAt,omitempty"`
+	// Test — платёж создан в песочнице (PAYMENTS_SANDBOX) и деньги не
+	// двигал; задаётся сервисом, а не клиентом.
+	Test      bool   `json:"test"`
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+// CardInput — данные карты из запроса на создание платежа. Номер нужен
+// только чтобы определить бренд и last4: payments-service сразу заменяет
+// его токеном, и в базу, ответы и логи он не попадает.
+type CardInput struct {
+	Number   string `json:"number,omitempty" example:"4242424242424242"`
+	ExpMonth int    `json:"exp_month" example:"12"`
+	ExpYear  int    `json:"exp_year" example:"2030"`
+}
+
+// MethodDetails — маскированные реквизиты карты, хранятся в
+// payments.method_details.
+type MethodDetails struct {
+	Brand    string `json:"brand" example:"visa"`
+	Last4    string `json:"last4" example:"4242"`
+	ExpMonth int    `json:"exp_month" example:"12"`
+	ExpYear  int    `json:"exp_year" example:"2030"`
+	Token    string `json:"token" example:"tok_3f9a1c0d5e7b2a4c6d8e0f12"`
+}
+
+// Scan читает JSONB-колонку method_details.
+func (m *MethodDetails) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, m)
+	case string:
+		return json.Unmarshal([]byte(v), m)
+	}
+	return fmt.Errorf("unsupported method_details type %T", src)
+}
+
+// Value пишет method_details как JSON; nil — NULL.
+func (m *MethodDetails) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	return json.Marshal(m)
+}
+
+// StatusTotals — число и сумма платежей в одном статусе.
+type StatusTotals struct {
+	Count  int     `json:"count"`
+	Amount float64 `json:"amount"`
+}
+
+// CurrencyStats — статистика платежей в одной валюте. Суммы разных валют
+// никогда не складываются.
+type CurrencyStats struct {
+	Count    int                     `json:"count"`
+	Amount   float64                 `json:"amount"`
+	ByStatus map[string]StatusTotals `json:"by_status"`
+}
+
+// AppliedRate — курс, по которому пересчитана часть платежей.
+type AppliedRate struct {
+	From          string  `json:"from"`
+	To            string  `json:"to"`
+	Rate          float64 `json:"rate"`
+	EffectiveDate string  `json:"effective_date"`
+	Payments      int     `json:"payments"`
+}
+
+// ConvertedStats — статистика, пересчитанная в одну валюту по курсу на
+// дату каждого платежа. Платежи без курса на свою дату в итог не входят и
+// перечислены в unconverted по валютам.
+type ConvertedStats struct {
+	Currency     string                  `json:"currency"`
+	Count        int                     `json:"count"`
+	Amount       float64                 `json:"amount"`
+	ByStatus     map[string]StatusTotals `json:"by_status"`
+	RatesApplied []AppliedRate           `json:"rates_applied"`
+	Unconverted  map[string]StatusTotals `json:"unconverted,omitempty"`
+}
+
+// PaymentStats — ответ GET /payments/stats.
+type PaymentStats struct {
+	Currencies     map[string]CurrencyStats `json:"currencies"`
+	Converted      *ConvertedStats          `json:"converted,omitempty"`
+	FailureReasons []ReasonCount            `json:"failure_reasons"`
+}
+
+// ReasonCount — причина неудачи и сколько раз она встретилась.
+type ReasonCount struct {
+	Reason string `json:"reason"`
+	Count  int    `json:"count"`
+}
+
+// Payments — клиент payments-service.
+type Payments struct {
+	client
+}
+
+// NewPayments создаёт клиент payments-service с базовым URL baseURL
+// (например, PAYMENTS_SERVICE_URL).
+func NewPayments(hc *httpclient.Client, baseURL string, opts ...Option) *Payments {
+	return &Payments{newClient(hc, "payments-service", baseURL, opts)}
+}
+
+func (c *Payments) Get(ctx context.Context, id int) (*Payment, error) {
+	var p Payment
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/payments/%d", id), nil, "", nil, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// List — GET /payments; query — фильтры (order_id, include_deleted).
+func (c *Payments) List(ctx context.Context, query url.Values) ([]Payment, error) {
+	var payments []Payment
+	err := c.do(ctx, http.MethodGet, "/payments", query, "", nil, &payments)
+	return payments, err
+}
+
+// Create проводит платёж. Повтор с тем же idempotencyKey возвращает тот
+// же платёж.
+func (c *Payments) Create(ctx context.Context, p Payment, idempotencyKey string) (*Payment, error) {
+	var out Payment
+	if err := c.do(ctx, http.MethodPost, "/payments", nil, idempotencyKey, p, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Payments) Update(ctx context.Context, id int, p Payment, idempotencyKey string) (*Payment, error) {
+	var out Payment
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/payments/%d", id), nil, idempotencyKey, p, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Payments) Delete(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/payments/%d", id), nil, "", nil, nil)
+}
+
+// Restore восстанавливает удалённый платёж (нужен WithAPIKey).
+func (c *Payments) Restore(ctx context.Context, id int) (*Payment, error) {
+	var out Payment
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/payments/%d/restore", id), nil, "", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetStatus переводит платёж из статуса from в to (например, completed →
+// refunded); в другом статусе платёж не меняется и возвращается false.
+func (c *Payments) SetStatus(ctx context.Context, id int, from, to, idempotencyKey string) (bool, error) {
+	return setStatus(ctx, &c.client, fmt.Sprintf("/payments/%d", id), func(p *Payment) *string { return &p.Status }, from, to, idempotencyKey)
+}
+
+// Stats — GET /payments/stats за дни from–to (YYYY-MM-DD) включительно.
+func (c *Payments) Stats(ctx context.Context, from, to string) (*PaymentStats, error) {
+	var out PaymentStats
+	if err := c.do(ctx, http.MethodGet, "/payments/stats", url.Values{"from": {from}, "to": {to}}, "", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
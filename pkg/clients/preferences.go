@@ -0,0 +1,57 @@
+package clients
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// PreferenceCache — настройки уведомлений из users-service с коротким
+// кэшем в памяти: отправители писем и SMS спрашивают их перед каждой
+// отправкой, а изменение настроек вступает в силу не позже чем через ttl.
+// Ошибки не кэшируются.
+type PreferenceCache struct {
+	users *Users
+	ttl   time.Duration
+
+	mu      sync.Mutex
+	entries map[int]cachedPreferences
+}
+
+type cachedPreferences struct {
+	prefs   NotificationPreferences
+	expires time.Time
+}
+
+// preferenceCacheMaxEntries — после стольких записей кэш очищается целиком.
+const preferenceCacheMaxEntries = 10000
+
+// NewPreferenceCache кэширует ответы users на ttl; ttl <= 0 выключает кэш.
+func NewPreferenceCache(users *Users, ttl time.Duration) *PreferenceCache {
+	return &PreferenceCache{users: users, ttl: ttl, entries: map[int]cachedPreferences{}}
+}
+
+// Get возвращает настройки пользователя userID.
+func (c *PreferenceCache) Get(ctx context.Context, userID int) (NotificationPreferences, error) {
+	now := time.Now()
+	c.mu.Lock()
+	e, ok := c.entries[userID]
+	c.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.prefs, nil
+	}
+
+	p, err := c.users.NotificationPreferences(ctx, userID)
+	if err != nil {
+		return NotificationPreferences{}, err
+	}
+	if c.ttl > 0 {
+		c.mu.Lock()
+		if len(c.entries) >= preferenceCacheMaxEntries {
+			clear(c.entries)
+		}
+		c.entries[userID] = cachedPreferences{prefs: *p, expires: now.Add(c.ttl)}
+		c.mu.Unlock()
+	}
+	return *p, nil
+}
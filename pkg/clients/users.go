@@ -0,0 +1,148 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"pkg/httpclient"
+)
+
+// User — пользователь users-service.
+type User struct {
+	ID       int    `json:"id"`
+	Email    string `json:"email" validate:"required,email"`
+	Name     string `json:"name" validate:"required,min=2,max=100"`
+	Age      int    `json:"age" validate:"required,min=1,max=150"`
+	Password string `json:"password,omitempty"`
+	IsActive bool   `json:"isActive"`
+	// Username — публичное имя вместо email; задаётся при регистрации или
+	// через PATCH /users/{id}/username, PUT его не меняет.
+	Username *string `json:"username,omitempty"`
+	// Phone — телефон в формате E.164 (+79991234567) для SMS о доставке.
+	Phone *string `json:"phone,omitempty"`
+	// Metadata — произвольные строковые поля интеграторов (id в CRM и т.п.).
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// AvatarURLs — адреса превью аватара по размерам (small, large).
+	AvatarURLs map[string]string `json:"avatarUrls,omitempty"`
+	CreatedAt  string            `json:"createdAt"`
+	UpdatedAt  string            `json:"updatedAt"`
+}
+
+// Users — клиент users-service.
+type Users struct {
+	client
+}
+
+// NewUsers создаёт клиент users-service с базовым URL baseURL (например,
+// USERS_SERVICE_URL).
+func NewUsers(hc *httpclient.Client, baseURL string, opts ...Option) *Users {
+	return &Users{newClient(hc, "users-service", baseURL, opts)}
+}
+
+func (c *Users) Get(ctx context.Context, id int) (*User, error) {
+	var u User
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/users/%d", id), nil, "", nil, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// List — GET /users; query — фильтры (is_active, metadata.<ключ>).
+func (c *Users) List(ctx context.Context, query url.Values) ([]User, error) {
+	var users []User
+	err := c.do(ctx, http.MethodGet, "/users", query, "", nil, &users)
+	return users, err
+}
+
+func (c *Users) Create(ctx context.Context, u User) (*User, error) {
+	var out User
+	if err := c.do(ctx, http.MethodPost, "/users", nil, "", u, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Users) Update(ctx context.Context, id int, u User) (*User, error) {
+	var out User
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/users/%d", id), nil, "", u, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Users) Delete(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/users/%d", id), nil, "", nil, nil)
+}
+
+func (c *Users) Activate(ctx context.Context, id int) (*User, error) {
+	var out User
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/users/%d/activate", id), nil, "", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Users) Deactivate(ctx context.Context, id int) (*User, error) {
+	var out User
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/users/%d/deactivate", id), nil, "", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// NotificationPreferences — какие уведомления получает пользователь.
+// Ключ, которого нет в сохранённых настройках, берёт значение из
+// DefaultNotificationPreferences. Служебные письма о безопасности аккаунта
+// (подтверждение и смена email) от настроек не зависят.
+type NotificationPreferences struct {
+	// EmailOrderUpdates — письма о смене статуса заказа; order_confirmed,
+	// order_shipped и order_delivered отключают отдельные письма.
+	EmailOrderUpdates bool `json:"email_order_updates"`
+	// SMSDeliveryUpdates — SMS о ходе доставки.
+	SMSDeliveryUpdates bool `json:"sms_delivery_updates"`
+	// Marketing — рекламные рассылки, по умолчанию выключены.
+	Marketing      bool `json:"marketing"`
+	OrderConfirmed bool `json:"order_confirmed"`
+	OrderShipped   bool `json:"order_shipped"`
+	OrderDelivered bool `json:"order_delivered"`
+}
+
+// DefaultNotificationPreferences — всё, кроме рекламы, включено.
+func DefaultNotificationPreferences() NotificationPreferences {
+	return NotificationPreferences{
+		EmailOrderUpdates:  true,
+		SMSDeliveryUpdates: true,
+		OrderConfirmed:     true,
+		OrderShipped:       true,
+		OrderDelivered:     true,
+	}
+}
+
+// OrderStatus — нужно ли письмо о переходе заказа в status.
+func (p NotificationPreferences) OrderStatus(status string) bool {
+	if !p.EmailOrderUpdates {
+		return false
+	}
+	switch status {
+	case "confirmed":
+		return p.OrderConfirmed
+	case "shipped":
+		return p.OrderShipped
+	case "delivered":
+		return p.OrderDelivered
+	}
+	return false
+}
+
+// NotificationPreferences — настройки писем пользователя (владелец или
+// WithAPIKey).
+func (c *Users) NotificationPreferences(ctx context.Context, id int) (*NotificationPreferences, error) {
+	// Ключи, которых нет в ответе (старый users-service), — по умолчанию.
+	p := DefaultNotificationPreferences()
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/users/%d/notification-preferences", id), nil, "", nil, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"pkg/clients"
+)
+
+func amount(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+func usersCmd(a *app) *cobra.Command {
+	r := &resource[clients.User]{
+		name:    "users",
+		columns: []string{"ID", "EMAIL", "NAME", "AGE", "ACTIVE", "CREATED"},
+		row: func(u *clients.User) []string {
+			return []string{strconv.Itoa(u.ID), u.Email, u.Name, strconv.Itoa(u.Age), strconv.FormatBool(u.IsActive), u.CreatedAt}
+		},
+		get:  func(ctx context.Context, id int) (*clients.User, error) { return a.users.Get(ctx, id) },
+		list: func(ctx context.Context, q url.Values) ([]clients.User, error) { return a.users.List(ctx, q) },
+		create: func(ctx context.Context, u clients.User) (*clients.User, error) {
+			return a.users.Create(ctx, u)
+		},
+		update: func(ctx context.Context, id int, u clients.User) (*clients.User, error) {
+			return a.users.Update(ctx, id, u)
+		},
+		delete: func(ctx context.Context, id int) error { return a.users.Delete(ctx, id) },
+	}
+	cmd := r.command(a, "Manage users")
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "activate ID",
+			Short: "Activate a user",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				id, err := parseID(args[0])
+				if err != nil {
+					return err
+				}
+				u, err := a.users.Activate(cmd.Context(), id)
+				if err != nil {
+					return err
+				}
+				return r.printOne(a, u)
+			},
+		},
+		&cobra.Command{
+			Use:   "deactivate ID",
+			Short: "Deactivate a user and end their sessions (requires --yes)",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				id, err := parseID(args[0])
+				if err != nil {
+					return err
+				}
+				if err := a.confirm(fmt.Sprintf("deactivating user %d", id)); err != nil {
+					return err
+				}
+				u, err := a.users.Deactivate(cmd.Context(), id)
+				if err != nil {
+					return err
+				}
+				return r.printOne(a, u)
+			},
+		},
+	)
+	return cmd
+}
+
+func ordersCmd(a *app) *cobra.Command {
+	r := &resource[clients.Order]{
+		name:    "orders",
+		columns: []string{"ID", "USER", "AMOUNT", "CURRENCY", "STATUS", "CREATED"},
+		row: func(o *clients.Order) []string {
+			return []string{strconv.Itoa(o.ID), strconv.Itoa(o.UserID), amount(o.TotalAmount), o.Currency, o.Status, o.CreatedAt}
+		},
+		get:  func(ctx context.Context, id int) (*clients.Order, error) { return a.orders.Get(ctx, id) },
+		list: func(ctx context.Context, q url.Values) ([]clients.Order, error) { return a.orders.List(ctx, q) },
+		create: func(ctx context.Context, o clients.Order) (*clients.Order, error) {
+			return a.orders.Create(ctx, o, idempotencyKey())
+		},
+		update: func(ctx context.Context, id int, o clients.Order) (*clients.Order, error) {
+			return a.orders.Update(ctx, id, o, idempotencyKey())
+		},
+		delete: func(ctx context.Context, id int) error { return a.orders.Delete(ctx, id) },
+	}
+	cmd := r.command(a, "Manage orders")
+	cmd.AddCommand(&cobra.Command{
+		Use:   "cancel ID",
+		Short: "Cancel a pending or confirmed order (requires --yes)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			if err := a.confirm(fmt.Sprintf("cancelling order %d", id)); err != nil {
+				return err
+			}
+			o, err := a.orders.Get(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+			if o.Status != "pending" && o.Status != "confirmed" {
+				return fmt.Errorf("order %d is %s; only pending or confirmed orders can be cancelled", id, o.Status)
+			}
+			changed, err := a.orders.SetStatus(cmd.Context(), id, o.Status, "cancelled", idempotencyKey())
+			if err != nil {
+				return err
+			}
+			if !changed {
+				return fmt.Errorf("order %d changed status concurrently; check it and retry", id)
+			}
+			if o, err = a.orders.Get(cmd.Context(), id); err != nil {
+				return err
+			}
+			return r.printOne(a, o)
+		},
+	})
+	return cmd
+}
+
+func paymentsCmd(a *app) *cobra.Command {
+	r := &resource[clients.Payment]{
+		name:    "payments",
+		columns: []string{"ID", "ORDER", "AMOUNT", "CURRENCY", "STATUS", "METHOD", "CREATED"},
+		row: func(p *clients.Payment) []string {
+			return []string{strconv.Itoa(p.ID), strconv.Itoa(p.OrderID), amount(p.Amount), p.Currency, p.Status, p.PaymentMethod, p.CreatedAt}
+		},
+		get:  func(ctx context.Context, id int) (*clients.Payment, error) { return a.payments.Get(ctx, id) },
+		list: func(ctx context.Context, q url.Values) ([]clients.Payment, error) { return a.payments.List(ctx, q) },
+		create: func(ctx context.Context, p clients.Payment) (*clients.Payment, error) {
+			return a.payments.Create(ctx, p, idempotencyKey())
+		},
+		update: func(ctx context.Context, id int, p clients.Payment) (*clients.Payment, error) {
+			return a.payments.Update(ctx, id, p, idempotencyKey())
+		},
+		delete: func(ctx context.Context, id int) error { return a.payments.Delete(ctx, id) },
+	}
+	cmd := r.command(a, "Manage payments")
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "refund ID",
+			Short: "Refund a completed payment (requires --yes)",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				id, err := parseID(args[0])
+				if err != nil {
+					return err
+				}
+				if err := a.confirm(fmt.Sprintf("refunding payment %d", id)); err != nil {
+					return err
+				}
+				changed, err := a.payments.SetStatus(cmd.Context(), id, "completed", "refunded", idempotencyKey())
+				if err != nil {
+					return err
+				}
+				p, err := a.payments.Get(cmd.Context(), id)
+				if err != nil {
+					return err
+				}
+				if !changed {
+					return fmt.Errorf("payment %d is %s; only completed payments can be refunded", id, p.Status)
+				}
+				return r.printOne(a, p)
+			},
+		},
+		&cobra.Command{
+			Use:   "restore ID",
+			Short: "Restore a deleted payment",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				id, err := parseID(args[0])
+				if err != nil {
+					return err
+				}
+				p, err := a.payments.Restore(cmd.Context(), id)
+				if err != nil {
+					return err
+				}
+				return r.printOne(a, p)
+			},
+		},
+	)
+	return cmd
+}
+
+func deliveriesCmd(a *app) *cobra.Command {
+	r := &resource[clients.Delivery]{
+		name:    "deliveries",
+		columns: []string{"ID", "ORDER", "STATUS", "COURIER", "FEE", "ADDRESS"},
+		row: func(d *clients.Delivery) []string {
+			courier := "-"
+			if d.CourierID != nil {
+				courier = strconv.Itoa(*d.CourierID)
+			}
+			return []string{strconv.Itoa(d.ID), strconv.Itoa(d.OrderID), d.Status, courier, amount(d.Fee), d.Address}
+		},
+		get:  func(ctx context.Context, id int) (*clients.Delivery, error) { return a.deliveries.Get(ctx, id) },
+		list: func(ctx context.Context, q url.Values) ([]clients.Delivery, error) { return a.deliveries.List(ctx, q) },
+		create: func(ctx context.Context, d clients.Delivery) (*clients.Delivery, error) {
+			return a.deliveries.Create(ctx, d, idempotencyKey())
+		},
+		update: func(ctx context.Context, id int, d clients.Delivery) (*clients.Delivery, error) {
+			return a.deliveries.Update(ctx, id, d, idempotencyKey())
+		},
+		delete: func(ctx context.Context, id int) error { return a.deliveries.Delete(ctx, id) },
+	}
+	return r.command(a, "Manage deliveries")
+}
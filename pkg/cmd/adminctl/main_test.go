@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"pkg/clients"
+)
+
+// fakePayments — payments-service с одним платежом: GET и PUT /payments/7.
+type fakePayments struct {
+	mu      sync.Mutex
+	payment clients.Payment
+	puts    int
+}
+
+func (f *fakePayments) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path != "/payments/7" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodPut {
+		f.puts++
+		json.NewDecoder(r.Body).Decode(&f.payment)
+	}
+	json.NewEncoder(w).Encode(f.payment)
+}
+
+func run(t *testing.T, srv *httptest.Server, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	cmd := newRootCmd(&out)
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetArgs(append([]string{"--url", srv.URL}, args...))
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+// TestRefundRequiresYes — без --yes возврат не отправляет ни одного PUT.
+func TestRefundRequiresYes(t *testing.T) {
+	f := &fakePayments{payment: clients.Payment{ID: 7, OrderID: 3, Amount: 10, Status: "completed", PaymentMethod: "card"}}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	if _, err := run(t, srv, "payments", "refund", "7"); err == nil || !strings.Contains(err.Error(), "--yes") {
+		t.Fatalf("refund without --yes: err = %v", err)
+	}
+	if f.puts != 0 {
+		t.Fatalf("refund without --yes sent %d PUTs", f.puts)
+	}
+
+	out, err := run(t, srv, "payments", "refund", "7", "--yes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.payment.Status != "refunded" || !strings.Contains(out, "refunded") {
+		t.Fatalf("status %q, output:\n%s", f.payment.Status, out)
+	}
+
+	// Повторный возврат: платёж уже не completed.
+	if _, err := run(t, srv, "payments", "refund", "7", "--yes"); err == nil {
+		t.Fatal("refund of a refunded payment succeeded")
+	}
+}
+
+// TestUpdateMergesFields — update меняет только переданные поля, а
+// неизвестное поле отклоняется до запроса.
+func TestUpdateMergesFields(t *testing.T) {
+	f := &fakePayments{payment: clients.Payment{ID: 7, OrderID: 3, Amount: 10, Currency: "RUB", Status: "pending", PaymentMethod: "card"}}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	out, err := run(t, srv, "-o", "json", "payments", "update", "7", "--data", `{"status":"completed"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got clients.Payment
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out)
+	}
+	if got.Status != "completed" || got.Currency != "RUB" || got.Amount != 10 {
+		t.Fatalf("updated payment = %+v", got)
+	}
+
+	if _, err := run(t, srv, "payments", "update", "7", "--data", `{"stauts":"failed"}`); err == nil {
+		t.Fatal("unknown field accepted")
+	}
+	if f.puts != 1 {
+		t.Fatalf("PUTs = %d, want 1", f.puts)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	prev := map[string]json.RawMessage{"status": json.RawMessage(`"pending"`), "fee": json.RawMessage(`199`)}
+	cur := map[string]json.RawMessage{"status": json.RawMessage(`"in_transit"`), "fee": json.RawMessage(`199`), "courier_id": json.RawMessage(`5`)}
+	got := diff(prev, cur)
+	want := []string{`courier_id: ∅ → 5`, `status: "pending" → "in_transit"`}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("diff = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"pkg/clients"
+)
+
+// resource — операции клиента над одним видом записей; из него строятся
+// общие подкоманды get, list, create, update, delete и watch.
+type resource[T any] struct {
+	name    string // подкоманда: users, orders, ...
+	columns []string
+	row     func(*T) []string
+
+	get    func(ctx context.Context, id int) (*T, error)
+	list   func(ctx context.Context, query url.Values) ([]T, error)
+	create func(ctx context.Context, v T) (*T, error)
+	update func(ctx context.Context, id int, v T) (*T, error)
+	delete func(ctx context.Context, id int) error
+}
+
+func (r *resource[T]) command(a *app, short string) *cobra.Command {
+	cmd := &cobra.Command{Use: r.name, Short: short}
+	cmd.AddCommand(r.getCmd(a), r.listCmd(a), r.createCmd(a), r.updateCmd(a), r.deleteCmd(a), r.watchCmd(a))
+	return cmd
+}
+
+func (r *resource[T]) printOne(a *app, v *T) error {
+	return a.print(v, r.columns, [][]string{r.row(v)})
+}
+
+func (r *resource[T]) getCmd(a *app) *cobra.Command {
+	return &cobra.Command{
+		Use:   "get ID",
+		Short: "Show one record",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			v, err := r.get(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+			return r.printOne(a, v)
+		},
+	}
+}
+
+func (r *resource[T]) listCmd(a *app) *cobra.Command {
+	var filters []string
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List records; --filter is passed to the API as a query parameter",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			query := url.Values{}
+			for _, f := range filters {
+				k, v, ok := strings.Cut(f, "=")
+				if !ok || k == "" {
+					return fmt.Errorf("filter %q: expected key=value", f)
+				}
+				query.Add(k, v)
+			}
+			items, err := r.list(cmd.Context(), query)
+			if err != nil {
+				return err
+			}
+			rows := make([][]string, len(items))
+			for i := range items {
+				rows[i] = r.row(&items[i])
+			}
+			return a.print(items, r.columns, rows)
+		},
+	}
+	cmd.Flags().StringArrayVar(&filters, "filter", nil, "параметр запроса key=value, можно повторять")
+	return cmd
+}
+
+func (r *resource[T]) createCmd(a *app) *cobra.Command {
+	var data string
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a record from JSON (--data, @file or - for stdin)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			body, err := readData(data, cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+			var v T
+			if err := strictUnmarshal(body, &v); err != nil {
+				return err
+			}
+			out, err := r.create(cmd.Context(), v)
+			if err != nil {
+				return err
+			}
+			return r.printOne(a, out)
+		},
+	}
+	cmd.Flags().StringVarP(&data, "data", "d", "", "JSON записи, @file или - (stdin)")
+	cmd.MarkFlagRequired("data")
+	return cmd
+}
+
+func (r *resource[T]) updateCmd(a *app) *cobra.Command {
+	var data string
+	cmd := &cobra.Command{
+		Use:   "update ID",
+		Short: "Change fields of a record; the JSON holds only the fields to change",
+		Long: "PUT сервисов принимает запись целиком, поэтому update читает текущую " +
+			"запись, накладывает на неё поля из --data и отправляет результат.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			body, err := readData(data, cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+			cur, err := r.get(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+			if err := strictUnmarshal(body, cur); err != nil {
+				return err
+			}
+			out, err := r.update(cmd.Context(), id, *cur)
+			if err != nil {
+				return err
+			}
+			return r.printOne(a, out)
+		},
+	}
+	cmd.Flags().StringVarP(&data, "data", "d", "", "JSON изменяемых полей, @file или - (stdin)")
+	cmd.MarkFlagRequired("data")
+	return cmd
+}
+
+func (r *resource[T]) deleteCmd(a *app) *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete ID",
+		Short: "Delete a record (requires --yes)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			if err := a.confirm(fmt.Sprintf("deleting %s %d", r.name, id)); err != nil {
+				return err
+			}
+			if err := r.delete(cmd.Context(), id); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "🗑️ Deleted %s %d\n", r.name, id)
+			return nil
+		},
+	}
+}
+
+// watchCmd опрашивает запись раз в --interval и печатает изменившиеся
+// поля (с -o json — запись целиком при каждом изменении). Ошибки опроса
+// печатаются, опрос продолжается; удалённая запись завершает команду.
+func (r *resource[T]) watchCmd(a *app) *cobra.Command {
+	var interval time.Duration
+	cmd := &cobra.Command{
+		Use:   "watch ID",
+		Short: "Poll a record and print changes until interrupted",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			if interval <= 0 {
+				return errors.New("interval must be positive")
+			}
+			return r.watch(cmd.Context(), a, id, interval)
+		},
+	}
+	cmd.Flags().DurationVar(&interval, "interval", 5*time.Second, "период опроса")
+	return cmd
+}
+
+func (r *resource[T]) watch(ctx context.Context, a *app, id int, interval time.Duration) error {
+	var prev map[string]json.RawMessage
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		v, err := r.get(ctx, id)
+		switch {
+		case clients.IsNotFound(err):
+			fmt.Fprintf(a.out, "%s %s %d not found\n", time.Now().Format(time.TimeOnly), r.name, id)
+			return err
+		case err != nil && ctx.Err() != nil:
+			return nil
+		case err != nil:
+			fmt.Fprintf(a.out, "%s ⚠️ %v\n", time.Now().Format(time.TimeOnly), err)
+		default:
+			cur, err := fields(v)
+			if err != nil {
+				return err
+			}
+			if prev == nil {
+				if err := r.printOne(a, v); err != nil {
+					return err
+				}
+			} else if changes := diff(prev, cur); len(changes) > 0 {
+				if a.output == "json" {
+					if err := a.print(v, nil, nil); err != nil {
+						return err
+					}
+				} else {
+					for _, c := range changes {
+						fmt.Fprintf(a.out, "%s %s\n", time.Now().Format(time.TimeOnly), c)
+					}
+				}
+			}
+			prev = cur
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// fields — поля записи верхнего уровня в JSON-представлении API.
+func fields(v interface{}) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]json.RawMessage
+	return m, json.Unmarshal(data, &m)
+}
+
+// diff — изменения полей вида `status: "pending" → "confirmed"` в
+// порядке имён полей.
+func diff(prev, cur map[string]json.RawMessage) []string {
+	names := make(map[string]bool, len(cur))
+	for k := range prev {
+		names[k] = true
+	}
+	for k := range cur {
+		names[k] = true
+	}
+	keys := make([]string, 0, len(names))
+	for k := range names {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var out []string
+	for _, k := range keys {
+		before, after := string(prev[k]), string(cur[k])
+		if before == after {
+			continue
+		}
+		if before == "" {
+			before = "∅"
+		}
+		if after == "" {
+			after = "∅"
+		}
+		out = append(out, fmt.Sprintf("%s: %s → %s", k, before, after))
+	}
+	return out
+}
+
+func parseID(s string) (int, error) {
+	id, err := strconv.Atoi(s)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid id %q", s)
+	}
+	return id, nil
+}
+
+// readData — JSON из значения флага: как есть, @file или - (stdin).
+func readData(data string, stdin io.Reader) ([]byte, error) {
+	switch {
+	case data == "-":
+		return io.ReadAll(stdin)
+	case strings.HasPrefix(data, "@"):
+		return os.ReadFile(data[1:])
+	default:
+		return []byte(data), nil
+	}
+}
+
+// strictUnmarshal не принимает неизвестные поля: опечатка в имени поля
+// иначе молча не изменила бы запись.
+func strictUnmarshal(data []byte, v interface{}) error {
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return nil
+}
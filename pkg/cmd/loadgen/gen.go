@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+var (
+	firstNames = []string{"Alice", "Boris", "Chen", "Daria", "Emil", "Fatima", "Gleb", "Hana", "Ivan", "Julia", "Kirill", "Lena", "Marat", "Nina", "Oleg", "Polina"}
+	lastNames  = []string{"Ivanov", "Smirnova", "Kuznetsov", "Popova", "Sokolov", "Lebedeva", "Kozlov", "Novikova", "Morozov", "Volkova"}
+	streets    = []string{"Lenina", "Gagarina", "Pushkina", "Sadovaya", "Mira", "Tverskaya", "Nevsky prospekt", "Arbat"}
+	cities     = []string{"Moscow", "Saint Petersburg", "Kazan", "Novosibirsk", "Yekaterinburg", "Samara"}
+	// hourWeights — доля заказов по часам суток: ночью мало, пик вечером.
+	hourWeights = []int{1, 1, 1, 1, 1, 1, 2, 3, 4, 5, 6, 6, 7, 7, 6, 6, 6, 7, 8, 9, 9, 7, 4, 2}
+)
+
+// Виды записей — разные потоки случайных чисел при одном seed.
+const (
+	kindUsers = iota + 1
+	kindOrders
+)
+
+// generator строит записи детерминированно: пачка chunk вида kind всегда
+// одинакова при том же Config, поэтому прерванный запуск пересоздаёт её
+// заново, не повторяя предыдущие пачки.
+type generator struct {
+	cfg   Config
+	until time.Time
+	span  time.Duration
+}
+
+func newGenerator(cfg Config) *generator {
+	return &generator{cfg: cfg, until: cfg.Until, span: time.Duration(cfg.Months) * 30 * 24 * time.Hour}
+}
+
+func (g *generator) rng(kind, chunk int) *rand.Rand {
+	return rand.New(rand.NewSource(g.cfg.Seed*1_000_003 + int64(kind)*7919 + int64(chunk)))
+}
+
+// splitmix — быстрый хэш id в [0, 1) для свойств, которые нужны и при
+// генерации заказов (дата регистрации пользователя).
+func (g *generator) splitmix(id int) float64 {
+	z := uint64(g.cfg.Seed) ^ uint64(id)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z ^= z >> 31
+	return float64(z>>11) / (1 << 53)
+}
+
+// userCreated — дата регистрации пользователя: равномерно за период.
+func (g *generator) userCreated(id int) time.Time {
+	return g.until.Add(-time.Duration(float64(g.span) * g.splitmix(id)))
+}
+
+// moment — время после from: чем ближе к until, тем плотнее (рост
+// нагрузки), час суток — по hourWeights.
+func (g *generator) moment(rng *rand.Rand, from time.Time) time.Time {
+	window := g.until.Sub(from)
+	day := from.Add(time.Duration(float64(window) * math.Sqrt(rng.Float64()))).Truncate(24 * time.Hour)
+	total := 0
+	for _, w := range hourWeights {
+		total += w
+	}
+	n, hour := rng.Intn(total), 0
+	for ; n >= hourWeights[hour]; hour++ {
+		n -= hourWeights[hour]
+	}
+	t := day.Add(time.Duration(hour)*time.Hour + time.Duration(rng.Intn(3600))*time.Second)
+	if t.Before(from) {
+		return from
+	}
+	if t.After(g.until) {
+		return g.until
+	}
+	return t
+}
+
+// users — пользователи с id [start, end).
+func (g *generator) users(chunk, start, end int) [][]interface{} {
+	rng := g.rng(kindUsers, chunk)
+	rows := make([][]interface{}, 0, end-start)
+	for id := start; id < end; id++ {
+		first := firstNames[rng.Intn(len(firstNames))]
+		last := lastNames[rng.Intn(len(lastNames))]
+		created := g.userCreated(id)
+		// Треть пользователей ни разу не входила.
+		var lastLogin interface{}
+		if rng.Intn(3) > 0 {
+			lastLogin = g.moment(rng, created)
+		}
+		rows = append(rows, []interface{}{
+			id, fmt.Sprintf("%s.%s.%d@load.example", strings.ToLower(first), strings.ToLower(last), id),
+			first + " " + last, 18 + rng.Intn(60), lastLogin, created, created,
+		})
+	}
+	return rows
+}
+
+// orderChunk — заказы с id [start, end) и их платежи и доставки (id
+// платежа и доставки совпадает с id заказа).
+type orderChunk struct {
+	orders, payments, deliveries [][]interface{}
+}
+
+func (g *generator) orders(chunk, start, end int) orderChunk {
+	rng := g.rng(kindOrders, chunk)
+	out := orderChunk{orders: make([][]interface{}, 0, end-start)}
+	for id := start; id < end; id++ {
+		userID := g.cfg.IDBase + rng.Intn(g.cfg.Users)
+		created := g.moment(rng, g.userCreated(userID))
+		// Логнормальная сумма: медиана около 40, редкие крупные заказы.
+		amount := math.Round(math.Min(math.Max(math.Exp(math.Log(40)+0.9*rng.NormFloat64()), 1), 5000)*100) / 100
+		address := fmt.Sprintf("%d %s st., %s", 1+rng.Intn(200), streets[rng.Intn(len(streets))], cities[rng.Intn(len(cities))])
+		status := orderStatus(rng, g.until.Sub(created))
+		updated := created.Add(time.Duration(rng.Intn(72*3600)) * time.Second)
+		if updated.After(g.until) {
+			updated = g.until
+		}
+		out.orders = append(out.orders, []interface{}{id, userID, amount, "RUB", status, address, created, updated})
+
+		paid := created.Add(time.Duration(30+rng.Intn(600)) * time.Second)
+		switch status {
+		case "pending", "cancelled":
+			// Часть брошенных и отменённых заказов — с неудачной оплатой.
+			if rng.Intn(100) < 30 {
+				out.payments = append(out.payments, []interface{}{id, userID, id, amount, "RUB", "failed", nil, nil, created, paid})
+			}
+			continue
+		}
+		payment := []interface{}{id, userID, id, amount, "RUB", "completed", paid, nil, created, paid}
+		if status == "delivered" && rng.Intn(100) < 3 {
+			refunded := updated.Add(time.Duration(1+rng.Intn(14*24)) * time.Hour)
+			if refunded.After(g.until) {
+				refunded = g.until
+			}
+			payment[5], payment[7], payment[9] = "refunded", refunded, refunded
+		}
+		out.payments = append(out.payments, payment)
+
+		fee := 199.0
+		if amount >= 3000 {
+			fee = 0
+		}
+		delivery := []interface{}{id, userID, id, address, "pending", fmt.Sprintf("LG%010d", id), fee, nil, created, updated}
+		switch status {
+		case "shipped":
+			delivery[4] = "in_transit"
+		case "delivered":
+			delivery[4], delivery[7] = "delivered", updated
+		}
+		out.deliveries = append(out.deliveries, delivery)
+	}
+	return out
+}
+
+// orderStatus — распределение статусов: свежие заказы ещё в работе,
+// старше двух недель — почти все доставлены или отменены.
+func orderStatus(rng *rand.Rand, age time.Duration) string {
+	r := rng.Intn(100)
+	if age > 14*24*time.Hour {
+		switch {
+		case r < 83:
+			return "delivered"
+		case r < 97:
+			return "cancelled"
+		default:
+			return "pending"
+		}
+	}
+	switch {
+	case r < 15:
+		return "pending"
+	case r < 25:
+		return "cancelled"
+	case r < 50:
+		return "confirmed"
+	case r < 75:
+		return "shipped"
+	default:
+		return "delivered"
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testGenerator() *generator {
+	return newGenerator(Config{Seed: 7, Users: 50, Orders: 500, Months: 6, IDBase: 10_000_000, Batch: 100,
+		Until: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)})
+}
+
+// TestChunksReproducible — пачка пересоздаётся одинаковой без
+// предыдущих, на этом держится продолжение прерванного запуска.
+func TestChunksReproducible(t *testing.T) {
+	g := testGenerator()
+	a := g.orders(3, 10_000_300, 10_000_400)
+	b := testGenerator().orders(3, 10_000_300, 10_000_400)
+	if !reflect.DeepEqual(a, b) {
+		t.Fatal("same chunk generated differently")
+	}
+	if reflect.DeepEqual(a.orders, g.orders(4, 10_000_300, 10_000_400).orders) {
+		t.Fatal("different chunks generated the same orders")
+	}
+}
+
+// TestOrdersReferenceUsers — заказы ссылаются на созданных пользователей
+// и не раньше их регистрации; платежи и доставки — на свои заказы.
+func TestOrdersReferenceUsers(t *testing.T) {
+	g := testGenerator()
+	c := g.orders(0, 10_000_000, 10_000_100)
+	for _, o := range c.orders {
+		userID, created := o[1].(int), o[6].(time.Time)
+		if userID < 10_000_000 || userID >= 10_000_050 {
+			t.Fatalf("order %d references unknown user %d", o[0], userID)
+		}
+		if created.Before(g.userCreated(userID)) || created.After(g.until) {
+			t.Fatalf("order %d created %s, user registered %s", o[0], created, g.userCreated(userID))
+		}
+	}
+	for _, rows := range [][][]interface{}{c.payments, c.deliveries} {
+		for _, row := range rows {
+			if row[0] != row[2] {
+				t.Fatalf("row id %v differs from its order id %v", row[0], row[2])
+			}
+		}
+	}
+}
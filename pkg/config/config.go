@@ -0,0 +1,395 @@
+// Package config загружает типизированную конфигурацию сервиса из
+// переменных окружения.
+//
+// Конфигурация — структура с тегами:
+//
+//	env:"PORT"          имя переменной (обязательно для поля-значения)
+//	default:"8001"      значение, если переменная не задана
+//	required:"true"     переменная должна быть задана
+//	secret:"true"       значение не попадает в журнал и -print-config
+//	url:"true"          строка — абсолютный URL (схема и хост)
+//	oneof:"a,b,c"       допустимые значения строки
+//	min:"1s"            нижняя граница для чисел и длительностей
+//
+// Поддерживаются string, bool, int, int64, float64, time.Duration и
+// []string (через запятую). Вложенные структуры без тега env (например,
+// Common) разбираются рекурсивно. Ошибки собираются по всем полям, а не
+// до первой.
+//
+// Любую переменную можно передать файлом: NAME_FILE — путь к файлу
+// (Docker/Kubernetes secrets), значением становится его содержимое без
+// пробелов по краям. Задать и NAME, и NAME_FILE — ошибка. Прочитанное
+// значение записывается в окружение процесса под именем NAME, чтобы его
+// видели и общие пакеты, читающие переменные сами (pkg/auth, pkg/admin).
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Common — переменные, которые читают общие пакеты (pkg/auth, pkg/mode,
+// pkg/flags, pkg/hmacsign, pkg/mtls, pkg/observe, pkg/specvalidate,
+// pkg/limit, pkg/ratelimit, pkg/dbhealth, pkg/replica). Пакеты
+// по-прежнему читают их сами; здесь они проверяются при старте и выводятся
+// в журнал вместе с остальной конфигурацией. Умолчания совпадают с
+// умолчаниями пакетов.
+type Common struct {
+	AppEnv                    string        `env:"APP_ENV"`
+	ReplicaID                 string        `env:"REPLICA_ID"`
+	JWTSecret                 string        `env:"JWT_SECRET" secret:"true"`
+	InternalAPIKey            string        `env:"INTERNAL_API_KEY" secret:"true"`
+	ServiceMode               string        `env:"SERVICE_MODE" default:"normal" oneof:"normal,read_only,maintenance"`
+	ModeRetryAfter            time.Duration `env:"MODE_RETRY_AFTER" default:"1m" min:"1s"`
+	SlowRequestThreshold      time.Duration `env:"SLOW_REQUEST_THRESHOLD" default:"1s" min:"1ms"`
+	FeatureFlagsFile          string        `env:"FEATURE_FLAGS_FILE"`
+	FeatureFlagsPollInterval  time.Duration `env:"FEATURE_FLAGS_POLL_INTERVAL" default:"5s" min:"1ms"`
+	HMACSigningKey            string        `env:"HMAC_SIGNING_KEY" secret:"true"`
+	HMACVerifyKeys            string        `env:"HMAC_VERIFY_KEYS" secret:"true"`
+	HMACMaxSkew               time.Duration `env:"HMAC_MAX_SKEW" default:"5m" min:"1s"`
+	MTLSCAFile                string        `env:"MTLS_CA_FILE"`
+	MTLSCertFile              string        `env:"MTLS_CERT_FILE"`
+	MTLSKeyFile               string        `env:"MTLS_KEY_FILE"`
+	OpenAPIValidation         string        `env:"OPENAPI_VALIDATION" default:"off" oneof:"off,log,enforce"`
+	OpenAPIResponseValidation bool          `env:"OPENAPI_RESPONSE_VALIDATION"`
+	MaxConcurrentRequests     int           `env:"MAX_CONCURRENT_REQUESTS" default:"100" min:"0"`
+	ConcurrencyQueueSize      int           `env:"CONCURRENCY_QUEUE_SIZE" default:"50" min:"0"`
+	ConcurrencyQueueTimeout   time.Duration `env:"CONCURRENCY_QUEUE_TIMEOUT" default:"500ms" min:"1ms"`
+	ConcurrencyRetryAfter     time.Duration `env:"CONCURRENCY_RETRY_AFTER" default:"1s" min:"1s"`
+	DBWatchdogInterval        time.Duration `env:"DB_WATCHDOG_INTERVAL" default:"2s" min:"100ms"`
+	DBWatchdogTimeout         time.Duration `env:"DB_WATCHDOG_TIMEOUT" default:"1s" min:"10ms"`
+	DBWatchdogFailures        int           `env:"DB_WATCHDOG_FAILURES" default:"3" min:"1"`
+	RateLimitRead             string        `env:"RATE_LIMIT_READ" default:"300/1m"`
+	RateLimitWrite            string        `env:"RATE_LIMIT_WRITE" default:"60/1m"`
+}
+
+// HTTPClient — настройки pkg/httpclient (таймауты, повторы, circuit
+// breaker) для сервисов, которые ходят в другие сервисы.
+type HTTPClient struct {
+	Timeout                 time.Duration `env:"HTTP_CLIENT_TIMEOUT" default:"5s" min:"1ms"`
+	MaxAttempts             int           `env:"HTTP_CLIENT_MAX_ATTEMPTS" default:"3" min:"1"`
+	RetryBaseDelay          time.Duration `env:"HTTP_CLIENT_RETRY_BASE_DELAY" default:"100ms" min:"0s"`
+	RetryMaxDelay           time.Duration `env:"HTTP_CLIENT_RETRY_MAX_DELAY" default:"2s" min:"0s"`
+	BreakerFailureThreshold int           `env:"BREAKER_FAILURE_THRESHOLD" default:"5" min:"1"`
+	BreakerOpenDuration     time.Duration `env:"BREAKER_OPEN_DURATION" default:"30s" min:"1ms"`
+	BreakerHalfOpenProbes   int           `env:"BREAKER_HALF_OPEN_PROBES" default:"1" min:"1"`
+}
+
+// Consistency — настройки pkg/consistency для сервисов, чьи записи
+// ссылаются на записи других сервисов.
+type Consistency struct {
+	// 0 — проверка только по POST /admin/inconsistencies/check.
+	CheckInterval  time.Duration `env:"CONSISTENCY_CHECK_INTERVAL" default:"24h" min:"0s"`
+	LookupInterval time.Duration `env:"CONSISTENCY_LOOKUP_INTERVAL" default:"200ms" min:"0s"`
+	BatchSize      int           `env:"CONSISTENCY_BATCH_SIZE" default:"100" min:"1"`
+	Remediate      bool          `env:"CONSISTENCY_REMEDIATE"`
+}
+
+// Errors — все ошибки конфигурации сразу.
+type Errors []error
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, err := range e {
+		parts[i] = err.Error()
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Entry — одна переменная в эффективной конфигурации.
+type Entry struct {
+	Name    string
+	Value   string // для секретов — маска
+	Default bool   // переменная не задана, взято умолчание
+	File    string // путь из NAME_FILE, если значение прочитано из файла
+}
+
+// Validator — проверки, связывающие несколько полей (например, S3_* при
+// AVATAR_STORAGE=s3). Вызывается и после ошибок разбора, чтобы сообщить
+// обо всём сразу; неразобранные поля в нём имеют нулевые значения.
+type Validator interface {
+	Validate() []error
+}
+
+// Load заполняет cfg (указатель на структуру) из окружения. Возвращает
+// Errors со всеми неверными и недостающими переменными; затем, если cfg
+// реализует Validator, — с ошибками его проверок.
+func Load(cfg interface{}) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return errors.New("config: Load expects a pointer to a struct")
+	}
+	var errs Errors
+	walk(v.Elem(), func(f reflect.StructField, fv reflect.Value) {
+		if err := loadField(f, fv); err != nil {
+			errs = append(errs, err)
+		}
+	})
+	if c, ok := cfg.(Validator); ok {
+		errs = append(errs, c.Validate()...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Describe возвращает эффективную конфигурацию в порядке полей, секреты
+// замаскированы, пароли в URL скрыты.
+func Describe(cfg interface{}) []Entry {
+	var out []Entry
+	walk(reflect.ValueOf(cfg).Elem(), func(f reflect.StructField, fv reflect.Value) {
+		name := f.Tag.Get("env")
+		raw := strings.TrimSpace(os.Getenv(name))
+		out = append(out, Entry{Name: name, Value: display(f, fv), Default: raw == "", File: fileSource(name)})
+	})
+	return out
+}
+
+// Print пишет эффективную конфигурацию построчно: NAME=value, с пометкой
+// (default) для незаданных переменных и (from путь) для прочитанных из
+// файла.
+func Print(w io.Writer, cfg interface{}) {
+	for _, e := range Describe(cfg) {
+		line := e.Name + "=" + e.Value
+		if e.Default {
+			line += " (default)"
+		}
+		if e.File != "" {
+			line += " (from " + e.File + ")"
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+var printConfig = flag.Bool("print-config", false, "print the effective configuration and exit")
+
+// MustLoad загружает конфигурацию сервиса при старте. С флагом
+// -print-config печатает её в stdout и завершает процесс (код 1, если
+// конфигурация неверна). Неверная конфигурация — выход с перечнем всех
+// ошибок; верная — записывается в журнал.
+func MustLoad(service string, cfg interface{}) {
+	if !flag.Parsed() {
+		flag.Parse()
+	}
+	err := Load(cfg)
+	if *printConfig {
+		Print(os.Stdout, cfg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "invalid configuration:")
+			for _, e := range err.(Errors) {
+				fmt.Fprintln(os.Stderr, "  "+e.Error())
+			}
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if err != nil {
+		var b strings.Builder
+		for _, e := range err.(Errors) {
+			b.WriteString("\n  " + e.Error())
+		}
+		log.Fatalf("❌ Invalid %s configuration:%s", service, b.String())
+	}
+	var b strings.Builder
+	for _, e := range Describe(cfg) {
+		if !e.Default {
+			b.WriteString(" " + e.Name + "=" + e.Value)
+			if e.File != "" {
+				b.WriteString(" (from " + e.File + ")")
+			}
+		}
+	}
+	log.Printf("⚙️ %s configuration (non-default):%s", service, b.String())
+}
+
+// walk обходит поля с тегом env, заходя во вложенные структуры.
+func walk(v reflect.Value, fn func(reflect.StructField, reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f, fv := t.Field(i), v.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if f.Tag.Get("env") == "" {
+			if fv.Kind() == reflect.Struct {
+				walk(fv, fn)
+			}
+			continue
+		}
+		fn(f, fv)
+	}
+}
+
+func loadField(f reflect.StructField, fv reflect.Value) error {
+	name := f.Tag.Get("env")
+	raw, err := lookup(name)
+	if err != nil {
+		return err
+	}
+	if raw == "" {
+		if f.Tag.Get("required") == "true" {
+			return fmt.Errorf("%s is required", name)
+		}
+		raw = f.Tag.Get("default")
+		if raw == "" {
+			fv.Set(reflect.Zero(fv.Type()))
+			return nil
+		}
+	}
+	if err := setValue(fv, raw); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return check(f, fv)
+}
+
+// fromFile — переменные, уже прочитанные из NAME_FILE и записанные в
+// окружение: повторная загрузка не должна принимать их за NAME, заданную
+// вместе с NAME_FILE.
+var (
+	fromFileMu sync.Mutex
+	fromFile   = map[string]string{} // NAME -> путь
+)
+
+// lookup возвращает значение переменной из NAME или из файла NAME_FILE.
+func lookup(name string) (string, error) {
+	raw := strings.TrimSpace(os.Getenv(name))
+	path := strings.TrimSpace(os.Getenv(name + "_FILE"))
+	if path == "" {
+		return raw, nil
+	}
+	fromFileMu.Lock()
+	defer fromFileMu.Unlock()
+	if raw != "" && fromFile[name] != path {
+		return "", fmt.Errorf("%s and %s_FILE are both set; use one of them", name, name)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%s_FILE: %v", name, err)
+	}
+	value := strings.TrimSpace(string(data))
+	if err := os.Setenv(name, value); err != nil {
+		return "", fmt.Errorf("%s_FILE: %v", name, err)
+	}
+	fromFile[name] = path
+	return value, nil
+}
+
+func fileSource(name string) string {
+	fromFileMu.Lock()
+	defer fromFileMu.Unlock()
+	return fromFile[name]
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setValue(fv reflect.Value, raw string) error {
+	switch {
+	case fv.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		fv.SetInt(int64(d))
+	case fv.Kind() == reflect.String:
+		fv.SetString(raw)
+	case fv.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		fv.SetBool(b)
+	case fv.Kind() == reflect.Int || fv.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		fv.SetInt(n)
+	case fv.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		fv.SetFloat(n)
+	case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, s := range strings.Split(raw, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				items = append(items, s)
+			}
+		}
+		fv.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported field type %s", fv.Type())
+	}
+	return nil
+}
+
+// check применяет url, oneof и min к разобранному значению.
+func check(f reflect.StructField, fv reflect.Value) error {
+	name := f.Tag.Get("env")
+	if f.Tag.Get("url") == "true" && fv.String() != "" {
+		if u, err := url.Parse(fv.String()); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("%s: %q is not an absolute URL", name, fv.String())
+		}
+	}
+	if oneof := f.Tag.Get("oneof"); oneof != "" {
+		allowed := strings.Split(oneof, ",")
+		ok := false
+		for _, a := range allowed {
+			ok = ok || fv.String() == a
+		}
+		if !ok {
+			return fmt.Errorf("%s: %q must be one of %s", name, fv.String(), strings.Join(allowed, ", "))
+		}
+	}
+	if min := f.Tag.Get("min"); min != "" {
+		bound := reflect.New(fv.Type()).Elem()
+		if err := setValue(bound, min); err != nil {
+			return fmt.Errorf("%s: bad min tag: %v", name, err)
+		}
+		below := false
+		switch fv.Kind() {
+		case reflect.Int, reflect.Int64:
+			below = fv.Int() < bound.Int()
+		case reflect.Float64:
+			below = fv.Float() < bound.Float()
+		}
+		if below {
+			return fmt.Errorf("%s: must be at least %s", name, min)
+		}
+	}
+	return nil
+}
+
+func display(f reflect.StructField, fv reflect.Value) string {
+	if f.Tag.Get("secret") == "true" {
+		if fv.IsZero() {
+			return ""
+		}
+		return "[redacted]"
+	}
+	switch {
+	case fv.Type() == durationType:
+		return time.Duration(fv.Int()).String()
+	case fv.Kind() == reflect.Slice:
+		return strings.Join(fv.Interface().([]string), ",")
+	case fv.Kind() == reflect.String:
+		// Пароль в URL (DATABASE_URL, REDIS_URL) не выводится.
+		if u, err := url.Parse(fv.String()); err == nil && u.User != nil {
+			return u.Redacted()
+		}
+		return fv.String()
+	}
+	return fmt.Sprint(fv.Interface())
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type fileConfig struct {
+	DatabaseURL string `env:"TEST_DATABASE_URL" required:"true"`
+	Secret      string `env:"TEST_SECRET" secret:"true" default:"fallback"`
+}
+
+func writeSecret(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFileVariantIsReadAndTrimmed(t *testing.T) {
+	// Load запишет значение в окружение; t.Setenv вернёт его после теста.
+	t.Setenv("TEST_DATABASE_URL", "")
+	t.Setenv("TEST_DATABASE_URL_FILE", writeSecret(t, "  postgres://u:pw@db/x\n"))
+	var cfg fileConfig
+	if err := Load(&cfg); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.DatabaseURL != "postgres://u:pw@db/x" {
+		t.Errorf("DatabaseURL = %q", cfg.DatabaseURL)
+	}
+	// Общие пакеты читают переменную из окружения сами.
+	if got := os.Getenv("TEST_DATABASE_URL"); got != cfg.DatabaseURL {
+		t.Errorf("TEST_DATABASE_URL in environment = %q", got)
+	}
+	// Повторная загрузка не считает экспортированное значение конфликтом.
+	if err := Load(&cfg); err != nil {
+		t.Errorf("second Load: %v", err)
+	}
+	for _, e := range Describe(&cfg) {
+		if e.Name == "TEST_DATABASE_URL" && (e.Default || e.File == "" || strings.Contains(e.Value, "pw")) {
+			t.Errorf("unexpected entry %+v", e)
+		}
+	}
+}
+
+func TestPlainAndFileVariantsConflict(t *testing.T) {
+	t.Setenv("TEST_DATABASE_URL", "postgres://db/plain")
+	t.Setenv("TEST_DATABASE_URL_FILE", writeSecret(t, "postgres://db/file"))
+	var cfg fileConfig
+	err := Load(&cfg)
+	if err == nil || !strings.Contains(err.Error(), "TEST_DATABASE_URL and TEST_DATABASE_URL_FILE are both set") {
+		t.Fatalf("Load error = %v", err)
+	}
+}
+
+func TestPlainVariableWithoutFile(t *testing.T) {
+	t.Setenv("TEST_DATABASE_URL", "postgres://db/plain")
+	t.Setenv("TEST_SECRET_FILE", "")
+	var cfg fileConfig
+	if err := Load(&cfg); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.DatabaseURL != "postgres://db/plain" || cfg.Secret != "fallback" {
+		t.Errorf("cfg = %+v", cfg)
+	}
+}
+
+func TestMissingFileIsReportedWithOtherErrors(t *testing.T) {
+	t.Setenv("TEST_DATABASE_URL", "")
+	t.Setenv("TEST_SECRET_FILE", filepath.Join(t.TempDir(), "missing"))
+	var cfg fileConfig
+	err := Load(&cfg)
+	errs, ok := err.(Errors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("Load error = %v", err)
+	}
+	if !strings.Contains(errs[0].Error(), "TEST_DATABASE_URL is required") {
+		t.Errorf("errs[0] = %v", errs[0])
+	}
+	if !strings.HasPrefix(errs[1].Error(), "TEST_SECRET_FILE: ") || !strings.Contains(errs[1].Error(), "no such file") {
+		t.Errorf("errs[1] = %v", errs[1])
+	}
+}
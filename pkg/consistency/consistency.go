@@ -0,0 +1,372 @@
+// Package consistency ищет записи, которые ссылаются на удалённые записи
+// другого сервиса: платежи и доставки несуществующих заказов, заказы
+// несуществующих пользователей. Каждый сервис владеет своей таблицей, и
+// удаление в одном сервисе не доходит до остальных.
+//
+// Проверка идёт по таблице страницами по BatchSize строк; ссылки страницы
+// проверяются одним запросом ?ids= к сервису-владельцу, запросы идут не
+// чаще раза в LookupInterval. Находки пишутся в inconsistencies: повторная
+// находка обновляет last_seen_at, а запись, которую полный проход больше не
+// нашёл, получает resolved_at. С Remediate запись-сирота помечается
+// orphaned_at; сама запись не удаляется.
+package consistency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"pkg/apierr"
+	"pkg/config"
+)
+
+// lockKey — ключ pg_advisory_lock: проверку ведёт одна реплика сервиса.
+const lockKey = 0x636f6e73 // "cons"
+
+// maxBatch — больше id ?ids= не принимает.
+const maxBatch = 100
+
+var ErrBusy = errors.New("consistency check already in progress")
+
+var found = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "consistency_inconsistencies_found_total",
+	Help: "Records found pointing at a missing record of another service, by type.",
+}, []string{"type"})
+
+var open = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "consistency_open_inconsistencies",
+	Help: "Unresolved inconsistencies after the last check, by type.",
+}, []string{"type"})
+
+// Lookup возвращает те из ids, для которых запись есть. ids — не больше
+// 100 различных значений.
+type Lookup func(ctx context.Context, ids []int) (map[int]bool, error)
+
+// Check — ссылки колонки Column таблицы Table на записи другого сервиса.
+// Where — необязательное условие отбора строк (например, без
+// удалённых). Table должна иметь колонки id и orphaned_at.
+type Check struct {
+	Type   string
+	Table  string
+	Column string
+	Where  string
+	Lookup Lookup
+}
+
+// Finding — запись inconsistencies.
+type Finding struct {
+	ID         int64      `json:"id"`
+	Type       string     `json:"type"`
+	RecordID   int        `json:"record_id"`
+	RefID      int        `json:"ref_id"`
+	DetectedAt time.Time  `json:"detected_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+}
+
+// CheckResult — итог одной проверки.
+type CheckResult struct {
+	Type     string `json:"type"`
+	Checked  int    `json:"checked"`
+	Found    int    `json:"found"`
+	Resolved int64  `json:"resolved"`
+	Flagged  int64  `json:"flagged"`
+}
+
+// Report — итог запуска.
+type Report struct {
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at"`
+	Remediate  bool          `json:"remediate"`
+	Checks     []CheckResult `json:"checks"`
+}
+
+type Checker struct {
+	db       *sql.DB
+	checks   []Check
+	batch    int
+	pause    time.Duration
+	interval time.Duration
+	flag     bool
+}
+
+func New(db *sql.DB, cfg config.Consistency, checks ...Check) *Checker {
+	return &Checker{
+		db:       db,
+		checks:   checks,
+		batch:    min(cfg.BatchSize, maxBatch),
+		pause:    cfg.LookupInterval,
+		interval: cfg.CheckInterval,
+		flag:     cfg.Remediate,
+	}
+}
+
+// Start запускает проверку раз в CONSISTENCY_CHECK_INTERVAL; 0 — только по
+// запросу.
+func (c *Checker) Start(ctx context.Context) {
+	if c.interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if _, err := c.Run(ctx); err != nil && !errors.Is(err, ErrBusy) && ctx.Err() == nil {
+				log.Printf("⚠️ Consistency check failed: %v", err)
+			}
+		}
+	}()
+	log.Printf("🔎 Consistency check started (every %s, remediate=%t)", c.interval, c.flag)
+}
+
+// Run выполняет все проверки. Сессионная advisory-блокировка держится на
+// выделенном соединении; пока идёт проверка, другие запуски получают
+// ErrBusy. Ошибка запроса к другому сервису прерывает проход: ни одна
+// запись не считается сиротой, пока её ссылка не проверена.
+func (c *Checker) Run(ctx context.Context) (Report, error) {
+	rep := Report{StartedAt: time.Now().UTC(), Remediate: c.flag, Checks: []CheckResult{}}
+
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return rep, err
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", lockKey).Scan(&locked); err != nil {
+		return rep, err
+	}
+	if !locked {
+		return rep, ErrBusy
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", lockKey)
+
+	lookups := 0
+	for _, ch := range c.checks {
+		res, err := c.runCheck(ctx, conn, ch, &lookups)
+		if err != nil {
+			return rep, err
+		}
+		rep.Checks = append(rep.Checks, res)
+		log.Printf("🔎 Consistency %s: %d checked, %d found, %d resolved, %d flagged", res.Type, res.Checked, res.Found, res.Resolved, res.Flagged)
+	}
+	rep.FinishedAt = time.Now().UTC()
+	return rep, nil
+}
+
+// ref — ссылка записи RecordID на RefID.
+type ref struct {
+	RecordID int
+	RefID    int
+}
+
+// orphans возвращает ссылки на записи, которых нет в exists.
+func orphans(refs []ref, exists map[int]bool) []ref {
+	var out []ref
+	for _, r := range refs {
+		if !exists[r.RefID] {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// distinctRefs — различные RefID страницы в порядке появления.
+func distinctRefs(refs []ref) []int {
+	seen := make(map[int]bool, len(refs))
+	var ids []int
+	for _, r := range refs {
+		if !seen[r.RefID] {
+			seen[r.RefID] = true
+			ids = append(ids, r.RefID)
+		}
+	}
+	return ids
+}
+
+func (c *Checker) runCheck(ctx context.Context, conn *sql.Conn, ch Check, lookups *int) (CheckResult, error) {
+	res := CheckResult{Type: ch.Type}
+	var startedAt time.Time
+	if err := conn.QueryRowContext(ctx, "SELECT NOW()").Scan(&startedAt); err != nil {
+		return res, err
+	}
+	where := ch.Column + " IS NOT NULL AND id > $1"
+	if ch.Where != "" {
+		where += " AND (" + ch.Where + ")"
+	}
+	page := "SELECT id, " + ch.Column + " FROM " + ch.Table + " WHERE " + where + " ORDER BY id LIMIT $2"
+
+	after := 0
+	for {
+		refs, err := loadRefs(ctx, conn, page, after, c.batch)
+		if err != nil {
+			return res, err
+		}
+		if len(refs) == 0 {
+			break
+		}
+		after = refs[len(refs)-1].RecordID
+		res.Checked += len(refs)
+
+		if *lookups > 0 && c.pause > 0 {
+			select {
+			case <-ctx.Done():
+				return res, ctx.Err()
+			case <-time.After(c.pause):
+			}
+		}
+		*lookups++
+		exists, err := ch.Lookup(ctx, distinctRefs(refs))
+		if err != nil {
+			return res, err
+		}
+
+		missing := orphans(refs, exists)
+		res.Found += len(missing)
+		found.WithLabelValues(ch.Type).Add(float64(len(missing)))
+		for _, m := range missing {
+			_, err := conn.ExecContext(ctx,
+				`INSERT INTO inconsistencies (type, record_id, ref_id) VALUES ($1, $2, $3)
+				 ON CONFLICT (type, record_id) DO UPDATE SET ref_id = EXCLUDED.ref_id, last_seen_at = NOW(), resolved_at = NULL`,
+				ch.Type, m.RecordID, m.RefID)
+			if err != nil {
+				return res, err
+			}
+		}
+		if c.flag && len(missing) > 0 {
+			ids := make([]int64, len(missing))
+			for i, m := range missing {
+				ids[i] = int64(m.RecordID)
+			}
+			r, err := conn.ExecContext(ctx, "UPDATE "+ch.Table+" SET orphaned_at = NOW() WHERE id = ANY($1) AND orphaned_at IS NULL", ids)
+			if err != nil {
+				return res, err
+			}
+			n, _ := r.RowsAffected()
+			res.Flagged += n
+		}
+	}
+
+	// Полный проход не нашёл запись — ссылка восстановлена или запись
+	// удалена.
+	r, err := conn.ExecContext(ctx,
+		"UPDATE inconsistencies SET resolved_at = NOW() WHERE type = $1 AND resolved_at IS NULL AND last_seen_at < $2",
+		ch.Type, startedAt)
+	if err != nil {
+		return res, err
+	}
+	res.Resolved, _ = r.RowsAffected()
+
+	var n int
+	if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM inconsistencies WHERE type = $1 AND resolved_at IS NULL", ch.Type).Scan(&n); err != nil {
+		return res, err
+	}
+	open.WithLabelValues(ch.Type).Set(float64(n))
+	return res, nil
+}
+
+func loadRefs(ctx context.Context, conn *sql.Conn, query string, after, limit int) ([]ref, error) {
+	rows, err := conn.QueryContext(ctx, query, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var refs []ref
+	for rows.Next() {
+		var r ref
+		if err := rows.Scan(&r.RecordID, &r.RefID); err != nil {
+			return nil, err
+		}
+		refs = append(refs, r)
+	}
+	return refs, rows.Err()
+}
+
+// RunHandler — POST /admin/inconsistencies/check: запустить проверку и
+// вернуть Report.
+func (c *Checker) RunHandler(w http.ResponseWriter, r *http.Request) {
+	rep, err := c.Run(r.Context())
+	if errors.Is(err, ErrBusy) {
+		apierr.Write(w, apierr.AlreadyRunning, err.Error())
+		return
+	}
+	if err != nil {
+		apierr.Respond(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rep)
+}
+
+// ListHandler — GET /admin/inconsistencies: находки, новые первыми.
+// Фильтры type, status (open — по умолчанию, resolved, all), страницы по
+// limit (до 500) и before_id.
+func (c *Checker) ListHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	where := "($1 = '' OR type = $1)"
+	switch q.Get("status") {
+	case "", "open":
+		where += " AND resolved_at IS NULL"
+	case "resolved":
+		where += " AND resolved_at IS NOT NULL"
+	case "all":
+	default:
+		apierr.Write(w, apierr.InvalidRequest, "status must be open, resolved or all")
+		return
+	}
+	var beforeID int64
+	if v := q.Get("before_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			apierr.Write(w, apierr.InvalidRequest, "before_id must be an integer")
+			return
+		}
+		beforeID = id
+		where += " AND id < $3"
+	}
+	limit := 100
+	if v, err := strconv.Atoi(q.Get("limit")); err == nil && v > 0 && v <= 500 {
+		limit = v
+	}
+
+	args := []interface{}{q.Get("type"), limit}
+	if beforeID > 0 {
+		args = append(args, beforeID)
+	}
+	rows, err := c.db.QueryContext(r.Context(),
+		"SELECT id, type, record_id, ref_id, detected_at, last_seen_at, resolved_at FROM inconsistencies WHERE "+where+" ORDER BY id DESC LIMIT $2",
+		args...)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	findings := []Finding{}
+	for rows.Next() {
+		var f Finding
+		if err := rows.Scan(&f.ID, &f.Type, &f.RecordID, &f.RefID, &f.DetectedAt, &f.LastSeenAt, &f.ResolvedAt); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		findings = append(findings, f)
+	}
+	if err := rows.Err(); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(findings)
+}
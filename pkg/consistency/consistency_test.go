@@ -0,0 +1,31 @@
+package consistency
+
+import (
+	"reflect"
+	"testing"
+
+	"pkg/config"
+)
+
+func TestOrphans(t *testing.T) {
+	refs := []ref{{1, 10}, {2, 11}, {3, 10}, {4, 12}}
+	if got := distinctRefs(refs); !reflect.DeepEqual(got, []int{10, 11, 12}) {
+		t.Errorf("distinctRefs = %v", got)
+	}
+	got := orphans(refs, map[int]bool{10: true})
+	if want := []ref{{2, 11}, {4, 12}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("orphans = %v, want %v", got, want)
+	}
+	if got := orphans(refs, map[int]bool{10: true, 11: true, 12: true}); got != nil {
+		t.Errorf("orphans = %v, want none", got)
+	}
+}
+
+func TestBatchCappedByLookupLimit(t *testing.T) {
+	if c := New(nil, config.Consistency{BatchSize: 500}); c.batch != maxBatch {
+		t.Errorf("batch = %d, want %d", c.batch, maxBatch)
+	}
+	if c := New(nil, config.Consistency{BatchSize: 20}); c.batch != 20 {
+		t.Errorf("batch = %d, want 20", c.batch)
+	}
+}
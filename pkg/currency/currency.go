@@ -0,0 +1,52 @@
+// Package currency — допустимые коды валют ISO 4217 и валюта по умолчанию.
+package currency
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// supported — валюты, которые принимают сервисы.
+var supported = map[string]bool{
+	"RUB": true,
+	"USD": true,
+	"EUR": true,
+	"GBP": true,
+	"CNY": true,
+	"KZT": true,
+	"BYN": true,
+}
+
+// Normalize приводит код к виду ISO 4217 (три заглавные буквы).
+func Normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Valid сообщает, поддерживается ли валюта.
+func Valid(code string) bool {
+	return supported[code]
+}
+
+// Supported — поддерживаемые валюты по алфавиту.
+func Supported() []string {
+	codes := make([]string, 0, len(supported))
+	for c := range supported {
+		codes = append(codes, c)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// DefaultFromEnv возвращает DEFAULT_CURRENCY (по умолчанию RUB).
+func DefaultFromEnv() (string, error) {
+	code := Normalize(os.Getenv("DEFAULT_CURRENCY"))
+	if code == "" {
+		return "RUB", nil
+	}
+	if !Valid(code) {
+		return "", fmt.Errorf("DEFAULT_CURRENCY %q is not a supported ISO 4217 code", code)
+	}
+	return code, nil
+}
@@ -0,0 +1,226 @@
+// Package dbhealth следит за соединением с Postgres во время работы. Если
+// несколько проверок подряд не прошли, реплика считается отрезанной от БД:
+// /ready отвечает 503 (балансировщик перестаёт слать на неё трафик),
+// запросы получают быстрый 503 database_unavailable вместо ошибки драйвера
+// после таймаута, а чтение по id, для которого есть кэш, продолжает
+// отвечать из кэша. Первая успешная проверка возвращает всё обратно.
+package dbhealth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"pkg/apierr"
+)
+
+var upGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "db_up",
+	Help: "Whether the database is reachable according to the watchdog.",
+})
+
+var downSinceGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "db_down_since_timestamp_seconds",
+	Help: "Unix time when the current database outage started, 0 if none.",
+})
+
+var outages = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "db_outages_total",
+	Help: "Database outages detected by the watchdog.",
+})
+
+var outageDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "db_outage_duration_seconds",
+	Help:    "Duration of database outages, observed on recovery.",
+	Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800},
+})
+
+var rejected = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "db_unavailable_rejected_requests_total",
+	Help: "Requests rejected with 503 while the database was unavailable.",
+})
+
+// Watchdog периодически проверяет БД (Ping с таймаутом) и хранит её
+// состояние.
+type Watchdog struct {
+	db        *sql.DB
+	interval  time.Duration
+	timeout   time.Duration
+	threshold int
+
+	mu         sync.RWMutex
+	failures   int
+	down       bool
+	downSince  time.Time
+	lastError  string
+	lastOutage time.Duration
+}
+
+// FromEnv создаёт Watchdog: DB_WATCHDOG_INTERVAL — период проверки (по
+// умолчанию 2s), DB_WATCHDOG_TIMEOUT — таймаут одной проверки (1s),
+// DB_WATCHDOG_FAILURES — сколько неудачных проверок подряд означают
+// потерю БД (3).
+func FromEnv(db *sql.DB) *Watchdog {
+	d := &Watchdog{db: db, interval: 2 * time.Second, timeout: time.Second, threshold: 3}
+	if v, err := time.ParseDuration(os.Getenv("DB_WATCHDOG_INTERVAL")); err == nil && v > 0 {
+		d.interval = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("DB_WATCHDOG_TIMEOUT")); err == nil && v > 0 {
+		d.timeout = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("DB_WATCHDOG_FAILURES")); err == nil && v > 0 {
+		d.threshold = v
+	}
+	upGauge.Set(1)
+	return d
+}
+
+// Start запускает проверки в фоне до отмены ctx.
+func (d *Watchdog) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			pingCtx, cancel := context.WithTimeout(ctx, d.timeout)
+			err := d.db.PingContext(pingCtx)
+			cancel()
+			if ctx.Err() == nil {
+				d.record(err)
+			}
+		}
+	}()
+}
+
+func (d *Watchdog) record(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err == nil {
+		d.failures = 0
+		d.lastError = ""
+		if d.down {
+			d.down = false
+			d.lastOutage = time.Since(d.downSince)
+			outageDuration.Observe(d.lastOutage.Seconds())
+			upGauge.Set(1)
+			downSinceGauge.Set(0)
+			log.Printf("✅ Database is reachable again after %s", d.lastOutage.Round(time.Second))
+		}
+		return
+	}
+
+	d.failures++
+	d.lastError = err.Error()
+	if !d.down && d.failures >= d.threshold {
+		d.down = true
+		// Отсчёт — с первой неудачной проверки, а не с момента решения.
+		d.downSince = time.Now().Add(-time.Duration(d.failures-1) * d.interval)
+		outages.Inc()
+		upGauge.Set(0)
+		downSinceGauge.Set(float64(d.downSince.Unix()))
+		log.Printf("🔥 Database unavailable after %d failed checks: %v", d.failures, err)
+	}
+}
+
+// Up — БД доступна (или потеря ещё не подтверждена).
+func (d *Watchdog) Up() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return !d.down
+}
+
+// Status — состояние БД для /health.
+type Status struct {
+	Status              string     `json:"status"` // up или down
+	DownSince           *time.Time `json:"down_since,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	// LastOutageSeconds — длительность последнего завершившегося сбоя.
+	LastOutageSeconds float64 `json:"last_outage_seconds,omitempty"`
+}
+
+func (d *Watchdog) Status() Status {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	s := Status{
+		Status:              "up",
+		ConsecutiveFailures: d.failures,
+		LastError:           d.lastError,
+		LastOutageSeconds:   math.Round(d.lastOutage.Seconds()*10) / 10,
+	}
+	if d.down {
+		since := d.downSince.UTC()
+		s.Status, s.DownSince = "down", &since
+	}
+	return s
+}
+
+// Unavailable отвечает 503 database_unavailable с Retry-After — для
+// обработчиков, которые не нашли ответ в кэше, пока БД недоступна.
+func (d *Watchdog) Unavailable(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.interval.Seconds()))))
+	apierr.Write(w, apierr.DatabaseUnavailable, "Database is unavailable")
+}
+
+// exempt — служебные маршруты работают без БД: по ним видно сбой, и через
+// них репликой можно управлять.
+func exempt(path string) bool {
+	return path == "/health" || path == "/ready" || path == "/health/ready" || path == "/metrics" || strings.HasPrefix(path, "/admin/")
+}
+
+// Middleware, пока БД недоступна, отвечает 503 database_unavailable на
+// всё, кроме служебных маршрутов и GET по шаблонам cached (например,
+// "/orders/{id}"): их обработчики отвечают из кэша, а при промахе сами
+// вызывают Unavailable. Подключается через router.Use.
+func (d *Watchdog) Middleware(cached ...string) mux.MiddlewareFunc {
+	fromCache := make(map[string]bool, len(cached))
+	for _, t := range cached {
+		fromCache[t] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if d.Up() || exempt(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.Method == http.MethodGet {
+				if route := mux.CurrentRoute(r); route != nil {
+					if t, err := route.GetPathTemplate(); err == nil && fromCache[t] {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+			rejected.Inc()
+			d.Unavailable(w)
+		})
+	}
+}
+
+// ReadyHandler — GET /ready для сервисов без собственной проверки
+// готовности: 200 {"status": "ready"}, пока БД доступна, иначе 503
+// {"status": "unready", "reason": "database"}.
+func (d *Watchdog) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !d.Up() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"status": "unready", "reason": "database"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ready"})
+}
@@ -0,0 +1,212 @@
+// Package deadletter хранит исходящие запросы, исчерпавшие повторы, и
+// позволяет переотправить их вручную. Заголовки (Idempotency-Key, подпись)
+// сохраняются как есть, чтобы получатель мог распознать дубликат.
+package deadletter
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"pkg/httpclient"
+)
+
+const (
+	StatusOpen     = "open"
+	StatusResolved = "resolved"
+)
+
+var (
+	ErrNotFound        = errors.New("dead letter not found")
+	ErrAlreadyResolved = errors.New("dead letter already resolved")
+)
+
+var recorded = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "dead_letters_recorded_total",
+	Help: "Outbound requests moved to dead-letter storage by source.",
+}, []string{"source"})
+
+var replays = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "dead_letter_replays_total",
+	Help: "Dead-letter replay attempts by result: resolved, failed.",
+}, []string{"result"})
+
+// Letter — запрос, который не удалось доставить.
+type Letter struct {
+	ID         int64             `json:"id"`
+	Source     string            `json:"source"`
+	Method     string            `json:"method"`
+	TargetURL  string            `json:"target_url"`
+	Headers    map[string]string `json:"headers"`
+	Payload    string            `json:"payload"`
+	Attempts   int               `json:"attempts"`
+	LastError  string            `json:"last_error"`
+	Status     string            `json:"status"`
+	CreatedAt  time.Time         `json:"created_at"`
+	ResolvedAt *time.Time        `json:"resolved_at"`
+}
+
+// Execer — *sql.DB или *sql.Tx.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Record сохраняет запрос в dead_letters. Внутри транзакции запись
+// появится вместе с остальными изменениями.
+func Record(ctx context.Context, ex Execer, l Letter) error {
+	if l.Method == "" {
+		l.Method = http.MethodPost
+	}
+	headers, err := json.Marshal(l.Headers)
+	if err != nil {
+		return err
+	}
+	_, err = ex.ExecContext(ctx,
+		`INSERT INTO dead_letters (source, method, target_url, headers, payload, attempts, last_error)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		l.Source, l.Method, l.TargetURL, headers, l.Payload, l.Attempts, l.LastError)
+	if err == nil {
+		recorded.WithLabelValues(l.Source).Inc()
+	}
+	return err
+}
+
+// Store читает и переотправляет записи через общий клиент с breaker и
+// повторами.
+type Store struct {
+	db     *sql.DB
+	client *httpclient.Client
+}
+
+func NewStore(db *sql.DB, client *httpclient.Client) *Store {
+	return &Store{db: db, client: client}
+}
+
+const columns = "id, source, method, target_url, headers, payload, attempts, last_error, status, created_at, resolved_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scan(row rowScanner) (Letter, error) {
+	var l Letter
+	var headers []byte
+	var lastError sql.NullString
+	var resolvedAt sql.NullTime
+	err := row.Scan(&l.ID, &l.Source, &l.Method, &l.TargetURL, &headers, &l.Payload,
+		&l.Attempts, &lastError, &l.Status, &l.CreatedAt, &resolvedAt)
+	if err != nil {
+		return l, err
+	}
+	if len(headers) > 0 {
+		if err := json.Unmarshal(headers, &l.Headers); err != nil {
+			return l, err
+		}
+	}
+	l.LastError = lastError.String
+	if resolvedAt.Valid {
+		l.ResolvedAt = &resolvedAt.Time
+	}
+	return l, nil
+}
+
+// List возвращает записи, новые первыми. Пустой status — все записи.
+func (s *Store) List(ctx context.Context, status string, limit int) ([]Letter, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+columns+" FROM dead_letters WHERE ($1 = '' OR status = $1) ORDER BY id DESC LIMIT $2",
+		status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	letters := []Letter{}
+	for rows.Next() {
+		l, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, l)
+	}
+	return letters, rows.Err()
+}
+
+// Replay переотправляет запись с исходными заголовками. При ответе 2xx
+// запись помечается resolved; иначе увеличивается attempts и сохраняется
+// ошибка, а сама ошибка возвращается вместе с обновлённой записью.
+// Запись блокируется на время отправки, поэтому параллельный replay
+// одной записи не отправит её дважды.
+func (s *Store) Replay(ctx context.Context, id int64) (Letter, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Letter{}, err
+	}
+	defer tx.Rollback()
+
+	l, err := scan(tx.QueryRowContext(ctx, "SELECT "+columns+" FROM dead_letters WHERE id = $1 FOR UPDATE", id))
+	if err == sql.ErrNoRows {
+		return l, ErrNotFound
+	} else if err != nil {
+		return l, err
+	}
+	if l.Status == StatusResolved {
+		return l, ErrAlreadyResolved
+	}
+
+	sendErr := s.send(ctx, l)
+	l.Attempts++
+	if sendErr == nil {
+		now := time.Now()
+		l.Status = StatusResolved
+		l.ResolvedAt = &now
+		_, err = tx.ExecContext(ctx,
+			"UPDATE dead_letters SET attempts = $1, status = $2, resolved_at = $3 WHERE id = $4",
+			l.Attempts, l.Status, now, l.ID)
+		replays.WithLabelValues("resolved").Inc()
+	} else {
+		l.LastError = sendErr.Error()
+		_, err = tx.ExecContext(ctx,
+			"UPDATE dead_letters SET attempts = $1, last_error = $2 WHERE id = $3",
+			l.Attempts, l.LastError, l.ID)
+		replays.WithLabelValues("failed").Inc()
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		return l, err
+	}
+	return l, sendErr
+}
+
+func (s *Store) send(ctx context.Context, l Letter) error {
+	u, err := url.Parse(l.TargetURL)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, l.Method, l.TargetURL, strings.NewReader(l.Payload))
+	if err != nil {
+		return err
+	}
+	for k, v := range l.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(u.Host, req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("replay rejected with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+// Package dedup делает обработку событий идемпотентной: id события
+// записывается в processed_events в той же транзакции, что и побочный
+// эффект, поэтому повторная доставка превращается в no-op.
+package dedup
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var duplicates = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "processed_events_duplicates_total",
+	Help: "Events skipped because they were already processed, by source.",
+}, []string{"source"})
+
+var pruned = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "processed_events_pruned_total",
+	Help: "Processed-event records removed by the retention job.",
+})
+
+// Claim отмечает событие обработанным. false означает, что событие уже
+// было обработано и побочный эффект выполнять не нужно. Если транзакция
+// откатится, отметка откатится вместе с ней. Параллельный Claim того же
+// события ждёт коммита первой транзакции.
+func Claim(ctx context.Context, tx *sql.Tx, source, eventID string) (bool, error) {
+	res, err := tx.ExecContext(ctx,
+		"INSERT INTO processed_events (source, event_id) VALUES ($1, $2) ON CONFLICT (source, event_id) DO NOTHING",
+		source, eventID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		duplicates.WithLabelValues(source).Inc()
+		return false, nil
+	}
+	return true, nil
+}
+
+// StartPruner периодически удаляет записи старше PROCESSED_EVENTS_RETENTION
+// (по умолчанию 7 дней). Окно должно превышать максимальный срок, в течение
+// которого отправитель может повторить событие.
+func StartPruner(ctx context.Context, db *sql.DB) {
+	retention := 7 * 24 * time.Hour
+	if v, err := time.ParseDuration(os.Getenv("PROCESSED_EVENTS_RETENTION")); err == nil && v > 0 {
+		retention = v
+	}
+	interval := time.Hour
+	if v, err := time.ParseDuration(os.Getenv("PROCESSED_EVENTS_PRUNE_INTERVAL")); err == nil && v > 0 {
+		interval = v
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if n, err := Prune(ctx, db, retention); err != nil && ctx.Err() == nil {
+				log.Printf("⚠️ processed_events prune failed: %v", err)
+			} else if n > 0 {
+				log.Printf("🧹 Pruned %d processed events older than %s", n, retention)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Prune удаляет записи старше retention и возвращает их количество.
+func Prune(ctx context.Context, db *sql.DB, retention time.Duration) (int64, error) {
+	res, err := db.ExecContext(ctx,
+		"DELETE FROM processed_events WHERE processed_at < NOW() - make_interval(secs => $1)",
+		retention.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err == nil {
+		pruned.Add(float64(n))
+	}
+	return n, err
+}
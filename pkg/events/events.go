@@ -0,0 +1,70 @@
+// Package events — формат событий, которыми обмениваются сервисы.
+package events
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	OrderPlaced    = "order.placed"
+	OrderConfirmed = "order.confirmed"
+	// OrderForceDeleted — заказ удалён с force=true, несмотря на активные
+	// платежи или доставки; получатели помечают свои записи.
+	OrderForceDeleted = "order.force_deleted"
+
+	DeliveryAssigned  = "delivery.assigned"
+	DeliveryDelivered = "delivery.delivered"
+	DeliveryFailed    = "delivery.failed"
+)
+
+// Envelope — конверт события. EventID уникален и служит ключом
+// идемпотентности у получателя.
+type Envelope struct {
+	EventID    string          `json:"event_id"`
+	EventType  string          `json:"event_type"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// OrderPayload — полезная нагрузка событий order.*.
+//
+// У подарка (IsGift) сумма и валюта при сериализации опускаются: получатель
+// подарка не должен видеть, сколько за него заплатили. Показать их можно
+// только явно, через WithPrice, — для сообщений самому покупателю.
+type OrderPayload struct {
+	OrderID         int     `json:"order_id"`
+	UserID          int     `json:"user_id"`
+	TotalAmount     float64 `json:"total_amount"`
+	Currency        string  `json:"currency"`
+	Status          string  `json:"status"`
+	ShippingAddress string  `json:"shipping_address"`
+	// AgeRestricted — получателю нужна проверка возраста при вручении.
+	AgeRestricted bool `json:"age_restricted,omitempty"`
+	// IsGift и GiftMessage — заказ-подарок и поздравление для этикетки.
+	IsGift      bool   `json:"is_gift,omitempty"`
+	GiftMessage string `json:"gift_message,omitempty"`
+
+	showPrice bool
+}
+
+// WithPrice возвращает копию, в которой сумма подарка сериализуется.
+func (p OrderPayload) WithPrice() OrderPayload {
+	p.showPrice = true
+	return p
+}
+
+// MarshalJSON скрывает total_amount и currency подарка, если не вызван
+// WithPrice.
+func (p OrderPayload) MarshalJSON() ([]byte, error) {
+	type plain OrderPayload
+	if !p.IsGift || p.showPrice {
+		return json.Marshal(plain(p))
+	}
+	// Поля внешней структуры перекрывают одноимённые поля plain.
+	return json.Marshal(struct {
+		plain
+		TotalAmount *float64 `json:"total_amount,omitempty"`
+		Currency    string   `json:"currency,omitempty"`
+	}{plain: plain(p)})
+}
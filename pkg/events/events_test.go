@@ -0,0 +1,38 @@
+package events
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestGiftPriceMasked(t *testing.T) {
+	p := OrderPayload{OrderID: 1, TotalAmount: 1500, Currency: "RUB", IsGift: true, GiftMessage: "С днём рождения!"}
+
+	masked, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(masked), "total_amount") || strings.Contains(string(masked), "currency") {
+		t.Errorf("gift payload leaks the price: %s", masked)
+	}
+	// Вложенная в другую структуру нагрузка маскируется так же.
+	nested, _ := json.Marshal(map[string]interface{}{"payload": p})
+	if strings.Contains(string(nested), "1500") {
+		t.Errorf("nested gift payload leaks the price: %s", nested)
+	}
+
+	var back OrderPayload
+	if err := json.Unmarshal(masked, &back); err != nil || back.GiftMessage != p.GiftMessage || back.TotalAmount != 0 {
+		t.Errorf("decoded %+v, %v", back, err)
+	}
+
+	shown, _ := json.Marshal(p.WithPrice())
+	if !strings.Contains(string(shown), `"total_amount":1500`) {
+		t.Errorf("WithPrice payload: %s", shown)
+	}
+	plain, _ := json.Marshal(OrderPayload{OrderID: 2, TotalAmount: 10})
+	if !strings.Contains(string(plain), `"total_amount":10`) {
+		t.Errorf("non-gift payload: %s", plain)
+	}
+}
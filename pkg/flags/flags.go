@@ -0,0 +1,240 @@
+// Package flags — feature flags для постепенного включения поведения.
+//
+// Флаги читаются из JSON-файла FEATURE_FLAGS_FILE и переменных окружения
+// FLAG_<NAME> (имеют приоритет над файлом). Значение флага — true/false
+// или процент раскатки: в файле {"rollout": 25}, в окружении "25%".
+// Файл перечитывается при изменении и по SIGHUP.
+package flags
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const envPrefix = "FLAG_"
+
+// Flag — значение одного флага. Rollout в процентах (0–100) задаёт долю
+// пользователей, для которых флаг включён; nil — флаг не раскатывается
+// по пользователям и определяется только Enabled.
+type Flag struct {
+	Enabled bool   `json:"enabled"`
+	Rollout *int   `json:"rollout,omitempty"`
+	Source  string `json:"source"`
+}
+
+func (f *Flag) UnmarshalJSON(b []byte) error {
+	var on bool
+	if err := json.Unmarshal(b, &on); err == nil {
+		f.Enabled = on
+		return nil
+	}
+	var v struct {
+		Enabled *bool `json:"enabled"`
+		Rollout *int  `json:"rollout"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return fmt.Errorf("flag must be a bool or {\"rollout\": n}: %w", err)
+	}
+	if v.Rollout != nil && (*v.Rollout < 0 || *v.Rollout > 100) {
+		return fmt.Errorf("rollout %d out of range 0-100", *v.Rollout)
+	}
+	f.Rollout = v.Rollout
+	f.Enabled = v.Enabled == nil || *v.Enabled
+	return nil
+}
+
+// Set — текущий набор флагов. Безопасен для параллельного чтения во время
+// перезагрузки.
+type Set struct {
+	file string
+
+	mu      sync.RWMutex
+	flags   map[string]Flag
+	modTime time.Time
+}
+
+// FromEnv загружает флаги. Ошибка разбора при старте фатальна; при
+// перезагрузке остаётся прежний набор.
+func FromEnv() (*Set, error) {
+	s := &Set{file: os.Getenv("FEATURE_FLAGS_FILE")}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload перечитывает файл и переменные окружения.
+func (s *Set) Reload() error {
+	flags := make(map[string]Flag)
+	var modTime time.Time
+
+	if s.file != "" {
+		st, err := os.Stat(s.file)
+		if err != nil {
+			return err
+		}
+		modTime = st.ModTime()
+		data, err := os.ReadFile(s.file)
+		if err != nil {
+			return err
+		}
+		var fromFile map[string]Flag
+		if err := json.Unmarshal(data, &fromFile); err != nil {
+			return fmt.Errorf("%s: %w", s.file, err)
+		}
+		for name, f := range fromFile {
+			f.Source = "file"
+			flags[name] = f
+		}
+	}
+
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(k, envPrefix) {
+			continue
+		}
+		f, err := parseEnv(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		flags[strings.ToLower(strings.TrimPrefix(k, envPrefix))] = f
+	}
+
+	s.mu.Lock()
+	s.flags = flags
+	s.modTime = modTime
+	s.mu.Unlock()
+	return nil
+}
+
+func parseEnv(v string) (Flag, error) {
+	f := Flag{Source: "env"}
+	if p, ok := strings.CutSuffix(v, "%"); ok {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || n > 100 {
+			return f, fmt.Errorf("invalid rollout %q", v)
+		}
+		f.Enabled = true
+		f.Rollout = &n
+		return f, nil
+	}
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		return f, fmt.Errorf("expected bool or percentage, got %q", v)
+	}
+	f.Enabled = on
+	return f, nil
+}
+
+// Watch перезагружает флаги по SIGHUP и при изменении файла (проверка
+// раз в FEATURE_FLAGS_POLL_INTERVAL, по умолчанию 5s).
+func (s *Set) Watch() {
+	interval := 5 * time.Second
+	if v, err := time.ParseDuration(os.Getenv("FEATURE_FLAGS_POLL_INTERVAL")); err == nil && v > 0 {
+		interval = v
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-hup:
+			case <-ticker.C:
+				if !s.fileChanged() {
+					continue
+				}
+			}
+			if err := s.Reload(); err != nil {
+				log.Printf("⚠️ Feature flags reload failed, keeping previous values: %v", err)
+				continue
+			}
+			log.Printf("🚩 Feature flags reloaded")
+		}
+	}()
+}
+
+func (s *Set) fileChanged() bool {
+	if s.file == "" {
+		return false
+	}
+	st, err := os.Stat(s.file)
+	if err != nil {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return !st.ModTime().Equal(s.modTime)
+}
+
+func (s *Set) get(name string) (Flag, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	f, ok := s.flags[name]
+	return f, ok
+}
+
+// Bool — включён ли флаг целиком. Флаг с неполной раскаткой считается
+// выключенным; def возвращается, если флаг не задан.
+func (s *Set) Bool(name string, def bool) bool {
+	f, ok := s.get(name)
+	if !ok {
+		return def
+	}
+	if f.Rollout != nil {
+		return f.Enabled && *f.Rollout >= 100
+	}
+	return f.Enabled
+}
+
+// EnabledFor — включён ли флаг для конкретного пользователя. Решение
+// детерминировано: пользователь попадает в раскатку по хешу имени флага
+// и его id, поэтому при увеличении процента уже включённые пользователи
+// остаются включёнными.
+func (s *Set) EnabledFor(name, userKey string, def bool) bool {
+	f, ok := s.get(name)
+	if !ok {
+		return def
+	}
+	if !f.Enabled {
+		return false
+	}
+	if f.Rollout == nil {
+		return true
+	}
+	return bucket(name, userKey) < *f.Rollout
+}
+
+// bucket возвращает число 0–99 для пары флаг/пользователь.
+func bucket(name, userKey string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(userKey))
+	return int(h.Sum32() % 100)
+}
+
+// Handler — GET /admin/flags: действующие значения и их источник.
+func (s *Set) Handler(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	out := make(map[string]Flag, len(s.flags))
+	for name, f := range s.flags {
+		out[name] = f
+	}
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
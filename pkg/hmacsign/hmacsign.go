@@ -0,0 +1,224 @@
+// Package hmacsign подписывает межсервисные изменяющие запросы общим
+// секретом — для окружений, где нет mTLS.
+//
+// Заголовок X-Signature: t=<unix>,kid=<id ключа>,v1=<hex>, где v1 —
+// HMAC-SHA256 от строки "<t>\n<METHOD>\n<path>\n<hex sha256(body)>".
+// Ключи задаются как "kid:secret"; у каждого вызывающего сервиса свой kid,
+// получатель может принимать несколько ключей одновременно (ротация).
+package hmacsign
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg/apierr"
+)
+
+const Header = "X-Signature"
+
+// DefaultMaxSkew — допустимое расхождение часов отправителя и получателя.
+const DefaultMaxSkew = 5 * time.Minute
+
+const maxBody = 10 << 20
+
+var (
+	ErrMissing    = errors.New("missing signature")
+	ErrMalformed  = errors.New("malformed signature header")
+	ErrUnknownKey = errors.New("unknown signing key")
+	ErrStale      = errors.New("signature timestamp outside allowed skew")
+	ErrMismatch   = errors.New("signature mismatch")
+)
+
+// ParseKeys разбирает список "kid:secret,kid2:secret2".
+func ParseKeys(s string) (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kid, secret, ok := strings.Cut(part, ":")
+		if !ok || kid == "" || secret == "" {
+			return nil, fmt.Errorf("invalid signing key %q: expected kid:secret", kid)
+		}
+		keys[kid] = []byte(secret)
+	}
+	return keys, nil
+}
+
+// Compute возвращает подпись v1 для запроса.
+func Compute(secret []byte, ts int64, method, path string, body []byte) string {
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%d\n%s\n%s\n%s", ts, method, path, hex.EncodeToString(sum[:]))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Signer подписывает исходящие запросы одним ключом.
+type Signer struct {
+	kid    string
+	secret []byte
+	now    func() time.Time
+}
+
+// SignerFromEnv читает HMAC_SIGNING_KEY ("kid:secret"). Возвращает nil,
+// если подпись не настроена.
+func SignerFromEnv() (*Signer, error) {
+	v := os.Getenv("HMAC_SIGNING_KEY")
+	if v == "" {
+		return nil, nil
+	}
+	keys, err := ParseKeys(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) != 1 {
+		return nil, errors.New("HMAC_SIGNING_KEY must contain exactly one kid:secret pair")
+	}
+	for kid, secret := range keys {
+		return &Signer{kid: kid, secret: secret, now: time.Now}, nil
+	}
+	return nil, nil
+}
+
+// Sign добавляет заголовок подписи к POST/PUT/PATCH/DELETE; остальные
+// запросы не меняются. Nil *Signer ничего не делает. Тело запроса должно
+// быть перечитываемым (GetBody), чтобы его можно было отправить после
+// хеширования.
+func (s *Signer) Sign(req *http.Request) error {
+	if s == nil || !isMutation(req.Method) {
+		return nil
+	}
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return errors.New("hmacsign: request body is not replayable")
+		}
+		rc, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		body, err = io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	ts := s.now().Unix()
+	sig := Compute(s.secret, ts, req.Method, req.URL.EscapedPath(), body)
+	req.Header.Set(Header, fmt.Sprintf("t=%d,kid=%s,v1=%s", ts, s.kid, sig))
+	return nil
+}
+
+// Verifier проверяет подписи входящих запросов.
+type Verifier struct {
+	keys    map[string][]byte
+	maxSkew time.Duration
+	now     func() time.Time
+}
+
+// VerifierFromEnv читает HMAC_VERIFY_KEYS ("kid:secret,...") и
+// HMAC_MAX_SKEW. Возвращает nil, если проверка не настроена.
+func VerifierFromEnv() (*Verifier, error) {
+	v := os.Getenv("HMAC_VERIFY_KEYS")
+	if v == "" {
+		return nil, nil
+	}
+	keys, err := ParseKeys(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("HMAC_VERIFY_KEYS contains no keys")
+	}
+	skew := DefaultMaxSkew
+	if d, err := time.ParseDuration(os.Getenv("HMAC_MAX_SKEW")); err == nil && d > 0 {
+		skew = d
+	}
+	return &Verifier{keys: keys, maxSkew: skew, now: time.Now}, nil
+}
+
+// Verify проверяет подпись запроса с уже прочитанным телом.
+func (v *Verifier) Verify(header, method, path string, body []byte) error {
+	if header == "" {
+		return ErrMissing
+	}
+	var ts int64
+	var kid, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, val, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return ErrMalformed
+		}
+		switch k {
+		case "t":
+			n, err := strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				return ErrMalformed
+			}
+			ts = n
+		case "kid":
+			kid = val
+		case "v1":
+			sig = val
+		}
+	}
+	if ts == 0 || kid == "" || sig == "" {
+		return ErrMalformed
+	}
+
+	secret, ok := v.keys[kid]
+	if !ok {
+		return ErrUnknownKey
+	}
+	skew := v.now().Sub(time.Unix(ts, 0))
+	if skew > v.maxSkew || skew < -v.maxSkew {
+		return ErrStale
+	}
+	want := Compute(secret, ts, method, path, body)
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		return ErrMismatch
+	}
+	return nil
+}
+
+// Require пропускает только запросы с верной подписью и отвечает 401 на
+// остальные. Без настроенных ключей (nil *Verifier) маршрут не
+// ограничивается.
+func (v *Verifier) Require(next http.HandlerFunc) http.HandlerFunc {
+	if v == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+		if err != nil {
+			apierr.Write(w, apierr.PayloadTooLarge, err.Error())
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if err := v.Verify(r.Header.Get(Header), r.Method, r.URL.EscapedPath(), body); err != nil {
+			apierr.Write(w, apierr.InvalidSignature, "Invalid request signature: "+err.Error())
+			return
+		}
+		next(w, r)
+	}
+}
+
+func isMutation(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package hmacsign
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Векторы посчитаны независимо от Compute (Python hmac/hashlib) по схеме
+// из описания пакета.
+var vectors = []struct {
+	secret string
+	ts     int64
+	method string
+	path   string
+	body   string
+	want   string
+}{
+	{"secret", 1700000000, "POST", "/events/orders", `{"event_id":"e1"}`,
+		"2f303fcf30043b44cfb846900798aeaf5cb026e01877d7d6f0580e7e46db921a"},
+	{"rotated-key", 1700000300, "DELETE", "/orders/42", "",
+		"ec886327e5056d404e0b109f92ec94f513908733decfbf227fc433af9f4c0359"},
+	{"secret", 1700000000, "PUT", "/payments/7%2F8", `{"status":"completed"}`,
+		"d1d6274619567a9ccdac4831a679dcc84b9f33a88d4b6a41bcb8318593d59668"},
+}
+
+func TestComputeVectors(t *testing.T) {
+	for _, v := range vectors {
+		if got := Compute([]byte(v.secret), v.ts, v.method, v.path, []byte(v.body)); got != v.want {
+			t.Errorf("%s %s: got %s, want %s", v.method, v.path, got, v.want)
+		}
+	}
+}
+
+func TestSignProducesVectorHeader(t *testing.T) {
+	v := vectors[0]
+	s := &Signer{kid: "orders", secret: []byte(v.secret), now: func() time.Time { return time.Unix(v.ts, 0) }}
+	req, _ := http.NewRequest(v.method, "http://delivery-service:8004"+v.path, strings.NewReader(v.body))
+	if err := s.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	want := "t=1700000000,kid=orders,v1=" + v.want
+	if got := req.Header.Get(Header); got != want {
+		t.Fatalf("header %q, want %q", got, want)
+	}
+
+	get, _ := http.NewRequest(http.MethodGet, "http://delivery-service:8004/deliveries", nil)
+	if err := s.Sign(get); err != nil || get.Header.Get(Header) != "" {
+		t.Fatalf("GET signed: %q, %v", get.Header.Get(Header), err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	v := &Verifier{
+		keys:    map[string][]byte{"orders": []byte("secret"), "orders-next": []byte("rotated-key")},
+		maxSkew: DefaultMaxSkew,
+		now:     func() time.Time { return now },
+	}
+	sig := func(kid string, ts int64, want string) string {
+		return "t=" + strconv.FormatInt(ts, 10) + ",kid=" + kid + ",v1=" + want
+	}
+	good := vectors[0]
+
+	cases := []struct {
+		name   string
+		header string
+		method string
+		path   string
+		body   string
+		want   error
+	}{
+		{"valid", sig("orders", good.ts, good.want), good.method, good.path, good.body, nil},
+		{"second key during rotation", sig("orders-next", vectors[1].ts, vectors[1].want), vectors[1].method, vectors[1].path, "", nil},
+		{"tampered body", sig("orders", good.ts, good.want), good.method, good.path, `{"event_id":"e2"}`, ErrMismatch},
+		{"tampered path", sig("orders", good.ts, good.want), good.method, "/events/payments", good.body, ErrMismatch},
+		{"tampered method", sig("orders", good.ts, good.want), "PUT", good.path, good.body, ErrMismatch},
+		{"wrong key for kid", sig("orders-next", good.ts, good.want), good.method, good.path, good.body, ErrMismatch},
+		{"unknown kid", sig("users", good.ts, good.want), good.method, good.path, good.body, ErrUnknownKey},
+		{"missing", "", good.method, good.path, good.body, ErrMissing},
+		{"malformed", "t=abc,kid=orders,v1=00", good.method, good.path, good.body, ErrMalformed},
+		{"no signature", "t=1700000000,kid=orders", good.method, good.path, good.body, ErrMalformed},
+	}
+	for _, c := range cases {
+		if err := v.Verify(c.header, c.method, c.path, []byte(c.body)); !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+}
+
+func TestVerifyRejectsStaleTimestamps(t *testing.T) {
+	const ts = 1700000000
+	header := "t=1700000000,kid=orders,v1=" + vectors[0].want
+	for _, c := range []struct {
+		offset time.Duration
+		want   error
+	}{
+		{DefaultMaxSkew, nil},
+		{-DefaultMaxSkew, nil},
+		{DefaultMaxSkew + time.Second, ErrStale},
+		{-DefaultMaxSkew - time.Second, ErrStale},
+	} {
+		v := &Verifier{
+			keys:    map[string][]byte{"orders": []byte("secret")},
+			maxSkew: DefaultMaxSkew,
+			now:     func() time.Time { return time.Unix(ts, 0).Add(c.offset) },
+		}
+		err := v.Verify(header, vectors[0].method, vectors[0].path, []byte(vectors[0].body))
+		if !errors.Is(err, c.want) {
+			t.Errorf("receiver clock %+v: got %v, want %v", c.offset, err, c.want)
+		}
+	}
+}
+
+func TestRequireAnswers401(t *testing.T) {
+	v := &Verifier{keys: map[string][]byte{"orders": []byte("secret")}, maxSkew: DefaultMaxSkew, now: func() time.Time { return time.Unix(1700000000, 0) }}
+	var called bool
+	h := v.Require(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+	for _, c := range []struct {
+		body string
+		want int
+	}{
+		{vectors[0].body, http.StatusOK},
+		{`{"event_id":"forged"}`, http.StatusUnauthorized},
+	} {
+		called = false
+		req := httptest.NewRequest(http.MethodPost, vectors[0].path, strings.NewReader(c.body))
+		req.Header.Set(Header, "t=1700000000,kid=orders,v1="+vectors[0].want)
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != c.want || called != (c.want == http.StatusOK) {
+			t.Errorf("body %s: status %d, handler called %v; want %d", c.body, rec.Code, called, c.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package httpclient
+
+import (
+	"sync"
+	"time"
+)
+
+// State — состояние circuit breaker.
+type State int
+
+const (
+	StateClosed State = iota
+	StateHalfOpen
+	StateOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	}
+	return "unknown"
+}
+
+// BreakerConfig задаёт пороги переключения breaker.
+type BreakerConfig struct {
+	FailureThreshold int           // подряд идущих ошибок до перехода в open
+	OpenDuration     time.Duration // сколько breaker остаётся open до пробных запросов
+	HalfOpenProbes   int           // сколько успешных пробных запросов нужно для закрытия
+}
+
+// Breaker — circuit breaker для одного целевого сервиса.
+type Breaker struct {
+	cfg      BreakerConfig
+	now      func() time.Time
+	onChange func(State)
+
+	mu        sync.Mutex
+	state     State
+	failures  int
+	successes int
+	inFlight  int
+	openedAt  time.Time
+}
+
+func NewBreaker(cfg BreakerConfig) *Breaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.OpenDuration <= 0 {
+		cfg.OpenDuration = 30 * time.Second
+	}
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = 1
+	}
+	return &Breaker{cfg: cfg, now: time.Now}
+}
+
+// State возвращает текущее состояние с учётом истечения OpenDuration.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	return b.state
+}
+
+// Allow сообщает, можно ли выполнить запрос. Каждый разрешённый вызов
+// должен завершаться вызовом Done.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+
+	switch b.state {
+	case StateOpen:
+		return false
+	case StateHalfOpen:
+		if b.inFlight >= b.cfg.HalfOpenProbes {
+			return false
+		}
+	}
+	b.inFlight++
+	return true
+}
+
+// Done фиксирует результат запроса, разрешённого Allow.
+func (b *Breaker) Done(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.inFlight > 0 {
+		b.inFlight--
+	}
+
+	switch b.state {
+	case StateClosed:
+		if success {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.cfg.FailureThreshold {
+			b.setState(StateOpen)
+		}
+	case StateHalfOpen:
+		if !success {
+			b.setState(StateOpen)
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenProbes {
+			b.setState(StateClosed)
+		}
+	}
+}
+
+// Release освобождает слот, разрешённый Allow, не засчитывая результат:
+// запрос отменил сам вызывающий, о здоровье сервиса это ничего не говорит.
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.inFlight > 0 {
+		b.inFlight--
+	}
+}
+
+func (b *Breaker) advance() {
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.cfg.OpenDuration {
+		b.setState(StateHalfOpen)
+	}
+}
+
+func (b *Breaker) setState(s State) {
+	b.state = s
+	b.failures = 0
+	b.successes = 0
+	if s == StateOpen {
+		b.openedAt = b.now()
+	}
+	if b.onChange != nil {
+		b.onChange(s)
+	}
+}
@@ -0,0 +1,176 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeClock — время, которое двигает только тест.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.t }
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// gaugeValue читает inter_service_breaker_state для target из реестра.
+func gaugeValue(t *testing.T, target string) float64 {
+	t.Helper()
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != "inter_service_breaker_state" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "target" && l.GetValue() == target {
+					return m.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	t.Fatalf("no inter_service_breaker_state for %s", target)
+	return 0
+}
+
+func TestBreakerCycle(t *testing.T) {
+	var failing atomic.Bool
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	const target = "breaker-cycle-test"
+	c := New(Config{Breaker: BreakerConfig{FailureThreshold: 3, OpenDuration: 10 * time.Second, HalfOpenProbes: 1}}, target)
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	b := c.breaker(target)
+	b.now = clock.Now
+
+	call := func() error {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, nil)
+		resp, err := c.Do(target, req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	expect := func(step string, want State) {
+		t.Helper()
+		if got := b.State(); got != want {
+			t.Fatalf("%s: state %s, want %s", step, got, want)
+		}
+		if got := gaugeValue(t, target); got != float64(want) {
+			t.Fatalf("%s: gauge %v, want %v", step, got, float64(want))
+		}
+	}
+
+	expect("new", StateClosed)
+
+	// closed → open после FailureThreshold ошибок подряд.
+	failing.Store(true)
+	for i := 0; i < 2; i++ {
+		if err := call(); !errors.Is(err, ErrDependencyUnavailable) {
+			t.Fatalf("failure %d: err %v, want ErrDependencyUnavailable", i+1, err)
+		}
+	}
+	expect("below threshold", StateClosed)
+	call()
+	expect("at threshold", StateOpen)
+
+	// open: запросы не доходят до сервиса.
+	before := hits.Load()
+	if err := call(); !errors.Is(err, ErrDependencyUnavailable) {
+		t.Fatalf("open: err %v, want ErrDependencyUnavailable", err)
+	}
+	if hits.Load() != before {
+		t.Fatal("open breaker let a request through")
+	}
+
+	// open → half-open по истечении OpenDuration.
+	clock.Advance(9 * time.Second)
+	expect("before OpenDuration", StateOpen)
+	clock.Advance(time.Second)
+	expect("after OpenDuration", StateHalfOpen)
+
+	// half-open → open при неудачной пробе.
+	call()
+	expect("failed probe", StateOpen)
+
+	// half-open → closed при удачной пробе.
+	clock.Advance(10 * time.Second)
+	expect("second half-open", StateHalfOpen)
+	failing.Store(false)
+	if err := call(); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	expect("successful probe", StateClosed)
+}
+
+// В half-open одновременно пропускается не больше HalfOpenProbes запросов.
+func TestBreakerHalfOpenLimitsProbes(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	b := NewBreaker(BreakerConfig{FailureThreshold: 1, OpenDuration: time.Second, HalfOpenProbes: 2})
+	b.now = clock.Now
+
+	if !b.Allow() {
+		t.Fatal("closed breaker refused a request")
+	}
+	b.Done(false)
+	clock.Advance(time.Second)
+
+	if !b.Allow() || !b.Allow() {
+		t.Fatal("half-open breaker refused a probe")
+	}
+	if b.Allow() {
+		t.Fatal("half-open breaker allowed more than HalfOpenProbes probes")
+	}
+	b.Done(true)
+	if got := b.State(); got != StateHalfOpen {
+		t.Fatalf("after one of two probes: state %s, want half-open", got)
+	}
+	b.Done(true)
+	if got := b.State(); got != StateClosed {
+		t.Fatalf("after both probes: state %s, want closed", got)
+	}
+}
+
+// Запросы, отменённые самим вызывающим, не открывают breaker.
+func TestCancelledRequestsDoNotOpenBreaker(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	c := New(Config{Breaker: BreakerConfig{FailureThreshold: 2}})
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		_, err := c.Do("cancel-test", req)
+		cancel()
+		if err == nil {
+			t.Fatal("want error for a cancelled request")
+		}
+	}
+	if s := c.breaker("cancel-test").State(); s != StateClosed {
+		t.Errorf("breaker %v after cancelled requests, want closed", s)
+	}
+}
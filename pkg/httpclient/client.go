@@ -0,0 +1,298 @@
+// Package httpclient — общий HTTP-клиент для вызовов между сервисами
+// с отдельным circuit breaker на каждый целевой сервис.
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"pkg/observe"
+)
+
+// ErrDependencyUnavailable — целевой сервис недоступен (breaker открыт,
+// сетевая ошибка или 5xx). Обработчики отдают на него 503.
+var ErrDependencyUnavailable = errors.New("dependency unavailable")
+
+// DependencyError уточняет, какой сервис недоступен и почему.
+type DependencyError struct {
+	Target string
+	Err    error
+}
+
+func (e *DependencyError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", ErrDependencyUnavailable, e.Target, e.Err)
+}
+
+func (e *DependencyError) Unwrap() error { return e.Err }
+
+func (e *DependencyError) Is(target error) bool { return target == ErrDependencyUnavailable }
+
+// ErrBreakerOpen — запрос не отправлялся: breaker цели открыт. Приходит
+// обёрнутым в DependencyError.
+var ErrBreakerOpen = errors.New("circuit breaker is open")
+
+var breakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "inter_service_breaker_state",
+	Help: "Circuit breaker state per target: 0 - closed, 1 - half-open, 2 - open.",
+}, []string{"target"})
+
+// TLSProvider выдаёт клиентскую TLS-конфигурацию для сервиса serverName;
+// nil означает обычный HTTP. Реализуется *mtls.Reloader.
+type TLSProvider interface {
+	ClientTLSConfig(serverName string) *tls.Config
+}
+
+// RequestSigner подписывает исходящий запрос перед каждой попыткой.
+// Реализуется *hmacsign.Signer.
+type RequestSigner interface {
+	Sign(req *http.Request) error
+}
+
+// Config — настройки клиента. Timeout ограничивает одну попытку, общий
+// дедлайн берётся из контекста входящего запроса.
+type Config struct {
+	Timeout time.Duration
+	Breaker BreakerConfig
+	Retry   RetryConfig
+	TLS     TLSProvider
+	Signer  RequestSigner
+	// Transport заменяет http.DefaultTransport, например чтобы проверять
+	// адрес при подключении. Используется только без TLS.
+	Transport http.RoundTripper
+}
+
+// ConfigFromEnv читает настройки из переменных окружения.
+func ConfigFromEnv() Config {
+	return Config{
+		Timeout: envDuration("HTTP_CLIENT_TIMEOUT", 5*time.Second),
+		Breaker: BreakerConfig{
+			FailureThreshold: envInt("BREAKER_FAILURE_THRESHOLD", 5),
+			OpenDuration:     envDuration("BREAKER_OPEN_DURATION", 30*time.Second),
+			HalfOpenProbes:   envInt("BREAKER_HALF_OPEN_PROBES", 1),
+		},
+		Retry: RetryConfig{
+			MaxAttempts: envInt("HTTP_CLIENT_MAX_ATTEMPTS", 3),
+			BaseDelay:   envDuration("HTTP_CLIENT_RETRY_BASE_DELAY", 100*time.Millisecond),
+			MaxDelay:    envDuration("HTTP_CLIENT_RETRY_MAX_DELAY", 2*time.Second),
+		},
+	}
+}
+
+// Client — обёртка над http.Client. Все межсервисные вызовы идут через неё.
+type Client struct {
+	http  *http.Client
+	cfg   Config
+	now   func() time.Time
+	sleep func(context.Context, time.Duration) error
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+	clients  map[string]*http.Client
+}
+
+// New создаёт клиент; targets регистрируются сразу, чтобы их состояние
+// было видно в /health и метриках ещё до первого вызова.
+func New(cfg Config, targets ...string) *Client {
+	if cfg.Retry.MaxAttempts <= 0 {
+		cfg.Retry.MaxAttempts = 1
+	}
+	c := &Client{
+		http:     &http.Client{Timeout: cfg.Timeout, Transport: cfg.Transport},
+		cfg:      cfg,
+		now:      time.Now,
+		sleep:    sleepContext,
+		breakers: make(map[string]*Breaker),
+		clients:  make(map[string]*http.Client),
+	}
+	for _, t := range targets {
+		c.breaker(t)
+	}
+	return c
+}
+
+func (c *Client) breaker(target string) *Breaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.breakers[target]
+	if !ok {
+		b = NewBreaker(c.cfg.Breaker)
+		b.onChange = func(s State) {
+			breakerState.WithLabelValues(target).Set(float64(s))
+			log.Printf("⚡ Circuit breaker for %s is now %s", target, s)
+		}
+		breakerState.WithLabelValues(target).Set(float64(StateClosed))
+		c.breakers[target] = b
+	}
+	return b
+}
+
+// httpClient возвращает http.Client для target. С mTLS у каждого target
+// свой транспорт: сертификат сервера проверяется по имени target.
+func (c *Client) httpClient(target string) *http.Client {
+	if c.cfg.TLS == nil {
+		return c.http
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hc, ok := c.clients[target]
+	if !ok {
+		hc = c.http
+		if tlsCfg := c.cfg.TLS.ClientTLSConfig(serverName(target)); tlsCfg != nil {
+			tr := http.DefaultTransport.(*http.Transport).Clone()
+			tr.TLSClientConfig = tlsCfg
+			hc = &http.Client{Timeout: c.cfg.Timeout, Transport: tr}
+		}
+		c.clients[target] = hc
+	}
+	return hc
+}
+
+// serverName — имя сервиса для проверки SAN: target без порта.
+func serverName(target string) string {
+	if host, _, err := net.SplitHostPort(target); err == nil {
+		return host
+	}
+	return target
+}
+
+// Do выполняет запрос к target. Сетевые ошибки и ответы 5xx считаются
+// отказом и возвращаются как *DependencyError. Идемпотентные запросы
+// повторяются с экспоненциальной задержкой, пока позволяет контекст req.
+// Если сервис просит подождать (Retry-After) дольше Retry.MaxDelay, повтора
+// нет: ошибка возвращается сразу, вызывающий решает сам.
+// X-Request-ID входящего запроса из контекста передаётся дальше.
+func (c *Client) Do(target string, req *http.Request) (*http.Response, error) {
+	if id := observe.RequestID(req.Context()); id != "" && req.Header.Get(observe.RequestIDHeader) == "" {
+		req.Header.Set(observe.RequestIDHeader, id)
+	}
+	attempts := 1
+	if isIdempotent(req) {
+		attempts = c.cfg.Retry.MaxAttempts
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				req.Body = body
+			}
+			retriesTotal.WithLabelValues(target).Inc()
+		}
+		// Подпись обновляется на каждой попытке: повтор после долгой
+		// паузы не должен упереться в допустимое расхождение времени.
+		if c.cfg.Signer != nil {
+			if err := c.cfg.Signer.Sign(req); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := c.attempt(target, req)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+		if errors.Is(err, ErrBreakerOpen) || attempt == attempts-1 {
+			break
+		}
+
+		wait, ok := retryAfter(resp, c.now())
+		if !ok {
+			wait = c.backoff(attempt)
+		} else if wait > c.cfg.Retry.MaxDelay {
+			break
+		}
+		if deadline, ok := req.Context().Deadline(); ok && c.now().Add(wait).After(deadline) {
+			break
+		}
+		if err := c.sleep(req.Context(), wait); err != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// attempt выполняет одну попытку через breaker. При повторяемом статусе
+// возвращает ответ (с закрытым телом) вместе с ошибкой, чтобы Do мог
+// прочитать Retry-After.
+func (c *Client) attempt(target string, req *http.Request) (*http.Response, error) {
+	b := c.breaker(target)
+	if !b.Allow() {
+		return nil, &DependencyError{Target: target, Err: ErrBreakerOpen}
+	}
+
+	resp, err := c.httpClient(target).Do(req)
+	if err != nil && req.Context().Err() != nil {
+		// Вызывающий отменил запрос или истёк его дедлайн — это не отказ
+		// сервиса, и breaker его не считает.
+		b.Release()
+		return nil, &DependencyError{Target: target, Err: err}
+	}
+	if err != nil {
+		b.Done(false)
+		return nil, &DependencyError{Target: target, Err: err}
+	}
+	if isRetryableStatus(resp.StatusCode) {
+		// 429 — это ограничение нагрузки, а не отказ сервиса.
+		b.Done(resp.StatusCode == http.StatusTooManyRequests)
+		resp.Body.Close()
+		return resp, &DependencyError{Target: target, Err: fmt.Errorf("status %d", resp.StatusCode)}
+	}
+	b.Done(true)
+	return resp, nil
+}
+
+// GetJSON выполняет GET и декодирует тело ответа 2xx в out.
+// Возвращает HTTP-статус, чтобы вызывающий мог обработать 404.
+func (c *Client) GetJSON(target string, req *http.Request, out interface{}) (int, error) {
+	resp, err := c.Do(target, req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || out == nil {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// BreakerStates возвращает состояние breaker по каждому известному сервису.
+func (c *Client) BreakerStates() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	states := make(map[string]string, len(c.breakers))
+	for target, b := range c.breakers {
+		states[target] = b.State().String()
+	}
+	return states
+}
+
+func envInt(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
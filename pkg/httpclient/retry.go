@@ -0,0 +1,102 @@
+package httpclient
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var retriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "inter_service_retries_total",
+	Help: "Number of retried outbound requests per target.",
+}, []string{"target"})
+
+// RetryConfig задаёт политику повторов для идемпотентных запросов.
+type RetryConfig struct {
+	MaxAttempts int           // всего попыток, включая первую
+	BaseDelay   time.Duration // задержка перед первым повтором
+	MaxDelay    time.Duration // верхняя граница задержки; больший Retry-After не выжидается
+}
+
+// isIdempotent — повторять можно только GET/HEAD и запросы с Idempotency-Key.
+// Тело запроса при этом должно быть перечитываемым (GetBody).
+func isIdempotent(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// backoff — экспоненциальная задержка с jitter в диапазоне [d/2, d].
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.cfg.Retry.BaseDelay << attempt
+	if d <= 0 || d > c.cfg.Retry.MaxDelay {
+		d = c.cfg.Retry.MaxDelay
+	}
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// retryAfter возвращает задержку, которую сервер просит выдержать перед
+// повтором: Retry-After (секунды или HTTP-дата), а без него — RateLimit-Reset
+// (секунды до сброса окна), если лимит исчерпан.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return rateLimitReset(resp.Header)
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func rateLimitReset(h http.Header) (time.Duration, bool) {
+	if rem := h.Get("RateLimit-Remaining"); rem != "" && rem != "0" {
+		return 0, false
+	}
+	secs, err := strconv.Atoi(h.Get("RateLimit-Reset"))
+	if err != nil || secs < 0 {
+		return 0, false
+	}
+	return time.Duration(secs) * time.Second, true
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,146 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// retryClient — клиент с фальшивыми часами: sleep не ждёт, а сдвигает
+// время и запоминает паузу.
+func retryClient(clock *fakeClock, waits *[]time.Duration) *Client {
+	c := New(Config{
+		Breaker: BreakerConfig{FailureThreshold: 100},
+		Retry:   RetryConfig{MaxAttempts: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: 400 * time.Millisecond},
+	})
+	c.now = clock.Now
+	c.sleep = func(_ context.Context, d time.Duration) error {
+		*waits = append(*waits, d)
+		clock.Advance(d)
+		return nil
+	}
+	return c
+}
+
+// throttled отвечает status с заголовками h первые fail раз, потом 200.
+func throttled(status, fail int, h func(http.Header)) *httptest.Server {
+	var n atomic.Int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(n.Add(1)) <= fail {
+			h(w.Header())
+			w.WriteHeader(status)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	cases := []struct {
+		name   string
+		status int
+		header func(http.Header)
+		want   time.Duration
+	}{
+		{"seconds", http.StatusTooManyRequests, func(h http.Header) { h.Set("Retry-After", "7") }, 7 * time.Second},
+		{"http-date", http.StatusServiceUnavailable, func(h http.Header) {
+			h.Set("Retry-After", clock.Now().Add(30*time.Second).Format(http.TimeFormat))
+		}, 30 * time.Second},
+		{"ratelimit-reset", http.StatusTooManyRequests, func(h http.Header) {
+			h.Set("RateLimit-Remaining", "0")
+			h.Set("RateLimit-Reset", "4")
+		}, 4 * time.Second},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var waits []time.Duration
+			c := retryClient(clock, &waits)
+			c.cfg.Retry.MaxDelay = time.Minute
+			srv := throttled(tc.status, 1, tc.header)
+			defer srv.Close()
+
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+			resp, err := c.Do("retry-after-test", req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if len(waits) != 1 || waits[0] != tc.want {
+				t.Fatalf("waits %v, want [%s]", waits, tc.want)
+			}
+		})
+	}
+}
+
+// Без Retry-After пауза — экспоненциальный backoff с jitter [d/2, d], не
+// больше MaxDelay.
+func TestRetryBackoffIsCapped(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	var waits []time.Duration
+	c := retryClient(clock, &waits)
+	c.cfg.Retry.MaxAttempts = 5
+	srv := throttled(http.StatusBadGateway, 4, func(http.Header) {})
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err := c.Do("backoff-test", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// BaseDelay << attempt: 100ms, 200ms, 400ms, затем MaxDelay 400ms.
+	ceilings := []time.Duration{100, 200, 400, 400}
+	if len(waits) != len(ceilings) {
+		t.Fatalf("waits %v, want %d", waits, len(ceilings))
+	}
+	for i, w := range waits {
+		max := ceilings[i] * time.Millisecond
+		if w < max/2 || w > max {
+			t.Errorf("wait %d = %s, want within [%s, %s]", i+1, w, max/2, max)
+		}
+	}
+}
+
+// Retry-After больше MaxDelay не выжидается: клиент сразу возвращает
+// ошибку.
+func TestRetryAfterBeyondMaxDelayGivesUp(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	var waits []time.Duration
+	c := retryClient(clock, &waits)
+	srv := throttled(http.StatusTooManyRequests, 1, func(h http.Header) { h.Set("Retry-After", "7") })
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if _, err := c.Do("max-delay-test", req); err == nil {
+		t.Fatal("want error when Retry-After exceeds MaxDelay")
+	}
+	if len(waits) != 0 {
+		t.Fatalf("waited %v beyond MaxDelay", waits)
+	}
+}
+
+// Пауза, которая не укладывается в дедлайн запроса, не выжидается:
+// клиент сразу возвращает ошибку.
+func TestRetryAfterBeyondDeadlineGivesUp(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	var waits []time.Duration
+	c := retryClient(clock, &waits)
+	c.cfg.Retry.MaxDelay = 5 * time.Minute
+	srv := throttled(http.StatusServiceUnavailable, 1, func(h http.Header) { h.Set("Retry-After", "120") })
+	defer srv.Close()
+
+	ctx, cancel := context.WithDeadline(context.Background(), clock.Now().Add(10*time.Second))
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if _, err := c.Do("deadline-test", req); err == nil {
+		t.Fatal("want error when Retry-After exceeds the deadline")
+	}
+	if len(waits) != 0 {
+		t.Fatalf("waited %v past the deadline", waits)
+	}
+}
@@ -0,0 +1,243 @@
+// Package limit ограничивает число запросов, которые реплика обрабатывает
+// одновременно. Сверх лимита запрос ждёт в короткой очереди; если очередь
+// полна или ожидание вышло, он сразу получает 503 overloaded с
+// Retry-After, а не копится, пока пул соединений к БД не исчерпан и не
+// истекают таймауты у всех сразу.
+package limit
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"pkg/apierr"
+)
+
+var inFlightGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "http_inflight_requests",
+	Help: "Requests currently being processed under the concurrency limit.",
+})
+
+var queuedGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "http_queued_requests",
+	Help: "Requests waiting for a concurrency slot.",
+})
+
+var limitGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "http_concurrency_limit",
+	Help: "Current concurrency limit, 0 if unlimited.",
+})
+
+var shed = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_shed_requests_total",
+	Help: "Requests rejected by the concurrency limiter: queue_full, timeout.",
+}, []string{"reason"})
+
+// Settings — лимит одновременных запросов (0 — без ограничения) и длина
+// очереди ожидающих.
+type Settings struct {
+	MaxInFlight int `json:"max_in_flight"`
+	QueueSize   int `json:"queue_size"`
+}
+
+// Limiter — семафор с очередью FIFO. Лимит меняется на ходу (SetSettings):
+// при увеличении ожидающие сразу получают слоты, при уменьшении лишние
+// запросы дорабатывают, а новые ждут, пока занятых не станет меньше
+// лимита.
+type Limiter struct {
+	queueTimeout time.Duration
+	retryAfter   time.Duration
+
+	mu       sync.Mutex
+	settings Settings
+	inFlight int
+	waiters  []chan struct{}
+}
+
+// FromEnv создаёт Limiter: MAX_CONCURRENT_REQUESTS — лимит (по умолчанию
+// 100, 0 — без ограничения), CONCURRENCY_QUEUE_SIZE — очередь (50),
+// CONCURRENCY_QUEUE_TIMEOUT — сколько запрос ждёт слот (500ms),
+// CONCURRENCY_RETRY_AFTER — Retry-After в ответах 503 (1s).
+func FromEnv() *Limiter {
+	l := &Limiter{queueTimeout: 500 * time.Millisecond, retryAfter: time.Second}
+	s := Settings{MaxInFlight: 100, QueueSize: 50}
+	if v, err := strconv.Atoi(os.Getenv("MAX_CONCURRENT_REQUESTS")); err == nil && v >= 0 {
+		s.MaxInFlight = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("CONCURRENCY_QUEUE_SIZE")); err == nil && v >= 0 {
+		s.QueueSize = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("CONCURRENCY_QUEUE_TIMEOUT")); err == nil && v > 0 {
+		l.queueTimeout = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("CONCURRENCY_RETRY_AFTER")); err == nil && v > 0 {
+		l.retryAfter = v
+	}
+	l.SetSettings(s)
+	return l
+}
+
+// SetSettings меняет лимит и очередь и возвращает прежние.
+func (l *Limiter) SetSettings(s Settings) Settings {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	prev := l.settings
+	l.settings = s
+	// Слоты, освободившиеся из-за нового лимита, — ожидающим по порядку;
+	// без лимита очередь не нужна вовсе.
+	for len(l.waiters) > 0 && (s.MaxInFlight == 0 || l.inFlight < s.MaxInFlight) {
+		l.grant()
+	}
+	limitGauge.Set(float64(s.MaxInFlight))
+	return prev
+}
+
+// grant передаёт слот первому в очереди. Вызывается под l.mu.
+func (l *Limiter) grant() {
+	close(l.waiters[0])
+	l.waiters = l.waiters[1:]
+	l.inFlight++
+	inFlightGauge.Set(float64(l.inFlight))
+	queuedGauge.Set(float64(len(l.waiters)))
+}
+
+// acquire занимает слот; "" — занят, иначе причина отказа для
+// http_shed_requests_total.
+func (l *Limiter) acquire(done <-chan struct{}) string {
+	l.mu.Lock()
+	if l.settings.MaxInFlight == 0 || l.inFlight < l.settings.MaxInFlight {
+		l.inFlight++
+		inFlightGauge.Set(float64(l.inFlight))
+		l.mu.Unlock()
+		return ""
+	}
+	if len(l.waiters) >= l.settings.QueueSize {
+		l.mu.Unlock()
+		return "queue_full"
+	}
+	ch := make(chan struct{})
+	l.waiters = append(l.waiters, ch)
+	queuedGauge.Set(float64(len(l.waiters)))
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case <-ch:
+		return ""
+	case <-timer.C:
+	case <-done:
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, w := range l.waiters {
+		if w == ch {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			queuedGauge.Set(float64(len(l.waiters)))
+			return "timeout"
+		}
+	}
+	// Слот выдан одновременно с таймаутом — запрос всё же обрабатывается.
+	return ""
+}
+
+func (l *Limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	if len(l.waiters) > 0 && (l.settings.MaxInFlight == 0 || l.inFlight < l.settings.MaxInFlight) {
+		l.grant()
+		return
+	}
+	inFlightGauge.Set(float64(l.inFlight))
+}
+
+// streamRoutes — шаблоны маршрутов WebSocket и SSE: они держат слот
+// часами и имеют свой лимит подключений.
+var streamRoutes = map[string]bool{
+	"/orders/{id}/ws":         true,
+	"/deliveries/{id}/stream": true,
+}
+
+// exempt — служебные маршруты и долгие подключения не ограничиваются:
+// проверки и метрики должны отвечать и под нагрузкой, /admin/ — чтобы
+// лимит можно было поменять. Потоки узнаются по шаблону маршрута, а не по
+// заголовкам Upgrade и Accept, которые клиент может подставить в любой
+// запрос.
+func exempt(r *http.Request) bool {
+	path := r.URL.Path
+	if path == "/health" || path == "/ready" || path == "/health/ready" || path == "/metrics" ||
+		strings.HasPrefix(path, "/admin/") {
+		return true
+	}
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			return streamRoutes[tpl]
+		}
+	}
+	return false
+}
+
+// Middleware пропускает запрос, когда есть слот, и отвечает 503 overloaded
+// с Retry-After, когда его нет. Подключается через router.Use.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if exempt(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if reason := l.acquire(r.Context().Done()); reason != "" {
+			shed.WithLabelValues(reason).Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(l.retryAfter.Seconds()))))
+			apierr.Write(w, apierr.Overloaded, "Too many concurrent requests")
+			return
+		}
+		defer l.release()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Status — текущие настройки и загрузка для /admin/concurrency.
+type Status struct {
+	Settings
+	InFlight int `json:"in_flight"`
+	Queued   int `json:"queued"`
+}
+
+func (l *Limiter) status() Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Status{Settings: l.settings, InFlight: l.inFlight, Queued: len(l.waiters)}
+}
+
+// Handler — GET /admin/concurrency возвращает настройки и загрузку, PUT с
+// телом {"max_in_flight": 50, "queue_size": 20} меняет их. Маршрут
+// подключается через admin.RequireKey.
+func (l *Limiter) Handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		s := l.status().Settings
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			apierr.Write(w, apierr.InvalidRequest, err.Error())
+			return
+		}
+		if s.MaxInFlight < 0 || s.QueueSize < 0 {
+			apierr.Write(w, apierr.InvalidRequest, "max_in_flight and queue_size must not be negative")
+			return
+		}
+		prev := l.SetSettings(s)
+		log.Printf("🚦 Concurrency limit changed: max_in_flight %d -> %d, queue_size %d -> %d",
+			prev.MaxInFlight, s.MaxInFlight, prev.QueueSize, s.QueueSize)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l.status())
+}
@@ -0,0 +1,47 @@
+package limit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestExempt(t *testing.T) {
+	cases := []struct {
+		target string
+		header http.Header
+		want   bool
+	}{
+		{"/health", nil, true},
+		{"/admin/concurrency", nil, true},
+		{"/orders/7/ws", nil, true},
+		{"/deliveries/7/stream", nil, true},
+		{"/orders/7", nil, false},
+		{"/orders/7", http.Header{"Upgrade": {"websocket"}}, false},
+		{"/orders", http.Header{"Accept": {"text/event-stream"}}, false},
+	}
+
+	var got bool
+	router := mux.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = exempt(r) })
+	})
+	noop := func(http.ResponseWriter, *http.Request) {}
+	for _, path := range []string{"/health", "/admin/concurrency", "/orders", "/orders/{id}", "/orders/{id}/ws", "/deliveries/{id}/stream"} {
+		router.HandleFunc(path, noop)
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, c.target, nil)
+		for k, v := range c.header {
+			req.Header[k] = v
+		}
+		got = !c.want
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		if got != c.want {
+			t.Errorf("%s %v: exempt %v, want %v", c.target, c.header, got, c.want)
+		}
+	}
+}
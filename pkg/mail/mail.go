@@ -0,0 +1,65 @@
+// Package mail отправляет письма через SMTP: SMTP_ADDR (host:port),
+// SMTP_FROM, необязательные SMTP_USER и SMTP_PASSWORD. Без SMTP_ADDR
+// письма пишутся в лог — режим для локальной разработки.
+package mail
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Message — письмо одному получателю. HTML — тело в text/html, иначе
+// text/plain.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+	HTML    bool
+}
+
+type Sender struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// FromEnv создаёт Sender по SMTP_*; SMTP_FROM по умолчанию
+// no-reply@localhost.
+func FromEnv() *Sender {
+	s := &Sender{addr: os.Getenv("SMTP_ADDR"), from: os.Getenv("SMTP_FROM")}
+	if s.from == "" {
+		s.from = "no-reply@localhost"
+	}
+	if user := os.Getenv("SMTP_USER"); user != "" {
+		host, _, _ := net.SplitHostPort(s.addr)
+		s.auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return s
+}
+
+// LogOnly — SMTP не настроен, письма только пишутся в лог.
+func (s *Sender) LogOnly() bool {
+	return s.addr == ""
+}
+
+func (s *Sender) Send(m Message) error {
+	if s.LogOnly() {
+		log.Printf("📧 Mail to %s: %s\n%s", m.To, m.Subject, m.Body)
+		return nil
+	}
+	if strings.ContainsAny(m.To+m.Subject, "\r\n") {
+		return fmt.Errorf("invalid mail header")
+	}
+	contentType := "text/plain"
+	if m.HTML {
+		contentType = "text/html"
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: %s; charset=utf-8\r\n\r\n%s",
+		s.from, m.To, m.Subject, time.Now().Format(time.RFC1123Z), contentType, strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{m.To}, []byte(msg))
+}
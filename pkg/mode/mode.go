@@ -0,0 +1,163 @@
+// Package mode — режим работы сервиса, переключаемый без перезапуска:
+// normal, read_only (изменяющие запросы отклоняются) и maintenance
+// (отклоняется всё, кроме служебных маршрутов).
+package mode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"pkg/apierr"
+)
+
+type Mode string
+
+const (
+	Normal      Mode = "normal"
+	ReadOnly    Mode = "read_only"
+	Maintenance Mode = "maintenance"
+)
+
+var modes = []Mode{Normal, ReadOnly, Maintenance}
+
+var modeGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "service_mode",
+	Help: "Current service mode: 1 for the active mode, 0 otherwise.",
+}, []string{"mode"})
+
+var rejected = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "service_mode_rejected_requests_total",
+	Help: "Requests rejected because of the current service mode.",
+}, []string{"mode"})
+
+func Parse(s string) (Mode, error) {
+	for _, m := range modes {
+		if string(m) == s {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("unknown mode %q: expected normal, read_only or maintenance", s)
+}
+
+// Switch хранит текущий режим. Чтение и смена режима атомарны, поэтому
+// параллельные переключения безопасны: действует последнее.
+type Switch struct {
+	current    atomic.Value // Mode
+	retryAfter time.Duration
+}
+
+// FromEnv создаёт Switch с режимом из SERVICE_MODE (по умолчанию normal).
+// MODE_RETRY_AFTER задаёт Retry-After в ответах 503.
+func FromEnv() (*Switch, error) {
+	m := Normal
+	if v := os.Getenv("SERVICE_MODE"); v != "" {
+		var err error
+		if m, err = Parse(v); err != nil {
+			return nil, err
+		}
+	}
+	s := &Switch{retryAfter: time.Minute}
+	if v, err := time.ParseDuration(os.Getenv("MODE_RETRY_AFTER")); err == nil && v > 0 {
+		s.retryAfter = v
+	}
+	s.Set(m)
+	return s, nil
+}
+
+func (s *Switch) Get() Mode {
+	return s.current.Load().(Mode)
+}
+
+// Set меняет режим и возвращает предыдущий.
+func (s *Switch) Set(m Mode) Mode {
+	prev, _ := s.current.Swap(m).(Mode)
+	for _, mm := range modes {
+		v := 0.0
+		if mm == m {
+			v = 1
+		}
+		modeGauge.WithLabelValues(string(mm)).Set(v)
+	}
+	return prev
+}
+
+// alwaysOpen — маршруты, доступные в любом режиме: без них нельзя ни
+// проверить сервис, ни вернуть его в normal.
+var alwaysOpen = map[string]bool{
+	"/health":       true,
+	"/health/live":  true,
+	"/health/ready": true,
+	"/ready":        true,
+	"/metrics":      true,
+	"/admin/mode":   true,
+}
+
+// exempt — запрос проходит в любом режиме: alwaysOpen и чтение
+// остальных /admin/ (состояние сервиса нужно и при обслуживании).
+// Изменения через /admin/ подчиняются режиму, как и всё остальное.
+func exempt(method, path string) bool {
+	return alwaysOpen[path] || (strings.HasPrefix(path, "/admin/") && !isMutation(method))
+}
+
+func isMutation(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// Middleware отклоняет запросы, недопустимые в текущем режиме, с 503,
+// Retry-After и машиночитаемым кодом. Подключается через router.Use.
+func (s *Switch) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := s.Get()
+		if m == Normal || exempt(r.Method, r.URL.Path) || (m == ReadOnly && !isMutation(r.Method)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rejected.WithLabelValues(string(m)).Inc()
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(s.retryAfter.Seconds()))))
+		msg := "Service is in maintenance mode"
+		if m == ReadOnly {
+			msg = "Service is read-only, writes are temporarily disabled"
+		}
+		// Коды режимов совпадают с их именами: read_only, maintenance.
+		apierr.Write(w, apierr.Code(m), msg)
+	})
+}
+
+// Handler — POST /admin/mode с телом {"mode": "read_only"}. Маршрут
+// подключается через admin.RequireKey.
+func (s *Switch) Handler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Mode string `json:"mode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	m, err := Parse(req.Mode)
+	if err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+
+	prev := s.Set(m)
+	if prev != m {
+		log.Printf("🚧 Service mode changed: %s -> %s", prev, m)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"mode": string(m), "previous": string(prev)})
+}
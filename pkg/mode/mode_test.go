@@ -0,0 +1,97 @@
+package mode
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newSwitch(m Mode) *Switch {
+	s := &Switch{retryAfter: 90 * time.Second}
+	s.Set(m)
+	return s
+}
+
+func TestMiddlewareByVerb(t *testing.T) {
+	verbs := []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	mutation := map[string]bool{http.MethodPost: true, http.MethodPut: true, http.MethodPatch: true, http.MethodDelete: true}
+	// Проходят в любом режиме: проверки, метрики и переключение режима.
+	open := map[string]bool{"/health": true, "/health/live": true, "/health/ready": true, "/ready": true, "/metrics": true, "/admin/mode": true}
+
+	for _, m := range modes {
+		s := newSwitch(m)
+		h := s.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		for _, path := range []string{"/orders/1", "/health", "/health/live", "/health/ready", "/ready", "/metrics", "/admin/mode", "/admin/flags", "/admin/seed"} {
+			for _, verb := range verbs {
+				adminRead := strings.HasPrefix(path, "/admin/") && !mutation[verb]
+				allowed := m == Normal || open[path] || adminRead || (m == ReadOnly && !mutation[verb])
+
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, httptest.NewRequest(verb, path, nil))
+
+				if allowed {
+					if rec.Code != http.StatusNoContent {
+						t.Errorf("%s %s %s: status %d, want pass-through", m, verb, path, rec.Code)
+					}
+					continue
+				}
+				if rec.Code != http.StatusServiceUnavailable {
+					t.Errorf("%s %s %s: status %d, want 503", m, verb, path, rec.Code)
+					continue
+				}
+				if got := rec.Header().Get("Retry-After"); got != "90" {
+					t.Errorf("%s %s %s: Retry-After %q, want 90", m, verb, path, got)
+				}
+				if verb == http.MethodHead {
+					continue
+				}
+				var body struct {
+					Code string `json:"code"`
+				}
+				if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body.Code != string(m) {
+					t.Errorf("%s %s %s: code %q (%v), want %s", m, verb, path, body.Code, err, m)
+				}
+			}
+		}
+	}
+}
+
+func TestHandlerSwitchesMode(t *testing.T) {
+	s := newSwitch(Normal)
+	rec := httptest.NewRecorder()
+	s.Handler(rec, httptest.NewRequest(http.MethodPost, "/admin/mode", strings.NewReader(`{"mode":"read_only"}`)))
+	if rec.Code != http.StatusOK || s.Get() != ReadOnly {
+		t.Fatalf("status %d, mode %s; want 200, read_only", rec.Code, s.Get())
+	}
+
+	rec = httptest.NewRecorder()
+	s.Handler(rec, httptest.NewRequest(http.MethodPost, "/admin/mode", strings.NewReader(`{"mode":"off"}`)))
+	if rec.Code != http.StatusBadRequest || s.Get() != ReadOnly {
+		t.Fatalf("unknown mode: status %d, mode %s; want 400, read_only", rec.Code, s.Get())
+	}
+}
+
+// Параллельные переключения не портят состояние: остаётся один из
+// допустимых режимов (запускать с -race).
+func TestConcurrentSet(t *testing.T) {
+	s := newSwitch(Normal)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(m Mode) {
+			defer wg.Done()
+			s.Set(m)
+			_ = s.Get()
+		}(modes[i%len(modes)])
+	}
+	wg.Wait()
+	if _, err := Parse(string(s.Get())); err != nil {
+		t.Fatal(err)
+	}
+}
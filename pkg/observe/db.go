@@ -0,0 +1,322 @@
+package observe
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"pkg/pg"
+)
+
+// DriverName — драйвер pgx (database/sql) с замером времени запросов:
+// sql.Open(observe.DriverName, databaseURL). Запросы, выполненные с
+// контекстом HTTP-запроса (QueryContext, ExecContext, ...), попадают в
+// журнал медленных запросов; остальные — только в метрики.
+const DriverName = "postgres-observed"
+
+// Метрики по имени запроса (см. Named): число запросов — _count
+// гистограммы, ошибки — db_query_errors_total с классом из pg.Class.
+var queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "db_query_duration_seconds",
+	Help:    "Database query latency by query name.",
+	Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+}, []string{"query"})
+
+var queryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "db_query_errors_total",
+	Help: "Failed database queries by query name and error class.",
+}, []string{"query", "class"})
+
+// unnamedQuery — метка запросов без имени.
+const unnamedQuery = "unnamed"
+
+// Named помечает запрос именем для метрик и журнала медленных запросов:
+// observe.Named("orders.list", "SELECT ..."). Имя — константа вида
+// <сервис>.<действие> (строчные буквы, цифры, _ и .), а не текст SQL,
+// чтобы число рядов метрик было ограничено. Оно уходит в Postgres
+// комментарием в начале запроса.
+func Named(name, query string) string {
+	return "/* " + name + " */ " + query
+}
+
+// Lookup — как Named, но для запроса ровно одной строки (чтение по ключу,
+// UPDATE ... WHERE id): пустой результат учитывается как ошибка
+// not_found.
+func Lookup(name, query string) string {
+	return "/* " + name + " lookup */ " + query
+}
+
+// queryName разбирает пометку Named/Lookup.
+func queryName(query string) (name string, lookup bool) {
+	if !strings.HasPrefix(query, "/* ") {
+		return unnamedQuery, false
+	}
+	end := strings.Index(query, " */")
+	if end < 0 {
+		return unnamedQuery, false
+	}
+	name, lookup = strings.CutSuffix(query[3:end], " lookup")
+	if name == "" {
+		return unnamedQuery, false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' || r == '.') {
+			return unnamedQuery, false
+		}
+	}
+	return name, lookup
+}
+
+// statementCache — запросы с параметрами по результату кэша
+// подготовленных выражений pgx: hit — выражение уже подготовлено на этом
+// соединении, miss — запрос разобран и подготовлен заново (первое
+// использование на соединении, новое соединение после разрыва или
+// вытеснение из кэша).
+var statementCache = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "db_statement_cache_total",
+	Help: "Parameterized queries by prepared statement cache result.",
+}, []string{"result"})
+
+func init() {
+	sql.Register(DriverName, timedDriver{})
+}
+
+// queryStats — запросы в рамках HTTP-запроса: число, самый долгий и
+// суммарное время по именам.
+type queryStats struct {
+	mu     sync.Mutex
+	max    time.Duration
+	count  int
+	byName map[string]time.Duration
+}
+
+func (s *queryStats) record(name string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+	if d > s.max {
+		s.max = d
+	}
+	if s.byName == nil {
+		s.byName = make(map[string]time.Duration)
+	}
+	s.byName[name] += d
+}
+
+// dbSummary — итог для журнала медленных запросов; dominant — имя
+// запроса с наибольшим суммарным временем.
+type dbSummary struct {
+	count         int
+	max           time.Duration
+	dominant      string
+	dominantTotal time.Duration
+}
+
+func (s *queryStats) snapshot() dbSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sum := dbSummary{count: s.count, max: s.max}
+	for name, d := range s.byName {
+		if d > sum.dominantTotal || d == sum.dominantTotal && name < sum.dominant {
+			sum.dominant, sum.dominantTotal = name, d
+		}
+	}
+	return sum
+}
+
+func observeQuery(ctx context.Context, name string, start time.Time, err error) {
+	d := time.Since(start)
+	queryDuration.WithLabelValues(name).Observe(d.Seconds())
+	if err != nil {
+		queryErrors.WithLabelValues(name, pg.Class(err)).Inc()
+	}
+	if s, ok := ctx.Value(queryStatsKey).(*queryStats); ok {
+		s.record(name, d)
+	}
+}
+
+type timedDriver struct{}
+
+func (timedDriver) Open(name string) (driver.Conn, error) {
+	c, err := stdlib.GetDefaultDriver().Open(name)
+	if err != nil {
+		return nil, err
+	}
+	tc := &timedConn{Conn: c}
+	// Кэш выражений работает только в режиме cache_statement (по
+	// умолчанию); default_query_exec_mode и statement_cache_capacity
+	// задаются в DATABASE_URL.
+	if cfg, err := pgx.ParseConfig(name); err == nil &&
+		cfg.DefaultQueryExecMode == pgx.QueryExecModeCacheStatement && cfg.StatementCacheCapacity > 0 {
+		tc.prepared = make(map[string]struct{})
+		tc.capacity = cfg.StatementCacheCapacity
+	}
+	return tc, nil
+}
+
+// timedConn оборачивает соединение pgx. Методы, которые database/sql
+// ищет через приведение типов, пробрасываются явно.
+type timedConn struct {
+	driver.Conn
+
+	// prepared — тексты запросов, уже подготовленных на соединении. Кэш
+	// pgx недоступен снаружи, поэтому учёт ведётся здесь по тем же
+	// правилам: запросы без параметров идут простым протоколом и не
+	// кэшируются. Соединение database/sql использует одна горутина за раз.
+	prepared map[string]struct{}
+	capacity int
+}
+
+// countStatement учитывает запрос в db_statement_cache_total.
+func (c *timedConn) countStatement(query string, args []driver.NamedValue) {
+	if c.prepared == nil || len(args) == 0 {
+		return
+	}
+	if _, ok := c.prepared[query]; ok {
+		statementCache.WithLabelValues("hit").Inc()
+		return
+	}
+	statementCache.WithLabelValues("miss").Inc()
+	if len(c.prepared) >= c.capacity {
+		// pgx вытесняет по LRU; сброс занижает попадания, но не завышает.
+		clear(c.prepared)
+	}
+	c.prepared[query] = struct{}{}
+}
+
+// QueryContext замеряет запрос до закрытия строк: pgx читает результат
+// по мере Next, и ошибка сервера (например, в INSERT ... RETURNING) может
+// прийти только там.
+func (c *timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	name, lookup := queryName(query)
+	c.countStatement(query, args)
+	rows, err := c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+	if err != nil {
+		observeQuery(ctx, name, start, err)
+		return nil, err
+	}
+	return &timedRows{Rows: rows, ctx: ctx, name: name, lookup: lookup, start: start}, nil
+}
+
+func (c *timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	name, lookup := queryName(query)
+	c.countStatement(query, args)
+	res, err := c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+	if err == nil && lookup {
+		if n, rerr := res.RowsAffected(); rerr == nil && n == 0 {
+			observeQuery(ctx, name, start, sql.ErrNoRows)
+			return res, err
+		}
+	}
+	observeQuery(ctx, name, start, err)
+	return res, err
+}
+
+func (c *timedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.Conn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+}
+
+func (c *timedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func (c *timedConn) Ping(ctx context.Context) error {
+	return c.Conn.(driver.Pinger).Ping(ctx)
+}
+
+func (c *timedConn) ResetSession(ctx context.Context) error {
+	return c.Conn.(driver.SessionResetter).ResetSession(ctx)
+}
+
+// CheckNamedValue пропускает аргументы в pgx без преобразования
+// database/sql: так срезы ([]string, []int64) уходят массивами.
+func (c *timedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	return c.Conn.(driver.NamedValueChecker).CheckNamedValue(nv)
+}
+
+func (c *timedConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// timedRows завершает замер запроса на первой ошибке, конце результата
+// или Close. Методы ColumnType* пробрасываются для rows.ColumnTypes().
+type timedRows struct {
+	driver.Rows
+	ctx    context.Context
+	name   string
+	lookup bool
+	start  time.Time
+	n      int
+	done   bool
+}
+
+func (r *timedRows) finish(err error) {
+	if r.done {
+		return
+	}
+	r.done = true
+	if err == io.EOF {
+		err = nil
+		if r.lookup && r.n == 0 {
+			err = sql.ErrNoRows
+		}
+	}
+	observeQuery(r.ctx, r.name, r.start, err)
+}
+
+func (r *timedRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err == nil {
+		r.n++
+	} else {
+		r.finish(err)
+	}
+	return err
+}
+
+func (r *timedRows) Close() error {
+	r.finish(nil)
+	return r.Rows.Close()
+}
+
+func (r *timedRows) ColumnTypeDatabaseTypeName(index int) string {
+	if t, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return t.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r *timedRows) ColumnTypeLength(index int) (int64, bool) {
+	if t, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+		return t.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+func (r *timedRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if t, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return t.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
+
+func (r *timedRows) ColumnTypeScanType(index int) reflect.Type {
+	if t, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+		return t.ColumnTypeScanType(index)
+	}
+	return reflect.TypeOf(new(interface{})).Elem()
+}
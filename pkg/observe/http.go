@@ -0,0 +1,148 @@
+// Package observe — метрики запросов по шаблонам маршрутов, журнал
+// медленных запросов и учёт времени SQL-запросов в рамках HTTP-запроса.
+package observe
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// RequestIDHeader — заголовок с id запроса; если клиент его не прислал,
+// id генерируется и возвращается в ответе.
+const RequestIDHeader = "X-Request-ID"
+
+var requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "http_request_duration_seconds",
+	Help:    "HTTP request latency by route template, method and status code.",
+	Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+}, []string{"route", "method", "status"})
+
+var slowRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_slow_requests_total",
+	Help: "Requests slower than SLOW_REQUEST_THRESHOLD by route template.",
+}, []string{"route"})
+
+type ctxKey int
+
+const (
+	requestIDKey ctxKey = iota
+	queryStatsKey
+)
+
+// RequestID возвращает id текущего запроса или "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Middleware пишет гистограмму по шаблону маршрута и предупреждение в
+// журнал для запросов дольше SLOW_REQUEST_THRESHOLD (по умолчанию 1s).
+// Подключается через router.Use первым, чтобы учитывать весь запрос.
+func Middleware() mux.MiddlewareFunc {
+	threshold := time.Second
+	if v, err := time.ParseDuration(os.Getenv("SLOW_REQUEST_THRESHOLD")); err == nil && v > 0 {
+		threshold = v
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			id := r.Header.Get(RequestIDHeader)
+			if id == "" {
+				id = newRequestID()
+			}
+			w.Header().Set(RequestIDHeader, id)
+			stats := &queryStats{}
+			ctx := context.WithValue(r.Context(), requestIDKey, id)
+			ctx = context.WithValue(ctx, queryStatsKey, stats)
+
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r.WithContext(ctx))
+
+			// Долгоживущие соединения (WebSocket, SSE) не запросы в обычном
+			// смысле — их длительность исказила бы гистограмму.
+			if rec.hijacked || rec.streaming {
+				return
+			}
+
+			route := "unmatched"
+			if cur := mux.CurrentRoute(r); cur != nil {
+				if tpl, err := cur.GetPathTemplate(); err == nil {
+					route = tpl
+				}
+			}
+			elapsed := time.Since(start)
+			requestDuration.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Observe(elapsed.Seconds())
+
+			if elapsed >= threshold {
+				slowRequests.WithLabelValues(route).Inc()
+				db := stats.snapshot()
+				log.Printf("🐢 slow request route=%q method=%s status=%d duration_ms=%d request_id=%s db_queries=%d db_max_query_ms=%d db_dominant_query=%s db_dominant_query_ms=%d",
+					route, r.Method, rec.status, elapsed.Milliseconds(), id, db.count, db.max.Milliseconds(), db.dominant, db.dominantTotal.Milliseconds())
+			}
+		})
+	}
+}
+
+// statusRecorder запоминает код ответа, сохраняя поддержку Flusher и
+// Hijacker для SSE и WebSocket.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	hijacked    bool
+	streaming   bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		r.streaming = true
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	r.hijacked = true
+	return hj.Hijack()
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,65 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// LockTimeout — сколько транзакция Locked ждёт блокировку строки, прежде
+// чем Postgres прервёт её (lock_timeout).
+const LockTimeout = 2 * time.Second
+
+// Повторы Locked: всего lockAttempts попыток, пауза растёт линейно.
+const (
+	lockAttempts = 3
+	lockBackoff  = 20 * time.Millisecond
+)
+
+// Locked выполняет «чтение — проверка — запись» в одной транзакции: fn
+// читает строку с SELECT ... FOR UPDATE (или меняет её одним условным
+// UPDATE ... RETURNING), проверяет состояние и пишет; транзакция
+// фиксируется, если fn вернула nil. Конкурирующий запрос к той же строке —
+// в том числе с другой реплики — ждёт фиксации и видит уже новое
+// состояние, поэтому переход выполняет ровно один из них.
+//
+// Транзакция, прерванная конкурирующей (serialization failure, deadlock,
+// ожидание блокировки дольше LockTimeout), повторяется целиком, всего до
+// lockAttempts раз; последняя ошибка уходит вызывающему, и APIError
+// переводит её в 409 resource_locked (lock_timeout) или 503
+// concurrent_update (serialization failure, deadlock). Поэтому fn не должна менять
+// ничего вне tx и должна начинать с исходных данных запроса. Прочие
+// ошибки fn (sql.ErrNoRows, *apierr.Error о недопустимом переходе)
+// возвращаются без повтора.
+func Locked(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	for attempt := 1; ; attempt++ {
+		err := lockedOnce(ctx, db, fn)
+		if !IsRetryable(err) || attempt == lockAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * lockBackoff):
+		}
+	}
+}
+
+var setLockTimeout = fmt.Sprintf("SET LOCAL lock_timeout = '%dms'", LockTimeout.Milliseconds())
+
+func lockedOnce(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, setLockTimeout); err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,162 @@
+// Package pg — общее для работы с Postgres через pgx и database/sql:
+// разбор ошибок сервера (SQLSTATE) и их перевод в коды API, сканирование
+// массивов.
+//
+// Срезы ([]string, []int64) передаются в запросы как есть — драйвер pgx
+// кодирует их сам; для чтения массива в срез нужен Array.
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"pkg/apierr"
+)
+
+// Коды SQLSTATE, которые сервисы обрабатывают особо.
+const (
+	UniqueViolation      = "23505"
+	ForeignKeyViolation  = "23503"
+	SerializationFailure = "40001"
+	DeadlockDetected     = "40P01"
+	LockNotAvailable     = "55P03"
+)
+
+// Code возвращает SQLSTATE ошибки Postgres; "" — ошибка не от сервера.
+func Code(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
+
+// Constraint возвращает имя нарушенного ограничения, если оно известно.
+func Constraint(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.ConstraintName
+	}
+	return ""
+}
+
+// IsUniqueViolation — нарушено ограничение уникальности.
+func IsUniqueViolation(err error) bool {
+	return Code(err) == UniqueViolation
+}
+
+// IsForeignKeyViolation — нарушен внешний ключ.
+func IsForeignKeyViolation(err error) bool {
+	return Code(err) == ForeignKeyViolation
+}
+
+// IsRetryable — транзакция прервана из-за конкурирующей транзакции
+// (serialization failure, deadlock, lock_timeout); её можно повторить
+// целиком.
+func IsRetryable(err error) bool {
+	switch Code(err) {
+	case SerializationFailure, DeadlockDetected, LockNotAvailable:
+		return true
+	}
+	return false
+}
+
+// Классы ошибок для метрик: значения меток, а не текст ошибки, чтобы число
+// рядов оставалось ограниченным.
+const (
+	ClassNotFound   = "not_found"
+	ClassConstraint = "constraint"
+	ClassTimeout    = "timeout"
+	ClassCanceled   = "canceled"
+	ClassConnection = "connection"
+	ClassOther      = "other"
+)
+
+// Class относит ошибку запроса к одному из классов Class*; nil — "".
+func Class(err error) string {
+	if err == nil {
+		return ""
+	}
+	code := Code(err)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ClassNotFound
+	case strings.HasPrefix(code, "23"): // integrity_constraint_violation
+		return ClassConstraint
+	// Отмена проверяется раньше таймаута: pgconn оборачивает в errTimeout
+	// и её.
+	case errors.Is(err, context.Canceled):
+		return ClassCanceled
+	// 57014 — query_canceled, в том числе по statement_timeout.
+	case errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err) || code == "57014":
+		return ClassTimeout
+	case IsConnectionLost(err),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		return ClassConnection
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ClassConnection
+	}
+	return ClassOther
+}
+
+// IsConnectionLost — к Postgres не подключиться или соединение разорвано
+// сервером: connection_exception (08xxx), остановка или запуск сервера
+// (57P01–57P03), отказ при подключении, соединение, которое database/sql
+// отбросил. Сетевые ошибки без признаков pgx сюда не относятся: их даёт и
+// HTTP-клиент других сервисов.
+func IsConnectionLost(err error) bool {
+	code := Code(err)
+	if strings.HasPrefix(code, "08") || code == "57P01" || code == "57P02" || code == "57P03" {
+		return true
+	}
+	var connectErr *pgconn.ConnectError
+	return errors.As(err, &connectErr) || errors.Is(err, driver.ErrBadConn)
+}
+
+// APIError переводит ошибку Postgres в ошибку API: нарушение
+// уникальности — 409 conflict, внешнего ключа — 422 invalid_reference,
+// lock_timeout — 409 resource_locked (строку держит другой запрос, и
+// после него переход может стать недопустимым: клиент перечитывает
+// ресурс), serialization failure и deadlock — 503 concurrent_update
+// (запрос можно повторить как есть), потеря соединения — 503
+// database_unavailable. Остальные ошибки не переводятся (nil).
+// Подключается через apierr.SetTranslator(pg.APIError).
+func APIError(err error) *apierr.Error {
+	switch {
+	case IsUniqueViolation(err):
+		return withConstraint(apierr.New(apierr.Conflict, "Conflicts with an existing record"), err)
+	case IsForeignKeyViolation(err):
+		return withConstraint(apierr.New(apierr.InvalidReference, "Referenced record does not exist"), err)
+	case Code(err) == LockNotAvailable:
+		return apierr.New(apierr.ResourceLocked, "Resource is being changed by another request, re-read it before retrying")
+	case IsRetryable(err):
+		return apierr.New(apierr.ConcurrentUpdate, "Concurrent update, retry the request")
+	case IsConnectionLost(err):
+		return apierr.New(apierr.DatabaseUnavailable, "Database is unavailable")
+	}
+	return nil
+}
+
+func withConstraint(e *apierr.Error, err error) *apierr.Error {
+	if c := Constraint(err); c != "" {
+		return e.With("constraint", c)
+	}
+	return e
+}
+
+// Array — приёмник для Scan, читающий массив Postgres в срез:
+// rows.Scan(pg.Array(&o.Tags)). dst — указатель на срез ([]string,
+// []int64, ...); NULL даёт nil-срез.
+func Array(dst interface{}) sql.Scanner {
+	return pgtype.NewMap().SQLScanner(dst)
+}
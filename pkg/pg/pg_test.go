@@ -0,0 +1,32 @@
+package pg
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"pkg/apierr"
+)
+
+func TestAPIErrorLockConflicts(t *testing.T) {
+	cases := []struct {
+		code   string
+		want   apierr.Code
+		status int
+	}{
+		{LockNotAvailable, apierr.ResourceLocked, http.StatusConflict},
+		{SerializationFailure, apierr.ConcurrentUpdate, http.StatusServiceUnavailable},
+		{DeadlockDetected, apierr.ConcurrentUpdate, http.StatusServiceUnavailable},
+	}
+	for _, c := range cases {
+		err := fmt.Errorf("update payment: %w", &pgconn.PgError{Code: c.code})
+		got := APIError(err)
+		if got == nil {
+			t.Fatalf("%s: not translated", c.code)
+		}
+		if got.Code != c.want || got.Status() != c.status {
+			t.Errorf("%s: got %s/%d, want %s/%d", c.code, got.Code, got.Status(), c.want, c.status)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Package pgnotify раздаёт события, опубликованные через Postgres NOTIFY,
+// подписчикам внутри реплики. NOTIFY доходит до всех реплик, подключённых
+// к той же базе, поэтому событие, записанное одной репликой, увидят все.
+package pgnotify
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Event — конверт сообщения: Key определяет подписчиков (обычно id ресурса),
+// Type — вид события, Data — полезная нагрузка.
+type Event struct {
+	Key  string          `json:"key"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Execer — *sql.DB или *sql.Tx.
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Notify публикует событие. Внутри транзакции подписчики получат его
+// только после коммита.
+func Notify(ex Execer, channel, key, typ string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(Event{Key: key, Type: typ, Data: raw})
+	if err != nil {
+		return err
+	}
+	_, err = ex.Exec("SELECT pg_notify($1, $2)", channel, string(payload))
+	return err
+}
+
+type Feed struct {
+	channel string
+
+	mu     sync.Mutex
+	subs   map[string]map[chan Event]struct{}
+	done   chan struct{}
+	closed bool
+}
+
+func NewFeed(channel string) *Feed {
+	return &Feed{
+		channel: channel,
+		subs:    make(map[string]map[chan Event]struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Subscribe возвращает канал событий по key и функцию отписки.
+func (f *Feed) Subscribe(key string) (<-chan Event, func()) {
+	ch := make(chan Event, 8)
+	f.mu.Lock()
+	if f.subs[key] == nil {
+		f.subs[key] = make(map[chan Event]struct{})
+	}
+	f.subs[key][ch] = struct{}{}
+	f.mu.Unlock()
+
+	return ch, func() {
+		f.mu.Lock()
+		delete(f.subs[key], ch)
+		if len(f.subs[key]) == 0 {
+			delete(f.subs, key)
+		}
+		f.mu.Unlock()
+	}
+}
+
+// Publish отдаёт событие локальным подписчикам.
+func (f *Feed) Publish(ev Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subs[ev.Key] {
+		select {
+		case ch <- ev:
+		default:
+			// медленный подписчик пропускает событие, а не блокирует остальных
+		}
+	}
+}
+
+// Done закрывается при остановке сервиса.
+func (f *Feed) Done() <-chan struct{} {
+	return f.done
+}
+
+func (f *Feed) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.closed {
+		f.closed = true
+		close(f.done)
+	}
+}
+
+// Listen подписывается на канал Postgres и публикует входящие события,
+// пока Feed не закрыт. Первое подключение — синхронно (ошибка
+// возвращается); при разрыве соединение восстанавливается с паузой от 10
+// секунд до минуты.
+func (f *Feed) Listen(databaseURL string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	conn, err := f.connect(ctx, databaseURL)
+	if err != nil {
+		cancel()
+		return err
+	}
+	go func() {
+		<-f.done
+		cancel()
+	}()
+	go f.receive(ctx, databaseURL, conn)
+	return nil
+}
+
+func (f *Feed) connect(ctx context.Context, databaseURL string) (*pgx.Conn, error) {
+	conn, err := pgx.Connect(ctx, databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{f.channel}.Sanitize()); err != nil {
+		conn.Close(context.Background())
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (f *Feed) receive(ctx context.Context, databaseURL string, conn *pgx.Conn) {
+	const minReconnect, maxReconnect = 10 * time.Second, time.Minute
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err == nil {
+			var ev Event
+			if err := json.Unmarshal([]byte(n.Payload), &ev); err != nil {
+				log.Printf("⚠️ Bad notification on %s: %v", f.channel, err)
+				continue
+			}
+			f.Publish(ev)
+			continue
+		}
+		conn.Close(context.Background())
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("⚠️ Listener %s: %v", f.channel, err)
+
+		// Переподключение; события за время разрыва потеряны.
+		for wait := minReconnect; ; wait = min(wait*2, maxReconnect) {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			if conn, err = f.connect(ctx, databaseURL); err == nil {
+				break
+			}
+			log.Printf("⚠️ Listener %s: reconnect failed: %v", f.channel, err)
+		}
+	}
+}
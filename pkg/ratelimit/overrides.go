@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"pkg/admin"
+	"pkg/apierr"
+)
+
+// UserLimits — действующие лимиты пользователя по группам и группы, для
+// которых они переопределены.
+type UserLimits struct {
+	UserID     string          `json:"user_id"`
+	Limits     map[string]Rule `json:"limits"`
+	Overridden []string        `json:"overridden"`
+}
+
+// Limits возвращает действующие лимиты пользователя.
+func (l *Limiter) Limits(ctx context.Context, user string) (UserLimits, error) {
+	fields := make([]string, len(Groups))
+	for i, g := range Groups {
+		fields[i] = user + ":" + g
+	}
+	vals, err := l.rdb.HMGet(ctx, overridesKey, fields...).Result()
+	if err != nil {
+		return UserLimits{}, err
+	}
+	out := UserLimits{UserID: user, Limits: map[string]Rule{}, Overridden: []string{}}
+	for i, g := range Groups {
+		out.Limits[g] = l.defaults[g]
+		s, _ := vals[i].(string)
+		n, w, ok := strings.Cut(s, ":")
+		limit, err1 := strconv.Atoi(n)
+		window, err2 := strconv.ParseInt(w, 10, 64)
+		if !ok || err1 != nil || err2 != nil {
+			continue
+		}
+		out.Limits[g] = Rule{Limit: limit, Window: time.Duration(window) * time.Millisecond}
+		out.Overridden = append(out.Overridden, g)
+	}
+	return out, nil
+}
+
+// SetOverride задаёт лимит группы для пользователя на всех сервисах.
+func (l *Limiter) SetOverride(ctx context.Context, user, group string, r Rule) error {
+	v := strconv.Itoa(r.Limit) + ":" + strconv.FormatInt(r.Window.Milliseconds(), 10)
+	return l.rdb.HSet(ctx, overridesKey, user+":"+group, v).Err()
+}
+
+// ClearOverrides возвращает пользователю лимиты по умолчанию.
+func (l *Limiter) ClearOverrides(ctx context.Context, user string) error {
+	fields := make([]string, len(Groups))
+	for i, g := range Groups {
+		fields[i] = user + ":" + g
+	}
+	return l.rdb.HDel(ctx, overridesKey, fields...).Err()
+}
+
+// Handler — /admin/rate-limits/users/{id}: GET возвращает действующие
+// лимиты пользователя, PUT с телом {"read": "1000/1m", "write": "0"}
+// переопределяет перечисленные группы ("0" — без ограничения), DELETE
+// снимает переопределения. Маршрут подключается через admin.RequireKey.
+// Без Redis отвечает 403 feature_disabled.
+func (l *Limiter) Handler(w http.ResponseWriter, r *http.Request) {
+	if l == nil {
+		apierr.Write(w, apierr.FeatureDisabled, "Rate limiting disabled: REDIS_URL not set")
+		return
+	}
+	user := mux.Vars(r)["id"]
+	ctx := r.Context()
+	switch r.Method {
+	case http.MethodPut:
+		var body map[string]Rule
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			apierr.Write(w, apierr.InvalidRequest, err.Error())
+			return
+		}
+		for g := range body {
+			if g != Read && g != Write {
+				apierr.Write(w, apierr.InvalidRequest, "unknown rate limit group "+strconv.Quote(g)+"; want read or write")
+				return
+			}
+		}
+		for g, rule := range body {
+			if err := l.SetOverride(ctx, user, g, rule); err != nil {
+				apierr.Internal(w, err)
+				return
+			}
+			log.Printf("🚦 Rate limit override for user %s: %s = %s by %s", user, g, rule, admin.Actor(r))
+		}
+	case http.MethodDelete:
+		if err := l.ClearOverrides(ctx, user); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		log.Printf("🚦 Rate limit overrides cleared for user %s by %s", user, admin.Actor(r))
+	}
+	limits, err := l.Limits(ctx, user)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(limits)
+}
@@ -0,0 +1,316 @@
+// Package ratelimit — лимит запросов на пользователя, общий для всех
+// реплик сервиса: окна хранятся в Redis и проверяются одним Lua-скриптом
+// (скользящее окно), поэтому две реплики не пропустят больше лимита на
+// двоих. Клиент — subject JWT, для анонимных запросов — адрес клиента.
+// Лимиты раздельные для чтения (GET, HEAD, OPTIONS) и записи (остальные
+// методы); для отдельных пользователей их можно переопределить через
+// /admin/rate-limits/users/{id}.
+//
+// Сверх лимита — 429 rate_limited с Retry-After; разрешённые ответы несут
+// RateLimit-Limit, RateLimit-Remaining и RateLimit-Reset. Если Redis
+// недоступен, запрос пропускается (fail open) и учитывается в
+// ratelimit_requests_total{result="fail_open"}. Nil *Limiter допустим и
+// означает, что лимит выключен.
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+	"pkg/admin"
+	"pkg/apierr"
+	"pkg/auth"
+)
+
+var decisions = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "ratelimit_requests_total",
+	Help: "Requests checked by the rate limiter by group and result: allowed, limited, fail_open.",
+}, []string{"group", "result"})
+
+// Группы маршрутов со своими лимитами.
+const (
+	Read  = "read"
+	Write = "write"
+)
+
+// Groups — все группы маршрутов.
+var Groups = []string{Read, Write}
+
+// checkTimeout — сколько запрос ждёт Redis, прежде чем пройти без
+// проверки.
+const checkTimeout = 200 * time.Millisecond
+
+// overridesKey — хэш переопределений: поле "<user>:<group>", значение
+// "<limit>:<window_ms>". Общий для всех сервисов.
+const overridesKey = "ratelimit:overrides"
+
+// slidingWindow проверяет и учитывает запрос атомарно.
+// KEYS[1] — окно клиента (ZSET отметок времени), KEYS[2] — overridesKey.
+// ARGV: now_ms, limit, window_ms, поле переопределения ("" — нет), member.
+// Возвращает {allowed, limit, remaining, reset_ms}; limit 0 — без
+// ограничения.
+var slidingWindow = redis.NewScript(`
+local limit = tonumber(ARGV[2])
+local window = tonumber(ARGV[3])
+if ARGV[4] ~= '' then
+  local o = redis.call('HGET', KEYS[2], ARGV[4])
+  if o then
+    local l, w = string.match(o, '^(%d+):(%d+)$')
+    if l then
+      limit = tonumber(l)
+      window = tonumber(w)
+    end
+  end
+end
+if limit == 0 then
+  return {1, 0, 0, 0}
+end
+local now = tonumber(ARGV[1])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if count < limit then
+  redis.call('ZADD', KEYS[1], now, ARGV[5])
+  count = count + 1
+  allowed = 1
+end
+redis.call('PEXPIRE', KEYS[1], window)
+local reset = window
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+if oldest[2] then
+  reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, limit, limit - count, reset}
+`)
+
+// Rule — не больше Limit запросов за скользящее окно Window. Limit 0 —
+// без ограничения.
+type Rule struct {
+	Limit  int
+	Window time.Duration
+}
+
+// ParseRule разбирает "<limit>/<window>", например "300/1m"; "0" — без
+// ограничения.
+func ParseRule(s string) (Rule, error) {
+	s = strings.TrimSpace(s)
+	if s == "0" {
+		return Rule{}, nil
+	}
+	n, w, ok := strings.Cut(s, "/")
+	if !ok {
+		return Rule{}, fmt.Errorf("rate limit %q: want <limit>/<window>, e.g. 300/1m", s)
+	}
+	limit, err := strconv.Atoi(n)
+	if err != nil || limit < 0 {
+		return Rule{}, fmt.Errorf("rate limit %q: limit must be a non-negative integer", s)
+	}
+	window, err := time.ParseDuration(w)
+	if err != nil || window < time.Millisecond {
+		return Rule{}, fmt.Errorf("rate limit %q: window must be a duration of at least 1ms", s)
+	}
+	if limit == 0 {
+		return Rule{}, nil
+	}
+	return Rule{Limit: limit, Window: window}, nil
+}
+
+func (r Rule) String() string {
+	if r.Limit == 0 {
+		return "0"
+	}
+	// 1m0s → 1m, 1h0m0s → 1h.
+	w := r.Window.String()
+	if strings.HasSuffix(w, "m0s") {
+		w = strings.TrimSuffix(w, "0s")
+	}
+	if strings.HasSuffix(w, "h0m") {
+		w = strings.TrimSuffix(w, "0m")
+	}
+	return strconv.Itoa(r.Limit) + "/" + w
+}
+
+func (r Rule) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Rule) UnmarshalText(b []byte) error {
+	v, err := ParseRule(string(b))
+	if err != nil {
+		return err
+	}
+	*r = v
+	return nil
+}
+
+type Limiter struct {
+	rdb      *redis.Client
+	name     string
+	defaults map[string]Rule
+	instance string
+	seq      atomic.Uint64
+	now      func() time.Time
+
+	mu         sync.Mutex
+	lastLogged time.Time
+}
+
+// FromEnv подключается к REDIS_URL; лимиты по умолчанию —
+// RATE_LIMIT_READ (300/1m) и RATE_LIMIT_WRITE (60/1m). Окна ведутся
+// отдельно для каждого сервиса name. Возвращает nil, если REDIS_URL не
+// задан.
+func FromEnv(name string) (*Limiter, error) {
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		return nil, nil
+	}
+
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, err
+	}
+	defaults := map[string]Rule{Read: {300, time.Minute}, Write: {60, time.Minute}}
+	for group, env := range map[string]string{Read: "RATE_LIMIT_READ", Write: "RATE_LIMIT_WRITE"} {
+		if v := os.Getenv(env); v != "" {
+			if defaults[group], err = ParseRule(v); err != nil {
+				return nil, fmt.Errorf("%s: %w", env, err)
+			}
+		}
+	}
+	id := make([]byte, 4)
+	rand.Read(id)
+	return &Limiter{
+		rdb:      redis.NewClient(opts),
+		name:     name,
+		defaults: defaults,
+		instance: hex.EncodeToString(id),
+		now:      time.Now,
+	}, nil
+}
+
+func (l *Limiter) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.rdb.Close()
+}
+
+// exempt — служебные маршруты и вызовы сервисов друг другу (с
+// внутренним ключом) не ограничиваются.
+func exempt(r *http.Request) bool {
+	path := r.URL.Path
+	return path == "/health" || path == "/ready" || path == "/health/ready" || path == "/metrics" ||
+		strings.HasPrefix(path, "/admin/") || admin.HasKey(r)
+}
+
+func groupOf(r *http.Request) string {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return Read
+	}
+	return Write
+}
+
+// client — ключ клиента и id пользователя ("" для анонимных запросов).
+// Нужен auth.Middleware раньше в цепочке.
+func client(r *http.Request) (key, user string) {
+	if c := auth.FromContext(r.Context()); c != nil && c.Subject != "" {
+		return "user:" + c.Subject, c.Subject
+	}
+	addr := r.Header.Get("X-Real-IP")
+	if addr == "" {
+		addr, _, _ = net.SplitHostPort(r.RemoteAddr)
+	}
+	return "ip:" + addr, ""
+}
+
+type result struct {
+	allowed   bool
+	limit     int
+	remaining int
+	reset     time.Duration
+}
+
+// check учитывает запрос клиента в окне группы.
+func (l *Limiter) check(ctx context.Context, group, key, user string) (result, error) {
+	rule := l.defaults[group]
+	field := ""
+	if user != "" {
+		field = user + ":" + group
+	}
+	now := l.now().UnixMilli()
+	member := fmt.Sprintf("%d-%s-%d", now, l.instance, l.seq.Add(1))
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	v, err := slidingWindow.Run(ctx, l.rdb,
+		[]string{"ratelimit:" + l.name + ":" + group + ":" + key, overridesKey},
+		now, rule.Limit, rule.Window.Milliseconds(), field, member).Int64Slice()
+	if err != nil {
+		return result{}, err
+	}
+	return result{allowed: v[0] == 1, limit: int(v[1]), remaining: int(v[2]), reset: time.Duration(v[3]) * time.Millisecond}, nil
+}
+
+// logFailure пишет ошибку Redis в журнал не чаще раза в 10 секунд: при
+// недоступном Redis она повторяется на каждом запросе.
+func (l *Limiter) logFailure(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Since(l.lastLogged) < 10*time.Second {
+		return
+	}
+	l.lastLogged = time.Now()
+	log.Printf("⚠️ Rate limit check failed, letting requests through: %v", err)
+}
+
+// Middleware отвечает 429 rate_limited, когда клиент исчерпал лимит
+// группы. Подключается через router.Use после auth.Middleware.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if exempt(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		group := groupOf(r)
+		key, user := client(r)
+		res, err := l.check(r.Context(), group, key, user)
+		if err != nil {
+			decisions.WithLabelValues(group, "fail_open").Inc()
+			l.logFailure(err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if res.limit > 0 {
+			reset := strconv.Itoa(int(math.Ceil(res.reset.Seconds())))
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.remaining))
+			w.Header().Set("RateLimit-Reset", reset)
+			if !res.allowed {
+				decisions.WithLabelValues(group, "limited").Inc()
+				w.Header().Set("Retry-After", reset)
+				apierr.Write(w, apierr.RateLimited, "Rate limit exceeded")
+				return
+			}
+		}
+		decisions.WithLabelValues(group, "allowed").Inc()
+		next.ServeHTTP(w, r)
+	})
+}
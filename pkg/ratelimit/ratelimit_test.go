@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// replicas — два лимитера на одном Redis, как у двух реплик сервиса.
+func replicas(t *testing.T) (mr *miniredis.Miniredis, a, b *Limiter) {
+	t.Helper()
+	mr = miniredis.RunT(t)
+	t.Setenv("REDIS_URL", "redis://"+mr.Addr())
+	t.Setenv("RATE_LIMIT_READ", "3/1m")
+	t.Setenv("RATE_LIMIT_WRITE", "1/1m")
+	var err error
+	if a, err = FromEnv("orders"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = FromEnv("orders"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close(); b.Close() })
+	return mr, a, b
+}
+
+func do(l *Limiter, method string) *httptest.ResponseRecorder {
+	h := l.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	req := httptest.NewRequest(method, "/orders", nil)
+	req.Header.Set("X-Real-IP", "10.0.0.1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestLimitSharedAcrossReplicas — лимит один на все реплики, чтение и
+// запись считаются отдельно.
+func TestLimitSharedAcrossReplicas(t *testing.T) {
+	_, a, b := replicas(t)
+	for i, l := range []*Limiter{a, b, a} {
+		if rec := do(l, "GET"); rec.Code != http.StatusOK {
+			t.Fatalf("read %d: status %d, want 200", i+1, rec.Code)
+		}
+	}
+	rec := do(b, "GET")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("read over limit: status %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" || rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("429 headers: %v", rec.Header())
+	}
+	if rec := do(a, "POST"); rec.Code != http.StatusOK {
+		t.Fatalf("write after reads: status %d, want 200", rec.Code)
+	}
+}
+
+// TestUserOverride — переопределение действует на пользователя на всех
+// репликах; "0" снимает ограничение.
+func TestUserOverride(t *testing.T) {
+	_, a, b := replicas(t)
+	ctx := context.Background()
+	if err := a.SetOverride(ctx, "42", Write, Rule{Limit: 2, Window: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if res, _ := b.check(ctx, Write, "user:42", "42"); !res.allowed || res.limit != 2 {
+			t.Fatalf("write %d under override: %+v", i+1, res)
+		}
+	}
+	if res, _ := b.check(ctx, Write, "user:42", "42"); res.allowed {
+		t.Fatal("write over override allowed")
+	}
+	if res, _ := b.check(ctx, Write, "user:7", "7"); !res.allowed || res.limit != 1 {
+		t.Fatalf("other user: %+v, want default limit 1", res)
+	}
+
+	a.SetOverride(ctx, "42", Write, Rule{})
+	if res, _ := b.check(ctx, Write, "user:42", "42"); !res.allowed || res.limit != 0 {
+		t.Fatalf("unlimited override: %+v", res)
+	}
+	a.ClearOverrides(ctx, "42")
+	limits, err := a.Limits(ctx, "42")
+	if err != nil || len(limits.Overridden) != 0 || limits.Limits[Write].Limit != 1 {
+		t.Fatalf("after clear: %+v, %v", limits, err)
+	}
+}
+
+// TestFailOpen — без Redis запросы проходят.
+func TestFailOpen(t *testing.T) {
+	mr, a, _ := replicas(t)
+	mr.Close()
+	for i := 0; i < 3; i++ {
+		if rec := do(a, "POST"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d with Redis down: status %d, want 200", i+1, rec.Code)
+		}
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	for in, want := range map[string]string{"300/1m": "300/1m", "10/1h0m0s": "10/1h", "5/90s": "5/1m30s", "0": "0"} {
+		r, err := ParseRule(in)
+		if err != nil || r.String() != want {
+			t.Errorf("ParseRule(%q) = %v, %v; want %s", in, r, err, want)
+		}
+	}
+	for _, in := range []string{"300", "x/1m", "10/0s", "-1/1m"} {
+		if _, err := ParseRule(in); err == nil {
+			t.Errorf("ParseRule(%q): want error", in)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Package redact маскирует номера банковских карт (PAN) в строках и логах.
+//
+// Номером карты считается последовательность из 13–19 цифр, возможно
+// разделённых пробелами или дефисами, проходящая проверку Луна. Такая
+// последовательность заменяется на "••••" и четыре последние цифры.
+package redact
+
+import (
+	"io"
+	"regexp"
+	"strings"
+)
+
+var panPattern = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+
+// Digits убирает из номера пробелы и дефисы.
+func Digits(s string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(s)
+}
+
+// Luhn проверяет контрольную цифру номера, состоящего только из цифр.
+func Luhn(digits string) bool {
+	if digits == "" {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		c := digits[i]
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// Mask — маскированная форма номера: "••••4242".
+func Mask(digits string) string {
+	if len(digits) < 4 {
+		return "••••"
+	}
+	return "••••" + digits[len(digits)-4:]
+}
+
+// String заменяет все похожие на номер карты фрагменты s маской.
+func String(s string) string {
+	return panPattern.ReplaceAllStringFunc(s, func(m string) string {
+		d := Digits(m)
+		if len(d) < 13 || !Luhn(d) {
+			return m
+		}
+		return Mask(d)
+	})
+}
+
+type writer struct {
+	w io.Writer
+}
+
+// Writer оборачивает w так, что записываемые данные проходят через
+// String. Пакет log пишет каждую запись одним вызовом Write, поэтому
+// номер не разрывается между вызовами:
+//
+//	log.SetOutput(redact.Writer(os.Stderr))
+func Writer(w io.Writer) io.Writer {
+	return writer{w: w}
+}
+
+func (r writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
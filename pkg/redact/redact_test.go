@@ -0,0 +1,56 @@
+package redact
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{"card 4242424242424242 declined", "card ••••4242 declined"},
+		{"card 4242 4242 4242 4242", "card ••••4242"},
+		{"card 5555-5555-5555-4444", "card ••••4444"},
+		{`{"number":"2200000000000004"}`, `{"number":"••••0004"}`},
+		{"amex 378282246310005, visa 4000000000000002", "amex ••••0005, visa ••••0002"},
+		// Не проходит проверку Луна — не номер карты.
+		{"order 4242424242424241", "order 4242424242424241"},
+		// Короче 13 цифр: телефоны, суммы, id.
+		{"phone 79161234567, order 123456", "phone 79161234567, order 123456"},
+		// Длиннее 19 цифр — не номер карты.
+		{"trace 42424242424242424242424", "trace 42424242424242424242424"},
+	}
+	for _, c := range cases {
+		if got := String(c.in); got != c.want {
+			t.Errorf("String(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestLuhn(t *testing.T) {
+	for digits, want := range map[string]bool{
+		"4242424242424242": true,
+		"4242424242424241": false,
+		"79927398713":      true,
+		"":                 false,
+		"4242x42424242424": false,
+	} {
+		if got := Luhn(digits); got != want {
+			t.Errorf("Luhn(%q) = %v, want %v", digits, got, want)
+		}
+	}
+}
+
+func TestWriterRedactsLog(t *testing.T) {
+	var buf bytes.Buffer
+	l := log.New(Writer(&buf), "", 0)
+	l.Printf("payment failed for card %s", "4242 4242 4242 4242")
+
+	if strings.Contains(buf.String(), "4242 4242 4242 4242") || strings.Contains(buf.String(), "4242424242424242") {
+		t.Fatalf("PAN in log output: %q", buf.String())
+	}
+	if want := "payment failed for card ••••4242\n"; buf.String() != want {
+		t.Errorf("log output %q, want %q", buf.String(), want)
+	}
+}
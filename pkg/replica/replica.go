@@ -0,0 +1,38 @@
+// Package replica — идентификатор экземпляра сервиса. Он есть в /health
+// и в заголовке X-Replica-ID каждого ответа: повторяя любой запрос через
+// балансировщик, видно, как он распределяет трафик.
+package replica
+
+import (
+	"net/http"
+	"os"
+	"sync"
+)
+
+// Header — заголовок ответа с идентификатором реплики.
+const Header = "X-Replica-ID"
+
+var id = sync.OnceValue(func() string {
+	if v := os.Getenv("REPLICA_ID"); v != "" {
+		return v
+	}
+	if h, err := os.Hostname(); err == nil && h != "" {
+		return h
+	}
+	return "default"
+})
+
+// ID — REPLICA_ID, а если не задан — имя хоста (в Docker — id контейнера).
+func ID() string {
+	return id()
+}
+
+// Middleware добавляет X-Replica-ID к ответу. Оборачивает весь роутер, а
+// не подключается через router.Use: так заголовок есть и у 404/405, и у
+// ответов, которыми запрос отклонили другие middleware.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(Header, ID())
+		next.ServeHTTP(w, r)
+	})
+}
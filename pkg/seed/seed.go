@@ -0,0 +1,246 @@
+// Package seed генерирует согласованные демо-данные для всех сервисов.
+//
+// Набор полностью определяется Config: одинаковые seed и количества дают
+// одинаковые записи с одинаковыми id в каждом сервисе, поэтому заказы
+// ссылаются на существующих пользователей, а платежи и доставки — на
+// существующие заказы. Id демо-записей начинаются с IDBase, чтобы не
+// пересекаться с обычными данными.
+package seed
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+
+	"pkg/apierr"
+)
+
+// IDBase — первый id демо-записей в каждой таблице.
+const IDBase = 1_000_000
+
+// BatchSize — сколько строк вставляется одним INSERT.
+const BatchSize = 500
+
+const maxRecords = 100_000
+
+type Config struct {
+	Seed   int64 `json:"seed"`
+	Users  int   `json:"users"`
+	Orders int   `json:"orders"`
+	// Reset удаляет ранее созданные демо-записи (id >= IDBase) перед вставкой.
+	Reset bool `json:"reset"`
+}
+
+type User struct {
+	ID    int
+	Email string
+	Name  string
+	Age   int
+}
+
+type Order struct {
+	ID              int
+	UserID          int
+	TotalAmount     float64
+	Status          string
+	ShippingAddress string
+}
+
+type Payment struct {
+	ID            int
+	OrderID       int
+	Amount        float64
+	Status        string
+	PaymentMethod string
+}
+
+type Delivery struct {
+	ID      int
+	OrderID int
+	Address string
+	Status  string
+}
+
+type Dataset struct {
+	Users      []User
+	Orders     []Order
+	Payments   []Payment
+	Deliveries []Delivery
+}
+
+var (
+	firstNames = []string{"Alice", "Boris", "Chen", "Daria", "Emil", "Fatima", "Gleb", "Hana", "Ivan", "Julia", "Kirill", "Lena", "Marat", "Nina", "Oleg", "Polina"}
+	lastNames  = []string{"Ivanov", "Smirnova", "Kuznetsov", "Popova", "Sokolov", "Lebedeva", "Kozlov", "Novikova", "Morozov", "Volkova"}
+	streets    = []string{"Lenina", "Gagarina", "Pushkina", "Sadovaya", "Mira", "Tverskaya", "Nevsky prospekt", "Arbat"}
+	cities     = []string{"Moscow", "Saint Petersburg", "Kazan", "Novosibirsk", "Yekaterinburg", "Samara"}
+	methods    = []string{"card", "cash", "paypal"}
+)
+
+// Generate строит набор данных. Один и тот же Config всегда даёт один и
+// тот же результат.
+func Generate(cfg Config) Dataset {
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	var ds Dataset
+
+	for i := 0; i < cfg.Users; i++ {
+		first := firstNames[rng.Intn(len(firstNames))]
+		last := lastNames[rng.Intn(len(lastNames))]
+		ds.Users = append(ds.Users, User{
+			ID:    IDBase + i,
+			Email: fmt.Sprintf("%s.%s.%d@demo.example", strings.ToLower(first), strings.ToLower(last), IDBase+i),
+			Name:  first + " " + last,
+			Age:   18 + rng.Intn(60),
+		})
+	}
+	if cfg.Users == 0 {
+		return ds
+	}
+
+	for i := 0; i < cfg.Orders; i++ {
+		o := Order{
+			ID:          IDBase + i,
+			UserID:      IDBase + rng.Intn(cfg.Users),
+			TotalAmount: math.Round((5+rng.Float64()*495)*100) / 100,
+			ShippingAddress: fmt.Sprintf("%d %s st., %s",
+				1+rng.Intn(200), streets[rng.Intn(len(streets))], cities[rng.Intn(len(cities))]),
+		}
+		// Распределение статусов: большинство заказов уже оплачены.
+		switch r := rng.Intn(100); {
+		case r < 15:
+			o.Status = "pending"
+		case r < 25:
+			o.Status = "cancelled"
+		case r < 50:
+			o.Status = "confirmed"
+		case r < 75:
+			o.Status = "shipped"
+		default:
+			o.Status = "delivered"
+		}
+		ds.Orders = append(ds.Orders, o)
+
+		if o.Status == "pending" || o.Status == "cancelled" {
+			continue
+		}
+		ds.Payments = append(ds.Payments, Payment{
+			ID:            IDBase + len(ds.Payments),
+			OrderID:       o.ID,
+			Amount:        o.TotalAmount,
+			Status:        "completed",
+			PaymentMethod: methods[rng.Intn(len(methods))],
+		})
+
+		d := Delivery{ID: IDBase + len(ds.Deliveries), OrderID: o.ID, Address: o.ShippingAddress}
+		switch o.Status {
+		case "confirmed":
+			d.Status = "pending"
+		case "shipped":
+			d.Status = "in_transit"
+		default:
+			d.Status = "delivered"
+		}
+		ds.Deliveries = append(ds.Deliveries, d)
+	}
+	return ds
+}
+
+// Report — результат заполнения одной таблицы.
+type Report struct {
+	Table   string `json:"table"`
+	Created int64  `json:"created"`
+	Skipped int64  `json:"skipped"`
+	Deleted int64  `json:"deleted"`
+}
+
+// Insert вставляет rows в table пачками по BatchSize в одной транзакции.
+// Первая колонка — id; строки, конфликтующие с существующими (id или
+// уникальные поля), пропускаются, поэтому повторный запуск с тем же seed
+// ничего не меняет. reset сначала удаляет все строки с id >= IDBase.
+// Последовательность id не сдвигается: обычные записи продолжают
+// нумероваться как раньше.
+func Insert(ctx context.Context, db *sql.DB, table string, columns []string, rows [][]interface{}, reset bool) (Report, error) {
+	rep := Report{Table: table}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return rep, err
+	}
+	defer tx.Rollback()
+
+	if reset {
+		res, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE id >= $1", IDBase)
+		if err != nil {
+			return rep, fmt.Errorf("reset %s: %w", table, err)
+		}
+		rep.Deleted, _ = res.RowsAffected()
+	}
+
+	for start := 0; start < len(rows); start += BatchSize {
+		batch := rows[start:min(start+BatchSize, len(rows))]
+		var (
+			values []string
+			args   []interface{}
+		)
+		for _, row := range batch {
+			ph := make([]string, len(row))
+			for i, v := range row {
+				args = append(args, v)
+				ph[i] = fmt.Sprintf("$%d", len(args))
+			}
+			values = append(values, "("+strings.Join(ph, ", ")+")")
+		}
+
+		res, err := tx.ExecContext(ctx,
+			"INSERT INTO "+table+" ("+strings.Join(columns, ", ")+") VALUES "+strings.Join(values, ", ")+" ON CONFLICT DO NOTHING",
+			args...)
+		if err != nil {
+			return rep, fmt.Errorf("insert %s: %w", table, err)
+		}
+		n, _ := res.RowsAffected()
+		rep.Created += n
+		rep.Skipped += int64(len(batch)) - n
+	}
+
+	return rep, tx.Commit()
+}
+
+// Handler — POST /admin/seed с телом Config. insert вставляет свою часть
+// набора (существующие id пропускаются) и возвращает отчёт. В production
+// (APP_ENV=production) маршрут отключён. Подключается через
+// admin.RequireKey.
+func Handler(insert func(ctx context.Context, ds Dataset, reset bool) ([]Report, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if os.Getenv("APP_ENV") == "production" {
+			apierr.Write(w, apierr.FeatureDisabled, "Seeding is disabled in production")
+			return
+		}
+
+		cfg := Config{Seed: 1, Users: 50, Orders: 200}
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			apierr.Write(w, apierr.InvalidRequest, err.Error())
+			return
+		}
+		if cfg.Users < 0 || cfg.Orders < 0 || cfg.Users > maxRecords || cfg.Orders > maxRecords {
+			apierr.Write(w, apierr.InvalidRequest, fmt.Sprintf("users and orders must be within 0-%d", maxRecords))
+			return
+		}
+
+		reports, err := insert(r.Context(), Generate(cfg), cfg.Reset)
+		if err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		for _, rep := range reports {
+			log.Printf("🌱 Seeded %s: created=%d skipped=%d deleted=%d (seed %d)", rep.Table, rep.Created, rep.Skipped, rep.Deleted, cfg.Seed)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"seed": cfg, "tables": reports})
+	}
+}
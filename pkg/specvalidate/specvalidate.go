@@ -0,0 +1,306 @@
+// Package specvalidate сверяет запросы и ответы сервиса с его
+// OpenAPI-документом, чтобы ручная валидация не расходилась со Swagger.
+//
+// Сервисы отдают Swagger 2.0 (swag); документ один раз при старте
+// переводится в OpenAPI 3 и компилируется вместе с маршрутизатором —
+// на запросе ничего не разбирается заново. Маршруты, которых нет в
+// документе (/health, /metrics, /swagger/), не проверяются.
+package specvalidate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi2"
+	"github.com/getkin/kin-openapi/openapi2conv"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"pkg/apierr"
+	"pkg/observe"
+)
+
+// Mode — что делать с запросом, не совпавшим с документом.
+type Mode string
+
+const (
+	Off     Mode = "off"
+	LogOnly Mode = "log"
+	Enforce Mode = "enforce"
+)
+
+// maxResponseCapture — ответы длиннее не проверяются: копия тела держится
+// в памяти до конца запроса.
+const maxResponseCapture = 1 << 20
+
+var failures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "openapi_validation_failures_total",
+	Help: "Requests and responses that do not match the OpenAPI document.",
+}, []string{"kind", "mode"})
+
+// Violation — одно расхождение с документом. Location — где в запросе
+// (query.limit, path.id, body/user_id, header.X-Request-ID); Schema — путь
+// нарушенного правила в схеме (например, properties/user_id/type).
+type Violation struct {
+	Location string `json:"location"`
+	Schema   string `json:"schema,omitempty"`
+	Message  string `json:"message"`
+}
+
+// Validator проверяет запросы и, если включено, ответы по скомпилированному
+// документу.
+type Validator struct {
+	mode      Mode
+	responses bool
+	router    routers.Router
+	options   *openapi3filter.Options
+}
+
+// FromEnv собирает Validator по настройкам сервиса:
+//
+//   - OPENAPI_VALIDATION — off (по умолчанию), log (только журнал и
+//     метрика, для раскатки) или enforce (400 invalid_request со списком
+//     нарушений);
+//   - OPENAPI_RESPONSE_VALIDATION=true — сверять и ответы (только журнал);
+//     для dev и test, при APP_ENV=production игнорируется.
+//
+// swagger — Swagger 2.0 JSON сервиса (docs.SwaggerInfo.ReadDoc()). Nil
+// означает, что проверка выключена.
+func FromEnv(swagger string) (*Validator, error) {
+	mode := Mode(strings.ToLower(os.Getenv("OPENAPI_VALIDATION")))
+	switch mode {
+	case "", Off:
+		return nil, nil
+	case LogOnly, Enforce:
+	default:
+		return nil, fmt.Errorf("OPENAPI_VALIDATION must be off, log or enforce, got %q", mode)
+	}
+	responses := os.Getenv("OPENAPI_RESPONSE_VALIDATION") == "true"
+	if responses && os.Getenv("APP_ENV") == "production" {
+		log.Printf("⚠️ OPENAPI_RESPONSE_VALIDATION is ignored in production")
+		responses = false
+	}
+	return New([]byte(swagger), mode, responses)
+}
+
+// New компилирует Swagger 2.0 документ.
+func New(swagger []byte, mode Mode, responses bool) (*Validator, error) {
+	// openapi2conv не переводит ссылки внутри additionalProperties
+	// (map[string]T в swag), поэтому ссылки на definitions сразу
+	// указывают туда, где схемы окажутся в OpenAPI 3.
+	swagger = bytes.ReplaceAll(swagger, []byte(`"#/definitions/`), []byte(`"#/components/schemas/`))
+	var doc2 openapi2.T
+	if err := json.Unmarshal(swagger, &doc2); err != nil {
+		return nil, fmt.Errorf("parse swagger: %w", err)
+	}
+	doc, err := openapi2conv.ToV3(&doc2)
+	if err != nil {
+		return nil, fmt.Errorf("convert swagger to openapi 3: %w", err)
+	}
+	// Сервис доступен под разными хостами (напрямую, через nginx), поэтому
+	// сверяется только путь.
+	doc.Servers = openapi3.Servers{{URL: "/"}}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid openapi document: %w", err)
+	}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("build openapi router: %w", err)
+	}
+	return &Validator{
+		mode:      mode,
+		responses: responses,
+		router:    router,
+		options: &openapi3filter.Options{
+			MultiError: true,
+			// Аутентификацию проверяют обработчики и middleware сервиса.
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		},
+	}, nil
+}
+
+// Middleware подключается через router.Use. На nil-Validator запросы
+// проходят без проверки.
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	if v == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, params, err := v.router.FindRoute(r)
+		if err != nil {
+			// Маршрута нет в документе — сверять не с чем.
+			next.ServeHTTP(w, r)
+			return
+		}
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: params,
+			Route:      route,
+			Options:    v.options,
+		}
+		// Тело multipart (загрузка файлов) не сверяется: для этого его
+		// пришлось бы прочитать в память целиком, а обработчик читает его
+		// потоком.
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+			opts := *v.options
+			opts.ExcludeRequestBody = true
+			input.Options = &opts
+		}
+		if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			violations := flatten(err)
+			failures.WithLabelValues("request", string(v.mode)).Inc()
+			log.Printf("⚠️ Request does not match OpenAPI spec: %s %s request_id=%s violations=%s",
+				r.Method, r.URL.Path, observe.RequestID(r.Context()), summary(violations))
+			if v.mode == Enforce {
+				apierr.Respond(w, apierr.New(apierr.InvalidRequest, "Request does not match the API specification").
+					With("violations", violations))
+				return
+			}
+		}
+		if !v.responses || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &responseCapture{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if rec.streaming || rec.overflow {
+			return
+		}
+		out := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 rec.status,
+			Header:                 w.Header(),
+			Options:                v.options,
+		}
+		out.SetBodyBytes(rec.body.Bytes())
+		if err := openapi3filter.ValidateResponse(r.Context(), out); err != nil {
+			failures.WithLabelValues("response", string(v.mode)).Inc()
+			log.Printf("⚠️ Response does not match OpenAPI spec: %s %s status=%d request_id=%s violations=%s",
+				r.Method, r.URL.Path, rec.status, observe.RequestID(r.Context()), summary(flatten(err)))
+		}
+	})
+}
+
+// flatten раскладывает ошибку kin-openapi на отдельные нарушения.
+func flatten(err error) []Violation {
+	var out []Violation
+	var walk func(location string, err error)
+	walk = func(location string, err error) {
+		// Тип проверяется напрямую, а не errors.As: RequestError
+		// разворачивается в свой MultiError, и место ошибки терялось бы.
+		switch e := err.(type) {
+		case openapi3.MultiError:
+			for _, inner := range e {
+				walk(location, inner)
+			}
+		case *openapi3filter.RequestError:
+			loc := "body"
+			if e.Parameter != nil {
+				loc = e.Parameter.In + "." + e.Parameter.Name
+			}
+			if e.Err == nil {
+				out = append(out, Violation{Location: loc, Message: e.Reason})
+				return
+			}
+			walk(loc, e.Err)
+		case *openapi3filter.ResponseError:
+			if e.Err == nil {
+				out = append(out, Violation{Location: "response", Message: e.Reason})
+				return
+			}
+			walk("response", e.Err)
+		case *openapi3.SchemaError:
+			if ptr := e.JSONPointer(); len(ptr) > 0 {
+				location += "/" + strings.Join(ptr, "/")
+			}
+			out = append(out, Violation{
+				Location: location,
+				Schema:   schemaPath(e),
+				Message:  e.Reason,
+			})
+		default:
+			if location == "" {
+				location = "request"
+			}
+			out = append(out, Violation{Location: location, Message: err.Error()})
+		}
+	}
+	walk("", err)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Location < out[j].Location })
+	return out
+}
+
+// schemaPath — путь правила внутри схемы: properties/user_id/type.
+func schemaPath(e *openapi3.SchemaError) string {
+	var parts []string
+	for _, p := range e.JSONPointer() {
+		parts = append(parts, "properties", p)
+	}
+	if e.SchemaField != "" {
+		parts = append(parts, e.SchemaField)
+	}
+	return strings.Join(parts, "/")
+}
+
+func summary(vs []Violation) string {
+	parts := make([]string, len(vs))
+	for i, v := range vs {
+		parts[i] = v.Location + ": " + v.Message
+	}
+	return strings.Join(parts, "; ")
+}
+
+// responseCapture копирует тело ответа для проверки, не задерживая его.
+// Потоковые ответы (Flush, Hijack) и ответы больше maxResponseCapture не
+// проверяются.
+type responseCapture struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+	streaming   bool
+	overflow    bool
+}
+
+func (c *responseCapture) WriteHeader(code int) {
+	if !c.wroteHeader {
+		c.status = code
+		c.wroteHeader = true
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *responseCapture) Write(b []byte) (int, error) {
+	c.wroteHeader = true
+	if !c.overflow {
+		if c.body.Len()+len(b) > maxResponseCapture {
+			c.overflow = true
+			c.body.Reset()
+		} else {
+			c.body.Write(b)
+		}
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+func (c *responseCapture) Flush() {
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		c.streaming = true
+		f.Flush()
+	}
+}
+
+func (c *responseCapture) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
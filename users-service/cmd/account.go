@@ -0,0 +1,76 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+)
+
+// setUserActive меняет is_active. При деактивации в той же транзакции
+// отзываются все сессии: refresh-токены перестают работать сразу.
+func setUserActive(w http.ResponseWriter, r *http.Request, active bool) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var u User
+	err = scanUser(tx.QueryRowContext(r.Context(),
+		"UPDATE users SET is_active = $2, updated_at = NOW() WHERE id = $1 RETURNING "+userColumns,
+		id, active), &u)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.UserNotFound, "User not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if !active {
+		_, err = tx.ExecContext(r.Context(), "UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", id)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	userCache.Delete(r.Context(), strconv.Itoa(id))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u)
+}
+
+// @Summary Deactivate user
+// @Description Приостановить аккаунт без удаления: вход возвращает 403 account_deactivated, все сессии отзываются, orders-service не принимает новые заказы пользователя. Требует X-Internal-API-Key.
+// @Tags users
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} User
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /users/{id}/deactivate [post]
+func deactivateUser(w http.ResponseWriter, r *http.Request) {
+	setUserActive(w, r, false)
+}
+
+// @Summary Activate user
+// @Description Снова разрешить вход деактивированному пользователю. Отозванные сессии не восстанавливаются. Требует X-Internal-API-Key.
+// @Tags users
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} User
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /users/{id}/activate [post]
+func activateUser(w http.ResponseWriter, r *http.Request) {
+	setUserActive(w, r, true)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+	"pkg/admin"
+	"pkg/apierr"
+	"pkg/auth"
+)
+
+// Выпуск токенов. Access-токен не проверяется по БД, поэтому живёт
+// недолго; отзыв сессии действует через refresh-токен.
+var (
+	jwtSecret  []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+)
+
+const minPasswordLength = 8
+
+func initAuth() {
+	jwtSecret = auth.Secret()
+	accessTTL, refreshTTL = cfg.JWTAccessTTL, cfg.JWTRefreshTTL
+}
+
+// TokenPair — ответ /auth/login и /auth/refresh.
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// LoginRequest — тело POST /auth/login.
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// RefreshRequest — тело POST /auth/refresh.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", errors.New("password must be at least 8 characters")
+	}
+	h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(h), err
+}
+
+// newRefreshToken возвращает токен для клиента и его sha256 для БД: сам
+// токен не хранится.
+func newRefreshToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = hex.EncodeToString(b)
+	return token, refreshHash(token), nil
+}
+
+func refreshHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func issueTokens(userID int, sessionID, refresh string) (TokenPair, error) {
+	now := time.Now()
+	access, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(userID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTTL)),
+		},
+	}).SignedString(jwtSecret)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return TokenPair{AccessToken: access, RefreshToken: refresh, TokenType: "Bearer", ExpiresIn: int(accessTTL.Seconds())}, nil
+}
+
+// authorizeUser пропускает владельца аккаунта (sub токена равен id) и
+// запросы с внутренним ключом. Для владельца возвращает его claims, для
+// ключа — пустые.
+func authorizeUser(w http.ResponseWriter, r *http.Request, id int) (*auth.Claims, bool) {
+	if admin.HasKey(r) {
+		return &auth.Claims{}, true
+	}
+	c := auth.FromContext(r.Context())
+	if c == nil {
+		apierr.Write(w, apierr.Unauthorized, "Unauthorized")
+		return nil, false
+	}
+	if c.Subject != strconv.Itoa(id) {
+		apierr.Write(w, apierr.Forbidden, "Forbidden")
+		return nil, false
+	}
+	return c, true
+}
+
+func clientIP(r *http.Request) string {
+	if ip := r.Header.Get("X-Real-IP"); ip != "" {
+		return ip
+	}
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	return ip
+}
+
+func requireJWTSecret(w http.ResponseWriter) bool {
+	if len(jwtSecret) == 0 {
+		apierr.Write(w, apierr.FeatureDisabled, "Authentication disabled: JWT_SECRET not set")
+		return false
+	}
+	return true
+}
+
+// @Summary Login
+// @Description Вход по email и паролю. Возвращает access-токен (JWT, JWT_ACCESS_TTL, по умолчанию 15m) и refresh-токен; каждый вход — отдельная сессия. Если включена 2FA, вместо токенов возвращается 202 {"status": "2fa_required", "challenge_token"}, и вход завершается через POST /auth/login/2fa.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param credentials body LoginRequest true "Credentials"
+// @Success 200 {object} TokenPair
+// @Success 202 {object} TwoFactorChallenge
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string "account_deactivated"
+// @Router /auth/login [post]
+func login(w http.ResponseWriter, r *http.Request) {
+	if !requireJWTSecret(w) {
+		return
+	}
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+
+	var userID int
+	var hash sql.NullString
+	var totpEnabled, active bool
+	err := db.QueryRowContext(r.Context(), "SELECT id, password_hash, totp_enabled, is_active FROM users WHERE email = $1", req.Email).
+		Scan(&userID, &hash, &totpEnabled, &active)
+	if err != nil && err != sql.ErrNoRows {
+		apierr.Internal(w, err)
+		return
+	}
+	if err == sql.ErrNoRows || !hash.Valid || bcrypt.CompareHashAndPassword([]byte(hash.String), []byte(req.Password)) != nil {
+		apierr.Write(w, apierr.InvalidCredentials, "Invalid email or password")
+		return
+	}
+	// Статус сообщается только после проверки пароля, чтобы не выдавать
+	// существование аккаунта.
+	if !active {
+		apierr.Write(w, apierr.AccountDeactivated, "Account is deactivated")
+		return
+	}
+
+	if totpEnabled {
+		challenge, err := issueChallenge(userID)
+		if err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(TwoFactorChallenge{Status: "2fa_required", ChallengeToken: challenge})
+		return
+	}
+	startSession(w, r, userID)
+}
+
+// startSession создаёт сессию входа, отмечает last_login_at и отвечает
+// парой токенов.
+func startSession(w http.ResponseWriter, r *http.Request, userID int) {
+	refresh, refreshSum, err := newRefreshToken()
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	var sessionID string
+	err = db.QueryRowContext(r.Context(),
+		`WITH login AS (UPDATE users SET last_login_at = NOW() WHERE id = $1)
+		 INSERT INTO user_sessions (user_id, refresh_hash, user_agent, ip, expires_at) VALUES ($1, $2, $3, $4, NOW() + $5 * INTERVAL '1 second') RETURNING id`,
+		userID, refreshSum, r.UserAgent(), clientIP(r), refreshTTL.Seconds()).Scan(&sessionID)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	tokens, err := issueTokens(userID, sessionID, refresh)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// @Summary Refresh tokens
+// @Description Обменять refresh-токен на новую пару. Refresh-токен одноразовый: в ответе новый, старый перестаёт работать. Отозванная или истёкшая сессия — 401.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token body RefreshRequest true "Refresh token"
+// @Success 200 {object} TokenPair
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /auth/refresh [post]
+func refreshTokens(w http.ResponseWriter, r *http.Request) {
+	if !requireJWTSecret(w) {
+		return
+	}
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		apierr.Write(w, apierr.InvalidRequest, "refresh_token is required")
+		return
+	}
+
+	refresh, refreshSum, err := newRefreshToken()
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	// Проверка отзыва, ротация и продление — один запрос по уникальному
+	// индексу refresh_hash.
+	var userID int
+	var sessionID string
+	err = db.QueryRowContext(r.Context(),
+		`UPDATE user_sessions SET refresh_hash = $2, last_used_at = NOW(), expires_at = NOW() + $3 * INTERVAL '1 second'
+		 WHERE refresh_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		 RETURNING id, user_id`,
+		refreshHash(req.RefreshToken), refreshSum, refreshTTL.Seconds()).Scan(&sessionID, &userID)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.InvalidRefreshToken, "Invalid or revoked refresh token")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	tokens, err := issueTokens(userID, sessionID, refresh)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
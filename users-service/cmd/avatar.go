@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/image/draw"
+	"pkg/apierr"
+)
+
+const (
+	maxAvatarBytes = 2 << 20
+	// maxAvatarPixels отсекает «бомбы»: маленький файл с огромными
+	// размерами, который раздувается при декодировании.
+	maxAvatarPixels = 4096 * 4096
+)
+
+// avatarSizes — стороны квадратных превью. Исходник не хранится.
+var avatarSizes = map[string]int{
+	"small": 64,
+	"large": 256,
+}
+
+const defaultAvatarSize = "large"
+
+// @Summary Upload avatar
+// @Description Загрузить аватар: multipart-поле avatar, PNG или JPEG до 2 МБ. Тип определяется по содержимому, заголовок Content-Type части не учитывается. Картинка обрезается до квадрата по центру и сохраняется в размерах small (64px) и large (256px); прежние файлы удаляются. Требует Bearer-токен этого пользователя или X-Internal-API-Key.
+// @Tags users
+// @Accept mpfd
+// @Produce json
+// @Param id path int true "User ID"
+// @Param avatar formData file true "Изображение PNG или JPEG"
+// @Success 200 {object} User
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 415 {object} map[string]string "unsupported_media_type"
+// @Router /users/{id}/avatar [put]
+func uploadAvatar(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if _, ok := authorizeUser(w, r, id); !ok {
+		return
+	}
+
+	data, err := readAvatarUpload(w, r)
+	if err != nil {
+		apierr.Respond(w, err)
+		return
+	}
+
+	files, err := renderAvatars(data)
+	if err != nil {
+		apierr.Write(w, apierr.UnsupportedMediaType, err.Error())
+		return
+	}
+
+	// Ключи объектов уникальны для каждой загрузки: новые файлы не
+	// затирают старые, пока строка пользователя не переключена на них.
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	version := hex.EncodeToString(token)
+	prefix := fmt.Sprintf("avatars/%d/%s", id, version)
+	keys := map[string]string{}
+	urls := map[string]string{}
+	for size, f := range files {
+		key := prefix + "-" + size + f.ext
+		if err := avatars.Put(r.Context(), key, f.contentType, f.data); err != nil {
+			deleteAvatarFiles(keys)
+			apierr.Write(w, apierr.UpstreamFailed, "Avatar storage error: "+err.Error())
+			return
+		}
+		keys[size] = key
+		urls[size] = avatarURL(id, size, key, version)
+	}
+
+	var u User
+	oldKeys, err := swapAvatar(r, id, keys, urls, &u)
+	if err != nil {
+		deleteAvatarFiles(keys)
+		if err == sql.ErrNoRows {
+			apierr.Write(w, apierr.UserNotFound, "User not found")
+			return
+		}
+		apierr.Internal(w, err)
+		return
+	}
+	deleteAvatarFiles(oldKeys)
+	userCache.Delete(r.Context(), strconv.Itoa(id))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u)
+}
+
+// @Summary Get avatar
+// @Description Получить аватар в размере size (small или large, по умолчанию large). При хранении в S3 — редирект 302 на публичный URL.
+// @Tags users
+// @Produce png,jpeg
+// @Param id path int true "User ID"
+// @Param size query string false "small или large"
+// @Success 200 {file} binary
+// @Success 302
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /users/{id}/avatar [get]
+func getAvatar(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	size := r.URL.Query().Get("size")
+	if size == "" {
+		size = defaultAvatarSize
+	}
+	if _, ok := avatarSizes[size]; !ok {
+		apierr.Write(w, apierr.InvalidRequest, "size must be small or large")
+		return
+	}
+
+	var key sql.NullString
+	err := db.QueryRowContext(r.Context(), "SELECT avatar_keys->>$2 FROM users WHERE id = $1", id, size).Scan(&key)
+	if err == sql.ErrNoRows || (err == nil && !key.Valid) {
+		apierr.Write(w, apierr.AvatarNotFound, "Avatar not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	if u := avatars.URL(key.String); u != "" {
+		http.Redirect(w, r, u, http.StatusFound)
+		return
+	}
+	local := avatars.(localAvatarStore)
+	f, err := os.Open(local.path(key.String))
+	if err != nil {
+		apierr.Write(w, apierr.AvatarNotFound, "Avatar not found")
+		return
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	// Ключ меняется при каждой загрузке, поэтому файл можно кешировать
+	// надолго: новая загрузка даёт новый URL.
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeContent(w, r, key.String, st.ModTime(), f)
+}
+
+// @Summary Delete avatar
+// @Description Удалить аватар пользователя вместе с файлами. Требует Bearer-токен этого пользователя или X-Internal-API-Key.
+// @Tags users
+// @Param id path int true "User ID"
+// @Success 204
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /users/{id}/avatar [delete]
+func deleteAvatar(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if _, ok := authorizeUser(w, r, id); !ok {
+		return
+	}
+
+	var u User
+	oldKeys, err := swapAvatar(r, id, nil, nil, &u)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.UserNotFound, "User not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if oldKeys == nil {
+		apierr.Write(w, apierr.AvatarNotFound, "Avatar not found")
+		return
+	}
+	deleteAvatarFiles(oldKeys)
+	userCache.Delete(r.Context(), strconv.Itoa(id))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readAvatarUpload достаёт поле avatar из multipart-тела и проверяет
+// размер и сигнатуру файла. Возвращает HTTP-статус для ответа с ошибкой.
+func readAvatarUpload(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	// Запас сверх лимита файла — на заголовки multipart.
+	r.Body = http.MaxBytesReader(w, r.Body, maxAvatarBytes+64<<10)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, apierr.New(apierr.UnsupportedMediaType, "expected multipart/form-data with an avatar field")
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, apierr.New(apierr.InvalidRequest, "avatar field is required")
+		}
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return nil, apierr.New(apierr.PayloadTooLarge, "avatar must not exceed 2 MB")
+			}
+			return nil, apierr.New(apierr.InvalidRequest, err.Error())
+		}
+		if part.FormName() != "avatar" {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(part, maxAvatarBytes+1))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return nil, apierr.New(apierr.PayloadTooLarge, "avatar must not exceed 2 MB")
+			}
+			return nil, apierr.New(apierr.InvalidRequest, err.Error())
+		}
+		if len(data) > maxAvatarBytes {
+			return nil, apierr.New(apierr.PayloadTooLarge, "avatar must not exceed 2 MB")
+		}
+		switch http.DetectContentType(data) {
+		case "image/png", "image/jpeg":
+			return data, nil
+		default:
+			return nil, apierr.New(apierr.UnsupportedMediaType, "avatar must be a PNG or JPEG image")
+		}
+	}
+}
+
+type avatarFile struct {
+	data        []byte
+	contentType string
+	ext         string
+}
+
+// renderAvatars декодирует изображение и готовит квадратные превью всех
+// размеров в исходном формате.
+func renderAvatars(data []byte) (map[string]avatarFile, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.New("avatar is not a valid PNG or JPEG image")
+	}
+	if cfg.Width*cfg.Height > maxAvatarPixels {
+		return nil, fmt.Errorf("avatar dimensions %dx%d are too large", cfg.Width, cfg.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.New("avatar is not a valid PNG or JPEG image")
+	}
+
+	b := src.Bounds()
+	side := min(b.Dx(), b.Dy())
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2))
+
+	files := make(map[string]avatarFile, len(avatarSizes))
+	for name, px := range avatarSizes {
+		dst := image.NewRGBA(image.Rect(0, 0, px, px))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Src, nil)
+
+		var buf bytes.Buffer
+		f := avatarFile{contentType: "image/png", ext: ".png"}
+		if format == "jpeg" {
+			f = avatarFile{contentType: "image/jpeg", ext: ".jpg"}
+			err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+		} else {
+			err = png.Encode(&buf, dst)
+		}
+		if err != nil {
+			return nil, err
+		}
+		f.data = buf.Bytes()
+		files[name] = f
+	}
+	return files, nil
+}
+
+// avatarURL — адрес, записываемый в профиль. Для локального хранилища это
+// GET /users/{id}/avatar через шлюз; v меняется с каждой загрузкой.
+func avatarURL(id int, size, key, version string) string {
+	if u := avatars.URL(key); u != "" {
+		return u
+	}
+	return fmt.Sprintf("%s/api/users/%d/avatar?size=%s&v=%s", publicURL, id, size, version)
+}
+
+// swapAvatar записывает новые ключи и URL (nil — удалить аватар) и
+// возвращает прежние ключи, чтобы удалить файлы после коммита.
+func swapAvatar(r *http.Request, id int, keys, urls map[string]string, u *User) (map[string]string, error) {
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var old []byte
+	if err := tx.QueryRowContext(r.Context(), "SELECT avatar_keys FROM users WHERE id = $1 FOR UPDATE", id).Scan(&old); err != nil {
+		return nil, err
+	}
+
+	var keysJSON, urlsJSON []byte
+	if keys != nil {
+		keysJSON, _ = json.Marshal(keys)
+		urlsJSON, _ = json.Marshal(urls)
+	}
+	err = scanUser(tx.QueryRowContext(r.Context(),
+		"UPDATE users SET avatar_keys = $2, avatar_urls = $3, updated_at = NOW() WHERE id = $1 RETURNING "+userColumns,
+		id, keysJSON, urlsJSON), u)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var oldKeys map[string]string
+	if old != nil {
+		if err := json.Unmarshal(old, &oldKeys); err != nil {
+			log.Printf("⚠️ Avatar keys of user %d are malformed: %v", id, err)
+		}
+	}
+	return oldKeys, nil
+}
+
+// deleteAvatarFiles удаляет файлы без привязки к запросу: отмена запроса
+// не должна оставлять сирот. Ошибки только логируются.
+func deleteAvatarFiles(keys map[string]string) {
+	for _, key := range keys {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := avatars.Delete(ctx, key); err != nil {
+			log.Printf("⚠️ Failed to delete avatar file %s: %v", key, err)
+		}
+		cancel()
+	}
+}
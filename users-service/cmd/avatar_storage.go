@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// avatarStore — хранилище файлов аватаров. Выбирается AVATAR_STORAGE:
+//   - local (по умолчанию) — каталог AVATAR_DIR, файлы отдаёт
+//     GET /users/{id}/avatar;
+//   - s3 — S3-совместимое хранилище (S3_ENDPOINT, S3_BUCKET, S3_REGION,
+//     S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY), GET отвечает редиректом на
+//     S3_PUBLIC_URL (по умолчанию S3_ENDPOINT/S3_BUCKET).
+type avatarStore interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	Delete(ctx context.Context, key string) error
+	// URL — публичный адрес объекта; пустой, если файлы отдаёт сам сервис.
+	URL(key string) string
+}
+
+var avatars avatarStore
+
+func initAvatarStore() error {
+	// Тип хранилища и наличие S3_* проверяет Config.
+	switch kind := cfg.AvatarStorage; kind {
+	case "local":
+		if err := os.MkdirAll(cfg.AvatarDir, 0o755); err != nil {
+			return err
+		}
+		avatars = localAvatarStore{dir: cfg.AvatarDir}
+	case "s3":
+		s := &s3AvatarStore{
+			endpoint:  strings.TrimRight(cfg.S3Endpoint, "/"),
+			bucket:    cfg.S3Bucket,
+			region:    cfg.S3Region,
+			accessKey: cfg.S3AccessKeyID,
+			secretKey: cfg.S3SecretAccessKey,
+			publicURL: strings.TrimRight(cfg.S3PublicURL, "/"),
+			client:    &http.Client{Timeout: 30 * time.Second},
+		}
+		if s.publicURL == "" {
+			s.publicURL = s.endpoint + "/" + s.bucket
+		}
+		avatars = s
+	default:
+		return fmt.Errorf("unknown AVATAR_STORAGE %q (want local or s3)", kind)
+	}
+	return nil
+}
+
+type localAvatarStore struct {
+	dir string
+}
+
+func (s localAvatarStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(key))
+}
+
+func (s localAvatarStore) Put(_ context.Context, key, _ string, data []byte) error {
+	p := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0o644)
+}
+
+func (s localAvatarStore) Delete(_ context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s localAvatarStore) URL(string) string { return "" }
+
+// s3AvatarStore обращается к бакету path-style запросами с подписью
+// AWS Signature V4 — этого хватает и для AWS, и для MinIO.
+type s3AvatarStore struct {
+	endpoint, bucket, region string
+	accessKey, secretKey     string
+	publicURL                string
+	client                   *http.Client
+}
+
+func (s *s3AvatarStore) URL(key string) string {
+	return s.publicURL + "/" + key
+}
+
+func (s *s3AvatarStore) Put(ctx context.Context, key, contentType string, data []byte) error {
+	return s.do(ctx, http.MethodPut, key, contentType, data)
+}
+
+func (s *s3AvatarStore) Delete(ctx context.Context, key string) error {
+	return s.do(ctx, http.MethodDelete, key, "", nil)
+}
+
+func (s *s3AvatarStore) do(ctx context.Context, method, key, contentType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, method, s.endpoint+"/"+s.bucket+"/"+key, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, body, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 && !(method == http.MethodDelete && resp.StatusCode == http.StatusNotFound) {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("s3 %s %s: %s: %s", method, key, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func (s *s3AvatarStore) sign(req *http.Request, body []byte, now time.Time) {
+	payloadHash := bodySHA256(body)
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if req.Header.Get("Content-Type") != "" {
+		signed = []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	}
+	var canonicalHeaders strings.Builder
+	for _, h := range signed {
+		v := req.Header.Get(h)
+		if h == "host" {
+			v = req.URL.Host
+		}
+		canonicalHeaders.WriteString(h + ":" + strings.TrimSpace(v) + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + bodySHA256([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
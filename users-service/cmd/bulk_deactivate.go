@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+	"pkg/audit"
+	"pkg/pg"
+)
+
+// Массовая деактивация неактивных пользователей: под неё попадают
+// активные пользователи, последний вход которых был раньше
+// last_login_before, и никогда не входившие, созданные раньше
+// created_before (так недавно зарегистрированные не деактивируются).
+// Деактивация идёт пачками, каждая в своей транзакции: is_active = false,
+// отзыв сессий, запись в журнал аудита на каждого пользователя и курсор
+// запуска. Прерванный запуск продолжается запросом с run_id. Одновременно
+// идёт только один запуск (pg_advisory_lock).
+
+// deactivationLockKey — ключ pg_advisory_lock, общий для всех реплик.
+const deactivationLockKey = 0x75736461 // "usda"
+
+const deactivationBatchSize = 100
+
+// BulkDeactivateRequest — новый запуск (last_login_before, dry_run) или
+// продолжение прерванного (run_id).
+type BulkDeactivateRequest struct {
+	LastLoginBefore string `json:"last_login_before,omitempty" example:"2024-10-15"`
+	// CreatedBefore — для никогда не входивших; по умолчанию
+	// last_login_before.
+	CreatedBefore string `json:"created_before,omitempty" example:"2026-09-15"`
+	DryRun        *bool  `json:"dry_run,omitempty"`
+	RunID         int    `json:"run_id,omitempty"`
+}
+
+// DeactivationRun — запуск массовой деактивации. Status: running
+// (идёт или прерван) или completed. IDsURL — список затронутых id в CSV.
+type DeactivationRun struct {
+	ID              int        `json:"id"`
+	LastLoginBefore time.Time  `json:"last_login_before"`
+	CreatedBefore   time.Time  `json:"created_before"`
+	DryRun          bool       `json:"dry_run"`
+	Status          string     `json:"status"`
+	Actor           string     `json:"actor"`
+	Matched         int        `json:"matched"`
+	Deactivated     int        `json:"deactivated"`
+	StartedAt       time.Time  `json:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+	IDsURL          string     `json:"ids_url"`
+
+	lastUserID int
+}
+
+var errDeactivationBusy = errors.New("another bulk deactivation is running")
+
+// inactiveUsersCond — условие отбора; $1 — last_login_before, $2 —
+// created_before.
+const inactiveUsersCond = `is_active AND (last_login_at < $1 OR (last_login_at IS NULL AND created_at < $2))`
+
+const deactivationRunColumns = "id, last_login_before, created_before, dry_run, status, actor, matched, deactivated, last_user_id, started_at, finished_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanDeactivationRun(row rowScanner) (DeactivationRun, error) {
+	var run DeactivationRun
+	err := row.Scan(&run.ID, &run.LastLoginBefore, &run.CreatedBefore, &run.DryRun, &run.Status, &run.Actor,
+		&run.Matched, &run.Deactivated, &run.lastUserID, &run.StartedAt, &run.FinishedAt)
+	run.IDsURL = fmt.Sprintf("/users/bulk-deactivate/%d/ids", run.ID)
+	return run, err
+}
+
+func parseDeactivationDate(name, v string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		if t, err = time.Parse("2006-01-02", v); err != nil {
+			return t, fmt.Errorf("%s: expected RFC 3339 or YYYY-MM-DD", name)
+		}
+	}
+	return t, nil
+}
+
+// @Summary Bulk deactivate inactive users
+// @Description Деактивировать активных пользователей без входа с last_login_before и никогда не входивших, созданных раньше created_before (по умолчанию last_login_before). dry_run=true только находит кандидатов. Пачками: сессии отзываются, каждый пользователь пишется в журнал аудита. Прерванный запуск продолжается запросом {"run_id": N}. Список id — по ids_url. Требует X-Internal-API-Key.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body BulkDeactivateRequest true "Условия или run_id"
+// @Success 200 {object} DeactivationRun
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "code: already_running"
+// @Router /users/bulk-deactivate [post]
+func bulkDeactivateUsers(w http.ResponseWriter, r *http.Request) {
+	var req BulkDeactivateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	var lastLogin, created time.Time
+	if req.RunID == 0 {
+		if req.LastLoginBefore == "" || req.DryRun == nil {
+			apierr.Write(w, apierr.InvalidRequest, "last_login_before and dry_run are required, or run_id to resume")
+			return
+		}
+		var err error
+		if lastLogin, err = parseDeactivationDate("last_login_before", req.LastLoginBefore); err != nil {
+			apierr.Write(w, apierr.InvalidRequest, err.Error())
+			return
+		}
+		created = lastLogin
+		if req.CreatedBefore != "" {
+			if created, err = parseDeactivationDate("created_before", req.CreatedBefore); err != nil {
+				apierr.Write(w, apierr.InvalidRequest, err.Error())
+				return
+			}
+		}
+	}
+
+	conn, err := db.Conn(r.Context())
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer conn.Close()
+	var locked bool
+	if err := conn.QueryRowContext(r.Context(), "SELECT pg_try_advisory_lock($1)", deactivationLockKey).Scan(&locked); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if !locked {
+		apierr.Write(w, apierr.AlreadyRunning, errDeactivationBusy.Error())
+		return
+	}
+	defer conn.ExecContext(context.WithoutCancel(r.Context()), "SELECT pg_advisory_unlock($1)", deactivationLockKey)
+
+	var run DeactivationRun
+	if req.RunID != 0 {
+		run, err = scanDeactivationRun(conn.QueryRowContext(r.Context(),
+			"SELECT "+deactivationRunColumns+" FROM deactivation_runs WHERE id = $1", req.RunID))
+		if err == sql.ErrNoRows {
+			apierr.Write(w, apierr.NotFound, "Deactivation run not found")
+			return
+		}
+		if err == nil && run.Status == "running" {
+			log.Printf("👥 Resuming bulk deactivation run %d after user %d", run.ID, run.lastUserID)
+		}
+	} else {
+		run, err = startDeactivationRun(r.Context(), conn, lastLogin, created, *req.DryRun, audit.Actor(r))
+	}
+	if err == nil && run.Status == "running" {
+		err = continueDeactivationRun(r.Context(), conn, &run)
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// startDeactivationRun создаёт запуск и считает кандидатов. Dry run
+// сразу сохраняет их список и завершается.
+func startDeactivationRun(ctx context.Context, conn *sql.Conn, lastLogin, created time.Time, dryRun bool, actor string) (DeactivationRun, error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return DeactivationRun{}, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO deactivation_runs (last_login_before, created_before, dry_run, actor, matched)
+		 VALUES ($1, $2, $3, $4, (SELECT COUNT(*) FROM users WHERE `+inactiveUsersCond+`)) RETURNING id`,
+		lastLogin, created, dryRun, actor).Scan(&id)
+	if err != nil {
+		return DeactivationRun{}, err
+	}
+	if dryRun {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO deactivation_run_users (run_id, user_id) SELECT $3, id FROM users WHERE `+inactiveUsersCond,
+			lastLogin, created, id)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, "UPDATE deactivation_runs SET status = 'completed', finished_at = NOW() WHERE id = $1", id)
+		}
+		if err != nil {
+			return DeactivationRun{}, err
+		}
+	}
+	run, err := scanDeactivationRun(tx.QueryRowContext(ctx, "SELECT "+deactivationRunColumns+" FROM deactivation_runs WHERE id = $1", id))
+	if err != nil {
+		return run, err
+	}
+	log.Printf("👥 Bulk deactivation run %d by %s: %d users match (dry_run=%t)", run.ID, actor, run.Matched, dryRun)
+	return run, tx.Commit()
+}
+
+// continueDeactivationRun деактивирует пачки после курсора запуска, пока
+// кандидаты не кончатся. Ошибка оставляет запуск в status = 'running'.
+func continueDeactivationRun(ctx context.Context, conn *sql.Conn, run *DeactivationRun) error {
+	for {
+		ids, err := deactivateBatch(ctx, conn, run)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			userCache.Delete(ctx, strconv.FormatInt(id, 10))
+		}
+		if len(ids) < deactivationBatchSize {
+			break
+		}
+	}
+	now := time.Now().UTC()
+	if _, err := conn.ExecContext(ctx,
+		"UPDATE deactivation_runs SET status = 'completed', finished_at = $2 WHERE id = $1", run.ID, now); err != nil {
+		return err
+	}
+	run.Status, run.FinishedAt = "completed", &now
+	log.Printf("👥 Bulk deactivation run %d completed: %d users deactivated", run.ID, run.Deactivated)
+	return nil
+}
+
+// deactivateBatch деактивирует одну пачку и сдвигает курсор запуска в той
+// же транзакции.
+func deactivateBatch(ctx context.Context, conn *sql.Conn, run *DeactivationRun) ([]int64, error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var ids []int64
+	err = tx.QueryRowContext(ctx,
+		`SELECT COALESCE(array_agg(id), '{}') FROM (
+		   SELECT id FROM users WHERE `+inactiveUsersCond+` AND id > $3
+		   ORDER BY id LIMIT $4 FOR UPDATE
+		 ) batch`,
+		run.LastLoginBefore, run.CreatedBefore, run.lastUserID, deactivationBatchSize).Scan(pg.Array(&ids))
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET is_active = FALSE, updated_at = NOW() WHERE id = ANY($1)", ids); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = ANY($1) AND revoked_at IS NULL", ids); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO deactivation_run_users (run_id, user_id) SELECT $1, unnest($2::int[]) ON CONFLICT DO NOTHING", run.ID, ids); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if err := audit.Record(ctx, tx, audit.Entry{
+			Actor:        run.Actor,
+			Action:       "bulk_deactivate " + strconv.Itoa(run.ID),
+			ResourceType: "users",
+			ResourceID:   strconv.FormatInt(id, 10),
+			BodySHA256:   bodySHA256(nil),
+		}); err != nil {
+			return nil, err
+		}
+	}
+	last := int(ids[len(ids)-1])
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE deactivation_runs SET deactivated = deactivated + $2, last_user_id = $3 WHERE id = $1",
+		run.ID, len(ids), last); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	run.Deactivated += len(ids)
+	run.lastUserID = last
+	return ids, nil
+}
+
+// @Summary Get bulk deactivation run
+// @Description Состояние запуска массовой деактивации. Требует X-Internal-API-Key.
+// @Tags users
+// @Produce json
+// @Param id path int true "Run ID"
+// @Success 200 {object} DeactivationRun
+// @Failure 404 {object} map[string]string
+// @Router /users/bulk-deactivate/{id} [get]
+func getDeactivationRun(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	run, err := scanDeactivationRun(db.QueryRowContext(r.Context(),
+		"SELECT "+deactivationRunColumns+" FROM deactivation_runs WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.NotFound, "Deactivation run not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// @Summary Download bulk deactivation ids
+// @Description id пользователей, деактивированных запуском (для dry run — кандидатов), в CSV. Требует X-Internal-API-Key.
+// @Tags users
+// @Produce text/csv
+// @Param id path int true "Run ID"
+// @Success 200 {string} string "user_id по строке"
+// @Failure 404 {object} map[string]string
+// @Router /users/bulk-deactivate/{id}/ids [get]
+func getDeactivationRunIDs(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	var exists bool
+	if err := db.QueryRowContext(r.Context(), "SELECT EXISTS (SELECT 1 FROM deactivation_runs WHERE id = $1)", id).Scan(&exists); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if !exists {
+		apierr.Write(w, apierr.NotFound, "Deactivation run not found")
+		return
+	}
+	rows, err := db.QueryContext(r.Context(), "SELECT user_id FROM deactivation_run_users WHERE run_id = $1 ORDER BY user_id", id)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="deactivation-run-%d.csv"`, id))
+	fmt.Fprintln(w, "user_id")
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			log.Printf("⚠️ Deactivation run %d ids: %v", id, err)
+			return
+		}
+		fmt.Fprintln(w, userID)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"pkg/config"
+)
+
+// Config — конфигурация users-service. Загружается и проверяется при
+// старте (config.MustLoad); -print-config выводит её и завершает процесс.
+type Config struct {
+	config.Common
+
+	Port        string `env:"PORT" default:"8001"`
+	DatabaseURL string `env:"DATABASE_URL" required:"true"`
+	// REDIS_URL и CACHE_TTL читает pkg/cache; без REDIS_URL кэша нет.
+	RedisURL string        `env:"REDIS_URL" url:"true"`
+	CacheTTL time.Duration `env:"CACHE_TTL" default:"60s"`
+
+	JWTAccessTTL  time.Duration `env:"JWT_ACCESS_TTL" default:"15m" min:"1s"`
+	JWTRefreshTTL time.Duration `env:"JWT_REFRESH_TTL" default:"720h" min:"1s"`
+
+	// Без SMTP_ADDR письма пишутся в лог.
+	SMTPAddr     string `env:"SMTP_ADDR"`
+	SMTPFrom     string `env:"SMTP_FROM" default:"no-reply@localhost"`
+	SMTPUser     string `env:"SMTP_USER"`
+	SMTPPassword string `env:"SMTP_PASSWORD" secret:"true"`
+	PublicURL    string `env:"PUBLIC_URL" default:"http://localhost" url:"true"`
+
+	AvatarStorage     string `env:"AVATAR_STORAGE" default:"local" oneof:"local,s3"`
+	AvatarDir         string `env:"AVATAR_DIR" default:"avatars"`
+	S3Endpoint        string `env:"S3_ENDPOINT" url:"true"`
+	S3Bucket          string `env:"S3_BUCKET"`
+	S3Region          string `env:"S3_REGION" default:"us-east-1"`
+	S3AccessKeyID     string `env:"S3_ACCESS_KEY_ID"`
+	S3SecretAccessKey string `env:"S3_SECRET_ACCESS_KEY" secret:"true"`
+	S3PublicURL       string `env:"S3_PUBLIC_URL" url:"true"`
+
+	UsernameHold            time.Duration `env:"USERNAME_HOLD" default:"720h" min:"0s"`
+	UserEventsRetention     time.Duration `env:"USER_EVENTS_RETENTION" default:"8760h" min:"1h"`
+	UserEventsPruneInterval time.Duration `env:"USER_EVENTS_PRUNE_INTERVAL" default:"24h" min:"1s"`
+	// Домены email (через запятую) в дополнение к таблице
+	// email_domain_rules; таблица перечитывается раз в
+	// EMAIL_DOMAIN_RELOAD_INTERVAL.
+	EmailDomainBlocklist      []string      `env:"EMAIL_DOMAIN_BLOCKLIST"`
+	EmailDomainAllowlist      []string      `env:"EMAIL_DOMAIN_ALLOWLIST"`
+	EmailDomainReloadInterval time.Duration `env:"EMAIL_DOMAIN_RELOAD_INTERVAL" default:"30s" min:"1s"`
+	// Читает pkg/dedup.
+	ProcessedEventsRetention     time.Duration `env:"PROCESSED_EVENTS_RETENTION" default:"168h" min:"1s"`
+	ProcessedEventsPruneInterval time.Duration `env:"PROCESSED_EVENTS_PRUNE_INTERVAL" default:"1h" min:"1s"`
+}
+
+func (c *Config) Validate() []error {
+	var errs []error
+	if c.AvatarStorage == "s3" && (c.S3Endpoint == "" || c.S3Bucket == "" || c.S3AccessKeyID == "" || c.S3SecretAccessKey == "") {
+		errs = append(errs, errors.New("AVATAR_STORAGE=s3 requires S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY"))
+	}
+	if c.SMTPUser != "" && c.SMTPAddr == "" {
+		errs = append(errs, errors.New("SMTP_USER is set but SMTP_ADDR is not"))
+	}
+	return errs
+}
+
+var cfg Config
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+	"pkg/pg"
+)
+
+// emailChangeTTL — сколько живут ссылка подтверждения нового адреса и
+// ссылка отмены, отправленная на старый.
+const emailChangeTTL = 24 * time.Hour
+
+// EmailChangeRequest — тело POST /users/{id}/change-email.
+type EmailChangeRequest struct {
+	Email string `json:"email"`
+}
+
+// EmailChangeToken — тело POST /auth/confirm-email-change и
+// POST /auth/undo-email-change.
+type EmailChangeToken struct {
+	Token string `json:"token"`
+}
+
+// emailTaken сообщает, что адрес занят другим пользователем.
+func emailTaken(ctx context.Context, q queryer, email string, userID int) (bool, error) {
+	var taken bool
+	err := q.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE email = $1 AND id <> $2)", email, userID).Scan(&taken)
+	return taken, err
+}
+
+// queryer — *sql.DB или *sql.Tx.
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// @Summary Request email change
+// @Description Сменить email с подтверждением: на новый адрес уходит ссылка с токеном (живёт 24 часа), email меняется только после POST /auth/confirm-email-change. Новый запрос заменяет предыдущий неподтверждённый. Доступно владельцу (Bearer) и по X-Internal-API-Key.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param email body EmailChangeRequest true "New email"
+// @Success 202 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "Адрес занят"
+// @Failure 422 {object} map[string]interface{} "email_domain_not_allowed: домен в блок-листе или вне allowlist"
+// @Failure 502 {object} map[string]string "Письмо не отправлено"
+// @Router /users/{id}/change-email [post]
+func requestEmailChange(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if _, ok := authorizeUser(w, r, id); !ok {
+		return
+	}
+	var req EmailChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	addr, err := mail.ParseAddress(req.Email)
+	if err != nil || addr.Address != strings.TrimSpace(req.Email) {
+		apierr.Write(w, apierr.InvalidRequest, "email must be a plain email address")
+		return
+	}
+	newEmail := addr.Address
+	if err := emailDomainRules.check(newEmail); err != nil {
+		apierr.Respond(w, err)
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var oldEmail string
+	err = tx.QueryRowContext(r.Context(), "SELECT email FROM users WHERE id = $1 FOR UPDATE", id).Scan(&oldEmail)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.UserNotFound, "User not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if newEmail == oldEmail {
+		apierr.Write(w, apierr.InvalidRequest, "email is unchanged")
+		return
+	}
+	if taken, err := emailTaken(r.Context(), tx, newEmail, id); err != nil {
+		apierr.Internal(w, err)
+		return
+	} else if taken {
+		apierr.Write(w, apierr.DuplicateEmail, "Email is already in use")
+		return
+	}
+
+	token, tokenHash, err := newRefreshToken()
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	_, err = tx.ExecContext(r.Context(), "DELETE FROM email_changes WHERE user_id = $1 AND confirmed_at IS NULL", id)
+	if err == nil {
+		_, err = tx.ExecContext(r.Context(),
+			"INSERT INTO email_changes (user_id, old_email, new_email, token_hash, expires_at) VALUES ($1, $2, $3, $4, NOW() + $5 * INTERVAL '1 second')",
+			id, oldEmail, newEmail, tokenHash, emailChangeTTL.Seconds())
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	// Письмо отправляется до коммита: если оно не ушло, запроса на смену
+	// не остаётся.
+	link := publicURL + "/confirm-email-change?token=" + url.QueryEscape(token)
+	if err := sendMail(newEmail, "Confirm your new email address",
+		fmt.Sprintf("To confirm changing your account email to %s, open:\n\n%s\n\nThe link expires in 24 hours. If you did not request this, ignore this message.", newEmail, link)); err != nil {
+		log.Printf("⚠️ Email change confirmation to %s failed: %v", newEmail, err)
+		apierr.Write(w, apierr.UpstreamFailed, "Could not send confirmation email")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "pending", "email": newEmail})
+}
+
+// @Summary Confirm email change
+// @Description Подтвердить смену email токеном из письма. Уникальность адреса проверяется повторно. На старый адрес уходит уведомление со ссылкой отмены, действующей 24 часа.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token body EmailChangeToken true "Confirmation token"
+// @Success 200 {object} User
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string "Токен неизвестен, истёк или уже использован"
+// @Failure 409 {object} map[string]string "Адрес занят"
+// @Router /auth/confirm-email-change [post]
+func confirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req EmailChangeToken
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		apierr.Write(w, apierr.InvalidRequest, "token is required")
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var changeID, userID int
+	var oldEmail, newEmail string
+	err = tx.QueryRowContext(r.Context(),
+		`SELECT id, user_id, old_email, new_email FROM email_changes
+		 WHERE token_hash = $1 AND confirmed_at IS NULL AND expires_at > NOW() FOR UPDATE`,
+		refreshHash(req.Token)).Scan(&changeID, &userID, &oldEmail, &newEmail)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.InvalidToken, "Invalid or expired token")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if taken, err := emailTaken(r.Context(), tx, newEmail, userID); err != nil {
+		apierr.Internal(w, err)
+		return
+	} else if taken {
+		apierr.Write(w, apierr.DuplicateEmail, "Email is already in use")
+		return
+	}
+
+	// Смена применяется, только если email не менялся после запроса.
+	var u User
+	err = scanUser(tx.QueryRowContext(r.Context(),
+		"UPDATE users SET email = $3, updated_at = NOW() WHERE id = $1 AND email = $2 RETURNING "+userColumns,
+		userID, oldEmail, newEmail), &u)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.InvalidToken, "Invalid or expired token")
+		return
+	} else if pg.IsUniqueViolation(err) {
+		apierr.Write(w, apierr.DuplicateEmail, "Email is already in use")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	undo, undoHash, err := newRefreshToken()
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	_, err = tx.ExecContext(r.Context(),
+		"UPDATE email_changes SET confirmed_at = NOW(), undo_hash = $2, undo_expires_at = NOW() + $3 * INTERVAL '1 second' WHERE id = $1",
+		changeID, undoHash, emailChangeTTL.Seconds())
+	if err == nil {
+		err = recordUserEvent(r.Context(), tx, userID, userEventEmailChanged,
+			map[string]interface{}{"old_email": oldEmail, "new_email": newEmail})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	userCache.Delete(r.Context(), strconv.Itoa(userID))
+
+	// Email уже сменён, поэтому ошибка уведомления только логируется.
+	link := publicURL + "/undo-email-change?token=" + url.QueryEscape(undo)
+	if err := sendMail(oldEmail, "Your account email was changed",
+		fmt.Sprintf("The email of your account was changed to %s.\n\nIf this was not you, undo the change within 24 hours:\n\n%s", newEmail, link)); err != nil {
+		log.Printf("⚠️ Email change notice to %s failed: %v", oldEmail, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u)
+}
+
+// @Summary Undo email change
+// @Description Вернуть прежний email по ссылке из уведомления на старый адрес (24 часа). Все сессии пользователя отзываются.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token body EmailChangeToken true "Undo token"
+// @Success 200 {object} User
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string "Токен неизвестен, истёк или уже использован"
+// @Failure 409 {object} map[string]string "Прежний адрес занят"
+// @Router /auth/undo-email-change [post]
+func undoEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req EmailChangeToken
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		apierr.Write(w, apierr.InvalidRequest, "token is required")
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var changeID, userID int
+	var oldEmail, newEmail string
+	err = tx.QueryRowContext(r.Context(),
+		`SELECT id, user_id, old_email, new_email FROM email_changes
+		 WHERE undo_hash = $1 AND undone_at IS NULL AND undo_expires_at > NOW() FOR UPDATE`,
+		refreshHash(req.Token)).Scan(&changeID, &userID, &oldEmail, &newEmail)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.InvalidToken, "Invalid or expired token")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	var u User
+	err = scanUser(tx.QueryRowContext(r.Context(),
+		"UPDATE users SET email = $2, updated_at = NOW() WHERE id = $1 RETURNING "+userColumns,
+		userID, oldEmail), &u)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.InvalidToken, "Invalid or expired token")
+		return
+	} else if pg.IsUniqueViolation(err) {
+		apierr.Write(w, apierr.DuplicateEmail, "Previous email is now used by another account")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	// Отмена означает, что аккаунт мог быть захвачен: выкидываем все сессии.
+	_, err = tx.ExecContext(r.Context(), "UPDATE email_changes SET undone_at = NOW() WHERE id = $1", changeID)
+	if err == nil {
+		_, err = tx.ExecContext(r.Context(), "UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", userID)
+	}
+	if err == nil {
+		err = recordUserEvent(r.Context(), tx, userID, userEventEmailChanged,
+			map[string]interface{}{"old_email": newEmail, "new_email": oldEmail, "undo": true})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	userCache.Delete(r.Context(), strconv.Itoa(userID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u)
+}
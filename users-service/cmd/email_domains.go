@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"pkg/apierr"
+	"pkg/audit"
+	"pkg/replica"
+)
+
+// recentDomainRejections — сколько последних отказов помнит реплика.
+const recentDomainRejections = 50
+
+var domainRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "users_email_domain_rejections_total",
+	Help: "Registrations and email changes rejected by the email domain rules.",
+}, []string{"reason"})
+
+var domainPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*$`)
+
+// DomainRule — домен в блок-листе или allowlist. Правило действует и на
+// все поддомены: example.com закрывает mail.example.com.
+type DomainRule struct {
+	Domain string `json:"domain" example:"tempmail.com"`
+	// Source — env (EMAIL_DOMAIN_BLOCKLIST/ALLOWLIST, меняется только
+	// перезапуском) или table (email_domain_rules).
+	Source    string     `json:"source" example:"table"`
+	Note      string     `json:"note,omitempty"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// DomainRejection — отказ в регистрации или смене email.
+type DomainRejection struct {
+	Domain string `json:"domain" example:"mail.tempmail.com"`
+	// Reason — blocklisted (Rule — сработавшее правило) или
+	// not_allowlisted.
+	Reason string    `json:"reason" example:"blocklisted"`
+	Rule   string    `json:"rule,omitempty" example:"tempmail.com"`
+	At     time.Time `json:"at"`
+}
+
+// EmailDomainLists — действующие правила и последние отказы этой реплики.
+type EmailDomainLists struct {
+	Allowlist        []DomainRule      `json:"allowlist"`
+	Blocklist        []DomainRule      `json:"blocklist"`
+	ReloadedAt       time.Time         `json:"reloaded_at"`
+	ReplicaID        string            `json:"replica_id"`
+	RecentRejections []DomainRejection `json:"recent_rejections"`
+}
+
+// DomainRuleRequest — тело PUT /admin/email-domains/{list}/{domain}.
+type DomainRuleRequest struct {
+	Note string `json:"note"`
+}
+
+// emailDomains — правила доменов email для регистрации (POST /users) и
+// смены адреса. Адрес из домена блок-листа отклоняется; если allowlist не
+// пуст, проходят только его домены. Блок-лист важнее allowlist.
+// Правила из окружения постоянны, таблица email_domain_rules
+// перечитывается раз в EMAIL_DOMAIN_RELOAD_INTERVAL и сразу после
+// изменения через /admin/email-domains на этой реплике.
+type emailDomains struct {
+	envAllow, envBlock []string
+
+	mu         sync.RWMutex
+	allow      map[string]DomainRule
+	block      map[string]DomainRule
+	reloadedAt time.Time
+	rejections []DomainRejection
+}
+
+var emailDomainRules *emailDomains
+
+func startEmailDomainRules(ctx context.Context) {
+	emailDomainRules = &emailDomains{envAllow: cfg.EmailDomainAllowlist, envBlock: cfg.EmailDomainBlocklist}
+	// Без таблицы (старая схема) остаются правила из окружения.
+	if err := emailDomainRules.reload(ctx); err != nil {
+		log.Printf("⚠️ Email domain rules: table not loaded, using environment only: %v", err)
+		emailDomainRules.set(emailDomainRules.envRules())
+	}
+
+	go func() {
+		ticker := time.NewTicker(cfg.EmailDomainReloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := emailDomainRules.reload(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("⚠️ Email domain rules reload failed, keeping previous rules: %v", err)
+			}
+		}
+	}()
+	allow, block := emailDomainRules.counts()
+	log.Printf("📧 Email domain rules loaded: %d allowed, %d blocked", allow, block)
+}
+
+// normalizeDomain приводит домен к нижнему регистру без завершающей точки
+// и "*.": правила и так действуют на поддомены. "" — домен невалиден.
+func normalizeDomain(d string) string {
+	d = strings.TrimSuffix(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(d)), "*."), ".")
+	if len(d) > 253 || !domainPattern.MatchString(d) {
+		return ""
+	}
+	return d
+}
+
+// emailDomain — домен адреса в нормализованном виде.
+func emailDomain(email string) string {
+	i := strings.LastIndexByte(email, '@')
+	if i < 0 {
+		return ""
+	}
+	return normalizeDomain(email[i+1:])
+}
+
+// match — правило из rules, под которое попадает domain (сам домен или
+// один из родительских); "" — ни одного.
+func match(rules map[string]DomainRule, domain string) string {
+	for d := domain; d != ""; {
+		if _, ok := rules[d]; ok {
+			return d
+		}
+		i := strings.IndexByte(d, '.')
+		if i < 0 {
+			break
+		}
+		d = d[i+1:]
+	}
+	return ""
+}
+
+// envRules — правила из EMAIL_DOMAIN_ALLOWLIST и EMAIL_DOMAIN_BLOCKLIST.
+func (e *emailDomains) envRules() (allow, block map[string]DomainRule) {
+	allow, block = map[string]DomainRule{}, map[string]DomainRule{}
+	for _, src := range []struct {
+		domains []string
+		rules   map[string]DomainRule
+	}{{e.envAllow, allow}, {e.envBlock, block}} {
+		for _, d := range src.domains {
+			if n := normalizeDomain(d); n != "" {
+				src.rules[n] = DomainRule{Domain: n, Source: "env"}
+			} else if strings.TrimSpace(d) != "" {
+				log.Printf("⚠️ Email domain rules: ignoring invalid domain %q", d)
+			}
+		}
+	}
+	return allow, block
+}
+
+// reload перечитывает таблицу; при ошибке правила не меняются.
+func (e *emailDomains) reload(ctx context.Context) error {
+	allow, block := e.envRules()
+	rows, err := db.QueryContext(ctx, "SELECT list, domain, note, created_by, created_at FROM email_domain_rules")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var list string
+		var rule DomainRule
+		var created time.Time
+		if err := rows.Scan(&list, &rule.Domain, &rule.Note, &rule.CreatedBy, &created); err != nil {
+			return err
+		}
+		rule.Source, rule.CreatedAt = "table", &created
+		rules := allow
+		if list == "block" {
+			rules = block
+		}
+		// Правило из окружения не перекрывается таблицей.
+		if _, ok := rules[rule.Domain]; !ok {
+			rules[rule.Domain] = rule
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	e.set(allow, block)
+	return nil
+}
+
+func (e *emailDomains) set(allow, block map[string]DomainRule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.allow, e.block, e.reloadedAt = allow, block, time.Now().UTC()
+}
+
+func (e *emailDomains) counts() (allow, block int) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return len(e.allow), len(e.block)
+}
+
+// check возвращает ошибку email_domain_not_allowed, если адрес не проходит
+// правила. Адрес без домена проверяется не здесь, а валидацией email.
+func (e *emailDomains) check(email string) error {
+	domain := emailDomain(email)
+	if domain == "" {
+		return nil
+	}
+	e.mu.RLock()
+	blocked := match(e.block, domain)
+	allowed := len(e.allow) == 0 || match(e.allow, domain) != ""
+	e.mu.RUnlock()
+
+	rej := DomainRejection{Domain: domain, At: time.Now().UTC()}
+	switch {
+	case blocked != "":
+		rej.Reason, rej.Rule = "blocklisted", blocked
+	case !allowed:
+		rej.Reason = "not_allowlisted"
+	default:
+		return nil
+	}
+
+	e.mu.Lock()
+	e.rejections = append(e.rejections, rej)
+	if len(e.rejections) > recentDomainRejections {
+		e.rejections = e.rejections[len(e.rejections)-recentDomainRejections:]
+	}
+	e.mu.Unlock()
+	domainRejections.WithLabelValues(rej.Reason).Inc()
+	return apierr.New(apierr.EmailDomainNotAllowed, "Email addresses on "+domain+" are not accepted").With("domain", domain)
+}
+
+func (e *emailDomains) lists() EmailDomainLists {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	res := EmailDomainLists{
+		Allowlist:        sortedRules(e.allow),
+		Blocklist:        sortedRules(e.block),
+		ReloadedAt:       e.reloadedAt,
+		ReplicaID:        replica.ID(),
+		RecentRejections: make([]DomainRejection, 0, len(e.rejections)),
+	}
+	// Новые отказы — первыми.
+	for i := len(e.rejections) - 1; i >= 0; i-- {
+		res.RecentRejections = append(res.RecentRejections, e.rejections[i])
+	}
+	return res
+}
+
+func sortedRules(rules map[string]DomainRule) []DomainRule {
+	out := make([]DomainRule, 0, len(rules))
+	for _, r := range rules {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Domain < out[j].Domain })
+	return out
+}
+
+// @Summary Email domain rules
+// @Description Действующие блок-лист и allowlist доменов email (из окружения и таблицы) и последние отказы в регистрации или смене email на этой реплике. Требует X-Internal-API-Key.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} EmailDomainLists
+// @Router /admin/email-domains [get]
+func getEmailDomains(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(emailDomainRules.lists())
+}
+
+// @Summary Add email domain rule
+// @Description Добавить домен в блок-лист (list=block) или allowlist (list=allow). Правило действует на домен и все его поддомены. На этой реплике применяется сразу, на остальных — в течение EMAIL_DOMAIN_RELOAD_INTERVAL. Требует X-Internal-API-Key.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param list path string true "allow или block"
+// @Param domain path string true "Домен" example(tempmail.com)
+// @Param request body DomainRuleRequest false "Комментарий"
+// @Success 200 {object} EmailDomainLists
+// @Failure 400 {object} map[string]string
+// @Router /admin/email-domains/{list}/{domain} [put]
+func putEmailDomain(w http.ResponseWriter, r *http.Request) {
+	list, domain, ok := domainRuleVars(w, r)
+	if !ok {
+		return
+	}
+	var req DomainRuleRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierr.Write(w, apierr.InvalidRequest, err.Error())
+			return
+		}
+	}
+
+	_, err := db.ExecContext(r.Context(),
+		`INSERT INTO email_domain_rules (list, domain, note, created_by) VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (list, domain) DO UPDATE SET note = EXCLUDED.note`,
+		list, domain, req.Note, audit.Actor(r))
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if err := emailDomainRules.reload(r.Context()); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	log.Printf("📧 Email domain %s added to %slist by %s", domain, list, audit.Actor(r))
+	getEmailDomains(w, r)
+}
+
+// @Summary Remove email domain rule
+// @Description Убрать домен из блок-листа или allowlist. Правила из EMAIL_DOMAIN_BLOCKLIST/ALLOWLIST так не удаляются. Требует X-Internal-API-Key.
+// @Tags admin
+// @Param list path string true "allow или block"
+// @Param domain path string true "Домен"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Router /admin/email-domains/{list}/{domain} [delete]
+func deleteEmailDomain(w http.ResponseWriter, r *http.Request) {
+	list, domain, ok := domainRuleVars(w, r)
+	if !ok {
+		return
+	}
+	res, err := db.ExecContext(r.Context(), "DELETE FROM email_domain_rules WHERE list = $1 AND domain = $2", list, domain)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		apierr.Write(w, apierr.NotFound, "No "+list+"list rule for "+domain+" in the table")
+		return
+	}
+	if err := emailDomainRules.reload(r.Context()); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	log.Printf("📧 Email domain %s removed from %slist by %s", domain, list, audit.Actor(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func domainRuleVars(w http.ResponseWriter, r *http.Request) (list, domain string, ok bool) {
+	vars := mux.Vars(r)
+	list = vars["list"]
+	if list != "allow" && list != "block" {
+		apierr.Write(w, apierr.InvalidRequest, "list must be allow or block")
+		return "", "", false
+	}
+	if domain = normalizeDomain(vars["domain"]); domain == "" {
+		apierr.Write(w, apierr.InvalidRequest, "domain is not a valid domain name")
+		return "", "", false
+	}
+	return list, domain, true
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"pkg/admin"
+	"pkg/apierr"
+	"pkg/audit"
+	"pkg/auth"
+)
+
+// maxImpersonationTTL — предельный срок токена имперсонации. Токен не
+// продлевается: refresh-токен к нему не выдаётся.
+const maxImpersonationTTL = 30 * time.Minute
+
+// ImpersonationRequest — тело POST /users/{id}/impersonate.
+type ImpersonationRequest struct {
+	Minutes int    `json:"minutes"`
+	Reason  string `json:"reason"`
+}
+
+// ImpersonationToken — ответ POST /users/{id}/impersonate.
+type ImpersonationToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	ExpiresAt   string `json:"expires_at"`
+}
+
+func bodySHA256(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// @Summary Impersonate user
+// @Description Выдать оператору access-токен от имени пользователя с claim impersonator (X-Actor). Токен живёт minutes минут (по умолчанию 15, не больше 30) и не продлевается. Запросы с ним помечаются во всех сервисах, удаление пользователя и возврат платежа с ним запрещены. Начало пишется в журнал аудита. Требует X-Internal-API-Key.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param request body ImpersonationRequest false "Срок и причина"
+// @Success 200 {object} ImpersonationToken
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string "account_deactivated"
+// @Failure 404 {object} map[string]string
+// @Router /users/{id}/impersonate [post]
+func impersonateUser(w http.ResponseWriter, r *http.Request) {
+	if !requireJWTSecret(w) {
+		return
+	}
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	req := ImpersonationRequest{Minutes: 15}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			apierr.Write(w, apierr.InvalidRequest, err.Error())
+			return
+		}
+	}
+	ttl := time.Duration(req.Minutes) * time.Minute
+	if ttl <= 0 || ttl > maxImpersonationTTL {
+		apierr.Write(w, apierr.InvalidRequest, "minutes must be between 1 and 30")
+		return
+	}
+
+	var active bool
+	err = db.QueryRowContext(r.Context(), "SELECT is_active FROM users WHERE id = $1", id).Scan(&active)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.UserNotFound, "User not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if !active {
+		apierr.Write(w, apierr.AccountDeactivated, "Account is deactivated")
+		return
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	now := time.Now()
+	expires := now.Add(ttl)
+	operator := admin.Actor(r)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		Impersonator: operator,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        hex.EncodeToString(jti),
+			Subject:   strconv.Itoa(id),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+	}).SignedString(jwtSecret)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	// Без записи в журнал токен не выдаётся.
+	if err := audit.Record(r.Context(), db, audit.Entry{
+		Actor:        operator,
+		Action:       "impersonation.start " + hex.EncodeToString(jti),
+		ResourceType: "users",
+		ResourceID:   strconv.Itoa(id),
+		BodySHA256:   bodySHA256(body),
+	}); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ImpersonationToken{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(ttl.Seconds()),
+		ExpiresAt:   expires.UTC().Format(time.RFC3339),
+	})
+}
+
+// @Summary Stop impersonation
+// @Description Завершить имперсонацию: запись в журнал аудита. Вызывается с токеном имперсонации; сам токен остаётся действительным до истечения, клиент должен его забыть.
+// @Tags auth
+// @Success 204
+// @Failure 400 {object} map[string]string "Токен не имперсонации"
+// @Failure 401 {object} map[string]string
+// @Router /auth/impersonation/stop [post]
+func stopImpersonation(w http.ResponseWriter, r *http.Request) {
+	c := auth.FromContext(r.Context())
+	if c == nil {
+		apierr.Write(w, apierr.Unauthorized, "Unauthorized")
+		return
+	}
+	if !c.Impersonated() {
+		apierr.Write(w, apierr.InvalidRequest, "Not an impersonation token")
+		return
+	}
+
+	if err := audit.Record(r.Context(), db, audit.Entry{
+		Actor:        c.Impersonator,
+		Action:       "impersonation.stop " + c.ID,
+		ResourceType: "users",
+		ResourceID:   c.Subject,
+		BodySHA256:   bodySHA256(nil),
+	}); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+
+	"pkg/mail"
+)
+
+// Почта — pkg/mail (SMTP_*; без SMTP_ADDR письма пишутся в лог).
+// PUBLIC_URL — адрес фронтенда для ссылок в письмах.
+var (
+	mailer    *mail.Sender
+	publicURL string
+)
+
+func initMail() {
+	mailer = mail.FromEnv()
+	publicURL = strings.TrimRight(cfg.PublicURL, "/")
+}
+
+// sendMail отправляет текстовое письмо одному получателю. Здесь только
+// письма о безопасности аккаунта, поэтому настройки уведомлений
+// (notification_prefs.go) не проверяются.
+func sendMail(to, subject, body string) error {
+	return mailer.Send(mail.Message{To: to, Subject: subject, Body: body})
+}
@@ -1,28 +1,67 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
-	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	httpSwagger "github.com/swaggo/http-swagger"
-	_ "users-service/docs"
+	"golang.org/x/crypto/bcrypt"
+	"pkg/admin"
+	"pkg/apierr"
+	"pkg/audit"
+	"pkg/auth"
+	"pkg/cache"
+	"pkg/clients"
+	"pkg/config"
+	"pkg/dbhealth"
+	"pkg/dedup"
+	"pkg/flags"
+	"pkg/hmacsign"
+	"pkg/limit"
+	"pkg/mode"
+	"pkg/mtls"
+	"pkg/observe"
+	"pkg/pg"
+	"pkg/ratelimit"
+	"pkg/replica"
+	"pkg/seed"
+	"pkg/specvalidate"
+	"users-service/docs"
 )
 
 var db *sql.DB
 
-type User struct {
-	ID        int    `json:"id"`
-	Email     string `json:"email" validate:"required,email"`
-	Name      string `json:"name" validate:"required,min=2,max=100"`
-	Age       int    `json:"age" validate:"required,min=1,max=150"`
-	CreatedAt string `json:"createdAt"`
-	UpdatedAt string `json:"updatedAt"`
+// dbWatch следит за соединением с БД; пока его нет, запросы получают 503.
+var dbWatch *dbhealth.Watchdog
+var serviceMode *mode.Switch
+var featureFlags *flags.Set
+var userCache *cache.Cache
+
+// User — общий контракт с клиентами (pkg/clients).
+type User = clients.User
+
+const userColumns = "id, email, username, phone, name, age, is_active, metadata, avatar_urls, created_at, updated_at"
+
+func scanUser(row interface{ Scan(...interface{}) error }, u *User) error {
+	var metadata, avatarURLs []byte
+	if err := row.Scan(&u.ID, &u.Email, &u.Username, &u.Phone, &u.Name, &u.Age, &u.IsActive, &metadata, &avatarURLs, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		return err
+	}
+	u.Metadata, u.AvatarURLs = nil, nil
+	if avatarURLs != nil {
+		if err := json.Unmarshal(avatarURLs, &u.AvatarURLs); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(metadata, &u.Metadata)
 }
 
 // @title Users Service API
@@ -31,13 +70,10 @@ type User struct {
 // @host localhost:8001
 // @BasePath /
 func main() {
-	databaseURL := os.Getenv("DATABASE_URL")
-	if databaseURL == "" {
-		log.Fatal("DATABASE_URL not set")
-	}
+	config.MustLoad("users-service", &cfg)
 
 	var err error
-	db, err = sql.Open("postgres", databaseURL)
+	db, err = sql.Open(observe.DriverName, cfg.DatabaseURL)
 	if err != nil {
 		log.Fatalf("DB connection error: %v", err)
 	}
@@ -47,25 +83,128 @@ func main() {
 		log.Fatalf("DB ping error: %v", err)
 	}
 	log.Printf("✅ Connected to PostgreSQL (users-service)")
+	// Ошибки ограничений БД — 409/422/503 вместо 500.
+	apierr.SetTranslator(pg.APIError)
+	dbWatch = dbhealth.FromEnv(db)
+
+	internalTLS, err := mtls.Load(mtls.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("mTLS config error: %v", err)
+	}
+	internalTLS.WatchSIGHUP()
+
+	signatures, err := hmacsign.VerifierFromEnv()
+	if err != nil {
+		log.Fatalf("HMAC verification config error: %v", err)
+	}
+
+	serviceMode, err = mode.FromEnv()
+	if err != nil {
+		log.Fatalf("Service mode config error: %v", err)
+	}
+	featureFlags, err = flags.FromEnv()
+	if err != nil {
+		log.Fatalf("Feature flags config error: %v", err)
+	}
+	featureFlags.Watch()
+	specValidator, err := specvalidate.FromEnv(docs.SwaggerInfo.ReadDoc())
+	if err != nil {
+		log.Fatalf("OpenAPI validation config error: %v", err)
+	}
+
+	port := cfg.Port
+
+	userCache, err = cache.FromEnv("users")
+	if err != nil {
+		log.Fatalf("Redis config error: %v", err)
+	}
+	defer userCache.Close()
+	initAuth()
+	initMail()
+	initUsernames()
+	if err := initAvatarStore(); err != nil {
+		log.Fatalf("Avatar storage config error: %v", err)
+	}
+
+	workers, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	dbWatch.Start(workers)
+	dedup.StartPruner(workers, db)
+	startUserEventsPruner(workers)
+	startEmailDomainRules(workers)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8001"
+	limiter := limit.FromEnv()
+	rateLimiter, err := ratelimit.FromEnv("users")
+	if err != nil {
+		log.Fatalf("Rate limit config error: %v", err)
 	}
+	defer rateLimiter.Close()
 
 	router := mux.NewRouter()
+	router.Use(apierr.Localize)
+	router.Use(observe.Middleware())
+	router.Use(limiter.Middleware)
+	router.Use(dbWatch.Middleware("/users/{id}"))
+	router.Use(auth.Middleware())
+	router.Use(rateLimiter.Middleware)
+	router.Use(audit.Middleware(db, "/admin/", "/dead-letters/"))
+	router.Use(serviceMode.Middleware)
+	router.Use(specValidator.Middleware)
 	router.HandleFunc("/health", healthCheck).Methods("GET")
+	router.HandleFunc("/ready", dbWatch.ReadyHandler).Methods("GET")
+	router.HandleFunc("/health/ready", dbWatch.ReadyHandler).Methods("GET")
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	router.HandleFunc("/errors/catalog", apierr.CatalogHandler).Methods("GET")
+	router.HandleFunc("/admin/mode", admin.RequireKey(serviceMode.Handler)).Methods("POST")
+	router.HandleFunc("/admin/concurrency", admin.RequireKey(limiter.Handler)).Methods("GET", "PUT")
+	router.HandleFunc("/admin/rate-limits/users/{id}", admin.RequireKey(rateLimiter.Handler)).Methods("GET", "PUT", "DELETE")
+	router.HandleFunc("/admin/flags", admin.RequireKey(featureFlags.Handler)).Methods("GET")
+	router.HandleFunc("/admin/seed", admin.RequireKey(seed.Handler(insertSeed))).Methods("POST")
+	router.HandleFunc("/admin/audit", admin.RequireKey(audit.Handler(db))).Methods("GET")
+	router.HandleFunc("/admin/email-domains", admin.RequireKey(getEmailDomains)).Methods("GET")
+	router.HandleFunc("/admin/email-domains/{list}/{domain}", admin.RequireKey(putEmailDomain)).Methods("PUT")
+	router.HandleFunc("/admin/email-domains/{list}/{domain}", admin.RequireKey(deleteEmailDomain)).Methods("DELETE")
+	router.HandleFunc("/auth/login", login).Methods("POST")
+	router.HandleFunc("/auth/login/2fa", loginTwoFactor).Methods("POST")
+	router.HandleFunc("/auth/refresh", refreshTokens).Methods("POST")
+	router.HandleFunc("/auth/impersonation/stop", stopImpersonation).Methods("POST")
+	router.HandleFunc("/auth/confirm-email-change", confirmEmailChange).Methods("POST")
+	router.HandleFunc("/auth/undo-email-change", undoEmailChange).Methods("POST")
+	router.HandleFunc("/events/orders", internalTLS.RequireClientCert(signatures.Require(consumeOrderEvent))).Methods("POST")
 	router.HandleFunc("/users", getUsers).Methods("GET")
+	router.HandleFunc("/users/check-username", checkUsername).Methods("GET")
+	router.HandleFunc("/users/bulk-deactivate", admin.RequireKey(bulkDeactivateUsers)).Methods("POST")
+	router.HandleFunc("/users/bulk-deactivate/{id}", admin.RequireKey(getDeactivationRun)).Methods("GET")
+	router.HandleFunc("/users/bulk-deactivate/{id}/ids", admin.RequireKey(getDeactivationRunIDs)).Methods("GET")
 	router.HandleFunc("/users/{id}", getUser).Methods("GET")
 	router.HandleFunc("/users", createUser).Methods("POST")
 	router.HandleFunc("/users/{id}", updateUser).Methods("PUT")
 	router.HandleFunc("/users/{id}", deleteUser).Methods("DELETE")
-	
+	router.HandleFunc("/users/{id}/activity", getUserActivity).Methods("GET")
+	router.HandleFunc("/users/{id}/profile", getPublicProfile).Methods("GET")
+	router.HandleFunc("/users/{id}/username", changeUsername).Methods("PATCH")
+	router.HandleFunc("/users/{id}/notification-preferences", getNotificationPreferences).Methods("GET")
+	router.HandleFunc("/users/{id}/notification-preferences", updateNotificationPreferences).Methods("PUT")
+	router.HandleFunc("/users/{id}/avatar", uploadAvatar).Methods("PUT")
+	router.HandleFunc("/users/{id}/avatar", getAvatar).Methods("GET")
+	router.HandleFunc("/users/{id}/avatar", deleteAvatar).Methods("DELETE")
+	router.HandleFunc("/users/{id}/change-email", requestEmailChange).Methods("POST")
+	router.HandleFunc("/users/{id}/impersonate", admin.RequireKey(impersonateUser)).Methods("POST")
+	router.HandleFunc("/users/{id}/deactivate", admin.RequireKey(deactivateUser)).Methods("POST")
+	router.HandleFunc("/users/{id}/activate", admin.RequireKey(activateUser)).Methods("POST")
+	router.HandleFunc("/users/{id}/2fa/setup", setupTOTP).Methods("POST")
+	router.HandleFunc("/users/{id}/2fa/enable", enableTOTP).Methods("POST")
+	router.HandleFunc("/users/{id}/2fa/disable", disableTOTP).Methods("POST")
+	router.HandleFunc("/users/{id}/sessions", getUserSessions).Methods("GET")
+	router.HandleFunc("/users/{id}/sessions", revokeUserSessions).Methods("DELETE")
+	router.HandleFunc("/users/{id}/sessions/{session_id}", revokeUserSession).Methods("DELETE")
+
 	router.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
 
 	log.Printf("🚀 Users Service started on port %s", port)
 	log.Printf("📚 Swagger UI: http://localhost:%s/swagger/index.html", port)
-	if err := http.ListenAndServe(":"+port, router); err != nil {
+	srv := &http.Server{Addr: ":" + port, Handler: replica.Middleware(router)}
+	if err := internalTLS.ListenAndServe(srv); err != nil {
 		log.Fatalf("Server error: %v", err)
 	}
 }
@@ -78,19 +217,62 @@ func main() {
 // @Router /health [get]
 func healthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     "healthy",
+		"mode":       serviceMode.Get(),
+		"replica_id": replica.ID(),
+		"database":   dbWatch.Status(),
+	})
 }
 
 // @Summary Get all users
 // @Description Получить список всех пользователей
 // @Tags users
 // @Produce json
+// @Param is_active query bool false "Только активные (true) или деактивированные (false)"
+// @Param metadata.key query string false "Фильтр по metadata: ?metadata.<ключ>=<значение>, можно несколько"
+// @Param ids query string false "Только пользователи с этими id, через запятую (не больше 100)"
 // @Success 200 {array} User
+// @Failure 400 {object} map[string]string
 // @Router /users [get]
 func getUsers(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query("SELECT id, email, name, age, created_at, updated_at FROM users ORDER BY id LIMIT 100")
+	var where []string
+	var args []interface{}
+	if v := r.URL.Query().Get("is_active"); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			apierr.Write(w, apierr.InvalidRequest, "is_active must be true or false")
+			return
+		}
+		args = append(args, active)
+		where = append(where, fmt.Sprintf("is_active = $%d", len(args)))
+	}
+	filter, err := metadataFilter(r.URL.Query())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	if filter != nil {
+		args = append(args, filter)
+		where = append(where, fmt.Sprintf("metadata @> $%d::jsonb", len(args)))
+	}
+	if v := r.URL.Query().Get("ids"); v != "" {
+		ids, err := parseIDList(v, 100)
+		if err != nil {
+			apierr.Write(w, apierr.InvalidRequest, err.Error())
+			return
+		}
+		args = append(args, ids)
+		where = append(where, fmt.Sprintf("id = ANY($%d)", len(args)))
+	}
+
+	query := "SELECT " + userColumns + " FROM users"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	rows, err := db.QueryContext(r.Context(), observe.Named("users.list", query+" ORDER BY id LIMIT 100"), args...)
+	if err != nil {
+		apierr.Internal(w, err)
 		return
 	}
 	defer rows.Close()
@@ -98,8 +280,8 @@ func getUsers(w http.ResponseWriter, r *http.Request) {
 	var users []User
 	for rows.Next() {
 		var u User
-		if err := rows.Scan(&u.ID, &u.Email, &u.Name, &u.Age, &u.CreatedAt, &u.UpdatedAt); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if err := scanUser(rows, &u); err != nil {
+			apierr.Internal(w, err)
 			return
 		}
 		users = append(users, u)
@@ -109,6 +291,23 @@ func getUsers(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(users)
 }
 
+// parseIDList разбирает список id через запятую, не длиннее max.
+func parseIDList(s string, max int) ([]int64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) > max {
+		return nil, fmt.Errorf("ids: at most %d ids per request", max)
+	}
+	ids := make([]int64, 0, len(parts))
+	for _, p := range parts {
+		id, err := strconv.ParseInt(strings.TrimSpace(p), 10, 64)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("ids: %q is not a valid id", p)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
 // @Summary Get user by ID
 // @Description Получить пользователя по ID
 // @Tags users
@@ -122,46 +321,124 @@ func getUser(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(vars["id"])
 
 	var u User
-	err := db.QueryRow("SELECT id, email, name, age, created_at, updated_at FROM users WHERE id = $1", id).
-		Scan(&u.ID, &u.Email, &u.Name, &u.Age, &u.CreatedAt, &u.UpdatedAt)
+	if userCache.Get(r.Context(), strconv.Itoa(id), &u) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(u)
+		return
+	}
+	// Без БД пользователь отдаётся только из кэша.
+	if !dbWatch.Up() {
+		dbWatch.Unavailable(w)
+		return
+	}
+
+	// Метка берётся до чтения: если пользователя изменят, пока идёт
+	// чтение, устаревшая версия в кэш не попадёт.
+	stamp, stamped := userCache.Stamp(r.Context(), strconv.Itoa(id))
+	err := scanUser(db.QueryRowContext(r.Context(), observe.Lookup("users.get_by_id", "SELECT "+userColumns+" FROM users WHERE id = $1"), id), &u)
 
 	if err == sql.ErrNoRows {
-		http.Error(w, "User not found", http.StatusNotFound)
+		apierr.Write(w, apierr.UserNotFound, "User not found")
 		return
 	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Internal(w, err)
 		return
 	}
+	if stamped {
+		userCache.SetIfUnchanged(r.Context(), strconv.Itoa(id), u, stamp)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(u)
 }
 
 // @Summary Create user
-// @Description Создать нового пользователя
+// @Description Создать нового пользователя. password (от 8 символов) необязателен и нужен для входа через /auth/login; в ответе не возвращается. metadata — плоский объект строк: до 20 ключей до 40 символов, значения до 500 символов, ключи с "_" в начале зарезервированы. username необязателен: 3–30 символов, уникален без учёта регистра (409 duplicate_username). phone необязателен, формат E.164 (+79991234567). Домен email проверяется по блок-листу и allowlist (GET /admin/email-domains).
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param user body User true "User data"
 // @Success 201 {object} User
 // @Failure 400 {object} map[string]string
+// @Failure 422 {object} map[string]interface{} "email_domain_not_allowed: домен в блок-листе или вне allowlist"
 // @Router /users [post]
 func createUser(w http.ResponseWriter, r *http.Request) {
 	var u User
 	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	if err := emailDomainRules.check(u.Email); err != nil {
+		apierr.Respond(w, err)
+		return
+	}
+
+	var hash *string
+	if u.Password != "" {
+		h, err := hashPassword(u.Password)
+		if err != nil {
+			apierr.Write(w, apierr.InvalidRequest, err.Error())
+			return
+		}
+		hash = &h
+	}
+	u.Password = ""
+	if err := validateMetadata(u.Metadata); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	metadata, _ := json.Marshal(u.Metadata)
+	if u.Metadata == nil {
+		metadata = []byte("{}")
+	}
+	if u.Username != nil {
+		if err := validateUsername(*u.Username); err != nil {
+			apierr.Write(w, apierr.InvalidRequest, err.Error())
+			return
+		}
+	}
+	if err := validatePhone(u.Phone); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		apierr.Internal(w, err)
 		return
 	}
+	defer tx.Rollback()
 
-	err := db.QueryRow(
-		"INSERT INTO users (email, name, age) VALUES ($1, $2, $3) RETURNING id, created_at, updated_at",
-		u.Email, u.Name, u.Age,
-	).Scan(&u.ID, &u.CreatedAt, &u.UpdatedAt)
+	if u.Username != nil {
+		if reason, err := usernameUnavailable(r.Context(), tx, *u.Username, 0); err != nil {
+			apierr.Internal(w, err)
+			return
+		} else if reason != "" {
+			apierr.Write(w, apierr.DuplicateUsername, "Username is not available")
+			return
+		}
+	}
 
+	err = scanUser(tx.QueryRowContext(r.Context(),
+		observe.Named("users.insert", `INSERT INTO users (email, name, age, password_hash, metadata, username, username_changed_at, phone)
+		 VALUES ($1, $2, $3, $4, $5, $6::varchar, CASE WHEN $6::varchar IS NULL THEN NULL ELSE NOW() END, NULLIF($7::varchar, '')) RETURNING `+userColumns),
+		u.Email, u.Name, u.Age, hash, metadata, u.Username, u.Phone,
+	), &u)
+	if isUsernameConflict(err) {
+		apierr.Write(w, apierr.DuplicateUsername, "Username is not available")
+		return
+	}
+	if err == nil {
+		err = recordUserEvent(r.Context(), tx, u.ID, userEventCreated, nil)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Internal(w, err)
 		return
 	}
+	userCache.Delete(r.Context(), strconv.Itoa(u.ID))
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -169,63 +446,176 @@ func createUser(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary Update user
-// @Description Обновить данные пользователя
+// @Description Обновить данные пользователя. Пустой password оставляет прежний; новый password принимается только от самого пользователя вместе с current_password или с X-Internal-API-Key, после смены все сессии пользователя отзываются, без metadata прежние metadata сохраняются, username не меняется (PATCH /users/{id}/username), без phone прежний телефон сохраняется, пустой phone удаляет его. email менять нельзя (409 email_change_requires_confirmation) — для этого POST /users/{id}/change-email.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param id path int true "User ID"
 // @Param user body User true "User data"
 // @Success 200 {object} User
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string "Смена password без аутентификации или с неверным current_password"
+// @Failure 403 {object} map[string]string "Смена password чужого аккаунта или под имперсонацией"
 // @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "email_change_requires_confirmation"
 // @Router /users/{id} [put]
 func updateUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, _ := strconv.Atoi(vars["id"])
 
-	var u User
-	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	var in struct {
+		User
+		CurrentPassword string `json:"current_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
 		return
 	}
+	u := in.User
+
+	// Пароль меняет только сам пользователь (с текущим паролем) или
+	// запрос с внутренним ключом; под имперсонацией — нельзя.
+	if u.Password != "" {
+		if _, ok := authorizeUser(w, r, id); !ok {
+			return
+		}
+		if auth.RefuseImpersonated(w, r) {
+			return
+		}
+	}
 
-	err := db.QueryRow(
-		"UPDATE users SET email=$1, name=$2, age=$3, updated_at=NOW() WHERE id=$4 RETURNING id, email, name, age, created_at, updated_at",
-		u.Email, u.Name, u.Age, id,
-	).Scan(&u.ID, &u.Email, &u.Name, &u.Age, &u.CreatedAt, &u.UpdatedAt)
+	// Пустой password оставляет прежний пароль.
+	var hash *string
+	if u.Password != "" {
+		h, err := hashPassword(u.Password)
+		if err != nil {
+			apierr.Write(w, apierr.InvalidRequest, err.Error())
+			return
+		}
+		hash = &h
+	}
+	u.Password = ""
 
+	// Email меняется только через POST /users/{id}/change-email с
+	// подтверждением нового адреса; здесь его можно передать лишь без
+	// изменений.
+	var current string
+	var currentHash sql.NullString
+	err := db.QueryRowContext(r.Context(), "SELECT email, password_hash FROM users WHERE id = $1", id).Scan(&current, &currentHash)
 	if err == sql.ErrNoRows {
-		http.Error(w, "User not found", http.StatusNotFound)
+		apierr.Write(w, apierr.UserNotFound, "User not found")
 		return
 	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Internal(w, err)
+		return
+	}
+	if hash != nil && !admin.HasKey(r) && currentHash.Valid &&
+		bcrypt.CompareHashAndPassword([]byte(currentHash.String), []byte(in.CurrentPassword)) != nil {
+		apierr.Write(w, apierr.InvalidCredentials, "current_password is missing or wrong")
+		return
+	}
+	if u.Email != "" && u.Email != current {
+		apierr.Write(w, apierr.EmailChangeRequiresConfirmation, fmt.Sprintf("Email cannot be changed here; use POST /users/%d/change-email", id))
 		return
 	}
 
+	// Без поля metadata прежние значения сохраняются; переданный объект
+	// заменяет их целиком.
+	if err := validateMetadata(u.Metadata); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	var metadata []byte
+	if u.Metadata != nil {
+		metadata, _ = json.Marshal(u.Metadata)
+	}
+	// Без поля phone прежний телефон сохраняется, "" удаляет его.
+	if err := validatePhone(u.Phone); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	err = scanUser(tx.QueryRowContext(r.Context(),
+		observe.Lookup("users.update", "UPDATE users SET name=$1, age=$2, password_hash=COALESCE($4, password_hash), metadata=COALESCE($5::jsonb, metadata), phone=CASE WHEN $6::varchar IS NULL THEN phone ELSE NULLIF($6, '') END, updated_at=NOW() WHERE id=$3 RETURNING "+userColumns),
+		u.Name, u.Age, id, hash, metadata, u.Phone,
+	), &u)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.UserNotFound, "User not found")
+		return
+	}
+	if err == nil && hash != nil {
+		err = recordUserEvent(r.Context(), tx, id, userEventPasswordChanged, nil)
+	}
+	// Со сменой пароля все refresh-сессии пользователя отзываются.
+	if err == nil && hash != nil {
+		_, err = tx.ExecContext(r.Context(), "UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", id)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	userCache.Delete(r.Context(), strconv.Itoa(id))
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(u)
 }
 
 // @Summary Delete user
-// @Description Удалить пользователя
+// @Description Удалить пользователя вместе с файлами аватара. Под имперсонацией запрещено (403).
 // @Tags users
 // @Param id path int true "User ID"
 // @Success 204
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Router /users/{id} [delete]
 func deleteUser(w http.ResponseWriter, r *http.Request) {
+	if auth.RefuseImpersonated(w, r) {
+		return
+	}
 	vars := mux.Vars(r)
 	id, _ := strconv.Atoi(vars["id"])
 
-	result, err := db.Exec("DELETE FROM users WHERE id = $1", id)
+	tx, err := db.BeginTx(r.Context(), nil)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierr.Internal(w, err)
 		return
 	}
+	defer tx.Rollback()
 
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		http.Error(w, "User not found", http.StatusNotFound)
+	var avatarKeys []byte
+	err = tx.QueryRowContext(r.Context(), observe.Lookup("users.delete", "DELETE FROM users WHERE id = $1 RETURNING avatar_keys"), id).Scan(&avatarKeys)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.UserNotFound, "User not found")
 		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	// Запись аудита фиксируется в одной транзакции с удалением.
+	err = audit.Write(r.Context(), tx)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	userCache.Delete(r.Context(), strconv.Itoa(id))
+	if avatarKeys != nil {
+		var keys map[string]string
+		json.Unmarshal(avatarKeys, &keys)
+		deleteAvatarFiles(keys)
 	}
 
 	w.WriteHeader(http.StatusNoContent)
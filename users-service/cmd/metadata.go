@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Ограничения metadata: плоский объект строка → строка.
+const (
+	maxMetadataKeys     = 20
+	maxMetadataKeyLen   = 40
+	maxMetadataValueLen = 500
+)
+
+// metadataKeyPattern — допустимые ключи. Ключи с "_" в начале
+// зарезервированы под служебные поля.
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+const metadataQueryPrefix = "metadata."
+
+func validateMetadata(m map[string]string) error {
+	if len(m) > maxMetadataKeys {
+		return fmt.Errorf("metadata may have at most %d keys", maxMetadataKeys)
+	}
+	for k, v := range m {
+		if strings.HasPrefix(k, "_") {
+			return fmt.Errorf("metadata key %q is reserved: keys starting with _ are not allowed", k)
+		}
+		if len(k) > maxMetadataKeyLen || !metadataKeyPattern.MatchString(k) {
+			return fmt.Errorf("metadata key %q must be up to %d characters of letters, digits, '_', '.', '-'", k, maxMetadataKeyLen)
+		}
+		if len(v) > maxMetadataValueLen {
+			return fmt.Errorf("metadata value for %q exceeds %d characters", k, maxMetadataValueLen)
+		}
+	}
+	return nil
+}
+
+// metadataFilter собирает из параметров ?metadata.<key>=<value> объект для
+// проверки вхождения (metadata @> ...), которую обслуживает GIN-индекс.
+// Возвращает nil, если таких параметров нет.
+func metadataFilter(q url.Values) ([]byte, error) {
+	filter := map[string]string{}
+	for param, values := range q {
+		key, ok := strings.CutPrefix(param, metadataQueryPrefix)
+		if !ok {
+			continue
+		}
+		if key == "" || len(values) != 1 {
+			return nil, fmt.Errorf("%s expects a single value", param)
+		}
+		filter[key] = values[0]
+	}
+	if len(filter) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(filter)
+}
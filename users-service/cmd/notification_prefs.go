@@ -0,0 +1,111 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+	"pkg/clients"
+)
+
+// NotificationPreferences — какие уведомления получает пользователь; по
+// ним orders-service решает, отправлять ли письмо, а delivery-service —
+// SMS. Письма users-service о безопасности аккаунта от них не зависят.
+type NotificationPreferences = clients.NotificationPreferences
+
+// loadNotificationPreferences читает users.notification_preferences
+// поверх умолчаний: ключи, которые пользователь не менял, включены.
+func loadNotificationPreferences(r *http.Request, id int) (NotificationPreferences, error) {
+	prefs := clients.DefaultNotificationPreferences()
+	var raw []byte
+	err := db.QueryRowContext(r.Context(), "SELECT notification_preferences FROM users WHERE id = $1", id).Scan(&raw)
+	if err != nil {
+		return prefs, err
+	}
+	return prefs, json.Unmarshal(raw, &prefs)
+}
+
+// @Summary Get notification preferences
+// @Description Какие уведомления получает пользователь: email_order_updates (письма о заказах; order_confirmed, order_shipped, order_delivered — отдельные письма), sms_delivery_updates (SMS о доставке), marketing (реклама, по умолчанию выключена). Владелец аккаунта или X-Internal-API-Key; orders- и delivery-service спрашивают их перед каждой отправкой.
+// @Tags users
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} NotificationPreferences
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /users/{id}/notification-preferences [get]
+func getNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if _, ok := authorizeUser(w, r, id); !ok {
+		return
+	}
+	prefs, err := loadNotificationPreferences(r, id)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.UserNotFound, "User not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// @Summary Update notification preferences
+// @Description Изменить настройки уведомлений. Поля, которых нет в теле, не меняются. Отправители кэшируют настройки, поэтому изменение вступает в силу в течение NOTIFICATION_PREFERENCES_TTL.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param preferences body NotificationPreferences true "Preferences"
+// @Success 200 {object} NotificationPreferences
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /users/{id}/notification-preferences [put]
+func updateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if _, ok := authorizeUser(w, r, id); !ok {
+		return
+	}
+	// Поля без значения в теле не попадают в patch и остаются прежними.
+	var patch struct {
+		EmailOrderUpdates  *bool `json:"email_order_updates,omitempty"`
+		SMSDeliveryUpdates *bool `json:"sms_delivery_updates,omitempty"`
+		Marketing          *bool `json:"marketing,omitempty"`
+		OrderConfirmed     *bool `json:"order_confirmed,omitempty"`
+		OrderShipped       *bool `json:"order_shipped,omitempty"`
+		OrderDelivered     *bool `json:"order_delivered,omitempty"`
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&patch); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+
+	body, _ := json.Marshal(patch)
+	var raw []byte
+	err := db.QueryRowContext(r.Context(),
+		"UPDATE users SET notification_preferences = notification_preferences || $1::jsonb WHERE id = $2 RETURNING notification_preferences",
+		string(body), id).Scan(&raw)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.UserNotFound, "User not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	prefs := clients.DefaultNotificationPreferences()
+	if err := json.Unmarshal(raw, &prefs); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
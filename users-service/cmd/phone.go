@@ -0,0 +1,18 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+)
+
+// phonePattern — E.164: "+", код страны и номер, до 15 цифр.
+var phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// validatePhone проверяет phone из тела запроса; nil (поле не передано) и
+// "" (удалить телефон) допустимы.
+func validatePhone(phone *string) error {
+	if phone == nil || *phone == "" || phonePattern.MatchString(*phone) {
+		return nil
+	}
+	return errors.New("phone must be in E.164 format, e.g. +79991234567")
+}
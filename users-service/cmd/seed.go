@@ -0,0 +1,17 @@
+package main
+
+import (
+	"context"
+
+	"pkg/seed"
+)
+
+// insertSeed вставляет демо-пользователей для POST /admin/seed.
+func insertSeed(ctx context.Context, ds seed.Dataset, reset bool) ([]seed.Report, error) {
+	rows := make([][]interface{}, 0, len(ds.Users))
+	for _, u := range ds.Users {
+		rows = append(rows, []interface{}{u.ID, u.Email, u.Name, u.Age})
+	}
+	rep, err := seed.Insert(ctx, db, "users", []string{"id", "email", "name", "age"}, rows, reset)
+	return []seed.Report{rep}, err
+}
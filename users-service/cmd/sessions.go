@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+)
+
+// Session — активная сессия пользователя (выданный refresh-токен).
+type Session struct {
+	ID         string  `json:"id"`
+	UserAgent  string  `json:"user_agent"`
+	IP         string  `json:"ip"`
+	CreatedAt  string  `json:"created_at"`
+	LastUsedAt *string `json:"last_used_at"`
+	ExpiresAt  string  `json:"expires_at"`
+	Current    bool    `json:"current"`
+}
+
+// @Summary List user sessions
+// @Description Активные сессии пользователя. current — сессия, которой выпущен access-токен запроса. Доступно владельцу (Bearer) и по X-Internal-API-Key.
+// @Tags sessions
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {array} Session
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /users/{id}/sessions [get]
+func getUserSessions(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	claims, ok := authorizeUser(w, r, id)
+	if !ok {
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT id, user_agent, ip, created_at, last_used_at, expires_at FROM user_sessions
+		 WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		 ORDER BY COALESCE(last_used_at, created_at) DESC`, id)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		s.Current = s.ID == claims.SessionID
+		sessions = append(sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// @Summary Revoke session
+// @Description Отозвать сессию: её refresh-токен сразу перестаёт работать, выданный access-токен доживает свой короткий срок.
+// @Tags sessions
+// @Param id path int true "User ID"
+// @Param session_id path string true "Session ID"
+// @Success 204
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /users/{id}/sessions/{session_id} [delete]
+func revokeUserSession(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+	if _, ok := authorizeUser(w, r, id); !ok {
+		return
+	}
+
+	result, err := db.ExecContext(r.Context(),
+		"UPDATE user_sessions SET revoked_at = NOW() WHERE id::text = $1 AND user_id = $2 AND revoked_at IS NULL",
+		vars["session_id"], id)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		apierr.Write(w, apierr.SessionNotFound, "Session not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Revoke other sessions
+// @Description Отозвать все сессии пользователя, кроме текущей. С X-Internal-API-Key текущей сессии нет — отзываются все.
+// @Tags sessions
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]int
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /users/{id}/sessions [delete]
+func revokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	claims, ok := authorizeUser(w, r, id)
+	if !ok {
+		return
+	}
+
+	result, err := db.ExecContext(r.Context(),
+		"UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL AND id::text <> $2",
+		id, claims.SessionID)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	n, _ := result.RowsAffected()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"revoked": int(n)})
+}
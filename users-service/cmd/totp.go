@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+	"pkg/auth"
+)
+
+// Параметры TOTP (RFC 6238) — значения по умолчанию приложений-
+// аутентификаторов: SHA1, 6 цифр, шаг 30 секунд.
+const (
+	totpStep   = 30
+	totpDigits = 6
+	// totpSkew — сколько шагов до и после текущего принимается.
+	totpSkew = 1
+	// totpIssuer — имя сервиса в приложении-аутентификаторе.
+	totpIssuer = "Microservices"
+
+	recoveryCodeCount = 10
+	challengeTTL      = 5 * time.Minute
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTPSetup — ответ POST /users/{id}/2fa/setup.
+type TOTPSetup struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+}
+
+// TOTPCode — тело запросов с кодом: TOTP из приложения или код
+// восстановления.
+type TOTPCode struct {
+	Code string `json:"code"`
+}
+
+// RecoveryCodes — ответ POST /users/{id}/2fa/enable. Коды показываются один
+// раз, в БД хранится только их sha256.
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// TwoFactorChallenge — промежуточный ответ /auth/login для аккаунтов с 2FA.
+type TwoFactorChallenge struct {
+	Status         string `json:"status"`
+	ChallengeToken string `json:"challenge_token"`
+}
+
+// TwoFactorLogin — тело POST /auth/login/2fa.
+type TwoFactorLogin struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+// totpCode — код для шага step.
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	v := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, v%1000000)
+}
+
+// matchTOTP ищет шаг в пределах totpSkew, для которого code верен.
+func matchTOTP(secret string, code string, now time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpStep
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(totpEncoding.EncodeToString(b))
+	return code[:8] + "-" + code[8:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+}
+
+// checkSecondFactor принимает TOTP-код или неиспользованный код
+// восстановления. TOTP-код, как и код восстановления, одноразовый: шаг
+// запоминается в totp_last_step, и повтор того же кода отклоняется.
+func checkSecondFactor(ctx context.Context, userID int, secret, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if step, ok := matchTOTP(secret, code, time.Now()); ok {
+		result, err := db.ExecContext(ctx,
+			"UPDATE users SET totp_last_step = $2 WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2)",
+			userID, step)
+		if err != nil {
+			return false, err
+		}
+		n, _ := result.RowsAffected()
+		return n == 1, nil
+	}
+
+	result, err := db.ExecContext(ctx,
+		"UPDATE user_recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL",
+		userID, refreshHash(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n == 1, nil
+}
+
+// issueChallenge выдаёт короткоживущий токен между вводом пароля и кода.
+func issueChallenge(userID int) (string, error) {
+	now := time.Now()
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		Purpose: "2fa",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(userID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(challengeTTL)),
+		},
+	}).SignedString(jwtSecret)
+}
+
+func decodeCode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req TOTPCode
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Code) == "" {
+		apierr.Write(w, apierr.InvalidRequest, "code is required")
+		return "", false
+	}
+	return req.Code, true
+}
+
+// @Summary Set up 2FA
+// @Description Создать TOTP-секрет. 2FA включается только после подтверждения первого кода в POST /users/{id}/2fa/enable; повторный setup до этого заменяет секрет. Доступно владельцу (Bearer) и по X-Internal-API-Key.
+// @Tags 2fa
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} TOTPSetup
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "2FA уже включена"
+// @Router /users/{id}/2fa/setup [post]
+func setupTOTP(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if _, ok := authorizeUser(w, r, id); !ok {
+		return
+	}
+
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	secret := totpEncoding.EncodeToString(key)
+
+	var email string
+	var enabled bool
+	err := db.QueryRowContext(r.Context(), "SELECT email, totp_enabled FROM users WHERE id = $1", id).Scan(&email, &enabled)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.UserNotFound, "User not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if enabled {
+		apierr.Write(w, apierr.InvalidState, "2FA is already enabled")
+		return
+	}
+	if _, err := db.ExecContext(r.Context(),
+		"UPDATE users SET totp_secret = $2, totp_last_step = NULL WHERE id = $1 AND NOT totp_enabled", id, secret); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	label := url.PathEscape(totpIssuer + ":" + email)
+	q := url.Values{"secret": {secret}, "issuer": {totpIssuer}, "algorithm": {"SHA1"}, "digits": {strconv.Itoa(totpDigits)}, "period": {strconv.Itoa(totpStep)}}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TOTPSetup{Secret: secret, OTPAuthURL: "otpauth://totp/" + label + "?" + q.Encode()})
+}
+
+// @Summary Enable 2FA
+// @Description Подтвердить первый TOTP-код и включить 2FA. Возвращает 10 одноразовых кодов восстановления — они показываются один раз.
+// @Tags 2fa
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param code body TOTPCode true "TOTP code"
+// @Success 200 {object} RecoveryCodes
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string "2FA уже включена или setup не выполнен"
+// @Failure 422 {object} map[string]string "Неверный код"
+// @Router /users/{id}/2fa/enable [post]
+func enableTOTP(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if _, ok := authorizeUser(w, r, id); !ok {
+		return
+	}
+	code, ok := decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var secret sql.NullString
+	var enabled bool
+	err = tx.QueryRowContext(r.Context(), "SELECT totp_secret, totp_enabled FROM users WHERE id = $1 FOR UPDATE", id).Scan(&secret, &enabled)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.UserNotFound, "User not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if enabled || !secret.Valid {
+		apierr.Write(w, apierr.InvalidState, "2FA is already enabled or not set up")
+		return
+	}
+	step, ok := matchTOTP(secret.String, strings.TrimSpace(code), time.Now())
+	if !ok {
+		apierr.Write(w, apierr.Invalid2FACode, "Invalid code")
+		return
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = newRecoveryCode(); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		if _, err := tx.ExecContext(r.Context(),
+			"INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)", id, refreshHash(normalizeRecoveryCode(codes[i]))); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+	}
+	_, err = tx.ExecContext(r.Context(), "UPDATE users SET totp_enabled = TRUE, totp_last_step = $2 WHERE id = $1", id, step)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RecoveryCodes{RecoveryCodes: codes})
+}
+
+// @Summary Disable 2FA
+// @Description Выключить 2FA. Требует действующий TOTP-код или код восстановления; секрет и коды восстановления удаляются.
+// @Tags 2fa
+// @Accept json
+// @Param id path int true "User ID"
+// @Param code body TOTPCode true "TOTP or recovery code"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string "2FA не включена"
+// @Failure 422 {object} map[string]string "Неверный код"
+// @Router /users/{id}/2fa/disable [post]
+func disableTOTP(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if _, ok := authorizeUser(w, r, id); !ok {
+		return
+	}
+	code, ok := decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	var secret sql.NullString
+	var enabled bool
+	err := db.QueryRowContext(r.Context(), "SELECT totp_secret, totp_enabled FROM users WHERE id = $1", id).Scan(&secret, &enabled)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.UserNotFound, "User not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if !enabled {
+		apierr.Write(w, apierr.InvalidState, "2FA is not enabled")
+		return
+	}
+	ok, err = checkSecondFactor(r.Context(), id, secret.String, code)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if !ok {
+		apierr.Write(w, apierr.Invalid2FACode, "Invalid code")
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(r.Context(), "DELETE FROM user_recovery_codes WHERE user_id = $1", id)
+	if err == nil {
+		_, err = tx.ExecContext(r.Context(), "UPDATE users SET totp_enabled = FALSE, totp_secret = NULL, totp_last_step = NULL WHERE id = $1", id)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Complete 2FA login
+// @Description Второй шаг входа для аккаунтов с 2FA: challenge_token из /auth/login (живёт 5 минут) и TOTP-код или код восстановления.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param login body TwoFactorLogin true "Challenge and code"
+// @Success 200 {object} TokenPair
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string "account_deactivated"
+// @Router /auth/login/2fa [post]
+func loginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if !requireJWTSecret(w) {
+		return
+	}
+	var req TwoFactorLogin
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeToken == "" || req.Code == "" {
+		apierr.Write(w, apierr.InvalidRequest, "challenge_token and code are required")
+		return
+	}
+
+	c, err := auth.Parse(jwtSecret, req.ChallengeToken)
+	if err != nil || c.Purpose != "2fa" {
+		apierr.Write(w, apierr.InvalidChallenge, "Invalid or expired challenge")
+		return
+	}
+	userID, _ := strconv.Atoi(c.Subject)
+
+	var secret sql.NullString
+	var enabled, active bool
+	err = db.QueryRowContext(r.Context(), "SELECT totp_secret, totp_enabled, is_active FROM users WHERE id = $1", userID).Scan(&secret, &enabled, &active)
+	if err == sql.ErrNoRows || (err == nil && !enabled) {
+		apierr.Write(w, apierr.InvalidChallenge, "Invalid or expired challenge")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if !active {
+		apierr.Write(w, apierr.AccountDeactivated, "Account is deactivated")
+		return
+	}
+	ok, err := checkSecondFactor(r.Context(), userID, secret.String, req.Code)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if !ok {
+		apierr.Write(w, apierr.InvalidCredentials, "Invalid code")
+		return
+	}
+
+	startSession(w, r, userID)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+	"pkg/dedup"
+	"pkg/events"
+	"pkg/pg"
+)
+
+// Типы событий журнала активности пользователя.
+const (
+	userEventCreated         = "user.created"
+	userEventEmailChanged    = "user.email_changed"
+	userEventPasswordChanged = "user.password_changed"
+	userEventUsernameChanged = "user.username_changed"
+	userEventOrderPlaced     = events.OrderPlaced
+)
+
+// Источники событий: сам сервис и outbox orders-service.
+const (
+	userEventsSourceSelf   = "users-service"
+	userEventsSourceOrders = "orders-service"
+)
+
+// Источник в processed_events для событий заказов.
+const orderEventsSource = "orders-outbox"
+
+// UserEvent — запись журнала активности. Записи только добавляются;
+// удаляет их лишь задача очистки по сроку хранения.
+type UserEvent struct {
+	ID         int64           `json:"id"`
+	Type       string          `json:"type"`
+	Source     string          `json:"source"`
+	Payload    json.RawMessage `json:"payload"`
+	OccurredAt time.Time       `json:"occurred_at"`
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// recordUserEvent пишет событие сервиса в журнал. Вызывается в транзакции
+// самого изменения, чтобы журнал не расходился с данными.
+func recordUserEvent(ctx context.Context, ex execer, userID int, eventType string, payload map[string]interface{}) error {
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = ex.ExecContext(ctx,
+		"INSERT INTO user_events (user_id, event_type, source, payload) VALUES ($1, $2, $3, $4)",
+		userID, eventType, userEventsSourceSelf, b)
+	return err
+}
+
+// @Summary User activity
+// @Description Журнал значимых событий аккаунта, новые сверху: user.created, user.email_changed, user.password_changed, user.username_changed, order.placed (из orders-service). Фильтр type — список типов через запятую. Постранично: следующая страница — before_id из next_before_id. Требует Bearer-токен этого пользователя или X-Internal-API-Key.
+// @Tags users
+// @Produce json
+// @Param id path int true "User ID"
+// @Param type query string false "Типы событий через запятую"
+// @Param before_id query int false "Курсор: события с id меньше"
+// @Param limit query int false "Размер страницы (по умолчанию 50, до 200)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /users/{id}/activity [get]
+func getUserActivity(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if _, ok := authorizeUser(w, r, id); !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	where := []string{"user_id = $1"}
+	args := []interface{}{id}
+	if v := q.Get("type"); v != "" {
+		args = append(args, strings.Split(v, ","))
+		where = append(where, "event_type = ANY($"+strconv.Itoa(len(args))+")")
+	}
+	if v := q.Get("before_id"); v != "" {
+		before, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			apierr.Write(w, apierr.InvalidRequest, "before_id must be an integer")
+			return
+		}
+		args = append(args, before)
+		where = append(where, "id < $"+strconv.Itoa(len(args)))
+	}
+	limit := 50
+	if v, err := strconv.Atoi(q.Get("limit")); err == nil && v > 0 && v <= 200 {
+		limit = v
+	}
+	args = append(args, limit)
+
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT id, event_type, source, payload, occurred_at FROM user_events
+		 WHERE `+strings.Join(where, " AND ")+` ORDER BY id DESC LIMIT $`+strconv.Itoa(len(args)),
+		args...)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	list := []UserEvent{}
+	for rows.Next() {
+		var e UserEvent
+		if err := rows.Scan(&e.ID, &e.Type, &e.Source, &e.Payload, &e.OccurredAt); err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		list = append(list, e)
+	}
+	if err := rows.Err(); err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	resp := map[string]interface{}{"events": list}
+	if len(list) == limit {
+		resp["next_before_id"] = list[len(list)-1].ID
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// @Summary Consume order event
+// @Description Приём событий заказов от outbox orders-service. order.placed добавляется в журнал активности пользователя; остальные типы игнорируются. Повторно доставленное событие (тот же event_id) ничего не меняет.
+// @Tags events
+// @Accept json
+// @Produce json
+// @Param event body events.Envelope true "Order event"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Router /events/orders [post]
+func consumeOrderEvent(w http.ResponseWriter, r *http.Request) {
+	var env events.Envelope
+	if err := json.NewDecoder(r.Body).Decode(&env); err != nil {
+		apierr.Write(w, apierr.ValidationFailed, err.Error())
+		return
+	}
+	if env.EventID == "" {
+		apierr.Write(w, apierr.ValidationFailed, "event_id is required")
+		return
+	}
+	result := func(res string) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"event_id": env.EventID, "result": res})
+	}
+	if env.EventType != events.OrderPlaced {
+		result("ignored")
+		return
+	}
+
+	var p events.OrderPayload
+	if err := json.Unmarshal(env.Payload, &p); err != nil || p.OrderID <= 0 || p.UserID <= 0 {
+		log.Printf("⚠️ Rejected order event %s: invalid payload", env.EventID)
+		apierr.Write(w, apierr.ValidationFailed, "Invalid order.placed payload: order_id and user_id are required")
+		return
+	}
+	occurredAt := env.OccurredAt
+	if occurredAt.IsZero() {
+		occurredAt = time.Now()
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"order_id":     p.OrderID,
+		"total_amount": p.TotalAmount,
+		"currency":     p.Currency,
+	})
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	claimed, err := dedup.Claim(r.Context(), tx, orderEventsSource, env.EventID)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	if !claimed {
+		result("duplicate")
+		return
+	}
+
+	_, err = tx.ExecContext(r.Context(),
+		"INSERT INTO user_events (user_id, event_type, source, payload, occurred_at) VALUES ($1, $2, $3, $4, $5)",
+		p.UserID, userEventOrderPlaced, userEventsSourceOrders, payload, occurredAt)
+	if pg.IsForeignKeyViolation(err) {
+		// Пользователь уже удалён — журнал ему не нужен, повторять
+		// доставку бессмысленно.
+		result("ignored")
+		return
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	result("recorded")
+}
+
+// startUserEventsPruner удаляет события старше USER_EVENTS_RETENTION (по
+// умолчанию 8760h — год) раз в USER_EVENTS_PRUNE_INTERVAL (по умолчанию
+// 24h). Удаление идёт пачками, чтобы не держать долгие блокировки.
+func startUserEventsPruner(ctx context.Context) {
+	retention, interval := cfg.UserEventsRetention, cfg.UserEventsPruneInterval
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			var total int64
+			for {
+				res, err := db.ExecContext(ctx,
+					`DELETE FROM user_events WHERE id IN (
+					   SELECT id FROM user_events WHERE created_at < $1 ORDER BY id LIMIT 1000)`,
+					time.Now().Add(-retention))
+				if err != nil {
+					if ctx.Err() == nil {
+						log.Printf("⚠️ User events pruning failed: %v", err)
+					}
+					break
+				}
+				n, _ := res.RowsAffected()
+				total += n
+				if n < 1000 {
+					break
+				}
+			}
+			if total > 0 {
+				log.Printf("🧹 Pruned %d user events older than %s", total, retention)
+			}
+		}
+	}()
+}
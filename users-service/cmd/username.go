@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"pkg/apierr"
+	"pkg/pg"
+)
+
+// usernamePattern — 3–30 символов: латиница, цифры, "_" и "."; первая —
+// буква. Регистр сохраняется для отображения, уникальность — без учёта
+// регистра (индекс idx_users_username_lower).
+var usernamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.]{2,29}$`)
+
+// reservedUsernames нельзя занять: их легко принять за служебные.
+var reservedUsernames = map[string]bool{
+	"admin": true, "administrator": true, "root": true, "system": true,
+	"support": true, "help": true, "api": true, "courier": true, "moderator": true,
+}
+
+// usernameRenameCooldown — не чаще одного переименования за этот срок.
+const usernameRenameCooldown = 30 * 24 * time.Hour
+
+// usernameHold — сколько прежний username закреплён за владельцем после
+// переименования (USERNAME_HOLD, по умолчанию 720h): другие не могут его
+// занять, сам владелец может вернуть.
+var usernameHold time.Duration
+
+func initUsernames() {
+	usernameHold = cfg.UsernameHold
+}
+
+// UsernameRequest — тело PATCH /users/{id}/username.
+type UsernameRequest struct {
+	Username string `json:"username"`
+}
+
+// UsernameAvailability — ответ GET /users/check-username.
+type UsernameAvailability struct {
+	Username  string `json:"username"`
+	Available bool   `json:"available"`
+	// Reason — почему недоступен: invalid, taken или reserved.
+	Reason string `json:"reason,omitempty"`
+}
+
+// PublicProfile — данные пользователя для других участников (курьеры и
+// т.п.): без email и служебных полей.
+type PublicProfile struct {
+	ID         int               `json:"id"`
+	Username   *string           `json:"username"`
+	Name       string            `json:"name"`
+	AvatarURLs map[string]string `json:"avatarUrls,omitempty"`
+}
+
+func validateUsername(name string) error {
+	if !usernamePattern.MatchString(name) {
+		return errors.New("username must be 3-30 characters: letters, digits, '_' or '.', starting with a letter")
+	}
+	if reservedUsernames[strings.ToLower(name)] {
+		return errors.New("username is reserved")
+	}
+	return nil
+}
+
+// usernameUnavailable сообщает, занят ли username другим пользователем
+// (taken) или закреплён за чужим прежним владельцем (reserved). exceptID —
+// пользователь, для которого проверяем; 0 при регистрации.
+func usernameUnavailable(ctx context.Context, q queryer, name string, exceptID int) (string, error) {
+	var reason string
+	err := q.QueryRowContext(ctx,
+		`SELECT 'taken' FROM users WHERE LOWER(username) = LOWER($1) AND id <> $2
+		 UNION ALL
+		 SELECT 'reserved' FROM reserved_usernames
+		 WHERE username_lower = LOWER($1) AND user_id <> $2 AND reserved_until > NOW()
+		 LIMIT 1`, name, exceptID).Scan(&reason)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return reason, err
+}
+
+// isUsernameConflict отличает нарушение уникальности username от
+// нарушения уникальности email.
+func isUsernameConflict(err error) bool {
+	return pg.IsUniqueViolation(err) && pg.Constraint(err) == "idx_users_username_lower"
+}
+
+// @Summary Check username
+// @Description Проверить, можно ли занять username. Проверка не резервирует имя.
+// @Tags users
+// @Produce json
+// @Param u query string true "Username"
+// @Success 200 {object} UsernameAvailability
+// @Router /users/check-username [get]
+func checkUsername(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("u")
+	resp := UsernameAvailability{Username: name, Available: true}
+	if err := validateUsername(name); err != nil {
+		resp = UsernameAvailability{Username: name, Reason: "invalid"}
+	} else {
+		reason, err := usernameUnavailable(r.Context(), db, name, 0)
+		if err != nil {
+			apierr.Internal(w, err)
+			return
+		}
+		if reason != "" {
+			resp = UsernameAvailability{Username: name, Reason: reason}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// @Summary Change username
+// @Description Задать или сменить username. Переименование — не чаще раза в 30 дней (429 username_change_too_soon), смена только регистра не ограничена. Прежний username закрепляется за владельцем на USERNAME_HOLD. Требует Bearer-токен этого пользователя или X-Internal-API-Key.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param request body UsernameRequest true "Новый username"
+// @Success 200 {object} User
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "duplicate_username"
+// @Failure 429 {object} map[string]string "username_change_too_soon"
+// @Router /users/{id}/username [patch]
+func changeUsername(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if _, ok := authorizeUser(w, r, id); !ok {
+		return
+	}
+	var req UsernameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+	if err := validateUsername(req.Username); err != nil {
+		apierr.Write(w, apierr.InvalidRequest, err.Error())
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var current sql.NullString
+	var changedAt sql.NullTime
+	err = tx.QueryRowContext(r.Context(),
+		"SELECT username, username_changed_at FROM users WHERE id = $1 FOR UPDATE", id).Scan(&current, &changedAt)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.UserNotFound, "User not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	rename := current.Valid && !strings.EqualFold(current.String, req.Username)
+	if rename && changedAt.Valid {
+		if next := changedAt.Time.Add(usernameRenameCooldown); time.Now().Before(next) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(next).Seconds())+1))
+			apierr.Write(w, apierr.UsernameChangeTooSoon, "Username can be changed again after "+next.UTC().Format(time.RFC3339))
+			return
+		}
+	}
+	if reason, err := usernameUnavailable(r.Context(), tx, req.Username, id); err != nil {
+		apierr.Internal(w, err)
+		return
+	} else if reason != "" {
+		apierr.Write(w, apierr.DuplicateUsername, "Username is not available")
+		return
+	}
+
+	// Смена только регистра не считается переименованием.
+	var u User
+	err = scanUser(tx.QueryRowContext(r.Context(),
+		`UPDATE users SET username = $2,
+		   username_changed_at = CASE WHEN $3 OR username IS NULL THEN NOW() ELSE username_changed_at END,
+		   updated_at = NOW()
+		 WHERE id = $1 RETURNING `+userColumns,
+		id, req.Username, rename), &u)
+	if isUsernameConflict(err) {
+		apierr.Write(w, apierr.DuplicateUsername, "Username is not available")
+		return
+	}
+	if err == nil && rename {
+		_, err = tx.ExecContext(r.Context(),
+			`INSERT INTO reserved_usernames (username_lower, user_id, reserved_until)
+			 VALUES (LOWER($1), $2, NOW() + $3 * INTERVAL '1 second')
+			 ON CONFLICT (username_lower) DO UPDATE SET user_id = EXCLUDED.user_id, reserved_until = EXCLUDED.reserved_until`,
+			current.String, id, usernameHold.Seconds())
+	}
+	if err == nil && (rename || !current.Valid) {
+		err = recordUserEvent(r.Context(), tx, id, userEventUsernameChanged,
+			map[string]interface{}{"old_username": current.String, "new_username": req.Username})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+	userCache.Delete(r.Context(), strconv.Itoa(id))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u)
+}
+
+// @Summary Public profile
+// @Description Профиль пользователя без email — для сервисов и людей, которым адрес знать не нужно (например, курьерам).
+// @Tags users
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} PublicProfile
+// @Failure 404 {object} map[string]string
+// @Router /users/{id}/profile [get]
+func getPublicProfile(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	var u User
+	err := scanUser(db.QueryRowContext(r.Context(), "SELECT "+userColumns+" FROM users WHERE id = $1", id), &u)
+	if err == sql.ErrNoRows {
+		apierr.Write(w, apierr.UserNotFound, "User not found")
+		return
+	} else if err != nil {
+		apierr.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PublicProfile{ID: u.ID, Username: u.Username, Name: u.Name, AvatarURLs: u.AvatarURLs})
+}